@@ -13,6 +13,7 @@ import (
 	"pika/codis/v2/pkg/models"
 	"pika/codis/v2/pkg/utils"
 	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
 )
 
 type cmdAdmin struct {
@@ -33,6 +34,8 @@ func (t *cmdAdmin) Main(d map[string]interface{}) {
 		t.handleConfigRestore(d)
 	case d["--dashboard-list"].(bool):
 		t.handleDashboardList(d)
+	case d["--issue-token"].(bool):
+		t.handleIssueToken(d)
 	}
 }
 
@@ -434,3 +437,30 @@ func (t *cmdAdmin) handleDashboardList(d map[string]interface{}) {
 		fmt.Println(string(b))
 	}
 }
+
+func (t *cmdAdmin) handleIssueToken(d map[string]interface{}) {
+	var role = rpc.RoleRead
+	if s, ok := utils.Argument(d, "--role"); ok {
+		role = s
+	}
+	var ttl = time.Hour * 24
+	if s, ok := utils.Argument(d, "--ttl"); ok {
+		v, err := time.ParseDuration(s)
+		if err != nil || v <= 0 {
+			log.Panicf("option --ttl = %s", s)
+		}
+		ttl = v
+	}
+	var subject = "codis-admin"
+	if s, ok := utils.Argument(d, "--subject"); ok {
+		subject = s
+	}
+
+	claims := rpc.NewTokenClaims(subject, role, ttl)
+	token, err := rpc.IssueToken(utils.ArgumentMust(d, "--token-secret"), claims)
+	if err != nil {
+		log.PanicErrorf(err, "issue token failed")
+	}
+	log.Debugf("issue token of %s, role = %s, expire at %s", subject, role, time.Unix(claims.ExpiresAt, 0))
+	fmt.Println(token)
+}
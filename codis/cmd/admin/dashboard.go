@@ -6,14 +6,19 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"pika/codis/v2/pkg/models"
 	"pika/codis/v2/pkg/topom"
 	"pika/codis/v2/pkg/utils"
+	"pika/codis/v2/pkg/utils/bytesize"
 	"pika/codis/v2/pkg/utils/log"
 	"pika/codis/v2/pkg/utils/math2"
+	"pika/codis/v2/pkg/utils/rpc"
 )
 
 type cmdDashboard struct {
@@ -34,6 +39,8 @@ func (t *cmdDashboard) Main(d map[string]interface{}) {
 		t.handleReload(d)
 	case d["--log-level"] != nil:
 		t.handleLogLevel(d)
+	case d["--profile"] != nil:
+		t.handleProfile(d)
 
 	case d["--slots-assign"].(bool):
 		fallthrough
@@ -77,6 +84,39 @@ func (t *cmdDashboard) Main(d map[string]interface{}) {
 	case d["--rebalance"].(bool):
 		t.handleSlotRebalance(d)
 
+	case d["--commands-status"].(bool):
+		fallthrough
+	case d["--commands-update"].(bool):
+		fallthrough
+	case d["--commands-resync"].(bool):
+		t.handleCommandsCommand(d)
+
+	case d["--auth-rotation-status"].(bool):
+		fallthrough
+	case d["--auth-rotation-start"].(bool):
+		fallthrough
+	case d["--auth-rotation-resync"].(bool):
+		fallthrough
+	case d["--auth-rotation-clear"].(bool):
+		t.handleAuthRotationCommand(d)
+
+	case d["--quota-status"].(bool):
+		fallthrough
+	case d["--quota-set"].(bool):
+		fallthrough
+	case d["--quota-del"].(bool):
+		fallthrough
+	case d["--quota-resync"].(bool):
+		t.handleQuotaCommand(d)
+
+	case d["--qps-limit"] != nil:
+		t.handleQPSLimitCommand(d)
+
+	case d["--config-history"].(bool):
+		fallthrough
+	case d["--config-rollback"] != nil:
+		t.handleConfigHistoryCommand(d)
+
 	}
 }
 
@@ -174,6 +214,28 @@ func (t *cmdDashboard) handleLogLevel(d map[string]interface{}) {
 	log.Debugf("call rpc loglevel OK")
 }
 
+func (t *cmdDashboard) handleProfile(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	kind := utils.ArgumentMust(d, "--profile")
+	output := utils.ArgumentMust(d, "--output")
+	seconds, ok := utils.ArgumentInteger(d, "--seconds")
+	if !ok {
+		seconds = rpc.DefaultProfileSeconds
+	}
+
+	log.Debugf("call rpc profile to dashboard %s", t.addr)
+	b, err := c.Profile(kind, seconds)
+	if err != nil {
+		log.PanicErrorf(err, "call rpc profile to dashboard %s failed", t.addr)
+	}
+	log.Debugf("call rpc profile OK")
+
+	if err := ioutil.WriteFile(output, b, 0644); err != nil {
+		log.PanicErrorf(err, "write profile to %s failed", output)
+	}
+}
+
 func (t *cmdDashboard) handleShutdown(d map[string]interface{}) {
 	c := t.newTopomClient()
 
@@ -765,3 +827,269 @@ func (t *cmdDashboard) handleSlotRebalance(d map[string]interface{}) {
 		fmt.Println("done")
 	}
 }
+
+func (t *cmdDashboard) handleCommandsCommand(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	switch {
+
+	case d["--commands-status"].(bool):
+
+		log.Debugf("call rpc stats to dashboard %s", t.addr)
+		s, err := c.Stats()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc stats to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc stats OK")
+
+		b, err := json.MarshalIndent(s.Commands, "", "    ")
+		if err != nil {
+			log.PanicErrorf(err, "json marshal failed")
+		}
+		fmt.Println(string(b))
+
+	case d["--commands-update"].(bool):
+
+		// e.g. --disable-cmds=KEYS,DEL --rename-cmds=FLUSHDB:FLUSHDB_7f3c,FLUSHALL:
+		//      --cmd-timeouts=quick:1s,slow:2m --cmd-classes=LRANGE:slow
+		commands := &models.Commands{}
+		if s, ok := utils.Argument(d, "--disable-cmds"); ok {
+			for _, name := range strings.Split(s, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					commands.Disabled = append(commands.Disabled, name)
+				}
+			}
+		}
+		if s, ok := utils.Argument(d, "--rename-cmds"); ok {
+			commands.Renamed = make(map[string]string)
+			for _, pair := range strings.Split(s, ",") {
+				if pair = strings.TrimSpace(pair); pair == "" {
+					continue
+				}
+				kv := strings.SplitN(pair, ":", 2)
+				if len(kv) != 2 {
+					log.Panicf("invalid rename '%s', should be CMD:ALIAS", pair)
+				}
+				commands.Renamed[kv[0]] = kv[1]
+			}
+		}
+		if s, ok := utils.Argument(d, "--cmd-timeouts"); ok {
+			commands.Timeouts = make(map[string]string)
+			for _, pair := range strings.Split(s, ",") {
+				if pair = strings.TrimSpace(pair); pair == "" {
+					continue
+				}
+				kv := strings.SplitN(pair, ":", 2)
+				if len(kv) != 2 {
+					log.Panicf("invalid timeout '%s', should be CLASS:DURATION", pair)
+				}
+				commands.Timeouts[kv[0]] = kv[1]
+			}
+		}
+		if s, ok := utils.Argument(d, "--cmd-classes"); ok {
+			commands.Classes = make(map[string]string)
+			for _, pair := range strings.Split(s, ",") {
+				if pair = strings.TrimSpace(pair); pair == "" {
+					continue
+				}
+				kv := strings.SplitN(pair, ":", 2)
+				if len(kv) != 2 {
+					log.Panicf("invalid class '%s', should be CMD:CLASS", pair)
+				}
+				commands.Classes[kv[0]] = kv[1]
+			}
+		}
+
+		log.Debugf("call rpc update-commands to dashboard %s", t.addr)
+		if err := c.UpdateCommands(commands); err != nil {
+			log.PanicErrorf(err, "call rpc update-commands to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc update-commands OK")
+
+	case d["--commands-resync"].(bool):
+
+		log.Debugf("call rpc resync-commands to dashboard %s", t.addr)
+		if err := c.ResyncCommands(); err != nil {
+			log.PanicErrorf(err, "call rpc resync-commands to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc resync-commands OK")
+
+	}
+}
+
+func (t *cmdDashboard) handleAuthRotationCommand(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	switch {
+
+	case d["--auth-rotation-status"].(bool):
+
+		log.Debugf("call rpc stats to dashboard %s", t.addr)
+		s, err := c.Stats()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc stats to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc stats OK")
+
+		b, err := json.MarshalIndent(s.AuthRotation, "", "    ")
+		if err != nil {
+			log.PanicErrorf(err, "json marshal failed")
+		}
+		fmt.Println(string(b))
+
+	case d["--auth-rotation-start"].(bool):
+
+		var window = time.Hour
+		if s, ok := utils.Argument(d, "--window"); ok {
+			v, err := time.ParseDuration(s)
+			if err != nil || v <= 0 {
+				log.Panicf("option --window = %s", s)
+			}
+			window = v
+		}
+		r := &models.AuthRotation{Deadline: time.Now().Add(window).Unix()}
+		r.ProductAuth, _ = utils.Argument(d, "--product-auth")
+		r.SessionAuth, _ = utils.Argument(d, "--session-auth")
+
+		log.Debugf("call rpc update-auth-rotation to dashboard %s", t.addr)
+		if err := c.UpdateAuthRotation(r); err != nil {
+			log.PanicErrorf(err, "call rpc update-auth-rotation to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc update-auth-rotation OK")
+
+	case d["--auth-rotation-resync"].(bool):
+
+		log.Debugf("call rpc resync-auth-rotation to dashboard %s", t.addr)
+		if err := c.ResyncAuthRotation(); err != nil {
+			log.PanicErrorf(err, "call rpc resync-auth-rotation to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc resync-auth-rotation OK")
+
+	case d["--auth-rotation-clear"].(bool):
+
+		log.Debugf("call rpc clear-auth-rotation to dashboard %s", t.addr)
+		if err := c.ClearAuthRotation(); err != nil {
+			log.PanicErrorf(err, "call rpc clear-auth-rotation to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc clear-auth-rotation OK")
+
+	}
+}
+
+func (t *cmdDashboard) handleQuotaCommand(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	log.Debugf("call rpc stats to dashboard %s", t.addr)
+	s, err := c.Stats()
+	if err != nil {
+		log.PanicErrorf(err, "call rpc stats to dashboard %s failed", t.addr)
+	}
+	log.Debugf("call rpc stats OK")
+
+	var quotas = s.Quotas
+	if quotas == nil {
+		quotas = &models.Quotas{}
+	}
+
+	switch {
+
+	case d["--quota-status"].(bool):
+
+		b, err := json.MarshalIndent(quotas, "", "    ")
+		if err != nil {
+			log.PanicErrorf(err, "json marshal failed")
+		}
+		fmt.Println(string(b))
+
+	case d["--quota-set"].(bool), d["--quota-del"].(bool):
+
+		var user = utils.ArgumentMust(d, "--user")
+		if quotas.Users == nil {
+			quotas.Users = make(map[string]*models.Quota)
+		}
+		if d["--quota-set"].(bool) {
+			q := &models.Quota{}
+			if n, ok := utils.ArgumentInteger(d, "--qps"); ok {
+				q.QPS = int64(n)
+			}
+			if n, ok := utils.ArgumentInteger(d, "--max-conns"); ok {
+				q.Connections = int64(n)
+			}
+			size := func(name string) int64 {
+				if s, ok := utils.Argument(d, name); ok {
+					n, err := bytesize.Parse(s)
+					if err != nil {
+						log.PanicErrorf(err, "option %s isn't a valid size", name)
+					}
+					return n
+				}
+				return 0
+			}
+			q.Bandwidth = size("--bandwidth")
+			q.Memory = size("--max-memory")
+			quotas.Users[user] = q
+		} else {
+			delete(quotas.Users, user)
+		}
+
+		log.Debugf("call rpc update-quotas to dashboard %s", t.addr)
+		if err := c.UpdateQuotas(quotas); err != nil {
+			log.PanicErrorf(err, "call rpc update-quotas to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc update-quotas OK")
+
+	case d["--quota-resync"].(bool):
+
+		log.Debugf("call rpc resync-quotas to dashboard %s", t.addr)
+		if err := c.ResyncQuotas(); err != nil {
+			log.PanicErrorf(err, "call rpc resync-quotas to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc resync-quotas OK")
+
+	}
+}
+
+func (t *cmdDashboard) handleQPSLimitCommand(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	value := utils.ArgumentIntegerMust(d, "--qps-limit")
+
+	log.Debugf("call rpc set-qps-limit to dashboard %s", t.addr)
+	if err := c.SetProductQPSLimit(int64(value)); err != nil {
+		log.PanicErrorf(err, "call rpc set-qps-limit to dashboard %s failed", t.addr)
+	}
+	log.Debugf("call rpc set-qps-limit OK")
+}
+
+func (t *cmdDashboard) handleConfigHistoryCommand(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	switch {
+
+	case d["--config-history"].(bool):
+
+		log.Debugf("call rpc config-history to dashboard %s", t.addr)
+		h, err := c.ConfigHistory()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc config-history to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc config-history OK")
+
+		b, err := json.MarshalIndent(h, "", "    ")
+		if err != nil {
+			log.PanicErrorf(err, "json marshal failed")
+		}
+		fmt.Println(string(b))
+
+	case d["--config-rollback"] != nil:
+
+		version := utils.ArgumentIntegerMust(d, "--config-rollback")
+
+		log.Debugf("call rpc rollback-config to dashboard %s", t.addr)
+		if err := c.RollbackConfig(int64(version)); err != nil {
+			log.PanicErrorf(err, "call rpc rollback-config to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc rollback-config OK")
+
+	}
+}
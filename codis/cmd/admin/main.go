@@ -4,58 +4,82 @@
 package main
 
 import (
+	"os"
+
 	"github.com/docopt/docopt-go"
 
+	"pika/codis/v2/pkg/utils"
 	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/tls2"
 )
 
 func main() {
 	const usage = `
 Usage:
-	codis-admin [-v] --proxy=ADDR [--auth=AUTH] [config|model|stats|slots]
-	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --start
-	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --shutdown
-	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --log-level=LEVEL
-	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --fillslots=FILE [--locked]
-	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --reset-stats
-	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --forcegc
-	codis-admin [-v] --dashboard=ADDR           [config|model|stats|slots|group|proxy]
-	codis-admin [-v] --dashboard=ADDR            --shutdown
-	codis-admin [-v] --dashboard=ADDR            --reload
-	codis-admin [-v] --dashboard=ADDR            --log-level=LEVEL
-	codis-admin [-v] --dashboard=ADDR            --slots-assign   --beg=ID --end=ID (--gid=ID|--offline) [--confirm]
-	codis-admin [-v] --dashboard=ADDR            --slots-status
-	codis-admin [-v] --dashboard=ADDR            --list-proxy
-	codis-admin [-v] --dashboard=ADDR            --create-proxy   --addr=ADDR
-	codis-admin [-v] --dashboard=ADDR            --online-proxy   --addr=ADDR
-	codis-admin [-v] --dashboard=ADDR            --remove-proxy  (--addr=ADDR|--token=TOKEN|--pid=ID)       [--force]
-	codis-admin [-v] --dashboard=ADDR            --reinit-proxy  (--addr=ADDR|--token=TOKEN|--pid=ID|--all) [--force]
-	codis-admin [-v] --dashboard=ADDR            --proxy-status
-	codis-admin [-v] --dashboard=ADDR            --list-group
-	codis-admin [-v] --dashboard=ADDR            --create-group   --gid=ID
-	codis-admin [-v] --dashboard=ADDR            --remove-group   --gid=ID
-	codis-admin [-v] --dashboard=ADDR            --resync-group  [--gid=ID | --all]
-	codis-admin [-v] --dashboard=ADDR            --group-add      --gid=ID --addr=ADDR [--datacenter=DATACENTER]
-	codis-admin [-v] --dashboard=ADDR            --group-del      --gid=ID --addr=ADDR
-	codis-admin [-v] --dashboard=ADDR            --group-status
-	codis-admin [-v] --dashboard=ADDR            --replica-groups --gid=ID --addr=ADDR (--enable|--disable)
-	codis-admin [-v] --dashboard=ADDR            --promote-server --gid=ID --addr=ADDR
-	codis-admin [-v] --dashboard=ADDR            --sync-action    --create --addr=ADDR
-	codis-admin [-v] --dashboard=ADDR            --sync-action    --remove --addr=ADDR
-	codis-admin [-v] --dashboard=ADDR            --slot-action    --create --sid=ID --gid=ID
-	codis-admin [-v] --dashboard=ADDR            --slot-action    --remove --sid=ID
-	codis-admin [-v] --dashboard=ADDR            --slot-action    --create-some  --gid-from=ID --gid-to=ID --num-slots=N
-	codis-admin [-v] --dashboard=ADDR            --slot-action    --create-range --beg=ID --end=ID --gid=ID
-	codis-admin [-v] --dashboard=ADDR            --slot-action    --interval=VALUE
-	codis-admin [-v] --dashboard=ADDR            --slot-action    --disabled=VALUE
-	codis-admin [-v] --dashboard=ADDR            --rebalance     [--confirm]
-	codis-admin [-v] --dashboard=ADDR            --sentinel-add   --addr=ADDR
-	codis-admin [-v] --dashboard=ADDR            --sentinel-del   --addr=ADDR [--force]
-	codis-admin [-v] --dashboard=ADDR            --sentinel-resync
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH] [config|model|stats|slots]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --start
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --shutdown
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --log-level=LEVEL
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --log-format=FORMAT
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --fillslots=FILE [--locked]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --reset-stats
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --forcegc
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --profile=KIND [--seconds=N] --output=FILE
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --proxy=ADDR [--auth=AUTH]  --runtime [--gogc=N] [--gomemlimit=SIZE] [--gomaxprocs=N] [--primary-parallel=N] [--replica-parallel=N]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR           [config|model|stats|slots|group|proxy]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --shutdown
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --reload
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --log-level=LEVEL
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --profile=KIND [--seconds=N] --output=FILE
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slots-assign   --beg=ID --end=ID (--gid=ID|--offline) [--confirm]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slots-status
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --list-proxy
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --create-proxy   --addr=ADDR
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --online-proxy   --addr=ADDR
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --remove-proxy  (--addr=ADDR|--token=TOKEN|--pid=ID)       [--force]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --reinit-proxy  (--addr=ADDR|--token=TOKEN|--pid=ID|--all) [--force]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --proxy-status
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --list-group
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --create-group   --gid=ID
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --remove-group   --gid=ID
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --resync-group  [--gid=ID | --all]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --group-add      --gid=ID --addr=ADDR [--datacenter=DATACENTER]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --group-del      --gid=ID --addr=ADDR
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --group-status
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --replica-groups --gid=ID --addr=ADDR (--enable|--disable)
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --promote-server --gid=ID --addr=ADDR
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --sync-action    --create --addr=ADDR
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --sync-action    --remove --addr=ADDR
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slot-action    --create --sid=ID --gid=ID
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slot-action    --remove --sid=ID
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slot-action    --create-some  --gid-from=ID --gid-to=ID --num-slots=N
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slot-action    --create-range --beg=ID --end=ID --gid=ID
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slot-action    --interval=VALUE
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --slot-action    --disabled=VALUE
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --rebalance     [--confirm]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --commands-status
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --commands-update [--disable-cmds=CMDS] [--rename-cmds=CMDS] [--cmd-timeouts=TIMEOUTS] [--cmd-classes=CLASSES]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --commands-resync
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --auth-rotation-status
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --auth-rotation-start [--product-auth=AUTH] [--session-auth=AUTH] [--window=DURATION]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --auth-rotation-resync
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --auth-rotation-clear
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --quota-status
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --quota-set    --user=NAME [--qps=N] [--bandwidth=SIZE] [--max-conns=N] [--max-memory=SIZE]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --quota-del    --user=NAME
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --quota-resync
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --qps-limit=N
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --config-history
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --config-rollback=VERSION
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --sentinel-add   --addr=ADDR
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --sentinel-del   --addr=ADDR [--force]
+	codis-admin [-v] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR            --sentinel-resync
 	codis-admin [-v] --remove-lock               --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT)
 	codis-admin [-v] --config-dump               --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT) [-1]
 	codis-admin [-v] --config-convert=FILE
 	codis-admin [-v] --config-restore=FILE       --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT) [--confirm]
+	codis-admin [-v] --issue-token               --token-secret=SECRET [--role=ROLE] [--ttl=DURATION] [--subject=NAME]
 	codis-admin [-v] --dashboard-list                           (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT)
 
 Options:
@@ -63,6 +87,12 @@ Options:
 	-x ADDR, --addr=ADDR
 	-t TOKEN, --token=TOKEN
 	-g ID, --gid=ID
+	--tls-ca=FILE        set the CAs to verify codis-proxy and codis-dashboard of mutual TLS.
+	--tls-cert=FILE      set the certificate of mutual TLS.
+	--tls-key=FILE       set the key of the certificate.
+
+Environment:
+	CODIS_ADMIN_TOKEN    the token sent to the admin API of codis-proxy and codis-dashboard.
 `
 
 	d, err := docopt.Parse(usage, nil, true, "", false)
@@ -75,6 +105,21 @@ Options:
 		log.SetLevel(log.LevelDebug)
 	}
 
+	if s, ok := utils.Argument(d, "--tls-cert"); ok {
+		err := rpc.SetupTLS(tls2.Files{
+			CertFile: s,
+			KeyFile:  utils.ArgumentMust(d, "--tls-key"),
+			CAFile:   utils.ArgumentMust(d, "--tls-ca"),
+		}, nil)
+		if err != nil {
+			log.PanicErrorf(err, "setup tls failed")
+		}
+	}
+
+	if s := os.Getenv("CODIS_ADMIN_TOKEN"); s != "" {
+		rpc.SetClientToken(s)
+	}
+
 	switch {
 	case d["--proxy"] != nil:
 		new(cmdProxy).Main(d)
@@ -11,7 +11,9 @@ import (
 	"pika/codis/v2/pkg/models"
 	"pika/codis/v2/pkg/proxy"
 	"pika/codis/v2/pkg/utils"
+	"pika/codis/v2/pkg/utils/bytesize"
 	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
 )
 
 type cmdProxy struct {
@@ -32,12 +34,18 @@ func (t *cmdProxy) Main(d map[string]interface{}) {
 		t.handleShutdown(d)
 	case d["--log-level"] != nil:
 		t.handleLogLevel(d)
+	case d["--log-format"] != nil:
+		t.handleLogFormat(d)
 	case d["--fillslots"] != nil:
 		t.handleFillSlots(d)
 	case d["--reset-stats"].(bool):
 		t.handleResetStats(d)
 	case d["--forcegc"].(bool):
 		t.handleForceGC(d)
+	case d["--profile"] != nil:
+		t.handleProfile(d)
+	case d["--runtime"].(bool):
+		t.handleRuntime(d)
 	}
 }
 
@@ -131,6 +139,23 @@ func (t *cmdProxy) handleLogLevel(d map[string]interface{}) {
 	log.Debugf("call rpc loglevel OK")
 }
 
+func (t *cmdProxy) handleLogFormat(d map[string]interface{}) {
+	c := t.newProxyClient(true)
+
+	s := utils.ArgumentMust(d, "--log-format")
+
+	var v log.LogFormat
+	if !v.ParseFromString(s) {
+		log.Panicf("option --log-format = %s", s)
+	}
+
+	log.Debugf("call rpc logformat to proxy %s", t.addr)
+	if err := c.LogFormat(v); err != nil {
+		log.PanicErrorf(err, "call rpc logformat to proxy %s failed", t.addr)
+	}
+	log.Debugf("call rpc logformat OK")
+}
+
 func (t *cmdProxy) handleFillSlots(d map[string]interface{}) {
 	c := t.newProxyClient(true)
 
@@ -183,6 +208,73 @@ func (t *cmdProxy) handleForceGC(d map[string]interface{}) {
 	log.Debugf("call rpc forcegc OK")
 }
 
+func (t *cmdProxy) handleProfile(d map[string]interface{}) {
+	c := t.newProxyClient(true)
+
+	kind := utils.ArgumentMust(d, "--profile")
+	output := utils.ArgumentMust(d, "--output")
+	seconds, ok := utils.ArgumentInteger(d, "--seconds")
+	if !ok {
+		seconds = rpc.DefaultProfileSeconds
+	}
+
+	log.Debugf("call rpc profile to proxy %s", t.addr)
+	b, err := c.Profile(kind, seconds)
+	if err != nil {
+		log.PanicErrorf(err, "call rpc profile to proxy %s failed", t.addr)
+	}
+	log.Debugf("call rpc profile OK")
+
+	if err := ioutil.WriteFile(output, b, 0644); err != nil {
+		log.PanicErrorf(err, "write profile to %s failed", output)
+	}
+}
+
+func (t *cmdProxy) handleRuntime(d map[string]interface{}) {
+	c := t.newProxyClient(true)
+
+	var tuning proxy.RuntimeTuning
+	if n, ok := utils.ArgumentInteger(d, "--gogc"); ok {
+		tuning.GCPercent = &n
+	}
+	if s, ok := utils.Argument(d, "--gomemlimit"); ok {
+		n, err := bytesize.Parse(s)
+		if err != nil {
+			log.PanicErrorf(err, "option --gomemlimit isn't a valid size")
+		}
+		tuning.MemoryLimit = &n
+	}
+	if n, ok := utils.ArgumentInteger(d, "--gomaxprocs"); ok {
+		tuning.MaxProcs = &n
+	}
+	if n, ok := utils.ArgumentInteger(d, "--primary-parallel"); ok {
+		tuning.PrimaryParallel = &n
+	}
+	if n, ok := utils.ArgumentInteger(d, "--replica-parallel"); ok {
+		tuning.ReplicaParallel = &n
+	}
+
+	var stats *proxy.RuntimeTuningStats
+	var err error
+	if tuning == (proxy.RuntimeTuning{}) {
+		log.Debugf("call rpc runtime to proxy %s", t.addr)
+		stats, err = c.RuntimeTuning()
+	} else {
+		log.Debugf("call rpc set-runtime to proxy %s", t.addr)
+		stats, err = c.SetRuntimeTuning(&tuning)
+	}
+	if err != nil {
+		log.PanicErrorf(err, "call rpc runtime to proxy %s failed", t.addr)
+	}
+	log.Debugf("call rpc runtime OK")
+
+	b, err := json.MarshalIndent(stats, "", "    ")
+	if err != nil {
+		log.PanicErrorf(err, "json marshal failed")
+	}
+	fmt.Println(string(b))
+}
+
 func (t *cmdProxy) handleShutdown(d map[string]interface{}) {
 	c := t.newProxyClient(true)
 
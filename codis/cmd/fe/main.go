@@ -29,6 +29,7 @@ import (
 	"pika/codis/v2/pkg/utils/log"
 	"pika/codis/v2/pkg/utils/rpc"
 	"pika/codis/v2/pkg/utils/sync2/atomic2"
+	"pika/codis/v2/pkg/utils/tls2"
 )
 
 var roundTripper http.RoundTripper
@@ -56,7 +57,7 @@ func init() {
 func main() {
 	const usage = `
 Usage:
-	codis-fe [--ncpu=N] [--log=FILE] [--log-level=LEVEL] [--assets-dir=PATH] [--pidfile=FILE] (--dashboard-list=FILE|--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT) --listen=ADDR
+	codis-fe [--ncpu=N] [--log=FILE] [--log-level=LEVEL] [--assets-dir=PATH] [--pidfile=FILE] [--tls-cert=FILE --tls-key=FILE --tls-ca=FILE [--tls-allowed-names=NAMES]] [--admin-token-secret=SECRET] (--dashboard-list=FILE|--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT) --listen=ADDR
 	codis-fe  --version
 
 Options:
@@ -65,6 +66,11 @@ Options:
 	-l FILE, --log=FILE             set path/name of daliy rotated log file.
 	--log-level=LEVEL               set the log-level, should be INFO,WARN,DEBUG or ERROR, default is INFO.
 	--listen=ADDR                   set the listen address.
+	--tls-cert=FILE                 set the certificate of mutual TLS to dashboards.
+	--tls-key=FILE                  set the key of the certificate.
+	--tls-ca=FILE                   set the CAs to verify dashboards.
+	--tls-allowed-names=NAMES       set the comma separated names allowed of dashboards.
+	--admin-token-secret=SECRET     set the secret to sign tokens of requests to dashboards.
 `
 	d, err := docopt.Parse(usage, nil, true, "", false)
 	if err != nil {
@@ -103,6 +109,30 @@ Options:
 	listen := utils.ArgumentMust(d, "--listen")
 	log.Warnf("set listen = %s", listen)
 
+	if s, ok := utils.Argument(d, "--tls-cert"); ok {
+		var names string
+		if x, ok := utils.Argument(d, "--tls-allowed-names"); ok {
+			names = x
+		}
+		err := rpc.SetupTLS(tls2.Files{
+			CertFile: s,
+			KeyFile:  utils.ArgumentMust(d, "--tls-key"),
+			CAFile:   utils.ArgumentMust(d, "--tls-ca"),
+		}, rpc.ParseNames(names))
+		if err != nil {
+			log.PanicErrorf(err, "setup tls failed")
+		}
+		roundTripper.(*http.Transport).TLSClientConfig = rpc.ClientTLSConfig()
+		log.Warnf("set tls-cert = %s", s)
+	}
+
+	if s, ok := utils.Argument(d, "--admin-token-secret"); ok {
+		if err := rpc.SetupToken(s, "codis-fe"); err != nil {
+			log.PanicErrorf(err, "setup token failed")
+		}
+		log.Warnf("set admin-token-secret = ******")
+	}
+
 	var assets string
 	if s, ok := utils.Argument(d, "--assets-dir"); ok {
 		abspath, err := filepath.Abs(s)
@@ -304,9 +334,16 @@ func (r *ReverseProxy) reload(d time.Duration) {
 			if name == "" || host == "" {
 				continue
 			}
-			u := &url.URL{Scheme: "http", Host: host}
+			u := &url.URL{Scheme: rpc.Scheme(), Host: host}
 			p := httputil.NewSingleHostReverseProxy(u)
 			p.Transport = roundTripper
+			director := p.Director
+			p.Director = func(req *http.Request) {
+				director(req)
+				if err := rpc.SetAuthorization(req); err != nil {
+					log.WarnErrorf(err, "sign token failed")
+				}
+			}
 			r.routes[name] = p
 		}
 	}
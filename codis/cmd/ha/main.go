@@ -5,6 +5,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"time"
 
@@ -15,17 +16,26 @@ import (
 	"pika/codis/v2/pkg/utils/log"
 	"pika/codis/v2/pkg/utils/math2"
 	"pika/codis/v2/pkg/utils/redis"
+	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/tls2"
 )
 
 func main() {
 	const usage = `
 Usage:
-	codis-ha [--log=FILE] [--log-level=LEVEL] [--interval=SECONDS] --dashboard=ADDR [--no-maintains]
+	codis-ha [--log=FILE] [--log-level=LEVEL] [--interval=SECONDS] [--admin-token-secret=SECRET] [--tls-ca=FILE --tls-cert=FILE --tls-key=FILE] --dashboard=ADDR [--no-maintains]
 	codis-ha  --version
 
 Options:
 	-l FILE, --log=FILE         set path/name of daliy rotated log file.
 	--log-level=LEVEL           set the log-level, should be INFO,WARN,DEBUG or ERROR, default is INFO.
+	--admin-token-secret=SECRET set the secret to sign tokens of requests to the dashboard.
+	--tls-ca=FILE               set the CAs to verify the dashboard of mutual TLS.
+	--tls-cert=FILE             set the certificate of mutual TLS.
+	--tls-key=FILE              set the key of the certificate.
+
+Environment:
+	CODIS_ADMIN_TOKEN           the token sent to the dashboard, unless --admin-token-secret is set.
 `
 	d, err := docopt.Parse(usage, nil, true, "", false)
 	if err != nil {
@@ -62,6 +72,27 @@ Options:
 		interval = n
 	}
 
+	if s, ok := utils.Argument(d, "--tls-cert"); ok {
+		err := rpc.SetupTLS(tls2.Files{
+			CertFile: s,
+			KeyFile:  utils.ArgumentMust(d, "--tls-key"),
+			CAFile:   utils.ArgumentMust(d, "--tls-ca"),
+		}, nil)
+		if err != nil {
+			log.PanicErrorf(err, "setup tls failed")
+		}
+		log.Warnf("set tls-cert = %s", s)
+	}
+
+	if s, ok := utils.Argument(d, "--admin-token-secret"); ok {
+		if err := rpc.SetupToken(s, "codis-ha"); err != nil {
+			log.PanicErrorf(err, "setup token failed")
+		}
+		log.Warnf("set admin-token-secret = ******")
+	} else if s := os.Getenv("CODIS_ADMIN_TOKEN"); s != "" {
+		rpc.SetClientToken(s)
+	}
+
 	dashboard := utils.ArgumentMust(d, "--dashboard")
 	log.Warnf("set dashboard = %s", dashboard)
 	log.Warnf("set interval = %d (seconds)", interval)
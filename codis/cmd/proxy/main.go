@@ -24,6 +24,7 @@ import (
 	"pika/codis/v2/pkg/proxy"
 	"pika/codis/v2/pkg/topom"
 	"pika/codis/v2/pkg/utils"
+	"pika/codis/v2/pkg/utils/bytesize"
 	"pika/codis/v2/pkg/utils/log"
 	"pika/codis/v2/pkg/utils/math2"
 )
@@ -31,7 +32,7 @@ import (
 func main() {
 	const usage = `
 Usage:
-	codis-proxy [--ncpu=N [--max-ncpu=MAX]] [--config=CONF] [--log=FILE] [--log-level=LEVEL] [--host-admin=ADDR] [--host-proxy=ADDR] [--dashboard=ADDR|--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT|--fillslots=FILE] [--ulimit=NLIMIT] [--pidfile=FILE] [--product_name=NAME] [--product_auth=AUTH] [--session_auth=AUTH]
+	codis-proxy [--ncpu=N [--max-ncpu=MAX]] [--config=CONF] [--log=FILE [--log-max-size=SIZE] [--log-max-backups=N] [--log-compress]] [--log-level=LEVEL] [--log-format=FORMAT] [--host-admin=ADDR] [--host-proxy=ADDR] [--dashboard=ADDR|--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT|--fillslots=FILE] [--ulimit=NLIMIT] [--pidfile=FILE] [--product_name=NAME] [--product_auth=AUTH] [--session_auth=AUTH]
 	codis-proxy  --default-config
 	codis-proxy  --version
 
@@ -39,7 +40,11 @@ Options:
 	--ncpu=N                    set runtime.GOMAXPROCS to N, default is runtime.NumCPU().
 	-c CONF, --config=CONF      run with the specific configuration.
 	-l FILE, --log=FILE         set path/name of daliy rotated log file.
+	--log-max-size=SIZE         rotate the log file once it exceeds SIZE, e.g. 256mb, default is unlimited.
+	--log-max-backups=N         keep at most N rotated log files, default is to keep all.
+	--log-compress              compress the rotated log files by gzip.
 	--log-level=LEVEL           set the log-level, should be INFO,WARN,DEBUG or ERROR, default is INFO.
+	--log-format=FORMAT         set the log-format, should be TEXT or JSON, default is TEXT.
 	--ulimit=NLIMIT             run 'ulimit -n' to check the maximum number of open file descriptors.
 `
 
@@ -62,7 +67,19 @@ Options:
 	}
 
 	if s, ok := utils.Argument(d, "--log"); ok {
-		w, err := log.NewRollingFile(s, log.DailyRolling)
+		var options = log.RollingOptions{Rolling: log.DailyRolling}
+		if v, ok := utils.Argument(d, "--log-max-size"); ok {
+			n, err := bytesize.Parse(v)
+			if err != nil || n <= 0 {
+				log.Panicf("option --log-max-size = %s", v)
+			}
+			options.MaxSize = n
+		}
+		if n, ok := utils.ArgumentInteger(d, "--log-max-backups"); ok {
+			options.MaxBackups = n
+		}
+		options.Compress = d["--log-compress"].(bool)
+		w, err := log.NewRollingFileOptions(s, options)
 		if err != nil {
 			log.PanicErrorf(err, "open log file %s failed", s)
 		} else {
@@ -77,6 +94,12 @@ Options:
 		}
 	}
 
+	if s, ok := utils.Argument(d, "--log-format"); ok {
+		if !log.SetFormatString(s) {
+			log.Panicf("option --log-format = %s", s)
+		}
+	}
+
 	if n, ok := utils.ArgumentInteger(d, "--ulimit"); ok {
 		b, err := exec.Command("/bin/sh", "-c", "ulimit -n").Output()
 		if err != nil {
@@ -193,6 +216,8 @@ Options:
 	}
 	defer s.Close()
 
+	log.SetField("proxy-id", s.Model().Token)
+
 	proxy.RefreshPeriod.Set(config.MaxDelayRefreshTimeInterval.Int64())
 
 	log.Warnf("create proxy with config\n%s", config)
@@ -246,6 +271,10 @@ Options:
 
 func AutoGOMAXPROCS(min, max int) {
 	for {
+		if proxy.IsMaxProcsPinned() {
+			time.Sleep(time.Second * 10)
+			continue
+		}
 		var ncpu = runtime.GOMAXPROCS(0)
 		var less, more int
 		var usage [10]float64
@@ -272,7 +301,7 @@ func AutoGOMAXPROCS(min, max int) {
 		case less == len(usage):
 			nn = ncpu - 1
 		}
-		if nn != ncpu {
+		if nn != ncpu && !proxy.IsMaxProcsPinned() {
 			runtime.GOMAXPROCS(nn)
 			var b bytes.Buffer
 			for i, u := range usage {
@@ -12,6 +12,7 @@ require (
 	github.com/emirpasic/gods v1.18.1
 	github.com/garyburd/redigo v1.6.4
 	github.com/go-martini/martini v0.0.0-20170121215854-22fa46961aab
+	github.com/golang/snappy v0.0.4
 	github.com/influxdata/influxdb v1.11.0
 	github.com/martini-contrib/binding v0.0.0-20160701174519-05d3e151b6cf
 	github.com/martini-contrib/gzip v0.0.0-20151124214156-6c035326b43f
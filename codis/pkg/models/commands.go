@@ -0,0 +1,25 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package models
+
+// Commands holds the commands of the product disabled or renamed on all the
+// proxies, e.g. Renamed["FLUSHDB"] = "FLUSHDB_7f3c" only accepts the alias.
+//
+// Timeouts are the timeouts of replies from backends of the classes quick,
+// slow, blocking and admin, e.g. Timeouts["slow"] = "2m", and Classes moves
+// commands to other classes, e.g. Classes["LRANGE"] = "slow". Classes without
+// timeouts follow backend_recv_timeout of the proxies.
+type Commands struct {
+	Disabled []string          `json:"disabled,omitempty"`
+	Renamed  map[string]string `json:"renamed,omitempty"`
+
+	Timeouts map[string]string `json:"timeouts,omitempty"`
+	Classes  map[string]string `json:"classes,omitempty"`
+
+	OutOfSync bool `json:"out_of_sync"`
+}
+
+func (c *Commands) Encode() []byte {
+	return jsonEncode(c)
+}
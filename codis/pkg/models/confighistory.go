@@ -0,0 +1,61 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package models
+
+// ConfigChange is a change of the runtime config of a proxy by XCONFIG SET or
+// PCONFIG SET. Seq is the sequence of the change on the proxy, and Version is
+// of the history of the product, assigned when collected by the dashboard.
+type ConfigChange struct {
+	Version  int64  `json:"version,omitempty"`
+	Seq      int64  `json:"seq"`
+	UnixTime int64  `json:"unixtime"`
+	Who      string `json:"who"`
+
+	Proxy string `json:"proxy,omitempty"`
+	Key   string `json:"key"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// MaxConfigHistory is the number of changes kept in the history, the older
+// ones are dropped and can't be rolled back to anymore.
+const MaxConfigHistory = 1000
+
+// ConfigHistory holds the config changes of all the proxies of the product,
+// Version is the version of the last change.
+type ConfigHistory struct {
+	Version int64           `json:"version"`
+	Changes []*ConfigChange `json:"changes,omitempty"`
+}
+
+// Append adds the changes renumbered to the following versions.
+func (h *ConfigHistory) Append(changes ...*ConfigChange) {
+	for _, c := range changes {
+		h.Version++
+		var x = *c
+		x.Version = h.Version
+		h.Changes = append(h.Changes, &x)
+	}
+	if n := len(h.Changes) - MaxConfigHistory; n > 0 {
+		h.Changes = append([]*ConfigChange(nil), h.Changes[n:]...)
+	}
+}
+
+// Since returns the changes after the version, or false if some of them are
+// no longer kept.
+func (h *ConfigHistory) Since(version int64) ([]*ConfigChange, bool) {
+	if len(h.Changes) != 0 && h.Changes[0].Version > version+1 {
+		return nil, false
+	}
+	for i, c := range h.Changes {
+		if c.Version > version {
+			return h.Changes[i:], true
+		}
+	}
+	return nil, true
+}
+
+func (h *ConfigHistory) Encode() []byte {
+	return jsonEncode(h)
+}
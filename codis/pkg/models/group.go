@@ -15,6 +15,8 @@ type Group struct {
 	} `json:"promoting"`
 
 	OutOfSync bool `json:"out_of_sync"`
+
+	Fenced bool `json:"fenced,omitempty"`
 }
 
 func (g *Group) GetServersMap() map[string]*GroupServer {
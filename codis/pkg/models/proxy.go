@@ -22,6 +22,10 @@ type Proxy struct {
 
 	MaxSlotNum int `toml:"max_slot_num" json:"max_slot_num"`
 
+	HashTag    string `json:"hash_tag,omitempty"`
+	HashMode   string `json:"hash_mode,omitempty"`
+	HashKeySum string `json:"hash_key_sum,omitempty"`
+
 	Hostname   string `json:"hostname"`
 	DataCenter string `json:"datacenter"`
 }
@@ -0,0 +1,45 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package models
+
+import "pika/codis/v2/pkg/utils/errors"
+
+// Quota limits the resources used by a tenant, i.e. an ACL user of the
+// sessions, on each proxy. Zero means unlimited.
+type Quota struct {
+	// QPS is the requests per second.
+	QPS int64 `json:"qps,omitempty"`
+	// Bandwidth is the bytes per second of requests and replies.
+	Bandwidth int64 `json:"bandwidth,omitempty"`
+	// Connections is the number of sessions authenticated as the user.
+	Connections int64 `json:"connections,omitempty"`
+	// Memory is the bytes of requests in flight, i.e. received but not yet
+	// replied.
+	Memory int64 `json:"memory,omitempty"`
+}
+
+// Quotas holds the quotas of the users, pushed to all the proxies.
+type Quotas struct {
+	Users map[string]*Quota `json:"users,omitempty"`
+
+	OutOfSync bool `json:"out_of_sync"`
+}
+
+func (q *Quotas) Validate() error {
+	for name, u := range q.Users {
+		switch {
+		case name == "":
+			return errors.New("invalid quota of empty user name")
+		case u == nil:
+			return errors.Errorf("invalid quota of user '%s'", name)
+		case u.QPS < 0 || u.Bandwidth < 0 || u.Connections < 0 || u.Memory < 0:
+			return errors.Errorf("invalid quota of user '%s', limits must not be negative", name)
+		}
+	}
+	return nil
+}
+
+func (q *Quotas) Encode() []byte {
+	return jsonEncode(q)
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// AuthRotation holds the new product_auth and session_auth of the product,
+// the old and the new passwords are both accepted by all the proxies until
+// the deadline, and only the new ones after. The passwords are replaced by
+// their hashes once stored.
+type AuthRotation struct {
+	ProductAuth string `json:"product_auth,omitempty"`
+	SessionAuth string `json:"session_auth,omitempty"`
+	Deadline    int64  `json:"deadline"`
+
+	ProductAuthHash string `json:"product_auth_hash,omitempty"`
+	SessionAuthHash string `json:"session_auth_hash,omitempty"`
+
+	OutOfSync bool `json:"out_of_sync"`
+}
+
+// Masked returns a copy with the passwords masked, which can be shown.
+func (r *AuthRotation) Masked() *AuthRotation {
+	if r == nil {
+		return nil
+	}
+	var m = *r
+	if m.ProductAuth != "" {
+		m.ProductAuth = "******"
+	}
+	if m.SessionAuth != "" {
+		m.SessionAuth = "******"
+	}
+	if m.ProductAuthHash != "" {
+		m.ProductAuthHash = "******"
+	}
+	if m.SessionAuthHash != "" {
+		m.SessionAuthHash = "******"
+	}
+	return &m
+}
+
+// Hashed returns a copy with the passwords replaced by their hashes, which
+// can be stored.
+func (r *AuthRotation) Hashed() *AuthRotation {
+	var h = *r
+	if h.ProductAuth != "" {
+		h.ProductAuth, h.ProductAuthHash = "", HashAuth(h.ProductAuth)
+	}
+	if h.SessionAuth != "" {
+		h.SessionAuth, h.SessionAuthHash = "", HashAuth(h.SessionAuth)
+	}
+	return &h
+}
+
+// HashAuth returns the hash of the password stored in an AuthRotation.
+func HashAuth(auth string) string {
+	var sum = sha256.Sum256([]byte(auth))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *AuthRotation) Encode() []byte {
+	return jsonEncode(r)
+}
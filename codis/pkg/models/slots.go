@@ -31,6 +31,7 @@ func GetMaxSlotNum() int {
 type Slot struct {
 	Id     int  `json:"id"`
 	Locked bool `json:"locked,omitempty"`
+	Fenced bool `json:"fenced,omitempty"`
 
 	BackendAddr        string `json:"backend_addr,omitempty"`
 	BackendAddrGroupId int    `json:"backend_addr_group_id,omitempty"`
@@ -40,6 +41,8 @@ type Slot struct {
 	ForwardMethod int `json:"forward_method,omitempty"`
 
 	ReplicaGroups [][]string `json:"replica_groups,omitempty"`
+
+	ReplicaDataCenters map[string]string `json:"replica_datacenters,omitempty"`
 }
 
 func ParseForwardMethod(s string) (int, bool) {
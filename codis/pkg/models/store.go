@@ -58,6 +58,38 @@ func SentinelPath(product string) string {
 	return filepath.Join(CodisDir, product, "sentinel")
 }
 
+func CommandsPath(product string) string {
+	return filepath.Join(CodisDir, product, "commands")
+}
+
+func AuthRotationPath(product string) string {
+	return filepath.Join(CodisDir, product, "auth-rotation")
+}
+
+func QuotasPath(product string) string {
+	return filepath.Join(CodisDir, product, "quotas")
+}
+
+func ConfigHistoryPath(product string) string {
+	return filepath.Join(CodisDir, product, "config-history")
+}
+
+func SlotNumPath(product string) string {
+	return filepath.Join(CodisDir, product, "slot-num")
+}
+
+func QPSLimitPath(product string) string {
+	return filepath.Join(CodisDir, product, "qps-limit")
+}
+
+func ScriptDir(product string) string {
+	return filepath.Join(CodisDir, product, "scripts")
+}
+
+func ScriptPath(product string, sha string) string {
+	return filepath.Join(CodisDir, product, "scripts", sha)
+}
+
 func LoadTopom(client Client, product string, must bool) (*Topom, error) {
 	b, err := client.Read(LockPath(product), must)
 	if err != nil || b == nil {
@@ -115,6 +147,38 @@ func (s *Store) SentinelPath() string {
 	return SentinelPath(s.product)
 }
 
+func (s *Store) CommandsPath() string {
+	return CommandsPath(s.product)
+}
+
+func (s *Store) AuthRotationPath() string {
+	return AuthRotationPath(s.product)
+}
+
+func (s *Store) QuotasPath() string {
+	return QuotasPath(s.product)
+}
+
+func (s *Store) ConfigHistoryPath() string {
+	return ConfigHistoryPath(s.product)
+}
+
+func (s *Store) SlotNumPath() string {
+	return SlotNumPath(s.product)
+}
+
+func (s *Store) QPSLimitPath() string {
+	return QPSLimitPath(s.product)
+}
+
+func (s *Store) ScriptDir() string {
+	return ScriptDir(s.product)
+}
+
+func (s *Store) ScriptPath(sha string) string {
+	return ScriptPath(s.product, sha)
+}
+
 func (s *Store) Acquire(topom *Topom) error {
 	return s.client.Create(s.LockPath(), topom.Encode())
 }
@@ -255,6 +319,148 @@ func (s *Store) UpdateSentinel(p *Sentinel) error {
 	return s.client.Update(s.SentinelPath(), p.Encode())
 }
 
+func (s *Store) LoadCommands(must bool) (*Commands, error) {
+	b, err := s.client.Read(s.CommandsPath(), must)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	c := &Commands{}
+	if err := jsonDecode(c, b); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Store) UpdateCommands(c *Commands) error {
+	return s.client.Update(s.CommandsPath(), c.Encode())
+}
+
+func (s *Store) LoadAuthRotation(must bool) (*AuthRotation, error) {
+	b, err := s.client.Read(s.AuthRotationPath(), must)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	r := &AuthRotation{}
+	if err := jsonDecode(r, b); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateAuthRotation stores the rotation with the hashes of the passwords
+// instead of the passwords.
+func (s *Store) UpdateAuthRotation(r *AuthRotation) error {
+	return s.client.Update(s.AuthRotationPath(), r.Hashed().Encode())
+}
+
+func (s *Store) LoadQuotas(must bool) (*Quotas, error) {
+	b, err := s.client.Read(s.QuotasPath(), must)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	q := &Quotas{}
+	if err := jsonDecode(q, b); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (s *Store) UpdateQuotas(q *Quotas) error {
+	return s.client.Update(s.QuotasPath(), q.Encode())
+}
+
+func (s *Store) LoadConfigHistory(must bool) (*ConfigHistory, error) {
+	b, err := s.client.Read(s.ConfigHistoryPath(), must)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	h := &ConfigHistory{}
+	if err := jsonDecode(h, b); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (s *Store) UpdateConfigHistory(h *ConfigHistory) error {
+	return s.client.Update(s.ConfigHistoryPath(), h.Encode())
+}
+
+type slotNum struct {
+	MaxSlotNum int `json:"max_slot_num"`
+}
+
+// LoadMaxSlotNum returns the number of slots the product is created with,
+// or 0 if it's not recorded yet.
+func (s *Store) LoadMaxSlotNum() (int, error) {
+	b, err := s.client.Read(s.SlotNumPath(), false)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	n := &slotNum{}
+	if err := jsonDecode(n, b); err != nil {
+		return 0, err
+	}
+	return n.MaxSlotNum, nil
+}
+
+func (s *Store) UpdateMaxSlotNum(n int) error {
+	return s.client.Update(s.SlotNumPath(), jsonEncode(&slotNum{n}))
+}
+
+type qpsLimit struct {
+	Limit int64 `json:"limit"`
+}
+
+// LoadQPSLimit returns the QPS limit of the product set at runtime, ok is
+// false if it's never set.
+func (s *Store) LoadQPSLimit() (n int64, ok bool, err error) {
+	b, err := s.client.Read(s.QPSLimitPath(), false)
+	if err != nil || b == nil {
+		return 0, false, err
+	}
+	l := &qpsLimit{}
+	if err := jsonDecode(l, b); err != nil {
+		return 0, false, err
+	}
+	return l.Limit, true, nil
+}
+
+func (s *Store) UpdateQPSLimit(n int64) error {
+	return s.client.Update(s.QPSLimitPath(), jsonEncode(&qpsLimit{n}))
+}
+
+// ListScripts returns the bodies of the lua scripts shared by proxies, keyed
+// by their sha1 digests.
+func (s *Store) ListScripts() (map[string][]byte, error) {
+	paths, err := s.client.List(s.ScriptDir(), false)
+	if err != nil {
+		return nil, err
+	}
+	scripts := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		b, err := s.client.Read(path, false)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			scripts[filepath.Base(path)] = b
+		}
+	}
+	return scripts, nil
+}
+
+func (s *Store) LoadScript(sha string) ([]byte, error) {
+	return s.client.Read(s.ScriptPath(sha), false)
+}
+
+func (s *Store) UpdateScript(sha string, body []byte) error {
+	return s.client.Update(s.ScriptPath(sha), body)
+}
+
+func (s *Store) DeleteScript(sha string) error {
+	return s.client.Delete(s.ScriptPath(sha))
+}
+
 func ValidateProduct(name string) error {
 	if regexp.MustCompile(`^\w[\w\.\-]*$`).MatchString(name) {
 		return nil
@@ -0,0 +1,130 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// accessList holds the CIDR rules of proxy_allow_cidrs and proxy_deny_cidrs,
+// which are checked against the remote address of new client connections.
+var accessList struct {
+	sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+
+	accepted atomic2.Int64
+	rejected atomic2.Int64
+}
+
+type AccessStats struct {
+	Allow    []string `json:"allow,omitempty"`
+	Deny     []string `json:"deny,omitempty"`
+	Accepted int64    `json:"accepted"`
+	Rejected int64    `json:"rejected"`
+}
+
+// parseCIDRs parses the comma separated list of CIDRs, a single IP address is
+// taken as a /32 or /128 network.
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.Errorf("invalid ip address '%s'", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Errorf("invalid cidr '%s'", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// SetAccessList replaces the rules, connections accepted before are kept.
+func SetAccessList(allow, deny string) error {
+	a, err := parseCIDRs(allow)
+	if err != nil {
+		return err
+	}
+	d, err := parseCIDRs(deny)
+	if err != nil {
+		return err
+	}
+	accessList.Lock()
+	defer accessList.Unlock()
+	accessList.allow, accessList.deny = a, d
+	return nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAccessAllowed reports whether a client from the address is accepted. The
+// deny rules come first, and with any allow rules the address must match one
+// of them. Addresses other than tcp, e.g. unix sockets, are always accepted.
+func isAccessAllowed(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	accessList.RLock()
+	defer accessList.RUnlock()
+	switch {
+	case containsIP(accessList.deny, tcp.IP):
+		return false
+	case len(accessList.allow) != 0:
+		return containsIP(accessList.allow, tcp.IP)
+	}
+	return true
+}
+
+// checkAccess counts the connection as accepted or rejected.
+func checkAccess(addr net.Addr) bool {
+	if isAccessAllowed(addr) {
+		accessList.accepted.Incr()
+		return true
+	}
+	accessList.rejected.Incr()
+	return false
+}
+
+func GetAccessStats() *AccessStats {
+	accessList.RLock()
+	defer accessList.RUnlock()
+	stats := &AccessStats{
+		Accepted: accessList.accepted.Int64(),
+		Rejected: accessList.rejected.Int64(),
+	}
+	for _, n := range accessList.allow {
+		stats.Allow = append(stats.Allow, n.String())
+	}
+	for _, n := range accessList.deny {
+		stats.Deny = append(stats.Deny, n.String())
+	}
+	return stats
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestAccessList(t *testing.T) {
+	defer SetAccessList("", "")
+
+	addr := func(ip string) net.Addr {
+		return &net.TCPAddr{IP: net.ParseIP(ip), Port: 6379}
+	}
+	assert.Must(isAccessAllowed(addr("1.2.3.4")))
+
+	assert.MustNoError(SetAccessList("10.0.0.0/8, 192.168.1.7", "10.1.0.0/16"))
+	assert.Must(isAccessAllowed(addr("10.2.3.4")))
+	assert.Must(isAccessAllowed(addr("192.168.1.7")))
+	assert.Must(!isAccessAllowed(addr("192.168.1.8")))
+	assert.Must(!isAccessAllowed(addr("10.1.2.3")))
+	assert.Must(isAccessAllowed(&net.UnixAddr{Name: "/tmp/proxy.sock", Net: "unix"}))
+
+	assert.MustNoError(SetAccessList("", "::1, 127.0.0.0/8"))
+	assert.Must(!isAccessAllowed(addr("::1")))
+	assert.Must(!isAccessAllowed(addr("127.0.0.1")))
+	assert.Must(isAccessAllowed(addr("10.1.2.3")))
+
+	assert.Must(SetAccessList("10.0.0.0/33", "") != nil)
+	assert.Must(SetAccessList("", "localhost") != nil)
+	assert.Must(!isAccessAllowed(addr("127.0.0.1")))
+
+	var stats = GetAccessStats()
+	assert.Must(len(stats.Allow) == 0 && len(stats.Deny) == 2)
+	assert.Must(stats.Deny[0] == "::1/128" && stats.Deny[1] == "127.0.0.0/8")
+
+	var rejected = stats.Rejected
+	assert.Must(!checkAccess(addr("127.0.0.1")))
+	assert.Must(GetAccessStats().Rejected == rejected+1)
+}
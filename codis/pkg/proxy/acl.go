@@ -0,0 +1,948 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+// aclUser is a user of the proxy as in Redis 6 ACL. Users are never modified
+// in place, ACL SETUSER replaces the user with an updated copy.
+type aclUser struct {
+	name    string
+	enabled bool
+	nopass  bool
+
+	// passwords are the hex sha256 of the passwords.
+	passwords []string
+
+	// commands are the +cmd, -cmd, +@category and -@category rules, applied
+	// in order, the last rule that matches a command wins.
+	commands []aclCommandRule
+
+	allkeys bool
+	keys    []string
+
+	allchannels bool
+	channels    []string
+
+	// namespace is the prefix of the keys and channels of the user, which is
+	// prepended to requests and stripped from replies.
+	namespace string
+
+	// priority is the priority of the sessions of the user to keep when
+	// proxy_max_clients_policy is evict-priority, higher is kept longer.
+	priority int64
+}
+
+type aclCommandRule struct {
+	allow    bool
+	category bool
+	name     string
+}
+
+func (r aclCommandRule) String() string {
+	var s = "-"
+	if r.allow {
+		s = "+"
+	}
+	if r.category {
+		s += "@"
+	}
+	return s + strings.ToLower(r.name)
+}
+
+// aclUsers are the users set by session_acl_file or ACL SETUSER. The default
+// user, unless set explicitly, authenticates with session_auth and is allowed
+// to run everything but aclAdminRules, unless session_admin_enabled.
+var aclUsers struct {
+	sync.RWMutex
+	users map[string]*aclUser
+}
+
+// aclAdminRules keep the commands inspecting or controlling the sessions of
+// other clients from the default user, while CLIENT on its own session is
+// still allowed.
+var aclAdminRules = []string{
+	"-client", "+client|id", "+client|getname", "+client|setname", "+client|setinfo",
+	"+client|deadline", "+client|tracking", "-monitor", "-slowlog", "-xslowlog",
+}
+
+func newDefaultACLUser(auths []string, admin bool) *aclUser {
+	u := &aclUser{
+		name: "default", enabled: true,
+		commands:    []aclCommandRule{{allow: true, category: true, name: "ALL"}},
+		allkeys:     true,
+		allchannels: true,
+	}
+	if !admin {
+		for _, rule := range aclAdminRules {
+			u.apply(rule)
+		}
+	}
+	for _, auth := range auths {
+		if auth == "" {
+			u.nopass, u.passwords = true, nil
+			break
+		}
+		u.passwords = append(u.passwords, aclHashPassword(auth))
+	}
+	return u
+}
+
+// aclDefault caches the default user of session_auth, which is hashed once.
+// During a rotation of session_auth, both the old and the new passwords are
+// accepted until the deadline.
+var aclDefault struct {
+	sync.Mutex
+	auths []string
+	admin bool
+	user  *aclUser
+}
+
+func getDefaultACLUser(config *Config) *aclUser {
+	var auths = config.sessionAuthRotation().Candidates(config.sessionAuth())
+	var admin = config.SessionAdminEnabled
+	aclDefault.Lock()
+	defer aclDefault.Unlock()
+	switch {
+	case aclDefault.user == nil, aclDefault.admin != admin:
+	case strings.Join(aclDefault.auths, "\x00") == strings.Join(auths, "\x00"):
+		return aclDefault.user
+	}
+	aclDefault.auths, aclDefault.admin = auths, admin
+	aclDefault.user = newDefaultACLUser(auths, admin)
+	return aclDefault.user
+}
+
+func getACLUser(name string, config *Config) *aclUser {
+	aclUsers.RLock()
+	var u = aclUsers.users[name]
+	aclUsers.RUnlock()
+	if u == nil && name == "default" {
+		return getDefaultACLUser(config)
+	}
+	return u
+}
+
+func listACLUsers(config *Config) []*aclUser {
+	aclUsers.RLock()
+	defer aclUsers.RUnlock()
+	var list []*aclUser
+	for _, u := range aclUsers.users {
+		list = append(list, u)
+	}
+	if aclUsers.users["default"] == nil {
+		list = append(list, getDefaultACLUser(config))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+// setACLUser creates or updates the user with the rules.
+func setACLUser(name string, rules []string, config *Config) error {
+	aclUsers.Lock()
+	defer aclUsers.Unlock()
+	var u *aclUser
+	switch {
+	case aclUsers.users[name] != nil:
+		u = aclUsers.users[name].clone()
+	case name == "default":
+		u = getDefaultACLUser(config).clone()
+	default:
+		u = &aclUser{name: name}
+	}
+	for _, rule := range rules {
+		if err := u.apply(rule); err != nil {
+			return err
+		}
+	}
+	if aclUsers.users == nil {
+		aclUsers.users = make(map[string]*aclUser)
+	}
+	aclUsers.users[name] = u
+	return nil
+}
+
+func delACLUser(name string) bool {
+	aclUsers.Lock()
+	defer aclUsers.Unlock()
+	if aclUsers.users[name] == nil {
+		return false
+	}
+	delete(aclUsers.users, name)
+	return true
+}
+
+func resetACLUsers() {
+	aclUsers.Lock()
+	defer aclUsers.Unlock()
+	aclUsers.users = nil
+}
+
+// LoadACLFile loads the users from the file, one "user <name> <rule> ..." per
+// line as the aclfile of Redis, and replaces all the users set before.
+func LoadACLFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	var users = make(map[string]*aclUser)
+	var scanner = bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		var fields = strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return errors.Errorf("invalid acl file %s, line %d: should be 'user <name> <rule> ...'", path, n)
+		}
+		var u = &aclUser{name: fields[1]}
+		for _, rule := range fields[2:] {
+			if err := u.apply(rule); err != nil {
+				return errors.Errorf("invalid acl file %s, line %d: %s", path, n, err)
+			}
+		}
+		users[u.name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	aclUsers.Lock()
+	defer aclUsers.Unlock()
+	aclUsers.users = users
+	return nil
+}
+
+func aclHashPassword(pass string) string {
+	sum := sha256.Sum256([]byte(pass))
+	return hex.EncodeToString(sum[:])
+}
+
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = append([]string{}, u.passwords...)
+	c.commands = append([]aclCommandRule{}, u.commands...)
+	c.keys = append([]string{}, u.keys...)
+	c.channels = append([]string{}, u.channels...)
+	return &c
+}
+
+func (u *aclUser) apply(rule string) error {
+	switch lower := strings.ToLower(rule); {
+	case lower == "":
+		return fmt.Errorf("Syntax error")
+	case lower == "on":
+		u.enabled = true
+	case lower == "off":
+		u.enabled = false
+	case lower == "nopass":
+		u.nopass, u.passwords = true, nil
+	case lower == "resetpass":
+		u.nopass, u.passwords = false, nil
+	case lower == "allkeys":
+		u.allkeys, u.keys = true, nil
+	case lower == "resetkeys":
+		u.allkeys, u.keys = false, nil
+	case lower == "allchannels":
+		u.allchannels, u.channels = true, nil
+	case lower == "resetchannels":
+		u.allchannels, u.channels = false, nil
+	case lower == "allcommands":
+		u.commands = []aclCommandRule{{allow: true, category: true, name: "ALL"}}
+	case lower == "nocommands":
+		u.commands = nil
+	case strings.HasPrefix(lower, "namespace:"):
+		var prefix = rule[len("namespace:"):]
+		if err := checkNamespace(prefix); err != nil {
+			return err
+		}
+		u.namespace = prefix
+	case lower == "resetnamespace":
+		u.namespace = ""
+	case strings.HasPrefix(lower, "priority:"):
+		n, err := strconv.ParseInt(rule[len("priority:"):], 10, 64)
+		if err != nil {
+			return fmt.Errorf("The priority must be an integer")
+		}
+		u.priority = n
+	case lower == "reset":
+		*u = aclUser{name: u.name}
+	case rule[0] == '>':
+		u.addPassword(aclHashPassword(rule[1:]))
+	case rule[0] == '#':
+		if len(rule) != 65 {
+			return fmt.Errorf("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		if _, err := hex.DecodeString(rule[1:]); err != nil || lower != rule {
+			return fmt.Errorf("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.addPassword(rule[1:])
+	case rule[0] == '<':
+		u.delPassword(aclHashPassword(rule[1:]))
+	case rule[0] == '!':
+		u.delPassword(rule[1:])
+	case rule == "~*":
+		u.allkeys, u.keys = true, nil
+	case rule == "&*":
+		u.allchannels, u.channels = true, nil
+	case rule[0] == '~':
+		if !u.allkeys {
+			u.keys = append(u.keys, rule[1:])
+		}
+	case rule[0] == '&':
+		if !u.allchannels {
+			u.channels = append(u.channels, rule[1:])
+		}
+	case rule[0] == '+' || rule[0] == '-':
+		var r = aclCommandRule{allow: rule[0] == '+', name: strings.ToUpper(rule[1:])}
+		if strings.HasPrefix(r.name, "@") {
+			r.category, r.name = true, r.name[1:]
+			if !isACLCategory(r.name) {
+				return fmt.Errorf("Unknown command or category name in ACL")
+			}
+		} else if cmd, sub, found := strings.Cut(r.name, "|"); cmd == "" || found && (sub == "" || strings.ContainsRune(sub, '|')) {
+			return fmt.Errorf("Unknown command or category name in ACL")
+		}
+		if r.category && r.name == "ALL" {
+			u.commands = nil
+		}
+		u.commands = append(u.commands, r)
+	default:
+		return fmt.Errorf("Syntax error")
+	}
+	return nil
+}
+
+func (u *aclUser) addPassword(hash string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *aclUser) delPassword(hash string) {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i:i], u.passwords[i+1:]...)
+			return
+		}
+	}
+}
+
+func (u *aclUser) checkPassword(pass string) bool {
+	if !u.enabled {
+		return false
+	}
+	if u.nopass {
+		return true
+	}
+	var hash = aclHashPassword(pass)
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare([]byte(p), []byte(hash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// canRun matches the rules against the command, and the subcommand given as
+// "cmd|sub" if any, e.g. "CLIENT|KILL".
+func (u *aclUser) canRun(opstr, sub string, flag OpFlag) bool {
+	var allow bool
+	for _, r := range u.commands {
+		switch {
+		case r.category:
+			if inACLCategory(r.name, opstr, flag) {
+				allow = r.allow
+			}
+		case r.name == opstr, sub != "" && r.name == sub:
+			allow = r.allow
+		}
+	}
+	return allow
+}
+
+func aclSubcommand(multi []*redis.Resp, opstr string) string {
+	if len(multi) < 2 {
+		return ""
+	}
+	return opstr + "|" + strings.ToUpper(string(multi[1].Value))
+}
+
+func (u *aclUser) canAccessKey(key []byte) bool {
+	if u.allkeys {
+		return true
+	}
+	for _, p := range u.keys {
+		if globMatch(p, string(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessChannel matches the channel against the channel patterns, or for
+// PSUBSCRIBE requires the pattern itself to be one of the channel patterns.
+func (u *aclUser) canAccessChannel(channel []byte, literal bool) bool {
+	if u.allchannels {
+		return true
+	}
+	for _, p := range u.channels {
+		if literal && p == string(channel) {
+			return true
+		}
+		if !literal && globMatch(p, string(channel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the NOPERM error if the user isn't allowed to run the request.
+func (u *aclUser) check(r *Request) *redis.Resp {
+	if !u.canRun(r.OpStr, aclSubcommand(r.Multi, r.OpStr), r.OpFlag) {
+		return redis.NewErrorf("NOPERM this user has no permissions to run the '%s' command", strings.ToLower(r.OpStr))
+	}
+	switch r.OpStr {
+	case "PUBLISH", "SUBSCRIBE", "PSUBSCRIBE":
+		var channels = r.Multi[1:]
+		if r.OpStr == "PUBLISH" && len(channels) != 0 {
+			channels = channels[:1]
+		}
+		for _, c := range channels {
+			if !u.canAccessChannel(c.Value, r.OpStr == "PSUBSCRIBE") {
+				return redis.NewErrorf("NOPERM this user has no permissions to access one of the channels used as arguments")
+			}
+		}
+		return nil
+	}
+	if u.allkeys {
+		return nil
+	}
+	for _, k := range aclKeys(r.Multi, r.OpStr) {
+		if !u.canAccessKey(k.Value) {
+			return redis.NewErrorf("NOPERM this user has no permissions to access one of the keys used as arguments")
+		}
+	}
+	return nil
+}
+
+func (u *aclUser) flags() []*redis.Resp {
+	var flags []*redis.Resp
+	add := func(s string) {
+		flags = append(flags, redis.NewBulkBytes([]byte(s)))
+	}
+	if u.enabled {
+		add("on")
+	} else {
+		add("off")
+	}
+	if u.allkeys {
+		add("allkeys")
+	}
+	if u.allchannels {
+		add("allchannels")
+	}
+	if u.nopass {
+		add("nopass")
+	}
+	return flags
+}
+
+func (u *aclUser) commandRules() string {
+	if len(u.commands) == 0 {
+		return "-@all"
+	}
+	var rules []string
+	for _, r := range u.commands {
+		rules = append(rules, r.String())
+	}
+	return strings.Join(rules, " ")
+}
+
+// String describes the user as a line of ACL LIST.
+func (u *aclUser) String() string {
+	var rules = []string{"user", u.name}
+	if u.enabled {
+		rules = append(rules, "on")
+	} else {
+		rules = append(rules, "off")
+	}
+	if u.nopass {
+		rules = append(rules, "nopass")
+	}
+	for _, p := range u.passwords {
+		rules = append(rules, "#"+p)
+	}
+	if u.allkeys {
+		rules = append(rules, "~*")
+	} else {
+		for _, k := range u.keys {
+			rules = append(rules, "~"+k)
+		}
+	}
+	if u.allchannels {
+		rules = append(rules, "&*")
+	} else {
+		rules = append(rules, "resetchannels")
+		for _, c := range u.channels {
+			rules = append(rules, "&"+c)
+		}
+	}
+	if u.namespace != "" {
+		rules = append(rules, "namespace:"+u.namespace)
+	}
+	if u.priority != 0 {
+		rules = append(rules, "priority:"+strconv.FormatInt(u.priority, 10))
+	}
+	return strings.Join(append(rules, u.commandRules()), " ")
+}
+
+var aclCategoryTable = map[string][]string{
+	"KEYSPACE": {
+		"COPY", "DEL", "DUMP", "EXISTS", "EXPIRE", "EXPIREAT", "EXPIRETIME", "KEYS", "OBJECT",
+		"PERSIST", "PEXPIRE", "PEXPIREAT", "PEXPIRETIME", "PTTL", "RANDOMKEY", "RENAME",
+		"RENAMENX", "RESTORE", "SCAN", "TOUCH", "TTL", "TYPE", "DBSIZE", "FLUSHALL", "FLUSHDB",
+	},
+	"STRING": {
+		"APPEND", "DECR", "DECRBY", "GET", "GETDEL", "GETEX", "GETRANGE", "GETSET", "INCR",
+		"INCRBY", "INCRBYFLOAT", "MGET", "MSET", "MSETNX", "PSETEX", "SET", "SETEX", "SETNX",
+		"SETRANGE", "STRLEN", "SUBSTR",
+	},
+	"BITMAP": {
+		"BITCOUNT", "BITFIELD", "BITFIELD_RO", "BITOP", "BITPOS", "GETBIT", "SETBIT",
+	},
+	"HASH": {
+		"HDEL", "HEXISTS", "HGET", "HGETALL", "HINCRBY", "HINCRBYFLOAT", "HKEYS", "HLEN",
+		"HMGET", "HMSET", "HRANDFIELD", "HSCAN", "HSET", "HSETNX", "HSTRLEN", "HVALS",
+	},
+	"LIST": {
+		"BLMOVE", "BLMPOP", "BLPOP", "BRPOP", "BRPOPLPUSH", "LINDEX", "LINSERT", "LLEN",
+		"LMOVE", "LMPOP", "LPOP", "LPOS", "LPUSH", "LPUSHX", "LRANGE", "LREM", "LSET", "LTRIM",
+		"RPOP", "RPOPLPUSH", "RPUSH", "RPUSHX", "SORT", "SORT_RO",
+	},
+	"SET": {
+		"SADD", "SCARD", "SDIFF", "SDIFFSTORE", "SINTER", "SINTERCARD", "SINTERSTORE",
+		"SISMEMBER", "SMEMBERS", "SMISMEMBER", "SMOVE", "SPOP", "SRANDMEMBER", "SREM", "SSCAN",
+		"SUNION", "SUNIONSTORE",
+	},
+	"SORTEDSET": {
+		"BZMPOP", "BZPOPMAX", "BZPOPMIN", "ZADD", "ZCARD", "ZCOUNT", "ZINCRBY", "ZINTERSTORE",
+		"ZLEXCOUNT", "ZMPOP", "ZPOPMAX", "ZPOPMIN", "ZRANDMEMBER", "ZRANGE", "ZRANGEBYLEX",
+		"ZRANGEBYSCORE", "ZRANK", "ZREM", "ZREMRANGEBYLEX", "ZREMRANGEBYRANK",
+		"ZREMRANGEBYSCORE", "ZREVRANGE", "ZREVRANGEBYLEX", "ZREVRANGEBYSCORE", "ZREVRANK",
+		"ZSCAN", "ZSCORE", "ZUNIONSTORE",
+	},
+	"HYPERLOGLOG": {
+		"PFADD", "PFCOUNT", "PFDEBUG", "PFMERGE", "PFSELFTEST",
+	},
+	"GEO": {
+		"GEOADD", "GEODIST", "GEOHASH", "GEOPOS", "GEORADIUS", "GEORADIUSBYMEMBER",
+		"GEOSEARCH", "GEOSEARCHSTORE",
+	},
+	"STREAM": {
+		"XACK", "XADD", "XAUTOCLAIM", "XCLAIM", "XDEL", "XGROUP", "XINFO", "XLEN", "XPENDING",
+		"XRANGE", "XREAD", "XREADGROUP", "XREVRANGE", "XSETID", "XTRIM",
+	},
+	"PUBSUB": {
+		"PSUBSCRIBE", "PUBLISH", "PUBSUB", "PUNSUBSCRIBE", "SUBSCRIBE", "UNSUBSCRIBE",
+	},
+	"SCRIPTING": {
+		"EVAL", "EVALSHA", "EVALSHA_RO", "EVAL_RO", "FCALL", "FCALL_RO", "FUNCTION", "SCRIPT",
+	},
+	"TRANSACTION": {
+		"DISCARD", "EXEC", "MULTI", "UNWATCH", "WATCH",
+	},
+	"CONNECTION": {
+		"AUTH", "CLIENT", "ECHO", "HELLO", "PING", "QUIT", "READONLY", "READWRITE", "SELECT",
+	},
+	"BLOCKING": {
+		"BLMOVE", "BLMPOP", "BLPOP", "BRPOP", "BRPOPLPUSH", "BZMPOP", "BZPOPMAX", "BZPOPMIN",
+		"XREAD", "XREADGROUP",
+	},
+	"ADMIN": {
+		"ACL", "CLIENT", "DEBUG", "LATENCY", "MONITOR", "PCONFIG", "SLOTSINFO", "SLOTSMAPPING",
+		"SLOTSSCAN", "SLOWLOG", "XCONFIG", "XMONITOR", "XSLOWLOG",
+	},
+	"DANGEROUS": {
+		"ACL", "CLIENT", "DEBUG", "FLUSHALL", "FLUSHDB", "INFO", "KEYS", "LATENCY", "MONITOR",
+		"PCONFIG", "ROLE", "SLOTSINFO", "SLOTSMAPPING", "SLOTSSCAN", "SLOWLOG", "SORT", "XCONFIG",
+		"XMONITOR", "XSLOWLOG",
+	},
+}
+
+var aclCategorySet = func() map[string]map[string]bool {
+	var m = make(map[string]map[string]bool)
+	for cat, cmds := range aclCategoryTable {
+		m[cat] = make(map[string]bool)
+		for _, c := range cmds {
+			m[cat][c] = true
+		}
+	}
+	return m
+}()
+
+func isACLCategory(name string) bool {
+	switch name {
+	case "ALL", "READ", "WRITE", "FAST", "SLOW":
+		return true
+	}
+	return aclCategoryTable[name] != nil
+}
+
+func inACLCategory(name string, opstr string, flag OpFlag) bool {
+	switch name {
+	case "ALL":
+		return true
+	case "READ":
+		return flag.IsReadOnly() && !aclCategorySet["CONNECTION"][opstr] && !aclCategorySet["ADMIN"][opstr]
+	case "WRITE":
+		return !flag.IsReadOnly()
+	case "FAST":
+		return flag.IsQuick()
+	case "SLOW":
+		return !flag.IsQuick()
+	}
+	return aclCategorySet[name][opstr]
+}
+
+func aclCategories() []string {
+	var list = []string{"all", "read", "write", "fast", "slow"}
+	for cat := range aclCategoryTable {
+		list = append(list, strings.ToLower(cat))
+	}
+	sort.Strings(list[5:])
+	return list
+}
+
+// aclKeys returns the keys of the request that are checked against the key
+// patterns of the user, and prefixed by the namespace of the user.
+func aclKeys(multi []*redis.Resp, opstr string) []*redis.Resp {
+	var args = multi[1:]
+	switch opstr {
+	case "SORT", "SORT_RO", "GEORADIUS", "GEORADIUSBYMEMBER":
+		if len(args) == 0 {
+			return nil
+		}
+		return append(args[:1:1], storeKeys(multi, opstr)...)
+	case "DEBUG":
+		if len(args) == 2 && strings.EqualFold(string(args[0].Value), "OBJECT") {
+			return args[1:]
+		}
+		return nil
+	case "MGET", "DEL", "EXISTS", "TOUCH", "WATCH", "PFCOUNT", "PFMERGE", "SDIFF", "SINTER",
+		"SUNION", "SDIFFSTORE", "SINTERSTORE", "SUNIONSTORE":
+		return args
+	case "MSET", "MSETNX":
+		var keys []*redis.Resp
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "RENAME", "RENAMENX", "SMOVE", "COPY", "LMOVE", "BLMOVE", "RPOPLPUSH", "BRPOPLPUSH",
+		"GEOSEARCHSTORE":
+		if len(args) > 2 {
+			return args[:2]
+		}
+		return args
+	case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX":
+		if len(args) > 1 {
+			return args[:len(args)-1]
+		}
+		return nil
+	case "BITOP":
+		if len(args) > 1 {
+			return args[1:]
+		}
+		return nil
+	case "ZINTERSTORE", "ZUNIONSTORE":
+		keys, _ := numKeys(multi, 2)
+		return append(keys[:len(keys):len(keys)], args[:1]...)
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO", "LMPOP", "ZMPOP",
+		"SINTERCARD":
+		keys, _ := numKeys(multi, 2)
+		return keys
+	case "BLMPOP", "BZMPOP":
+		keys, _ := numKeys(multi, 3)
+		return keys
+	case "XREAD", "XREADGROUP":
+		if i := streamsIndex(multi); i > 0 {
+			var streams = multi[i+1:]
+			return streams[:len(streams)/2]
+		}
+		return nil
+	}
+	switch {
+	case aclCategorySet["CONNECTION"][opstr], aclCategorySet["TRANSACTION"][opstr],
+		aclCategorySet["ADMIN"][opstr], aclCategorySet["PUBSUB"][opstr]:
+		return nil
+	}
+	switch opstr {
+	case "INFO", "SCAN", "KEYS", "DBSIZE", "RANDOMKEY", "FLUSHALL", "FLUSHDB", "ROLE",
+		"COMMAND", "CLUSTER", "ASKING", "SCRIPT", "FUNCTION", "CODIS.INFO":
+		return nil
+	}
+	if i := hashKeyIndex(multi, opstr); i < len(multi) {
+		return multi[i : i+1]
+	}
+	return nil
+}
+
+// storeKeys returns the destinations of STORE of SORT, and of STORE and
+// STOREDIST of GEORADIUS and GEORADIUSBYMEMBER.
+func storeKeys(multi []*redis.Resp, opstr string) []*redis.Resp {
+	var keys []*redis.Resp
+	for i := 2; i+1 < len(multi); i++ {
+		switch strings.ToUpper(string(multi[i].Value)) {
+		case "BY", "GET":
+			if opstr == "SORT" || opstr == "SORT_RO" {
+				i++
+			}
+		case "LIMIT":
+			if opstr == "SORT" || opstr == "SORT_RO" {
+				i += 2
+			}
+		case "STORE":
+			keys = append(keys, multi[i+1])
+			i++
+		case "STOREDIST":
+			if opstr != "SORT" && opstr != "SORT_RO" {
+				keys = append(keys, multi[i+1])
+			}
+			i++
+		}
+	}
+	return keys
+}
+
+// globMatch reports whether the string matches the glob-style pattern as the
+// stringmatch of Redis, which supports *, ?, [...] and \ escaping.
+func globMatch(pattern, s string) bool {
+	for len(pattern) != 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			var not = len(pattern) != 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			var match bool
+			for len(pattern) != 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					match = match || pattern[0] == s[0]
+				case len(pattern) >= 3 && pattern[1] == '-':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					match = match || (s[0] >= lo && s[0] <= hi)
+					pattern = pattern[2:]
+				default:
+					match = match || pattern[0] == s[0]
+				}
+				pattern = pattern[1:]
+			}
+			if match == not {
+				return false
+			}
+			s = s[1:]
+			if len(pattern) == 0 {
+				return len(s) == 0
+			}
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
+
+func (s *Session) aclUser() *aclUser {
+	var name = s.user
+	if name == "" {
+		name = "default"
+	}
+	return getACLUser(name, s.config)
+}
+
+func (s *Session) isNoPass() bool {
+	u := s.aclUser()
+	return u != nil && u.enabled && u.nopass
+}
+
+func (s *Session) handleACL(r *Request) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'ACL' command")
+		return nil
+	}
+	var args = r.Multi[2:]
+	switch sub := strings.ToUpper(string(r.Multi[1].Value)); sub {
+	case "WHOAMI":
+		if len(args) != 0 {
+			break
+		}
+		r.Resp = redis.NewBulkBytes([]byte(s.aclUser().name))
+		return nil
+	case "USERS", "LIST":
+		if len(args) != 0 {
+			break
+		}
+		var array []*redis.Resp
+		for _, u := range listACLUsers(s.config) {
+			if sub == "USERS" {
+				array = append(array, redis.NewBulkBytes([]byte(u.name)))
+			} else {
+				array = append(array, redis.NewBulkBytes([]byte(u.String())))
+			}
+		}
+		r.Resp = redis.NewArray(array)
+		return nil
+	case "CAT":
+		if len(args) != 0 {
+			break
+		}
+		var array []*redis.Resp
+		for _, c := range aclCategories() {
+			array = append(array, redis.NewBulkBytes([]byte(c)))
+		}
+		r.Resp = redis.NewArray(array)
+		return nil
+	case "SETUSER":
+		if len(args) < 1 {
+			break
+		}
+		var rules []string
+		for _, a := range args[1:] {
+			rules = append(rules, string(a.Value))
+		}
+		if err := setACLUser(string(args[0].Value), rules, s.config); err != nil {
+			r.Resp = redis.NewErrorf("ERR Error in ACL SETUSER modifier: %s", err)
+		} else {
+			r.Resp = RespOK
+		}
+		return nil
+	case "GETUSER":
+		if len(args) != 1 {
+			break
+		}
+		var u = getACLUser(string(args[0].Value), s.config)
+		switch {
+		case u == nil && s.proto == 3:
+			r.Resp = redis.NewNull()
+			return nil
+		case u == nil:
+			r.Resp = redis.NewBulkBytes(nil)
+			return nil
+		}
+		var passwords, keys, channels []*redis.Resp
+		for _, p := range u.passwords {
+			passwords = append(passwords, redis.NewBulkBytes([]byte(p)))
+		}
+		if u.allkeys {
+			keys = append(keys, redis.NewBulkBytes([]byte("*")))
+		}
+		for _, k := range u.keys {
+			keys = append(keys, redis.NewBulkBytes([]byte(k)))
+		}
+		if u.allchannels {
+			channels = append(channels, redis.NewBulkBytes([]byte("*")))
+		}
+		for _, c := range u.channels {
+			channels = append(channels, redis.NewBulkBytes([]byte(c)))
+		}
+		var info = []*redis.Resp{
+			redis.NewBulkBytes([]byte("flags")), redis.NewArray(u.flags()),
+			redis.NewBulkBytes([]byte("passwords")), redis.NewArray(passwords),
+			redis.NewBulkBytes([]byte("commands")), redis.NewBulkBytes([]byte(u.commandRules())),
+			redis.NewBulkBytes([]byte("keys")), redis.NewArray(keys),
+			redis.NewBulkBytes([]byte("channels")), redis.NewArray(channels),
+			redis.NewBulkBytes([]byte("namespace")), redis.NewBulkBytes([]byte(u.namespace)),
+			redis.NewBulkBytes([]byte("priority")), redis.NewInt(strconv.AppendInt(nil, u.priority, 10)),
+		}
+		if s.proto == 3 {
+			r.Resp = redis.NewMap(info)
+		} else {
+			r.Resp = redis.NewArray(info)
+		}
+		return nil
+	case "DELUSER":
+		if len(args) == 0 {
+			break
+		}
+		var n int64
+		for _, a := range args {
+			if string(a.Value) == "default" {
+				r.Resp = redis.NewErrorf("ERR The 'default' user cannot be removed")
+				return nil
+			}
+		}
+		for _, a := range args {
+			if delACLUser(string(a.Value)) {
+				n++
+			}
+		}
+		r.Resp = redis.NewInt(strconv.AppendInt(nil, n, 10))
+		return nil
+	default:
+		r.Resp = redis.NewErrorf("ERR unknown subcommand '%s'. Try ACL HELP.", r.Multi[1].Value)
+		return nil
+	}
+	r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'acl|%s' command", strings.ToLower(string(r.Multi[1].Value)))
+	return nil
+}
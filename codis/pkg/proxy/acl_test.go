@@ -0,0 +1,206 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestGlobMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"cache:*", "cache:1", true},
+		{"cache:*", "user:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"*:*:x", "a:b:x", true},
+	} {
+		assert.Must(globMatch(c.pattern, c.s) == c.match)
+	}
+}
+
+func TestACLKeys(t *testing.T) {
+	keys := func(args ...string) string {
+		var list []string
+		for _, k := range aclKeys(newTestRequest(args...).Multi, args[0]) {
+			list = append(list, string(k.Value))
+		}
+		return strings.Join(list, " ")
+	}
+	assert.Must(keys("SORT", "l", "BY", "store", "LIMIT", "0", "1", "STORE", "d") == "l d")
+	assert.Must(keys("SORT_RO", "l", "GET", "#") == "l")
+	assert.Must(keys("GEORADIUS", "g", "0", "0", "1", "km", "STORE", "d1", "STOREDIST", "d2") == "g d1 d2")
+	assert.Must(keys("GEORADIUSBYMEMBER", "g", "m", "1", "km", "STOREDIST", "d") == "g d")
+	assert.Must(keys("DEBUG", "OBJECT", "k") == "k")
+	assert.Must(keys("DEBUG", "SLEEP", "0") == "")
+}
+
+func isNoPerm(resp *redis.Resp) bool {
+	return resp.IsError() && strings.HasPrefix(string(resp.Value), "NOPERM")
+}
+
+func TestACLUsers(t *testing.T) {
+	resetACLUsers()
+	defer resetACLUsers()
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return RespOK
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(string(handleTestRequest(s, d, "ACL", "WHOAMI").Value) == "default")
+
+	assert.Must(handleTestRequest(s, d, "ACL", "SETUSER", "alice", "on", ">secret",
+		"~cache:*", "&news.*", "+@read", "+set", "-@dangerous").IsString())
+	assert.Must(handleTestRequest(s, d, "ACL", "SETUSER", "bob", "bad-rule").IsError())
+
+	resp := handleTestRequest(s, d, "ACL", "USERS")
+	assert.Must(resp.IsArray() && len(resp.Array) == 2)
+	assert.Must(string(resp.Array[0].Value) == "alice" && string(resp.Array[1].Value) == "default")
+
+	a := newTestSession()
+	assert.Must(handleTestRequest(a, d, "AUTH", "alice", "wrong").IsError())
+	assert.Must(handleTestRequest(a, d, "AUTH", "alice", "secret").IsString())
+	assert.Must(a.user == "alice")
+
+	assert.Must(handleTestRequest(a, d, "GET", "cache:1").IsString())
+	assert.Must(handleTestRequest(a, d, "SET", "cache:1", "v").IsString())
+	assert.Must(isNoPerm(handleTestRequest(a, d, "GET", "user:1")))
+	assert.Must(isNoPerm(handleTestRequest(a, d, "DEL", "cache:1")))
+	assert.Must(isNoPerm(handleTestRequest(a, d, "KEYS", "*")))
+	assert.Must(isNoPerm(handleTestRequest(a, d, "MGET", "cache:1", "user:1")))
+	assert.Must(isNoPerm(handleTestRequest(a, d, "ACL", "SETUSER", "alice", "allkeys")))
+	assert.Must(isNoPerm(handleTestRequest(a, d, "PUBLISH", "news.1", "msg")))
+
+	assert.Must(handleTestRequest(s, d, "ACL", "SETUSER", "alice", "+publish").IsString())
+	assert.Must(handleTestRequest(a, d, "PUBLISH", "news.1", "msg").IsString())
+	assert.Must(isNoPerm(handleTestRequest(a, d, "PUBLISH", "chat", "msg")))
+
+	resp = handleTestRequest(s, d, "ACL", "GETUSER", "alice")
+	assert.Must(resp.IsArray() && len(resp.Array) == 14)
+	assert.Must(string(resp.Array[4].Value) == "commands")
+	assert.Must(string(resp.Array[5].Value) == "+@read +set -@dangerous +publish")
+	resp = handleTestRequest(s, d, "ACL", "GETUSER", "nobody")
+	assert.Must(resp.IsBulkBytes() && resp.Value == nil)
+	s.proto = 3
+	assert.Must(handleTestRequest(s, d, "ACL", "GETUSER", "nobody").IsNull())
+	s.proto = 2
+
+	resp = handleTestRequest(s, d, "ACL", "LIST")
+	assert.Must(resp.IsArray() && len(resp.Array) == 2)
+	assert.Must(strings.HasPrefix(string(resp.Array[0].Value), "user alice on #"))
+
+	assert.Must(handleTestRequest(s, d, "ACL", "SETUSER", "alice", "off").IsString())
+	assert.Must(handleTestRequest(a, d, "GET", "user:1").IsString())
+	assert.Must(string(handleTestRequest(a, d, "ACL", "WHOAMI").Value) == "default")
+
+	assert.Must(handleTestRequest(s, d, "ACL", "DELUSER", "default").IsError())
+	resp = handleTestRequest(s, d, "ACL", "DELUSER", "alice", "nobody")
+	assert.Must(resp.IsInt() && string(resp.Value) == "1")
+}
+
+func TestACLDefaultUser(t *testing.T) {
+	resetACLUsers()
+	defer resetACLUsers()
+
+	c := *config
+	c.SessionAuth = "secret"
+
+	s := newTestSession()
+	s.config = &c
+
+	resp := handleTestRequest(s, nil, "ACL", "WHOAMI")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "NOAUTH"))
+	assert.Must(handleTestRequest(s, nil, "AUTH", "default", "secret").IsString())
+	assert.Must(string(handleTestRequest(s, nil, "ACL", "WHOAMI").Value) == "default")
+
+	assert.Must(handleTestRequest(s, nil, "ACL", "SETUSER", "default", "-@all", "+acl").IsString())
+	assert.Must(isNoPerm(handleTestRequest(s, nil, "PING")))
+	assert.Must(handleTestRequest(s, nil, "AUTH", "secret").IsString())
+	assert.Must(handleTestRequest(s, nil, "ACL", "SETUSER", "default", "resetpass", ">other", "+@all").IsString())
+	assert.Must(handleTestRequest(s, nil, "AUTH", "secret").IsError())
+	assert.Must(handleTestRequest(s, nil, "AUTH", "other").IsString())
+}
+
+func TestLoadACLFile(t *testing.T) {
+	resetACLUsers()
+	defer resetACLUsers()
+
+	var path = filepath.Join(t.TempDir(), "users.acl")
+	assert.MustNoError(os.WriteFile(path, []byte(`
+# comments and empty lines are skipped
+user alice on >secret ~cache:* +@read
+user bob off nopass allkeys +@all
+`), 0644))
+	assert.MustNoError(LoadACLFile(path))
+
+	var u = getACLUser("alice", config)
+	assert.Must(u != nil && u.enabled && u.checkPassword("secret") && !u.checkPassword("wrong"))
+	assert.Must(u.canRun("GET", "", 0) && !u.canRun("SET", "", FlagWrite))
+	assert.Must(u.canAccessKey([]byte("cache:1")) && !u.canAccessKey([]byte("user:1")))
+
+	u = getACLUser("bob", config)
+	assert.Must(u != nil && !u.enabled && !u.checkPassword(""))
+
+	u = getACLUser("default", config)
+	assert.Must(u.canRun("CLIENT", "CLIENT|KILL", 0) && u.canRun("MONITOR", "", 0))
+
+	config.SessionAdminEnabled = false
+	defer func() {
+		config.SessionAdminEnabled = true
+	}()
+	u = getACLUser("default", config)
+	assert.Must(u.canRun("CLIENT", "CLIENT|SETNAME", 0) && !u.canRun("CLIENT", "CLIENT|KILL", 0))
+	assert.Must(!u.canRun("MONITOR", "", 0) && u.canRun("GET", "", 0))
+	assert.Must(u.clone().apply("+client|") != nil && u.clone().apply("+client|kill|x") != nil)
+
+	assert.MustNoError(os.WriteFile(path, []byte("user alice on +@unknown\n"), 0644))
+	assert.Must(LoadACLFile(path) != nil)
+	assert.Must(getACLUser("alice", config) != nil)
+}
+
+func TestACLDefaultUserRotation(t *testing.T) {
+	resetACLUsers()
+	defer resetACLUsers()
+	c := *config
+	c.SessionAuth = "old"
+	c.auth = &proxyAuth{}
+
+	s := newTestSession()
+	s.config = &c
+
+	c.sessionAuthRotation().Set("old", "new", time.Now().Add(time.Hour))
+	assert.Must(handleTestRequest(s, nil, "AUTH", "old").IsString())
+	assert.Must(handleTestRequest(s, nil, "AUTH", "new").IsString())
+	assert.Must(handleTestRequest(s, nil, "AUTH", "other").IsError())
+
+	c.sessionAuthRotation().Set("old", "new", time.Now().Add(-time.Second))
+	assert.Must(handleTestRequest(s, nil, "AUTH", "old").IsError())
+	assert.Must(handleTestRequest(s, nil, "AUTH", "new").IsString())
+
+	c.sessionAuthRotation().Set("", "", time.Time{})
+	c.setSessionAuth("refreshed")
+	assert.Must(handleTestRequest(s, nil, "AUTH", "new").IsError())
+	assert.Must(handleTestRequest(s, nil, "AUTH", "refreshed").IsString())
+}
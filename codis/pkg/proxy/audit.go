@@ -0,0 +1,199 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"log/syslog"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+const MaxAuditKeyLen = 128
+
+// audit records the commands of the audited categories, e.g. write and admin,
+// to a file rolled daily or to syslog. Records are written in background and
+// dropped if the writer falls behind.
+var audit struct {
+	sync.RWMutex
+	enabled atomic2.Bool
+
+	w          io.WriteCloser
+	categories []string
+	records    chan *auditRecord
+	done       chan struct{}
+
+	written atomic2.Int64
+	dropped atomic2.Int64
+}
+
+type auditRecord struct {
+	Time    string `json:"time"`
+	Session int64  `json:"session"`
+	Addr    string `json:"addr"`
+	User    string `json:"user"`
+	DB      int32  `json:"db"`
+	Cmd     string `json:"cmd"`
+	Key     string `json:"key,omitempty"`
+}
+
+type AuditStats struct {
+	Categories []string `json:"categories"`
+	Written    int64    `json:"written"`
+	Dropped    int64    `json:"dropped"`
+}
+
+func parseAuditCategories(list string) ([]string, error) {
+	var categories []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s == "" {
+			continue
+		}
+		if !isACLCategory(s) {
+			return nil, errors.Errorf("invalid category '%s'", s)
+		}
+		categories = append(categories, s)
+	}
+	return categories, nil
+}
+
+// OpenAuditLog starts the audit log to the target, a file path or "syslog".
+// The audit log opened before is closed first.
+func OpenAuditLog(target string, categories string) error {
+	list, err := parseAuditCategories(categories)
+	if err != nil {
+		return err
+	}
+	CloseAuditLog()
+	if target == "" {
+		return nil
+	}
+
+	var w io.WriteCloser
+	if target == "syslog" {
+		w, err = syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, "codis-proxy-audit")
+	} else {
+		w, err = log.NewRollingFile(target, log.DailyRolling)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	audit.Lock()
+	defer audit.Unlock()
+	audit.w, audit.categories = w, list
+	audit.records = make(chan *auditRecord, 4096)
+	audit.done = make(chan struct{})
+	audit.enabled.Set(len(list) != 0)
+
+	go func(w io.WriteCloser, records <-chan *auditRecord, done chan<- struct{}) {
+		defer close(done)
+		defer w.Close()
+		for r := range records {
+			b, err := json.Marshal(r)
+			if err != nil {
+				continue
+			}
+			if _, err := w.Write(append(b, '\n')); err != nil {
+				log.WarnErrorf(err, "write audit log failed")
+				audit.dropped.Incr()
+			} else {
+				audit.written.Incr()
+			}
+		}
+	}(w, audit.records, audit.done)
+	return nil
+}
+
+// CloseAuditLog stops the audit log after the pending records are written.
+func CloseAuditLog() {
+	audit.Lock()
+	defer audit.Unlock()
+	if audit.records == nil {
+		return
+	}
+	audit.enabled.Set(false)
+	close(audit.records)
+	<-audit.done
+	audit.w, audit.records, audit.done = nil, nil, nil
+}
+
+// SetAuditCategories changes the audited categories of the audit log opened.
+func SetAuditCategories(categories string) error {
+	list, err := parseAuditCategories(categories)
+	if err != nil {
+		return err
+	}
+	audit.Lock()
+	defer audit.Unlock()
+	audit.categories = list
+	audit.enabled.Set(audit.records != nil && len(list) != 0)
+	return nil
+}
+
+func GetAuditStats() *AuditStats {
+	audit.RLock()
+	defer audit.RUnlock()
+	if audit.records == nil {
+		return nil
+	}
+	var categories []string
+	for _, c := range audit.categories {
+		categories = append(categories, strings.ToLower(c))
+	}
+	return &AuditStats{
+		Categories: categories,
+		Written:    audit.written.Int64(),
+		Dropped:    audit.dropped.Int64(),
+	}
+}
+
+func (s *Session) auditRequest(r *Request, user string) {
+	if !audit.enabled.Bool() {
+		return
+	}
+	audit.RLock()
+	defer audit.RUnlock()
+	if audit.records == nil {
+		return
+	}
+	var audited bool
+	for _, c := range audit.categories {
+		if inACLCategory(c, r.OpStr, r.OpFlag) {
+			audited = true
+			break
+		}
+	}
+	if !audited {
+		return
+	}
+	var record = &auditRecord{
+		Time:    time.Now().Format("2006-01-02 15:04:05.000000"),
+		Session: s.id,
+		User:    user,
+		DB:      s.database,
+		Cmd:     r.OpStr,
+	}
+	if s.Conn != nil {
+		record.Addr = s.Conn.RemoteAddr()
+	}
+	if keys := aclKeys(r.Multi, r.OpStr); len(keys) != 0 {
+		var key = keys[0].Value
+		if len(key) > MaxAuditKeyLen {
+			key = key[:MaxAuditKeyLen]
+		}
+		record.Key = string(key)
+	}
+	select {
+	case audit.records <- record:
+	default:
+		audit.dropped.Incr()
+	}
+}
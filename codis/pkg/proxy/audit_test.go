@@ -0,0 +1,63 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	defer CloseAuditLog()
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return RespOK
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	assert.Must(OpenAuditLog("", "write,nosuchcategory") != nil)
+
+	var dir = t.TempDir()
+	assert.MustNoError(OpenAuditLog(filepath.Join(dir, "audit.log"), "write"))
+
+	s := newTestSession()
+	handleTestRequest(s, d, "GET", "key-r")
+	handleTestRequest(s, d, "SET", "key-w", "value")
+	handleTestRequest(s, d, "DEL", "key-d")
+
+	assert.MustNoError(SetAuditCategories("admin"))
+	handleTestRequest(s, d, "SET", "key-x", "value")
+	handleTestRequest(s, d, "SLOWLOG", "LEN")
+
+	assert.Must(GetAuditStats() != nil)
+	CloseAuditLog()
+	assert.Must(GetAuditStats() == nil)
+
+	files, err := filepath.Glob(filepath.Join(dir, "audit.log.*"))
+	assert.MustNoError(err)
+	assert.Must(len(files) == 1)
+	data, err := os.ReadFile(files[0])
+	assert.MustNoError(err)
+
+	var records []*auditRecord
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var r = &auditRecord{}
+		assert.MustNoError(json.Unmarshal(line, r))
+		records = append(records, r)
+	}
+	assert.Must(len(records) == 3)
+	assert.Must(records[0].Cmd == "SET" && records[0].Key == "key-w" && records[0].User == "default")
+	assert.Must(records[1].Cmd == "DEL" && records[1].Key == "key-d")
+	assert.Must(records[2].Cmd == "SLOWLOG" && records[2].Key == "")
+	assert.Must(records[0].Session == s.id)
+}
@@ -35,9 +35,14 @@ type BackendConn struct {
 	}
 	state atomic2.Int64
 
+	// latency is the EWMA of the round trip time in nanoseconds.
+	latency atomic2.Int64
+
 	closed atomic2.Bool
 	config *Config
 
+	breaker *circuitBreaker
+
 	database int
 }
 
@@ -75,6 +80,10 @@ func (bc *BackendConn) PushBack(r *Request) {
 	if r.Batch != nil {
 		r.Batch.Add(1)
 	}
+	if r.trace != nil {
+		r.span = r.trace.addBackend(bc.addr)
+	}
+	r.backend = bc.addr
 	bc.input <- r
 }
 
@@ -155,9 +164,7 @@ func init() {
 }
 
 func (bc *BackendConn) newBackendReader(round int, config *Config) (*redis.Conn, chan<- *Request, error) {
-	c, err := redis.DialTimeout(bc.addr, time.Second*5,
-		config.BackendRecvBufsize.AsInt(),
-		config.BackendSendBufsize.AsInt())
+	c, err := dialTimeout(bc.addr, config)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -165,7 +172,7 @@ func (bc *BackendConn) newBackendReader(round int, config *Config) (*redis.Conn,
 	c.WriterTimeout = config.BackendSendTimeout.Duration()
 	c.SetKeepAlivePeriod(config.BackendKeepAlivePeriod.Duration())
 
-	if err := bc.verifyAuth(c, config.ProductAuth); err != nil {
+	if err := bc.verifyAuth(c, config.productAuth()); err != nil {
 		c.Close()
 		return nil, nil, err
 	}
@@ -180,9 +187,77 @@ func (bc *BackendConn) newBackendReader(round int, config *Config) (*redis.Conn,
 	return c, tasks, nil
 }
 
+func dialTimeout(addr string, config *Config) (*redis.Conn, error) {
+	if config.backendTLS != nil {
+		return redis.DialTLSTimeout(addr, time.Second*5,
+			config.BackendRecvBufsize.AsInt(),
+			config.BackendSendBufsize.AsInt(), config.backendTLS)
+	}
+	return redis.DialTimeout(addr, time.Second*5,
+		config.BackendRecvBufsize.AsInt(),
+		config.BackendSendBufsize.AsInt())
+}
+
+// dialBackend opens a connection that is owned by a single session instead
+// of being shared, e.g. for pub/sub or transactions.
+func dialBackend(addr string, database int, config *Config) (*redis.Conn, error) {
+	c, err := dialTimeout(addr, config)
+	if err != nil {
+		return nil, err
+	}
+	c.ReaderTimeout = config.BackendRecvTimeout.Duration()
+	c.WriterTimeout = config.BackendSendTimeout.Duration()
+	c.SetKeepAlivePeriod(config.BackendKeepAlivePeriod.Duration())
+
+	bc := &BackendConn{addr: addr, config: config}
+	if err := bc.verifyAuth(c, config.productAuth()); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := bc.selectDatabase(c, database); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// doCommands sends the commands in a pipeline and waits for all replies.
+func doCommands(c *redis.Conn, cmds ...[]*redis.Resp) ([]*redis.Resp, error) {
+	for _, multi := range cmds {
+		if err := c.EncodeMultiBulk(multi, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	var replies = make([]*redis.Resp, len(cmds))
+	for i := range replies {
+		resp, err := c.Decode()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = resp
+	}
+	return replies, nil
+}
+
+// verifyAuth authenticates with the password of servers, or with the new and
+// the old ones in turn during a rotation of the password.
 func (bc *BackendConn) verifyAuth(c *redis.Conn, auth string) error {
+	var err error
+	for _, auth := range bc.config.productAuthRotation().Candidates(auth) {
+		var rejected bool
+		if rejected, err = bc.tryAuth(c, auth); err == nil || !rejected {
+			return err
+		}
+	}
+	return err
+}
+
+func (bc *BackendConn) tryAuth(c *redis.Conn, auth string) (bool, error) {
 	if auth == "" {
-		return nil
+		return false, nil
 	}
 
 	multi := []*redis.Resp{
@@ -191,21 +266,21 @@ func (bc *BackendConn) verifyAuth(c *redis.Conn, auth string) error {
 	}
 
 	if err := c.EncodeMultiBulk(multi, true); err != nil {
-		return err
+		return false, err
 	}
 
 	resp, err := c.Decode()
 	switch {
 	case err != nil:
-		return err
+		return false, err
 	case resp == nil:
-		return ErrRespIsRequired
+		return false, ErrRespIsRequired
 	case resp.IsError():
-		return fmt.Errorf("error resp: %s", resp.Value)
+		return true, fmt.Errorf("error resp: %s", resp.Value)
 	case resp.IsString():
-		return nil
+		return false, nil
 	default:
-		return fmt.Errorf("error resp: should be string, but got %s", resp.Type)
+		return false, fmt.Errorf("error resp: should be string, but got %s", resp.Type)
 	}
 }
 
@@ -239,7 +314,16 @@ func (bc *BackendConn) selectDatabase(c *redis.Conn, database int) error {
 }
 
 func (bc *BackendConn) setResponse(r *Request, resp *redis.Resp, err error) error {
+	bc.breaker.record(resp, err)
+	if r.span != nil {
+		r.span.reply.Set(time.Now().UnixNano())
+	}
 	r.Resp, r.Err = resp, err
+	r.leaveFlight()
+	if r.slotStats != nil {
+		r.slotStats.done(r, err != nil || (resp != nil && resp.IsError()))
+	}
+	r.chargeReply(resp)
 	if r.Group != nil {
 		r.Group.Done()
 	}
@@ -252,6 +336,7 @@ func (bc *BackendConn) setResponse(r *Request, resp *redis.Resp, err error) erro
 var (
 	ErrBackendConnReset = errors.New("backend conn reset")
 	ErrRequestIsBroken  = errors.New("request is broken")
+	ErrRequestIsExpired = errors.New("request is expired")
 )
 
 func (bc *BackendConn) run() {
@@ -268,6 +353,21 @@ func (bc *BackendConn) run() {
 		bc, bc.addr, bc.database)
 }
 
+// Latency returns the EWMA of the round trip time, or 0 if not measured.
+func (bc *BackendConn) Latency() int64 {
+	return bc.latency.Int64()
+}
+
+func (bc *BackendConn) updateLatency(d int64) {
+	if d <= 0 {
+		return
+	}
+	if l := bc.latency.Int64(); l != 0 {
+		d = l + (d-l)/8
+	}
+	bc.latency.Set(d)
+}
+
 var (
 	errRespMasterDown = []byte("MASTERDOWN")
 	errRespLoading    = []byte("LOADING")
@@ -282,9 +382,18 @@ func (bc *BackendConn) loopReader(tasks <-chan *Request, c *redis.Conn, round in
 		log.WarnErrorf(err, "backend conn [%p] to %s, db-%d reader-[%d] exit",
 			bc, bc.addr, bc.database, round)
 	}()
+	var timeout = bc.config.BackendRecvTimeout.Duration()
 	for r := range tasks {
+		c.ReaderTimeout = commandTimeout(r.OpStr, r.OpFlag, timeout)
 		resp, err := c.Decode()
 		r.ReceiveFromServerTime = time.Now().UnixNano()
+		if r.SendToServerTime > 0 {
+			d := r.ReceiveFromServerTime - r.SendToServerTime
+			bc.updateLatency(d)
+			if r.IsQuick() && r.IsReadOnly() {
+				recordHedgeSample(time.Duration(d))
+			}
+		}
 		if err != nil {
 			return bc.setResponse(r, nil, fmt.Errorf("backend conn failure, %s", err))
 		}
@@ -356,15 +465,22 @@ func (bc *BackendConn) loopWriter(round int) (err error) {
 			bc.setResponse(r, nil, ErrRequestIsBroken)
 			continue
 		}
+		if r.IsReadOnly() && r.IsExpired() {
+			bc.setResponse(r, nil, ErrRequestIsExpired)
+			continue
+		}
 		if err := p.EncodeMultiBulk(r.Multi); err != nil {
 			return bc.setResponse(r, nil, fmt.Errorf("backend conn failure, %s", err))
 		}
 		if err := p.Flush(len(bc.input) == 0); err != nil {
 			return bc.setResponse(r, nil, fmt.Errorf("backend conn failure, %s", err))
 		} else {
+			r.SendToServerTime = time.Now().UnixNano()
+			if r.span != nil {
+				r.span.send.Set(r.SendToServerTime)
+			}
 			tasks <- r
 		}
-		r.SendToServerTime = time.Now().UnixNano()
 	}
 	return nil
 }
@@ -379,7 +495,20 @@ type sharedBackendConn struct {
 
 	single []*BackendConn
 
+	// lag is the replication lag reported by the master, or -1 if unknown.
+	lag atomic2.Int64
+
+	breaker circuitBreaker
+	probe   backendProbe
+
 	refcnt int
+
+	// expire is when the connections are closed after the last release.
+	expire time.Time
+
+	// warmup is when the warm-up ends, it's reset to 0 once all of the
+	// connections are ready.
+	warmup atomic2.Int64
 }
 
 func newSharedBackendConn(addr string, pool *sharedBackendConnPool) *sharedBackendConn {
@@ -392,11 +521,13 @@ func newSharedBackendConn(addr string, pool *sharedBackendConnPool) *sharedBacke
 		host: []byte(host), port: []byte(port),
 	}
 	s.owner = pool
+	s.breaker.addr, s.breaker.config = addr, pool.config
 	s.conns = make([][]*BackendConn, pool.config.BackendNumberDatabases)
 	for database := range s.conns {
 		parallel := make([]*BackendConn, pool.parallel)
 		for i := range parallel {
 			parallel[i] = NewBackendConn(addr, database, pool.config)
+			parallel[i].breaker = &s.breaker
 		}
 		s.conns[database] = parallel
 	}
@@ -406,10 +537,34 @@ func newSharedBackendConn(addr string, pool *sharedBackendConnPool) *sharedBacke
 			s.single[database] = s.conns[database][0]
 		}
 	}
+	s.lag.Set(replicaLagUnknown)
+	s.warmup.Set(time.Now().Add(pool.config.BackendWarmupTimeout.Duration()).UnixNano())
 	s.refcnt = 1
 	return s
 }
 
+// isWarm returns whether all of the connections are ready, or the warm-up
+// has timed out, so that it can take a share of the reads.
+func (s *sharedBackendConn) isWarm() bool {
+	var warmup = s.warmup.Int64()
+	if warmup == 0 {
+		return true
+	}
+	if time.Now().UnixNano() < warmup {
+		for _, parallel := range s.conns {
+			for _, bc := range parallel {
+				if !bc.IsConnected() {
+					return false
+				}
+			}
+		}
+	}
+	if s.warmup.CompareAndSwap(warmup, 0) {
+		log.Warnf("shared backend conn to %s is warmed up", s.addr)
+	}
+	return true
+}
+
 func (s *sharedBackendConn) Addr() string {
 	if s == nil {
 		return ""
@@ -429,12 +584,24 @@ func (s *sharedBackendConn) Release() {
 	if s.refcnt != 0 {
 		return
 	}
+	delete(s.owner.pool, s.addr)
+	if timeout := s.owner.config.BackendDrainTimeout.Duration(); timeout > 0 {
+		s.owner.draining.Lock()
+		s.expire = time.Now().Add(timeout)
+		s.owner.draining.pool[s.addr] = s
+		s.owner.draining.Unlock()
+		log.Warnf("shared backend conn to %s is draining, expire = %s", s.addr, timeout)
+		return
+	}
+	s.close()
+}
+
+func (s *sharedBackendConn) close() {
 	for _, parallel := range s.conns {
 		for _, bc := range parallel {
 			bc.Close()
 		}
 	}
-	delete(s.owner.pool, s.addr)
 }
 
 func (s *sharedBackendConn) Retain() *sharedBackendConn {
@@ -515,6 +682,16 @@ type sharedBackendConnPool struct {
 	quick    int // The number of quick backend connection
 
 	pool map[string]*sharedBackendConn
+
+	// draining holds the released shared backend conns until they expire,
+	// and they're reused if retained again before that.
+	draining struct {
+		sync.Mutex
+		pool map[string]*sharedBackendConn
+	}
+
+	// next is the start of the round robin of the replicas.
+	next atomic2.Int64
 }
 
 func newSharedBackendConnPool(config *Config, parallel, quick int) *sharedBackendConnPool {
@@ -522,6 +699,7 @@ func newSharedBackendConnPool(config *Config, parallel, quick int) *sharedBacken
 		config: config, parallel: math2.MaxInt(1, parallel), quick: math2.MaxInt(math2.MinInt(quick, parallel-1), 0),
 	}
 	p.pool = make(map[string]*sharedBackendConn)
+	p.draining.pool = make(map[string]*sharedBackendConn)
 	return p
 }
 
@@ -533,6 +711,22 @@ func (p *sharedBackendConnPool) KeepAlive() {
 	for _, bc := range p.pool {
 		bc.KeepAlive()
 	}
+	p.Drain(false)
+}
+
+// Drain closes the draining shared backend conns that have expired, or all
+// of them if force is true.
+func (p *sharedBackendConnPool) Drain(force bool) {
+	p.draining.Lock()
+	defer p.draining.Unlock()
+	var now = time.Now()
+	for addr, bc := range p.draining.pool {
+		if force || now.After(bc.expire) {
+			delete(p.draining.pool, addr)
+			bc.close()
+			log.Warnf("shared backend conn to %s is drained", addr)
+		}
+	}
 }
 
 func (p *sharedBackendConnPool) Get(addr string) *sharedBackendConn {
@@ -542,9 +736,17 @@ func (p *sharedBackendConnPool) Get(addr string) *sharedBackendConn {
 func (p *sharedBackendConnPool) Retain(addr string) *sharedBackendConn {
 	if bc := p.pool[addr]; bc != nil {
 		return bc.Retain()
-	} else {
-		bc = newSharedBackendConn(addr, p)
+	}
+	p.draining.Lock()
+	defer p.draining.Unlock()
+	if bc := p.draining.pool[addr]; bc != nil {
+		delete(p.draining.pool, addr)
+		bc.refcnt = 1
 		p.pool[addr] = bc
+		log.Warnf("shared backend conn to %s is reused", addr)
 		return bc
 	}
+	bc := newSharedBackendConn(addr, p)
+	p.pool[addr] = bc
+	return bc
 }
@@ -80,3 +80,55 @@ func TestBackend(t *testing.T) {
 		assert.Must(string(r.Resp.Value) == strconv.Itoa(i))
 	}
 }
+
+func TestSharedBackendConnDrain(t *testing.T) {
+	config := NewDefaultConfig()
+	config.BackendDrainTimeout.Set(time.Hour)
+
+	p := newSharedBackendConnPool(config, 1, 0)
+	s := p.Retain("127.0.0.1:0")
+	s.Release()
+	assert.Must(p.Get(s.Addr()) == nil && s.single[0].closed.IsFalse())
+
+	assert.Must(p.Retain(s.Addr()) == s)
+	s.Release()
+	p.Drain(false)
+	assert.Must(s.single[0].closed.IsFalse())
+	p.Drain(true)
+	assert.Must(s.single[0].closed.IsTrue())
+
+	n := p.Retain(s.Addr())
+	assert.Must(n != s)
+	n.Release()
+	p.Drain(true)
+}
+
+func TestSharedBackendConnWarmup(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewString([]byte("OK"))
+	})
+	defer b.Close()
+
+	config := NewDefaultConfig()
+	config.BackendWarmupTimeout.Set(time.Hour)
+
+	p := newSharedBackendConnPool(config, 2, 0)
+	s := p.Retain(b.Addr())
+	defer s.Release()
+	for i := 0; !s.isWarm(); i++ {
+		assert.Must(i < 100)
+		time.Sleep(time.Millisecond * 10)
+	}
+	for _, parallel := range s.conns {
+		for _, bc := range parallel {
+			assert.Must(bc.IsConnected())
+		}
+	}
+
+	// It's never warm before the timeout if a connection can't be made.
+	n := p.Retain("127.0.0.1:0")
+	defer n.Release()
+	assert.Must(!n.isWarm())
+	n.warmup.Set(time.Now().UnixNano())
+	assert.Must(n.isWarm())
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// keyBatch is the keys of a request belonging to the same slot, index is
+// the position of each key in the request.
+type keyBatch struct {
+	slot  int
+	index []int
+
+	replies []*redis.Resp
+	err     error
+}
+
+// handleRequestBatch splits a request with many keys, e.g. MGET or DEL, into
+// a sub-request for each slot, which are all sent at once, except that at
+// most session_batch_concurrency of them are in flight to the same backend.
+// The keys of a slot being migrated are still sent one by one. Once all
+// replies are received, merge is called in Coalesce, unless any of them is
+// an error, e.g. TRYAGAIN of a fenced slot, which is replied.
+func (s *Session) handleRequestBatch(r *Request, d *Router, merge func(batches []*keyBatch) error) error {
+	var slots = make(map[int]*keyBatch)
+	var batches []*keyBatch
+	for i, key := range r.Multi[1:] {
+		id := d.keySlot(key.Value)
+		b := slots[id]
+		if b == nil {
+			b = &keyBatch{slot: id}
+			slots[id] = b
+			batches = append(batches, b)
+		}
+		b.index = append(b.index, i)
+	}
+
+	var concurrency = s.config.SessionBatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var inflight = make(map[string]chan struct{})
+	var wg sync.WaitGroup
+	for _, b := range batches {
+		var addr = d.slotBackendAddr(b.slot)
+		var sem = inflight[addr]
+		if sem == nil {
+			sem = make(chan struct{}, concurrency)
+			inflight[addr] = sem
+		}
+		wg.Add(1)
+		go func(b *keyBatch) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+			}()
+			b.replies, b.err = s.doKeyBatch(r, d, b)
+		}(b)
+	}
+	r.Batch.Add(1)
+	go func() {
+		defer r.Batch.Done()
+		wg.Wait()
+	}()
+
+	r.Coalesce = func() error {
+		for _, b := range batches {
+			if b.err != nil {
+				return b.err
+			}
+			for _, resp := range b.replies {
+				if resp.IsError() {
+					r.Resp = resp
+					return nil
+				}
+			}
+		}
+		return merge(batches)
+	}
+	return nil
+}
+
+// doKeyBatch sends the keys of the batch and waits for the replies, which
+// are either one reply for all the keys, or one reply for each key.
+func (s *Session) doKeyBatch(r *Request, d *Router, b *keyBatch) ([]*redis.Resp, error) {
+	var multi = make([]*redis.Resp, 0, len(b.index)+1)
+	multi = append(multi, r.Multi[0])
+	for _, i := range b.index {
+		multi = append(multi, r.Multi[i+1])
+	}
+	var wg = &sync.WaitGroup{}
+
+	sub := r.MakeSubRequest(1)
+	sub[0].Batch = wg
+	sub[0].Multi = multi
+	ok, err := d.dispatchBatch(&sub[0], b.slot)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		sub = r.MakeSubRequest(len(b.index))
+		for i := range sub {
+			sub[i].Batch = wg
+			sub[i].Multi = []*redis.Resp{multi[0], multi[i+1]}
+			if err := d.dispatch(&sub[i]); err != nil {
+				wg.Wait()
+				return nil, err
+			}
+		}
+	}
+	wg.Wait()
+
+	var replies = make([]*redis.Resp, len(sub))
+	for i := range sub {
+		switch {
+		case sub[i].Err != nil:
+			return nil, sub[i].Err
+		case sub[i].Resp == nil:
+			return nil, ErrRespIsRequired
+		}
+		replies[i] = sub[i].Resp
+	}
+	return replies, nil
+}
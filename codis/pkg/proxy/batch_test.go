@@ -0,0 +1,116 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestBatchRequest(t *testing.T) {
+	var calls atomic2.Int64
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		calls.Incr()
+		switch string(multi[0].Value) {
+		case "MGET":
+			var array []*redis.Resp
+			for _, key := range multi[1:] {
+				array = append(array, redis.NewBulkBytes(key.Value))
+			}
+			return redis.NewArray(array)
+		default:
+			return redis.NewInt([]byte(strconv.Itoa(len(multi) - 1)))
+		}
+	}
+	b1 := newFakeBackend(handler)
+	defer b1.Close()
+	b2 := newFakeBackend(handler)
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	threshold, concurrency := config.SessionBatchThreshold, config.SessionBatchConcurrency
+	defer func() {
+		config.SessionBatchThreshold, config.SessionBatchConcurrency = threshold, concurrency
+	}()
+	config.SessionBatchThreshold, config.SessionBatchConcurrency = 8, 2
+
+	var args = []string{"MGET"}
+	for i := 0; i < 64; i++ {
+		args = append(args, "{tag"+strconv.Itoa(i%4)+"}"+strconv.Itoa(i))
+	}
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, args...)
+	assert.Must(resp.IsArray() && len(resp.Array) == 64)
+	for i, value := range resp.Array {
+		assert.Must(string(value.Value) == args[i+1])
+	}
+	assert.Must(calls.Int64() == 4)
+
+	args[0] = "DEL"
+	resp = handleTestRequest(s, d, args...)
+	assert.Must(resp.IsInt() && string(resp.Value) == "64")
+	assert.Must(calls.Int64() == 8)
+
+	// Requests with fewer keys are still split into single keys.
+	resp = handleTestRequest(s, d, args[:5]...)
+	assert.Must(resp.IsInt() && string(resp.Value) == "4")
+	assert.Must(calls.Int64() == 12)
+}
+
+func TestBatchRequestInflight(t *testing.T) {
+	var total, peak atomic2.Int64
+	newBackend := func() (*fakeBackend, *atomic2.Int64) {
+		var inflight, max atomic2.Int64
+		b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			for n := inflight.Incr(); n > max.Int64(); {
+				max.Set(n)
+			}
+			for n := total.Incr(); n > peak.Int64(); {
+				peak.Set(n)
+			}
+			time.Sleep(time.Millisecond * 10)
+			inflight.Decr()
+			total.Decr()
+			return redis.NewInt([]byte(strconv.Itoa(len(multi) - 1)))
+		})
+		return b, &max
+	}
+	b1, max1 := newBackend()
+	defer b1.Close()
+	b2, max2 := newBackend()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	threshold, concurrency := config.SessionBatchThreshold, config.SessionBatchConcurrency
+	defer func() {
+		config.SessionBatchThreshold, config.SessionBatchConcurrency = threshold, concurrency
+	}()
+	config.SessionBatchThreshold, config.SessionBatchConcurrency = 8, 1
+
+	var args = []string{"DEL"}
+	var count [2]int
+	for i := 0; count[0] < 4 || count[1] < 4; i++ {
+		key := "key" + strconv.Itoa(i)
+		if n := &count[Hash([]byte(key))%2]; *n < 4 {
+			*n++
+			args = append(args, key)
+		}
+	}
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, args...)
+	assert.Must(resp.IsInt() && string(resp.Value) == "8")
+	assert.Must(max1.Int64() == 1 && max2.Int64() == 1)
+	assert.Must(peak.Int64() == 2)
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/bytesize"
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+// batchLimit is the max batch size and bytes of requests, zero means
+// unlimited, and -1 means the limit of max_batch_size or max_batch_bytes.
+type batchLimit struct {
+	size, bytes int64
+}
+
+type batchLimits struct {
+	batchLimit
+	cmds map[string]batchLimit
+}
+
+// batchLimitTable holds the limits of max_batch_size, max_batch_bytes and
+// cmd_batch_limit, replaced as a whole when any of them is set.
+var batchLimitTable atomic.Value
+
+func init() {
+	batchLimitTable.Store(&batchLimits{})
+}
+
+// parseCmdBatchLimit parses the limits as "cmd:size[:bytes]" separated by
+// commas, e.g. "mget:1000,hmset:100:1mb".
+func parseCmdBatchLimit(list string) (map[string]batchLimit, error) {
+	var limits = make(map[string]batchLimit)
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		fields := strings.Split(s, ":")
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, errors.Errorf("invalid limit '%s', should be cmd:size[:bytes]", s)
+		}
+		var name = strings.ToUpper(strings.TrimSpace(fields[0]))
+		if name == "" {
+			return nil, errors.Errorf("invalid limit '%s', should be cmd:size[:bytes]", s)
+		}
+		var l = batchLimit{bytes: -1}
+		n, err := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid batch size of '%s'", s)
+		}
+		l.size = n
+		if len(fields) == 3 {
+			n, err := bytesize.Parse(strings.TrimSpace(fields[2]))
+			if err != nil || n < 0 {
+				return nil, errors.Errorf("invalid batch bytes of '%s'", s)
+			}
+			l.bytes = n
+		}
+		limits[name] = l
+	}
+	return limits, nil
+}
+
+// SetBatchLimit replaces the limits of all commands, and of the commands of
+// cmd_batch_limit, which override the former.
+func SetBatchLimit(size, bytes int64, list string) error {
+	cmds, err := parseCmdBatchLimit(list)
+	if err != nil {
+		return err
+	}
+	batchLimitTable.Store(&batchLimits{
+		batchLimit: batchLimit{size: size, bytes: bytes}, cmds: cmds,
+	})
+	return nil
+}
+
+// batchSize returns the number of keys, fields or members of the request,
+// i.e. the pairs are counted once.
+func batchSize(r *Request) int64 {
+	var n = int64(len(r.Multi))
+	switch {
+	case r.OpFlag&FlagReqPairValues != 0:
+		return (n - 2) / 2
+	case r.OpFlag&FlagReqKeyValues != 0:
+		return (n - 1) / 2
+	case r.OpFlag&FlagReqValues != 0:
+		return n - 2
+	}
+	return n - 1
+}
+
+// checkBatchLimit returns the error reply if the batch size or bytes of the
+// request exceed the limits of the command.
+func checkBatchLimit(r *Request) *redis.Resp {
+	var t = batchLimitTable.Load().(*batchLimits)
+	var l = t.batchLimit
+	if x, ok := t.cmds[r.OpStr]; ok {
+		l.size = x.size
+		if x.bytes >= 0 {
+			l.bytes = x.bytes
+		}
+	}
+	if l.size > 0 {
+		if n := batchSize(r); n > l.size {
+			return redis.NewErrorf("ERR batch of '%s' is too large, %d exceeds batch size limit %d", r.OpStr, n, l.size)
+		}
+	}
+	if l.bytes > 0 {
+		if n := multiSize(r.Multi); n > l.bytes {
+			return redis.NewErrorf("ERR batch of '%s' is too large, %d bytes exceeds batch bytes limit %d", r.OpStr, n, l.bytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func newBatchRequest(opstr string, n int, args ...string) *Request {
+	r := newTestRequest(append([]string{opstr}, args...)...)
+	for i := 0; i < n; i++ {
+		r.Multi = append(r.Multi, newTestRequest(strconv.Itoa(i)).Multi[0])
+	}
+	r.OpStr = opstr
+	r.OpFlag = getOpInfoForTest(opstr).Flag
+	return r
+}
+
+func TestBatchLimit(t *testing.T) {
+	defer SetBatchLimit(0, 0, "")
+
+	_, err := parseCmdBatchLimit("mget:1000, hmset:100:1mb, del:0")
+	assert.MustNoError(err)
+	for _, s := range []string{"mget", "mget:-1", ":10", "hmset:100:x", "hmset:1:2:3"} {
+		_, err := parseCmdBatchLimit(s)
+		assert.Must(err != nil)
+	}
+
+	assert.Must(checkBatchLimit(newBatchRequest("MGET", 5000)) == nil)
+
+	assert.MustNoError(SetBatchLimit(500, 0, "mget:1000,hmset:100:1kb,del:0"))
+	assert.Must(checkBatchLimit(newBatchRequest("MGET", 1000)) == nil)
+	assert.Must(checkBatchLimit(newBatchRequest("MGET", 1001)).IsError())
+	assert.Must(checkBatchLimit(newBatchRequest("EXISTS", 500)) == nil)
+	assert.Must(checkBatchLimit(newBatchRequest("EXISTS", 501)).IsError())
+	assert.Must(checkBatchLimit(newBatchRequest("DEL", 5000)) == nil)
+	assert.Must(checkBatchLimit(newBatchRequest("HMSET", 200, "key")) == nil)
+	assert.Must(checkBatchLimit(newBatchRequest("HMSET", 202, "key")).IsError())
+	assert.Must(checkBatchLimit(newBatchRequest("MSET", 1000)) == nil)
+	assert.Must(checkBatchLimit(newBatchRequest("MSET", 1002)).IsError())
+
+	big := newBatchRequest("HMSET", 2, "key")
+	big.Multi[3].Value = make([]byte, 1024)
+	assert.Must(checkBatchLimit(big).IsError())
+
+	assert.MustNoError(SetBatchLimit(0, 1024, "mget:10"))
+	big = newBatchRequest("MGET", 1)
+	assert.Must(checkBatchLimit(big) == nil)
+	big.Multi[1].Value = make([]byte, 1024)
+	assert.Must(checkBatchLimit(big).IsError())
+}
@@ -0,0 +1,265 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+const MaxBigKeyRecords = 1024
+
+type BigKeyInfo struct {
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	OpStr    string `json:"opstr"`
+	UnixTime int64  `json:"unixtime"`
+	Count    int64  `json:"count"`
+}
+
+var bigkeys struct {
+	sync.Mutex
+	data  map[string]*BigKeyInfo
+	dirty bool
+
+	threshold atomic2.Int64
+}
+
+func init() {
+	bigkeys.data = make(map[string]*BigKeyInfo, 64)
+}
+
+func StatsSetBigKeyThreshold(n int64) {
+	if n < 0 {
+		return
+	}
+	bigkeys.threshold.Set(n)
+}
+
+// recordBigKey adds the key into the big-key report if size exceeds the
+// configured threshold. The findings of a key are aggregated into a single
+// record, and once the report is full, the record found least recently is
+// replaced by the new key, as a ring buffer.
+func recordBigKey(key []byte, size int64, opstr string) bool {
+	threshold := bigkeys.threshold.Int64()
+	if threshold <= 0 || size < threshold {
+		return false
+	}
+	bigkeys.Lock()
+	defer bigkeys.Unlock()
+	info := bigkeys.data[string(key)]
+	if info == nil {
+		if len(bigkeys.data) >= MaxBigKeyRecords {
+			evictOldestBigKey()
+		}
+		info = &BigKeyInfo{Key: string(key)}
+		bigkeys.data[info.Key] = info
+		log.Warnf("big key detected: key = '%s', size = %d, opstr = %s", key, size, opstr)
+	}
+	if t := bigKeyType(opstr); t != "" || info.Type == "" {
+		info.Type = t
+	}
+	info.Size = size
+	info.OpStr = opstr
+	info.UnixTime = time.Now().Unix()
+	info.Count++
+	bigkeys.dirty = true
+	return true
+}
+
+func evictOldestBigKey() {
+	var oldest *BigKeyInfo
+	for _, info := range bigkeys.data {
+		if oldest == nil || info.UnixTime < oldest.UnixTime {
+			oldest = info
+		}
+	}
+	if oldest != nil {
+		delete(bigkeys.data, oldest.Key)
+	}
+}
+
+// bigKeyType returns the type of the key as of the category of the command,
+// or empty if it's unknown, e.g. DEBUG OBJECT.
+func bigKeyType(opstr string) string {
+	switch {
+	case aclCategorySet["HASH"][opstr]:
+		return "hash"
+	case aclCategorySet["LIST"][opstr]:
+		return "list"
+	case aclCategorySet["SET"][opstr]:
+		return "set"
+	case aclCategorySet["SORTEDSET"][opstr], aclCategorySet["GEO"][opstr]:
+		return "zset"
+	case aclCategorySet["STREAM"][opstr]:
+		return "stream"
+	case aclCategorySet["STRING"][opstr], aclCategorySet["BITMAP"][opstr],
+		aclCategorySet["HYPERLOGLOG"][opstr]:
+		return "string"
+	}
+	return ""
+}
+
+// checkBigValue records the key if the value replied is too large, it's
+// used for commands with FlagRespReturnSingleValue.
+func checkBigValue(r *Request) {
+	if r.Resp.IsBulkBytes() && r.Resp.Value != nil {
+		recordBigKey(getHashKey(r.Multi, r.OpStr), int64(len(r.Resp.Value)), r.OpStr)
+	}
+}
+
+// checkBigArray records the key if the elements replied are too large in
+// total, it's used for commands with FlagRespReturnArray, which may reply
+// a single value as well, e.g. ZRANDMEMBER without count.
+func checkBigArray(r *Request) {
+	if r.Resp.IsArray() || r.Resp.IsBulkBytes() {
+		recordBigKey(getHashKey(r.Multi, r.OpStr), respSize(r.Resp), r.OpStr)
+	}
+}
+
+// maxValueBytes is the limit of values written, as max_value_bytes.
+var maxValueBytes atomic2.Int64
+
+func SetMaxValueBytes(n int64) {
+	if n < 0 {
+		return
+	}
+	maxValueBytes.Set(n)
+}
+
+// checkBigRequest returns the error reply if a value of the request is larger
+// than max_value_bytes, it's used for commands with FlagReqValue etc.
+func checkBigRequest(r *Request) *redis.Resp {
+	var limit = maxValueBytes.Int64()
+	if limit <= 0 {
+		return nil
+	}
+	var first, step = 0, 1
+	switch {
+	case r.OpFlag&(FlagReqValue|FlagReqValues) != 0:
+		first = 2
+	case r.OpFlag&FlagReqPairValues != 0:
+		first, step = 3, 2
+	case r.OpFlag&FlagReqKeyValues != 0:
+		first, step = 2, 2
+	default:
+		return nil
+	}
+	for i := first; i < len(r.Multi); i += step {
+		if n := int64(len(r.Multi[i].Value)); n > limit {
+			return redis.NewErrorf("ERR value of '%s' is too large, %d bytes exceeds max_value_bytes %d", r.OpStr, n, limit)
+		}
+		if r.OpFlag&FlagReqValue != 0 {
+			break
+		}
+	}
+	return nil
+}
+
+func respSize(resp *redis.Resp) int64 {
+	var n = int64(len(resp.Value))
+	for _, x := range resp.Array {
+		n += respSize(x)
+	}
+	return n
+}
+
+func GetBigKeys() []*BigKeyInfo {
+	bigkeys.Lock()
+	defer bigkeys.Unlock()
+	var all = make([]*BigKeyInfo, 0, len(bigkeys.data))
+	for _, info := range bigkeys.data {
+		x := *info
+		all = append(all, &x)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Size > all[j].Size
+	})
+	return all
+}
+
+func ResetBigKeys() {
+	bigkeys.Lock()
+	defer bigkeys.Unlock()
+	bigkeys.data = make(map[string]*BigKeyInfo, 64)
+	bigkeys.dirty = true
+}
+
+// LoadBigKeys restores the big-key report saved by SaveBigKeys, it's fine if
+// the file doesn't exist yet.
+func LoadBigKeys(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+	var all []*BigKeyInfo
+	if err := json.Unmarshal(b, &all); err != nil {
+		return errors.Trace(err)
+	}
+	bigkeys.Lock()
+	defer bigkeys.Unlock()
+	bigkeys.data = make(map[string]*BigKeyInfo, 64)
+	for _, info := range all {
+		if len(bigkeys.data) >= MaxBigKeyRecords {
+			break
+		}
+		bigkeys.data[info.Key] = info
+	}
+	return nil
+}
+
+// SaveBigKeys writes the big-key report to the file if it's changed since it
+// was saved last time.
+func SaveBigKeys(path string) error {
+	bigkeys.Lock()
+	var dirty = bigkeys.dirty
+	bigkeys.dirty = false
+	bigkeys.Unlock()
+	if !dirty {
+		return nil
+	}
+	b, err := json.MarshalIndent(GetBigKeys(), "", "    ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var tmp = path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(tmp, path))
+}
+
+var serializedLengthField = []byte("serializedlength:")
+
+// parseSerializedLength extracts serializedlength from a DEBUG OBJECT reply.
+func parseSerializedLength(reply []byte) (int64, bool) {
+	i := bytes.Index(reply, serializedLengthField)
+	if i < 0 {
+		return 0, false
+	}
+	value := reply[i+len(serializedLengthField):]
+	if j := bytes.IndexByte(value, ' '); j >= 0 {
+		value = value[:j]
+	}
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
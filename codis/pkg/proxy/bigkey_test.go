@@ -0,0 +1,171 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestParseSerializedLength(t *testing.T) {
+	n, ok := parseSerializedLength([]byte("Value at:0x7f refcount:1 encoding:raw serializedlength:12345 lru:1 lru_seconds_idle:2"))
+	assert.Must(ok && n == 12345)
+	n, ok = parseSerializedLength([]byte("Value at:0x7f serializedlength:42"))
+	assert.Must(ok && n == 42)
+	_, ok = parseSerializedLength([]byte("Value at:0x7f refcount:1"))
+	assert.Must(!ok)
+}
+
+func TestDebugObjectBigKey(t *testing.T) {
+	StatsSetBigKeyThreshold(1024 * 1024)
+	defer StatsSetBigKeyThreshold(0)
+	defer ResetBigKeys()
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		switch string(multi[2].Value) {
+		case "big":
+			return redis.NewString([]byte("Value at:0x7f refcount:1 encoding:raw serializedlength:4194304 lru:1 lru_seconds_idle:2"))
+		default:
+			return redis.NewString([]byte("Value at:0x7f refcount:1 encoding:raw serializedlength:5 lru:1 lru_seconds_idle:2"))
+		}
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "DEBUG", "OBJECT", "small").IsString())
+	assert.Must(handleTestRequest(s, d, "DEBUG", "OBJECT", "big").IsString())
+	assert.Must(handleTestRequest(s, d, "DEBUG", "SLEEP", "0").IsError())
+
+	keys := GetBigKeys()
+	assert.Must(len(keys) == 1)
+	assert.Must(keys[0].Key == "big" && keys[0].Size == 4194304)
+	assert.Must(keys[0].OpStr == "DEBUG")
+}
+
+func TestSingleValueBigKey(t *testing.T) {
+	StatsSetBigKeyThreshold(1024)
+	defer StatsSetBigKeyThreshold(0)
+	defer ResetBigKeys()
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		switch string(multi[1].Value) {
+		case "big":
+			return redis.NewBulkBytes(make([]byte, 4096))
+		default:
+			return redis.NewBulkBytes([]byte("value"))
+		}
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "GETEX", "small", "PERSIST").IsBulkBytes())
+	assert.Must(handleTestRequest(s, d, "GETDEL", "big").IsBulkBytes())
+
+	keys := GetBigKeys()
+	assert.Must(len(keys) == 1)
+	assert.Must(keys[0].Key == "big" && keys[0].Size == 4096 && keys[0].OpStr == "GETDEL")
+}
+
+func TestArrayBigKey(t *testing.T) {
+	StatsSetBigKeyThreshold(1024)
+	defer StatsSetBigKeyThreshold(0)
+	defer ResetBigKeys()
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		var array []*redis.Resp
+		for i := 0; i < 8; i++ {
+			array = append(array, redis.NewBulkBytes(make([]byte, 200)))
+		}
+		return redis.NewArray(array)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "ZRANDMEMBER", "zset", "8").IsArray())
+	assert.Must(handleTestRequest(s, d, "SMISMEMBER", "set", "a").IsArray())
+
+	keys := GetBigKeys()
+	assert.Must(len(keys) == 1)
+	assert.Must(keys[0].Key == "zset" && keys[0].Size == 1600)
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	SetMaxValueBytes(8)
+	defer SetMaxValueBytes(0)
+
+	var forwarded int
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		forwarded++
+		return redis.NewString([]byte("OK"))
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "SET", "key", "12345678", "EX", "1000000000").IsString())
+	assert.Must(handleTestRequest(s, d, "SET", "key", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "APPEND", "key", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "LPUSH", "key", "a", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "HSET", "key", "field-123456789", "v").IsString())
+	assert.Must(handleTestRequest(s, d, "HSET", "key", "f", "v", "g", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "GET", "123456789").IsString())
+	assert.Must(handleTestRequest(s, d, "SETEX", "key", "1000000000", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "SETRANGE", "key", "0", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "LINSERT", "key", "BEFORE", "a", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "ZADD", "key", "NX", "1", "a", "2", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "XADD", "key", "*", "f", "123456789").IsError())
+	assert.Must(handleTestRequest(s, d, "MSET", "key-123456789", "v").IsString())
+	assert.Must(handleTestRequest(s, d, "MSET", "key", "v", "key2", "123456789").IsError())
+	assert.Must(forwarded == 4)
+
+	SetMaxValueBytes(0)
+	assert.Must(handleTestRequest(s, d, "SET", "key", "123456789").IsString())
+}
+
+func TestBigKeyReport(t *testing.T) {
+	StatsSetBigKeyThreshold(1024)
+	defer StatsSetBigKeyThreshold(0)
+	defer ResetBigKeys()
+
+	ResetBigKeys()
+	assert.Must(recordBigKey([]byte("hash"), 2048, "HGETALL"))
+	assert.Must(recordBigKey([]byte("hash"), 4096, "DEBUG"))
+	keys := GetBigKeys()
+	assert.Must(len(keys) == 1 && keys[0].Type == "hash" && keys[0].Size == 4096 && keys[0].Count == 2)
+
+	for i := 0; i < MaxBigKeyRecords; i++ {
+		assert.Must(recordBigKey([]byte("key-"+strconv.Itoa(i)), 2048, "GET"))
+	}
+	assert.Must(len(GetBigKeys()) == MaxBigKeyRecords)
+
+	var path = filepath.Join(t.TempDir(), "bigkeys.json")
+	assert.MustNoError(LoadBigKeys(path))
+	assert.MustNoError(SaveBigKeys(path))
+	ResetBigKeys()
+	assert.Must(len(GetBigKeys()) == 0)
+	assert.MustNoError(LoadBigKeys(path))
+	keys = GetBigKeys()
+	assert.Must(len(keys) == MaxBigKeyRecords && keys[0].Type != "" && keys[0].Count != 0)
+
+	s := newTestSession()
+	resp := handleTestRequest(s, nil, "XMONITOR", "BIGKEYS")
+	assert.Must(resp.IsArray() && len(resp.Array) == MaxBigKeyRecords && len(resp.Array[0].Array) == 6)
+	assert.Must(string(handleTestRequest(s, nil, "XMONITOR", "BIGKEYS", "RESET").Value) == "OK")
+	assert.Must(len(handleTestRequest(s, nil, "XMONITOR", "BIGKEYS").Array) == 0)
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// handleRequestBitOp forwards BITOP if the destination and all keys belong to
+// the same slot. Otherwise the proxy reads each string, computes the result,
+// and writes it to the destination with SET, if no string is larger than
+// bitop_max_operand_size.
+func (s *Session) handleRequestBitOp(r *Request, d *Router) error {
+	if len(r.Multi) < 4 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'bitop' command")
+		return nil
+	}
+	var op = strings.ToUpper(string(r.Multi[1].Value))
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(r.Multi) != 4 {
+			r.Resp = redis.NewErrorf("ERR BITOP NOT must be called with a single source key.")
+			return nil
+		}
+	default:
+		r.Resp = redis.NewErrorf("ERR syntax error")
+		return nil
+	}
+	var dest, keys = r.Multi[2], r.Multi[3:]
+	if d.isSameSlot(r.Multi[2:]) {
+		return d.dispatch(r)
+	}
+	var limit = s.config.BitOpMaxOperandSize.Int64()
+	if limit == 0 {
+		r.Resp = redis.NewErrorf("ERR keys in 'BITOP' command must be in the same slot")
+		return nil
+	}
+	r.Coalesce = func() error {
+		lens, err := s.dispatchEachKey(r, d, keys, "STRLEN")
+		if err != nil {
+			return err
+		}
+		for i, resp := range lens {
+			switch n, err := redis.Btoi64(resp.Value); {
+			case resp.IsError():
+				r.Resp = resp
+				return nil
+			case err != nil:
+				r.Resp = redis.NewErrorf("ERR bad strlen resp: %s", resp.Value)
+				return nil
+			case n > limit:
+				r.Resp = redis.NewErrorf("ERR key '%s' has %d bytes, more than %d", keys[i].Value, n, limit)
+				return nil
+			}
+		}
+		values, err := s.dispatchEachKey(r, d, keys, "GET")
+		if err != nil {
+			return err
+		}
+		var operands = make([][]byte, len(values))
+		for i, resp := range values {
+			if resp.IsError() {
+				r.Resp = resp
+				return nil
+			}
+			operands[i] = resp.Value
+		}
+		result := computeBitOp(op, operands)
+
+		var multi = []*redis.Resp{redis.NewBulkBytes([]byte("DEL")), dest}
+		if len(result) != 0 {
+			multi = []*redis.Resp{redis.NewBulkBytes([]byte("SET")), dest, redis.NewBulkBytes(result)}
+		}
+		resp, err := dispatchWait(r, d, multi)
+		switch {
+		case err != nil:
+			return err
+		case resp.IsError():
+			r.Resp = resp
+		default:
+			r.Resp = redis.NewInt([]byte(strconv.Itoa(len(result))))
+		}
+		return nil
+	}
+	return nil
+}
+
+// computeBitOp follows redis, the shorter strings are padded with zero bytes.
+func computeBitOp(op string, operands [][]byte) []byte {
+	var size int
+	for _, b := range operands {
+		if len(b) > size {
+			size = len(b)
+		}
+	}
+	var result = make([]byte, size)
+	if op == "NOT" {
+		for i, c := range operands[0] {
+			result[i] = ^c
+		}
+		return result
+	}
+	copy(result, operands[0])
+	for _, b := range operands[1:] {
+		for i := range result {
+			var c byte
+			if i < len(b) {
+				c = b[i]
+			}
+			switch op {
+			case "AND":
+				result[i] &= c
+			case "OR":
+				result[i] |= c
+			case "XOR":
+				result[i] ^= c
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestBitOpCrossSlot(t *testing.T) {
+	var mu sync.Mutex
+	var data = map[string]string{
+		"a": "\xf0\x0f",
+		"b": "\xff",
+	}
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		mu.Lock()
+		defer mu.Unlock()
+		var key = string(multi[1].Value)
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "STRLEN":
+			return redis.NewInt([]byte(strconv.Itoa(len(data[key]))))
+		case "GET":
+			if v, ok := data[key]; ok {
+				return redis.NewBulkBytes([]byte(v))
+			}
+			return redis.NewBulkBytes(nil)
+		case "SET":
+			data[key] = string(multi[2].Value)
+			return redis.NewString([]byte("OK"))
+		case "DEL":
+			delete(data, key)
+			return redis.NewInt([]byte("1"))
+		default:
+			return redis.NewErrorf("ERR unexpected %s", multi[0].Value)
+		}
+	}
+	b1, b2 := newFakeBackend(handler), newFakeBackend(handler)
+	defer b1.Close()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	limit := config.BitOpMaxOperandSize
+	defer func() {
+		config.BitOpMaxOperandSize = limit
+	}()
+	config.BitOpMaxOperandSize = 2
+
+	value := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return data["dst"]
+	}
+
+	s := newTestSession()
+	for _, c := range []struct {
+		args  []string
+		value string
+	}{
+		{[]string{"AND", "dst", "a", "b"}, "\xf0\x00"},
+		{[]string{"OR", "dst", "a", "b"}, "\xff\x0f"},
+		{[]string{"XOR", "dst", "a", "b"}, "\x0f\x0f"},
+		{[]string{"NOT", "dst", "a"}, "\x0f\xf0"},
+		{[]string{"OR", "dst", "x", "none"}, ""},
+	} {
+		resp := handleTestRequest(s, d, append([]string{"BITOP"}, c.args...)...)
+		assert.Must(resp.IsInt() && string(resp.Value) == strconv.Itoa(len(c.value)))
+		assert.Must(value() == c.value)
+	}
+
+	assert.Must(handleTestRequest(s, d, "BITOP", "NOT", "dst", "a", "b").IsError())
+	assert.Must(handleTestRequest(s, d, "BITOP", "NAND", "dst", "a", "b").IsError())
+
+	config.BitOpMaxOperandSize = 1
+	assert.Must(handleTestRequest(s, d, "BITOP", "AND", "dst", "a", "b").IsError())
+}
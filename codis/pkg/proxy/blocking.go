@@ -0,0 +1,160 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+var ErrBlockConnClosed = errors.New("blocking backend connection closed")
+
+// blockState keeps the connection used by blocking commands of a session,
+// since a blocked command would stall all sessions sharing a backend
+// connection. The connection is kept for following blocking commands on
+// the same group, and closed when the client goes away, which cancels the
+// command being blocked.
+type blockState struct {
+	mu     sync.Mutex
+	conn   *redis.Conn
+	addr   string
+	closed bool
+}
+
+func (b *blockState) getConn(s *Session, addr string, database int32) (*redis.Conn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBlockConnClosed
+	}
+	if b.conn != nil && b.addr == addr {
+		return b.conn, nil
+	}
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn, b.addr = nil, ""
+	}
+	c, err := dialBackend(addr, int(database), s.config)
+	if err != nil {
+		return nil, err
+	}
+	b.conn, b.addr = c, addr
+	return c, nil
+}
+
+func (b *blockState) dropConn(c *redis.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == c {
+		b.conn, b.addr = nil, ""
+	}
+	c.Close()
+}
+
+func (b *blockState) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn, b.addr = nil, ""
+	}
+}
+
+// handleRequestBlocking supports BLPOP, BRPOP, BRPOPLPUSH, BLMOVE, BLMPOP,
+// BZPOPMIN, BZPOPMAX and BZMPOP. All keys must belong to the same slot, and
+// the command is sent through the connection of the session from Coalesce,
+// so replies stay in order.
+func (s *Session) handleRequestBlocking(r *Request, d *Router) error {
+	var keys []*redis.Resp
+	var timeoutArg = r.Multi[len(r.Multi)-1]
+	switch r.OpStr {
+	case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX":
+		if len(r.Multi) >= 3 {
+			keys = r.Multi[1 : len(r.Multi)-1]
+		}
+	case "BRPOPLPUSH":
+		if len(r.Multi) == 4 {
+			keys = r.Multi[1:3]
+		}
+	case "BLMOVE":
+		if len(r.Multi) == 6 {
+			keys = r.Multi[1:3]
+			for _, where := range r.Multi[3:5] {
+				switch strings.ToUpper(string(where.Value)) {
+				case "LEFT", "RIGHT":
+				default:
+					r.Resp = redis.NewErrorf("ERR syntax error")
+					return nil
+				}
+			}
+		}
+	case "BLMPOP", "BZMPOP":
+		var errResp *redis.Resp
+		if keys, errResp = numKeys(r.Multi, 2); errResp != nil {
+			r.Resp = errResp
+			return nil
+		}
+		timeoutArg = r.Multi[1]
+	}
+	if len(keys) == 0 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", strings.ToLower(r.OpStr))
+		return nil
+	}
+	if !d.isSameSlot(keys) {
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+		return nil
+	}
+	var timeout time.Duration
+	switch f, err := strconv.ParseFloat(string(timeoutArg.Value), 64); {
+	case err != nil || math.IsNaN(f) || math.IsInf(f, 0):
+		r.Resp = redis.NewErrorf("ERR timeout is not a float or out of range")
+		return nil
+	case f < 0:
+		r.Resp = redis.NewErrorf("ERR timeout is negative")
+		return nil
+	default:
+		timeout = time.Duration(f * float64(time.Second))
+	}
+
+	var slot = d.keySlot(keys[0].Value)
+	r.Coalesce = func() error {
+		return s.doBlocking(r, d, slot, timeout)
+	}
+	return nil
+}
+
+func (s *Session) doBlocking(r *Request, d *Router, slot int, timeout time.Duration) error {
+	m := d.GetSlot(slot)
+	switch {
+	case m == nil || m.BackendAddr == "":
+		return ErrSlotIsNotReady
+	case m.MigrateFrom != "":
+		// The list could be found in either group.
+		r.Resp = redis.NewErrorf("ERR %s", ErrSlotIsMigrating)
+		return nil
+	}
+	c, err := s.blocking.getConn(s, m.BackendAddr, r.Database)
+	if err != nil {
+		return err
+	}
+	if timeout != 0 {
+		c.ReaderTimeout = timeout + commandTimeout(r.OpStr, r.OpFlag, s.config.BackendRecvTimeout.Duration())
+	} else {
+		c.ReaderTimeout = 0
+	}
+	replies, err := doCommands(c, r.Multi)
+	if err != nil {
+		s.blocking.dropConn(c)
+		return err
+	}
+	r.Resp = replies[0]
+	return nil
+}
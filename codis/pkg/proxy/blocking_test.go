@@ -0,0 +1,156 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestBlockingCommands(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "BLPOP", "BRPOP":
+			time.Sleep(time.Millisecond * 500)
+			return redis.NewArray([]*redis.Resp{multi[1], redis.NewBulkBytes([]byte("value"))})
+		case "BLMOVE", "BRPOPLPUSH":
+			return redis.NewBulkBytes([]byte("value"))
+		default:
+			return redis.NewString([]byte("OK"))
+		}
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s1, s2 := newTestSession(), newTestSession()
+
+	var done = make(chan *redis.Resp, 1)
+	go func() {
+		done <- handleTestRequest(s1, d, "BLPOP", "{list}a", "{list}b", "1.5")
+	}()
+
+	// Other sessions are not stalled by the blocked one.
+	time.Sleep(time.Millisecond * 50)
+	var start = time.Now()
+	assert.Must(handleTestRequest(s2, d, "GET", "key").IsString())
+	assert.Must(time.Since(start) < time.Millisecond*300)
+
+	resp := <-done
+	assert.Must(resp.IsArray() && string(resp.Array[0].Value) == "{list}a")
+
+	resp = handleTestRequest(s1, d, "BLMOVE", "{list}a", "{list}b", "left", "RIGHT", "0")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "value")
+	assert.Must(handleTestRequest(s1, d, "BRPOPLPUSH", "{list}a", "{list}b", "0").IsBulkBytes())
+
+	assert.Must(handleTestRequest(s1, d, "BLPOP", "a", "b", "0").IsError())
+	assert.Must(handleTestRequest(s1, d, "BLPOP", "a").IsError())
+	assert.Must(handleTestRequest(s1, d, "BLPOP", "a", "x").IsError())
+	assert.Must(handleTestRequest(s1, d, "BLPOP", "a", "-1").IsError())
+	assert.Must(handleTestRequest(s1, d, "BLMOVE", "a", "a", "UP", "LEFT", "0").IsError())
+}
+
+func TestBlockingCancel(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		time.Sleep(time.Second * 5)
+		return redis.NewArray(nil)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	r := newTestRequest("BRPOP", "list", "0")
+	assert.MustNoError(s.handleRequest(r, d))
+
+	var done = make(chan error, 1)
+	go func() {
+		_, err := s.handleResponse(r)
+		done <- err
+	}()
+
+	// The client goes away while being blocked.
+	time.Sleep(time.Millisecond * 100)
+	s.blocking.close()
+
+	select {
+	case err := <-done:
+		assert.Must(err != nil)
+	case <-time.After(time.Second * 2):
+		t.Fatal("blocking command is not cancelled")
+	}
+}
+
+func TestStreamRead(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewArray(multi)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "XREAD", "COUNT", "1", "STREAMS", "{s}1", "{s}2", "0", "0")
+	assert.Must(resp.IsArray() && len(resp.Array) == 8)
+	resp = handleTestRequest(s, d, "XREADGROUP", "GROUP", "g", "c", "BLOCK", "100", "STREAMS", "s", ">")
+	assert.Must(resp.IsArray() && len(resp.Array) == 9)
+	assert.Must(s.blocking.conn != nil)
+
+	assert.Must(handleTestRequest(s, d, "XREAD", "STREAMS", "a", "b", "0", "0").IsError())
+	assert.Must(handleTestRequest(s, d, "XREAD", "STREAMS", "a", "b", "0").IsError())
+	assert.Must(handleTestRequest(s, d, "XREAD", "COUNT", "1").IsError())
+	assert.Must(handleTestRequest(s, d, "XREAD", "BLOCK", "-1", "STREAMS", "a", "0").IsError())
+}
+
+func TestMultiPop(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewArray(multi)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "LMPOP", "2", "{l}1", "{l}2", "LEFT", "COUNT", "2")
+	assert.Must(resp.IsArray() && len(resp.Array) == 7)
+	assert.Must(handleTestRequest(s, d, "ZMPOP", "1", "z", "MIN").IsArray())
+	assert.Must(handleTestRequest(s, d, "SINTERCARD", "2", "{s}1", "{s}2").IsArray())
+	resp = handleTestRequest(s, d, "BZMPOP", "0.5", "2", "{z}1", "{z}2", "MAX")
+	assert.Must(resp.IsArray() && len(resp.Array) == 6)
+	assert.Must(handleTestRequest(s, d, "BLMPOP", "0", "1", "l", "RIGHT").IsArray())
+
+	assert.Must(handleTestRequest(s, d, "LMPOP", "2", "a", "b", "LEFT").IsError())
+	assert.Must(handleTestRequest(s, d, "LMPOP", "0", "a", "LEFT").IsError())
+	assert.Must(handleTestRequest(s, d, "ZMPOP", "3", "a", "MIN").IsError())
+	assert.Must(handleTestRequest(s, d, "SINTERCARD").IsError())
+	assert.Must(handleTestRequest(s, d, "BLMPOP", "-1", "1", "l", "LEFT").IsError())
+	assert.Must(handleTestRequest(s, d, "BZMPOP", "0", "2", "a", "b", "MIN").IsError())
+}
+
+func TestZPop(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewArray(multi)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "ZPOPMIN", "z", "2").IsArray())
+	resp := handleTestRequest(s, d, "BZPOPMAX", "{z}1", "{z}2", "0.1")
+	assert.Must(resp.IsArray() && len(resp.Array) == 4)
+	assert.Must(s.blocking.conn != nil)
+
+	assert.Must(handleTestRequest(s, d, "BZPOPMIN", "a", "b", "0").IsError())
+	assert.Must(handleTestRequest(s, d, "BZPOPMIN", "z").IsError())
+}
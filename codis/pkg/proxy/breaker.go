@@ -0,0 +1,119 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+var ErrBackendIsBroken = errors.New("backend is broken, circuit breaker is open")
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var BreakerTrips atomic2.Int64
+
+// circuitBreaker of a backend opens if backend_breaker_error_rate percent of
+// the requests fail within backend_breaker_window, then requests to the
+// backend fail fast, or reads are sent to the replicas. After
+// backend_breaker_cooldown a single request is let through as a probe, which
+// closes the breaker if it succeeds, or opens it again otherwise.
+type circuitBreaker struct {
+	addr   string
+	config *Config
+
+	state  atomic2.Int64
+	opened atomic2.Int64
+
+	window struct {
+		start atomic2.Int64
+		total atomic2.Int64
+		fails atomic2.Int64
+	}
+}
+
+func (b *circuitBreaker) enabled() bool {
+	return b != nil && b.config.BackendBreakerErrorRate > 0
+}
+
+// allow returns whether a request may be sent to the backend.
+func (b *circuitBreaker) allow() bool {
+	if !b.enabled() {
+		return true
+	}
+	switch b.state.Int64() {
+	case breakerOpen:
+		cooldown := b.config.BackendBreakerCooldown.Duration()
+		if time.Now().UnixNano()-b.opened.Int64() < int64(cooldown) {
+			return false
+		}
+		return b.state.CompareAndSwap(breakerOpen, breakerHalfOpen)
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+func (b *circuitBreaker) record(resp *redis.Resp, err error) {
+	if !b.enabled() {
+		return
+	}
+	var failed = err != nil
+	if resp != nil && resp.IsError() {
+		failed = bytes.HasPrefix(resp.Value, errRespMasterDown) || bytes.HasPrefix(resp.Value, errRespLoading)
+	}
+	var now = time.Now().UnixNano()
+
+	switch b.state.Int64() {
+	case breakerOpen:
+		return
+	case breakerHalfOpen:
+		if failed {
+			b.trip(breakerHalfOpen, now)
+		} else if b.state.CompareAndSwap(breakerHalfOpen, breakerClosed) {
+			b.reset(now)
+			log.Warnf("circuit breaker of backend %s is closed", b.addr)
+		}
+		return
+	}
+
+	if start := b.window.start.Int64(); now-start > int64(b.config.BackendBreakerWindow.Duration()) {
+		if b.window.start.CompareAndSwap(start, now) {
+			b.window.total.Set(0)
+			b.window.fails.Set(0)
+		}
+	}
+	total := b.window.total.Incr()
+	fails := b.window.fails.Int64()
+	if failed {
+		fails = b.window.fails.Incr()
+	}
+	if total >= b.config.BackendBreakerMinRequests && fails*100 >= total*b.config.BackendBreakerErrorRate {
+		b.trip(breakerClosed, now)
+	}
+}
+
+func (b *circuitBreaker) trip(state int64, now int64) {
+	if b.state.CompareAndSwap(state, breakerOpen) {
+		b.opened.Set(now)
+		BreakerTrips.Incr()
+		log.Warnf("circuit breaker of backend %s is open, fails = %d/%d",
+			b.addr, b.window.fails.Int64(), b.window.total.Int64())
+	}
+}
+
+func (b *circuitBreaker) reset(now int64) {
+	b.window.start.Set(now)
+	b.window.total.Set(0)
+	b.window.fails.Set(0)
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var loading atomic2.Bool
+	var backends = make([]*fakeBackend, 2)
+	for i, name := range []string{"primary", "replica"} {
+		var value = []byte(name)
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			if string(value) == "primary" && loading.IsTrue() {
+				return redis.NewErrorf("LOADING Redis is loading the dataset in memory")
+			}
+			return redis.NewBulkBytes(value)
+		})
+		defer backends[i].Close()
+	}
+
+	saved := *config
+	defer func() {
+		*config = saved
+	}()
+	config.SessionReplicaRead = ReplicaReadOnly
+	config.BackendBreakerErrorRate = 50
+	config.BackendBreakerMinRequests = 4
+	config.BackendBreakerCooldown.UnmarshalText([]byte("50ms"))
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: backends[0].Addr(),
+			ReplicaGroups: [][]string{{backends[1].Addr()}},
+		}))
+	}
+	d.Start()
+
+	s := newTestSession()
+	get := func() string {
+		return string(handleTestRequest(s, d, "GET", "key").Value)
+	}
+	assert.Must(get() == "primary")
+
+	loading.Set(true)
+	var trips = BreakerTrips.Int64()
+	for i := 0; get() != "replica"; i++ {
+		assert.Must(i < 4)
+	}
+	assert.Must(BreakerTrips.Int64() == trips+1)
+	r := newTestRequest("SET", "key", "v")
+	assert.Must(s.handleRequest(r, d) == ErrBackendIsBroken)
+
+	loading.Set(false)
+	time.Sleep(time.Millisecond * 60)
+	assert.Must(string(handleTestRequest(s, d, "SET", "key", "v").Value) == "primary")
+	assert.Must(get() == "primary")
+}
@@ -0,0 +1,284 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+var ErrKilledSession = errors.New("session killed by CLIENT KILL")
+
+func (s *Session) getName() string {
+	s.client.Lock()
+	defer s.client.Unlock()
+	return s.client.name
+}
+
+func (s *Session) setName(name string) {
+	s.client.Lock()
+	s.client.name = name
+	s.client.Unlock()
+}
+
+func (s *Session) setLastCmd(opstr string) {
+	s.client.Lock()
+	s.client.cmd = opstr
+	s.client.Unlock()
+}
+
+// listSessions returns the sessions in the registry ordered by id.
+func listSessions() []*Session {
+	liveSessions.Lock()
+	var list = make([]*Session, 0, len(liveSessions.m))
+	for x := range liveSessions.m {
+		list = append(list, x)
+	}
+	liveSessions.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+// clientInfo returns the line of the session in CLIENT LIST, its fields are
+// a subset of the ones of redis.
+func (s *Session) clientInfo(now int64) string {
+	s.client.Lock()
+	var name, cmd = s.client.name, s.client.cmd
+	var libName, libVer = s.client.libName, s.client.libVer
+	s.client.Unlock()
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	var pending int
+	if s.tasks != nil {
+		pending = s.tasks.Buffered()
+	}
+
+	var b bytes.Buffer
+	b.WriteString("id=" + strconv.FormatInt(s.id, 10))
+	if s.Conn != nil {
+		b.WriteString(" addr=" + s.Conn.RemoteAddr())
+		b.WriteString(" laddr=" + s.Conn.LocalAddr())
+	}
+	b.WriteString(" name=" + name)
+	b.WriteString(" age=" + strconv.FormatInt(now-s.CreateUnix, 10))
+	b.WriteString(" idle=" + strconv.FormatInt(now-s.lastActive(), 10))
+	b.WriteString(" cmd=" + strings.ToLower(cmd))
+	b.WriteString(" tot-ops=" + strconv.FormatInt(atomic.LoadInt64(&s.Ops), 10))
+	b.WriteString(" pending=" + strconv.Itoa(pending))
+	b.WriteString(" omem=" + strconv.FormatInt(s.output.pending.Int64(), 10))
+	b.WriteString(" lib-name=" + libName)
+	b.WriteString(" lib-ver=" + libVer)
+	return b.String()
+}
+
+// handleClientList handles CLIENT LIST [ID id ...].
+func (s *Session) handleClientList(r *Request) error {
+	var ids map[int64]bool
+	if len(r.Multi) > 2 {
+		if strings.ToUpper(string(r.Multi[2].Value)) != "ID" || len(r.Multi) == 3 {
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		}
+		ids = make(map[int64]bool)
+		for _, arg := range r.Multi[3:] {
+			id, err := strconv.ParseInt(string(arg.Value), 10, 64)
+			if err != nil || id <= 0 {
+				r.Resp = redis.NewErrorf("ERR Invalid client ID")
+				return nil
+			}
+			ids[id] = true
+		}
+	}
+	var now = time.Now().Unix()
+	var b bytes.Buffer
+	for _, x := range listSessions() {
+		if ids != nil && !ids[x.id] {
+			continue
+		}
+		b.WriteString(x.clientInfo(now))
+		b.WriteByte('\n')
+	}
+	r.Resp = redis.NewBulkBytes(b.Bytes())
+	return nil
+}
+
+// handleClientKill handles CLIENT KILL addr, which replies OK, and CLIENT KILL
+// with filters of ID, ADDR, LADDR and SKIPME, which replies the number of the
+// sessions killed. Killing the session itself closes it after the reply.
+func (s *Session) handleClientKill(r *Request) error {
+	var args = r.Multi[2:]
+	var legacy = len(args) == 1
+
+	var id int64
+	var addr, laddr string
+	var skipme = !legacy
+	if legacy {
+		addr = string(args[0].Value)
+	} else {
+		if len(args)%2 != 0 {
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		}
+		for i := 0; i < len(args); i += 2 {
+			var value = string(args[i+1].Value)
+			switch strings.ToUpper(string(args[i].Value)) {
+			case "ID":
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || n <= 0 {
+					r.Resp = redis.NewErrorf("ERR client-id should be greater than 0")
+					return nil
+				}
+				id = n
+			case "ADDR":
+				addr = value
+			case "LADDR":
+				laddr = value
+			case "SKIPME":
+				switch strings.ToLower(value) {
+				case "yes":
+					skipme = true
+				case "no":
+					skipme = false
+				default:
+					r.Resp = redis.NewErrorf("ERR syntax error")
+					return nil
+				}
+			default:
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+		}
+	}
+
+	var killed int64
+	for _, x := range listSessions() {
+		switch {
+		case id != 0 && x.id != id:
+			continue
+		case addr != "" && (x.Conn == nil || x.Conn.RemoteAddr() != addr):
+			continue
+		case laddr != "" && (x.Conn == nil || x.Conn.LocalAddr() != laddr):
+			continue
+		case x == s && skipme:
+			continue
+		}
+		killed++
+		if x == s {
+			s.quit = true
+			continue
+		}
+		log.Warnf("session [%p] killed by CLIENT KILL of session [%p]: %s", x, s, x)
+		x.CloseWithError(ErrKilledSession)
+	}
+
+	switch {
+	case !legacy:
+		r.Resp = redis.NewInt(strconv.AppendInt(nil, killed, 10))
+	case killed == 0:
+		r.Resp = redis.NewErrorf("ERR No such client")
+	default:
+		r.Resp = RespOK
+	}
+	return nil
+}
+
+// validClientInfo returns whether the name or the library info can be shown
+// in CLIENT LIST, which can't contain spaces or newlines, as in redis.
+func validClientInfo(b []byte) bool {
+	for _, c := range b {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Session) handleClientSetName(r *Request) error {
+	var name = r.Multi[2].Value
+	if !validClientInfo(name) {
+		r.Resp = redis.NewErrorf("ERR Client names cannot contain spaces, newlines or special characters.")
+		return nil
+	}
+	s.setName(string(name))
+	r.Resp = RespOK
+	return nil
+}
+
+// handleClientSetInfo handles CLIENT SETINFO LIB-NAME|LIB-VER value, as sent
+// by the client libraries on connect.
+func (s *Session) handleClientSetInfo(r *Request) error {
+	var attr, value = strings.ToLower(string(r.Multi[2].Value)), r.Multi[3].Value
+	if attr != "lib-name" && attr != "lib-ver" {
+		r.Resp = redis.NewErrorf("ERR Unrecognized option '%s'", r.Multi[2].Value)
+		return nil
+	}
+	if !validClientInfo(value) {
+		r.Resp = redis.NewErrorf("ERR %s cannot contain spaces, newlines or special characters.", attr)
+		return nil
+	}
+	s.client.Lock()
+	if attr == "lib-name" {
+		s.client.libName = string(value)
+	} else {
+		s.client.libVer = string(value)
+	}
+	s.client.Unlock()
+	r.Resp = RespOK
+	return nil
+}
+
+// ClientStats are the sessions alive of the same client name and library,
+// so that the traffic can be attributed to applications.
+type ClientStats struct {
+	Name     string `json:"name,omitempty"`
+	LibName  string `json:"lib_name,omitempty"`
+	LibVer   string `json:"lib_ver,omitempty"`
+	Sessions int64  `json:"sessions"`
+	Ops      int64  `json:"ops"`
+}
+
+func GetClientStats() []*ClientStats {
+	type clientKey struct {
+		name, libName, libVer string
+	}
+	var m = make(map[clientKey]*ClientStats)
+	for _, x := range listSessions() {
+		x.client.Lock()
+		var k = clientKey{x.client.name, x.client.libName, x.client.libVer}
+		x.client.Unlock()
+		var c = m[k]
+		if c == nil {
+			c = &ClientStats{Name: k.name, LibName: k.libName, LibVer: k.libVer}
+			m[k] = c
+		}
+		c.Sessions++
+		c.Ops += atomic.LoadInt64(&x.Ops)
+	}
+	var list = make([]*ClientStats, 0, len(m))
+	for _, c := range m {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		switch a, b := list[i], list[j]; {
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.LibName != b.LibName:
+			return a.LibName < b.LibName
+		default:
+			return a.LibVer < b.LibVer
+		}
+	})
+	return list
+}
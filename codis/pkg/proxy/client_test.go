@@ -0,0 +1,93 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestClientList(t *testing.T) {
+	newSession := func() *Session {
+		c, _ := net.Pipe()
+		s := NewSession(c, config, nil)
+		assert.Must(s.admit())
+		return s
+	}
+	a, b := newSession(), newSession()
+	defer a.leave()
+	defer b.leave()
+
+	assert.Must(string(handleTestRequest(b, nil, "CLIENT", "SETNAME", "worker").Value) == "OK")
+	assert.Must(handleTestRequest(b, nil, "CLIENT", "SETNAME", "bad name").IsError())
+	assert.Must(string(handleTestRequest(b, nil, "CLIENT", "GETNAME").Value) == "worker")
+	assert.Must(handleTestRequest(a, nil, "CLIENT", "GETNAME").Value == nil)
+	assert.Must(string(handleTestRequest(b, nil, "CLIENT", "ID").Value) == strconv.FormatInt(b.id, 10))
+	b.setLastCmd("GET")
+	b.Ops = 3
+
+	// CLIENT on other sessions is for administrators only, unless the
+	// default user is allowed by session_admin_enabled.
+	config.SessionAdminEnabled = false
+	assert.Must(handleTestRequest(a, nil, "CLIENT", "LIST").IsError())
+	config.SessionAdminEnabled = true
+
+	var id = strconv.FormatInt(b.id, 10)
+	resp := handleTestRequest(a, nil, "CLIENT", "LIST", "ID", id)
+	var lines = strings.Split(strings.TrimSpace(string(resp.Value)), "\n")
+	assert.Must(len(lines) == 1)
+	for _, field := range []string{"id=" + id, "addr=pipe", "name=worker", "cmd=get", "tot-ops=3", "pending=0", "omem=0"} {
+		assert.Must(strings.Contains(" "+lines[0]+" ", " "+field+" "))
+	}
+	resp = handleTestRequest(a, nil, "CLIENT", "LIST")
+	assert.Must(strings.Contains(string(resp.Value), "id="+strconv.FormatInt(a.id, 10)+" "))
+	assert.Must(handleTestRequest(a, nil, "CLIENT", "LIST", "ID", "x").IsError())
+
+	assert.Must(handleTestRequest(a, nil, "CLIENT", "KILL", "127.0.0.1:1").IsError())
+	assert.Must(handleTestRequest(a, nil, "CLIENT", "KILL", "ID").IsError())
+	assert.Must(handleTestRequest(a, nil, "CLIENT", "KILL", "ID", "0").IsError())
+
+	resp = handleTestRequest(a, nil, "CLIENT", "KILL", "ID", id, "LADDR", "127.0.0.1:1")
+	assert.Must(resp.Type == redis.TypeInt && string(resp.Value) == "0")
+	resp = handleTestRequest(a, nil, "CLIENT", "KILL", "ID", id, "ADDR", "pipe")
+	assert.Must(resp.Type == redis.TypeInt && string(resp.Value) == "1")
+	assert.Must(b.broken.IsTrue())
+
+	id = strconv.FormatInt(a.id, 10)
+	resp = handleTestRequest(a, nil, "CLIENT", "KILL", "ID", id)
+	assert.Must(string(resp.Value) == "0" && !a.quit)
+	resp = handleTestRequest(a, nil, "CLIENT", "KILL", "ID", id, "SKIPME", "no")
+	assert.Must(string(resp.Value) == "1" && a.quit)
+}
+
+func TestClientSetInfo(t *testing.T) {
+
+	c, _ := net.Pipe()
+	s := NewSession(c, config, nil)
+	assert.Must(s.admit())
+	defer s.leave()
+
+	assert.Must(string(handleTestRequest(s, nil, "CLIENT", "SETINFO", "LIB-NAME", "go-redis(app,go1.19)").Value) == "OK")
+	assert.Must(string(handleTestRequest(s, nil, "CLIENT", "SETINFO", "lib-ver", "9.0.5").Value) == "OK")
+	assert.Must(handleTestRequest(s, nil, "CLIENT", "SETINFO", "lib-ver", "9 0").IsError())
+	assert.Must(handleTestRequest(s, nil, "CLIENT", "SETINFO", "lib-os", "linux").IsError())
+	assert.Must(string(handleTestRequest(s, nil, "CLIENT", "SETNAME", "orders").Value) == "OK")
+
+	resp := handleTestRequest(s, nil, "CLIENT", "LIST", "ID", strconv.FormatInt(s.id, 10))
+	assert.Must(strings.Contains(string(resp.Value), " lib-name=go-redis(app,go1.19) lib-ver=9.0.5"))
+	assert.Must(strings.Contains(s.String(), `"name":"orders","lib_name":"go-redis(app,go1.19)","lib_ver":"9.0.5"`))
+
+	var found bool
+	for _, x := range GetClientStats() {
+		if x.Name == "orders" && x.LibName == "go-redis(app,go1.19)" && x.LibVer == "9.0.5" {
+			found = x.Sessions == 1
+		}
+	}
+	assert.Must(found)
+}
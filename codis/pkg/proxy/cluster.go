@@ -0,0 +1,219 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// ClusterSlotNum is the number of slots of redis cluster, which has nothing
+// to do with the slots of codis.
+const ClusterSlotNum = 16384
+
+// handleRequestCluster emulates a redis cluster with the proxy and the other
+// proxies of cluster_emulation_nodes as the nodes, if cluster_emulation_enabled.
+// The slots are split evenly among the nodes, but keys sent to any node are
+// routed by the slots of codis as usual, and ASKING is a no-op.
+func (s *Session) handleRequestCluster(r *Request, d *Router) error {
+	if !s.config.ClusterEmulationEnabled {
+		return fmt.Errorf("command '%s' is not allowed", r.OpStr)
+	}
+	if r.OpStr != "CLUSTER" {
+		r.Resp = RespOK
+		return nil
+	}
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'cluster' command")
+		return nil
+	}
+	var nodes = s.clusterNodes()
+	var health = s.clusterHealth(d)
+	switch sub := strings.ToUpper(string(r.Multi[1].Value)); sub {
+	case "SLOTS":
+		var array = make([]*redis.Resp, len(nodes))
+		for i, n := range nodes {
+			array[i] = redis.NewArray([]*redis.Resp{
+				redis.NewInt([]byte(strconv.Itoa(n.beg))),
+				redis.NewInt([]byte(strconv.Itoa(n.end))),
+				redis.NewArray([]*redis.Resp{
+					redis.NewBulkBytes([]byte(n.ip)),
+					redis.NewInt([]byte(strconv.Itoa(n.port))),
+					redis.NewBulkBytes([]byte(n.id)),
+				}),
+			})
+		}
+		r.Resp = redis.NewArray(array)
+	case "SHARDS":
+		var array = make([]*redis.Resp, len(nodes))
+		for i, n := range nodes {
+			array[i] = redis.NewArray([]*redis.Resp{
+				redis.NewBulkBytes([]byte("slots")),
+				redis.NewArray([]*redis.Resp{
+					redis.NewInt([]byte(strconv.Itoa(n.beg))),
+					redis.NewInt([]byte(strconv.Itoa(n.end))),
+				}),
+				redis.NewBulkBytes([]byte("nodes")),
+				redis.NewArray([]*redis.Resp{
+					redis.NewArray([]*redis.Resp{
+						redis.NewBulkBytes([]byte("id")),
+						redis.NewBulkBytes([]byte(n.id)),
+						redis.NewBulkBytes([]byte("port")),
+						redis.NewInt([]byte(strconv.Itoa(n.port))),
+						redis.NewBulkBytes([]byte("ip")),
+						redis.NewBulkBytes([]byte(n.ip)),
+						redis.NewBulkBytes([]byte("endpoint")),
+						redis.NewBulkBytes([]byte(n.ip)),
+						redis.NewBulkBytes([]byte("role")),
+						redis.NewBulkBytes([]byte("master")),
+						redis.NewBulkBytes([]byte("replication-offset")),
+						redis.NewInt([]byte("0")),
+						redis.NewBulkBytes([]byte("health")),
+						redis.NewBulkBytes([]byte(health)),
+					}),
+				}),
+			})
+		}
+		r.Resp = redis.NewArray(array)
+	case "NODES":
+		var state = "connected"
+		if health != "online" {
+			state = "disconnected"
+		}
+		var b bytes.Buffer
+		for i, n := range nodes {
+			var flags = "master"
+			if n.myself {
+				flags = "myself,master"
+			}
+			fmt.Fprintf(&b, "%s %s:%d@%d %s - 0 0 %d %s %d-%d\n",
+				n.id, n.ip, n.port, n.port+10000, flags, i+1, state, n.beg, n.end)
+		}
+		r.Resp = redis.NewBulkBytes(b.Bytes())
+	case "INFO":
+		var state = "ok"
+		if health != "online" {
+			state = "fail"
+		}
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "cluster_state:%s\r\n", state)
+		fmt.Fprintf(&b, "cluster_slots_assigned:%d\r\n", ClusterSlotNum)
+		if state == "ok" {
+			fmt.Fprintf(&b, "cluster_slots_ok:%d\r\n", ClusterSlotNum)
+			fmt.Fprintf(&b, "cluster_slots_fail:0\r\n")
+		} else {
+			fmt.Fprintf(&b, "cluster_slots_ok:0\r\n")
+			fmt.Fprintf(&b, "cluster_slots_fail:%d\r\n", ClusterSlotNum)
+		}
+		fmt.Fprintf(&b, "cluster_slots_pfail:0\r\n")
+		fmt.Fprintf(&b, "cluster_known_nodes:%d\r\n", len(nodes))
+		fmt.Fprintf(&b, "cluster_size:%d\r\n", len(nodes))
+		fmt.Fprintf(&b, "cluster_current_epoch:%d\r\n", len(nodes))
+		fmt.Fprintf(&b, "cluster_my_epoch:1\r\n")
+		r.Resp = redis.NewBulkBytes(b.Bytes())
+	case "MYID":
+		for _, n := range nodes {
+			if n.myself {
+				r.Resp = redis.NewBulkBytes([]byte(n.id))
+			}
+		}
+	case "KEYSLOT":
+		if len(r.Multi) != 3 {
+			r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'cluster|keyslot' command")
+			return nil
+		}
+		r.Resp = redis.NewInt([]byte(strconv.Itoa(int(clusterKeySlot(r.Multi[2].Value)))))
+	default:
+		r.Resp = redis.NewErrorf("ERR CLUSTER subcommand '%s' is not supported", sub)
+	}
+	return nil
+}
+
+// clusterNode is a node of the emulated cluster, which owns the slots from
+// beg to end.
+type clusterNode struct {
+	ip       string
+	port     int
+	id       string
+	beg, end int
+	myself   bool
+}
+
+// parseClusterNodes parses the addresses of cluster_emulation_nodes.
+func parseClusterNodes(list string) ([]string, error) {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// clusterNodes returns the nodes of the cluster sorted by address, i.e. the
+// proxy and the ones of cluster_emulation_nodes. The node id is derived from
+// the address, so that all proxies agree on it.
+func (s *Session) clusterNodes() []*clusterNode {
+	var self = s.config.ProxyAddr
+	if s.proxy != nil {
+		self = s.proxy.Model().ProxyAddr
+	}
+	addrs, _ := parseClusterNodes(s.config.ClusterEmulationNodes)
+	var found bool
+	for _, addr := range addrs {
+		found = found || addr == self
+	}
+	if !found {
+		addrs = append(addrs, self)
+	}
+	sort.Strings(addrs)
+
+	var nodes = make([]*clusterNode, len(addrs))
+	for i, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		n, _ := strconv.Atoi(port)
+		nodes[i] = &clusterNode{
+			ip: host, port: n, id: fmt.Sprintf("%x", sha1.Sum([]byte(addr))),
+			beg:    ClusterSlotNum * i / len(addrs),
+			end:    ClusterSlotNum*(i+1)/len(addrs) - 1,
+			myself: addr == self,
+		}
+	}
+	return nodes
+}
+
+// clusterHealth returns online only if all slots of codis have a backend.
+func (s *Session) clusterHealth(d *Router) string {
+	if d.assignedSlots() != models.GetMaxSlotNum() {
+		return "failed"
+	}
+	return "online"
+}
+
+// clusterKeySlot returns the slot of redis cluster, i.e. CRC16 of the hash
+// tag of the key. Unlike codis, an empty hash tag is ignored.
+func clusterKeySlot(key []byte) uint16 {
+	const tagBeg, tagEnd = '{', '}'
+	if beg := bytes.IndexByte(key, tagBeg); beg >= 0 {
+		if end := bytes.IndexByte(key[beg+1:], tagEnd); end > 0 {
+			key = key[beg+1 : beg+1+end]
+		}
+	}
+	return crc16(key) % ClusterSlotNum
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestClusterKeySlot(t *testing.T) {
+	for key, slot := range map[string]uint16{
+		"":              0,
+		"123456789":     12739,
+		"foo":           12182,
+		"{user1000}.a":  3443,
+		"{user1000}.b":  3443,
+		"foo{}{bar}":    8363,
+		"foo{{bar}}zap": 4015,
+	} {
+		assert.Must(clusterKeySlot([]byte(key)) == slot)
+	}
+}
+
+func TestClusterEmulation(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewString([]byte("OK"))
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	enabled := config.ClusterEmulationEnabled
+	defer func() {
+		config.ClusterEmulationEnabled = enabled
+	}()
+
+	s := newTestSession()
+	r := newTestRequest("CLUSTER", "SLOTS")
+	assert.Must(s.handleRequest(r, d) != nil)
+
+	config.ClusterEmulationEnabled = true
+	resp := handleTestRequest(s, d, "CLUSTER", "SLOTS")
+	assert.Must(resp.IsArray() && len(resp.Array) == 1)
+	assert.Must(string(resp.Array[0].Array[1].Value) == "16383")
+	assert.Must(len(resp.Array[0].Array[2].Array[2].Value) == 40)
+
+	resp = handleTestRequest(s, d, "CLUSTER", "NODES")
+	assert.Must(resp.IsBulkBytes() && strings.Contains(string(resp.Value), "myself,master - 0 0 1 connected 0-16383"))
+	resp = handleTestRequest(s, d, "CLUSTER", "INFO")
+	assert.Must(strings.HasPrefix(string(resp.Value), "cluster_state:ok\r\n"))
+	assert.Must(handleTestRequest(s, d, "CLUSTER", "SHARDS").IsArray())
+	assert.Must(string(handleTestRequest(s, d, "CLUSTER", "KEYSLOT", "foo").Value) == "12182")
+	assert.Must(handleTestRequest(s, d, "READONLY").IsString())
+	assert.Must(handleTestRequest(s, d, "CLUSTER", "FAILOVER").IsError())
+
+	// Other proxies are advertised, and the slots are split among them.
+	nodes := config.ClusterEmulationNodes
+	defer func() {
+		config.ClusterEmulationNodes = nodes
+	}()
+	config.ClusterEmulationNodes = "10.0.0.2:19000, 10.0.0.1:19000"
+	resp = handleTestRequest(s, d, "CLUSTER", "SLOTS")
+	assert.Must(resp.IsArray() && len(resp.Array) == 3)
+	assert.Must(string(resp.Array[1].Array[2].Array[0].Value) == "10.0.0.1")
+	assert.Must(string(resp.Array[0].Array[1].Value) == "5460" && string(resp.Array[1].Array[0].Value) == "5461")
+	assert.Must(string(resp.Array[2].Array[1].Value) == "16383")
+	resp = handleTestRequest(s, d, "CLUSTER", "NODES")
+	assert.Must(strings.Count(string(resp.Value), "\n") == 3 && strings.Count(string(resp.Value), "myself") == 1)
+	resp = handleTestRequest(s, d, "CLUSTER", "INFO")
+	assert.Must(strings.Contains(string(resp.Value), "cluster_known_nodes:3\r\n"))
+	_, err := parseClusterNodes("10.0.0.1")
+	assert.Must(err != nil)
+
+	d.Close()
+	resp = handleTestRequest(s, d, "CLUSTER", "INFO")
+	assert.Must(strings.HasPrefix(string(resp.Value), "cluster_state:fail\r\n"))
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+// cmdOverrides saves the entries of opTable replaced by SetCommandOverrides,
+// an entry with empty name was absent, so they can be restored on the next
+// call. It's protected by opTableLock.
+var cmdOverrides = make(map[string]OpInfo)
+
+// ValidateCommandOverrides checks the commands to disable or rename exist,
+// and the aliases don't conflict with any command.
+func ValidateCommandOverrides(c *models.Commands) error {
+	opTableLock.RLock()
+	defer opTableLock.RUnlock()
+	return validateCommandOverrides(c)
+}
+
+// isKnownCommand returns true if the command exists before the overrides, it
+// must be called with opTableLock held.
+func isKnownCommand(name string) bool {
+	if r, ok := cmdOverrides[name]; ok {
+		return r.Name != ""
+	}
+	_, ok := opTable[name]
+	return ok
+}
+
+func validateCommandOverrides(c *models.Commands) error {
+	for _, name := range c.Disabled {
+		if !isKnownCommand(strings.ToUpper(name)) {
+			return errors.Errorf("invalid disabled command '%s'", name)
+		}
+	}
+	var aliases = make(map[string]bool)
+	for name, alias := range c.Renamed {
+		if !isKnownCommand(strings.ToUpper(name)) {
+			return errors.Errorf("invalid renamed command '%s'", name)
+		}
+		if alias == "" {
+			continue
+		}
+		var upper = strings.ToUpper(alias)
+		switch {
+		case len(alias) > MaxOpStrLen || strings.ContainsAny(alias, " \t\r\n"):
+			return errors.Errorf("invalid alias '%s' of command '%s'", alias, name)
+		case isKnownCommand(upper) || aliases[upper]:
+			return errors.Errorf("alias '%s' of command '%s' conflicts with another command", alias, name)
+		}
+		aliases[upper] = true
+	}
+	if _, err := parseCommandTimeouts(c, isKnownCommand); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetCommandOverrides disables or renames the commands, the overrides set
+// before are restored first. A command renamed to an empty alias is disabled.
+func SetCommandOverrides(c *models.Commands) error {
+	opTableLock.Lock()
+	defer opTableLock.Unlock()
+
+	if err := validateCommandOverrides(c); err != nil {
+		return err
+	}
+	timeouts, err := parseCommandTimeouts(c, isKnownCommand)
+	if err != nil {
+		return err
+	}
+	cmdTimeouts.Store(timeouts)
+
+	for name, r := range cmdOverrides {
+		if r.Name != "" {
+			opTable[name] = r
+		} else {
+			delete(opTable, name)
+		}
+	}
+	cmdOverrides = make(map[string]OpInfo)
+
+	override := func(name string, r OpInfo) {
+		if _, ok := cmdOverrides[name]; !ok {
+			cmdOverrides[name] = opTable[name]
+		}
+		opTable[name] = r
+	}
+	for _, name := range c.Disabled {
+		var r = opTable[strings.ToUpper(name)]
+		override(r.Name, OpInfo{r.Name, r.Flag | FlagNotAllow})
+	}
+	for name, alias := range c.Renamed {
+		var r = opTable[strings.ToUpper(name)]
+		if alias != "" {
+			override(strings.ToUpper(alias), OpInfo{r.Name, r.Flag | FlagAlias})
+		}
+		override(r.Name, OpInfo{r.Name, r.Flag | FlagNotAllow})
+	}
+	return nil
+}
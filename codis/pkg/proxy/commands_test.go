@@ -0,0 +1,50 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestCommandOverrides(t *testing.T) {
+	defer SetCommandOverrides(&models.Commands{})
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes(multi[0].Value)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(string(handleTestRequest(s, d, "DEL", "key").Value) == "DEL")
+
+	assert.Must(SetCommandOverrides(&models.Commands{Disabled: []string{"NOSUCHCMD"}}) != nil)
+	assert.Must(SetCommandOverrides(&models.Commands{Renamed: map[string]string{"GET": "SET"}}) != nil)
+	assert.Must(SetCommandOverrides(&models.Commands{Renamed: map[string]string{"GET": "X", "SET": "x"}}) != nil)
+
+	assert.MustNoError(SetCommandOverrides(&models.Commands{
+		Disabled: []string{"del"},
+		Renamed:  map[string]string{"TYPE": "type_7f3c"},
+	}))
+	_, flag, err := getOpInfo([]*redis.Resp{redis.NewBulkBytes([]byte("DEL"))})
+	assert.MustNoError(err)
+	assert.Must(flag.IsNotAllowed())
+	_, flag, err = getOpInfo([]*redis.Resp{redis.NewBulkBytes([]byte("type"))})
+	assert.MustNoError(err)
+	assert.Must(flag.IsNotAllowed())
+	assert.Must(string(handleTestRequest(s, d, "TYPE_7F3C", "key").Value) == "TYPE")
+
+	assert.MustNoError(SetCommandOverrides(&models.Commands{Disabled: []string{"TYPE"}}))
+	_, flag, _ = getOpInfo([]*redis.Resp{redis.NewBulkBytes([]byte("DEL"))})
+	assert.Must(!flag.IsNotAllowed())
+	opstr, flag, _ := getOpInfo([]*redis.Resp{redis.NewBulkBytes([]byte("type_7f3c"))})
+	assert.Must(opstr == "TYPE_7F3C" && !flag.IsAlias())
+	assert.Must(string(handleTestRequest(s, d, "DEL", "key").Value) == "DEL")
+}
@@ -5,12 +5,18 @@ package proxy
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"time"
 
 	"github.com/BurntSushi/toml"
 
 	"pika/codis/v2/pkg/utils/bytesize"
 	"pika/codis/v2/pkg/utils/errors"
 	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/secret"
 	"pika/codis/v2/pkg/utils/timesize"
 )
 
@@ -25,20 +31,102 @@ const DefaultConfig = `
 product_name = "codis-demo"
 product_auth = ""
 
+# Set Vault to fetch secrets from, the token is read from vault_token_file, or from the environment
+# variable VAULT_TOKEN if empty. Secret settings, e.g. product_auth, session_auth, admin_token_secret
+# and the files of TLS certificates and keys, may refer to secrets instead of plain values as
+#   "vault:<path>#<field>", e.g. "vault:secret/data/codis#product_auth" (KV version 1 or 2)
+#   "file:<path>", e.g. written by a KMS agent, or "env:<name>".
+# Secrets are refreshed every secret_refresh_period, or before their vault leases expire if sooner.
+# Files of TLS are rewritten and reloaded once changed, and a changed product_auth, session_auth or
+# admin_token_secret is applied at once, product_auth to the backend connections opened since then.
+# Other secrets changed are applied after restart.
+vault_addr = ""
+vault_token_file = ""
+vault_namespace = ""
+vault_ca_file = ""
+secret_refresh_period = "5m"
+
+# Set the 2 characters delimiting the hash tag of keys, e.g. "{}" or "[]" as in twemproxy.
+# All proxies of the product must use the same hash tag, which is checked by the dashboard. Slots
+# can't be migrated with other hash tags than "{}", since Pika finds the keys of slots by "{}".
+hash_tag = "{}"
+
+# Set the hash function of keys, "crc32", "crc16", "xxhash64" or "siphash". With "crc16", keys are
+# placed in slots as in redis cluster, which requires max_slot_num = 16384. "siphash" is keyed by
+# hash_key, 32 hex digits. All proxies of the product must use the same hash_mode and hash_key,
+# which is checked by the dashboard with a digest of hash_key. Slots can't be migrated by the
+# dashboard with other modes than "crc32", which is how Pika hashes keys.
+hash_mode = "crc32"
+hash_key = ""
+
+# Set how keys are routed, "slots" or "ring". With "ring", keys are hashed onto a consistent hash ring
+# of the groups of the slot table with ring_virtual_nodes per group, and sent through the first slot of
+# their group, so slots only decide which groups are in the ring. It's meant for pure-cache deployments only.
+router_mode = "slots"
+ring_virtual_nodes = 160
+
 # Set auth for client session
 #   1. product_auth is used for auth validation among codis-dashboard,
 #      codis-proxy and codis-server.
 #   2. session_auth is different from product_auth, it requires clients
 #      to issue AUTH <PASSWORD> before processing any other commands.
+#      It is the password of the ACL default user, unless the default user
+#      is set by session_acl_file or ACL SETUSER.
 session_auth = ""
 
+# Set to false to keep the default user of session_auth from CLIENT, MONITOR, SLOWLOG and
+# XSLOWLOG, which are meant for administrators, except CLIENT on its own session, e.g.
+# CLIENT SETNAME. Other users run them as allowed by their ACL rules.
+session_admin_enabled = true
+
+# Set the ACL users of client sessions, one "user <name> <rule> ..." per line
+# as the aclfile of redis, e.g. "user alice on >secret ~cache:* +@read".
+# Users changed by ACL SETUSER/DELUSER are not saved to the file.
+# The rule "namespace:<prefix>" confines the user to a tenant, the prefix is
+# prepended to its keys and channels and stripped from replies transparently,
+# and commands on the whole keyspace like FLUSHALL, DBSIZE and EVAL are refused.
+session_acl_file = ""
+
+# Set the audit log of the commands in audit_log_categories, which are ACL categories separated by
+# commas, e.g. "write,admin,dangerous". Each record tells the client address, ACL user, command and
+# the first key. audit_log is a file path rolled daily, or "syslog" for the local syslog. (empty to disable)
+audit_log = ""
+audit_log_categories = "write,admin"
+
+# Set the number of commands a client session may issue before it has to
+# AUTH again, only works with users having passwords. (0 to disable)
+session_auth_max_commands = 0
+
 # Set bind address for admin(rpc), tcp only.
 admin_addr = "0.0.0.0:11080"
 
+# Set mutual TLS of the admin(rpc) API among codis-dashboard, codis-proxy and codis-fe, which is enabled
+# if admin_tls_cert_file, admin_tls_key_file and admin_tls_ca_file are set. Peers must present certificates
+# signed by admin_tls_ca_file, and with a common name or DNS name in admin_tls_allowed_names if not empty,
+# e.g. "codis-dashboard,codis-proxy,codis-fe". product_auth is still required as before.
+admin_tls_cert_file = ""
+admin_tls_key_file = ""
+admin_tls_ca_file = ""
+admin_tls_allowed_names = ""
+
+# Set the secret to sign tokens (JWT with HS256) of the admin(rpc) API, at least 16 bytes. If it's set,
+# requests must have header "Authorization: Bearer <token>", tokens of role "read" are allowed to GET
+# only and tokens of role "admin" are allowed to call any API. codis-dashboard, codis-proxy and codis-fe
+# must share the same secret, and tokens for tools can be issued by codis-admin --issue-token.
+admin_token_secret = ""
+
 # Set bind address for proxy, proto_type can be "tcp", "tcp4", "tcp6", "unix" or "unixpacket".
 proto_type = "tcp4"
 proxy_addr = "0.0.0.0:19000"
 
+# Set TLS of the proxy listener, clients must connect with TLS if proxy_tls_cert_file and
+# proxy_tls_key_file are set. With proxy_tls_client_auth = true, clients must present certificates
+# signed by proxy_tls_ca_file. The files are reloaded for new connections once they're changed.
+proxy_tls_cert_file = ""
+proxy_tls_key_file = ""
+proxy_tls_ca_file = ""
+proxy_tls_client_auth = false
+
 # Set jodis address & session timeout
 #   1. jodis_name is short for jodis_coordinator_name, only accept "zookeeper" & "etcd".
 #   2. jodis_addr is short for jodis_coordinator_addr
@@ -48,6 +136,8 @@ proxy_addr = "0.0.0.0:19000"
 #          /zk/codis/db_{PRODUCT_NAME}/proxy-{HASHID} (compatible with Codis2.0)
 #        or else
 #          /jodis/{PRODUCT_NAME}/proxy-{HASHID}
+#   5. lua scripts are shared by proxies through it as /codis3/{PRODUCT_NAME}/scripts/{SHA1}, so EVALSHA
+#      can be resent as EVAL by any proxy.
 jodis_name = ""
 jodis_addr = ""
 jodis_auth = ""
@@ -57,8 +147,29 @@ jodis_compatible = false
 # Set datacenter of proxy.
 proxy_datacenter = ""
 
-# Set max number of alive sessions.
+# Set max number of alive sessions, and the policy for new clients once it's reached:
+#   "reject"         - refuse the new clients.
+#   "evict-idle"     - close the session idle for the longest time, if it's idle for at least
+#                      proxy_max_clients_evict_idle, or else reject the new client.
+#   "evict-priority" - close the session of the lowest ACL priority, set by the rule "priority:<n>"
+#                      of session_acl_file (0 by default), then the one idle for the longest time,
+#                      if its priority is below proxy_max_clients_evict_priority, or else reject the new client.
+# Rejected and evicted sessions are counted in the stats. All can be changed by CONFIG SET at runtime.
 proxy_max_clients = 1000
+proxy_max_clients_policy = "reject"
+proxy_max_clients_evict_idle = "5m"
+proxy_max_clients_evict_priority = 1
+
+# Set the CIDRs of clients allowed or denied to connect, separated by commas, e.g. "10.0.0.0/8, 192.168.1.7".
+# The deny rules come first, and with any allow rules a client must match one of them. Connections
+# rejected are closed at once and counted in the stats. Both can be changed by CONFIG SET at runtime.
+proxy_allow_cidrs = ""
+proxy_deny_cidrs = ""
+
+# Set the token-bucket limits of commands per proxy, as "cmd:qps" separated by commas, e.g.
+# "hgetall:500,keys:10". Requests over the limit are refused with a LIMIT error. It can be changed
+# by XCONFIG SET at runtime.
+cmd_rate_limit = ""
 
 # Set max offheap memory size. (0 to disable)
 proxy_max_offheap_size = "1024mb"
@@ -66,12 +177,21 @@ proxy_max_offheap_size = "1024mb"
 # Set heap placeholder to reduce GC frequency.
 proxy_heap_placeholder = "256mb"
 
+# Set the budget of memory of requests and replies in flight of all sessions, i.e. received but not
+# yet written to clients, including replies of sub-requests of fan-out commands. New requests over
+# the budget are refused with a retryable TRYAGAIN error. It can be changed by CONFIG SET at runtime.
+# (0 to disable)
+proxy_max_inflight_memory = "0"
+
 # Proxy will ping backend redis (and clear 'MASTERDOWN' state) in a predefined interval. (0 to disable)
 backend_ping_period = "5s"
 
 # Set backend recv buffer size & timeout.
 backend_recv_bufsize = "128kb"
 backend_recv_timeout = "30s"
+# The timeout of replies of the classes of commands (quick, slow, blocking and admin) could be set
+# apart by the command table of the dashboard, e.g. codis-admin --commands-update
+# --cmd-timeouts=quick:1s,slow:2m --cmd-classes=LRANGE:slow. A timeout resets the backend connection.
 
 # Set backend send buffer & timeout.
 backend_send_bufsize = "128kb"
@@ -90,12 +210,63 @@ backend_replica_parallel = 2
 backend_primary_quick = 1
 backend_replica_quick = 1
 
-# Set slot num
+# Set how a replica is picked for reads in the replica groups, "random", "round-robin" or "latency".
+# Replicas on the same host, then in the same data center are always preferred, the data centers of the
+# replicas are their datacenter in the dashboard, compared with proxy_datacenter.
+backend_replica_policy = "random"
+
+# Set the max replication lag of a replica to serve reads, as reported by INFO replication of its master,
+# which is polled every backend_ping_period. Reads go to the master if all replicas lag behind. (0 to disable)
+backend_replica_max_lag = 0
+
+# Set the max round trip time of INFO replication sent to each replica every backend_ping_period, replicas
+# slower than it, or with the link to the master down, are ejected from the read pool until they're fine
+# again. Primaries are probed by PING. The probes are shown in stats. (0 to disable probing)
+backend_replica_max_latency = "0ms"
+
+# Set the percentile of the round trip time of quick reads, e.g. 95 or 99, after which a quick read not yet
+# answered by the master is sent to a replica as well, and the first response wins. It's never done for
+# sessions reading from masters by READWRITE or session_read_your_writes. (0 to disable)
+backend_hedge_percentile = 0
+
+# Set the max number of times a read-only command is resent on connection reset, or LOADING or READONLY
+# error of the backend, with a jittered delay doubled from backend_retry_backoff each time. (0 to disable)
+backend_retry_max = 0
+backend_retry_backoff = "10ms"
+
+# Set the circuit breaker of each backend, which opens if backend_breaker_error_rate percent of at least
+# backend_breaker_min_requests requests fail or time out within backend_breaker_window. Then requests fail
+# fast, and reads are sent to the replicas if any, until a probe succeeds after backend_breaker_cooldown.
+# (0 to disable)
+backend_breaker_error_rate = 0
+backend_breaker_min_requests = 20
+backend_breaker_window = "10s"
+backend_breaker_cooldown = "5s"
+
+# Set how long the connections to a server no longer used by any slot are kept open, so the requests
+# in flight are answered, and the connections are reused if the server is added back. (0 to disable)
+backend_drain_timeout = "30s"
+
+# Set how long a server newly added to a replica group is warmed up, it serves no reads until all of its
+# connections are ready, or the timeout is reached. (0 to serve reads once any connection is ready)
+backend_warmup_timeout = "5s"
+
+# Set slot num, e.g. 1024, 4096 or 16384. It's fixed when the product is created, and proxies
+# must use the same slot num as the dashboard.
 max_slot_num = 1024
 
 # Set backend tcp keepalive period. (0 to disable)
 backend_keepalive_period = "75s"
 
+# Set TLS of backend connections. The servers are verified by backend_tls_ca_file only if set, or else
+# by the CAs of the host, with backend_tls_server_name as SNI, or the host of each server if empty.
+# backend_tls_cert_file and backend_tls_key_file are sent to servers requiring client certificates.
+backend_tls = false
+backend_tls_ca_file = ""
+backend_tls_server_name = ""
+backend_tls_cert_file = ""
+backend_tls_key_file = ""
+
 # Set number of databases of backend.
 backend_number_databases = 1
 
@@ -115,12 +286,143 @@ session_max_pipeline = 10000
 # Set session tcp keepalive period. (0 to disable)
 session_keepalive_period = "75s"
 
+# Set the limits of replies pending to be written to clients, as client-output-buffer-limit of Redis,
+# "<class> <hard limit> <soft limit> <soft seconds>" for the classes normal (replies of requests) and
+# pubsub (messages of subscriptions), 0 means no limit. A client over the hard limit, or over the soft
+# limit for the soft seconds, is disconnected, or with session_output_buffer_action = "throttle", the
+# proxy stops reading its requests, or messages for it from backends, until the pending replies drain
+# below the soft limit (the hard limit if no soft limit). Both can be changed by CONFIG SET at runtime.
+session_output_buffer_limit = "normal 0 0 0 pubsub 32mb 8mb 60"
+session_output_buffer_action = "disconnect"
+
 # Set session to be sensitive to failures. Default is false, instead of closing socket, proxy will send an error response to client.
 session_break_on_failure = false
 
+# Set the number of keys from which MGET/DEL are split into per-slot sub-requests, (0 to disable)
+# and the max number of sub-requests of a request in flight to the same backend.
+session_batch_threshold = 128
+session_batch_concurrency = 16
+
+# Set when read-only commands are sent to the replica groups, "always" or "readonly". With "readonly",
+# only sessions that issued READONLY read from replicas. READWRITE routes reads of a session to masters.
+session_replica_read = "always"
+
+# Set how long reads of a session are sent to the masters after it writes to the same slot, so that
+# it reads its own writes with replica reads enabled. (0 to disable)
+session_read_your_writes = "0s"
+
 # Slowlog-log-slower-than(us), from receive command to send response, 0 is allways print slow log
 slowlog_log_slower_than = 100000
 
+# Set the file the slowlog is saved to periodically and restored from on start, so that it's kept across
+# restarts, and the target XSLOWLOG EXPORT sends the entries to for offline analysis, as JSON lines appended
+# to the file, or a JSON array POSTed if it's an http(s) URL. Both are disabled if empty.
+slowlog_persist_file = ""
+slowlog_export_target = ""
+
+# Set the values masked as "(redacted)" in the slowlog and logs, passwords of AUTH, HELLO and ACL SETUSER
+# are always masked. redact_key_patterns are glob patterns of keys, separated by commas, whose values of
+# SET/SETEX/MSET etc. are masked, and redact_field_patterns are of the fields whose values of HSET/HMSET
+# are masked, e.g. "*password*,*token*".
+redact_key_patterns = ""
+redact_field_patterns = ""
+
+# Set the commands streamed to the sessions of MONITOR, one of every monitor_sample_ratio commands is streamed.
+# The values of the commands are masked as of the redact patterns above if monitor_redact is true, passwords are
+# always masked. Monitors falling behind are closed by session_output_buffer_limit of pubsub.
+monitor_sample_ratio = 1
+monitor_redact = true
+
+# Set latency-monitor-threshold(ms), commands slower than it are sampled for LATENCY LATEST/HISTORY. (0 to disable)
+latency_monitor_threshold = 0
+
+# Set threshold of serialized length for big-key report, keys reported larger than it by DEBUG OBJECT are recorded. (0 to disable)
+bigkey_size_threshold = "10mb"
+
+# Set file the big-key report is saved to every 10 seconds and restored from at startup, the report is
+# kept in memory only if it's empty. The report is read by XMONITOR BIGKEYS or the admin API /api/proxy/bigkeys.
+bigkey_report_file = ""
+
+# Set max size of values written by SET/SETEX/MSET/APPEND/HSET/LPUSH/SADD/ZADD/XADD etc., requests with larger values are rejected
+# before forwarded to backends. (0 to disable)
+max_value_bytes = "0"
+
+# Set max batch size, i.e. the number of keys/fields/members, and max bytes of all arguments of requests. (0 to disable)
+# They can be overridden by commands in cmd_batch_limit as "cmd:size[:bytes]" separated by commas, e.g.
+# "mget:1000,hmset:100:1mb", where size 0 means unlimited and bytes omitted means max_batch_bytes.
+max_batch_size = 0
+max_batch_bytes = "0"
+cmd_batch_limit = ""
+
+# Set number of the hottest keys tracked by the sampler of the router, (0 to disable) where one of every
+# hotkey_sample_ratio requests is sampled. The keys of the last hotkey_interval, with the counts estimated,
+# are reported by XMONITOR HOTKEYS and the proxy stats.
+hotkey_capacity = 0
+hotkey_sample_ratio = 16
+hotkey_interval = "10s"
+
+# Set max number of replies of read commands of the hot keys cached by the proxy, (0 to disable) which
+# requires the sampler of hot keys. The replies expire after hotkey_cache_ttl, and are invalidated by the
+# writes of the keys through the proxy, so the reads may be stale for that long at most. Only the hot keys
+# read hotkey_cache_min_qps times per second at least, as estimated by the sampler, are cached.
+hotkey_cache_size = 0
+hotkey_cache_ttl = "100ms"
+hotkey_cache_min_qps = 100
+
+# Set max number of nil replies of GET of missing keys cached by the proxy, (0 to disable) to protect the
+# backends from cache penetration. The replies expire after negative_cache_ttl, and are invalidated by the
+# writes through the proxy.
+negative_cache_size = 0
+negative_cache_ttl = "1s"
+
+# Set commands whose identical requests in flight are collapsed into one request to backends, separated by
+# commas, e.g. "get,hget". The requests sent later wait for the reply of the first one, to blunt the thundering
+# herd after expiry of a cache. It doesn't work with backend_retry_max.
+singleflight_commands = ""
+
+# Set true to subscribe to the keyspace notifications of the backends, so that the keys written by others than the
+# proxy are invalidated for the clients of CLIENT TRACKING as well. It requires notify-keyspace-events of the backends
+# to be set, e.g. "K$lshzxeg".
+tracking_keyspace_events = false
+
+# Set whether KEYS is answered by scanning all groups, only for debugging since
+# it's expensive. The reply is cut at keys_fanout_max_results keys.
+keys_fanout_enabled = false
+keys_fanout_max_results = 10000
+
+# Set whether FLUSHALL/FLUSHDB are sent to all groups, only for test environments.
+# The command has to be resent with the token replied, e.g. FLUSHALL ASYNC CONFIRM <token>.
+admin_flush_enabled = false
+
+# Set the max number of members of each set or sorted set read by the proxy to compute
+# SDIFF/SINTER/SUNION and ZINTERSTORE/ZUNIONSTORE of keys in different slots, the command fails if
+# any of them replied is larger. (0 to disable)
+set_algebra_max_members = 100000
+
+# Set to allow RENAME/RENAMENX of keys in different slots, done by the proxy with DUMP, RESTORE and
+# DEL on the source. It requires the backends to support DUMP/RESTORE, which Pika doesn't, and it's
+# not atomic for other clients.
+rename_cross_slot_enabled = false
+
+# Set to allow SMOVE of keys in different slots, done by the proxy with SREM and SADD. It's not
+# atomic, and the member is added back to the source on a best-effort basis if SADD fails.
+smove_cross_slot_enabled = false
+
+# Set the max size of each string read by the proxy to compute BITOP of keys in different slots. (0 to disable)
+bitop_max_operand_size = "1mb"
+
+# Set to allow MSETNX of keys in different slots, done by the proxy with EXISTS and then SET per key.
+# It's not atomic, keys created by other clients in between may be overwritten.
+msetnx_two_phase_enabled = false
+
+# Set to answer CLUSTER SLOTS/SHARDS/NODES/INFO as a redis cluster, so cluster-aware clients are able to
+# connect to the proxy. The nodes of the cluster are the proxy and cluster_emulation_nodes, the addresses of
+# other proxies separated by commas, which should be the same on all of them. The 16384 slots are split
+# evenly among the nodes sorted by address, and any node serves any key, so MOVED is never replied.
+# With no other nodes, the proxy is the only node, and all clients are sent to it.
+cluster_emulation_enabled = false
+cluster_emulation_nodes = ""
+
 # quick command list
 quick_cmd_list = "get,set"
 # slow command list
@@ -137,10 +439,37 @@ metrics_report_influxdb_username = ""
 metrics_report_influxdb_password = ""
 metrics_report_influxdb_database = ""
 
-# Set statsd server (such as localhost:8125), proxy will report metrics to statsd.
+# Set statsd server (such as localhost:8125), proxy will report metrics to statsd, including the calls, fails and
+# average duration in ms of each command since the last report. Set metrics_report_statsd_format to "dogstatsd" or
+# "influxdb" to identify the proxy by tags rather than the names of metrics, with the extra tags of
+# metrics_report_statsd_tags as "key:value" separated by commas, e.g. "env:prod,idc:bj".
 metrics_report_statsd_server = ""
 metrics_report_statsd_period = "1s"
 metrics_report_statsd_prefix = ""
+metrics_report_statsd_format = "statsd"
+metrics_report_statsd_tags = ""
+
+# Set Prometheus remote write endpoint (such as http://localhost:9090/api/v1/write), proxy will push the same metrics
+# as /metrics of the admin port, labelled with job="codis-proxy" and instance of the admin addr, for the proxies that
+# can't be scraped, e.g. behind NAT.
+metrics_report_remote_write_server = ""
+metrics_report_remote_write_period = "15s"
+
+# Set OTLP/HTTP endpoint of traces (such as http://localhost:4318/v1/traces), proxy will export the spans of one of
+# every tracing_sample_ratio requests in the JSON encoding of OpenTelemetry, with the slot, backend addr, time waiting
+# in the queue of the backend conn and round trip time of each request.
+tracing_otlp_endpoint = ""
+tracing_sample_ratio = 1000
+tracing_export_period = "1s"
+
+# Set Pyroscope compatible endpoint of continuous profiling (such as http://localhost:4040), proxy will capture the
+# profiles of profiling_types every profiling_push_interval, cpu for profiling_cpu_duration, and push them in the
+# format of pprof to /ingest, labelled with the product and the proxy token. Types are of cpu, heap, allocs and
+# goroutine, separated by commas. Captures are skipped while a profile is taken by the admin API.
+profiling_push_endpoint = ""
+profiling_push_interval = "60s"
+profiling_cpu_duration = "10s"
+profiling_types = "cpu,heap"
 
 # Maximum delay statistical time interval.(This value must be greater than 0.)
 max_delay_refresh_time_interval = "15s"
@@ -151,6 +480,17 @@ type Config struct {
 	ProxyAddr string `toml:"proxy_addr" json:"proxy_addr"`
 	AdminAddr string `toml:"admin_addr" json:"admin_addr"`
 
+	AdminTLSCertFile     string `toml:"admin_tls_cert_file" json:"admin_tls_cert_file"`
+	AdminTLSKeyFile      string `toml:"admin_tls_key_file" json:"admin_tls_key_file"`
+	AdminTLSCAFile       string `toml:"admin_tls_ca_file" json:"admin_tls_ca_file"`
+	AdminTLSAllowedNames string `toml:"admin_tls_allowed_names" json:"admin_tls_allowed_names"`
+	AdminTokenSecret     string `toml:"admin_token_secret" json:"-"`
+
+	ProxyTLSCertFile   string `toml:"proxy_tls_cert_file" json:"proxy_tls_cert_file"`
+	ProxyTLSKeyFile    string `toml:"proxy_tls_key_file" json:"proxy_tls_key_file"`
+	ProxyTLSCAFile     string `toml:"proxy_tls_ca_file" json:"proxy_tls_ca_file"`
+	ProxyTLSClientAuth bool   `toml:"proxy_tls_client_auth" json:"proxy_tls_client_auth"`
+
 	HostProxy string `toml:"-" json:"-"`
 	HostAdmin string `toml:"-" json:"-"`
 
@@ -162,12 +502,42 @@ type Config struct {
 
 	ProductName string `toml:"product_name" json:"product_name"`
 	ProductAuth string `toml:"product_auth" json:"-"`
-	SessionAuth string `toml:"session_auth" json:"-"`
 
-	ProxyDataCenter      string         `toml:"proxy_datacenter" json:"proxy_datacenter"`
-	ProxyMaxClients      int            `toml:"proxy_max_clients" json:"proxy_max_clients"`
-	ProxyMaxOffheapBytes bytesize.Int64 `toml:"proxy_max_offheap_size" json:"proxy_max_offheap_size"`
-	ProxyHeapPlaceholder bytesize.Int64 `toml:"proxy_heap_placeholder" json:"proxy_heap_placeholder"`
+	VaultAddr           string            `toml:"vault_addr" json:"vault_addr"`
+	VaultTokenFile      string            `toml:"vault_token_file" json:"vault_token_file"`
+	VaultNamespace      string            `toml:"vault_namespace" json:"vault_namespace"`
+	VaultCAFile         string            `toml:"vault_ca_file" json:"vault_ca_file"`
+	SecretRefreshPeriod timesize.Duration `toml:"secret_refresh_period" json:"secret_refresh_period"`
+	SessionAuth         string            `toml:"session_auth" json:"-"`
+
+	SessionAdminEnabled bool   `toml:"session_admin_enabled" json:"session_admin_enabled"`
+	SessionACLFile      string `toml:"session_acl_file" json:"session_acl_file"`
+
+	AuditLog           string `toml:"audit_log" json:"audit_log"`
+	AuditLogCategories string `toml:"audit_log_categories" json:"audit_log_categories"`
+
+	HashTag  string `toml:"hash_tag" json:"hash_tag"`
+	HashMode string `toml:"hash_mode" json:"hash_mode"`
+	HashKey  string `toml:"hash_key" json:"-"`
+
+	RouterMode       string `toml:"router_mode" json:"router_mode"`
+	RingVirtualNodes int    `toml:"ring_virtual_nodes" json:"ring_virtual_nodes"`
+
+	SessionAuthMaxCommands int64 `toml:"session_auth_max_commands" json:"session_auth_max_commands"`
+
+	ProxyDataCenter       string         `toml:"proxy_datacenter" json:"proxy_datacenter"`
+	ProxyMaxClients       int            `toml:"proxy_max_clients" json:"proxy_max_clients"`
+	ProxyMaxClientsPolicy string         `toml:"proxy_max_clients_policy" json:"proxy_max_clients_policy"`
+	ProxyAllowCIDRs       string         `toml:"proxy_allow_cidrs" json:"proxy_allow_cidrs"`
+	ProxyDenyCIDRs        string         `toml:"proxy_deny_cidrs" json:"proxy_deny_cidrs"`
+	CmdRateLimit          string         `toml:"cmd_rate_limit" json:"cmd_rate_limit"`
+	ProxyMaxOffheapBytes  bytesize.Int64 `toml:"proxy_max_offheap_size" json:"proxy_max_offheap_size"`
+	ProxyHeapPlaceholder  bytesize.Int64 `toml:"proxy_heap_placeholder" json:"proxy_heap_placeholder"`
+
+	ProxyMaxClientsEvictIdle     timesize.Duration `toml:"proxy_max_clients_evict_idle" json:"proxy_max_clients_evict_idle"`
+	ProxyMaxClientsEvictPriority int64             `toml:"proxy_max_clients_evict_priority" json:"proxy_max_clients_evict_priority"`
+
+	ProxyMaxInflightMemory bytesize.Int64 `toml:"proxy_max_inflight_memory" json:"proxy_max_inflight_memory"`
 
 	BackendPingPeriod      timesize.Duration `toml:"backend_ping_period" json:"backend_ping_period"`
 	BackendRecvBufsize     bytesize.Int64    `toml:"backend_recv_bufsize" json:"backend_recv_bufsize"`
@@ -181,8 +551,30 @@ type Config struct {
 	MaxSlotNum             int               `toml:"max_slot_num" json:"max_slot_num"`
 	BackendReplicaParallel int               `toml:"backend_replica_parallel" json:"backend_replica_parallel"`
 	BackendReplicaQuick    int               `toml:"backend_replica_quick" json:"backend_replica_quick"`
-	BackendKeepAlivePeriod timesize.Duration `toml:"backend_keepalive_period" json:"backend_keepalive_period"`
-	BackendNumberDatabases int32             `toml:"backend_number_databases" json:"backend_number_databases"`
+	BackendReplicaPolicy   string            `toml:"backend_replica_policy" json:"backend_replica_policy"`
+	BackendReplicaMaxLag   int64             `toml:"backend_replica_max_lag" json:"backend_replica_max_lag"`
+	BackendHedgePercentile int64             `toml:"backend_hedge_percentile" json:"backend_hedge_percentile"`
+	BackendRetryMax        int               `toml:"backend_retry_max" json:"backend_retry_max"`
+	BackendRetryBackoff    timesize.Duration `toml:"backend_retry_backoff" json:"backend_retry_backoff"`
+
+	BackendBreakerErrorRate   int64             `toml:"backend_breaker_error_rate" json:"backend_breaker_error_rate"`
+	BackendBreakerMinRequests int64             `toml:"backend_breaker_min_requests" json:"backend_breaker_min_requests"`
+	BackendBreakerWindow      timesize.Duration `toml:"backend_breaker_window" json:"backend_breaker_window"`
+	BackendBreakerCooldown    timesize.Duration `toml:"backend_breaker_cooldown" json:"backend_breaker_cooldown"`
+	BackendDrainTimeout       timesize.Duration `toml:"backend_drain_timeout" json:"backend_drain_timeout"`
+	BackendWarmupTimeout      timesize.Duration `toml:"backend_warmup_timeout" json:"backend_warmup_timeout"`
+	BackendReplicaMaxLatency  timesize.Duration `toml:"backend_replica_max_latency" json:"backend_replica_max_latency"`
+	BackendKeepAlivePeriod    timesize.Duration `toml:"backend_keepalive_period" json:"backend_keepalive_period"`
+	BackendNumberDatabases    int32             `toml:"backend_number_databases" json:"backend_number_databases"`
+
+	BackendTLS           bool   `toml:"backend_tls" json:"backend_tls"`
+	BackendTLSCAFile     string `toml:"backend_tls_ca_file" json:"backend_tls_ca_file"`
+	BackendTLSServerName string `toml:"backend_tls_server_name" json:"backend_tls_server_name"`
+	BackendTLSCertFile   string `toml:"backend_tls_cert_file" json:"backend_tls_cert_file"`
+	BackendTLSKeyFile    string `toml:"backend_tls_key_file" json:"backend_tls_key_file"`
+
+	// backendTLS is loaded by the proxy if backend_tls is true.
+	backendTLS *tls.Config
 
 	SessionRecvBufsize     bytesize.Int64    `toml:"session_recv_bufsize" json:"session_recv_bufsize"`
 	SessionRecvTimeout     timesize.Duration `toml:"session_recv_timeout" json:"session_recv_timeout"`
@@ -192,7 +584,61 @@ type Config struct {
 	SessionKeepAlivePeriod timesize.Duration `toml:"session_keepalive_period" json:"session_keepalive_period"`
 	SessionBreakOnFailure  bool              `toml:"session_break_on_failure" json:"session_break_on_failure"`
 
-	SlowlogLogSlowerThan int64 `toml:"slowlog_log_slower_than" json:"slowlog_log_slower_than"`
+	SessionOutputBufferLimit  string `toml:"session_output_buffer_limit" json:"session_output_buffer_limit"`
+	SessionOutputBufferAction string `toml:"session_output_buffer_action" json:"session_output_buffer_action"`
+
+	SessionBatchThreshold   int `toml:"session_batch_threshold" json:"session_batch_threshold"`
+	SessionBatchConcurrency int `toml:"session_batch_concurrency" json:"session_batch_concurrency"`
+
+	SessionReplicaRead string `toml:"session_replica_read" json:"session_replica_read"`
+
+	SessionReadYourWrites timesize.Duration `toml:"session_read_your_writes" json:"session_read_your_writes"`
+
+	SlowlogLogSlowerThan int64  `toml:"slowlog_log_slower_than" json:"slowlog_log_slower_than"`
+	SlowlogPersistFile   string `toml:"slowlog_persist_file" json:"slowlog_persist_file"`
+	SlowlogExportTarget  string `toml:"slowlog_export_target" json:"slowlog_export_target"`
+
+	RedactKeyPatterns   string `toml:"redact_key_patterns" json:"redact_key_patterns"`
+	RedactFieldPatterns string `toml:"redact_field_patterns" json:"redact_field_patterns"`
+
+	MonitorSampleRatio int64 `toml:"monitor_sample_ratio" json:"monitor_sample_ratio"`
+	MonitorRedact      bool  `toml:"monitor_redact" json:"monitor_redact"`
+
+	LatencyMonitorThreshold int64 `toml:"latency_monitor_threshold" json:"latency_monitor_threshold"`
+
+	BigKeySizeThreshold bytesize.Int64 `toml:"bigkey_size_threshold" json:"bigkey_size_threshold"`
+	BigKeyReportFile    string         `toml:"bigkey_report_file" json:"bigkey_report_file"`
+	MaxValueBytes       bytesize.Int64 `toml:"max_value_bytes" json:"max_value_bytes"`
+	MaxBatchSize        int64          `toml:"max_batch_size" json:"max_batch_size"`
+	MaxBatchBytes       bytesize.Int64 `toml:"max_batch_bytes" json:"max_batch_bytes"`
+	CmdBatchLimit       string         `toml:"cmd_batch_limit" json:"cmd_batch_limit"`
+
+	HotKeyCapacity    int               `toml:"hotkey_capacity" json:"hotkey_capacity"`
+	HotKeySampleRatio int64             `toml:"hotkey_sample_ratio" json:"hotkey_sample_ratio"`
+	HotKeyInterval    timesize.Duration `toml:"hotkey_interval" json:"hotkey_interval"`
+	HotKeyCacheSize   int               `toml:"hotkey_cache_size" json:"hotkey_cache_size"`
+	HotKeyCacheTTL    timesize.Duration `toml:"hotkey_cache_ttl" json:"hotkey_cache_ttl"`
+	HotKeyCacheMinQPS int64             `toml:"hotkey_cache_min_qps" json:"hotkey_cache_min_qps"`
+	NegativeCacheSize int               `toml:"negative_cache_size" json:"negative_cache_size"`
+	NegativeCacheTTL  timesize.Duration `toml:"negative_cache_ttl" json:"negative_cache_ttl"`
+
+	SingleflightCommands   string `toml:"singleflight_commands" json:"singleflight_commands"`
+	TrackingKeyspaceEvents bool   `toml:"tracking_keyspace_events" json:"tracking_keyspace_events"`
+
+	KeysFanoutEnabled    bool  `toml:"keys_fanout_enabled" json:"keys_fanout_enabled"`
+	KeysFanoutMaxResults int64 `toml:"keys_fanout_max_results" json:"keys_fanout_max_results"`
+
+	AdminFlushEnabled bool `toml:"admin_flush_enabled" json:"admin_flush_enabled"`
+
+	SetAlgebraMaxMembers   int64 `toml:"set_algebra_max_members" json:"set_algebra_max_members"`
+	RenameCrossSlotEnabled bool  `toml:"rename_cross_slot_enabled" json:"rename_cross_slot_enabled"`
+	SMoveCrossSlotEnabled  bool  `toml:"smove_cross_slot_enabled" json:"smove_cross_slot_enabled"`
+
+	BitOpMaxOperandSize   bytesize.Int64 `toml:"bitop_max_operand_size" json:"bitop_max_operand_size"`
+	MSetNXTwoPhaseEnabled bool           `toml:"msetnx_two_phase_enabled" json:"msetnx_two_phase_enabled"`
+
+	ClusterEmulationEnabled bool   `toml:"cluster_emulation_enabled" json:"cluster_emulation_enabled"`
+	ClusterEmulationNodes   string `toml:"cluster_emulation_nodes" json:"cluster_emulation_nodes"`
 
 	QuickCmdList    string `toml:"quick_cmd_list" json:"quick_cmd_list"`
 	SlowCmdList     string `toml:"slow_cmd_list" json:"slow_cmd_list"`
@@ -208,10 +654,28 @@ type Config struct {
 	MetricsReportStatsdServer     string            `toml:"metrics_report_statsd_server" json:"metrics_report_statsd_server"`
 	MetricsReportStatsdPeriod     timesize.Duration `toml:"metrics_report_statsd_period" json:"metrics_report_statsd_period"`
 	MetricsReportStatsdPrefix     string            `toml:"metrics_report_statsd_prefix" json:"metrics_report_statsd_prefix"`
+	MetricsReportStatsdFormat     string            `toml:"metrics_report_statsd_format" json:"metrics_report_statsd_format"`
+	MetricsReportStatsdTags       string            `toml:"metrics_report_statsd_tags" json:"metrics_report_statsd_tags"`
+
+	MetricsReportRemoteWriteServer string            `toml:"metrics_report_remote_write_server" json:"metrics_report_remote_write_server"`
+	MetricsReportRemoteWritePeriod timesize.Duration `toml:"metrics_report_remote_write_period" json:"metrics_report_remote_write_period"`
+
+	TracingOtlpEndpoint string            `toml:"tracing_otlp_endpoint" json:"tracing_otlp_endpoint"`
+	TracingSampleRatio  int64             `toml:"tracing_sample_ratio" json:"tracing_sample_ratio"`
+	TracingExportPeriod timesize.Duration `toml:"tracing_export_period" json:"tracing_export_period"`
+
+	ProfilingPushEndpoint string            `toml:"profiling_push_endpoint" json:"profiling_push_endpoint"`
+	ProfilingPushInterval timesize.Duration `toml:"profiling_push_interval" json:"profiling_push_interval"`
+	ProfilingCPUDuration  timesize.Duration `toml:"profiling_cpu_duration" json:"profiling_cpu_duration"`
+	ProfilingTypes        string            `toml:"profiling_types" json:"profiling_types"`
 
 	MaxDelayRefreshTimeInterval timesize.Duration `toml:"max_delay_refresh_time_interval" json:"max_delay_refresh_time_interval"`
 
 	ConfigFileName string `toml:"-" json:"config_file_name"`
+
+	// auth is product_auth and session_auth of the proxy of the config, which
+	// are changed at runtime.
+	auth *proxyAuth
 }
 
 func NewDefaultConfig() *Config {
@@ -241,16 +705,53 @@ func (c *Config) String() string {
 	return b.String()
 }
 
+// NewHashFunc returns the hash function of keys of hash_mode and hash_key.
+func (c *Config) NewHashFunc() (HashFunc, error) {
+	key, err := hex.DecodeString(c.HashKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return NewHashFunc(c.HashMode, key)
+}
+
+// hashKeySum returns a digest of hash_key in siphash mode, which tells the
+// keys of proxies apart without revealing them.
+func (c *Config) hashKeySum() string {
+	if c.HashMode != HashModeSipHash {
+		return ""
+	}
+	key, _ := hex.DecodeString(c.HashKey)
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
 func (c *Config) Validate() error {
 	if c.ProtoType == "" {
 		return errors.New("invalid proto_type")
 	}
+	if c.HashTag != "" && (len(c.HashTag) != 2 || c.HashTag[0] == c.HashTag[1]) {
+		return errors.New("invalid hash_tag")
+	}
 	if c.ProxyAddr == "" {
 		return errors.New("invalid proxy_addr")
 	}
 	if c.AdminAddr == "" {
 		return errors.New("invalid admin_addr")
 	}
+	if c.AdminTLSCertFile != "" || c.AdminTLSKeyFile != "" || c.AdminTLSCAFile != "" {
+		if c.AdminTLSCertFile == "" || c.AdminTLSKeyFile == "" || c.AdminTLSCAFile == "" {
+			return errors.New("invalid admin_tls_cert_file, admin_tls_key_file or admin_tls_ca_file")
+		}
+	}
+	if c.AdminTokenSecret != "" && !secret.IsRef(c.AdminTokenSecret) && len(c.AdminTokenSecret) < rpc.MinTokenSecretLen {
+		return errors.New("invalid admin_token_secret")
+	}
+	if (c.ProxyTLSCertFile == "") != (c.ProxyTLSKeyFile == "") {
+		return errors.New("invalid proxy_tls_cert_file or proxy_tls_key_file")
+	}
+	if c.ProxyTLSClientAuth && (c.ProxyTLSCertFile == "" || c.ProxyTLSCAFile == "") {
+		return errors.New("invalid proxy_tls_client_auth, requires proxy_tls_cert_file and proxy_tls_ca_file")
+	}
 	if c.JodisName != "" {
 		if c.JodisAddr == "" {
 			return errors.New("invalid jodis_addr")
@@ -262,9 +763,30 @@ func (c *Config) Validate() error {
 	if c.ProductName == "" {
 		return errors.New("invalid product_name")
 	}
+	if c.SecretRefreshPeriod < 0 {
+		return errors.New("invalid secret_refresh_period")
+	}
+	if _, err := parseAuditCategories(c.AuditLogCategories); err != nil {
+		return errors.Errorf("invalid audit_log_categories, %s", err)
+	}
+	if _, err := parseCmdRateLimit(c.CmdRateLimit); err != nil {
+		return errors.Errorf("invalid cmd_rate_limit, %s", err)
+	}
+	if _, err := parseCIDRs(c.ProxyAllowCIDRs); err != nil {
+		return errors.Errorf("invalid proxy_allow_cidrs, %s", err)
+	}
+	if _, err := parseCIDRs(c.ProxyDenyCIDRs); err != nil {
+		return errors.Errorf("invalid proxy_deny_cidrs, %s", err)
+	}
 	if c.ProxyMaxClients < 0 {
 		return errors.New("invalid proxy_max_clients")
 	}
+	if err := checkMaxClientsPolicy(c.ProxyMaxClientsPolicy); err != nil {
+		return errors.New("invalid proxy_max_clients_policy")
+	}
+	if c.ProxyMaxClientsEvictIdle < 0 {
+		return errors.New("invalid proxy_max_clients_evict_idle")
+	}
 
 	const MaxInt = bytesize.Int64(^uint(0) >> 1)
 
@@ -274,6 +796,9 @@ func (c *Config) Validate() error {
 	if d := c.ProxyHeapPlaceholder; d < 0 || d > MaxInt {
 		return errors.New("invalid proxy_heap_placeholder")
 	}
+	if c.ProxyMaxInflightMemory < 0 {
+		return errors.New("invalid proxy_max_inflight_memory")
+	}
 	if c.BackendPingPeriod < 0 {
 		return errors.New("invalid backend_ping_period")
 	}
@@ -296,6 +821,21 @@ func (c *Config) Validate() error {
 	if c.MaxSlotNum <= 0 {
 		return errors.New("invalid max_slot_num")
 	}
+	if _, err := c.NewHashFunc(); err != nil {
+		return errors.New("invalid hash_mode or hash_key")
+	}
+	if c.HashMode == HashModeCRC16 && c.MaxSlotNum != ClusterSlotNum {
+		return errors.New("invalid max_slot_num, must be 16384 in crc16 hash_mode")
+	}
+	switch c.RouterMode {
+	case "", RouterModeSlots:
+	case RouterModeRing:
+		if c.RingVirtualNodes <= 0 {
+			return errors.New("invalid ring_virtual_nodes")
+		}
+	default:
+		return errors.New("invalid router_mode")
+	}
 	if c.BackendPrimaryParallel < 0 {
 		return errors.New("invalid backend_primary_parallel")
 	}
@@ -308,12 +848,53 @@ func (c *Config) Validate() error {
 	if c.BackendReplicaQuick < 0 || c.BackendReplicaQuick >= c.BackendReplicaParallel {
 		return errors.New("invalid backend_replica_quick")
 	}
+	switch c.BackendReplicaPolicy {
+	case "", ReplicaPolicyRandom, ReplicaPolicyRoundRobin, ReplicaPolicyLatency:
+	default:
+		return errors.New("invalid backend_replica_policy")
+	}
+	if c.BackendReplicaMaxLag < 0 {
+		return errors.New("invalid backend_replica_max_lag")
+	}
+	if c.BackendReplicaMaxLatency < 0 {
+		return errors.New("invalid backend_replica_max_latency")
+	}
+	if c.BackendHedgePercentile < 0 || c.BackendHedgePercentile >= 100 {
+		return errors.New("invalid backend_hedge_percentile")
+	}
+	if c.BackendRetryMax < 0 {
+		return errors.New("invalid backend_retry_max")
+	}
+	if c.BackendRetryBackoff < 0 {
+		return errors.New("invalid backend_retry_backoff")
+	}
+	if c.BackendBreakerErrorRate < 0 || c.BackendBreakerErrorRate > 100 {
+		return errors.New("invalid backend_breaker_error_rate")
+	}
+	if c.BackendBreakerMinRequests < 0 {
+		return errors.New("invalid backend_breaker_min_requests")
+	}
+	if c.BackendBreakerWindow <= 0 {
+		return errors.New("invalid backend_breaker_window")
+	}
+	if c.BackendBreakerCooldown <= 0 {
+		return errors.New("invalid backend_breaker_cooldown")
+	}
+	if c.BackendDrainTimeout < 0 {
+		return errors.New("invalid backend_drain_timeout")
+	}
+	if c.BackendWarmupTimeout < 0 {
+		return errors.New("invalid backend_warmup_timeout")
+	}
 	if c.BackendKeepAlivePeriod < 0 {
 		return errors.New("invalid backend_keepalive_period")
 	}
 	if c.BackendNumberDatabases < 1 {
 		return errors.New("invalid backend_number_databases")
 	}
+	if (c.BackendTLSCertFile == "") != (c.BackendTLSKeyFile == "") {
+		return errors.New("invalid backend_tls_cert_file or backend_tls_key_file")
+	}
 
 	if d := c.SessionRecvBufsize; d < 0 || d > MaxInt {
 		return errors.New("invalid session_recv_bufsize")
@@ -327,16 +908,93 @@ func (c *Config) Validate() error {
 	if c.SessionSendTimeout < 0 {
 		return errors.New("invalid session_send_timeout")
 	}
+	if c.SessionAuthMaxCommands < 0 {
+		return errors.New("invalid session_auth_max_commands")
+	}
 	if c.SessionMaxPipeline < 0 {
 		return errors.New("invalid session_max_pipeline")
 	}
+	if _, err := parseOutputBufferLimit(c.SessionOutputBufferLimit); err != nil {
+		return errors.Errorf("invalid session_output_buffer_limit, %s", err)
+	}
+	if err := checkOutputBufferAction(c.SessionOutputBufferAction); err != nil {
+		return errors.New("invalid session_output_buffer_action")
+	}
 	if c.SessionKeepAlivePeriod < 0 {
 		return errors.New("invalid session_keepalive_period")
 	}
+	if c.SessionBatchThreshold < 0 {
+		return errors.New("invalid session_batch_threshold")
+	}
+	switch c.SessionReplicaRead {
+	case "", ReplicaReadAlways, ReplicaReadOnly:
+	default:
+		return errors.New("invalid session_replica_read")
+	}
+	if c.SessionReadYourWrites < 0 {
+		return errors.New("invalid session_read_your_writes")
+	}
+	if c.SessionBatchConcurrency <= 0 {
+		return errors.New("invalid session_batch_concurrency")
+	}
 
 	if c.SlowlogLogSlowerThan < 0 {
 		return errors.New("invalid slowlog_log_slower_than")
 	}
+	if c.LatencyMonitorThreshold < 0 {
+		return errors.New("invalid latency_monitor_threshold")
+	}
+	if d := c.BigKeySizeThreshold; d < 0 || d > MaxInt {
+		return errors.New("invalid bigkey_size_threshold")
+	}
+	if d := c.MaxValueBytes; d < 0 || d > MaxInt {
+		return errors.New("invalid max_value_bytes")
+	}
+	if c.MaxBatchSize < 0 {
+		return errors.New("invalid max_batch_size")
+	}
+	if d := c.MaxBatchBytes; d < 0 || d > MaxInt {
+		return errors.New("invalid max_batch_bytes")
+	}
+	if _, err := parseCmdBatchLimit(c.CmdBatchLimit); err != nil {
+		return errors.Errorf("invalid cmd_batch_limit, %s", err)
+	}
+	if c.HotKeyCapacity < 0 {
+		return errors.New("invalid hotkey_capacity")
+	}
+	if c.HotKeySampleRatio <= 0 {
+		return errors.New("invalid hotkey_sample_ratio")
+	}
+	if c.HotKeyInterval <= 0 {
+		return errors.New("invalid hotkey_interval")
+	}
+	if c.HotKeyCacheSize < 0 {
+		return errors.New("invalid hotkey_cache_size")
+	}
+	if c.HotKeyCacheTTL <= 0 {
+		return errors.New("invalid hotkey_cache_ttl")
+	}
+	if c.HotKeyCacheMinQPS < 0 {
+		return errors.New("invalid hotkey_cache_min_qps")
+	}
+	if c.NegativeCacheSize < 0 {
+		return errors.New("invalid negative_cache_size")
+	}
+	if c.NegativeCacheTTL <= 0 {
+		return errors.New("invalid negative_cache_ttl")
+	}
+	if c.KeysFanoutMaxResults <= 0 {
+		return errors.New("invalid keys_fanout_max_results")
+	}
+	if c.SetAlgebraMaxMembers < 0 {
+		return errors.New("invalid set_algebra_max_members")
+	}
+	if _, err := parseClusterNodes(c.ClusterEmulationNodes); err != nil {
+		return errors.New("invalid cluster_emulation_nodes")
+	}
+	if d := c.BitOpMaxOperandSize; d < 0 || d > MaxInt {
+		return errors.New("invalid bitop_max_operand_size")
+	}
 
 	if c.MetricsReportPeriod < 0 {
 		return errors.New("invalid metrics_report_period")
@@ -347,6 +1005,32 @@ func (c *Config) Validate() error {
 	if c.MetricsReportStatsdPeriod < 0 {
 		return errors.New("invalid metrics_report_statsd_period")
 	}
+	if c.MetricsReportRemoteWritePeriod < 0 {
+		return errors.New("invalid metrics_report_remote_write_period")
+	}
+	if f := c.MetricsReportStatsdFormat; f != "" && f != "statsd" {
+		if _, ok := statsdTagsFormat(f); !ok {
+			return errors.New("invalid metrics_report_statsd_format")
+		}
+	}
+	if c.MonitorSampleRatio < 1 {
+		return errors.New("invalid monitor_sample_ratio")
+	}
+	if c.TracingSampleRatio < 0 {
+		return errors.New("invalid tracing_sample_ratio")
+	}
+	if c.TracingExportPeriod < 0 {
+		return errors.New("invalid tracing_export_period")
+	}
+	if c.ProfilingPushInterval < 0 {
+		return errors.New("invalid profiling_push_interval")
+	}
+	if d := c.ProfilingCPUDuration.Duration(); d < time.Second || d > time.Duration(rpc.MaxProfileSeconds)*time.Second {
+		return errors.New("invalid profiling_cpu_duration")
+	}
+	if _, err := parseProfilingTypes(c.ProfilingTypes); err != nil {
+		return errors.New("invalid profiling_types")
+	}
 
 	if c.MaxDelayRefreshTimeInterval <= 0 {
 		return errors.New("max_delay_refresh_time_interval must be greater than 0")
@@ -0,0 +1,71 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// maxConfigChanges is the number of changes kept on the proxy, enough for
+// the dashboard to collect them as of Stats.ConfigVersion in time.
+const maxConfigChanges = 256
+
+// configLog records the changes of the runtime config on the proxy, which are
+// collected into the history of the product by the dashboard.
+type configLog struct {
+	sync.Mutex
+	version int64
+	changes []*models.ConfigChange
+}
+
+// SetConfig changes the config as of XCONFIG SET, and records the change with
+// the old and the new value if it succeeds.
+func (p *Proxy) SetConfig(key, value, who string) *redis.Resp {
+	p.configlog.Lock()
+	defer p.configlog.Unlock()
+
+	var old string
+	if resp := p.ConfigGet(key); resp != nil && resp.IsBulkBytes() {
+		old = string(resp.Value)
+	}
+	var resp = p.ConfigSet(key, value)
+	if resp.IsError() {
+		return resp
+	}
+	p.configlog.version++
+	p.configlog.changes = append(p.configlog.changes, &models.ConfigChange{
+		Seq:      p.configlog.version,
+		UnixTime: time.Now().Unix(),
+		Who:      who,
+		Proxy:    p.model.Token,
+		Key:      key, Old: old, New: value,
+	})
+	if n := len(p.configlog.changes) - maxConfigChanges; n > 0 {
+		p.configlog.changes = append([]*models.ConfigChange(nil), p.configlog.changes[n:]...)
+	}
+	return resp
+}
+
+func (p *Proxy) ConfigVersion() int64 {
+	p.configlog.Lock()
+	defer p.configlog.Unlock()
+	return p.configlog.version
+}
+
+// ConfigChanges returns the changes recorded after the version.
+func (p *Proxy) ConfigChanges(since int64) []*models.ConfigChange {
+	p.configlog.Lock()
+	defer p.configlog.Unlock()
+	var changes = []*models.ConfigChange{}
+	for _, c := range p.configlog.changes {
+		if c.Seq > since {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"time"
+
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// expired is the number of requests replied with TIMEOUT, because their
+// deadlines set by CLIENT DEADLINE were exceeded.
+var expired atomic2.Int64
+
+func (r *Request) IsExpired() bool {
+	return r.Deadline != 0 && time.Now().UnixNano() >= r.Deadline
+}
+
+// hasDeadline returns false for commands of transactions, which always wait
+// for their replies, to keep the state of the transaction consistent.
+func (r *Request) hasDeadline() bool {
+	if r.Deadline == 0 {
+		return false
+	}
+	switch r.OpStr {
+	case "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH":
+		return false
+	}
+	return true
+}
+
+// waitResponse waits for the replies of the request, and returns false if
+// its deadline is exceeded first. The replies received later are dropped,
+// and the request isn't coalesced.
+func (r *Request) waitResponse() bool {
+	if !r.hasDeadline() {
+		r.Batch.Wait()
+		return true
+	}
+	var done = make(chan struct{})
+	go func() {
+		r.Batch.Wait()
+		close(done)
+	}()
+	var timer = time.NewTimer(time.Duration(r.Deadline - time.Now().UnixNano()))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		select {
+		case <-done:
+			return true
+		default:
+		}
+		expired.Incr()
+		return false
+	}
+}
+
+func GetExpiredRequests() int64 {
+	return expired.Int64()
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+const FlushTokenTimeout = time.Second * 30
+
+// handleRequestFlush sends FLUSHALL/FLUSHDB to all groups if it has been
+// enabled by admin_flush_enabled. To avoid wiping data by mistake, the first
+// call only replies a token, and the command has to be resent by the same
+// session with CONFIRM <token> in time, e.g.
+//
+//	FLUSHALL ASYNC
+//	FLUSHALL ASYNC CONFIRM 5f3c9a1e
+func (s *Session) handleRequestFlush(r *Request, d *Router) error {
+	if !s.config.AdminFlushEnabled {
+		return fmt.Errorf("command '%s' is not allowed", r.OpStr)
+	}
+	var args = r.Multi[1:]
+	var token string
+	if n := len(args); n >= 2 && strings.ToUpper(string(args[n-2].Value)) == "CONFIRM" {
+		token, args = string(args[n-1].Value), args[:n-2]
+	}
+	switch {
+	case len(args) > 1:
+		r.Resp = redis.NewErrorf("ERR syntax error")
+		return nil
+	case len(args) == 1:
+		switch strings.ToUpper(string(args[0].Value)) {
+		case "ASYNC", "SYNC":
+		default:
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		}
+	}
+
+	var now = time.Now()
+	if token == "" || token != s.flush.token || now.After(s.flush.expire) {
+		s.flush.token = strconv.FormatUint(s.rand.Uint64(), 16)
+		s.flush.expire = now.Add(FlushTokenTimeout)
+		r.Resp = redis.NewErrorf("ERR %s requires confirmation, resend it with CONFIRM %s in %s",
+			r.OpStr, s.flush.token, FlushTokenTimeout)
+		return nil
+	}
+	s.flush.token = ""
+
+	var multi = append([]*redis.Resp{r.Multi[0]}, args...)
+	ids := d.backendSlots()
+	if len(ids) == 0 {
+		return ErrSlotIsNotReady
+	}
+	var sub = r.MakeSubRequest(len(ids))
+	for i := range sub {
+		sub[i].Multi = multi
+		if err := d.dispatchSlot(&sub[i], ids[i]); err != nil {
+			return err
+		}
+	}
+	r.Coalesce = func() error {
+		for i := range sub {
+			if err := sub[i].Err; err != nil {
+				return err
+			}
+			switch resp := sub[i].Resp; {
+			case resp == nil:
+				return ErrRespIsRequired
+			case resp.IsError() || r.Resp == nil:
+				r.Resp = resp
+			}
+		}
+		return nil
+	}
+	return nil
+}
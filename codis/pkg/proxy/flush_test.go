@@ -0,0 +1,56 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestAdminFlush(t *testing.T) {
+	var flushes atomic2.Int64
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		assert.Must(len(multi) == 2 && string(multi[1].Value) == "ASYNC")
+		flushes.Incr()
+		return redis.NewString([]byte("OK"))
+	}
+	b1 := newFakeBackend(handler)
+	defer b1.Close()
+	b2 := newFakeBackend(handler)
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(s.handleRequest(newTestRequest("FLUSHALL"), d) != nil)
+
+	enabled := config.AdminFlushEnabled
+	defer func() {
+		config.AdminFlushEnabled = enabled
+	}()
+	config.AdminFlushEnabled = true
+
+	resp := handleTestRequest(s, d, "FLUSHALL", "ASYNC")
+	assert.Must(resp.IsError() && strings.Contains(string(resp.Value), "CONFIRM"))
+	token := s.flush.token
+	assert.Must(token != "")
+
+	resp = handleTestRequest(s, d, "FLUSHALL", "ASYNC", "CONFIRM", "bad")
+	assert.Must(resp.IsError() && s.flush.token != token)
+	assert.Must(flushes.Int64() == 0)
+
+	token = s.flush.token
+	resp = handleTestRequest(s, d, "FLUSHDB", "ASYNC", "CONFIRM", token)
+	assert.Must(resp.IsString() && flushes.Int64() == 2)
+
+	// Tokens can't be reused.
+	assert.Must(handleTestRequest(s, d, "FLUSHDB", "ASYNC", "CONFIRM", token).IsError())
+	assert.Must(handleTestRequest(s, d, "FLUSHDB", "LAZY").IsError())
+	assert.Must(flushes.Int64() == 2)
+}
@@ -35,11 +35,14 @@ func (d *forwardSync) GetId() int {
 func (d *forwardSync) Forward(s *Slot, r *Request, hkey []byte) error {
 	s.lock.RLock()
 	bc, err := d.process(s, r, hkey)
+	hc := d.hedge(s, r, bc)
 	s.lock.RUnlock()
 	if err != nil {
 		return err
 	}
-	bc.PushBack(r)
+	if bc != nil {
+		pushBackHedged(bc, hc, r)
+	}
 	return nil
 }
 
@@ -49,6 +52,9 @@ func (d *forwardSync) process(s *Slot, r *Request, hkey []byte) (*BackendConn, e
 			s.id, hkey)
 		return nil, ErrSlotIsNotReady
 	}
+	if d.fenced(s, r) {
+		return nil, nil
+	}
 	if s.migrate.bc != nil && len(hkey) != 0 {
 		if err := d.slotsmgrt(s, hkey, r.Database, r.Seed16()); err != nil {
 			log.Debugf("slot-%04d migrate from = %s to %s failed: hash key = '%s', database = %d, error = %s",
@@ -56,9 +62,13 @@ func (d *forwardSync) process(s *Slot, r *Request, hkey []byte) (*BackendConn, e
 			return nil, err
 		}
 	}
+	bc := d.forward2(s, r)
+	if bc == nil {
+		return nil, ErrBackendIsBroken
+	}
 	r.Group = &s.refs
 	r.Group.Add(1)
-	return d.forward2(s, r), nil
+	return bc, nil
 }
 
 type forwardSemiAsync struct {
@@ -74,6 +84,7 @@ func (d *forwardSemiAsync) Forward(s *Slot, r *Request, hkey []byte) error {
 	for {
 		s.lock.RLock()
 		bc, retry, err := d.process(s, r, hkey)
+		hc := d.hedge(s, r, bc)
 		s.lock.RUnlock()
 
 		switch {
@@ -81,7 +92,7 @@ func (d *forwardSemiAsync) Forward(s *Slot, r *Request, hkey []byte) error {
 			return err
 		case !retry:
 			if bc != nil {
-				bc.PushBack(r)
+				pushBackHedged(bc, hc, r)
 			}
 			return nil
 		}
@@ -110,6 +121,9 @@ func (d *forwardSemiAsync) process(s *Slot, r *Request, hkey []byte) (_ *Backend
 			s.id, hkey)
 		return nil, false, ErrSlotIsNotReady
 	}
+	if d.fenced(s, r) {
+		return nil, false, nil
+	}
 	if s.migrate.bc != nil && len(hkey) != 0 {
 		resp, moved, err := d.slotsmgrtExecWrapper(s, hkey, r.Database, r.Seed16(), r.Multi)
 		switch {
@@ -126,9 +140,13 @@ func (d *forwardSemiAsync) process(s *Slot, r *Request, hkey []byte) (_ *Backend
 			return nil, true, nil
 		}
 	}
+	bc := d.forward2(s, r)
+	if bc == nil {
+		return nil, false, ErrBackendIsBroken
+	}
 	r.Group = &s.refs
 	r.Group.Add(1)
-	return d.forward2(s, r), false, nil
+	return bc, false, nil
 }
 
 type forwardHelper struct {
@@ -213,20 +231,44 @@ func (d *forwardHelper) slotsmgrtExecWrapper(s *Slot, hkey []byte, database int3
 	}
 }
 
+// fenced replies a retryable error to writes to a slot whose master is being
+// switched by the dashboard, so the old master doesn't accept writes that are
+// lost after the failover. Every path sending requests of slots to backends
+// checks it while holding the lock of the slot, i.e. process and
+// dispatchBatch.
+func (d *forwardHelper) fenced(s *Slot, r *Request) bool {
+	if !s.fenced || r.IsReadOnly() {
+		return false
+	}
+	r.Resp = redis.NewErrorf("TRYAGAIN slot-%04d is failing over, retry later", s.id)
+	return true
+}
+
+// forward2 returns nil if the circuit breaker of the master is open, and the
+// request can't be sent to the replicas.
 func (d *forwardHelper) forward2(s *Slot, r *Request) *BackendConn {
 	var database = r.Database
-	if s.migrate.bc == nil && !r.IsMasterOnly() && len(s.replicaGroups) != 0 {
-		var seed = r.Seed16()
-		for _, group := range s.replicaGroups {
-			var i = seed
-			for range group {
-				i = (i + 1) % uint(len(group))
-				if bc := group[i].BackendConn(database, seed, false, r.OpFlag.IsQuick()); bc != nil {
-					return bc
-				}
-			}
+	var replica = s.migrate.bc == nil && !r.IsMasterOnly() && len(s.replicaGroups) != 0
+	if replica && r.ReplicaRead {
+		if bc := d.forwardReplica(s, r); bc != nil {
+			return bc
 		}
 	}
+	if !s.backend.bc.breaker.allow() {
+		if replica && !r.ReplicaRead {
+			return d.forwardReplica(s, r)
+		}
+		return nil
+	}
 	//  fix:https://github.com/OpenAtomFoundation/pika/issues/2174
 	return s.backend.bc.BackendConn(database, uint(s.id), true, r.OpFlag.IsQuick())
 }
+
+func (d *forwardHelper) forwardReplica(s *Slot, r *Request) *BackendConn {
+	for _, group := range s.replicaGroups {
+		if bc := selectReplica(group, r); bc != nil {
+			return bc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestForwardFencedSlot(t *testing.T) {
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewString([]byte("OK"))
+	})
+	defer backend.Close()
+
+	d := NewRouter(config)
+	defer d.Close()
+	fill := func(fenced bool) {
+		for i := 0; i < models.GetMaxSlotNum(); i++ {
+			assert.MustNoError(d.FillSlot(&models.Slot{
+				Id: i, BackendAddr: backend.Addr(), Fenced: fenced,
+			}))
+		}
+	}
+	fill(true)
+	d.Start()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "SET", "key", "v")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "TRYAGAIN"))
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "OK")
+
+	// Writes of many keys in a slot are sent in a batch.
+	threshold := config.SessionBatchThreshold
+	defer func() {
+		config.SessionBatchThreshold = threshold
+	}()
+	config.SessionBatchThreshold = 2
+	resp = handleTestRequest(s, d, "DEL", "{k}1", "{k}2", "{k}3")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "TRYAGAIN"))
+
+	fill(false)
+	assert.Must(string(handleTestRequest(s, d, "SET", "key", "v").Value) == "OK")
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// functions keeps the libraries loaded through the proxy by name, so they
+// can be loaded into new groups as well.
+var functions struct {
+	sync.RWMutex
+	libs map[string][]byte
+}
+
+func init() {
+	functions.libs = make(map[string][]byte, 16)
+}
+
+// libraryName parses the name from the shebang of the library code, e.g.
+// "#!lua name=mylib".
+func libraryName(code []byte) string {
+	line := code
+	if i := bytes.IndexByte(code, '\n'); i >= 0 {
+		line = code[:i]
+	}
+	if !bytes.HasPrefix(line, []byte("#!")) {
+		return ""
+	}
+	for _, field := range strings.Fields(string(line[2:])) {
+		if strings.HasPrefix(field, "name=") {
+			return field[len("name="):]
+		}
+	}
+	return ""
+}
+
+func registerLibrary(code []byte) {
+	name := libraryName(code)
+	if name == "" {
+		return
+	}
+	functions.Lock()
+	defer functions.Unlock()
+	if _, ok := functions.libs[name]; ok || len(functions.libs) < MaxScriptRecords {
+		functions.libs[name] = append([]byte{}, code...)
+	}
+}
+
+func deleteLibrary(name string) {
+	functions.Lock()
+	defer functions.Unlock()
+	delete(functions.libs, name)
+}
+
+func allLibraries() [][]byte {
+	functions.RLock()
+	defer functions.RUnlock()
+	var all = make([][]byte, 0, len(functions.libs))
+	for _, code := range functions.libs {
+		all = append(all, code)
+	}
+	return all
+}
+
+func flushLibraries() {
+	functions.Lock()
+	defer functions.Unlock()
+	functions.libs = make(map[string][]byte, 16)
+}
+
+// loadLibraries loads all known libraries into the backend, like loadScripts.
+func loadLibraries(addr string, config *Config) error {
+	var cmds [][]*redis.Resp
+	for _, code := range allLibraries() {
+		cmds = append(cmds, []*redis.Resp{
+			redis.NewBulkBytes([]byte("FUNCTION")),
+			redis.NewBulkBytes([]byte("LOAD")),
+			redis.NewBulkBytes([]byte("REPLACE")),
+			redis.NewBulkBytes(code),
+		})
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+	c, err := dialBackend(addr, 0, config)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	replies, err := doCommands(c, cmds...)
+	if err != nil {
+		return err
+	}
+	for _, resp := range replies {
+		if resp.IsError() {
+			return fmt.Errorf("error resp: %s", resp.Value)
+		}
+	}
+	return nil
+}
+
+// handleRequestFunction sends FUNCTION LOAD/DELETE/FLUSH to every group, so
+// that FCALL works regardless of which group the keys belong to. FUNCTION
+// LIST is answered by one of the groups.
+func (s *Session) handleRequestFunction(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'FUNCTION' command")
+		return nil
+	}
+	switch sub := strings.ToUpper(string(r.Multi[1].Value)); {
+	case sub == "LOAD" && (len(r.Multi) == 3 || len(r.Multi) == 4):
+		var code = r.Multi[len(r.Multi)-1].Value
+		return s.broadcastScript(r, d, func(replies []*redis.Resp) *redis.Resp {
+			registerLibrary(code)
+			return replies[0]
+		})
+	case sub == "DELETE" && len(r.Multi) == 3:
+		var name = string(r.Multi[2].Value)
+		return s.broadcastScript(r, d, func(replies []*redis.Resp) *redis.Resp {
+			deleteLibrary(name)
+			return replies[0]
+		})
+	case sub == "FLUSH" && len(r.Multi) <= 3:
+		return s.broadcastScript(r, d, func(replies []*redis.Resp) *redis.Resp {
+			flushLibraries()
+			return replies[0]
+		})
+	case sub == "LIST":
+		return d.dispatch(r)
+	default:
+		r.Resp = redis.NewErrorf("ERR FUNCTION subcommand '%s' is not allowed", sub)
+		return nil
+	}
+}
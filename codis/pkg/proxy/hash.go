@@ -0,0 +1,244 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math/bits"
+
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+const (
+	HashModeCRC32    = "crc32"
+	HashModeCRC16    = "crc16"
+	HashModeXXHash64 = "xxhash64"
+	HashModeSipHash  = "siphash"
+)
+
+// HashFunc hashes the hash tag of keys, and slots are the hash values modulo
+// max_slot_num.
+type HashFunc interface {
+	Sum32(key []byte) uint32
+}
+
+var hashing = struct {
+	beg, end byte
+	fn       HashFunc
+}{beg: '{', end: '}', fn: crc32Hash{}}
+
+// SetHashTag sets the characters delimiting the hash tag of keys. It must be
+// called before any key is hashed.
+func SetHashTag(beg, end byte) {
+	hashing.beg, hashing.end = beg, end
+}
+
+// SetHashFunc sets the hash function of keys. It must be called before any
+// key is hashed.
+func SetHashFunc(fn HashFunc) {
+	hashing.fn = fn
+}
+
+// NewHashFunc returns the hash function of the mode. The key is required by
+// siphash only, which must be 16 bytes.
+func NewHashFunc(mode string, key []byte) (HashFunc, error) {
+	switch mode {
+	case "", HashModeCRC32:
+		return crc32Hash{}, nil
+	case HashModeCRC16:
+		return crc16Hash{}, nil
+	case HashModeXXHash64:
+		return xxhash64Hash{}, nil
+	case HashModeSipHash:
+		if len(key) != 16 {
+			return nil, errors.New("siphash requires a key of 16 bytes")
+		}
+		return sipHash{
+			k0: binary.LittleEndian.Uint64(key[0:8]),
+			k1: binary.LittleEndian.Uint64(key[8:16]),
+		}, nil
+	}
+	return nil, errors.Errorf("invalid hash mode %q", mode)
+}
+
+func Hash(key []byte) uint32 {
+	return hashing.fn.Sum32(hashTag(key))
+}
+
+// hashTag returns the part of the key that is hashed, i.e. its hash tag, or
+// the whole key if it has none.
+func hashTag(key []byte) []byte {
+	if beg := bytes.IndexByte(key, hashing.beg); beg >= 0 {
+		if end := bytes.IndexByte(key[beg+1:], hashing.end); end > 0 || (end == 0 && !isCRC16(hashing.fn)) {
+			return key[beg+1 : beg+1+end]
+		}
+	}
+	return key
+}
+
+// isCRC16 is true if keys are hashed as in redis cluster, which ignores empty
+// hash tags.
+func isCRC16(fn HashFunc) bool {
+	_, ok := fn.(crc16Hash)
+	return ok
+}
+
+type crc32Hash struct{}
+
+func (crc32Hash) Sum32(key []byte) uint32 {
+	return crc32.ChecksumIEEE(key)
+}
+
+type crc16Hash struct{}
+
+func (crc16Hash) Sum32(key []byte) uint32 {
+	return uint32(crc16(key))
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) used by redis cluster.
+func crc16(key []byte) uint16 {
+	var crc uint16
+	for _, c := range key {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+type xxhash64Hash struct{}
+
+func (xxhash64Hash) Sum32(key []byte) uint32 {
+	return uint32(xxhash64(key))
+}
+
+var (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+// xxhash64 is XXH64 with seed 0.
+func xxhash64(b []byte) uint64 {
+	var n = len(b)
+	var h uint64
+	if n >= 32 {
+		v1 := xxPrime1 + xxPrime2
+		v2 := xxPrime2
+		v3 := uint64(0)
+		v4 := -xxPrime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:32]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+type sipHash struct {
+	k0, k1 uint64
+}
+
+func (s sipHash) Sum32(key []byte) uint32 {
+	return uint32(siphash(s.k0, s.k1, key))
+}
+
+// siphash is SipHash-2-4 with the 128-bit key k0, k1.
+func siphash(k0, k1 uint64, b []byte) uint64 {
+	var v0 = k0 ^ 0x736f6d6570736575
+	var v1 = k1 ^ 0x646f72616e646f6d
+	var v2 = k0 ^ 0x6c7967656e657261
+	var v3 = k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+
+	var n = len(b)
+	for ; len(b) >= 8; b = b[8:] {
+		m := binary.LittleEndian.Uint64(b[:8])
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+	var m = uint64(n) << 56
+	for i, c := range b {
+		m |= uint64(c) << (8 * uint(i))
+	}
+	v3 ^= m
+	round()
+	round()
+	v0 ^= m
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
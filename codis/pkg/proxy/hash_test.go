@@ -0,0 +1,48 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestXXHash64(t *testing.T) {
+	for s, h := range map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+		"Nobody inspects the spammish repetition": 0xfbcea83c8a378bf1,
+	} {
+		assert.Must(xxhash64([]byte(s)) == h)
+	}
+}
+
+func TestSipHash(t *testing.T) {
+	var key, msg []byte
+	for i := 0; i < 16; i++ {
+		key = append(key, byte(i))
+	}
+	for i := 0; i < 15; i++ {
+		msg = append(msg, byte(i))
+	}
+	fn, err := NewHashFunc(HashModeSipHash, key)
+	assert.MustNoError(err)
+	s := fn.(sipHash)
+	assert.Must(siphash(s.k0, s.k1, nil) == 0x726fdb47dd0e0e31)
+	assert.Must(siphash(s.k0, s.k1, msg) == 0xa129ca6149be45e5)
+
+	_, err = NewHashFunc(HashModeSipHash, nil)
+	assert.Must(err != nil)
+	_, err = NewHashFunc("md5", nil)
+	assert.Must(err != nil)
+}
+
+func TestHashFunc(t *testing.T) {
+	SetHashFunc(xxhash64Hash{})
+	defer SetHashFunc(crc32Hash{})
+	assert.Must(Hash([]byte("{user}1")) == Hash([]byte("user")))
+	assert.Must(Hash([]byte("user")) == uint32(xxhash64([]byte("user"))))
+}
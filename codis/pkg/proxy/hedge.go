@@ -0,0 +1,163 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+const hedgeBucketNum = 32
+
+// hedgeStats is a histogram of the round trip time of quick reads, by powers
+// of 2 of microseconds, from which the delay before a read is hedged to a
+// replica is taken at backend_hedge_percentile.
+var hedgeStats struct {
+	percentile atomic2.Int64
+	budget     atomic2.Int64
+
+	buckets [hedgeBucketNum]atomic2.Int64
+	samples atomic2.Int64
+
+	HedgedReads atomic2.Int64
+}
+
+const (
+	hedgeMinSamples = 100
+	hedgeMaxSamples = 4096
+)
+
+func SetHedgePercentile(p int64) {
+	if p < 0 || p >= 100 {
+		return
+	}
+	if hedgeStats.percentile.Swap(p) == p {
+		return
+	}
+	for i := range hedgeStats.buckets {
+		hedgeStats.buckets[i].Set(0)
+	}
+	hedgeStats.samples.Set(0)
+	hedgeStats.budget.Set(0)
+}
+
+func hedgeBudget() time.Duration {
+	if hedgeStats.percentile.Int64() == 0 {
+		return 0
+	}
+	return time.Duration(hedgeStats.budget.Int64())
+}
+
+// recordHedgeSample adds the round trip time of a quick read, the budget is
+// updated every hedgeMaxSamples samples, then the histogram decays by half.
+func recordHedgeSample(d time.Duration) {
+	p := hedgeStats.percentile.Int64()
+	if p == 0 || d <= 0 {
+		return
+	}
+	var i int
+	for us := int64(d / time.Microsecond); us > 1 && i < hedgeBucketNum-1; us >>= 1 {
+		i++
+	}
+	hedgeStats.buckets[i].Incr()
+	switch n := hedgeStats.samples.Incr(); {
+	case n == hedgeMinSamples && hedgeStats.budget.Int64() == 0:
+		updateHedgeBudget(p, n)
+	case n >= hedgeMaxSamples:
+		if hedgeStats.samples.CompareAndSwap(n, n/2) {
+			updateHedgeBudget(p, n)
+			for i := range hedgeStats.buckets {
+				hedgeStats.buckets[i].Set(hedgeStats.buckets[i].Int64() / 2)
+			}
+		}
+	}
+}
+
+func updateHedgeBudget(p, n int64) {
+	var sum, rank = int64(0), n * p / 100
+	for i := range hedgeStats.buckets {
+		if sum += hedgeStats.buckets[i].Int64(); sum >= rank {
+			hedgeStats.budget.Set(int64(time.Microsecond) << uint(i+1))
+			return
+		}
+	}
+}
+
+// hedge returns another replica of the replica group of bc to send a second
+// request to if the request of a quick read sent to a replica isn't answered
+// within the budget. Reads sent to the master aren't hedged, since sessions
+// reading from the master may not read stale values from replicas.
+func (d *forwardHelper) hedge(s *Slot, r *Request, bc *BackendConn) *BackendConn {
+	switch {
+	case bc == nil || r.Batch == nil || hedgeBudget() == 0:
+		return nil
+	case !r.IsQuick() || !r.IsReadOnly() || r.IsMasterOnly() || r.MasterRead || !r.ReplicaRead:
+		return nil
+	case s.migrate.bc != nil || s.backend.bc == nil || bc.Addr() == s.backend.bc.Addr():
+		return nil
+	}
+	for _, group := range s.replicaGroups {
+		var others = make([]*sharedBackendConn, 0, len(group))
+		for _, replica := range group {
+			if replica.Addr() != bc.Addr() {
+				others = append(others, replica)
+			}
+		}
+		if len(others) == len(group) {
+			continue
+		}
+		if len(others) != 0 {
+			return selectReplica(others, r)
+		}
+		return nil
+	}
+	return nil
+}
+
+// pushBackHedged sends the request to bc, and to hc as well if bc doesn't
+// answer within the budget, the first successful response wins.
+func pushBackHedged(bc, hc *BackendConn, r *Request) {
+	if hc == nil {
+		bc.PushBack(r)
+		return
+	}
+	var sub = r.MakeSubRequest(2)
+	for i := range sub {
+		sub[i].Multi = r.Multi
+		sub[i].Batch = &sync.WaitGroup{}
+	}
+	sub[0].Group, r.Group = r.Group, nil
+
+	r.Batch.Add(1)
+	bc.PushBack(&sub[0])
+
+	go func() {
+		var done = make(chan *Request, len(sub))
+		var wait = func(x *Request) {
+			x.Batch.Wait()
+			done <- x
+		}
+		go wait(&sub[0])
+
+		var timer = time.NewTimer(hedgeBudget())
+		defer timer.Stop()
+
+		var x *Request
+		select {
+		case x = <-done:
+		case <-timer.C:
+			hedgeStats.HedgedReads.Incr()
+			hc.PushBack(&sub[1])
+			go wait(&sub[1])
+			if x = <-done; x.Err != nil {
+				x = <-done
+			}
+		}
+		r.Resp, r.Err = x.Resp, x.Err
+		r.leaveFlight()
+		r.Batch.Done()
+	}()
+}
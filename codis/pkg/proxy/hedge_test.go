@@ -0,0 +1,96 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestHedgeBudget(t *testing.T) {
+	defer SetHedgePercentile(0)
+	SetHedgePercentile(90)
+	for i := 0; i < hedgeMinSamples; i++ {
+		if i%10 == 0 {
+			recordHedgeSample(time.Millisecond * 10)
+		} else {
+			recordHedgeSample(time.Microsecond * 100)
+		}
+	}
+	assert.Must(hedgeBudget() == time.Microsecond*128)
+	SetHedgePercentile(0)
+	assert.Must(hedgeBudget() == 0)
+}
+
+func TestHedgedRead(t *testing.T) {
+	var backends = make([]*fakeBackend, 3)
+	for i, name := range []string{"primary", "slow", "fast"} {
+		var value = []byte(name)
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			if string(value) != "fast" && string(multi[0].Value) == "GET" {
+				time.Sleep(time.Millisecond * 100)
+			}
+			return redis.NewBulkBytes(value)
+		})
+		defer backends[i].Close()
+	}
+
+	mode := config.SessionReplicaRead
+	defer func() {
+		config.SessionReplicaRead = mode
+	}()
+	config.SessionReplicaRead = ReplicaReadOnly
+
+	assert.MustNoError(setCmdListFlag("get", FlagQuick))
+	defer setCmdListFlag(config.QuickCmdList, FlagQuick)
+	defer SetHedgePercentile(0)
+	SetHedgePercentile(99)
+	hedgeStats.budget.Set(int64(time.Millisecond * 5))
+	policy := config.BackendReplicaPolicy
+	defer func() {
+		config.BackendReplicaPolicy = policy
+	}()
+	config.BackendReplicaPolicy = ReplicaPolicyRoundRobin
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: backends[0].Addr(),
+			ReplicaGroups: [][]string{{backends[1].Addr(), backends[2].Addr()}},
+		}))
+	}
+	d.Start()
+
+	// Reads of sessions reading from the master aren't hedged to replicas.
+	s := newTestSession()
+	var hedged = hedgeStats.HedgedReads.Int64()
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "primary")
+	assert.Must(hedgeStats.HedgedReads.Int64() == hedged)
+
+	// Reads sent to the slow replica, which the round robin starts at, are
+	// hedged to the other one.
+	assert.Must(handleTestRequest(s, d, "READONLY").IsString())
+	for _, b := range backends[1:] {
+		for i := 0; !d.pool.replica.Get(b.Addr()).isWarm(); i++ {
+			assert.Must(i < 100)
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+	hedged = hedgeStats.HedgedReads.Int64()
+	for i := 0; i < 4; i++ {
+		d.pool.replica.next.Set(-1)
+		assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "fast")
+	}
+	assert.Must(hedgeStats.HedgedReads.Int64() == hedged+4)
+
+	assert.Must(handleTestRequest(s, d, "READWRITE").IsString())
+	hedged = hedgeStats.HedgedReads.Int64()
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "primary")
+	assert.Must(hedgeStats.HedgedReads.Int64() == hedged)
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"math/bits"
+	"time"
+
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// The buckets of latencyHistogram are log-linear like HdrHistogram, each
+// power of two is divided into histSubCount sub-buckets, so the error of the
+// values is less than 1/histSubCount, and values are exact below that.
+const (
+	histSubBits   = 4
+	histSubCount  = 1 << histSubBits
+	histMaxBits   = 30
+	histBucketNum = (histMaxBits - histSubBits + 1) * histSubCount
+	histMaxValue  = 1<<histMaxBits - 1
+)
+
+// latencyHistogram counts the latencies in microseconds, up to histMaxValue,
+// which is about 18 minutes. There is one for each command, shared by all the
+// intervals, which are refreshed together.
+type latencyHistogram struct {
+	counts [histBucketNum]atomic2.Int64
+}
+
+func histIndex(v int64) int {
+	switch {
+	case v < 0:
+		return 0
+	case v > histMaxValue:
+		v = histMaxValue
+	}
+	if v < histSubCount {
+		return int(v)
+	}
+	var shift = bits.Len64(uint64(v)) - histSubBits - 1
+	return (shift+1)*histSubCount + int(v>>uint(shift)) - histSubCount
+}
+
+// histValue returns the highest value of the bucket.
+func histValue(index int) int64 {
+	if index < histSubCount {
+		return int64(index)
+	}
+	var shift = index/histSubCount - 1
+	var m = int64(index%histSubCount + histSubCount)
+	return (m+1)<<uint(shift) - 1
+}
+
+// record counts the latency given in nanoseconds.
+func (h *latencyHistogram) record(duration int64) {
+	h.counts[histIndex(duration/1e3)].Incr()
+}
+
+func (h *latencyHistogram) reset() {
+	for i := range h.counts {
+		h.counts[i].Set(0)
+	}
+}
+
+// percentiles returns the values of the quantiles in microseconds in ascending
+// order, or zeros if nothing is recorded.
+func (h *latencyHistogram) percentiles(quantiles ...float64) []int64 {
+	var counts [histBucketNum]int64
+	var total int64
+	for i := range h.counts {
+		counts[i] = h.counts[i].Int64()
+		total += counts[i]
+	}
+	var values = make([]int64, len(quantiles))
+	if total == 0 {
+		return values
+	}
+	var i, count = 0, counts[0]
+	for j, q := range quantiles {
+		var rank = int64(q*float64(total) + 0.5)
+		if rank < 1 {
+			rank = 1
+		}
+		for count < rank && i < histBucketNum-1 {
+			i++
+			count += counts[i]
+		}
+		values[j] = histValue(i)
+	}
+	return values
+}
+
+// latencyBuckets are the upper bounds of the buckets of the latency histogram
+// of commands exported to Prometheus, the counts of the buckets are not
+// cumulative in opStats.
+var latencyBuckets = [...]time.Duration{
+	time.Microsecond * 500,
+	time.Millisecond * 1,
+	time.Millisecond * 2,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 20,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 200,
+	time.Millisecond * 500,
+	time.Second * 1,
+	time.Second * 2,
+	time.Second * 5,
+}
+
+func (s *opStats) observe(duration int64) {
+	for i, b := range latencyBuckets {
+		if duration <= int64(b) {
+			s.buckets[i].Incr()
+			return
+		}
+	}
+}
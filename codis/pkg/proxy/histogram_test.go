@@ -0,0 +1,58 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	for i := 0; i < histBucketNum; i++ {
+		v := histValue(i)
+		assert.Must(histIndex(v) == i)
+		assert.Must(histIndex(v+1) == i+1 || i == histBucketNum-1)
+	}
+	for _, v := range []int64{0, 1, 15, 16, 17, 100, 999, 1000, 12345, 1e6, 3e8, histMaxValue} {
+		var ceil = histValue(histIndex(v))
+		assert.Must(ceil >= v && ceil-v <= v/histSubCount)
+	}
+	assert.Must(histIndex(-1) == 0)
+	assert.Must(histIndex(histMaxValue+1) == histBucketNum-1)
+}
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	var h = &latencyHistogram{}
+	assert.Must(h.percentiles(0.5)[0] == 0)
+
+	for i := 1; i <= 1000; i++ {
+		h.record(int64(time.Microsecond * 10 * time.Duration(i)))
+	}
+	var values = h.percentiles(0.5, 0.99, 0.999, 1)
+	for i, want := range []int64{5000, 9900, 9990, 10000} {
+		assert.Must(values[i] >= want && values[i]-want <= want/histSubCount)
+	}
+
+	h.reset()
+	for i := 0; i < 100; i++ {
+		h.record(int64(time.Millisecond * 15))
+	}
+	h.record(int64(time.Second * 2))
+	values = h.percentiles(0.5, 0.99, 1)
+	assert.Must(values[0] == values[1] && values[0] >= 15000 && values[0]-15000 <= 15000/histSubCount)
+	assert.Must(values[2] >= 2e6 && values[2]-2e6 <= 2e6/histSubCount)
+
+	var d = &delayInfo{}
+	d.calls.Set(2)
+	d.refreshTpInfo([]int64{800, 2500, 2500, 2500, 2500, 2500})
+	assert.Must(d.tpus[0] == 800)
+	assert.Must(d.tp(0) == 1)
+	assert.Must(d.tp(5) == 3)
+
+	d.resetTpInfo()
+	d.refreshTpInfo(make([]int64, len(TPQuantiles)))
+	assert.Must(d.tpus[0] == 0 && d.tp(5) == 0)
+}
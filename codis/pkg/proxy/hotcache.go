@@ -0,0 +1,366 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"hash/crc32"
+	"strconv"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// hotCacheEntry is the reply of a read command of a hot key. It's pending
+// until the reply is received, and the reply is dropped if the entry has been
+// invalidated, or the epoch of the key bumped, by a write in the meantime. A
+// pending entry expires as well, in case the reply is never received, e.g.
+// the session is closed.
+type hotCacheEntry struct {
+	resp   *redis.Resp
+	expire int64
+	epoch  int64
+}
+
+// hotCache holds the replies of read commands of the hot keys reported by
+// the sampler, indexed by the database and key, and then by the command.
+var hotCache struct {
+	sync.Mutex
+	keys    map[string]map[string]*hotCacheEntry
+	entries int
+
+	size   atomic2.Int64
+	ttl    atomic2.Int64
+	minqps atomic2.Int64
+
+	hits, misses atomic2.Int64
+
+	// epochs are bumped by the writes of the keys hashed to them, both when
+	// the writes are dispatched and when their replies are received.
+	epochs [64]atomic2.Int64
+}
+
+func hotCacheEpoch(k string) *atomic2.Int64 {
+	return &hotCache.epochs[crc32.ChecksumIEEE([]byte(k))%uint32(len(hotCache.epochs))]
+}
+
+// SetHotKeyCache sets the max number of entries and the TTL of the cache, and
+// the min QPS of the keys cached, zero size disables it. The entries cached
+// are dropped.
+func SetHotKeyCache(size int, ttl time.Duration, minqps int64) {
+	hotCache.Lock()
+	defer hotCache.Unlock()
+	hotCache.keys = make(map[string]map[string]*hotCacheEntry)
+	hotCache.entries = 0
+	hotCache.size.Set(int64(size))
+	hotCache.ttl.Set(int64(ttl))
+	hotCache.minqps.Set(minqps)
+}
+
+const hotCachePendingTimeout = time.Second * 10
+
+func hotCacheKey(db int32, key []byte) string {
+	return strconv.Itoa(int(db)) + ":" + string(key)
+}
+
+func hotCacheCmd(multi []*redis.Resp) string {
+	var b []byte
+	for _, m := range multi {
+		b = strconv.AppendInt(b, int64(len(m.Value)), 10)
+		b = append(b, ':')
+		b = append(b, m.Value...)
+	}
+	return string(b)
+}
+
+// isHotCacheable returns true if the reply of the request may be cached,
+// i.e. a read command replying values of a hot key. The replies of the random
+// members, e.g. HRANDFIELD, are never cached.
+func isHotCacheable(r *Request, key []byte) bool {
+	if hotCache.size.Int64() <= 0 || len(key) == 0 || r.Namespace != "" {
+		return false
+	}
+	if !r.IsReadOnly() || !(r.IsRespReturnSingleValue() || r.IsRespReturnArray()) {
+		return false
+	}
+	switch r.OpStr {
+	case "HRANDFIELD", "SRANDMEMBER", "ZRANDMEMBER":
+		return false
+	}
+	return isHotKey(key, hotCache.minqps.Int64())
+}
+
+// lookupHotCache returns the reply cached of the request. On a miss, it adds
+// a pending entry, and returns the function to fill it, which should be set
+// by setHotCacheFill once the request is dispatched.
+func lookupHotCache(r *Request) (*redis.Resp, func()) {
+	var key = getHashKey(r.Multi, r.OpStr)
+	if !isHotCacheable(r, key) {
+		return nil, nil
+	}
+	var k, cmd = hotCacheKey(r.Database, key), hotCacheCmd(r.Multi)
+	var now = time.Now().UnixNano()
+
+	hotCache.Lock()
+	defer hotCache.Unlock()
+	if e := hotCache.keys[k][cmd]; e != nil {
+		switch {
+		case now >= e.expire:
+			delete(hotCache.keys[k], cmd)
+			hotCache.entries--
+		case e.resp != nil:
+			hotCache.hits.Incr()
+			return e.resp, nil
+		default:
+			// The entry is being filled by another request.
+			hotCache.misses.Incr()
+			return nil, nil
+		}
+	}
+	hotCache.misses.Incr()
+	if hotCache.entries >= int(hotCache.size.Int64()) && !purgeHotCache(now) {
+		return nil, nil
+	}
+	var e = &hotCacheEntry{expire: now + int64(hotCachePendingTimeout), epoch: hotCacheEpoch(k).Int64()}
+	if hotCache.keys[k] == nil {
+		hotCache.keys[k] = make(map[string]*hotCacheEntry)
+	}
+	hotCache.keys[k][cmd] = e
+	hotCache.entries++
+	return nil, func() {
+		fillHotCache(k, cmd, e, r)
+	}
+}
+
+// setHotCacheFill fills the entry with the reply, after the coalescing of
+// the request if any.
+func setHotCacheFill(r *Request, fill func()) {
+	var coalesce = r.Coalesce
+	r.Coalesce = func() error {
+		if coalesce != nil {
+			if err := coalesce(); err != nil {
+				return err
+			}
+		}
+		fill()
+		return nil
+	}
+}
+
+func fillHotCache(k, cmd string, e *hotCacheEntry, r *Request) {
+	hotCache.Lock()
+	defer hotCache.Unlock()
+	if hotCache.keys[k][cmd] != e {
+		return
+	}
+	if r.Err != nil || r.Resp == nil || r.Resp.IsError() || hotCacheEpoch(k).Int64() != e.epoch {
+		delete(hotCache.keys[k], cmd)
+		hotCache.entries--
+		return
+	}
+	e.resp = r.Resp
+	e.expire = time.Now().UnixNano() + hotCache.ttl.Int64()
+}
+
+// purgeHotCache removes the entries expired, and returns false if the cache
+// is still full. It must be called with the lock held.
+func purgeHotCache(now int64) bool {
+	for k, m := range hotCache.keys {
+		for cmd, e := range m {
+			if now >= e.expire {
+				delete(m, cmd)
+				hotCache.entries--
+			}
+		}
+		if len(m) == 0 {
+			delete(hotCache.keys, k)
+		}
+	}
+	return hotCache.entries < int(hotCache.size.Int64())
+}
+
+// invalidateHotCache removes the entries of any key of the commands, which
+// are writes. The entries pending are removed as well, so that the replies
+// read before the writes are not cached. It's called when the writes are
+// dispatched, and again by setHotCacheInvalidate when their replies are
+// received, for the reads dispatched in between.
+func invalidateHotCache(db int32, multis ...[]*redis.Resp) {
+	invalidateNegativeCache(db, multis...)
+	invalidateFlights(db, multis...)
+	if hotCache.size.Int64() <= 0 {
+		return
+	}
+	hotCache.Lock()
+	defer hotCache.Unlock()
+	for _, multi := range multis {
+		for i := 1; i < len(multi); i++ {
+			var k = hotCacheKey(db, multi[i].Value)
+			hotCacheEpoch(k).Incr()
+			if m := hotCache.keys[k]; m != nil {
+				hotCache.entries -= len(m)
+				delete(hotCache.keys, k)
+			}
+		}
+	}
+}
+
+// clearHotCache removes all entries, e.g. for FLUSHALL.
+func clearHotCache() {
+	clearNegativeCache()
+	clearFlights()
+	if hotCache.size.Int64() <= 0 {
+		return
+	}
+	hotCache.Lock()
+	defer hotCache.Unlock()
+	for i := range hotCache.epochs {
+		hotCache.epochs[i].Incr()
+	}
+	hotCache.keys = make(map[string]map[string]*hotCacheEntry)
+	hotCache.entries = 0
+}
+
+// setHotCacheInvalidate invalidates the caches again once the reply of the
+// write is received, after the coalescing of the request if any.
+func setHotCacheInvalidate(r *Request, invalidate func()) {
+	var coalesce = r.Coalesce
+	r.Coalesce = func() error {
+		defer invalidate()
+		if coalesce != nil {
+			return coalesce()
+		}
+		return nil
+	}
+}
+
+// negCache holds the nil replies of GET of missing keys, to protect backends
+// from the lookups of nonexistent keys repeated. The replies read before any
+// write through the proxy is dispatched, or its reply is received, are
+// dropped, so that there is no pending entry.
+var negCache struct {
+	sync.RWMutex
+	keys map[string]*hotCacheEntry
+
+	size atomic2.Int64
+	ttl  atomic2.Int64
+
+	writes atomic2.Int64
+	hits   atomic2.Int64
+}
+
+// SetNegativeCache sets the max number of entries and the TTL of the cache,
+// zero size disables it. The entries cached are dropped.
+func SetNegativeCache(size int, ttl time.Duration) {
+	negCache.Lock()
+	defer negCache.Unlock()
+	negCache.keys = make(map[string]*hotCacheEntry)
+	negCache.size.Set(int64(size))
+	negCache.ttl.Set(int64(ttl))
+}
+
+// lookupNegativeCache returns the nil reply cached of GET. On a miss, it
+// returns the function to fill the entry if the reply is nil.
+func lookupNegativeCache(r *Request) (*redis.Resp, func()) {
+	if negCache.size.Int64() <= 0 || r.OpStr != "GET" || len(r.Multi) != 2 || r.Namespace != "" {
+		return nil, nil
+	}
+	var k = hotCacheKey(r.Database, r.Multi[1].Value)
+	var now = time.Now().UnixNano()
+
+	negCache.RLock()
+	var e = negCache.keys[k]
+	negCache.RUnlock()
+	if e != nil && now < e.expire {
+		negCache.hits.Incr()
+		return e.resp, nil
+	}
+	var writes = negCache.writes.Int64()
+	return nil, func() {
+		fillNegativeCache(k, writes, r)
+	}
+}
+
+func fillNegativeCache(k string, writes int64, r *Request) {
+	if r.Err != nil || r.Resp == nil || !(r.Resp.IsBulkBytes() && r.Resp.Value == nil || r.Resp.IsNull()) {
+		return
+	}
+	var now = time.Now().UnixNano()
+	negCache.Lock()
+	defer negCache.Unlock()
+	if negCache.writes.Int64() != writes {
+		return
+	}
+	if len(negCache.keys) >= int(negCache.size.Int64()) {
+		for x, e := range negCache.keys {
+			if now >= e.expire {
+				delete(negCache.keys, x)
+			}
+		}
+		if len(negCache.keys) >= int(negCache.size.Int64()) {
+			return
+		}
+	}
+	negCache.keys[k] = &hotCacheEntry{resp: r.Resp, expire: now + negCache.ttl.Int64()}
+}
+
+func invalidateNegativeCache(db int32, multis ...[]*redis.Resp) {
+	if negCache.size.Int64() <= 0 {
+		return
+	}
+	negCache.writes.Incr()
+	negCache.Lock()
+	defer negCache.Unlock()
+	for _, multi := range multis {
+		for i := 1; i < len(multi) && len(negCache.keys) != 0; i++ {
+			delete(negCache.keys, hotCacheKey(db, multi[i].Value))
+		}
+	}
+}
+
+func clearNegativeCache() {
+	if negCache.size.Int64() <= 0 {
+		return
+	}
+	negCache.writes.Incr()
+	negCache.Lock()
+	defer negCache.Unlock()
+	negCache.keys = make(map[string]*hotCacheEntry)
+}
+
+type HotKeyCacheStats struct {
+	Entries int64 `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+type NegativeCacheStats struct {
+	Entries int64 `json:"entries"`
+	Hits    int64 `json:"hits"`
+}
+
+func GetNegativeCacheStats() *NegativeCacheStats {
+	if negCache.size.Int64() <= 0 {
+		return nil
+	}
+	negCache.RLock()
+	defer negCache.RUnlock()
+	return &NegativeCacheStats{
+		Entries: int64(len(negCache.keys)),
+		Hits:    negCache.hits.Int64(),
+	}
+}
+
+func GetHotKeyCacheStats() *HotKeyCacheStats {
+	if hotCache.size.Int64() <= 0 {
+		return nil
+	}
+	hotCache.Lock()
+	defer hotCache.Unlock()
+	return &HotKeyCacheStats{
+		Entries: int64(hotCache.entries),
+		Hits:    hotCache.hits.Int64(),
+		Misses:  hotCache.misses.Int64(),
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestHotKeyCache(t *testing.T) {
+	SetHotKeyCache(16, time.Millisecond*100, 100)
+	defer SetHotKeyCache(0, 0, 0)
+	hotKeySet.Store(map[string]int64{"hot": 100, "warm": 99})
+	defer hotKeySet.Store(map[string]int64{})
+
+	var reads atomic2.Int64
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		switch string(multi[0].Value) {
+		case "GET":
+			reads.Incr()
+			return redis.NewBulkBytes([]byte("value"))
+		case "HRANDFIELD":
+			reads.Incr()
+			return redis.NewBulkBytes([]byte("field"))
+		}
+		return redis.NewString([]byte("OK"))
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	var hits = hotCache.hits.Int64()
+	s := newTestSession()
+	for i := 0; i < 3; i++ {
+		assert.Must(string(handleTestRequest(s, d, "GET", "hot").Value) == "value")
+		assert.Must(string(handleTestRequest(s, d, "GET", "cold").Value) == "value")
+	}
+	assert.Must(reads.Int64() == 4)
+	assert.Must(GetHotKeyCacheStats().Hits-hits == 2)
+
+	// Keys read less than hotkey_cache_min_qps, and random members, aren't cached.
+	for i := 0; i < 2; i++ {
+		assert.Must(string(handleTestRequest(s, d, "GET", "warm").Value) == "value")
+		assert.Must(string(handleTestRequest(s, d, "HRANDFIELD", "hot").Value) == "field")
+	}
+	assert.Must(reads.Int64() == 8)
+
+	assert.Must(handleTestRequest(s, d, "SET", "hot", "v").IsString())
+	assert.Must(string(handleTestRequest(s, d, "GET", "hot").Value) == "value")
+	assert.Must(reads.Int64() == 9)
+
+	time.Sleep(time.Millisecond * 150)
+	assert.Must(string(handleTestRequest(s, d, "GET", "hot").Value) == "value")
+	assert.Must(reads.Int64() == 10)
+
+	// The reply read before the write isn't cached.
+	clearHotCache()
+	r := newTestRequest("GET", "hot")
+	assert.MustNoError(s.handleRequest(r, d))
+	invalidateHotCache(0, newTestRequest("DEL", "hot").Multi)
+	_, err := s.handleResponse(r)
+	assert.MustNoError(err)
+	assert.Must(GetHotKeyCacheStats().Entries == 0 && reads.Int64() == 11)
+
+	// The reply read before the reply of the write isn't cached either.
+	w := newTestRequest("SET", "hot", "v")
+	assert.MustNoError(s.handleRequest(w, d))
+	assert.Must(string(handleTestRequest(s, d, "GET", "hot").Value) == "value")
+	assert.Must(GetHotKeyCacheStats().Entries == 1)
+	_, err = s.handleResponse(w)
+	assert.MustNoError(err)
+	assert.Must(GetHotKeyCacheStats().Entries == 0)
+}
+
+func TestNegativeCache(t *testing.T) {
+	SetNegativeCache(2, time.Millisecond*100)
+	defer SetNegativeCache(0, 0)
+
+	var reads atomic2.Int64
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		if string(multi[0].Value) != "GET" {
+			return redis.NewString([]byte("OK"))
+		}
+		reads.Incr()
+		if string(multi[1].Value) == "found" {
+			return redis.NewBulkBytes([]byte("value"))
+		}
+		return redis.NewBulkBytes(nil)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	for i := 0; i < 3; i++ {
+		assert.Must(handleTestRequest(s, d, "GET", "missing").Value == nil)
+		assert.Must(string(handleTestRequest(s, d, "GET", "found").Value) == "value")
+	}
+	assert.Must(reads.Int64() == 4 && GetNegativeCacheStats().Entries == 1)
+
+	assert.Must(handleTestRequest(s, d, "SET", "missing", "v").IsString())
+	assert.Must(GetNegativeCacheStats().Entries == 0)
+	assert.Must(handleTestRequest(s, d, "GET", "missing").Value == nil)
+	assert.Must(reads.Int64() == 5)
+
+	// The reply read before the write isn't cached.
+	r := newTestRequest("GET", "other")
+	assert.MustNoError(s.handleRequest(r, d))
+	invalidateHotCache(0, newTestRequest("SET", "x", "v").Multi)
+	_, err := s.handleResponse(r)
+	assert.MustNoError(err)
+	assert.Must(GetNegativeCacheStats().Entries == 1)
+
+	// Nor the reply read before the reply of the write.
+	w := newTestRequest("SET", "other", "v")
+	assert.MustNoError(s.handleRequest(w, d))
+	r = newTestRequest("GET", "missing2")
+	assert.MustNoError(s.handleRequest(r, d))
+	_, err = s.handleResponse(w)
+	assert.MustNoError(err)
+	_, err = s.handleResponse(r)
+	assert.MustNoError(err)
+	assert.Must(GetNegativeCacheStats().Entries == 1)
+
+	time.Sleep(time.Millisecond * 150)
+	assert.Must(handleTestRequest(s, d, "GET", "missing").Value == nil)
+	assert.Must(reads.Int64() == 8)
+}
@@ -0,0 +1,189 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+type HotKeyInfo struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Error int64  `json:"error"`
+}
+
+type hotKeyCounter struct {
+	key          string
+	count, error int64
+	index        int
+}
+
+// hotKeyHeap is the min-heap of the counters of the space-saving algorithm,
+// the counter of the least count is replaced by a new key once it's full.
+type hotKeyHeap []*hotKeyCounter
+
+func (h hotKeyHeap) Len() int           { return len(h) }
+func (h hotKeyHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h hotKeyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *hotKeyHeap) Push(x interface{}) {
+	c := x.(*hotKeyCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *hotKeyHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// hotKeySampler tracks the hottest keys of the requests sampled, with the
+// counts of the keys of the current and the last interval.
+type hotKeySampler struct {
+	capacity int
+	ratio    int64
+	interval time.Duration
+
+	counters map[string]*hotKeyCounter
+	heap     hotKeyHeap
+	start    time.Time
+	last     []*HotKeyInfo
+}
+
+func (t *hotKeySampler) add(key string) {
+	if c := t.counters[key]; c != nil {
+		c.count++
+		heap.Fix(&t.heap, c.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		c := &hotKeyCounter{key: key, count: 1}
+		t.counters[key] = c
+		heap.Push(&t.heap, c)
+		return
+	}
+	c := t.heap[0]
+	delete(t.counters, c.key)
+	c.key, c.error = key, c.count
+	c.count++
+	t.counters[key] = c
+	heap.Fix(&t.heap, 0)
+}
+
+// rotate moves the counts of the current interval to the last one, if the
+// interval is over.
+func (t *hotKeySampler) rotate(now time.Time) {
+	if now.Sub(t.start) < t.interval {
+		return
+	}
+	t.last = t.report()
+	if now.Sub(t.start) >= t.interval*2 {
+		t.last = nil
+	}
+	var hot = make(map[string]int64, len(t.last))
+	for _, x := range t.last {
+		hot[x.Key] = x.Count * int64(time.Second) / int64(t.interval)
+	}
+	hotKeySet.Store(hot)
+	t.counters = make(map[string]*hotKeyCounter, t.capacity)
+	t.heap = t.heap[:0]
+	t.start = now
+}
+
+// report returns the counts of the keys, scaled by the sample ratio, in the
+// descending order.
+func (t *hotKeySampler) report() []*HotKeyInfo {
+	var all = make([]*HotKeyInfo, 0, len(t.heap))
+	for _, c := range t.heap {
+		all = append(all, &HotKeyInfo{
+			Key: c.key, Count: c.count * t.ratio, Error: c.error * t.ratio,
+		})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Count > all[j].Count
+	})
+	return all
+}
+
+// hotKeySet holds the keys of the last interval with the QPS estimated,
+// which are cached by the hot-key cache if enabled.
+var hotKeySet atomic.Value
+
+func init() {
+	hotKeySet.Store(map[string]int64{})
+}
+
+// isHotKey returns true if the key is one of the hottest keys of the last
+// interval, with the QPS estimated of minqps at least.
+func isHotKey(key []byte, minqps int64) bool {
+	qps, ok := hotKeySet.Load().(map[string]int64)[string(key)]
+	return ok && qps >= minqps
+}
+
+var hotkeys struct {
+	sync.Mutex
+	sampler *hotKeySampler
+
+	ratio atomic2.Int64
+	seq   atomic2.Int64
+}
+
+// SetHotKeySampler replaces the sampler, zero capacity disables it.
+func SetHotKeySampler(capacity int, ratio int64, interval time.Duration) {
+	hotkeys.Lock()
+	defer hotkeys.Unlock()
+	hotKeySet.Store(map[string]int64{})
+	if capacity <= 0 || ratio <= 0 || interval <= 0 {
+		hotkeys.sampler = nil
+		hotkeys.ratio.Set(0)
+		return
+	}
+	hotkeys.ratio.Set(ratio)
+	hotkeys.sampler = &hotKeySampler{
+		capacity: capacity, ratio: ratio, interval: interval,
+		counters: make(map[string]*hotKeyCounter, capacity),
+		start:    time.Now(),
+	}
+}
+
+// sampleHotKey counts the key of one of every hotkey_sample_ratio requests.
+func sampleHotKey(key []byte) {
+	var ratio = hotkeys.ratio.Int64()
+	if ratio <= 0 || len(key) == 0 || hotkeys.seq.Incr()%ratio != 0 {
+		return
+	}
+	hotkeys.Lock()
+	defer hotkeys.Unlock()
+	var t = hotkeys.sampler
+	if t == nil {
+		return
+	}
+	t.rotate(time.Now())
+	t.add(string(key))
+}
+
+// GetHotKeys returns the hottest keys of the last interval, or nil if the
+// sampler is disabled.
+func GetHotKeys() []*HotKeyInfo {
+	hotkeys.Lock()
+	defer hotkeys.Unlock()
+	var t = hotkeys.sampler
+	if t == nil {
+		return nil
+	}
+	t.rotate(time.Now())
+	return t.last
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestHotKeySampler(t *testing.T) {
+	var now = time.Now()
+	var x = &hotKeySampler{
+		capacity: 8, ratio: 2, interval: time.Second,
+		counters: make(map[string]*hotKeyCounter), start: now,
+	}
+	for i := 0; i < 1000; i++ {
+		x.add("hot")
+		if i%2 == 0 {
+			x.add("warm")
+		}
+		x.add("cold-" + strconv.Itoa(i))
+	}
+	assert.Must(len(x.heap) == 8 && len(x.counters) == 8)
+	keys := x.report()
+	assert.Must(keys[0].Key == "hot" && keys[0].Count == 2000)
+	assert.Must(keys[1].Key == "warm" && keys[1].Count >= 1000)
+	assert.Must(keys[2].Count-keys[2].Error <= 2)
+
+	x.rotate(now.Add(time.Millisecond * 500))
+	assert.Must(x.last == nil && len(x.heap) == 8)
+	x.rotate(now.Add(time.Second))
+	assert.Must(len(x.last) == 8 && len(x.heap) == 0)
+	x.rotate(now.Add(time.Second * 3))
+	assert.Must(x.last == nil)
+}
+
+func TestHotKeys(t *testing.T) {
+	defer SetHotKeySampler(0, 0, 0)
+
+	sampleHotKey([]byte("key"))
+	assert.Must(GetHotKeys() == nil)
+
+	SetHotKeySampler(8, 1, time.Millisecond*50)
+	for i := 0; i < 10; i++ {
+		sampleHotKey([]byte("key"))
+	}
+	sampleHotKey([]byte("other"))
+	time.Sleep(time.Millisecond * 60)
+	keys := GetHotKeys()
+	assert.Must(len(keys) == 2 && keys[0].Key == "key" && keys[0].Count == 10)
+
+	s := newTestSession()
+	resp := handleTestRequest(s, nil, "XMONITOR", "HOTKEYS")
+	assert.Must(resp.IsArray() && len(resp.Array) == 4 && string(resp.Array[0].Value) == "key")
+}
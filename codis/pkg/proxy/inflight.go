@@ -0,0 +1,100 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// inflight is the memory of requests and replies of all sessions, received
+// but not yet written to the clients, limited by proxy_max_inflight_memory.
+var inflight struct {
+	budget   atomic2.Int64
+	memory   atomic2.Int64
+	rejected atomic2.Int64
+}
+
+func setInflightBudget(n int64) {
+	inflight.budget.Set(n)
+}
+
+// inflightSize is the memory of a request charged to the budget, shared by
+// its sub-requests. It's -1 once released, so that replies received after
+// the session is closed are not charged anymore.
+type inflightSize struct {
+	n atomic2.Int64
+}
+
+func (x *inflightSize) add(n int64) {
+	for {
+		var v = x.n.Int64()
+		if v < 0 {
+			return
+		}
+		if x.n.CompareAndSwap(v, v+n) {
+			inflight.memory.Add(n)
+			return
+		}
+	}
+}
+
+func (x *inflightSize) release() {
+	if v := x.n.Swap(-1); v > 0 {
+		inflight.memory.Sub(v)
+	}
+}
+
+// acquireInflight charges the request to the budget, and returns the error
+// reply if the budget is exceeded. The error is retryable, the load is shed
+// until the replies in flight are written.
+func (r *Request) acquireInflight() *redis.Resp {
+	var budget = inflight.budget.Int64()
+	if budget <= 0 {
+		return nil
+	}
+	var size = multiSize(r.Multi)
+	if inflight.memory.Int64()+size > budget {
+		inflight.rejected.Incr()
+		return redis.NewErrorf("TRYAGAIN in-flight memory budget of proxy exceeded, please retry later")
+	}
+	r.inflight = &inflightSize{}
+	r.inflight.add(size)
+	return nil
+}
+
+// chargeReply charges the reply received from the backend, to the budget and
+// to the output buffer of the session.
+func (r *Request) chargeReply(resp *redis.Resp) {
+	if resp == nil || (r.inflight == nil && r.session == nil) {
+		return
+	}
+	var size = respSize(resp)
+	if r.inflight != nil {
+		r.inflight.add(size)
+	}
+	if r.session != nil {
+		r.session.chargeOutput(r, size, false)
+	}
+}
+
+func (r *Request) releaseInflight() {
+	if r.inflight != nil {
+		r.inflight.release()
+	}
+}
+
+type InflightStats struct {
+	Budget   int64 `json:"budget"`
+	Memory   int64 `json:"memory"`
+	Rejected int64 `json:"rejected"`
+}
+
+func GetInflightStats() *InflightStats {
+	return &InflightStats{
+		Budget:   inflight.budget.Int64(),
+		Memory:   inflight.memory.Int64(),
+		Rejected: inflight.rejected.Int64(),
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestInflightBudget(t *testing.T) {
+	defer setInflightBudget(0)
+
+	r0 := newTestRequest("GET", "0123456789")
+	assert.Must(r0.acquireInflight() == nil && r0.inflight == nil)
+
+	setInflightBudget(40)
+	var memory, rejected = inflight.memory.Int64(), inflight.rejected.Int64()
+
+	r1 := newTestRequest("MGET", "0123456789", "0123456789")
+	assert.Must(r1.acquireInflight() == nil)
+	assert.Must(inflight.memory.Int64() == memory+24)
+
+	sub := r1.MakeSubRequest(2)
+	sub[0].chargeReply(redis.NewBulkBytes([]byte("0123456789")))
+	assert.Must(inflight.memory.Int64() == memory+34)
+
+	r2 := newTestRequest("GET", "0123456789")
+	assert.Must(r2.acquireInflight().IsError())
+	assert.Must(inflight.rejected.Int64() == rejected+1)
+
+	r1.releaseInflight()
+	assert.Must(inflight.memory.Int64() == memory)
+	sub[1].chargeReply(redis.NewBulkBytes([]byte("0123456789")))
+	assert.Must(inflight.memory.Int64() == memory)
+
+	assert.Must(r2.acquireInflight() == nil)
+	r2.releaseInflight()
+	assert.Must(inflight.memory.Int64() == memory)
+}
@@ -0,0 +1,247 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+const InfoCacheTimeout = time.Second
+
+// infoCache keeps the INFO snapshots of the backends, so the merged view
+// doesn't send INFO to every group for each client asking.
+var infoCache struct {
+	sync.Mutex
+	snapshots map[string]*infoSnapshot
+}
+
+type infoSnapshot struct {
+	text   []byte
+	expire time.Time
+}
+
+func init() {
+	infoCache.snapshots = make(map[string]*infoSnapshot)
+}
+
+func getInfoSnapshot(addr string) []byte {
+	infoCache.Lock()
+	defer infoCache.Unlock()
+	if x := infoCache.snapshots[addr]; x != nil && time.Now().Before(x.expire) {
+		return x.text
+	}
+	return nil
+}
+
+func setInfoSnapshot(addr string, text []byte) {
+	infoCache.Lock()
+	defer infoCache.Unlock()
+	infoCache.snapshots[addr] = &infoSnapshot{
+		text: text, expire: time.Now().Add(InfoCacheTimeout),
+	}
+}
+
+var infoMergedSections = []string{"clients", "memory", "replication", "keyspace"}
+
+// handleRequestMergedInfo replies INFO [section] with the sections clients,
+// memory, replication and keyspace merged from all groups.
+func (s *Session) handleRequestMergedInfo(r *Request, d *Router) error {
+	var section = "default"
+	if len(r.Multi) == 2 {
+		section = strings.ToLower(string(r.Multi[1].Value))
+	}
+	var sections = make(map[string]bool)
+	switch section {
+	case "all", "default", "everything":
+		for _, name := range infoMergedSections {
+			sections[name] = true
+		}
+	default:
+		sections[section] = true
+	}
+	ids := d.backendSlots()
+	if len(ids) == 0 {
+		return ErrSlotIsNotReady
+	}
+
+	var addrs = make([]string, len(ids))
+	var texts = make([][]byte, len(ids))
+	var sub = r.MakeSubRequest(len(ids))
+	for i := range ids {
+		addrs[i] = d.slotAddr(ids[i])
+		if texts[i] = getInfoSnapshot(addrs[i]); texts[i] != nil {
+			continue
+		}
+		sub[i].Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte("INFO")),
+		}
+		if err := d.dispatchSlot(&sub[i], ids[i]); err != nil {
+			return err
+		}
+	}
+	r.Coalesce = func() error {
+		for i := range sub {
+			if texts[i] != nil {
+				continue
+			}
+			if err := sub[i].Err; err != nil {
+				return err
+			}
+			switch resp := sub[i].Resp; {
+			case resp == nil:
+				return ErrRespIsRequired
+			case resp.IsError():
+				r.Resp = resp
+				return nil
+			default:
+				texts[i] = resp.Value
+				setInfoSnapshot(addrs[i], resp.Value)
+			}
+		}
+		var infos = make([]map[string][][2]string, len(texts))
+		for i := range texts {
+			infos[i] = parseInfo(texts[i])
+		}
+		var b bytes.Buffer
+		for _, name := range infoMergedSections {
+			if !sections[name] {
+				continue
+			}
+			if b.Len() != 0 {
+				b.WriteString("\r\n")
+			}
+			fmt.Fprintf(&b, "# %s\r\n", strings.ToUpper(name[:1])+name[1:])
+			switch name {
+			case "replication":
+				mergeInfoReplication(&b, d, ids, addrs, infos)
+			case "keyspace":
+				mergeInfoKeyspace(&b, infos)
+			default:
+				mergeInfoSection(&b, name, infos)
+			}
+		}
+		r.Resp = redis.NewBulkBytes(b.Bytes())
+		return nil
+	}
+	return nil
+}
+
+// parseInfo splits the reply of INFO into sections, keyed by the lowercase
+// name of each section. Comment lines inside a section, e.g. "# Time:..."
+// in the keyspace section of pika, are skipped.
+func parseInfo(text []byte) map[string][][2]string {
+	var infos = make(map[string][][2]string)
+	var section string
+	for _, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			if name := strings.TrimSpace(line[1:]); !strings.ContainsAny(name, ": ") {
+				section = strings.ToLower(name)
+			}
+		default:
+			if i := strings.IndexAny(line, ": "); i > 0 {
+				infos[section] = append(infos[section], [2]string{line[:i], line[i+1:]})
+			}
+		}
+	}
+	return infos
+}
+
+// mergeInfoSection sums the integer fields of the section, other fields
+// can't be merged and are dropped.
+func mergeInfoSection(b *bytes.Buffer, name string, infos []map[string][][2]string) {
+	var keys []string
+	var sums = make(map[string]int64)
+	for _, info := range infos {
+		for _, kv := range info[name] {
+			n, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, ok := sums[kv[0]]; !ok {
+				keys = append(keys, kv[0])
+			}
+			sums[kv[0]] += n
+		}
+	}
+	for _, key := range keys {
+		fmt.Fprintf(b, "%s:%d\r\n", key, sums[key])
+	}
+}
+
+// mergeInfoKeyspace sums the counters of each db, e.g. "db0:keys=1,expires=0"
+// of redis or "db0 Strings_keys=1, expires=0" of pika.
+func mergeInfoKeyspace(b *bytes.Buffer, infos []map[string][][2]string) {
+	var dbs []string
+	var keys = make(map[string][]string)
+	var sums = make(map[string]map[string]int64)
+	for _, info := range infos {
+		for _, kv := range info["keyspace"] {
+			if sums[kv[0]] == nil {
+				dbs = append(dbs, kv[0])
+				sums[kv[0]] = make(map[string]int64)
+			}
+			for _, field := range strings.Split(kv[1], ",") {
+				var pair = strings.SplitN(strings.TrimSpace(field), "=", 2)
+				if len(pair) != 2 {
+					continue
+				}
+				n, err := strconv.ParseInt(pair[1], 10, 64)
+				if err != nil {
+					continue
+				}
+				if _, ok := sums[kv[0]][pair[0]]; !ok {
+					keys[kv[0]] = append(keys[kv[0]], pair[0])
+				}
+				sums[kv[0]][pair[0]] += n
+			}
+		}
+	}
+	for _, db := range dbs {
+		var fields []string
+		for _, key := range keys[db] {
+			fields = append(fields, fmt.Sprintf("%s=%d", key, sums[db][key]))
+		}
+		fmt.Fprintf(b, "%s:%s\r\n", db, strings.Join(fields, ","))
+	}
+}
+
+// mergeInfoReplication reports the role and replicas of each group's master.
+func mergeInfoReplication(b *bytes.Buffer, d *Router, ids []int, addrs []string, infos []map[string][][2]string) {
+	var total int64
+	var lines []string
+	for i, info := range infos {
+		var role, slaves = "unknown", int64(0)
+		for _, kv := range info["replication"] {
+			switch kv[0] {
+			case "role":
+				role = strings.TrimSpace(kv[1])
+			case "connected_slaves":
+				slaves, _ = strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+			}
+		}
+		total += slaves
+		var gid int
+		if m := d.GetSlot(ids[i]); m != nil {
+			gid = m.BackendAddrGroupId
+		}
+		lines = append(lines, fmt.Sprintf("group_%d:addr=%s,role=%s,connected_slaves=%d",
+			gid, addrs[i], role, slaves))
+	}
+	fmt.Fprintf(b, "role:master\r\n")
+	fmt.Fprintf(b, "connected_slaves:%d\r\n", total)
+	fmt.Fprintf(b, "groups:%d\r\n", len(lines))
+	for _, line := range lines {
+		b.WriteString(line + "\r\n")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestMergedInfo(t *testing.T) {
+	var calls atomic2.Int64
+	var texts = []string{
+		"# Server\r\nredis_version:6.2.0\r\n\r\n" +
+			"# Clients\r\nconnected_clients:3\r\nblocked_clients:1\r\n\r\n" +
+			"# Memory\r\nused_memory:100\r\nused_memory_human:100B\r\n\r\n" +
+			"# Replication\r\nrole:master\r\nconnected_slaves:1\r\n\r\n" +
+			"# Keyspace\r\ndb0:keys=10,expires=2,avg_ttl=0\r\n",
+		"# Clients\r\nconnected_clients:4\r\n\r\n" +
+			"# Memory\r\nused_memory:200\r\n\r\n" +
+			"# Replication\r\nrole:master\r\nconnected_slaves:2\r\n\r\n" +
+			"# Keyspace\r\n# Time:2024-01-01 00:00:00\r\ndb0 keys=5, expires=1\r\ndb1 keys=1, expires=0\r\n",
+	}
+	var backends = make([]*fakeBackend, len(texts))
+	var addrs = make([]string, len(texts))
+	for i := range texts {
+		text := texts[i]
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			calls.Incr()
+			return redis.NewBulkBytes([]byte(text))
+		})
+		defer backends[i].Close()
+		addrs[i] = backends[i].Addr()
+	}
+
+	d := newTestRouter(addrs...)
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "INFO")
+	assert.Must(resp.IsBulkBytes())
+	var info = string(resp.Value)
+	for _, line := range []string{
+		"connected_clients:7", "blocked_clients:1", "used_memory:300",
+		"connected_slaves:3", "groups:2", "db0:keys=15,expires=3,avg_ttl=0", "db1:keys=1,expires=0",
+	} {
+		assert.Must(strings.Contains(info, line+"\r\n"))
+	}
+	assert.Must(!strings.Contains(info, "used_memory_human") && !strings.Contains(info, "redis_version"))
+	assert.Must(calls.Int64() == 2)
+
+	resp = handleTestRequest(s, d, "INFO", "keyspace")
+	assert.Must(strings.HasPrefix(string(resp.Value), "# Keyspace\r\n"))
+	assert.Must(!strings.Contains(string(resp.Value), "connected_clients"))
+	assert.Must(calls.Int64() == 2)
+
+	resp = handleTestRequest(s, d, "INFO", addrs[1])
+	assert.Must(string(resp.Value) == texts[1] && calls.Int64() == 3)
+}
+
+func TestPingBackend(t *testing.T) {
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		if len(multi) == 2 {
+			return redis.NewBulkBytes(multi[1].Value)
+		}
+		return redis.NewString([]byte("PONG"))
+	})
+	defer backend.Close()
+
+	d := newTestRouter(backend.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "PING")
+	assert.Must(resp.IsString() && string(resp.Value) == "PONG")
+	resp = handleTestRequest(s, d, "PING", "hello")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "hello")
+	resp = handleTestRequest(s, d, "PING", backend.Addr(), "hello")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "hello")
+}
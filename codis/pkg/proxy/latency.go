@@ -0,0 +1,120 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	MaxLatencyEvents  = 256
+	MaxLatencySamples = 160
+)
+
+type LatencySample struct {
+	UnixTime int64 `json:"unixtime"`
+	Latency  int64 `json:"latency"`
+}
+
+type LatencyEvent struct {
+	Name    string `json:"name"`
+	Latest  int64  `json:"latest"`
+	Max     int64  `json:"max"`
+	Samples []*LatencySample
+}
+
+var latency struct {
+	sync.Mutex
+	events map[string]*LatencyEvent
+}
+
+func init() {
+	latency.events = make(map[string]*LatencyEvent, 64)
+}
+
+// recordLatency adds a sample (in milliseconds) for the event. Like redis,
+// samples within the same second are merged, keeping the highest latency.
+func recordLatency(name string, unixTime, ms int64) {
+	name = strings.ToLower(name)
+	latency.Lock()
+	defer latency.Unlock()
+	e := latency.events[name]
+	if e == nil {
+		if len(latency.events) >= MaxLatencyEvents {
+			return
+		}
+		e = &LatencyEvent{Name: name}
+		latency.events[name] = e
+	}
+	if ms > e.Max {
+		e.Max = ms
+	}
+	e.Latest = ms
+	if n := len(e.Samples); n != 0 && e.Samples[n-1].UnixTime == unixTime {
+		if ms > e.Samples[n-1].Latency {
+			e.Samples[n-1].Latency = ms
+		}
+		return
+	}
+	if len(e.Samples) >= MaxLatencySamples {
+		e.Samples = append(e.Samples[:0], e.Samples[1:]...)
+	}
+	e.Samples = append(e.Samples, &LatencySample{UnixTime: unixTime, Latency: ms})
+}
+
+// GetLatencyLatest returns every event with its latest sample, sorted by name.
+func GetLatencyLatest() []*LatencyEvent {
+	latency.Lock()
+	defer latency.Unlock()
+	var all = make([]*LatencyEvent, 0, len(latency.events))
+	for _, e := range latency.events {
+		x := &LatencyEvent{Name: e.Name, Latest: e.Latest, Max: e.Max}
+		if n := len(e.Samples); n != 0 {
+			x.Samples = []*LatencySample{{UnixTime: e.Samples[n-1].UnixTime, Latency: e.Samples[n-1].Latency}}
+		}
+		all = append(all, x)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+func GetLatencyHistory(name string) []*LatencySample {
+	latency.Lock()
+	defer latency.Unlock()
+	e := latency.events[strings.ToLower(name)]
+	if e == nil {
+		return nil
+	}
+	var all = make([]*LatencySample, len(e.Samples))
+	for i, s := range e.Samples {
+		x := *s
+		all[i] = &x
+	}
+	return all
+}
+
+// ResetLatency removes the given events, or all of them if none is given,
+// and returns the number of events removed.
+func ResetLatency(names ...string) int {
+	latency.Lock()
+	defer latency.Unlock()
+	if len(names) == 0 {
+		n := len(latency.events)
+		latency.events = make(map[string]*LatencyEvent, 64)
+		return n
+	}
+	var n int
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, ok := latency.events[name]; ok {
+			delete(latency.events, name)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestLatencySamples(t *testing.T) {
+	ResetLatency()
+	defer ResetLatency()
+
+	recordLatency("GET", 100, 5)
+	recordLatency("GET", 100, 3)
+	recordLatency("GET", 101, 2)
+
+	history := GetLatencyHistory("get")
+	assert.Must(len(history) == 2)
+	assert.Must(history[0].UnixTime == 100 && history[0].Latency == 5)
+	assert.Must(history[1].UnixTime == 101 && history[1].Latency == 2)
+
+	for i := 0; i < MaxLatencySamples*2; i++ {
+		recordLatency("GET", int64(200+i), 1)
+	}
+	assert.Must(len(GetLatencyHistory("get")) == MaxLatencySamples)
+}
+
+func TestLatencyCommand(t *testing.T) {
+	ResetLatency()
+	defer ResetLatency()
+
+	recordLatency("GET", 100, 5)
+	recordLatency("GET", 101, 7)
+	recordLatency("MGET", 102, 20)
+
+	s := newTestSession()
+	resp := handleTestRequest(s, nil, "LATENCY", "LATEST")
+	assert.Must(resp.IsArray() && len(resp.Array) == 2)
+	get := resp.Array[0].Array
+	assert.Must(string(get[0].Value) == "get")
+	assert.Must(string(get[1].Value) == "101")
+	assert.Must(string(get[2].Value) == "7" && string(get[3].Value) == "7")
+
+	resp = handleTestRequest(s, nil, "LATENCY", "HISTORY", "mget")
+	assert.Must(resp.IsArray() && len(resp.Array) == 1)
+	assert.Must(string(resp.Array[0].Array[1].Value) == "20")
+
+	resp = handleTestRequest(s, nil, "LATENCY", "RESET", "get")
+	assert.Must(resp.IsInt() && string(resp.Value) == "1")
+	resp = handleTestRequest(s, nil, "LATENCY", "LATEST")
+	assert.Must(len(resp.Array) == 1)
+
+	assert.Must(handleTestRequest(s, nil, "LATENCY", "DOCTOR").IsError())
+}
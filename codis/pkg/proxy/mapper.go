@@ -4,8 +4,6 @@
 package proxy
 
 import (
-	"bytes"
-	"hash/crc32"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,6 +25,8 @@ func init() {
 			charmap[i] = c - 'a' + 'A'
 		case c == ':':
 			charmap[i] = ':'
+		case c == '_':
+			charmap[i] = '_'
 		}
 	}
 }
@@ -51,6 +51,18 @@ func (f OpFlag) IsQuick() bool {
 	return (f & FlagQuick) != 0
 }
 
+func (f OpFlag) IsRespReturnSingleValue() bool {
+	return (f & FlagRespReturnSingleValue) != 0
+}
+
+func (f OpFlag) IsRespReturnArray() bool {
+	return (f & FlagRespReturnArray) != 0
+}
+
+func (f OpFlag) IsAlias() bool {
+	return (f & FlagAlias) != 0
+}
+
 type OpInfo struct {
 	Name string
 	Flag OpFlag
@@ -63,6 +75,19 @@ const (
 	FlagNotAllow
 	FlagQuick
 	FlagSlow
+	FlagRespReturnSingleValue
+	FlagRespReturnArray
+	FlagAlias
+
+	// The values of requests checked by max_value_bytes, i.e. the argument
+	// after the key, all the arguments after the key, the values of the
+	// field-value pairs after the key, or the values of the key-value pairs.
+	// Commands with options or scores before the values, e.g. ZADD, check
+	// all the arguments after the key, the others than the values are short.
+	FlagReqValue
+	FlagReqValues
+	FlagReqPairValues
+	FlagReqKeyValues
 )
 
 var (
@@ -72,92 +97,116 @@ var (
 
 func init() {
 	for _, i := range []OpInfo{
-		{"APPEND", FlagWrite},
-		{"ASKING", FlagNotAllow},
+		{"ACL", 0},
+		{"APPEND", FlagWrite | FlagReqValue},
+		{"ASKING", 0},
 		{"AUTH", 0},
 		{"BGREWRITEAOF", FlagNotAllow},
 		{"BGSAVE", FlagNotAllow},
 		{"BITCOUNT", 0},
 		{"BITFIELD", FlagWrite},
-		{"BITOP", FlagWrite | FlagNotAllow},
+		{"BITFIELD_RO", 0},
+		{"BITOP", FlagWrite},
 		{"BITPOS", 0},
-		{"BLPOP", FlagWrite | FlagNotAllow},
-		{"BRPOP", FlagWrite | FlagNotAllow},
-		{"BRPOPLPUSH", FlagWrite | FlagNotAllow},
-		{"CLIENT", FlagNotAllow},
-		{"CLUSTER", FlagNotAllow},
+		{"BLMOVE", FlagWrite},
+		{"BLMPOP", FlagWrite},
+		{"BLPOP", FlagWrite},
+		{"BRPOP", FlagWrite},
+		{"BRPOPLPUSH", FlagWrite},
+		{"BZMPOP", FlagWrite},
+		{"BZPOPMAX", FlagWrite | FlagRespReturnArray},
+		{"BZPOPMIN", FlagWrite | FlagRespReturnArray},
+		{"CLIENT", 0},
+		{"CLUSTER", 0},
 		{"COMMAND", 0},
 		{"CONFIG", FlagNotAllow},
-		{"DBSIZE", FlagNotAllow},
-		{"DEBUG", FlagNotAllow},
+		{"COPY", FlagWrite},
+		{"DBSIZE", FlagMasterOnly},
+		{"DEBUG", 0},
 		{"DECR", FlagWrite},
 		{"DECRBY", FlagWrite},
 		{"DEL", FlagWrite},
-		{"DISCARD", FlagNotAllow},
+		{"DISCARD", 0},
 		{"DUMP", 0},
 		{"ECHO", 0},
-		{"EVAL", FlagNotAllow},
-		{"EVALSHA", FlagNotAllow},
-		{"EXEC", FlagNotAllow},
+		{"EVAL", FlagWrite},
+		{"EVALSHA", FlagWrite},
+		{"EVALSHA_RO", 0},
+		{"EVAL_RO", 0},
+		{"EXEC", 0},
 		{"EXISTS", 0},
 		{"EXPIRE", FlagWrite},
 		{"EXPIREAT", FlagWrite},
-		{"FLUSHALL", FlagWrite | FlagNotAllow},
-		{"FLUSHDB", FlagWrite | FlagNotAllow},
+		{"EXPIRETIME", 0},
+		{"FCALL", FlagWrite},
+		{"FCALL_RO", 0},
+		{"FLUSHALL", FlagWrite},
+		{"FLUSHDB", FlagWrite},
+		{"FUNCTION", FlagWrite},
 		{"GEOADD", FlagWrite},
 		{"GEODIST", 0},
 		{"GEOHASH", 0},
 		{"GEOPOS", 0},
+		{"GEOSEARCH", 0},
+		{"GEOSEARCHSTORE", FlagWrite},
 		{"GEORADIUS", FlagWrite},
 		{"GEORADIUSBYMEMBER", FlagWrite},
-		{"GET", 0},
+		{"GET", FlagRespReturnSingleValue},
 		{"GETBIT", 0},
 		{"GETRANGE", 0},
-		{"GETSET", FlagWrite},
+		{"GETDEL", FlagWrite | FlagRespReturnSingleValue},
+		{"GETEX", FlagWrite | FlagRespReturnSingleValue},
+		{"GETSET", FlagWrite | FlagReqValue | FlagRespReturnSingleValue},
 		{"HDEL", FlagWrite},
+		{"HELLO", 0},
 		{"HEXISTS", 0},
-		{"HGET", 0},
+		{"HGET", FlagRespReturnSingleValue},
 		{"HGETALL", 0},
 		{"HINCRBY", FlagWrite},
 		{"HINCRBYFLOAT", FlagWrite},
 		{"HKEYS", 0},
 		{"HLEN", 0},
 		{"HMGET", 0},
-		{"HMSET", FlagWrite},
+		{"HMSET", FlagWrite | FlagReqPairValues},
 		{"HOST:", FlagNotAllow},
+		{"HRANDFIELD", FlagRespReturnArray},
 		{"HSCAN", FlagMasterOnly},
-		{"HSET", FlagWrite},
-		{"HSETNX", FlagWrite},
+		{"HSET", FlagWrite | FlagReqPairValues},
+		{"HSETNX", FlagWrite | FlagReqPairValues},
 		{"HSTRLEN", 0},
 		{"HVALS", 0},
 		{"INCR", FlagWrite},
 		{"INCRBY", FlagWrite},
 		{"INCRBYFLOAT", FlagWrite},
 		{"INFO", 0},
-		{"KEYS", FlagNotAllow},
+		{"KEYS", FlagMasterOnly},
 		{"LASTSAVE", FlagNotAllow},
-		{"LATENCY", FlagNotAllow},
-		{"LINDEX", 0},
-		{"LINSERT", FlagWrite},
+		{"LATENCY", 0},
+		{"LINDEX", FlagRespReturnSingleValue},
+		{"LINSERT", FlagWrite | FlagReqValues},
 		{"LLEN", 0},
+		{"LMOVE", FlagWrite},
+		{"LMPOP", FlagWrite},
 		{"LPOP", FlagWrite},
-		{"LPUSH", FlagWrite},
-		{"LPUSHX", FlagWrite},
+		{"LPOS", 0},
+		{"LPUSH", FlagWrite | FlagReqValues},
+		{"LPUSHX", FlagWrite | FlagReqValues},
 		{"LRANGE", 0},
 		{"LREM", FlagWrite},
-		{"LSET", FlagWrite},
+		{"LSET", FlagWrite | FlagReqValues},
 		{"LTRIM", FlagWrite},
 		{"MGET", 0},
 		{"MIGRATE", FlagWrite | FlagNotAllow},
-		{"MONITOR", FlagNotAllow},
+		{"MONITOR", 0},
 		{"MOVE", FlagWrite | FlagNotAllow},
-		{"MSET", FlagWrite},
-		{"MSETNX", FlagWrite | FlagNotAllow},
-		{"MULTI", FlagNotAllow},
-		{"OBJECT", FlagNotAllow},
+		{"MSET", FlagWrite | FlagReqKeyValues},
+		{"MSETNX", FlagWrite | FlagReqKeyValues},
+		{"MULTI", 0},
+		{"OBJECT", 0},
 		{"PERSIST", FlagWrite},
 		{"PEXPIRE", FlagWrite},
 		{"PEXPIREAT", FlagWrite},
+		{"PEXPIRETIME", 0},
 		{"PFADD", FlagWrite},
 		{"PFCOUNT", 0},
 		{"PFDEBUG", FlagWrite},
@@ -165,44 +214,46 @@ func init() {
 		{"PFSELFTEST", 0},
 		{"PING", 0},
 		{"POST", FlagNotAllow},
-		{"PSETEX", FlagWrite},
-		{"PSUBSCRIBE", FlagNotAllow},
+		{"PSETEX", FlagWrite | FlagReqValues},
+		{"PSUBSCRIBE", 0},
 		{"PSYNC", FlagNotAllow},
 		{"PTTL", 0},
-		{"PUBLISH", FlagNotAllow},
+		{"PUBLISH", FlagWrite},
 		{"PUBSUB", 0},
-		{"PUNSUBSCRIBE", FlagNotAllow},
+		{"PUNSUBSCRIBE", 0},
 		{"QUIT", 0},
-		{"RANDOMKEY", FlagNotAllow},
-		{"READONLY", FlagNotAllow},
-		{"READWRITE", FlagNotAllow},
-		{"RENAME", FlagWrite | FlagNotAllow},
-		{"RENAMENX", FlagWrite | FlagNotAllow},
+		{"RANDOMKEY", 0},
+		{"READONLY", 0},
+		{"READWRITE", 0},
+		{"RENAME", FlagWrite},
+		{"RENAMENX", FlagWrite},
 		{"REPLCONF", FlagNotAllow},
 		{"RESTORE", FlagWrite | FlagNotAllow},
 		{"RESTORE-ASKING", FlagWrite | FlagNotAllow},
 		{"ROLE", 0},
 		{"RPOP", FlagWrite},
-		{"RPOPLPUSH", FlagNotAllow},
-		{"RPUSH", FlagWrite},
-		{"RPUSHX", FlagWrite},
-		{"SADD", FlagWrite},
+		{"RPOPLPUSH", FlagWrite},
+		{"RPUSH", FlagWrite | FlagReqValues},
+		{"RPUSHX", FlagWrite | FlagReqValues},
+		{"SADD", FlagWrite | FlagReqValues},
 		{"SAVE", FlagNotAllow},
-		{"SCAN", FlagMasterOnly | FlagNotAllow},
+		{"SCAN", FlagMasterOnly},
 		{"SCARD", 0},
-		{"SCRIPT", FlagNotAllow},
-		{"SDIFF", FlagNotAllow},
+		{"SCRIPT", FlagWrite},
+		{"SDIFF", 0},
 		{"SDIFFSTORE", FlagWrite},
 		{"SELECT", 0},
-		{"SET", FlagWrite},
+		{"SET", FlagWrite | FlagReqValue},
 		{"SETBIT", FlagWrite},
-		{"SETEX", FlagWrite},
-		{"SETNX", FlagWrite},
-		{"SETRANGE", FlagWrite},
+		{"SETEX", FlagWrite | FlagReqValues},
+		{"SETNX", FlagWrite | FlagReqValue},
+		{"SETRANGE", FlagWrite | FlagReqValues},
 		{"SHUTDOWN", FlagNotAllow},
-		{"SINTER", FlagNotAllow},
+		{"SINTER", 0},
+		{"SINTERCARD", 0},
 		{"SINTERSTORE", FlagNotAllow},
 		{"SISMEMBER", 0},
+		{"SMISMEMBER", 0},
 		{"SLAVEOF", FlagNotAllow},
 		{"SLOTSCHECK", FlagNotAllow},
 		{"SLOTSDEL", FlagWrite | FlagNotAllow},
@@ -226,37 +277,60 @@ func init() {
 		{"SLOTSRESTORE-ASYNC-AUTH", FlagWrite | FlagNotAllow},
 		{"SLOTSRESTORE-ASYNC-ACK", FlagWrite | FlagNotAllow},
 		{"SLOTSSCAN", FlagMasterOnly},
-		{"SLOWLOG", FlagNotAllow},
+		{"SLOWLOG", 0},
+		{"XSLOWLOG", 0},
 		{"SMEMBERS", 0},
-		{"SMOVE", FlagNotAllow},
+		{"SMOVE", FlagWrite},
 		{"SORT", FlagWrite},
+		{"SORT_RO", 0},
 		{"SPOP", FlagWrite},
 		{"SRANDMEMBER", 0},
 		{"SREM", FlagWrite},
 		{"SSCAN", FlagMasterOnly},
 		{"STRLEN", 0},
-		{"SUBSCRIBE", FlagNotAllow},
+		{"SUBSCRIBE", 0},
 		{"SUBSTR", 0},
-		{"SUNION", FlagNotAllow},
+		{"SUNION", 0},
 		{"SUNIONSTORE", FlagNotAllow},
 		{"SYNC", FlagNotAllow},
 		{"PCONFIG", 0},
+		{"XCONFIG", 0},
 		{"TIME", FlagNotAllow},
 		{"TOUCH", FlagWrite},
 		{"TTL", 0},
 		{"TYPE", 0},
-		{"UNSUBSCRIBE", FlagNotAllow},
-		{"UNWATCH", FlagNotAllow},
+		{"UNSUBSCRIBE", 0},
+		{"UNWATCH", 0},
 		{"WAIT", FlagNotAllow},
-		{"WATCH", FlagNotAllow},
-		{"ZADD", FlagWrite},
+		{"WATCH", 0},
+		{"XACK", FlagWrite},
+		{"XADD", FlagWrite | FlagReqValues},
+		{"XAUTOCLAIM", FlagWrite},
+		{"XCLAIM", FlagWrite},
+		{"XDEL", FlagWrite},
+		{"XGROUP", FlagWrite},
+		{"XINFO", 0},
+		{"XLEN", 0},
+		{"XMONITOR", 0},
+		{"XPENDING", 0},
+		{"XRANGE", 0},
+		{"XREAD", 0},
+		{"XREADGROUP", FlagWrite},
+		{"XREVRANGE", 0},
+		{"XSETID", FlagWrite},
+		{"XTRIM", FlagWrite},
+		{"ZADD", FlagWrite | FlagReqValues},
 		{"ZCARD", 0},
 		{"ZCOUNT", 0},
 		{"ZINCRBY", FlagWrite},
-		{"ZINTERSTORE", FlagNotAllow},
+		{"ZINTERSTORE", FlagWrite},
 		{"ZLEXCOUNT", 0},
+		{"ZMPOP", FlagWrite},
+		{"ZPOPMAX", FlagWrite | FlagRespReturnArray},
+		{"ZPOPMIN", FlagWrite | FlagRespReturnArray},
 		{"ZRANGE", 0},
 		{"ZRANGEBYLEX", 0},
+		{"ZRANDMEMBER", FlagRespReturnArray},
 		{"ZRANGEBYSCORE", 0},
 		{"ZRANK", 0},
 		{"ZREM", FlagWrite},
@@ -269,7 +343,7 @@ func init() {
 		{"ZREVRANK", 0},
 		{"ZSCAN", FlagMasterOnly},
 		{"ZSCORE", 0},
-		{"ZUNIONSTORE", FlagNotAllow},
+		{"ZUNIONSTORE", FlagWrite},
 	} {
 		opTable[i.Name] = i
 	}
@@ -297,7 +371,7 @@ func getOpInfo(multi []*redis.Resp) (string, OpFlag, error) {
 		if c := charmap[op[i]]; c != 0 {
 			upper[i] = c
 		} else {
-			return strings.ToUpper(string(op)), FlagMayWrite, nil
+			return getOpInfoSlow(strings.ToUpper(string(op)))
 		}
 	}
 	op = upper[:len(op)]
@@ -311,29 +385,81 @@ func getOpInfo(multi []*redis.Resp) (string, OpFlag, error) {
 	return string(op), FlagMayWrite, nil
 }
 
-func Hash(key []byte) uint32 {
-	const (
-		TagBeg = '{'
-		TagEnd = '}'
-	)
-	if beg := bytes.IndexByte(key, TagBeg); beg >= 0 {
-		if end := bytes.IndexByte(key[beg+1:], TagEnd); end >= 0 {
-			key = key[beg+1 : beg+1+end]
+// getOpInfoSlow looks up the commands with characters other than letters,
+// ':' and '_', which could only be aliases of renamed commands.
+func getOpInfoSlow(opstr string) (string, OpFlag, error) {
+	opTableLock.RLock()
+	defer opTableLock.RUnlock()
+
+	if r, ok := opTable[opstr]; ok {
+		return r.Name, r.Flag, nil
+	}
+	return opstr, FlagMayWrite, nil
+}
+
+func isKnownOp(opstr string) bool {
+	opTableLock.RLock()
+	defer opTableLock.RUnlock()
+	_, ok := opTable[opstr]
+	return ok
+}
+
+// numKeys returns the keys following numkeys at the index, e.g. the keys of
+// LMPOP numkeys key [key ...] LEFT|RIGHT.
+func numKeys(multi []*redis.Resp, index int) ([]*redis.Resp, *redis.Resp) {
+	if index >= len(multi) {
+		return nil, redis.NewErrorf("ERR wrong number of arguments for '%s' command", strings.ToLower(string(multi[0].Value)))
+	}
+	n, err := redis.Btoi64(multi[index].Value)
+	switch {
+	case err != nil || n <= 0:
+		return nil, redis.NewErrorf("ERR numkeys should be greater than 0")
+	case n > int64(len(multi)-index-1):
+		return nil, redis.NewErrorf("ERR Number of keys can't be greater than number of args")
+	}
+	return multi[index+1 : index+1+int(n)], nil
+}
+
+// streamsIndex returns the index of STREAMS in XREAD/XREADGROUP, or 0.
+func streamsIndex(multi []*redis.Resp) int {
+	for i := 1; i < len(multi); i++ {
+		switch strings.ToUpper(string(multi[i].Value)) {
+		case "STREAMS":
+			return i
+		case "COUNT", "BLOCK":
+			i++
+		case "GROUP":
+			i += 2
 		}
 	}
-	return crc32.ChecksumIEEE(key)
+	return 0
 }
 
 func getHashKey(multi []*redis.Resp, opstr string) []byte {
+	if index := hashKeyIndex(multi, opstr); index < len(multi) {
+		return multi[index].Value
+	}
+	return nil
+}
+
+// hashKeyIndex returns the index of the key used to route the request, it
+// could be out of range if the key is missing.
+func hashKeyIndex(multi []*redis.Resp, opstr string) int {
 	var index = 1
 	switch opstr {
-	case "ZINTERSTORE", "ZUNIONSTORE", "EVAL", "EVALSHA":
+	case "ZINTERSTORE", "ZUNIONSTORE", "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO",
+		"FCALL", "FCALL_RO":
 		index = 3
+	case "BITOP", "DEBUG", "OBJECT", "XGROUP", "XINFO", "LMPOP", "ZMPOP", "SINTERCARD":
+		index = 2
+	case "BLMPOP", "BZMPOP":
+		index = 3
+	case "XREAD", "XREADGROUP":
+		if i := streamsIndex(multi); i > 0 {
+			index = i + 1
+		}
 	}
-	if index < len(multi) {
-		return multi[index].Value
-	}
-	return nil
+	return index
 }
 
 func getWholeCmd(multi []*redis.Resp, cmd []byte) int {
@@ -344,7 +470,7 @@ func getWholeCmd(multi []*redis.Resp, cmd []byte) int {
 	for i := 0; i < len(multi); i++ {
 		if index < len(cmd) {
 			index += copy(cmd[index:], multi[i].Value)
-			if i < len(multi)-i {
+			if i < len(multi)-1 {
 				index += copy(cmd[index:], []byte(" "))
 			}
 		}
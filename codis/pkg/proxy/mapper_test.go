@@ -4,6 +4,7 @@
 package proxy
 
 import (
+	"strings"
 	"testing"
 
 	"pika/codis/v2/pkg/proxy/redis"
@@ -163,3 +164,103 @@ func TestHashSlot(t *testing.T) {
 		assert.Must(i == j)
 	}
 }
+
+func TestHashTag(t *testing.T) {
+	SetHashTag('[', ']')
+	defer SetHashTag('{', '}')
+	for k, v := range map[string]string{
+		"[abc]":    "abc",
+		"123[abc]": "abc",
+		"{abc}":    "{abc}",
+		"[]abc":    "",
+	} {
+		assert.Must(Hash([]byte(k)) == Hash([]byte(v)))
+	}
+}
+
+func TestHashModeCRC16(t *testing.T) {
+	SetHashFunc(crc16Hash{})
+	defer SetHashFunc(crc32Hash{})
+	for key, slot := range map[string]uint32{
+		"123456789":     12739,
+		"{user1000}.a":  3443,
+		"foo{}{bar}":    8363,
+		"foo{{bar}}zap": 4015,
+	} {
+		assert.Must(Hash([]byte(key))%ClusterSlotNum == slot)
+		assert.Must(uint32(clusterKeySlot([]byte(key))) == slot)
+	}
+}
+
+func TestEvalReadOnly(t *testing.T) {
+	for _, op := range []string{"eval_ro", "EVALSHA_RO", "FCALL_RO"} {
+		var multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte(op)),
+			redis.NewBulkBytes([]byte("return redis.call('get', KEYS[1])")),
+			redis.NewBulkBytes([]byte("1")),
+			redis.NewBulkBytes([]byte("key")),
+		}
+		s, flag, err := getOpInfo(multi)
+		assert.MustNoError(err)
+		assert.Must(flag.IsReadOnly() && !flag.IsNotAllowed())
+		assert.Must(string(getHashKey(multi, s)) == "key")
+	}
+}
+
+func TestBitFieldReadOnly(t *testing.T) {
+	var multi = []*redis.Resp{
+		redis.NewBulkBytes([]byte("bitfield_ro")),
+		redis.NewBulkBytes([]byte("key")),
+		redis.NewBulkBytes([]byte("GET")),
+		redis.NewBulkBytes([]byte("u8")),
+		redis.NewBulkBytes([]byte("0")),
+	}
+	s, flag, err := getOpInfo(multi)
+	assert.MustNoError(err)
+	assert.Must(s == "BITFIELD_RO")
+	assert.Must(flag.IsReadOnly() && !flag.IsNotAllowed())
+	assert.Must(string(getHashKey(multi, s)) == "key")
+}
+
+func TestSortReadOnly(t *testing.T) {
+	var multi = []*redis.Resp{
+		redis.NewBulkBytes([]byte("sort_ro")),
+		redis.NewBulkBytes([]byte("key")),
+	}
+	s, flag, err := getOpInfo(multi)
+	assert.MustNoError(err)
+	assert.Must(s == "SORT_RO")
+	assert.Must(flag.IsReadOnly() && !flag.IsNotAllowed())
+	assert.Must(string(getHashKey(multi, s)) == "key")
+}
+
+func TestHashKeyIndex(t *testing.T) {
+	for args, key := range map[string]string{
+		"XADD s * f v":                                   "s",
+		"XGROUP CREATE s g $":                            "s",
+		"XINFO STREAM s":                                 "s",
+		"XREAD COUNT 2 STREAMS {s}1 {s}2 0 0":            "{s}1",
+		"XREADGROUP GROUP streams c BLOCK 0 STREAMS s >": "s",
+		"LMPOP 2 l1 l2 LEFT":                             "l1",
+		"SINTERCARD 1 s":                                 "s",
+		"BZMPOP 0 1 z MIN":                               "z",
+		"BITOP AND {b}d {b}1 {b}2":                       "{b}d",
+	} {
+		var multi []*redis.Resp
+		for _, arg := range strings.Fields(args) {
+			multi = append(multi, redis.NewBulkBytes([]byte(arg)))
+		}
+		s, flag, err := getOpInfo(multi)
+		assert.MustNoError(err)
+		assert.Must(!flag.IsNotAllowed())
+		assert.Must(string(getHashKey(multi, s)) == key)
+	}
+}
+
+func TestNewReadCommands(t *testing.T) {
+	for _, op := range []string{"SMISMEMBER", "zrandmember", "HRANDFIELD", "LPOS"} {
+		_, flag, err := getOpInfo([]*redis.Resp{redis.NewBulkBytes([]byte(op))})
+		assert.MustNoError(err)
+		assert.Must(flag.IsReadOnly() && !flag.IsMasterOnly())
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+// The policies of proxy_max_clients_policy, i.e. what to do with a new client
+// when proxy_max_clients is reached.
+const (
+	MaxClientsReject        = "reject"
+	MaxClientsEvictIdle     = "evict-idle"
+	MaxClientsEvictPriority = "evict-priority"
+)
+
+var ErrEvictedSession = errors.New("session evicted by max clients policy")
+
+func checkMaxClientsPolicy(policy string) error {
+	switch policy {
+	case MaxClientsReject, MaxClientsEvictIdle, MaxClientsEvictPriority:
+		return nil
+	}
+	return errors.Errorf("invalid max clients policy '%s'", policy)
+}
+
+// liveSessions are the sessions started, which are candidates to evict.
+// Sessions evicted are removed at once, and counted in evicting until their
+// loops exit, so that they aren't evicted or counted twice.
+var liveSessions struct {
+	sync.Mutex
+	m        map[*Session]struct{}
+	evicting int64
+}
+
+// admit counts the session in the alive sessions, and evicts another session
+// as of the policy if proxy_max_clients is reached. It returns false if the
+// session is rejected, i.e. no session is allowed to evict.
+func (s *Session) admit() bool {
+	var alive = incrSessions()
+	liveSessions.Lock()
+	defer liveSessions.Unlock()
+	if alive-liveSessions.evicting > int64(s.config.ProxyMaxClients) {
+		var victim *Session
+		switch s.config.ProxyMaxClientsPolicy {
+		case MaxClientsEvictIdle:
+			victim = pickEvictSession(false)
+			if victim != nil && time.Now().Unix()-victim.lastActive() < int64(s.config.ProxyMaxClientsEvictIdle.Duration()/time.Second) {
+				victim = nil
+			}
+		case MaxClientsEvictPriority:
+			victim = pickEvictSession(true)
+			if victim != nil && victim.priority.Int64() >= s.config.ProxyMaxClientsEvictPriority {
+				victim = nil
+			}
+		}
+		if victim == nil {
+			sessions.rejected.Incr()
+			decrSessions()
+			return false
+		}
+		delete(liveSessions.m, victim)
+		victim.evicted = true
+		liveSessions.evicting++
+		sessions.evicted.Incr()
+		log.Warnf("session [%p] evicted by max clients policy: %s", victim, victim)
+		go victim.CloseWithError(ErrEvictedSession)
+	}
+	if liveSessions.m == nil {
+		liveSessions.m = make(map[*Session]struct{})
+	}
+	liveSessions.m[s] = struct{}{}
+	return true
+}
+
+// leave is the reverse of admit, once the session is closed.
+func (s *Session) leave() {
+	liveSessions.Lock()
+	if s.evicted {
+		liveSessions.evicting--
+	} else {
+		delete(liveSessions.m, s)
+	}
+	liveSessions.Unlock()
+	decrSessions()
+}
+
+func (s *Session) lastActive() int64 {
+	if t := atomic.LoadInt64(&s.LastOpUnix); t != 0 {
+		return t
+	}
+	return s.CreateUnix
+}
+
+// pickEvictSession returns the session idle for the longest time, or the one
+// of the lowest ACL priority if byPriority, with ties broken by idle time.
+func pickEvictSession(byPriority bool) *Session {
+	var victim *Session
+	var priority, active int64
+	for x := range liveSessions.m {
+		var p, t = x.priority.Int64(), x.lastActive()
+		switch {
+		case victim == nil:
+		case byPriority && p != priority:
+			if p > priority {
+				continue
+			}
+		case t >= active:
+			continue
+		}
+		victim, priority, active = x, p, t
+	}
+	return victim
+}
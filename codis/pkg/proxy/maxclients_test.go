@@ -0,0 +1,58 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestMaxClientsPolicy(t *testing.T) {
+	config := NewDefaultConfig()
+	config.ProxyMaxClients = 2
+
+	newSession := func(lastop, priority int64) *Session {
+		c, _ := net.Pipe()
+		s := NewSession(c, config, nil)
+		s.LastOpUnix = lastop
+		s.priority.Set(priority)
+		return s
+	}
+	var rejected, evicted = SessionsRejected(), SessionsEvicted()
+
+	config.ProxyMaxClientsPolicy = MaxClientsReject
+	s1, s2 := newSession(100, 1), newSession(200, 0)
+	assert.Must(s1.admit() && s2.admit())
+	assert.Must(!newSession(300, 0).admit())
+	assert.Must(SessionsRejected() == rejected+1)
+
+	config.ProxyMaxClientsPolicy = MaxClientsEvictIdle
+	s3 := newSession(300, 0)
+	assert.Must(s3.admit())
+	assert.Must(s1.evicted && !s2.evicted)
+
+	config.ProxyMaxClientsPolicy = MaxClientsEvictPriority
+	s4 := newSession(400, 5)
+	assert.Must(s4.admit())
+	assert.Must(s2.evicted && !s3.evicted)
+	assert.Must(SessionsEvicted() == evicted+2)
+
+	config.ProxyMaxClientsEvictPriority = 0
+	assert.Must(!newSession(500, -1).admit())
+
+	config.ProxyMaxClientsPolicy = MaxClientsEvictIdle
+	s3.LastOpUnix, s4.LastOpUnix = time.Now().Unix(), time.Now().Unix()
+	assert.Must(!newSession(600, 0).admit())
+	assert.Must(!s3.evicted && !s4.evicted)
+	assert.Must(SessionsRejected() == rejected+3 && SessionsEvicted() == evicted+2)
+
+	for _, s := range []*Session{s1, s2, s3, s4} {
+		s.leave()
+	}
+	assert.Must(liveSessions.evicting == 0 && len(liveSessions.m) == 0)
+	assert.Must(checkMaxClientsPolicy("evict-random") != nil)
+}
@@ -126,27 +126,47 @@ func (p *Proxy) startMetricsStatsd() {
 	}
 	period = math2.MaxDuration(time.Second, period)
 
-	c, err := statsdClient.New(statsdClient.Address(server))
+	var (
+		prefix   = p.config.MetricsReportStatsdPrefix
+		replacer = strings.NewReplacer(".", "_", ":", "_")
+	)
+
+	model := p.Model()
+	segs := []string{
+		prefix, model.ProductName,
+		replacer.Replace(model.AdminAddr),
+		replacer.Replace(model.ProxyAddr),
+	}
+	opts := []statsdClient.Option{statsdClient.Address(server)}
+
+	format, tagged := statsdTagsFormat(p.config.MetricsReportStatsdFormat)
+	if tagged {
+		// The proxy is identified by the tags, rather than the segments of
+		// the names of metrics.
+		tags := []string{
+			"product_name", model.ProductName,
+			"admin_addr", model.AdminAddr,
+			"proxy_addr", model.ProxyAddr,
+		}
+		tags = append(tags, parseStatsdTags(p.config.MetricsReportStatsdTags)...)
+		opts = append(opts, statsdClient.TagsFormat(format), statsdClient.Tags(tags...))
+		segs = nil
+		if prefix != "" {
+			segs = []string{prefix}
+		}
+	}
+
+	c, err := statsdClient.New(opts...)
 	if err != nil {
 		log.WarnErrorf(err, "create statsd client failed")
 		return
 	}
 
-	var (
-		prefix   = p.config.MetricsReportStatsdPrefix
-		replacer = strings.NewReplacer(".", "_", ":", "_")
-	)
+	var last = make(map[string]*OpStats)
 
 	p.startMetricsReporter(period, func() error {
-		model := p.Model()
 		stats := p.Stats(StatsRuntime)
 
-		segs := []string{
-			prefix, model.ProductName,
-			replacer.Replace(model.AdminAddr),
-			replacer.Replace(model.ProxyAddr),
-		}
-
 		fields := map[string]interface{}{
 			"ops_total":                stats.Ops.Total,
 			"ops_fails":                stats.Ops.Fails,
@@ -166,9 +186,65 @@ func (p *Proxy) startMetricsStatsd() {
 		for key, value := range fields {
 			c.Gauge(strings.Join(append(segs, key), "."), value)
 		}
+
+		// The calls and the average duration of each command since the last
+		// report, as counters and timings in ms.
+		for _, o := range GetOpStatsAll() {
+			if o.OpStr == "ALL" {
+				continue
+			}
+			var calls, usecs, fails = o.Calls, o.Usecs, o.Fails
+			if x := last[o.OpStr]; x != nil && x.Calls <= calls {
+				calls, usecs, fails = calls-x.Calls, usecs-x.Usecs, fails-x.Fails
+			}
+			last[o.OpStr] = o
+			if calls <= 0 && fails <= 0 {
+				continue
+			}
+			var cmd, name = c, append(segs[:len(segs):len(segs)], "cmd")
+			if tagged {
+				cmd = c.Clone(statsdClient.Tags("cmd", o.OpStr))
+			} else {
+				name = append(name, strings.ToLower(o.OpStr))
+			}
+			cmd.Count(strings.Join(append(name, "calls"), "."), calls)
+			if fails > 0 {
+				cmd.Count(strings.Join(append(name, "fails"), "."), fails)
+			}
+			if calls > 0 {
+				cmd.Timing(strings.Join(append(name, "duration"), "."), float64(usecs)/float64(calls)/1e3)
+			}
+		}
 		return nil
 	}, func() error {
 		c.Close()
 		return nil
 	})
 }
+
+func statsdTagsFormat(format string) (statsdClient.TagFormat, bool) {
+	switch strings.ToLower(format) {
+	case "dogstatsd", "datadog":
+		return statsdClient.Datadog, true
+	case "influxdb":
+		return statsdClient.InfluxDB, true
+	}
+	return 0, false
+}
+
+// parseStatsdTags parses the tags as "key:value" separated by commas, into
+// pairs of keys and values.
+func parseStatsdTags(s string) []string {
+	var tags []string
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		var k, v = kv, ""
+		if i := strings.IndexByte(kv, ':'); i >= 0 {
+			k, v = kv[:i], kv[i+1:]
+		}
+		tags = append(tags, strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return tags
+}
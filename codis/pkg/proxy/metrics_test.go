@@ -0,0 +1,49 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestParseStatsdTags(t *testing.T) {
+	tags := parseStatsdTags(" env:prod, ,idc:bj:1,solo")
+	assert.Must(strings.Join(tags, "|") == "env|prod|idc|bj:1|solo|")
+}
+
+func TestMetricsStatsdTags(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	defer l.Close()
+
+	var conf = *config
+	conf.MetricsReportStatsdServer = l.LocalAddr().String()
+	conf.MetricsReportStatsdPrefix = "codis"
+	conf.MetricsReportStatsdFormat = "dogstatsd"
+	conf.MetricsReportStatsdTags = "env:test"
+
+	getOpStats("STATSDGET", true).incrOpStats(int64(time.Millisecond*2), 0)
+
+	p, err := New(&conf)
+	assert.MustNoError(err)
+	defer p.Close()
+
+	var text string
+	var b = make([]byte, 65536)
+	l.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for !strings.Contains(text, "cmd:STATSDGET") {
+		n, _, err := l.ReadFrom(b)
+		assert.MustNoError(err)
+		text += string(b[:n])
+	}
+	assert.Must(strings.Contains(text, "codis.ops_total:"))
+	assert.Must(strings.Contains(text, "env:test"))
+	assert.Must(strings.Contains(text, "product_name:"+conf.ProductName))
+	assert.Must(strings.Contains(text, "codis.cmd.duration:"))
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// monitors are the sessions of MONITOR, commands are streamed to them by the
+// proxy rather than the backends, which don't allow MONITOR.
+var monitors struct {
+	sync.RWMutex
+	sessions map[*Session]bool
+
+	count atomic2.Int64
+	seq   atomic2.Int64
+
+	ratio  atomic2.Int64
+	redact atomic2.Bool
+}
+
+func SetMonitorOptions(ratio int64, redact bool) {
+	monitors.ratio.Set(ratio)
+	monitors.redact.Set(redact)
+}
+
+// handleMonitor starts to stream the commands to the session once +OK is
+// replied, so that the commands are always sent after it.
+func (s *Session) handleMonitor(r *Request) error {
+	r.Resp = RespOK
+	r.Coalesce = func() error {
+		monitors.Lock()
+		defer monitors.Unlock()
+		if monitors.sessions == nil {
+			monitors.sessions = make(map[*Session]bool)
+		}
+		if !monitors.sessions[s] {
+			monitors.sessions[s] = true
+			monitors.count.Incr()
+		}
+		return nil
+	}
+	return nil
+}
+
+func (s *Session) stopMonitor() {
+	monitors.Lock()
+	defer monitors.Unlock()
+	if monitors.sessions[s] {
+		delete(monitors.sessions, s)
+		monitors.count.Decr()
+	}
+}
+
+// feedMonitors streams the command of the session to the monitors, in the
+// format of redis, e.g. +1339518083.107412 [0 127.0.0.1:60866] "get" "key".
+// As in redis, AUTH and HELLO are never streamed.
+func feedMonitors(s *Session, r *Request) {
+	if monitors.count.Int64() == 0 || r.OpStr == "MONITOR" {
+		return
+	}
+	if ratio := monitors.ratio.Int64(); ratio > 1 && monitors.seq.Incr()%ratio != 0 {
+		return
+	}
+	var multi = r.Multi
+	if monitors.redact.Bool() {
+		multi = redactArgs(r.OpStr, multi)
+	} else {
+		multi = redactPasswords(r.OpStr, multi)
+	}
+
+	var t = time.Unix(0, r.ReceiveTime)
+	var b = make([]byte, 0, 64)
+	b = strconv.AppendInt(b, t.Unix(), 10)
+	b = append(b, '.')
+	b = appendPadded(b, int64(t.Nanosecond()/1e3), 6)
+	b = append(b, " ["...)
+	b = strconv.AppendInt(b, int64(r.Database), 10)
+	b = append(b, ' ')
+	if s.Conn != nil {
+		b = append(b, s.Conn.RemoteAddr()...)
+	}
+	b = append(b, ']')
+	for _, arg := range multi {
+		b = append(b, ' ')
+		b = appendRepr(b, arg.Value)
+	}
+
+	monitors.RLock()
+	defer monitors.RUnlock()
+	for x := range monitors.sessions {
+		var m = &Request{Batch: &sync.WaitGroup{}}
+		m.Resp = redis.NewString(b)
+		m.ReceiveTime = r.ReceiveTime
+		x.tasks.PushBack(m)
+		x.chargeOutput(m, respSize(m.Resp), true)
+	}
+}
+
+func appendPadded(b []byte, n int64, width int) []byte {
+	var s = strconv.FormatInt(n, 10)
+	for i := len(s); i < width; i++ {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
+
+// appendRepr quotes the argument like sdscatrepr of redis.
+func appendRepr(b []byte, v []byte) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for _, c := range v {
+		switch c {
+		case '\\', '"':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		case '\a':
+			b = append(b, '\\', 'a')
+		case '\b':
+			b = append(b, '\\', 'b')
+		default:
+			if c < ' ' || c > '~' {
+				b = append(b, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return append(b, '"')
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"regexp"
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestMonitor(t *testing.T) {
+	SetMonitorOptions(1, true)
+	SetRedactRules("secret:*", "")
+	defer SetRedactRules("", "")
+
+	m := newTestSession()
+	m.tasks = NewRequestChanBuffer(16)
+	assert.Must(string(handleTestRequest(m, nil, "MONITOR").Value) == "OK")
+	defer m.stopMonitor()
+
+	pop := func() string {
+		r, ok := m.tasks.PopFront()
+		assert.Must(ok && r.Resp.IsString())
+		return string(r.Resp.Value)
+	}
+
+	s := newTestSession()
+	var r = newTestRequest("ECHO", "a\"b\n\xff")
+	r.OpStr, r.Database = "ECHO", 3
+	feedMonitors(s, r)
+	assert.Must(regexp.MustCompile(`^\d+\.\d{6} \[3 \] "ECHO" "a\\"b\\n\\xff"$`).MatchString(pop()))
+
+	handleTestRequest(s, nil, "AUTH", "password")
+	assert.Must(m.tasks.IsEmpty())
+
+	r = newTestRequest("SET", "secret:1", "v")
+	r.OpStr = "SET"
+	feedMonitors(s, r)
+	assert.Must(regexp.MustCompile(`"SET" "secret:1" "\(redacted\)"$`).MatchString(pop()))
+	SetMonitorOptions(1, false)
+	feedMonitors(s, r)
+	assert.Must(regexp.MustCompile(`"SET" "secret:1" "v"$`).MatchString(pop()))
+
+	r = newTestRequest("ACL", "SETUSER", "u", "on", ">password")
+	r.OpStr = "ACL"
+	feedMonitors(s, r)
+	assert.Must(regexp.MustCompile(`"on" "\(redacted\)"$`).MatchString(pop()))
+
+	SetMonitorOptions(2, false)
+	for i := 0; i < 4; i++ {
+		handleTestRequest(s, nil, "CLIENT", "ID")
+	}
+	assert.Must(m.tasks.Buffered() == 2)
+	pop()
+	pop()
+	SetMonitorOptions(1, true)
+
+	m.stopMonitor()
+	assert.Must(monitors.count.Int64() == 0)
+	handleTestRequest(s, nil, "CLIENT", "ID")
+	assert.Must(m.tasks.IsEmpty())
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// handleRequestMSetNX forwards MSETNX if all keys belong to the same slot.
+// Otherwise, if msetnx_two_phase_enabled, the keys are probed with EXISTS
+// first, and then set one by one with SET if none of them exists, so that each
+// key is migrated first if its slot is being migrated. Keys created by other
+// clients between the two phases are overwritten.
+func (s *Session) handleRequestMSetNX(r *Request, d *Router) error {
+	var nblks = len(r.Multi) - 1
+	if nblks == 0 || nblks%2 != 0 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'MSETNX' command")
+		return nil
+	}
+	var keys = make([]*redis.Resp, 0, nblks/2)
+	for i := 1; i < len(r.Multi); i += 2 {
+		keys = append(keys, r.Multi[i])
+	}
+	switch {
+	case d.isSameSlot(keys):
+		return d.dispatch(r)
+	case !s.config.MSetNXTwoPhaseEnabled:
+		r.Resp = redis.NewErrorf("ERR keys in 'MSETNX' command must be in the same slot")
+		return nil
+	}
+	r.Coalesce = func() error {
+		var names = make([]string, len(keys))
+		for i := range keys {
+			names[i] = string(keys[i].Value)
+		}
+		defer d.locks.lock(names...)()
+
+		exists, err := s.dispatchEachKey(r, d, keys, "EXISTS")
+		if err != nil {
+			return err
+		}
+		for _, resp := range exists {
+			switch {
+			case resp.IsError():
+				r.Resp = resp
+				return nil
+			case string(resp.Value) != "0":
+				r.Resp = redis.NewInt([]byte("0"))
+				return nil
+			}
+		}
+
+		var wg = &sync.WaitGroup{}
+		var sub = r.MakeSubRequest(len(keys))
+		for i := range sub {
+			sub[i].Batch = wg
+			sub[i].OpStr = "SET"
+			sub[i].Multi = []*redis.Resp{redis.NewBulkBytes([]byte("SET")), r.Multi[i*2+1], r.Multi[i*2+2]}
+			if err := d.dispatch(&sub[i]); err != nil {
+				wg.Wait()
+				return err
+			}
+		}
+		wg.Wait()
+		for i := range sub {
+			switch {
+			case sub[i].Err != nil:
+				return sub[i].Err
+			case sub[i].Resp == nil:
+				return ErrRespIsRequired
+			case sub[i].Resp.IsError():
+				r.Resp = sub[i].Resp
+				return nil
+			}
+		}
+		r.Resp = redis.NewInt([]byte("1"))
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestMSetNXTwoPhase(t *testing.T) {
+	var mu sync.Mutex
+	var data = map[string]string{}
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "EXISTS":
+			if _, ok := data[string(multi[1].Value)]; ok {
+				return redis.NewInt([]byte("1"))
+			}
+			return redis.NewInt([]byte("0"))
+		case "SET":
+			data[string(multi[1].Value)] = string(multi[2].Value)
+			return redis.NewString([]byte("OK"))
+		case "MSETNX":
+			return redis.NewInt([]byte("1"))
+		default:
+			return redis.NewErrorf("ERR unexpected %s", multi[0].Value)
+		}
+	}
+	b1, b2 := newFakeBackend(handler), newFakeBackend(handler)
+	defer b1.Close()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	enabled := config.MSetNXTwoPhaseEnabled
+	defer func() {
+		config.MSetNXTwoPhaseEnabled = enabled
+	}()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "MSETNX", "{k}1", "v", "{k}2", "v").IsInt())
+	assert.Must(handleTestRequest(s, d, "MSETNX", "a", "1", "b", "2").IsError())
+	assert.Must(handleTestRequest(s, d, "MSETNX", "a", "1", "b").IsError())
+
+	config.MSetNXTwoPhaseEnabled = true
+	resp := handleTestRequest(s, d, "MSETNX", "a", "1", "b", "2", "c", "3")
+	assert.Must(resp.IsInt() && string(resp.Value) == "1")
+	mu.Lock()
+	assert.Must(data["a"] == "1" && data["b"] == "2" && data["c"] == "3")
+	mu.Unlock()
+
+	resp = handleTestRequest(s, d, "MSETNX", "x", "1", "c", "4")
+	assert.Must(resp.IsInt() && string(resp.Value) == "0")
+	mu.Lock()
+	_, ok := data["x"]
+	assert.Must(!ok && data["c"] == "3")
+	mu.Unlock()
+}
@@ -0,0 +1,265 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// A namespace confines the keys and channels of an ACL user, set by the rule
+// "namespace:<prefix>", to the prefix. The proxy prepends the prefix to the
+// keys and channels of requests, and strips it from the replies and messages
+// where they appear, e.g. KEYS, SCAN, BLPOP, XREAD and keyspace notifications.
+//
+// Commands working on the whole keyspace, or on keys not given as arguments,
+// are refused.
+var namespaceDenied = map[string]bool{
+	"RANDOMKEY": true, "DBSIZE": true, "FLUSHALL": true, "FLUSHDB": true,
+	"EVAL": true, "EVALSHA": true, "EVAL_RO": true, "EVALSHA_RO": true,
+	"FCALL": true, "FCALL_RO": true, "SCRIPT": true, "FUNCTION": true,
+	"PUBSUB": true, "XMONITOR": true, "MONITOR": true, "PFDEBUG": true,
+	"CLIENT": true, "SLOWLOG": true, "XSLOWLOG": true, "DEBUG": true,
+	"PCONFIG": true, "XCONFIG": true, "LATENCY": true,
+	"SLOTSINFO": true, "SLOTSSCAN": true, "SLOTSRESTORE": true,
+}
+
+const (
+	keyspaceChannel = "__keyspace@"
+	keyeventChannel = "__keyevent@"
+)
+
+func checkNamespace(prefix string) error {
+	switch {
+	case prefix == "":
+		return fmt.Errorf("The namespace must not be empty")
+	case strings.ContainsAny(prefix, "{}"):
+		return fmt.Errorf("The namespace must not contain '{' or '}'")
+	case strings.IndexByte(prefix, hashing.beg) >= 0 || strings.IndexByte(prefix, hashing.end) >= 0:
+		return fmt.Errorf("The namespace must not contain '%c' or '%c' of hash_tag", hashing.beg, hashing.end)
+	}
+	return nil
+}
+
+// globEscape escapes the special characters of glob-style patterns.
+func globEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func prependBytes(prefix string, value []byte) []byte {
+	var b = make([]byte, 0, len(prefix)+len(value))
+	return append(append(b, prefix...), value...)
+}
+
+// applyNamespace rewrites the keys and channels of the request in place. It
+// returns the error reply if the request isn't allowed in a namespace.
+func applyNamespace(r *Request, ns string) *redis.Resp {
+	if namespaceDenied[r.OpStr] || !isKnownOp(r.OpStr) {
+		return redis.NewErrorf("ERR command '%s' is not allowed in a namespace", strings.ToLower(r.OpStr))
+	}
+	r.Namespace = ns
+
+	var args = r.Multi[1:]
+	switch r.OpStr {
+	case "PUBLISH":
+		if len(args) != 0 {
+			args[0].Value = namespaceChannel(ns, args[0].Value, false)
+		}
+		return nil
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		var pattern = r.OpStr[0] == 'P'
+		for _, c := range args {
+			c.Value = namespaceChannel(ns, c.Value, pattern)
+		}
+		return nil
+	case "KEYS":
+		if len(args) == 1 {
+			args[0].Value = prependBytes(globEscape(ns), args[0].Value)
+		}
+		return nil
+	case "SCAN":
+		namespaceScan(r, ns)
+		return nil
+	case "SORT", "SORT_RO":
+		namespaceSort(r, ns)
+	}
+	for _, k := range aclKeys(r.Multi, r.OpStr) {
+		k.Value = prependBytes(ns, k.Value)
+	}
+	return nil
+}
+
+// namespaceScan confines the MATCH pattern of SCAN to the namespace, or adds
+// one if it's not given.
+func namespaceScan(r *Request, ns string) {
+	for i := 2; i+1 < len(r.Multi); i += 2 {
+		if strings.EqualFold(string(r.Multi[i].Value), "MATCH") {
+			r.Multi[i+1].Value = prependBytes(globEscape(ns), r.Multi[i+1].Value)
+			return
+		}
+	}
+	if len(r.Multi) >= 2 {
+		r.Multi = append(r.Multi,
+			redis.NewBulkBytes([]byte("MATCH")),
+			redis.NewBulkBytes([]byte(globEscape(ns)+"*")),
+		)
+	}
+}
+
+// namespaceSort prepends the namespace to the patterns of BY and GET, the key
+// and the destination of STORE are done as other commands.
+func namespaceSort(r *Request, ns string) {
+	for i := 2; i+1 < len(r.Multi); i++ {
+		var arg = r.Multi[i+1]
+		switch strings.ToUpper(string(r.Multi[i].Value)) {
+		case "BY":
+			if !strings.EqualFold(string(arg.Value), "nosort") {
+				arg.Value = prependBytes(ns, arg.Value)
+			}
+			i++
+		case "GET":
+			if string(arg.Value) != "#" {
+				arg.Value = prependBytes(ns, arg.Value)
+			}
+			i++
+		case "STORE":
+			i++
+		case "LIMIT":
+			i += 2
+		}
+	}
+}
+
+// namespaceChannel prepends the namespace to the channel or pattern. The key
+// of keyspace notifications gets the namespace, while channels of keyevent
+// notifications are kept, and messages of other namespaces are filtered out.
+func namespaceChannel(ns string, name []byte, pattern bool) []byte {
+	var prefix = ns
+	if pattern {
+		prefix = globEscape(ns)
+	}
+	switch {
+	case bytes.HasPrefix(name, []byte(keyeventChannel)):
+		return name
+	case bytes.HasPrefix(name, []byte(keyspaceChannel)):
+		if i := bytes.Index(name, []byte("__:")); i > 0 {
+			var b = append([]byte{}, name[:i+3]...)
+			return append(append(b, prefix...), name[i+3:]...)
+		}
+	}
+	return prependBytes(prefix, name)
+}
+
+// stripChannel is the reverse of namespaceChannel, it returns false if the
+// channel doesn't belong to the namespace.
+func stripChannel(ns string, name []byte, pattern bool) ([]byte, bool) {
+	var prefix = ns
+	if pattern {
+		prefix = globEscape(ns)
+	}
+	switch {
+	case bytes.HasPrefix(name, []byte(keyeventChannel)):
+		return name, true
+	case bytes.HasPrefix(name, []byte(keyspaceChannel)):
+		if i := bytes.Index(name, []byte("__:")); i > 0 {
+			if !bytes.HasPrefix(name[i+3:], []byte(prefix)) {
+				return name, false
+			}
+			var b = append([]byte{}, name[:i+3]...)
+			return append(b, name[i+3+len(prefix):]...), true
+		}
+	}
+	if !bytes.HasPrefix(name, []byte(prefix)) {
+		return name, false
+	}
+	return name[len(prefix):], true
+}
+
+func stripKey(ns string, key *redis.Resp) {
+	if key != nil && bytes.HasPrefix(key.Value, []byte(ns)) {
+		key.Value = key.Value[len(ns):]
+	}
+}
+
+// stripNamespaceReply strips the namespace from the keys and channels in the
+// reply of the command, the reply is modified in place.
+func stripNamespaceReply(ns string, opstr string, resp *redis.Resp) {
+	if resp == nil || resp.IsError() {
+		return
+	}
+	switch opstr {
+	case "KEYS":
+		for _, k := range resp.Array {
+			stripKey(ns, k)
+		}
+	case "SCAN":
+		if len(resp.Array) == 2 {
+			for _, k := range resp.Array[1].Array {
+				stripKey(ns, k)
+			}
+		}
+	case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX", "BLMPOP", "BZMPOP", "LMPOP", "ZMPOP":
+		if len(resp.Array) != 0 {
+			stripKey(ns, resp.Array[0])
+		}
+	case "XREAD", "XREADGROUP":
+		if resp.IsMap() {
+			for i := 0; i < len(resp.Array); i += 2 {
+				stripKey(ns, resp.Array[i])
+			}
+		} else {
+			for _, s := range resp.Array {
+				if len(s.Array) != 0 {
+					stripKey(ns, s.Array[0])
+				}
+			}
+		}
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		if len(resp.Array) == 3 && resp.Array[1].Value != nil {
+			resp.Array[1].Value, _ = stripChannel(ns, resp.Array[1].Value, opstr[0] == 'P')
+		}
+	}
+}
+
+// stripNamespaceMessage strips the namespace from the message pushed from
+// pubsub connections, it returns false if the message belongs to another
+// namespace, e.g. keyevent notifications of keys of other namespaces.
+func stripNamespaceMessage(ns string, array []*redis.Resp) bool {
+	var channel, payload = 1, 2
+	if strings.EqualFold(string(array[0].Value), "pmessage") {
+		if len(array) != 4 {
+			return false
+		}
+		name, ok := stripChannel(ns, array[1].Value, true)
+		if !ok {
+			return false
+		}
+		array[1].Value, channel, payload = name, 2, 3
+	} else if len(array) != 3 {
+		return false
+	}
+	name, ok := stripChannel(ns, array[channel].Value, false)
+	if !ok {
+		return false
+	}
+	array[channel].Value = name
+	if bytes.HasPrefix(name, []byte(keyeventChannel)) {
+		if !bytes.HasPrefix(array[payload].Value, []byte(ns)) {
+			return false
+		}
+		stripKey(ns, array[payload])
+	}
+	return true
+}
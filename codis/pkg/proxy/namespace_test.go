@@ -0,0 +1,136 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestNamespaceRequests(t *testing.T) {
+	resetACLUsers()
+	defer resetACLUsers()
+
+	var mu sync.Mutex
+	var last []string
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		var args []string
+		for _, m := range multi {
+			args = append(args, string(m.Value))
+		}
+		mu.Lock()
+		last = args
+		mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "SCAN":
+			return redis.NewArray([]*redis.Resp{
+				redis.NewBulkBytes([]byte("0")),
+				redis.NewArray([]*redis.Resp{redis.NewBulkBytes([]byte("t1:a"))}),
+			})
+		case "MGET":
+			return redis.NewArray([]*redis.Resp{redis.NewNull()})
+		}
+		return RespOK
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	lastArgs := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(last, " ")
+	}
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "ACL", "SETUSER", "t1", "on", "nopass", "allkeys",
+		"allchannels", "+@all", "namespace:t1:").IsString())
+	assert.Must(handleTestRequest(s, d, "ACL", "SETUSER", "t2", "namespace:a{b}").IsError())
+	assert.Must(strings.Contains(getACLUser("t1", config).String(), " namespace:t1: "))
+
+	a := newTestSession()
+	assert.Must(handleTestRequest(a, d, "AUTH", "t1", "").IsString())
+
+	assert.Must(handleTestRequest(a, d, "SET", "k", "v").IsString())
+	assert.Must(lastArgs() == "SET t1:k v")
+	assert.Must(handleTestRequest(a, d, "MSET", "k1", "v1", "k2", "v2").IsString())
+	assert.Must(lastArgs() == "MSET t1:k2 v2")
+	handleTestRequest(a, d, "MGET", "k1")
+	assert.Must(lastArgs() == "MGET t1:k1")
+
+	resp := handleTestRequest(a, d, "SCAN", "0")
+	assert.Must(lastArgs() == "SCAN 0 MATCH t1:*")
+	assert.Must(string(resp.Array[1].Array[0].Value) == "a")
+	handleTestRequest(a, d, "SCAN", "0", "MATCH", "x*", "COUNT", "10")
+	assert.Must(lastArgs() == "SCAN 0 MATCH t1:x* COUNT 10")
+
+	assert.Must(handleTestRequest(a, d, "SORT", "l", "BY", "w_*", "GET", "#", "GET", "o_*").IsString())
+	assert.Must(lastArgs() == "SORT t1:l BY t1:w_* GET # GET t1:o_*")
+	assert.Must(handleTestRequest(a, d, "SORT", "l", "LIMIT", "0", "1", "STORE", "d").IsString())
+	assert.Must(lastArgs() == "SORT t1:l LIMIT 0 1 STORE t1:d")
+	assert.Must(handleTestRequest(a, d, "GEORADIUS", "g", "0", "0", "1", "km", "STORE", "d").IsString())
+	assert.Must(lastArgs() == "GEORADIUS t1:g 0 0 1 km STORE t1:d")
+
+	for _, cmd := range []string{"FLUSHALL", "DBSIZE", "RANDOMKEY", "UNKNOWNCMD", "MONITOR", "SLOWLOG", "XSLOWLOG",
+		"PCONFIG", "XCONFIG", "LATENCY"} {
+		assert.Must(handleTestRequest(a, d, cmd).IsError())
+	}
+	assert.Must(handleTestRequest(a, d, "EVAL", "return 1", "0").IsError())
+	assert.Must(handleTestRequest(a, d, "CLIENT", "LIST").IsError())
+	assert.Must(handleTestRequest(a, d, "DEBUG", "OBJECT", "k").IsError())
+
+	SetHashTag('[', ']')
+	defer SetHashTag('{', '}')
+	assert.Must(checkNamespace("t1:") == nil)
+	assert.Must(checkNamespace("t[1]:") != nil && checkNamespace("t{1}:") != nil)
+}
+
+func TestNamespaceReplies(t *testing.T) {
+	var bulks = func(args ...string) []*redis.Resp {
+		var array []*redis.Resp
+		for _, arg := range args {
+			array = append(array, redis.NewBulkBytes([]byte(arg)))
+		}
+		return array
+	}
+
+	resp := redis.NewArray(bulks("t1:list", "v"))
+	stripNamespaceReply("t1:", "BLPOP", resp)
+	assert.Must(string(resp.Array[0].Value) == "list")
+
+	resp = redis.NewArray([]*redis.Resp{
+		redis.NewArray([]*redis.Resp{redis.NewBulkBytes([]byte("t1:s")), redis.NewArray(nil)}),
+	})
+	stripNamespaceReply("t1:", "XREAD", resp)
+	assert.Must(string(resp.Array[0].Array[0].Value) == "s")
+
+	resp = redis.NewArray(bulks("subscribe", "__keyspace@0__:t1:k"))
+	resp.Array = append(resp.Array, redis.NewInt([]byte("1")))
+	stripNamespaceReply("t1:", "SUBSCRIBE", resp)
+	assert.Must(string(resp.Array[1].Value) == "__keyspace@0__:k")
+
+	assert.Must(string(namespaceChannel("t1:", []byte("news"), false)) == "t1:news")
+	assert.Must(string(namespaceChannel("t*", []byte("n*"), true)) == "t\\*n*")
+	assert.Must(string(namespaceChannel("t1:", []byte("__keyspace@0__:k*"), true)) == "__keyspace@0__:t1:k*")
+	assert.Must(string(namespaceChannel("t1:", []byte("__keyevent@0__:del"), false)) == "__keyevent@0__:del")
+
+	msg := bulks("message", "t1:news", "hi")
+	assert.Must(stripNamespaceMessage("t1:", msg) && string(msg[1].Value) == "news")
+	msg = bulks("message", "t2:news", "hi")
+	assert.Must(!stripNamespaceMessage("t1:", msg))
+
+	msg = bulks("pmessage", "__keyspace@0__:t1:*", "__keyspace@0__:t1:k", "set")
+	assert.Must(stripNamespaceMessage("t1:", msg))
+	assert.Must(string(msg[1].Value) == "__keyspace@0__:*" && string(msg[2].Value) == "__keyspace@0__:k")
+
+	msg = bulks("message", "__keyevent@0__:del", "t1:k")
+	assert.Must(stripNamespaceMessage("t1:", msg) && string(msg[2].Value) == "k")
+	msg = bulks("message", "__keyevent@0__:del", "t2:k")
+	assert.Must(!stripNamespaceMessage("t1:", msg))
+}
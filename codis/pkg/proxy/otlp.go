@@ -0,0 +1,252 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/utils/math2"
+	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// requestTrace is the trace of a request sampled, from it's received by the
+// session until the reply is written, with a span for each time it's sent
+// to a backend, including the sub-requests.
+type requestTrace struct {
+	mu sync.Mutex
+
+	slot     int
+	backends []*backendSpan
+}
+
+// backendSpan is the span of a request sent to a backend, from it's pushed
+// to the backend conn until the reply is received. The time waiting in the
+// queue of the backend conn is the time from enqueue to send.
+type backendSpan struct {
+	addr  string
+	start int64
+	send  atomic2.Int64
+	reply atomic2.Int64
+}
+
+var tracing struct {
+	ratio atomic2.Int64
+	seq   atomic2.Int64
+
+	queue   chan *otlpSpans
+	dropped atomic2.Int64
+}
+
+func init() {
+	tracing.queue = make(chan *otlpSpans, 4096)
+}
+
+// sampleTrace returns the trace of one of every tracing_sample_ratio requests,
+// or nil if it isn't sampled.
+func sampleTrace() *requestTrace {
+	var ratio = tracing.ratio.Int64()
+	if ratio <= 0 || tracing.seq.Incr()%ratio != 0 {
+		return nil
+	}
+	return &requestTrace{slot: -1}
+}
+
+func (t *requestTrace) setSlot(id int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.slot = id
+	t.mu.Unlock()
+}
+
+func (t *requestTrace) addBackend(addr string) *backendSpan {
+	var span = &backendSpan{addr: addr, start: time.Now().UnixNano()}
+	t.mu.Lock()
+	t.backends = append(t.backends, span)
+	t.mu.Unlock()
+	return span
+}
+
+// otlpSpans are the spans of a trace, encoded as JSON of OTLP/HTTP.
+type otlpSpans []*otlpSpan
+
+type otlpSpan struct {
+	TraceId      string          `json:"traceId"`
+	SpanId       string          `json:"spanId"`
+	ParentSpanId string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+	} `json:"value"`
+}
+
+const (
+	otlpSpanKindServer = 2
+	otlpSpanKindClient = 3
+	otlpStatusError    = 2
+)
+
+func otlpString(key, value string) otlpAttribute {
+	var a = otlpAttribute{Key: key}
+	a.Value.StringValue = &value
+	return a
+}
+
+func otlpInt(key string, value int64) otlpAttribute {
+	var a = otlpAttribute{Key: key}
+	var s = strconv.FormatInt(value, 10)
+	a.Value.IntValue = &s
+	return a
+}
+
+func otlpRandomId(n int) string {
+	var b = make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// finishTrace queues the spans of the request once its reply is written, the
+// spans are dropped if the exporter falls behind.
+func (s *Session) finishTrace(r *Request, failed bool) {
+	var t = r.trace
+	var now = time.Now().UnixNano()
+	var traceId = otlpRandomId(16)
+
+	var root = &otlpSpan{
+		TraceId: traceId, SpanId: otlpRandomId(8),
+		Name: r.OpStr, Kind: otlpSpanKindServer,
+		Start: strconv.FormatInt(r.ReceiveTime, 10),
+		End:   strconv.FormatInt(now, 10),
+	}
+	root.Attributes = []otlpAttribute{
+		otlpString("db.system", "redis"),
+		otlpString("db.operation", r.OpStr),
+		otlpInt("db.redis.database_index", int64(r.Database)),
+		otlpString("net.peer.name", s.Conn.RemoteAddr()),
+		otlpInt("codis.session.id", s.id),
+	}
+	if failed {
+		root.Status.Code = otlpStatusError
+	}
+	var spans = otlpSpans{root}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.slot >= 0 {
+		root.Attributes = append(root.Attributes, otlpInt("codis.slot", int64(t.slot)))
+	}
+	for _, b := range t.backends {
+		var span = &otlpSpan{
+			TraceId: traceId, SpanId: otlpRandomId(8), ParentSpanId: root.SpanId,
+			Name: r.OpStr, Kind: otlpSpanKindClient,
+			Start: strconv.FormatInt(b.start, 10),
+		}
+		span.Attributes = []otlpAttribute{
+			otlpString("db.system", "redis"),
+			otlpString("net.peer.name", b.addr),
+		}
+		var send, reply = b.send.Int64(), b.reply.Int64()
+		if send != 0 {
+			span.Attributes = append(span.Attributes, otlpInt("codis.queue_wait_us", (send-b.start)/1e3))
+		}
+		if reply != 0 {
+			span.End = strconv.FormatInt(reply, 10)
+			if send != 0 {
+				span.Attributes = append(span.Attributes, otlpInt("codis.rtt_us", (reply-send)/1e3))
+			}
+		} else {
+			span.End = root.End
+			span.Status.Code = otlpStatusError
+		}
+		spans = append(spans, span)
+	}
+
+	select {
+	case tracing.queue <- &spans:
+	default:
+		tracing.dropped.Incr()
+	}
+}
+
+// startTracingExporter exports the spans of the requests sampled to the
+// OTLP/HTTP endpoint in JSON, e.g. http://localhost:4318/v1/traces.
+func (p *Proxy) startTracingExporter() {
+	endpoint := p.config.TracingOtlpEndpoint
+	period := p.config.TracingExportPeriod.Duration()
+	if endpoint == "" {
+		return
+	}
+	period = math2.MaxDuration(time.Millisecond*100, period)
+	tracing.ratio.Set(p.config.TracingSampleRatio)
+
+	model := p.Model()
+	resource := []otlpAttribute{
+		otlpString("service.name", "codis-proxy"),
+		otlpString("service.instance.id", model.Token),
+		otlpString("codis.product_name", model.ProductName),
+		otlpString("codis.proxy_addr", model.ProxyAddr),
+	}
+
+	p.startMetricsReporter(period, func() error {
+		var spans []*otlpSpan
+		for len(spans) < 8192 {
+			select {
+			case x := <-tracing.queue:
+				spans = append(spans, *x...)
+				continue
+			default:
+			}
+			break
+		}
+		if len(spans) == 0 {
+			return nil
+		}
+		return rpc.ApiPostJson(endpoint, newOtlpRequest(resource, spans))
+	}, nil)
+}
+
+func newOtlpRequest(resource []otlpAttribute, spans []*otlpSpan) interface{} {
+	type scopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []*otlpSpan `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []*scopeSpans `json:"scopeSpans"`
+	}
+	var scope = &scopeSpans{Spans: spans}
+	scope.Scope.Name = "pika/codis/proxy"
+	var x = &resourceSpans{ScopeSpans: []*scopeSpans{scope}}
+	x.Resource.Attributes = resource
+	return map[string]interface{}{
+		"resourceSpans": []*resourceSpans{x},
+	}
+}
+
+func GetTracingDropped() int64 {
+	return tracing.dropped.Int64()
+}
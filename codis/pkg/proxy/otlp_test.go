@@ -0,0 +1,88 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/timesize"
+)
+
+func TestTracingExport(t *testing.T) {
+	var bodies = make(chan []byte, 16)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		bodies <- b
+	}))
+	defer collector.Close()
+
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes([]byte("v"))
+	})
+	defer backend.Close()
+
+	var conf = *config
+	conf.TracingOtlpEndpoint = collector.URL + "/v1/traces"
+	conf.TracingSampleRatio = 1
+	conf.TracingExportPeriod = timesize.Duration(time.Millisecond * 100)
+
+	p, err := New(&conf)
+	assert.MustNoError(err)
+	defer p.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(p.router.FillSlot(&models.Slot{Id: i, BackendAddr: backend.Addr()}))
+	}
+	assert.MustNoError(p.Start())
+
+	c, err := redis.DialTimeout(p.Model().ProxyAddr, time.Second*5, 1024, 1024)
+	assert.MustNoError(err)
+	defer c.Close()
+	assert.MustNoError(c.EncodeMultiBulk([]*redis.Resp{
+		redis.NewBulkBytes([]byte("GET")), redis.NewBulkBytes([]byte("key")),
+	}, true))
+	resp, err := c.Decode()
+	assert.MustNoError(err)
+	assert.Must(string(resp.Value) == "v")
+
+	var x struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceId      string `json:"traceId"`
+					ParentSpanId string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Attributes   []struct {
+						Key string `json:"key"`
+					} `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	select {
+	case b := <-bodies:
+		assert.MustNoError(json.Unmarshal(b, &x))
+	case <-time.After(time.Second * 5):
+		t.Fatal("no spans exported")
+	}
+	var spans = x.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Must(len(spans) == 2)
+	assert.Must(spans[0].Name == "GET" && spans[0].ParentSpanId == "")
+	assert.Must(spans[1].TraceId == spans[0].TraceId && spans[1].ParentSpanId != "")
+
+	var keys = make(map[string]bool)
+	for _, a := range append(spans[0].Attributes, spans[1].Attributes...) {
+		keys[a.Key] = true
+	}
+	for _, key := range []string{"codis.slot", "net.peer.name", "codis.queue_wait_us", "codis.rtt_us"} {
+		assert.Must(keys[key])
+	}
+}
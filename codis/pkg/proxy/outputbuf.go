@@ -0,0 +1,194 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/utils/bytesize"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// The actions of session_output_buffer_action.
+const (
+	OutputBufferDisconnect = "disconnect"
+	OutputBufferThrottle   = "throttle"
+)
+
+var ErrOutputBufferLimit = errors.New("output buffer limit reached")
+
+// outputBufferLimit is the limit of a class of clients, as in the option
+// client-output-buffer-limit of Redis, zero means unlimited.
+type outputBufferLimit struct {
+	hard, soft  int64
+	softSeconds int64
+}
+
+type outputBufferLimits struct {
+	normal, pubsub outputBufferLimit
+}
+
+// outputLimits holds the limits of session_output_buffer_limit.
+var outputLimits atomic.Value
+
+func init() {
+	outputLimits.Store(&outputBufferLimits{})
+}
+
+// parseOutputBufferLimit parses the limits as "<class> <hard> <soft> <soft
+// seconds> ...", e.g. "normal 0 0 0 pubsub 32mb 8mb 60", classes absent are
+// unlimited.
+func parseOutputBufferLimit(s string) (*outputBufferLimits, error) {
+	var fields = strings.Fields(s)
+	if len(fields)%4 != 0 {
+		return nil, errors.Errorf("invalid limit '%s', should be <class> <hard> <soft> <soft seconds> ...", s)
+	}
+	var limits = &outputBufferLimits{}
+	for i := 0; i < len(fields); i += 4 {
+		var l *outputBufferLimit
+		switch strings.ToLower(fields[i]) {
+		case "normal":
+			l = &limits.normal
+		case "pubsub":
+			l = &limits.pubsub
+		default:
+			return nil, errors.Errorf("invalid class '%s'", fields[i])
+		}
+		hard, err := bytesize.Parse(fields[i+1])
+		if err != nil || hard < 0 {
+			return nil, errors.Errorf("invalid hard limit '%s'", fields[i+1])
+		}
+		soft, err := bytesize.Parse(fields[i+2])
+		if err != nil || soft < 0 {
+			return nil, errors.Errorf("invalid soft limit '%s'", fields[i+2])
+		}
+		secs, err := strconv.ParseInt(fields[i+3], 10, 64)
+		if err != nil || secs < 0 {
+			return nil, errors.Errorf("invalid soft seconds '%s'", fields[i+3])
+		}
+		*l = outputBufferLimit{hard: hard, soft: soft, softSeconds: secs}
+	}
+	return limits, nil
+}
+
+func SetOutputBufferLimit(s string) error {
+	limits, err := parseOutputBufferLimit(s)
+	if err != nil {
+		return err
+	}
+	outputLimits.Store(limits)
+	return nil
+}
+
+func checkOutputBufferAction(action string) error {
+	switch action {
+	case OutputBufferDisconnect, OutputBufferThrottle:
+		return nil
+	}
+	return errors.Errorf("invalid output buffer action '%s'", action)
+}
+
+// outputBuffer counts the bytes of replies of a session, received from the
+// backends but not yet written to the client. Replies merged by the proxy,
+// e.g. MGET split into sub-requests, are not counted.
+type outputBuffer struct {
+	pending   atomic2.Int64
+	softSince atomic2.Int64
+}
+
+func (l *outputBufferLimit) enabled() bool {
+	return l.hard > 0 || l.soft > 0
+}
+
+func (b *outputBuffer) limit(pubsub bool) *outputBufferLimit {
+	var limits = outputLimits.Load().(*outputBufferLimits)
+	if pubsub {
+		return &limits.pubsub
+	}
+	return &limits.normal
+}
+
+// exceeded returns true if the pending bytes are over the hard limit, or over
+// the soft limit for longer than the soft seconds.
+func (b *outputBuffer) exceeded(l *outputBufferLimit, now time.Time) bool {
+	var n = b.pending.Int64()
+	if l.hard > 0 && n > l.hard {
+		return true
+	}
+	if l.soft <= 0 || n <= l.soft {
+		b.softSince.Set(0)
+		return false
+	}
+	var since = b.softSince.Int64()
+	if since == 0 {
+		b.softSince.CompareAndSwap(0, now.UnixNano())
+		return l.softSeconds == 0
+	}
+	return now.UnixNano()-since >= l.softSeconds*int64(time.Second)
+}
+
+// drained returns true if the pending bytes are below the limit to resume
+// a throttled session, i.e. the soft limit, or the hard limit if no soft.
+func (b *outputBuffer) drained(l *outputBufferLimit) bool {
+	var n = b.pending.Int64()
+	switch {
+	case l.soft > 0:
+		return n <= l.soft
+	case l.hard > 0:
+		return n <= l.hard
+	}
+	return true
+}
+
+// chargeOutput counts the reply of the request in the output buffer, and
+// closes the session if the limit is exceeded, unless it's to be throttled.
+// Replies received after the request is released, e.g. after its deadline,
+// are not counted.
+func (s *Session) chargeOutput(r *Request, size int64, pubsub bool) {
+	for {
+		var n = atomic.LoadInt64(&r.outputSize)
+		if n < 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&r.outputSize, n, n+size) {
+			break
+		}
+	}
+	s.output.pending.Add(size)
+	if s.config.SessionOutputBufferAction == OutputBufferThrottle {
+		return
+	}
+	if s.output.exceeded(s.output.limit(pubsub), time.Now()) && !s.broken.IsTrue() {
+		sessions.slow.Incr()
+		log.Warnf("session [%p] output buffer limit reached, pending %d bytes: %s", s, s.output.pending.Int64(), s)
+		s.CloseWithError(ErrOutputBufferLimit)
+	}
+}
+
+func (s *Session) releaseOutput(r *Request) {
+	if n := atomic.SwapInt64(&r.outputSize, -1); n > 0 {
+		s.output.pending.Sub(n)
+	}
+}
+
+// waitOutput blocks the session from reading requests, or messages of its
+// subscriptions, until the output buffer is drained, if it's throttled.
+func (s *Session) waitOutput(pubsub bool) {
+	if s.config.SessionOutputBufferAction != OutputBufferThrottle {
+		return
+	}
+	var l = s.output.limit(pubsub)
+	if !s.output.exceeded(l, time.Now()) {
+		return
+	}
+	sessions.slow.Incr()
+	for !s.broken.IsTrue() && !s.output.drained(l) {
+		time.Sleep(time.Millisecond * 10)
+	}
+}
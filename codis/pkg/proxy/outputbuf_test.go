@@ -0,0 +1,53 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestOutputBufferLimit(t *testing.T) {
+	defer SetOutputBufferLimit("")
+
+	l, err := parseOutputBufferLimit("normal 0 0 0 pubsub 32mb 8mb 60")
+	assert.MustNoError(err)
+	assert.Must(!l.normal.enabled() && l.pubsub.hard == 32<<20 && l.pubsub.soft == 8<<20 && l.pubsub.softSeconds == 60)
+	for _, s := range []string{"normal 0 0", "replica 0 0 0", "pubsub x 0 0", "pubsub 0 0 -1"} {
+		_, err := parseOutputBufferLimit(s)
+		assert.Must(err != nil)
+	}
+
+	var b outputBuffer
+	var now = time.Now()
+	var limit = &outputBufferLimit{hard: 100, soft: 50, softSeconds: 2}
+	b.pending.Set(60)
+	assert.Must(!b.exceeded(limit, now) && !b.drained(limit))
+	assert.Must(!b.exceeded(limit, now.Add(time.Second)))
+	assert.Must(b.exceeded(limit, now.Add(time.Second*2)))
+	b.pending.Set(40)
+	assert.Must(!b.exceeded(limit, now.Add(time.Second*3)) && b.drained(limit))
+	b.pending.Set(101)
+	assert.Must(b.exceeded(limit, now))
+
+	config := NewDefaultConfig()
+	c, _ := net.Pipe()
+	s := NewSession(c, config, nil)
+	assert.MustNoError(SetOutputBufferLimit("pubsub 100 0 0"))
+
+	var slow = SessionsSlow()
+	r1, r2 := &Request{}, &Request{}
+	s.chargeOutput(r1, 60, true)
+	assert.Must(!s.broken.IsTrue())
+	s.releaseOutput(r1)
+	s.chargeOutput(r2, 60, true)
+	assert.Must(!s.broken.IsTrue() && s.output.pending.Int64() == 60)
+	s.chargeOutput(r2, 60, true)
+	assert.Must(s.broken.IsTrue() && SessionsSlow() == slow+1)
+	s.releaseOutput(r2)
+	assert.Must(s.output.pending.Int64() == 0)
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// clientPause holds the commands of all sessions of the proxy paused by
+// CLIENT PAUSE, until CLIENT UNPAUSE or the timeout.
+var clientPause struct {
+	sync.Mutex
+	all    bool
+	expire time.Time
+	done   chan struct{}
+}
+
+// pauseClients pauses the writes, or all commands, for the duration. A pause
+// in effect is extended, and never turns from ALL into WRITE.
+func pauseClients(d time.Duration, all bool) {
+	clientPause.Lock()
+	defer clientPause.Unlock()
+	var expire = time.Now().Add(d)
+	if clientPause.done == nil {
+		clientPause.done = make(chan struct{})
+		clientPause.all = all
+		clientPause.expire = expire
+	} else {
+		clientPause.all = clientPause.all || all
+		if expire.After(clientPause.expire) {
+			clientPause.expire = expire
+		}
+	}
+	time.AfterFunc(d, func() {
+		clientPause.Lock()
+		defer clientPause.Unlock()
+		if !time.Now().Before(clientPause.expire) {
+			unpauseClientsLocked()
+		}
+	})
+}
+
+func unpauseClients() {
+	clientPause.Lock()
+	defer clientPause.Unlock()
+	unpauseClientsLocked()
+}
+
+func unpauseClientsLocked() {
+	if clientPause.done != nil {
+		close(clientPause.done)
+		clientPause.done = nil
+	}
+}
+
+// waitClientPause blocks until the request isn't paused anymore. EXEC is
+// paused by WRITE as well, for the writes queued by the transaction.
+func waitClientPause(r *Request) {
+	for {
+		clientPause.Lock()
+		done, all := clientPause.done, clientPause.all
+		clientPause.Unlock()
+		if done == nil || (!all && r.IsReadOnly() && r.OpStr != "EXEC") {
+			return
+		}
+		<-done
+	}
+}
+
+func (s *Session) handleClient(r *Request) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'CLIENT' command")
+		return nil
+	}
+	var subCmd = strings.ToUpper(string(r.Multi[1].Value))
+	switch {
+	case subCmd == "PAUSE" && (len(r.Multi) == 3 || len(r.Multi) == 4):
+		ms, err := strconv.ParseInt(string(r.Multi[2].Value), 10, 64)
+		if err != nil || ms < 0 {
+			r.Resp = redis.NewErrorf("ERR timeout is not an integer or out of range")
+			return nil
+		}
+		var all = true
+		if len(r.Multi) == 4 {
+			switch strings.ToUpper(string(r.Multi[3].Value)) {
+			case "WRITE":
+				all = false
+			case "ALL":
+			default:
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+		}
+		pauseClients(time.Duration(ms)*time.Millisecond, all)
+		r.Resp = RespOK
+	case subCmd == "UNPAUSE" && len(r.Multi) == 2:
+		unpauseClients()
+		r.Resp = RespOK
+	case subCmd == "DEADLINE" && len(r.Multi) == 3:
+		ms, err := strconv.ParseInt(string(r.Multi[2].Value), 10, 64)
+		if err != nil || ms < 0 {
+			r.Resp = redis.NewErrorf("ERR timeout is not an integer or out of range")
+			return nil
+		}
+		s.deadline = time.Duration(ms) * time.Millisecond
+		r.Resp = RespOK
+	case subCmd == "TRACKING" && len(r.Multi) >= 3:
+		return s.handleTracking(r)
+	case subCmd == "LIST":
+		return s.handleClientList(r)
+	case subCmd == "KILL" && len(r.Multi) >= 3:
+		return s.handleClientKill(r)
+	case subCmd == "ID" && len(r.Multi) == 2:
+		r.Resp = redis.NewInt(strconv.AppendInt(nil, s.id, 10))
+	case subCmd == "GETNAME" && len(r.Multi) == 2:
+		if name := s.getName(); name != "" {
+			r.Resp = redis.NewBulkBytes([]byte(name))
+		} else {
+			r.Resp = redis.NewBulkBytes(nil)
+		}
+	case subCmd == "SETNAME" && len(r.Multi) == 3:
+		return s.handleClientSetName(r)
+	case subCmd == "SETINFO" && len(r.Multi) == 4:
+		return s.handleClientSetInfo(r)
+	default:
+		r.Resp = redis.NewErrorf("ERR Unknown CLIENT subcommand or wrong args. Try PAUSE, UNPAUSE, DEADLINE, TRACKING, LIST, KILL, ID, GETNAME, SETNAME, SETINFO.")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestClientPause(t *testing.T) {
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewString([]byte("OK"))
+	})
+	defer backend.Close()
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{Id: i, BackendAddr: backend.Addr()}))
+	}
+	d.Start()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "CLIENT", "PAUSE", "1000", "NONE").IsError())
+	assert.Must(handleTestRequest(s, d, "CLIENT", "PAUSE", "-1").IsError())
+
+	assert.Must(string(handleTestRequest(s, d, "CLIENT", "PAUSE", "50", "WRITE").Value) == "OK")
+	start := time.Now()
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "OK")
+	assert.Must(time.Since(start) < time.Millisecond*50)
+	assert.Must(string(handleTestRequest(s, d, "SET", "key", "v").Value) == "OK")
+	assert.Must(time.Since(start) >= time.Millisecond*40)
+
+	assert.Must(string(handleTestRequest(s, d, "CLIENT", "PAUSE", "10000").Value) == "OK")
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		handleTestRequest(newTestSession(), d, "CLIENT", "UNPAUSE")
+	}()
+	start = time.Now()
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "OK")
+	assert.Must(time.Since(start) >= time.Millisecond*40 && time.Since(start) < time.Second)
+}
+
+func TestClientDeadline(t *testing.T) {
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		if string(multi[0].Value) == "GET" {
+			time.Sleep(time.Millisecond * 200)
+		}
+		return redis.NewString([]byte("OK"))
+	})
+	defer backend.Close()
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{Id: i, BackendAddr: backend.Addr()}))
+	}
+	d.Start()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "CLIENT", "DEADLINE", "-1").IsError())
+	assert.Must(string(handleTestRequest(s, d, "CLIENT", "DEADLINE", "50").Value) == "OK")
+	assert.Must(s.deadline == time.Millisecond*50)
+
+	var n = GetExpiredRequests()
+	r := newTestRequest("GET", "key")
+	r.Deadline = time.Now().Add(s.deadline).UnixNano()
+	assert.MustNoError(s.handleRequest(r, d))
+	start := time.Now()
+	resp, err := s.handleResponse(r)
+	assert.MustNoError(err)
+	assert.Must(resp.IsError() && time.Since(start) < time.Millisecond*150)
+	assert.Must(GetExpiredRequests() == n+1)
+
+	r = newTestRequest("SET", "key", "v")
+	r.Deadline = time.Now().Add(time.Second).UnixNano()
+	assert.MustNoError(s.handleRequest(r, d))
+	resp, err = s.handleResponse(r)
+	assert.MustNoError(err)
+	assert.Must(string(resp.Value) == "OK")
+
+	r = newTestRequest("GET", "key")
+	r.Deadline = time.Now().UnixNano()
+	assert.Must(r.IsExpired())
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// backendProbe is the result of the last probe sent to a backend by the
+// prober every backend_ping_period, PING to a primary and INFO replication to
+// a replica. A replica slower than backend_replica_max_latency, not answering,
+// or with the link to its master down, is ejected from the read pool until
+// it's fine again.
+type backendProbe struct {
+	latency atomic2.Int64
+	failed  atomic2.Bool
+	ejected atomic2.Bool
+}
+
+type BackendProbe struct {
+	Addr      string `json:"addr"`
+	Replica   bool   `json:"replica,omitempty"`
+	LatencyUs int64  `json:"latency_us"`
+	Failed    bool   `json:"failed,omitempty"`
+	Ejected   bool   `json:"ejected,omitempty"`
+}
+
+func isReplicaEjected(s *sharedBackendConn) bool {
+	return s.owner.config.BackendReplicaMaxLatency > 0 && s.probe.ejected.IsTrue()
+}
+
+// probeBackends probes each backend and records the time between sending
+// the probe and receiving the reply, unless backend_replica_max_latency is 0.
+// It must be called with the lock held.
+func (s *Router) probeBackends() {
+	if s.config.BackendReplicaMaxLatency <= 0 {
+		return
+	}
+	for _, shared := range s.pool.primary.pool {
+		s.probeBackend(shared, false)
+	}
+	for _, shared := range s.pool.replica.pool {
+		s.probeBackend(shared, true)
+	}
+}
+
+func (s *Router) probeBackend(shared *sharedBackendConn, replica bool) {
+	var slo = s.config.BackendReplicaMaxLatency.Duration()
+	var update = func(latency time.Duration, failed bool) {
+		shared.probe.latency.Set(int64(latency))
+		shared.probe.failed.Set(failed)
+		if !replica {
+			return
+		}
+		ejected := failed || latency > slo
+		if shared.probe.ejected.Swap(ejected) != ejected {
+			if ejected {
+				log.Warnf("replica %s is ejected from read pool, latency = %s, failed = %t",
+					shared.addr, latency, failed)
+			} else {
+				log.Warnf("replica %s is back to read pool, latency = %s", shared.addr, latency)
+			}
+		}
+	}
+
+	bc := shared.BackendConn(0, 0, false, false)
+	if bc == nil {
+		update(0, true)
+		return
+	}
+	m := &Request{Batch: &sync.WaitGroup{}}
+	if replica {
+		m.Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte("INFO")),
+			redis.NewBulkBytes([]byte("replication")),
+		}
+	} else {
+		m.Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte("PING")),
+		}
+	}
+	bc.PushBack(m)
+
+	keepAliveCallback <- func() {
+		m.Batch.Wait()
+		var latency time.Duration
+		if m.SendToServerTime > 0 && m.ReceiveFromServerTime > 0 {
+			latency = time.Duration(m.ReceiveFromServerTime - m.SendToServerTime)
+		}
+		switch resp := m.Resp; {
+		case m.Err != nil || resp == nil || resp.IsError() || m.SendToServerTime == 0:
+			update(latency, true)
+		case replica:
+			update(latency, !resp.IsBulkBytes() || !isReplicaLinkUp(string(resp.Value)))
+		default:
+			update(latency, false)
+		}
+	}
+}
+
+// isReplicaLinkUp returns false if the INFO replication of a replica reports
+// master_link_status other than up.
+func isReplicaLinkUp(info string) bool {
+	for _, line := range strings.Split(info, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "master_link_status:") {
+			return strings.TrimPrefix(line, "master_link_status:") == "up"
+		}
+	}
+	return true
+}
+
+// BackendProbes returns the result of the last probe of each backend.
+func (s *Router) BackendProbes() []*BackendProbe {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var probes []*BackendProbe
+	for i, pool := range []*sharedBackendConnPool{s.pool.primary, s.pool.replica} {
+		for addr, shared := range pool.pool {
+			probes = append(probes, &BackendProbe{
+				Addr: addr, Replica: i != 0,
+				LatencyUs: shared.probe.latency.Int64() / int64(time.Microsecond),
+				Failed:    shared.probe.failed.IsTrue(),
+				Ejected:   i != 0 && isReplicaEjected(shared),
+			})
+		}
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		if probes[i].Replica != probes[j].Replica {
+			return !probes[i].Replica
+		}
+		return probes[i].Addr < probes[j].Addr
+	})
+	return probes
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestProbeEjectSlowReplica(t *testing.T) {
+	var backends = make([]*fakeBackend, 4)
+	for i, name := range []string{"primary", "fast", "slow", "down"} {
+		var value = []byte(name)
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			switch string(multi[0].Value) {
+			case "PING":
+				return redis.NewString([]byte("PONG"))
+			case "INFO":
+				var link = "up"
+				switch string(value) {
+				case "slow":
+					time.Sleep(time.Millisecond * 50)
+				case "down":
+					link = "down"
+				}
+				return redis.NewBulkBytes([]byte("# Replication\r\nrole:slave\r\nmaster_link_status:" + link + "\r\n"))
+			}
+			return redis.NewBulkBytes(value)
+		})
+		defer backends[i].Close()
+	}
+
+	latency := config.BackendReplicaMaxLatency
+	defer func() {
+		config.BackendReplicaMaxLatency = latency
+	}()
+	config.BackendReplicaMaxLatency.UnmarshalText([]byte("20ms"))
+	policy := config.BackendReplicaPolicy
+	defer func() {
+		config.BackendReplicaPolicy = policy
+	}()
+	config.BackendReplicaPolicy = ReplicaPolicyRoundRobin
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: backends[0].Addr(),
+			ReplicaGroups: [][]string{{backends[1].Addr(), backends[2].Addr(), backends[3].Addr()}},
+		}))
+	}
+	d.Start()
+
+	ejected := func() map[string]bool {
+		var addrs = make(map[string]bool)
+		for _, p := range d.BackendProbes() {
+			if p.Ejected {
+				addrs[p.Addr] = true
+			}
+		}
+		return addrs
+	}
+	for i := 0; len(ejected()) != 2; i++ {
+		assert.Must(i < 100)
+		assert.MustNoError(d.KeepAlive())
+		time.Sleep(time.Millisecond * 60)
+	}
+	assert.Must(ejected()[backends[2].Addr()] && ejected()[backends[3].Addr()])
+
+	s := newTestSession()
+	for i := 0; i < 10; i++ {
+		assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "fast")
+	}
+}
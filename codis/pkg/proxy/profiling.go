@@ -0,0 +1,128 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/math2"
+	"pika/codis/v2/pkg/utils/rpc"
+)
+
+var profilingTypes = map[string]bool{
+	"cpu": true, "heap": true, "allocs": true, "goroutine": true,
+}
+
+func parseProfilingTypes(list string) ([]string, error) {
+	var types []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s == "" {
+			continue
+		}
+		if !profilingTypes[s] {
+			return nil, errors.Errorf("invalid profiling type '%s'", s)
+		}
+		types = append(types, s)
+	}
+	return types, nil
+}
+
+// profilePusher pushes the profiles to the ingest API of Pyroscope, where the
+// name is the application with the labels, e.g. codis-proxy{product=demo}.
+type profilePusher struct {
+	endpoint string
+	name     string
+	types    []string
+	cpu      time.Duration
+	client   *http.Client
+}
+
+func (p *Proxy) startProfilingPusher() {
+	endpoint := p.config.ProfilingPushEndpoint
+	period := p.config.ProfilingPushInterval.Duration()
+	if endpoint == "" {
+		return
+	}
+	period = math2.MaxDuration(time.Second, period)
+
+	types, _ := parseProfilingTypes(p.config.ProfilingTypes)
+	model := p.Model()
+	x := &profilePusher{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/ingest",
+		name:     fmt.Sprintf("codis-proxy{product=%s,proxy_id=%s}", model.ProductName, model.Token),
+		types:    types,
+		cpu:      p.config.ProfilingCPUDuration.Duration(),
+		client:   &http.Client{Timeout: time.Second * 30},
+	}
+	p.startMetricsReporter(period, x.push, nil)
+}
+
+func (x *profilePusher) push() error {
+	for _, kind := range x.types {
+		var b bytes.Buffer
+		var from = time.Now()
+		if err := rpc.WriteProfile(&b, kind, int(x.cpu/time.Second)); err != nil {
+			if errors.Equal(err, rpc.ErrTooManyProfiles) {
+				log.Debugf("skip pushing profile %s: %s", kind, err)
+				return nil
+			}
+			return err
+		}
+		if err := x.upload(kind, from, time.Now(), b.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *profilePusher) upload(kind string, from, until time.Time, profile []byte) error {
+	var body bytes.Buffer
+	var w = multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("profile", "profile.pprof")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	part.Write(profile)
+	if err := w.Close(); err != nil {
+		return errors.Trace(err)
+	}
+
+	var query = url.Values{}
+	query.Set("name", x.name)
+	query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	query.Set("until", strconv.FormatInt(until.Unix(), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+	if kind == "cpu" {
+		query.Set("sampleRate", "100")
+	}
+	req, err := http.NewRequest("POST", x.endpoint+"?"+query.Encode(), &body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	rsp, err := x.client.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 512))
+		return errors.Errorf("[%d] %s - %s", rsp.StatusCode, http.StatusText(rsp.StatusCode), msg)
+	}
+	io.Copy(ioutil.Discard, rsp.Body)
+	return nil
+}
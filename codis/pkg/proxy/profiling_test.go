@@ -0,0 +1,56 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/timesize"
+)
+
+func TestProfilingPusher(x *testing.T) {
+	_, err := parseProfilingTypes("cpu, heap,,")
+	assert.MustNoError(err)
+	_, err = parseProfilingTypes("cpu,trace")
+	assert.Must(err != nil)
+
+	type upload struct {
+		query   url.Values
+		profile []byte
+	}
+	var uploads = make(chan *upload, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Must(req.URL.Path == "/ingest")
+		f, _, err := req.FormFile("profile")
+		assert.MustNoError(err)
+		b, _ := ioutil.ReadAll(f)
+		uploads <- &upload{req.URL.Query(), b}
+	}))
+	defer server.Close()
+
+	var conf = *config
+	conf.ProfilingPushEndpoint = server.URL + "/"
+	conf.ProfilingPushInterval = timesize.Duration(time.Second)
+	conf.ProfilingTypes = "heap,goroutine"
+
+	p, err := New(&conf)
+	assert.MustNoError(err)
+	defer p.Close()
+
+	for _, kind := range []string{"heap", "goroutine"} {
+		select {
+		case u := <-uploads:
+			assert.Must(len(u.profile) != 0 && u.query.Get("format") == "pprof")
+			assert.Must(u.query.Get("name") == "codis-proxy{product="+conf.ProductName+",proxy_id="+p.Model().Token+"}")
+		case <-time.After(time.Second * 5):
+			x.Fatalf("no profile %s pushed", kind)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackendPoolStats is the state of the connections to a backend.
+type BackendPoolStats struct {
+	Addr      string
+	Replica   bool
+	Conns     int
+	Connected int
+	Pending   int
+	LatencyUs int64
+}
+
+// BackendPools returns the state of the connections to each backend.
+func (s *Router) BackendPools() []*BackendPoolStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var pools []*BackendPoolStats
+	for i, pool := range []*sharedBackendConnPool{s.pool.primary, s.pool.replica} {
+		for addr, shared := range pool.pool {
+			var x = &BackendPoolStats{Addr: addr, Replica: i != 0}
+			var count = func(bc *BackendConn) {
+				x.Conns++
+				if bc.IsConnected() {
+					x.Connected++
+				}
+				x.Pending += len(bc.input)
+				if us := bc.Latency() / int64(time.Microsecond); us > x.LatencyUs {
+					x.LatencyUs = us
+				}
+			}
+			for _, bc := range shared.single {
+				count(bc)
+			}
+			for _, parallel := range shared.conns {
+				for _, bc := range parallel {
+					count(bc)
+				}
+			}
+			pools = append(pools, x)
+		}
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		if pools[i].Replica != pools[j].Replica {
+			return !pools[i].Replica
+		}
+		return pools[i].Addr < pools[j].Addr
+	})
+	return pools
+}
+
+// slotOps returns the number of requests dispatched to each slot, the slots
+// never dispatched are omitted.
+func (s *Router) slotOps() map[int]int64 {
+	var ops = make(map[int]int64)
+	for i := range s.slots {
+		if n := s.slots[i].stats.ops.Int64(); n != 0 {
+			ops[i] = n
+		}
+	}
+	return ops
+}
+
+// promWriter writes the metrics in the text format of Prometheus.
+type promWriter struct {
+	*bufio.Writer
+}
+
+var promLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (w *promWriter) header(name, typ, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes a sample of the metric, labels are pairs of names and values.
+func (w *promWriter) sample(name string, value float64, labels ...string) {
+	w.WriteString(name)
+	if len(labels) != 0 {
+		w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i != 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(labels[i] + `="` + promLabelReplacer.Replace(labels[i+1]) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteByte('\n')
+}
+
+// promSink receives the metric families of the proxy, e.g. written in the
+// text format, or pushed by remote write.
+type promSink interface {
+	header(name, typ, help string)
+	sample(name string, value float64, labels ...string)
+}
+
+func promMetric(w promSink, name, typ, help string, value float64, labels ...string) {
+	w.header(name, typ, help)
+	w.sample(name, value, labels...)
+}
+
+// WriteMetrics writes the metrics of the proxy in the text format of
+// Prometheus, as served by /metrics of the admin port.
+func (p *Proxy) WriteMetrics(out io.Writer) error {
+	var w = &promWriter{bufio.NewWriter(out)}
+	p.collectMetrics(w)
+	return w.Flush()
+}
+
+func (p *Proxy) collectMetrics(w promSink) {
+	var model = p.Model()
+
+	promMetric(w, "codis_proxy_info", "gauge", "Information of the proxy.", 1,
+		"product_name", model.ProductName, "token", model.Token,
+		"admin_addr", model.AdminAddr, "proxy_addr", model.ProxyAddr)
+	promMetric(w, "codis_proxy_online", "gauge", "Whether the proxy is online.", boolValue(p.IsOnline()))
+
+	promMetric(w, "codis_proxy_ops_total", "counter", "Total number of commands.", float64(OpTotal()))
+	promMetric(w, "codis_proxy_ops_fails_total", "counter", "Total number of commands failed.", float64(OpFails()))
+	promMetric(w, "codis_proxy_ops_redis_errors_total", "counter", "Total number of error replies of backends.", float64(OpRedisErrors()))
+	promMetric(w, "codis_proxy_ops_qps", "gauge", "Commands per second.", float64(OpQPS()))
+	promMetric(w, "codis_proxy_ops_expired_total", "counter", "Total number of commands exceeding deadlines.", float64(GetExpiredRequests()))
+	promMetric(w, "codis_proxy_tracing_dropped_total", "counter", "Total number of traces dropped by the exporter.", float64(GetTracingDropped()))
+	promMetric(w, "codis_proxy_ops_collapsed_total", "counter", "Total number of commands collapsed by singleflight.", float64(GetSingleflightCollapsed()))
+
+	p.writeCmdMetrics(w)
+
+	promMetric(w, "codis_proxy_sessions_total", "counter", "Total number of sessions accepted.", float64(SessionsTotal()))
+	promMetric(w, "codis_proxy_sessions_alive", "gauge", "Number of sessions alive.", float64(SessionsAlive()))
+	promMetric(w, "codis_proxy_sessions_rejected_total", "counter", "Total number of sessions rejected.", float64(SessionsRejected()))
+	promMetric(w, "codis_proxy_sessions_evicted_total", "counter", "Total number of sessions evicted.", float64(SessionsEvicted()))
+
+	var pools = p.router.BackendPools()
+	var pool = func(x *BackendPoolStats) string {
+		if x.Replica {
+			return "replica"
+		}
+		return "primary"
+	}
+	w.header("codis_proxy_backend_conns", "gauge", "Number of connections to the backend.")
+	for _, x := range pools {
+		w.sample("codis_proxy_backend_conns", float64(x.Conns), "addr", x.Addr, "pool", pool(x))
+	}
+	w.header("codis_proxy_backend_conns_connected", "gauge", "Number of connections to the backend connected.")
+	for _, x := range pools {
+		w.sample("codis_proxy_backend_conns_connected", float64(x.Connected), "addr", x.Addr, "pool", pool(x))
+	}
+	w.header("codis_proxy_backend_pending", "gauge", "Number of requests waiting to be sent to the backend.")
+	for _, x := range pools {
+		w.sample("codis_proxy_backend_pending", float64(x.Pending), "addr", x.Addr, "pool", pool(x))
+	}
+	w.header("codis_proxy_backend_latency_seconds", "gauge", "Max round trip time of the connections to the backend.")
+	for _, x := range pools {
+		w.sample("codis_proxy_backend_latency_seconds", float64(x.LatencyUs)/1e6, "addr", x.Addr, "pool", pool(x))
+	}
+	promMetric(w, "codis_proxy_backend_retries_total", "counter", "Total number of requests retried.", float64(RetryCount.Int64()))
+	promMetric(w, "codis_proxy_backend_breaker_trips_total", "counter", "Total number of trips of circuit breakers.", float64(BreakerTrips.Int64()))
+
+	promMetric(w, "codis_proxy_slots_assigned", "gauge", "Number of slots with a backend.", float64(p.router.assignedSlots()))
+	var ops = p.router.slotOps()
+	var ids = make([]int, 0, len(ops))
+	for id := range ops {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	w.header("codis_proxy_slot_ops_total", "counter", "Total number of requests dispatched to the slot.")
+	for _, id := range ids {
+		w.sample("codis_proxy_slot_ops_total", float64(ops[id]), "slot", strconv.Itoa(id))
+	}
+
+	var r runtime.MemStats
+	runtime.ReadMemStats(&r)
+	promMetric(w, "codis_proxy_goroutines", "gauge", "Number of goroutines.", float64(runtime.NumGoroutine()))
+	promMetric(w, "codis_proxy_heap_alloc_bytes", "gauge", "Bytes of heap objects allocated.", float64(r.HeapAlloc))
+	promMetric(w, "codis_proxy_sys_bytes", "gauge", "Bytes of memory obtained from the OS.", float64(r.Sys))
+	promMetric(w, "codis_proxy_gc_total", "counter", "Total number of GC cycles.", float64(r.NumGC))
+	if u := GetSysUsage(); u != nil {
+		promMetric(w, "codis_proxy_cpu_usage", "gauge", "CPU usage of the process.", u.CPU)
+		promMetric(w, "codis_proxy_resident_memory_bytes", "gauge", "Memory used by the process.", float64(u.MemTotal()))
+	}
+}
+
+// writeCmdMetrics writes the stats of commands as of the last refresh, the
+// scrapes never refresh or reset the stats of intervals shared with others.
+func (p *Proxy) writeCmdMetrics(w promSink) {
+	cmdstats.opmapLock.RLock()
+	var all = make([]*opStats, 0, len(cmdstats.opmap))
+	for opstr, s := range cmdstats.opmap {
+		if opstr != "ALL" {
+			all = append(all, s)
+		}
+	}
+	cmdstats.opmapLock.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].opstr < all[j].opstr
+	})
+
+	w.header("codis_proxy_cmd_calls_total", "counter", "Total number of calls of the command.")
+	for _, s := range all {
+		w.sample("codis_proxy_cmd_calls_total", float64(s.calls.Int64()), "cmd", s.opstr)
+	}
+	w.header("codis_proxy_cmd_fails_total", "counter", "Total number of calls of the command failed.")
+	for _, s := range all {
+		w.sample("codis_proxy_cmd_fails_total", float64(s.fails.Int64()), "cmd", s.opstr)
+	}
+	w.header("codis_proxy_cmd_redis_errors_total", "counter", "Total number of error replies of the command.")
+	for _, s := range all {
+		w.sample("codis_proxy_cmd_redis_errors_total", float64(s.redis.errors.Int64()), "cmd", s.opstr)
+	}
+	w.header("codis_proxy_cmd_duration_seconds", "histogram", "Latency of the command.")
+	for _, s := range all {
+		var count int64
+		for i, b := range latencyBuckets {
+			count += s.buckets[i].Int64()
+			w.sample("codis_proxy_cmd_duration_seconds_bucket", float64(count),
+				"cmd", s.opstr, "le", strconv.FormatFloat(b.Seconds(), 'g', -1, 64))
+		}
+		var calls = s.calls.Int64()
+		if calls < count {
+			calls = count
+		}
+		w.sample("codis_proxy_cmd_duration_seconds_bucket", float64(calls), "cmd", s.opstr, "le", "+Inf")
+		w.sample("codis_proxy_cmd_duration_seconds_sum", float64(s.nsecs.Int64())/1e9, "cmd", s.opstr)
+		w.sample("codis_proxy_cmd_duration_seconds_count", float64(calls), "cmd", s.opstr)
+	}
+	w.header("codis_proxy_cmd_latency_quantile_seconds", "gauge", "Quantiles of the latency of the command in the last second.")
+	for _, s := range all {
+		var tpus = s.delayInfo[0].quantiles()
+		for _, i := range []int{0, 2, 3, 4} {
+			w.sample("codis_proxy_cmd_latency_quantile_seconds", float64(tpus[i])/1e6,
+				"cmd", s.opstr, "quantile", strconv.FormatFloat(TPQuantiles[i], 'g', -1, 64))
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/timesize"
+)
+
+func TestPrometheusMetrics(x *testing.T) {
+	s, addr := openProxy()
+	defer s.Close()
+
+	cmdstats.opmapLock.Lock()
+	delete(cmdstats.opmap, "PROMGET")
+	cmdstats.opmapLock.Unlock()
+	getOpStats("PROMGET", true).incrOpStats(int64(time.Millisecond*3), 0)
+
+	rsp, err := http.Get("http://" + addr + "/metrics")
+	assert.MustNoError(err)
+	defer rsp.Body.Close()
+	assert.Must(rsp.StatusCode == http.StatusOK)
+	assert.Must(strings.HasPrefix(rsp.Header.Get("Content-Type"), "text/plain"))
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	assert.MustNoError(err)
+	var text = string(b)
+	for _, line := range []string{
+		"# TYPE codis_proxy_cmd_duration_seconds histogram",
+		"# TYPE codis_proxy_cmd_latency_quantile_seconds gauge",
+		`codis_proxy_cmd_calls_total{cmd="PROMGET"} 1`,
+		`codis_proxy_cmd_duration_seconds_bucket{cmd="PROMGET",le="0.002"} 0`,
+		`codis_proxy_cmd_duration_seconds_bucket{cmd="PROMGET",le="0.005"} 1`,
+		`codis_proxy_cmd_duration_seconds_bucket{cmd="PROMGET",le="+Inf"} 1`,
+		`codis_proxy_cmd_duration_seconds_count{cmd="PROMGET"} 1`,
+		"codis_proxy_sessions_alive ",
+		"codis_proxy_slots_assigned 0",
+	} {
+		assert.Must(strings.Contains(text, line))
+	}
+}
+
+func TestPrometheusRemoteWrite(x *testing.T) {
+	var bodies = make(chan []byte, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Must(req.Header.Get("Content-Encoding") == "snappy")
+		b, _ := ioutil.ReadAll(req.Body)
+		bodies <- b
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var conf = *config
+	conf.MetricsReportRemoteWriteServer = server.URL + "/api/v1/write"
+	conf.MetricsReportRemoteWritePeriod = timesize.Duration(time.Second)
+
+	p, err := New(&conf)
+	assert.MustNoError(err)
+	defer p.Close()
+
+	// Wait for two pushes, so they run along with the refresh of the stats.
+	var body []byte
+	for i := 0; i < 2; i++ {
+		select {
+		case b := <-bodies:
+			body, err = snappy.Decode(nil, b)
+			assert.MustNoError(err)
+		case <-time.After(time.Second * 5):
+			x.Fatal("no metrics pushed")
+		}
+	}
+	for _, s := range []string{"__name__", "codis_proxy_ops_total", "instance", p.Model().AdminAddr, "job", "codis-proxy"} {
+		assert.Must(bytes.Contains(body, []byte(s)))
+	}
+
+	w := &promRemoteWriter{}
+	w.sample("m", 1.5, "b", "2", "a", "1")
+	assert.Must(len(w.series) == 1 && w.series[0].labels[0].name == "__name__" && w.series[0].labels[1].name == "a")
+	var expect = []byte{
+		0x0a, 0x2c, // TimeSeries
+		0x0a, 0x0d, 0x0a, 0x08, '_', '_', 'n', 'a', 'm', 'e', '_', '_', 0x12, 0x01, 'm',
+		0x0a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, '1',
+		0x0a, 0x06, 0x0a, 0x01, 'b', 0x12, 0x01, '2',
+		0x12, 0x0b, 0x09, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, 0x10, 0x02,
+	}
+	assert.Must(bytes.Equal(w.encode(2), expect))
+}
@@ -4,6 +4,7 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -19,10 +20,14 @@ import (
 	"pika/codis/v2/pkg/models"
 	"pika/codis/v2/pkg/proxy/redis"
 	"pika/codis/v2/pkg/utils"
+	"pika/codis/v2/pkg/utils/bytesize"
 	"pika/codis/v2/pkg/utils/errors"
 	"pika/codis/v2/pkg/utils/log"
 	"pika/codis/v2/pkg/utils/math2"
 	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/secret"
+	"pika/codis/v2/pkg/utils/timesize"
+	"pika/codis/v2/pkg/utils/tls2"
 	"pika/codis/v2/pkg/utils/unsafe2"
 )
 
@@ -50,6 +55,16 @@ type Proxy struct {
 		servers []string
 	}
 	jodis *Jodis
+
+	commands *models.Commands
+	secrets  *secret.Manager
+
+	rotation *models.AuthRotation
+	xauths   []string
+
+	quotas *models.Quotas
+
+	configlog configLog
 }
 
 var ErrClosedProxy = errors.New("use of closed proxy")
@@ -61,10 +76,58 @@ func New(config *Config) (*Proxy, error) {
 	if err := models.ValidateProduct(config.ProductName); err != nil {
 		return nil, errors.Trace(err)
 	}
+	config.auth = &proxyAuth{}
+
+	if config.HashTag != "" {
+		SetHashTag(config.HashTag[0], config.HashTag[1])
+	}
+	if err := SetAccessList(config.ProxyAllowCIDRs, config.ProxyDenyCIDRs); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := SetCmdRateLimit(config.CmdRateLimit); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := SetOutputBufferLimit(config.SessionOutputBufferLimit); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := SetBatchLimit(config.MaxBatchSize, config.MaxBatchBytes.Int64(), config.CmdBatchLimit); err != nil {
+		return nil, errors.Trace(err)
+	}
+	SetHotKeySampler(config.HotKeyCapacity, config.HotKeySampleRatio, config.HotKeyInterval.Duration())
+	SetHotKeyCache(config.HotKeyCacheSize, config.HotKeyCacheTTL.Duration(), config.HotKeyCacheMinQPS)
+	SetNegativeCache(config.NegativeCacheSize, config.NegativeCacheTTL.Duration())
+	SetSingleflightCommands(config.SingleflightCommands)
+	if path := config.BigKeyReportFile; path != "" {
+		if err := LoadBigKeys(path); err != nil {
+			log.WarnErrorf(err, "load big-key report from %s failed", path)
+		}
+	}
+	if path := config.SlowlogPersistFile; path != "" {
+		if err := LoadSlowlog(path); err != nil {
+			log.WarnErrorf(err, "load slowlog from %s failed", path)
+		}
+	}
+	SetRedactRules(config.RedactKeyPatterns, config.RedactFieldPatterns)
+	SetMonitorOptions(config.MonitorSampleRatio, config.MonitorRedact)
+	if err := LoadACLFile(config.SessionACLFile); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := OpenAuditLog(config.AuditLog, config.AuditLogCategories); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if fn, err := config.NewHashFunc(); err != nil {
+		return nil, errors.Trace(err)
+	} else {
+		SetHashFunc(fn)
+	}
 
 	p := &Proxy{}
 	p.config = config
 	p.exit.C = make(chan struct{})
+	if err := p.setupSecrets(config); err != nil {
+		p.Close()
+		return nil, err
+	}
 	p.router = NewRouter(config)
 	p.ignore = make([]byte, config.ProxyHeapPlaceholder.Int64())
 
@@ -90,6 +153,7 @@ func New(config *Config) (*Proxy, error) {
 	log.Warnf("[%p] create new proxy:\n%s", p, p.model.Encode())
 
 	unsafe2.SetMaxOffheapBytes(config.ProxyMaxOffheapBytes.Int64())
+	setInflightBudget(config.ProxyMaxInflightMemory.Int64())
 
 	go p.serveAdmin()
 	go p.serveProxy()
@@ -97,17 +161,44 @@ func New(config *Config) (*Proxy, error) {
 	p.startMetricsJson()
 	p.startMetricsInfluxdb()
 	p.startMetricsStatsd()
+	p.startMetricsRemoteWrite()
+	p.startTracingExporter()
+	p.startProfilingPusher()
 
 	return p, nil
 }
 
 func (p *Proxy) setup(config *Config) error {
+	if config.BackendTLS {
+		c, err := tls2.NewClientConfig(tls2.Files{
+			CertFile: config.BackendTLSCertFile,
+			KeyFile:  config.BackendTLSKeyFile,
+			CAFile:   config.BackendTLSCAFile,
+		}, config.BackendTLSServerName)
+		if err != nil {
+			return err
+		}
+		config.backendTLS = c
+	}
+
 	proto := config.ProtoType
 	if l, err := net.Listen(proto, config.ProxyAddr); err != nil {
 		return errors.Trace(err)
 	} else {
 		p.lproxy = l
 
+		if config.ProxyTLSCertFile != "" {
+			c, err := tls2.NewServerConfig(tls2.Files{
+				CertFile: config.ProxyTLSCertFile,
+				KeyFile:  config.ProxyTLSKeyFile,
+				CAFile:   config.ProxyTLSCAFile,
+			}, config.ProxyTLSClientAuth)
+			if err != nil {
+				return err
+			}
+			p.lproxy = tls.NewListener(l, c)
+		}
+
 		x, err := utils.ReplaceUnspecifiedIP(proto, l.Addr().String(), config.HostProxy)
 		if err != nil {
 			return err
@@ -116,11 +207,26 @@ func (p *Proxy) setup(config *Config) error {
 		p.model.ProxyAddr = x
 	}
 
+	if config.AdminTLSCertFile != "" {
+		if err := rpc.SetupTLS(tls2.Files{
+			CertFile: config.AdminTLSCertFile,
+			KeyFile:  config.AdminTLSKeyFile,
+			CAFile:   config.AdminTLSCAFile,
+		}, rpc.ParseNames(config.AdminTLSAllowedNames)); err != nil {
+			return err
+		}
+	}
+	if config.AdminTokenSecret != "" {
+		if err := rpc.SetupToken(config.AdminTokenSecret, "codis-proxy"); err != nil {
+			return err
+		}
+	}
+
 	proto = "tcp"
 	if l, err := net.Listen(proto, config.AdminAddr); err != nil {
 		return errors.Trace(err)
 	} else {
-		p.ladmin = l
+		p.ladmin = rpc.NewListener(l)
 
 		x, err := utils.ReplaceUnspecifiedIP(proto, l.Addr().String(), config.HostAdmin)
 		if err != nil {
@@ -151,8 +257,18 @@ func (p *Proxy) setup(config *Config) error {
 			p.model.JodisPath = models.JodisPath(config.ProductName, p.model.Token)
 		}
 		p.jodis = NewJodis(c, p.model)
+		if err := setScriptStore(models.NewStore(c, config.ProductName)); err != nil {
+			log.WarnErrorf(err, "load shared scripts failed")
+		}
 	}
 	p.model.MaxSlotNum = config.MaxSlotNum
+	if config.HashTag != "{}" {
+		p.model.HashTag = config.HashTag
+	}
+	if config.HashMode != HashModeCRC32 {
+		p.model.HashMode = config.HashMode
+	}
+	p.model.HashKeySum = config.hashKeySum()
 
 	return nil
 }
@@ -184,6 +300,7 @@ func (p *Proxy) Close() error {
 	close(p.exit.C)
 
 	if p.jodis != nil {
+		setScriptStore(nil)
 		p.jodis.Close()
 	}
 	if p.ladmin != nil {
@@ -195,6 +312,10 @@ func (p *Proxy) Close() error {
 	if p.router != nil {
 		p.router.Close()
 	}
+	if p.secrets != nil {
+		p.secrets.Close()
+	}
+	CloseAuditLog()
 	return nil
 }
 
@@ -215,6 +336,10 @@ func (p *Proxy) Config() *Config {
 func (p *Proxy) ConfigGet(key string) *redis.Resp {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	return p.configGet(key)
+}
+
+func (p *Proxy) configGet(key string) *redis.Resp {
 	switch key {
 	case "jodis":
 		return redis.NewArray([]*redis.Resp{
@@ -235,11 +360,23 @@ func (p *Proxy) ConfigGet(key string) *redis.Resp {
 			redis.NewBulkBytes([]byte(p.config.ProxyDataCenter)),
 			redis.NewBulkBytes([]byte("proxy_max_clients")),
 			redis.NewBulkBytes([]byte(strconv.Itoa(p.config.ProxyMaxClients))),
+			redis.NewBulkBytes([]byte("proxy_max_clients_policy")),
+			redis.NewBulkBytes([]byte(p.config.ProxyMaxClientsPolicy)),
+			redis.NewBulkBytes([]byte("proxy_max_clients_evict_idle")),
+			redis.NewBulkBytes([]byte(p.config.ProxyMaxClientsEvictIdle.Duration().String())),
+			redis.NewBulkBytes([]byte("proxy_max_clients_evict_priority")),
+			redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.ProxyMaxClientsEvictPriority, 10))),
 			redis.NewBulkBytes([]byte("proxy_max_offheap_size")),
 			redis.NewBulkBytes([]byte(p.config.ProxyMaxOffheapBytes.HumanString())),
 			redis.NewBulkBytes([]byte("proxy_heap_placeholder")),
 			redis.NewBulkBytes([]byte(p.config.ProxyHeapPlaceholder.HumanString())),
+			redis.NewBulkBytes([]byte("proxy_max_inflight_memory")),
+			redis.NewBulkBytes([]byte(p.config.ProxyMaxInflightMemory.HumanString())),
 		})
+	case "proxy_allow_cidrs":
+		return redis.NewBulkBytes([]byte(p.config.ProxyAllowCIDRs))
+	case "proxy_deny_cidrs":
+		return redis.NewBulkBytes([]byte(p.config.ProxyDenyCIDRs))
 	case "backend_ping_period":
 		return redis.NewBulkBytes([]byte(p.config.BackendPingPeriod.Duration().String()))
 	case "backend_buffer_size":
@@ -256,6 +393,10 @@ func (p *Proxy) ConfigGet(key string) *redis.Resp {
 			redis.NewBulkBytes([]byte("backend_send_timeout")),
 			redis.NewBulkBytes([]byte(p.config.BackendSendTimeout.Duration().String())),
 		})
+	case "backend_recv_timeout":
+		return redis.NewBulkBytes([]byte(p.config.BackendRecvTimeout.Duration().String()))
+	case "backend_send_timeout":
+		return redis.NewBulkBytes([]byte(p.config.BackendSendTimeout.Duration().String()))
 	case "backend_max_pipeline":
 		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.BackendMaxPipeline)))
 	case "backend_primary_only":
@@ -281,6 +422,32 @@ func (p *Proxy) ConfigGet(key string) *redis.Resp {
 			redis.NewBulkBytes([]byte("session_send_bufsize")),
 			redis.NewBulkBytes([]byte(p.config.SessionSendBufsize.HumanString())),
 		})
+	case "redact_key_patterns":
+		return redis.NewBulkBytes([]byte(p.config.RedactKeyPatterns))
+	case "redact_field_patterns":
+		return redis.NewBulkBytes([]byte(p.config.RedactFieldPatterns))
+	case "monitor_sample_ratio":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.MonitorSampleRatio, 10)))
+	case "monitor_redact":
+		return redis.NewBulkBytes([]byte(strconv.FormatBool(p.config.MonitorRedact)))
+	case "audit_log":
+		return redis.NewBulkBytes([]byte(p.config.AuditLog))
+	case "audit_log_categories":
+		return redis.NewBulkBytes([]byte(p.config.AuditLogCategories))
+	case "cmd_rate_limit":
+		return redis.NewBulkBytes([]byte(p.config.CmdRateLimit))
+	case "session_output_buffer_limit":
+		return redis.NewBulkBytes([]byte(p.config.SessionOutputBufferLimit))
+	case "session_output_buffer_action":
+		return redis.NewBulkBytes([]byte(p.config.SessionOutputBufferAction))
+	case "session_acl_file":
+		return redis.NewBulkBytes([]byte(p.config.SessionACLFile))
+	case "session_auth_max_commands":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.SessionAuthMaxCommands, 10)))
+	case "session_batch_threshold":
+		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.SessionBatchThreshold)))
+	case "session_batch_concurrency":
+		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.SessionBatchConcurrency)))
 	case "session_timeout":
 		return redis.NewArray([]*redis.Resp{
 			redis.NewBulkBytes([]byte("session_recv_timeout")),
@@ -288,8 +455,104 @@ func (p *Proxy) ConfigGet(key string) *redis.Resp {
 			redis.NewBulkBytes([]byte("session_send_timeout")),
 			redis.NewBulkBytes([]byte(p.config.SessionSendTimeout.Duration().String())),
 		})
+	case "session_recv_timeout":
+		return redis.NewBulkBytes([]byte(p.config.SessionRecvTimeout.Duration().String()))
+	case "session_send_timeout":
+		return redis.NewBulkBytes([]byte(p.config.SessionSendTimeout.Duration().String()))
 	case "slowlog_log_slower_than":
 		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.SlowlogLogSlowerThan, 10)))
+	case "slowlog_persist_file":
+		return redis.NewBulkBytes([]byte(p.config.SlowlogPersistFile))
+	case "slowlog_export_target":
+		return redis.NewBulkBytes([]byte(p.config.SlowlogExportTarget))
+	case "latency_monitor_threshold":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.LatencyMonitorThreshold, 10)))
+	case "bigkey_size_threshold":
+		return redis.NewBulkBytes([]byte(p.config.BigKeySizeThreshold.HumanString()))
+	case "bigkey_report_file":
+		return redis.NewBulkBytes([]byte(p.config.BigKeyReportFile))
+	case "max_value_bytes":
+		return redis.NewBulkBytes([]byte(p.config.MaxValueBytes.HumanString()))
+	case "max_batch_size":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.MaxBatchSize, 10)))
+	case "max_batch_bytes":
+		return redis.NewBulkBytes([]byte(p.config.MaxBatchBytes.HumanString()))
+	case "cmd_batch_limit":
+		return redis.NewBulkBytes([]byte(p.config.CmdBatchLimit))
+	case "hotkey_capacity":
+		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.HotKeyCapacity)))
+	case "hotkey_sample_ratio":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.HotKeySampleRatio, 10)))
+	case "hotkey_interval":
+		return redis.NewBulkBytes([]byte(p.config.HotKeyInterval.Duration().String()))
+	case "hotkey_cache_size":
+		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.HotKeyCacheSize)))
+	case "hotkey_cache_ttl":
+		return redis.NewBulkBytes([]byte(p.config.HotKeyCacheTTL.Duration().String()))
+	case "hotkey_cache_min_qps":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.HotKeyCacheMinQPS, 10)))
+	case "negative_cache_size":
+		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.NegativeCacheSize)))
+	case "negative_cache_ttl":
+		return redis.NewBulkBytes([]byte(p.config.NegativeCacheTTL.Duration().String()))
+	case "singleflight_commands":
+		return redis.NewBulkBytes([]byte(p.config.SingleflightCommands))
+	case "keys_fanout_enabled":
+		return redis.NewBulkBytes([]byte(strconv.FormatBool(p.config.KeysFanoutEnabled)))
+	case "keys_fanout_max_results":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.KeysFanoutMaxResults, 10)))
+	case "admin_flush_enabled":
+		return redis.NewBulkBytes([]byte(strconv.FormatBool(p.config.AdminFlushEnabled)))
+	case "set_algebra_max_members":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.SetAlgebraMaxMembers, 10)))
+	case "rename_cross_slot_enabled":
+		return redis.NewBulkBytes([]byte(strconv.FormatBool(p.config.RenameCrossSlotEnabled)))
+	case "smove_cross_slot_enabled":
+		return redis.NewBulkBytes([]byte(strconv.FormatBool(p.config.SMoveCrossSlotEnabled)))
+	case "bitop_max_operand_size":
+		return redis.NewBulkBytes([]byte(p.config.BitOpMaxOperandSize.HumanString()))
+	case "msetnx_two_phase_enabled":
+		return redis.NewBulkBytes([]byte(strconv.FormatBool(p.config.MSetNXTwoPhaseEnabled)))
+	case "cluster_emulation_enabled":
+		return redis.NewBulkBytes([]byte(strconv.FormatBool(p.config.ClusterEmulationEnabled)))
+	case "cluster_emulation_nodes":
+		return redis.NewBulkBytes([]byte(p.config.ClusterEmulationNodes))
+	case "hash_tag":
+		return redis.NewBulkBytes([]byte(p.config.HashTag))
+	case "session_replica_read":
+		return redis.NewBulkBytes([]byte(p.config.SessionReplicaRead))
+	case "session_read_your_writes":
+		return redis.NewBulkBytes([]byte(p.config.SessionReadYourWrites.Duration().String()))
+	case "backend_replica_policy":
+		return redis.NewBulkBytes([]byte(p.config.BackendReplicaPolicy))
+	case "backend_replica_max_lag":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.BackendReplicaMaxLag, 10)))
+	case "backend_replica_max_latency":
+		return redis.NewBulkBytes([]byte(p.config.BackendReplicaMaxLatency.Duration().String()))
+	case "backend_hedge_percentile":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.BackendHedgePercentile, 10)))
+	case "backend_retry_max":
+		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.BackendRetryMax)))
+	case "backend_breaker_error_rate":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.BackendBreakerErrorRate, 10)))
+	case "backend_breaker_min_requests":
+		return redis.NewBulkBytes([]byte(strconv.FormatInt(p.config.BackendBreakerMinRequests, 10)))
+	case "backend_breaker_window":
+		return redis.NewBulkBytes([]byte(p.config.BackendBreakerWindow.Duration().String()))
+	case "backend_breaker_cooldown":
+		return redis.NewBulkBytes([]byte(p.config.BackendBreakerCooldown.Duration().String()))
+	case "backend_drain_timeout":
+		return redis.NewBulkBytes([]byte(p.config.BackendDrainTimeout.Duration().String()))
+	case "backend_warmup_timeout":
+		return redis.NewBulkBytes([]byte(p.config.BackendWarmupTimeout.Duration().String()))
+	case "backend_retry_backoff":
+		return redis.NewBulkBytes([]byte(p.config.BackendRetryBackoff.Duration().String()))
+	case "hash_mode":
+		return redis.NewBulkBytes([]byte(p.config.HashMode))
+	case "router_mode":
+		return redis.NewBulkBytes([]byte(p.config.RouterMode))
+	case "ring_virtual_nodes":
+		return redis.NewBulkBytes([]byte(strconv.Itoa(p.config.RingVirtualNodes)))
 	case "metrics_report_server":
 		return redis.NewBulkBytes([]byte(p.config.MetricsReportServer))
 	case "metrics_report_period":
@@ -327,7 +590,7 @@ func (p *Proxy) ConfigGet(key string) *redis.Resp {
 			return redis.NewBulkBytes(text)
 		}
 	default:
-		return redis.NewErrorf("unsupported key: %s", key)
+		return redis.NewErrorf("ERR unsupported config key '%s'", key)
 	}
 }
 
@@ -348,6 +611,100 @@ func (p *Proxy) ConfigSet(key, value string) *redis.Resp {
 		}
 		p.config.ProxyMaxClients = n
 		return redis.NewString([]byte("OK"))
+	case "proxy_max_inflight_memory":
+		n, err := bytesize.Parse(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid proxy_max_inflight_memory")
+		}
+		setInflightBudget(n)
+		p.config.ProxyMaxInflightMemory = bytesize.Int64(n)
+		return redis.NewString([]byte("OK"))
+	case "proxy_max_clients_policy":
+		if err := checkMaxClientsPolicy(value); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.ProxyMaxClientsPolicy = value
+		return redis.NewString([]byte("OK"))
+	case "proxy_max_clients_evict_idle":
+		d, err := timesize.Parse(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if d < 0 {
+			return redis.NewErrorf("invalid proxy_max_clients_evict_idle")
+		}
+		p.config.ProxyMaxClientsEvictIdle.Set(d)
+		return redis.NewString([]byte("OK"))
+	case "proxy_max_clients_evict_priority":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.ProxyMaxClientsEvictPriority = n
+		return redis.NewString([]byte("OK"))
+	case "redact_key_patterns":
+		SetRedactRules(value, p.config.RedactFieldPatterns)
+		p.config.RedactKeyPatterns = value
+		return redis.NewString([]byte("OK"))
+	case "redact_field_patterns":
+		SetRedactRules(p.config.RedactKeyPatterns, value)
+		p.config.RedactFieldPatterns = value
+		return redis.NewString([]byte("OK"))
+	case "monitor_sample_ratio":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 {
+			return redis.NewErrorf("invalid monitor_sample_ratio")
+		}
+		SetMonitorOptions(n, p.config.MonitorRedact)
+		p.config.MonitorSampleRatio = n
+		return redis.NewString([]byte("OK"))
+	case "monitor_redact":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return redis.NewErrorf("invalid monitor_redact")
+		}
+		SetMonitorOptions(p.config.MonitorSampleRatio, b)
+		p.config.MonitorRedact = b
+		return redis.NewString([]byte("OK"))
+	case "audit_log_categories":
+		if err := SetAuditCategories(value); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.AuditLogCategories = value
+		return redis.NewString([]byte("OK"))
+	case "cmd_rate_limit":
+		if err := SetCmdRateLimit(value); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.CmdRateLimit = value
+		return redis.NewString([]byte("OK"))
+	case "session_output_buffer_limit":
+		if err := SetOutputBufferLimit(value); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.SessionOutputBufferLimit = value
+		return redis.NewString([]byte("OK"))
+	case "session_output_buffer_action":
+		if err := checkOutputBufferAction(value); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.SessionOutputBufferAction = value
+		return redis.NewString([]byte("OK"))
+	case "proxy_allow_cidrs":
+		if err := SetAccessList(value, p.config.ProxyDenyCIDRs); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.ProxyAllowCIDRs = value
+		return redis.NewString([]byte("OK"))
+	case "proxy_deny_cidrs":
+		if err := SetAccessList(p.config.ProxyAllowCIDRs, value); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.ProxyDenyCIDRs = value
+		return redis.NewString([]byte("OK"))
 	case "backend_primary_only":
 		return redis.NewErrorf("not currently supported")
 	case "slowlog_log_slower_than":
@@ -360,6 +717,294 @@ func (p *Proxy) ConfigSet(key, value string) *redis.Resp {
 		}
 		p.config.SlowlogLogSlowerThan = n
 		return redis.NewString([]byte("OK"))
+	case "latency_monitor_threshold":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid latency_monitor_threshold")
+		}
+		p.config.LatencyMonitorThreshold = n
+		return redis.NewString([]byte("OK"))
+	case "bigkey_size_threshold":
+		var n bytesize.Int64
+		if err := n.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid bigkey_size_threshold")
+		}
+		p.config.BigKeySizeThreshold = n
+		StatsSetBigKeyThreshold(n.Int64())
+		return redis.NewString([]byte("OK"))
+	case "max_value_bytes":
+		var n bytesize.Int64
+		if err := n.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid max_value_bytes")
+		}
+		p.config.MaxValueBytes = n
+		SetMaxValueBytes(n.Int64())
+		return redis.NewString([]byte("OK"))
+	case "max_batch_size":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid max_batch_size")
+		}
+		if err := SetBatchLimit(n, p.config.MaxBatchBytes.Int64(), p.config.CmdBatchLimit); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.MaxBatchSize = n
+		return redis.NewString([]byte("OK"))
+	case "max_batch_bytes":
+		var n bytesize.Int64
+		if err := n.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid max_batch_bytes")
+		}
+		if err := SetBatchLimit(p.config.MaxBatchSize, n.Int64(), p.config.CmdBatchLimit); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.MaxBatchBytes = n
+		return redis.NewString([]byte("OK"))
+	case "cmd_batch_limit":
+		if err := SetBatchLimit(p.config.MaxBatchSize, p.config.MaxBatchBytes.Int64(), value); err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.CmdBatchLimit = value
+		return redis.NewString([]byte("OK"))
+	case "hotkey_capacity":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid hotkey_capacity")
+		}
+		p.config.HotKeyCapacity = n
+		SetHotKeySampler(n, p.config.HotKeySampleRatio, p.config.HotKeyInterval.Duration())
+		return redis.NewString([]byte("OK"))
+	case "hotkey_sample_ratio":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n <= 0 {
+			return redis.NewErrorf("invalid hotkey_sample_ratio")
+		}
+		p.config.HotKeySampleRatio = n
+		SetHotKeySampler(p.config.HotKeyCapacity, n, p.config.HotKeyInterval.Duration())
+		return redis.NewString([]byte("OK"))
+	case "hotkey_interval":
+		var d timesize.Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if d <= 0 {
+			return redis.NewErrorf("invalid hotkey_interval")
+		}
+		p.config.HotKeyInterval = d
+		SetHotKeySampler(p.config.HotKeyCapacity, p.config.HotKeySampleRatio, d.Duration())
+		return redis.NewString([]byte("OK"))
+	case "hotkey_cache_size":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid hotkey_cache_size")
+		}
+		p.config.HotKeyCacheSize = n
+		SetHotKeyCache(n, p.config.HotKeyCacheTTL.Duration(), p.config.HotKeyCacheMinQPS)
+		return redis.NewString([]byte("OK"))
+	case "hotkey_cache_ttl":
+		var d timesize.Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if d <= 0 {
+			return redis.NewErrorf("invalid hotkey_cache_ttl")
+		}
+		p.config.HotKeyCacheTTL = d
+		SetHotKeyCache(p.config.HotKeyCacheSize, d.Duration(), p.config.HotKeyCacheMinQPS)
+		return redis.NewString([]byte("OK"))
+	case "hotkey_cache_min_qps":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid hotkey_cache_min_qps")
+		}
+		p.config.HotKeyCacheMinQPS = n
+		SetHotKeyCache(p.config.HotKeyCacheSize, p.config.HotKeyCacheTTL.Duration(), n)
+		return redis.NewString([]byte("OK"))
+	case "negative_cache_size":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid negative_cache_size")
+		}
+		p.config.NegativeCacheSize = n
+		SetNegativeCache(n, p.config.NegativeCacheTTL.Duration())
+		return redis.NewString([]byte("OK"))
+	case "negative_cache_ttl":
+		var d timesize.Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if d <= 0 {
+			return redis.NewErrorf("invalid negative_cache_ttl")
+		}
+		p.config.NegativeCacheTTL = d
+		SetNegativeCache(p.config.NegativeCacheSize, d.Duration())
+		return redis.NewString([]byte("OK"))
+	case "singleflight_commands":
+		p.config.SingleflightCommands = value
+		SetSingleflightCommands(value)
+		return redis.NewString([]byte("OK"))
+	case "bitop_max_operand_size":
+		var n bytesize.Int64
+		if err := n.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid bitop_max_operand_size")
+		}
+		p.config.BitOpMaxOperandSize = n
+		return redis.NewString([]byte("OK"))
+	case "keys_fanout_enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.KeysFanoutEnabled = b
+		return redis.NewString([]byte("OK"))
+	case "backend_replica_max_lag":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid backend_replica_max_lag")
+		}
+		p.config.BackendReplicaMaxLag = n
+		return redis.NewString([]byte("OK"))
+	case "backend_retry_max":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid backend_retry_max")
+		}
+		p.config.BackendRetryMax = n
+		return redis.NewString([]byte("OK"))
+	case "backend_replica_max_latency":
+		var d timesize.Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if d < 0 {
+			return redis.NewErrorf("invalid backend_replica_max_latency")
+		}
+		p.config.BackendReplicaMaxLatency = d
+		return redis.NewString([]byte("OK"))
+	case "backend_retry_backoff":
+		var d timesize.Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if d < 0 {
+			return redis.NewErrorf("invalid backend_retry_backoff")
+		}
+		p.config.BackendRetryBackoff = d
+		return redis.NewString([]byte("OK"))
+	case "backend_hedge_percentile":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if n < 0 || n >= 100 {
+			return redis.NewErrorf("invalid backend_hedge_percentile")
+		}
+		p.config.BackendHedgePercentile = n
+		SetHedgePercentile(n)
+		return redis.NewString([]byte("OK"))
+	case "backend_replica_policy":
+		switch value {
+		case "", ReplicaPolicyRandom, ReplicaPolicyRoundRobin, ReplicaPolicyLatency:
+		default:
+			return redis.NewErrorf("invalid backend_replica_policy")
+		}
+		p.config.BackendReplicaPolicy = value
+		return redis.NewString([]byte("OK"))
+	case "session_replica_read":
+		switch value {
+		case ReplicaReadAlways, ReplicaReadOnly:
+		default:
+			return redis.NewErrorf("invalid session_replica_read")
+		}
+		p.config.SessionReplicaRead = value
+		return redis.NewString([]byte("OK"))
+	case "rename_cross_slot_enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.RenameCrossSlotEnabled = b
+		return redis.NewString([]byte("OK"))
+	case "smove_cross_slot_enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.SMoveCrossSlotEnabled = b
+		return redis.NewString([]byte("OK"))
+	case "msetnx_two_phase_enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.MSetNXTwoPhaseEnabled = b
+		return redis.NewString([]byte("OK"))
+	case "cluster_emulation_enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		p.config.ClusterEmulationEnabled = b
+		return redis.NewString([]byte("OK"))
+	case "set_algebra_max_members":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if n < 0 {
+			return redis.NewErrorf("invalid set_algebra_max_members")
+		}
+		p.config.SetAlgebraMaxMembers = n
+		return redis.NewString([]byte("OK"))
+	case "keys_fanout_max_results":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return redis.NewErrorf("err：%s", err)
+		}
+		if n <= 0 {
+			return redis.NewErrorf("invalid keys_fanout_max_results")
+		}
+		p.config.KeysFanoutMaxResults = n
+		return redis.NewString([]byte("OK"))
 	case "quick_cmd_list":
 		err := setCmdListFlag(value, FlagQuick)
 		if err != nil {
@@ -416,8 +1061,34 @@ func (p *Proxy) ConfigSet(key, value string) *redis.Resp {
 			RefreshPeriod.Set(int64(d))
 			return redis.NewString([]byte("OK"))
 		}
+	case "session_recv_timeout", "session_send_timeout", "backend_recv_timeout", "backend_send_timeout",
+		"session_read_your_writes":
+		// The new timeouts only take effect on connections created afterwards.
+		var d timesize.Duration
+		if err := d.UnmarshalText([]byte(value)); err != nil {
+			return redis.NewErrorf("err：%s.", err)
+		}
+		if d < 0 {
+			return redis.NewErrorf("invalid %s", key)
+		}
+		switch key {
+		case "session_recv_timeout":
+			p.config.SessionRecvTimeout = d
+		case "session_send_timeout":
+			p.config.SessionSendTimeout = d
+		case "session_read_your_writes":
+			p.config.SessionReadYourWrites = d
+		case "backend_recv_timeout":
+			p.config.BackendRecvTimeout = d
+		case "backend_send_timeout":
+			p.config.BackendSendTimeout = d
+		}
+		return redis.NewString([]byte("OK"))
 	default:
-		return redis.NewErrorf("unsupported key: %s", key)
+		if resp := p.configGet(key); !resp.IsError() {
+			return redis.NewErrorf("ERR config key '%s' is read-only", key)
+		}
+		return redis.NewErrorf("ERR unsupported config key '%s'", key)
 	}
 }
 
@@ -458,15 +1129,40 @@ func (p *Proxy) FillSlot(m *models.Slot) error {
 	if p.closed {
 		return ErrClosedProxy
 	}
+	defer p.syncScripts(p.router.backendAddrs())
 	return p.router.FillSlot(m)
 }
 
+// syncScripts loads the known scripts and libraries into the backends that
+// didn't serve any slot before, so EVALSHA and FCALL don't fail after
+// scaling out.
+func (p *Proxy) syncScripts(before []string) {
+	var seen = make(map[string]bool, len(before))
+	for _, addr := range before {
+		seen[addr] = true
+	}
+	for _, addr := range p.router.backendAddrs() {
+		if seen[addr] {
+			continue
+		}
+		go func(addr string) {
+			if err := loadScripts(addr, p.config); err != nil {
+				log.WarnErrorf(err, "proxy load scripts into %s failed", addr)
+			}
+			if err := loadLibraries(addr, p.config); err != nil {
+				log.WarnErrorf(err, "proxy load libraries into %s failed", addr)
+			}
+		}(addr)
+	}
+}
+
 func (p *Proxy) FillSlots(slots []*models.Slot) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if p.closed {
 		return ErrClosedProxy
 	}
+	defer p.syncScripts(p.router.backendAddrs())
 	for _, m := range slots {
 		if err := p.router.FillSlot(m); err != nil {
 			return err
@@ -475,6 +1171,67 @@ func (p *Proxy) FillSlots(slots []*models.Slot) error {
 	return nil
 }
 
+// SetCommands disables or renames the commands as pushed by the dashboard.
+func (p *Proxy) SetCommands(c *models.Commands) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosedProxy
+	}
+	if err := SetCommandOverrides(c); err != nil {
+		return err
+	}
+	log.Warnf("[%p] set commands:\n%s", p, c.Encode())
+	p.commands = c
+	return nil
+}
+
+func (p *Proxy) Commands() *models.Commands {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.commands
+}
+
+// SetQPSLimit sets the share of the QPS limit of the product given by the
+// dashboard, 0 means unlimited.
+func (p *Proxy) SetQPSLimit(n int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosedProxy
+	}
+	if n < 0 {
+		return errors.Errorf("invalid qps limit %d", n)
+	}
+	if qpsLimit.rate.Int64() != n {
+		log.Warnf("[%p] set qps limit = %d", p, n)
+	}
+	setQPSLimit(n)
+	return nil
+}
+
+// SetQuotas replaces the quotas of the users as pushed by the dashboard.
+func (p *Proxy) SetQuotas(q *models.Quotas) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosedProxy
+	}
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	setQuotas(q)
+	log.Warnf("[%p] set quotas:\n%s", p, q.Encode())
+	p.quotas = q
+	return nil
+}
+
+func (p *Proxy) Quotas() *models.Quotas {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.quotas
+}
+
 func (p *Proxy) SwitchMasters(masters map[int]string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -540,6 +1297,11 @@ func (p *Proxy) serveProxy() {
 			if err != nil {
 				return err
 			}
+			if !checkAccess(c.RemoteAddr()) {
+				log.Debugf("[%p] proxy reject connection from %s", p, c.RemoteAddr())
+				c.Close()
+				continue
+			}
 			NewSession(c, p.config, p).Start(p.router)
 		}
 	}(p.lproxy)
@@ -547,6 +1309,16 @@ func (p *Proxy) serveProxy() {
 	if d := p.config.BackendPingPeriod.Duration(); d != 0 {
 		go p.keepAlive(d)
 	}
+	if path := p.config.BigKeyReportFile; path != "" {
+		go p.saveReport("big-key report", path, SaveBigKeys)
+	}
+	if path := p.config.SlowlogPersistFile; path != "" {
+		go p.saveReport("slowlog", path, SaveSlowlog)
+	}
+	if p.config.TrackingKeyspaceEvents {
+		go p.watchKeyspace()
+	}
+	go p.loopSlotStats()
 
 	if err := setCmdListFlag(p.config.QuickCmdList, FlagQuick); err != nil {
 		log.PanicErrorf(err, "setQuickCmdList [%s] failed", p.config.QuickCmdList)
@@ -556,6 +1328,9 @@ func (p *Proxy) serveProxy() {
 	}
 
 	StatsSetLogSlowerThan(p.config.SlowlogLogSlowerThan)
+	StatsSetBigKeyThreshold(p.config.BigKeySizeThreshold.Int64())
+	SetMaxValueBytes(p.config.MaxValueBytes.Int64())
+	SetHedgePercentile(p.config.BackendHedgePercentile)
 
 	select {
 	case <-p.exit.C:
@@ -578,6 +1353,26 @@ func (p *Proxy) keepAlive(d time.Duration) {
 	}
 }
 
+// saveReport saves the report, e.g. the big keys or the slowlog, to the file
+// periodically, and once more when the proxy is closed.
+func (p *Proxy) saveReport(name, path string, save func(path string) error) {
+	var ticker = time.NewTicker(time.Second * 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.exit.C:
+			if err := save(path); err != nil {
+				log.WarnErrorf(err, "[%p] save %s to %s failed", p, name, path)
+			}
+			return
+		case <-ticker.C:
+			if err := save(path); err != nil {
+				log.WarnErrorf(err, "[%p] save %s to %s failed", p, name, path)
+			}
+		}
+	}
+}
+
 func (p *Proxy) acceptConn(l net.Listener) (net.Conn, error) {
 	var delay = &DelayExp2{
 		Min: 10, Max: 500,
@@ -603,6 +1398,12 @@ type Overview struct {
 	Model   *models.Proxy  `json:"model,omitempty"`
 	Stats   *Stats         `json:"stats,omitempty"`
 	Slots   []*models.Slot `json:"slots,omitempty"`
+
+	Commands *models.Commands `json:"commands,omitempty"`
+
+	AuthRotation *models.AuthRotation `json:"auth_rotation,omitempty"`
+
+	Quotas *models.Quotas `json:"quotas,omitempty"`
 }
 
 type CmdInfo struct {
@@ -615,6 +1416,11 @@ type CmdInfo struct {
 	Cmd []*OpStats `json:"cmd,omitempty"`
 }
 
+type UnknownCmdsInfo struct {
+	Cmds     []*UnknownCmd `json:"cmds"`
+	Overflow int64         `json:"overflow"`
+}
+
 type Stats struct {
 	Online bool `json:"online"`
 	Closed bool `json:"closed"`
@@ -626,9 +1432,11 @@ type Stats struct {
 	} `json:"sentinels"`
 
 	Ops struct {
-		Total int64 `json:"total"`
-		Fails int64 `json:"fails"`
-		Redis struct {
+		Total     int64 `json:"total"`
+		Fails     int64 `json:"fails"`
+		Expired   int64 `json:"expired"`
+		Collapsed int64 `json:"collapsed"`
+		Redis     struct {
 			Errors int64 `json:"errors"`
 		} `json:"redis"`
 		QPS int64      `json:"qps"`
@@ -636,8 +1444,13 @@ type Stats struct {
 	} `json:"ops"`
 
 	Sessions struct {
-		Total int64 `json:"total"`
-		Alive int64 `json:"alive"`
+		Total    int64 `json:"total"`
+		Alive    int64 `json:"alive"`
+		Rejected int64 `json:"rejected"`
+		Evicted  int64 `json:"evicted"`
+		Slow     int64 `json:"slow"`
+
+		Clients []*ClientStats `json:"clients,omitempty"`
 	} `json:"sessions"`
 
 	Rusage struct {
@@ -648,11 +1461,33 @@ type Stats struct {
 	} `json:"rusage"`
 
 	Backend struct {
-		PrimaryOnly bool `json:"primary_only"`
+		PrimaryOnly  bool  `json:"primary_only"`
+		HedgedReads  int64 `json:"hedged_reads"`
+		Retries      int64 `json:"retries"`
+		BreakerTrips int64 `json:"breaker_trips"`
+
+		Probes []*BackendProbe `json:"probes,omitempty"`
 	} `json:"backend"`
 
+	Access *AccessStats  `json:"access"`
+	Audit  *AuditStats   `json:"audit,omitempty"`
+	Quotas []*QuotaStats `json:"quotas,omitempty"`
+
+	CmdRateLimits []*CmdRateLimitStats `json:"cmd_rate_limits,omitempty"`
+	HotKeys       []*HotKeyInfo        `json:"hotkeys,omitempty"`
+	HotKeyCache   *HotKeyCacheStats    `json:"hotkey_cache,omitempty"`
+	NegativeCache *NegativeCacheStats  `json:"negative_cache,omitempty"`
+	QPSLimit      *QPSLimitStats       `json:"qps_limit,omitempty"`
+
+	Inflight *InflightStats `json:"inflight,omitempty"`
+
+	Slots []*SlotStats `json:"slots,omitempty"`
+
 	Runtime      *RuntimeStats `json:"runtime,omitempty"`
 	SlowCmdCount int64         `json:"slow_cmd_count"` // Cumulative count of slow log
+
+	// ConfigVersion is the version of the last config change on the proxy.
+	ConfigVersion int64 `json:"config_version,omitempty"`
 }
 
 type RuntimeStats struct {
@@ -682,6 +1517,8 @@ type RuntimeStats struct {
 	NumGoroutines int   `json:"num_goroutines"`
 	NumCgoCall    int64 `json:"num_cgo_call"`
 	MemOffheap    int64 `json:"mem_offheap"`
+
+	Tuning *RuntimeTuningStats `json:"tuning,omitempty"`
 }
 
 type StatsFlags uint32
@@ -709,6 +1546,9 @@ func (p *Proxy) Overview(flags StatsFlags) *Overview {
 	if flags.HasBit(StatsSlots) {
 		o.Slots = p.Slots()
 	}
+	o.Commands = p.Commands()
+	o.AuthRotation = p.AuthRotation().Masked()
+	o.Quotas = p.Quotas()
 	return o
 }
 
@@ -719,15 +1559,18 @@ func (p *Proxy) Stats(flags StatsFlags) *Stats {
 
 	stats.Ops.Total = OpTotal()
 	stats.Ops.Fails = OpFails()
+	stats.Ops.Expired = GetExpiredRequests()
+	stats.Ops.Collapsed = GetSingleflightCollapsed()
 	stats.Ops.Redis.Errors = OpRedisErrors()
 	stats.Ops.QPS = OpQPS()
-	stats.Ops.Cmd = GetOpStatsByInterval(1)
-	if flags.HasBit(StatsCmds) {
-		stats.Ops.Cmd = GetOpStatsAll()
-	}
+	stats.Ops.Cmd = GetOpStatsAll()
 
 	stats.Sessions.Total = SessionsTotal()
 	stats.Sessions.Alive = SessionsAlive()
+	stats.Sessions.Rejected = SessionsRejected()
+	stats.Sessions.Evicted = SessionsEvicted()
+	stats.Sessions.Slow = SessionsSlow()
+	stats.Sessions.Clients = GetClientStats()
 
 	if u := GetSysUsage(); u != nil {
 		stats.Rusage.Now = u.Now.String()
@@ -737,6 +1580,24 @@ func (p *Proxy) Stats(flags StatsFlags) *Stats {
 	}
 
 	stats.Backend.PrimaryOnly = p.Config().BackendPrimaryOnly
+	stats.Backend.HedgedReads = hedgeStats.HedgedReads.Int64()
+	stats.Backend.Retries = RetryCount.Int64()
+	stats.Backend.BreakerTrips = BreakerTrips.Int64()
+	stats.Backend.Probes = p.router.BackendProbes()
+
+	stats.Access = GetAccessStats()
+	stats.Audit = GetAuditStats()
+	stats.Quotas = GetQuotaStats()
+	stats.CmdRateLimits = GetCmdRateLimitStats()
+	stats.HotKeys = GetHotKeys()
+	stats.HotKeyCache = GetHotKeyCacheStats()
+	stats.NegativeCache = GetNegativeCacheStats()
+	stats.QPSLimit = GetQPSLimitStats()
+	stats.Inflight = GetInflightStats()
+	if flags.HasBit(StatsSlots) {
+		stats.Slots = p.SlotStats()
+	}
+	stats.ConfigVersion = p.ConfigVersion()
 
 	if flags.HasBit(StatsRuntime) {
 		var r runtime.MemStats
@@ -760,6 +1621,7 @@ func (p *Proxy) Stats(flags StatsFlags) *Stats {
 		stats.Runtime.NumGoroutines = runtime.NumGoroutine()
 		stats.Runtime.NumCgoCall = runtime.NumCgoCall()
 		stats.Runtime.MemOffheap = unsafe2.OffheapBytes()
+		stats.Runtime.Tuning = p.RuntimeTuningStats()
 	}
 	stats.SlowCmdCount = SlowCmdCount.Int64()
 	return stats
@@ -45,6 +45,9 @@ func newApiServer(p *Proxy) http.Handler {
 		}
 		c.Next()
 	})
+	m.Use(func(w http.ResponseWriter, req *http.Request) {
+		rpc.ApiVerifyToken(w, req)
+	})
 	m.Use(gzip.All())
 	m.Use(func(c martini.Context, w http.ResponseWriter) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -59,6 +62,7 @@ func newApiServer(p *Proxy) http.Handler {
 	r.Any("/debug/**", func(w http.ResponseWriter, req *http.Request) {
 		http.DefaultServeMux.ServeHTTP(w, req)
 	})
+	r.Get("/metrics", api.Metrics)
 
 	r.Group("/proxy", func(r martini.Router) {
 		r.Get("", api.Overview)
@@ -76,10 +80,27 @@ func newApiServer(p *Proxy) http.Handler {
 		r.Get("/slots/:xauth", api.Slots)
 		r.Put("/start/:xauth", api.Start)
 		r.Put("/stats/reset/:xauth", api.ResetStats)
+		r.Get("/unknowncmds/:xauth", api.UnknownCmds)
+		r.Put("/unknowncmds/reset/:xauth", api.ResetUnknownCmds)
+		r.Get("/bigkeys/:xauth", api.BigKeys)
+		r.Put("/bigkeys/reset/:xauth", api.ResetBigKeys)
+		r.Get("/slowlog/:xauth", api.Slowlog)
+		r.Put("/slowlog/reset/:xauth", api.ResetSlowlog)
 		r.Put("/forcegc/:xauth", api.ForceGC)
+		r.Get("/runtime/:xauth", api.RuntimeTuning)
+		r.Put("/runtime/:xauth", binding.Json(RuntimeTuning{}), api.SetRuntimeTuning)
+		r.Put("/profile/:xauth/:kind", api.Profile)
+		r.Put("/profile/:xauth/:kind/:seconds", api.Profile)
 		r.Put("/shutdown/:xauth", api.Shutdown)
 		r.Put("/loglevel/:xauth/:value", api.LogLevel)
+		r.Put("/logformat/:xauth/:value", api.LogFormat)
 		r.Put("/fillslots/:xauth", binding.Json([]*models.Slot{}), api.FillSlots)
+		r.Put("/commands/:xauth", binding.Json(models.Commands{}), api.SetCommands)
+		r.Put("/auth-rotation/:xauth", binding.Json(models.AuthRotation{}), api.SetAuthRotation)
+		r.Put("/quotas/:xauth", binding.Json(models.Quotas{}), api.SetQuotas)
+		r.Put("/qpslimit/:xauth/:value", api.SetQPSLimit)
+		r.Get("/config/changes/:xauth/:since", api.ConfigChanges)
+		r.Put("/config/:xauth", binding.Json(models.ConfigChange{}), api.SetConfig)
 	})
 
 	m.MapTo(r, (*martini.Routes)(nil))
@@ -95,7 +116,7 @@ func (s *apiServer) verifyXAuth(params martini.Params) error {
 	if xauth == "" {
 		return errors.New("missing xauth, please check product name & auth")
 	}
-	if xauth != s.proxy.XAuth() {
+	if !s.proxy.IsXAuth(xauth) {
 		return errors.New("invalid xauth, please check product name & auth")
 	}
 	return nil
@@ -121,6 +142,13 @@ func (s *apiServer) CmdInfoNoXAuth() (int, string) {
 	return rpc.ApiResponseJson(s.proxy.CmdInfo(2))
 }
 
+func (s *apiServer) Metrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.proxy.WriteMetrics(w); err != nil {
+		log.WarnErrorf(err, "[%p] write metrics failed", s.proxy)
+	}
+}
+
 func (s *apiServer) XPing(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -184,6 +212,56 @@ func (s *apiServer) ResetStats(params martini.Params) (int, string) {
 		return rpc.ApiResponseError(err)
 	} else {
 		ResetStats()
+		s.proxy.ResetSlotStats()
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
+func (s *apiServer) UnknownCmds(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	cmds, overflow := GetUnknownCmds()
+	return rpc.ApiResponseJson(&UnknownCmdsInfo{Cmds: cmds, Overflow: overflow})
+}
+
+func (s *apiServer) ResetUnknownCmds(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		ResetUnknownCmds()
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
+func (s *apiServer) BigKeys(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(GetBigKeys())
+}
+
+func (s *apiServer) ResetBigKeys(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		ResetBigKeys()
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
+func (s *apiServer) Slowlog(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(GetSlowlog(-1))
+}
+
+func (s *apiServer) ResetSlowlog(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		ResetSlowlog()
 		return rpc.ApiResponseJson("OK")
 	}
 }
@@ -197,6 +275,32 @@ func (s *apiServer) ForceGC(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) RuntimeTuning(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(s.proxy.RuntimeTuningStats())
+}
+
+func (s *apiServer) SetRuntimeTuning(t RuntimeTuning, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	stats, err := s.proxy.SetRuntimeTuning(&t)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(stats)
+}
+
+func (s *apiServer) Profile(params martini.Params, w http.ResponseWriter) {
+	if err := s.verifyXAuth(params); err != nil {
+		rpc.ApiWriteError(w, err)
+		return
+	}
+	rpc.ApiResponseProfile(w, "proxy", params["kind"], params["seconds"])
+}
+
 func (s *apiServer) LogLevel(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -213,6 +317,22 @@ func (s *apiServer) LogLevel(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) LogFormat(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	v := params["value"]
+	if v == "" {
+		return rpc.ApiResponseError(errors.New("missing logformat"))
+	}
+	if !log.SetFormatString(v) {
+		return rpc.ApiResponseError(errors.New("invalid logformat"))
+	} else {
+		log.Warnf("set logformat to %s", v)
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
 func (s *apiServer) Shutdown(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -234,6 +354,73 @@ func (s *apiServer) FillSlots(slots []*models.Slot, params martini.Params) (int,
 	return rpc.ApiResponseJson("OK")
 }
 
+func (s *apiServer) SetCommands(c models.Commands, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.proxy.SetCommands(&c); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) SetAuthRotation(r models.AuthRotation, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.proxy.SetAuthRotation(&r); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) SetQuotas(q models.Quotas, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.proxy.SetQuotas(&q); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) SetQPSLimit(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	n, err := strconv.ParseInt(params["value"], 10, 64)
+	if err != nil {
+		return rpc.ApiResponseError(errors.New("invalid qps limit"))
+	}
+	if err := s.proxy.SetQPSLimit(n); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) ConfigChanges(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	since, err := strconv.ParseInt(params["since"], 10, 64)
+	if err != nil {
+		return rpc.ApiResponseError(errors.New("invalid config version"))
+	}
+	return rpc.ApiResponseJson(s.proxy.ConfigChanges(since))
+}
+
+// SetConfig changes the config to c.New as of XCONFIG SET by c.Who, e.g. to
+// roll back a change by the dashboard.
+func (s *apiServer) SetConfig(c models.ConfigChange, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if resp := s.proxy.SetConfig(strings.ToLower(c.Key), c.New, c.Who); resp.IsError() {
+		return rpc.ApiResponseError(errors.Errorf("set config %s failed: %s", c.Key, resp.Value))
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
 type ApiClient struct {
 	addr  string
 	xauth string
@@ -315,6 +502,48 @@ func (c *ApiClient) ResetStats() error {
 	return rpc.ApiPutJson(url, nil, nil)
 }
 
+func (c *ApiClient) UnknownCmds() (*UnknownCmdsInfo, error) {
+	url := c.encodeURL("/api/proxy/unknowncmds/%s", c.xauth)
+	info := &UnknownCmdsInfo{}
+	if err := rpc.ApiGetJson(url, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (c *ApiClient) ResetUnknownCmds() error {
+	url := c.encodeURL("/api/proxy/unknowncmds/reset/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) BigKeys() ([]*BigKeyInfo, error) {
+	url := c.encodeURL("/api/proxy/bigkeys/%s", c.xauth)
+	var keys []*BigKeyInfo
+	if err := rpc.ApiGetJson(url, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (c *ApiClient) ResetBigKeys() error {
+	url := c.encodeURL("/api/proxy/bigkeys/reset/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) Slowlog() ([]*SlowlogEntry, error) {
+	url := c.encodeURL("/api/proxy/slowlog/%s", c.xauth)
+	var entries []*SlowlogEntry
+	if err := rpc.ApiGetJson(url, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (c *ApiClient) ResetSlowlog() error {
+	url := c.encodeURL("/api/proxy/slowlog/reset/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
 func (c *ApiClient) ForceGC() error {
 	url := c.encodeURL("/api/proxy/forcegc/%s", c.xauth)
 	return rpc.ApiPutJson(url, nil, nil)
@@ -330,6 +559,11 @@ func (c *ApiClient) LogLevel(level log.LogLevel) error {
 	return rpc.ApiPutJson(url, nil, nil)
 }
 
+func (c *ApiClient) LogFormat(format log.LogFormat) error {
+	url := c.encodeURL("/api/proxy/logformat/%s/%s", c.xauth, format)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
 func (c *ApiClient) Shutdown() error {
 	url := c.encodeURL("/api/proxy/shutdown/%s", c.xauth)
 	return rpc.ApiPutJson(url, nil, nil)
@@ -339,3 +573,60 @@ func (c *ApiClient) FillSlots(slots ...*models.Slot) error {
 	url := c.encodeURL("/api/proxy/fillslots/%s", c.xauth)
 	return rpc.ApiPutJson(url, slots, nil)
 }
+
+func (c *ApiClient) SetCommands(commands *models.Commands) error {
+	url := c.encodeURL("/api/proxy/commands/%s", c.xauth)
+	return rpc.ApiPutJson(url, commands, nil)
+}
+
+func (c *ApiClient) SetAuthRotation(r *models.AuthRotation) error {
+	url := c.encodeURL("/api/proxy/auth-rotation/%s", c.xauth)
+	return rpc.ApiPutJson(url, r, nil)
+}
+
+func (c *ApiClient) SetQuotas(q *models.Quotas) error {
+	url := c.encodeURL("/api/proxy/quotas/%s", c.xauth)
+	return rpc.ApiPutJson(url, q, nil)
+}
+
+func (c *ApiClient) SetQPSLimit(n int64) error {
+	url := c.encodeURL("/api/proxy/qpslimit/%s/%d", c.xauth, n)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) ConfigChanges(since int64) ([]*models.ConfigChange, error) {
+	url := c.encodeURL("/api/proxy/config/changes/%s/%d", c.xauth, since)
+	var changes []*models.ConfigChange
+	if err := rpc.ApiGetJson(url, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (c *ApiClient) SetConfig(change *models.ConfigChange) error {
+	url := c.encodeURL("/api/proxy/config/%s", c.xauth)
+	return rpc.ApiPutJson(url, change, nil)
+}
+
+func (c *ApiClient) Profile(kind string, seconds int) ([]byte, error) {
+	url := c.encodeURL("/api/proxy/profile/%s/%s/%d", c.xauth, kind, seconds)
+	return rpc.ApiPutProfile(url, seconds)
+}
+
+func (c *ApiClient) RuntimeTuning() (*RuntimeTuningStats, error) {
+	url := c.encodeURL("/api/proxy/runtime/%s", c.xauth)
+	var stats = &RuntimeTuningStats{}
+	if err := rpc.ApiGetJson(url, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (c *ApiClient) SetRuntimeTuning(t *RuntimeTuning) (*RuntimeTuningStats, error) {
+	url := c.encodeURL("/api/proxy/runtime/%s", c.xauth)
+	var stats = &RuntimeTuningStats{}
+	if err := rpc.ApiPutJson(url, t, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -4,6 +4,7 @@
 package proxy
 
 import (
+	"strings"
 	"testing"
 
 	"pika/codis/v2/pkg/models"
@@ -15,6 +16,7 @@ var config = newProxyConfig()
 
 func init() {
 	log.SetLevel(log.LevelError)
+	models.SetMaxSlotNum(config.MaxSlotNum)
 }
 
 func newProxyConfig() *Config {
@@ -138,3 +140,85 @@ func TestStartAndShutdown(x *testing.T) {
 	err3 := c.Start()
 	assert.Must(err3 != nil)
 }
+
+func TestXConfig(x *testing.T) {
+	p, _ := openProxy()
+	defer p.Close()
+
+	var saved = config.SessionRecvTimeout
+	defer func() {
+		config.SessionRecvTimeout = saved
+	}()
+
+	s := newTestSession()
+	s.proxy = p
+
+	resp := handleTestRequest(s, p.router, "XCONFIG", "SET", "session_recv_timeout", "45s")
+	assert.Must(resp.IsString() && string(resp.Value) == "OK")
+	resp = handleTestRequest(s, p.router, "XCONFIG", "GET", "session_recv_timeout")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "45s")
+	resp = handleTestRequest(s, p.router, "PCONFIG", "GET", "session_recv_timeout")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "45s")
+
+	resp = handleTestRequest(s, p.router, "XCONFIG", "SET", "session_recv_timeout", "-1s")
+	assert.Must(resp.IsError())
+
+	resp = handleTestRequest(s, p.router, "XCONFIG", "SET", "max_slot_num", "16")
+	assert.Must(resp.IsError() && strings.Contains(string(resp.Value), "read-only"))
+
+	resp = handleTestRequest(s, p.router, "XCONFIG", "SET", "no_such_key", "1")
+	assert.Must(resp.IsError() && strings.Contains(string(resp.Value), "unsupported"))
+	resp = handleTestRequest(s, p.router, "XCONFIG", "GET", "no_such_key")
+	assert.Must(resp.IsError() && strings.Contains(string(resp.Value), "unsupported"))
+}
+
+func TestConfigChanges(x *testing.T) {
+	p, addr := openProxy()
+	defer p.Close()
+
+	var saved = config.SessionRecvTimeout
+	defer func() {
+		config.SessionRecvTimeout = saved
+	}()
+	var old = config.SessionRecvTimeout.Duration().String()
+
+	s := newTestSession()
+	s.proxy = p
+	handleTestRequest(s, p.router, "XCONFIG", "SET", "session_recv_timeout", "45s")
+	handleTestRequest(s, p.router, "XCONFIG", "SET", "session_recv_timeout", "-1s")
+	assert.Must(p.ConfigVersion() == 1)
+	assert.Must(p.Stats(0).ConfigVersion == 1)
+
+	var c = NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, p.Model().Token)
+	changes, err := c.ConfigChanges(0)
+	assert.MustNoError(err)
+	assert.Must(len(changes) == 1)
+	var change = changes[0]
+	assert.Must(change.Seq == 1 && change.Who == "default" && change.Proxy == p.Model().Token)
+	assert.Must(change.Key == "session_recv_timeout" && change.Old == old && change.New == "45s")
+
+	assert.MustNoError(c.SetConfig(&models.ConfigChange{Who: "admin", Key: "session_recv_timeout", New: old}))
+	assert.Must(config.SessionRecvTimeout.Duration().String() == old)
+	assert.Must(c.SetConfig(&models.ConfigChange{Key: "no_such_key", New: "1"}) != nil)
+	changes, err = c.ConfigChanges(1)
+	assert.MustNoError(err)
+	assert.Must(len(changes) == 1 && changes[0].Who == "admin" && changes[0].Old == "45s")
+}
+
+func TestProfile(x *testing.T) {
+	s, addr := openProxy()
+	defer s.Close()
+
+	var c = NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, s.Model().Token)
+	b, err := c.Profile("heap", 1)
+	assert.MustNoError(err)
+	assert.Must(len(b) != 0)
+	_, err = c.Profile("unknown", 1)
+	assert.Must(err != nil)
+
+	c.SetXAuth(config.ProductName, config.ProductAuth, "")
+	_, err = c.Profile("heap", 1)
+	assert.Must(err != nil)
+}
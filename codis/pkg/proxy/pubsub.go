@@ -0,0 +1,270 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+var ErrPubSubConnClosed = errors.New("pubsub backend connection closed")
+
+// pubsubState keeps the subscriptions of a session. Every backend group the
+// session subscribes to gets a dedicated connection: a channel is subscribed
+// on the group owning the slot of the channel name, where PUBLISH is routed
+// to as well, and a pattern is subscribed on all groups.
+//
+// Subscriptions are not moved when slots are migrated afterwards, clients
+// are expected to resubscribe after reconnecting.
+type pubsubState struct {
+	mu sync.Mutex
+
+	conns    map[string]*redis.Conn
+	channels map[string]string
+	patterns map[string]bool
+
+	// namespace is stripped from the messages, see applyNamespace.
+	namespace string
+
+	closed bool
+}
+
+func (s *Session) subscriptions() int {
+	if s.pubsub == nil {
+		return 0
+	}
+	s.pubsub.mu.Lock()
+	defer s.pubsub.mu.Unlock()
+	return len(s.pubsub.channels) + len(s.pubsub.patterns)
+}
+
+func (s *Session) closePubSub() {
+	if s.pubsub == nil {
+		return
+	}
+	ps := s.pubsub
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.closed = true
+	for _, c := range ps.conns {
+		c.Close()
+	}
+}
+
+func (s *Session) newPushResp(array []*redis.Resp) *redis.Resp {
+	if s.proto == 3 {
+		return redis.NewPush(array)
+	}
+	return redis.NewArray(array)
+}
+
+func (s *Session) newPubSubReply(kind string, name []byte, count int) *redis.Resp {
+	return s.newPushResp([]*redis.Resp{
+		redis.NewBulkBytes([]byte(kind)),
+		redis.NewBulkBytes(name),
+		redis.NewInt(strconv.AppendInt(nil, int64(count), 10)),
+	})
+}
+
+func (ps *pubsubState) lockedGetConn(s *Session, addr string) (*redis.Conn, error) {
+	if c := ps.conns[addr]; c != nil {
+		return c, nil
+	}
+	c, err := dialBackend(addr, 0, s.config)
+	if err != nil {
+		return nil, err
+	}
+	// Subscribers may stay idle for a long time.
+	c.ReaderTimeout = 0
+	ps.conns[addr] = c
+	go s.loopPubSubReader(ps, c)
+	return c, nil
+}
+
+// loopPubSubReader forwards messages from the backend to the client. The
+// confirmations of (un)subscribe are dropped, since the proxy has already
+// replied on behalf of all groups.
+func (s *Session) loopPubSubReader(ps *pubsubState, c *redis.Conn) {
+	for {
+		resp, err := c.Decode()
+		if err != nil {
+			ps.mu.Lock()
+			closed := ps.closed
+			ps.mu.Unlock()
+			if !closed {
+				log.WarnErrorf(err, "session [%p] pubsub connection to %s lost", s, c.RemoteAddr())
+				s.CloseReaderWithError(ErrPubSubConnClosed)
+			}
+			return
+		}
+		if !resp.IsArray() || len(resp.Array) == 0 {
+			continue
+		}
+		switch strings.ToLower(string(resp.Array[0].Value)) {
+		case "message", "pmessage":
+		default:
+			continue
+		}
+		ps.mu.Lock()
+		var ns = ps.namespace
+		ps.mu.Unlock()
+		if ns != "" && !stripNamespaceMessage(ns, resp.Array) {
+			continue
+		}
+		s.waitOutput(true)
+
+		r := &Request{Batch: &sync.WaitGroup{}}
+		r.Resp = s.newPushResp(resp.Array)
+		r.ReceiveTime = time.Now().UnixNano()
+
+		ps.mu.Lock()
+		if !ps.closed {
+			s.tasks.PushBack(r)
+			s.chargeOutput(r, respSize(r.Resp), true)
+		}
+		ps.mu.Unlock()
+	}
+}
+
+// handleSubscribe and handleUnsubscribe do the work in Coalesce, which runs
+// in loopWriter just before the reply is sent, so that messages received
+// after subscribing are always sent to the client after the confirmation.
+func (s *Session) handleSubscribe(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", strings.ToLower(r.OpStr))
+		return nil
+	}
+	if s.pubsub == nil {
+		s.pubsub = &pubsubState{
+			conns:    make(map[string]*redis.Conn),
+			channels: make(map[string]string),
+			patterns: make(map[string]bool),
+		}
+	}
+	r.Coalesce = func() error {
+		return s.subscribe(r, d)
+	}
+	return nil
+}
+
+func (s *Session) subscribe(r *Request, d *Router) error {
+	var pattern = r.OpStr == "PSUBSCRIBE"
+	var kind = strings.ToLower(r.OpStr)
+
+	ps := s.pubsub
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.namespace = r.Namespace
+
+	var replies []*redis.Resp
+	for _, m := range r.Multi[1:] {
+		var name = string(m.Value)
+		var addrs []string
+		switch {
+		case pattern && !ps.patterns[name]:
+			addrs = d.backendAddrs()
+		case !pattern && ps.channels[name] == "":
+			if addr := d.slotAddr(d.keySlot(m.Value)); addr != "" {
+				addrs = []string{addr}
+			}
+		default:
+			replies = append(replies, s.newPubSubReply(kind, m.Value, len(ps.channels)+len(ps.patterns)))
+			continue
+		}
+		if len(addrs) == 0 {
+			return ErrSlotIsNotReady
+		}
+		for _, addr := range addrs {
+			c, err := ps.lockedGetConn(s, addr)
+			if err != nil {
+				return err
+			}
+			multi := []*redis.Resp{redis.NewBulkBytes([]byte(r.OpStr)), m}
+			if err := c.EncodeMultiBulk(multi, true); err != nil {
+				return err
+			}
+		}
+		if pattern {
+			ps.patterns[name] = true
+		} else {
+			ps.channels[name] = addrs[0]
+		}
+		replies = append(replies, s.newPubSubReply(kind, m.Value, len(ps.channels)+len(ps.patterns)))
+	}
+	r.Resp, r.Replies = replies[0], replies[1:]
+	return nil
+}
+
+func (s *Session) handleUnsubscribe(r *Request) error {
+	if s.pubsub == nil {
+		r.Resp = s.newPubSubReply(strings.ToLower(r.OpStr), nil, 0)
+		return nil
+	}
+	r.Coalesce = func() error {
+		return s.unsubscribe(r)
+	}
+	return nil
+}
+
+func (s *Session) unsubscribe(r *Request) error {
+	var pattern = r.OpStr == "PUNSUBSCRIBE"
+	var kind = strings.ToLower(r.OpStr)
+
+	ps := s.pubsub
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	var names [][]byte
+	for _, m := range r.Multi[1:] {
+		names = append(names, m.Value)
+	}
+	if len(names) == 0 {
+		if pattern {
+			for name := range ps.patterns {
+				names = append(names, []byte(name))
+			}
+		} else {
+			for name := range ps.channels {
+				names = append(names, []byte(name))
+			}
+		}
+	}
+	if len(names) == 0 {
+		r.Resp = s.newPubSubReply(kind, nil, len(ps.channels)+len(ps.patterns))
+		return nil
+	}
+
+	var replies []*redis.Resp
+	for _, name := range names {
+		var addrs []string
+		if pattern {
+			if ps.patterns[string(name)] {
+				for addr := range ps.conns {
+					addrs = append(addrs, addr)
+				}
+				delete(ps.patterns, string(name))
+			}
+		} else {
+			if addr := ps.channels[string(name)]; addr != "" {
+				addrs = append(addrs, addr)
+				delete(ps.channels, string(name))
+			}
+		}
+		for _, addr := range addrs {
+			multi := []*redis.Resp{redis.NewBulkBytes([]byte(r.OpStr)), redis.NewBulkBytes(name)}
+			if err := ps.conns[addr].EncodeMultiBulk(multi, true); err != nil {
+				return err
+			}
+		}
+		replies = append(replies, s.newPubSubReply(kind, name, len(ps.channels)+len(ps.patterns)))
+	}
+	r.Resp, r.Replies = replies[0], replies[1:]
+	return nil
+}
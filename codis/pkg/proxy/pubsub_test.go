@@ -0,0 +1,204 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+// fakePubSubBackend implements just enough of redis pub/sub for the tests,
+// other commands are answered with +OK.
+type fakePubSubBackend struct {
+	*fakeBackend
+
+	mu   sync.Mutex
+	subs map[*redis.Conn]map[string]bool
+}
+
+func newFakePubSubBackend() *fakePubSubBackend {
+	b := &fakePubSubBackend{subs: make(map[*redis.Conn]map[string]bool)}
+	b.fakeBackend = newFakeConnBackend(b.serve)
+	return b
+}
+
+func (b *fakePubSubBackend) serve(c *redis.Conn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, c)
+		b.mu.Unlock()
+	}()
+	for {
+		multi, err := c.DecodeMultiBulk()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		switch op := string(multi[0].Value); op {
+		case "SUBSCRIBE", "PSUBSCRIBE":
+			if b.subs[c] == nil {
+				b.subs[c] = make(map[string]bool)
+			}
+			b.subs[c][op+" "+string(multi[1].Value)] = true
+			c.Encode(newTestPushResp(op, string(multi[1].Value), strconv.Itoa(len(b.subs[c]))), true)
+		case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+			delete(b.subs[c], strings.Replace(op, "UN", "", 1)+" "+string(multi[1].Value))
+			c.Encode(newTestPushResp(op, string(multi[1].Value), strconv.Itoa(len(b.subs[c]))), true)
+		case "PUBLISH":
+			var n int
+			var channel, message = string(multi[1].Value), string(multi[2].Value)
+			for x, subs := range b.subs {
+				if subs["SUBSCRIBE "+channel] {
+					x.Encode(newTestPushResp("message", channel, message), true)
+					n++
+				}
+				for sub := range subs {
+					if pattern := sub[len("PSUBSCRIBE "):]; sub[0] == 'P' {
+						if ok, _ := path.Match(pattern, channel); ok {
+							x.Encode(newTestPushResp("pmessage", pattern, channel, message), true)
+							n++
+						}
+					}
+				}
+			}
+			c.Encode(redis.NewInt([]byte(strconv.Itoa(n))), true)
+		default:
+			c.Encode(redis.NewString([]byte("OK")), true)
+		}
+		b.mu.Unlock()
+	}
+}
+
+func newTestPushResp(args ...string) *redis.Resp {
+	var array []*redis.Resp
+	for _, arg := range args {
+		array = append(array, redis.NewBulkBytes([]byte(arg)))
+	}
+	return redis.NewArray(array)
+}
+
+type testClient struct {
+	*redis.Conn
+}
+
+func newTestClient(addr string) *testClient {
+	c, err := redis.DialTimeout(addr, time.Second*5, 1024, 1024)
+	assert.MustNoError(err)
+	c.ReaderTimeout = time.Second * 5
+	return &testClient{c}
+}
+
+func (c *testClient) Send(args ...string) {
+	var multi = make([]*redis.Resp, len(args))
+	for i := range args {
+		multi[i] = redis.NewBulkBytes([]byte(args[i]))
+	}
+	assert.MustNoError(c.EncodeMultiBulk(multi, true))
+}
+
+func (c *testClient) Receive() *redis.Resp {
+	resp, err := c.Decode()
+	assert.MustNoError(err)
+	return resp
+}
+
+func (c *testClient) Do(args ...string) *redis.Resp {
+	c.Send(args...)
+	return c.Receive()
+}
+
+func isTestPushResp(resp *redis.Resp, args ...string) bool {
+	if len(resp.Array) != len(args) {
+		return false
+	}
+	for i := range args {
+		if string(resp.Array[i].Value) != args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPubSub(t *testing.T) {
+	b := newFakePubSubBackend()
+	defer b.Close()
+
+	p, _ := openProxy()
+	defer p.Close()
+
+	var slots []*models.Slot
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		slots = append(slots, &models.Slot{Id: i, BackendAddr: b.Addr()})
+	}
+	assert.MustNoError(p.FillSlots(slots))
+	assert.MustNoError(p.Start())
+
+	sub := newTestClient(p.Model().ProxyAddr)
+	defer sub.Close()
+	pub := newTestClient(p.Model().ProxyAddr)
+	defer pub.Close()
+
+	sub.Send("SUBSCRIBE", "news", "sports")
+	assert.Must(isTestPushResp(sub.Receive(), "subscribe", "news", "1"))
+	assert.Must(isTestPushResp(sub.Receive(), "subscribe", "sports", "2"))
+	assert.Must(isTestPushResp(sub.Do("PSUBSCRIBE", "n*"), "psubscribe", "n*", "3"))
+
+	assert.Must(sub.Do("GET", "key").IsError())
+	assert.Must(isTestPushResp(sub.Do("PING"), "pong", ""))
+
+	resp := pub.Do("PUBLISH", "news", "hello")
+	assert.Must(resp.IsInt() && string(resp.Value) == "2")
+	assert.Must(isTestPushResp(sub.Receive(), "message", "news", "hello"))
+	assert.Must(isTestPushResp(sub.Receive(), "pmessage", "n*", "news", "hello"))
+
+	sub.Send("UNSUBSCRIBE")
+	for i := 0; i < 2; i++ {
+		resp := sub.Receive()
+		assert.Must(resp.IsArray() && string(resp.Array[0].Value) == "unsubscribe")
+	}
+	assert.Must(isTestPushResp(sub.Do("PUNSUBSCRIBE", "n*"), "punsubscribe", "n*", "0"))
+	assert.Must(sub.Do("GET", "key").IsString())
+
+	resp = pub.Do("PUBLISH", "news", "hello")
+	assert.Must(resp.IsInt() && string(resp.Value) == "0")
+}
+
+func TestPubSubResp3(t *testing.T) {
+	b := newFakePubSubBackend()
+	defer b.Close()
+
+	p, _ := openProxy()
+	defer p.Close()
+
+	var slots []*models.Slot
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		slots = append(slots, &models.Slot{Id: i, BackendAddr: b.Addr()})
+	}
+	assert.MustNoError(p.FillSlots(slots))
+	assert.MustNoError(p.Start())
+
+	sub := newTestClient(p.Model().ProxyAddr)
+	defer sub.Close()
+	pub := newTestClient(p.Model().ProxyAddr)
+	defer pub.Close()
+
+	assert.Must(sub.Do("HELLO", "3").IsMap())
+	resp := sub.Do("SUBSCRIBE", "news")
+	assert.Must(resp.IsPush() && isTestPushResp(resp, "subscribe", "news", "1"))
+
+	// RESP3 clients may keep issuing commands while subscribed.
+	assert.Must(sub.Do("GET", "key").IsString())
+
+	pub.Do("PUBLISH", "news", "hello")
+	resp = sub.Receive()
+	assert.Must(resp.IsPush() && isTestPushResp(resp, "message", "news", "hello"))
+}
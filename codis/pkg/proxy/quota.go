@@ -0,0 +1,210 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// tokenBucket is refilled at the rate per second, holding at most a second
+// of tokens. It's protected by the lock of its quotaState.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time, rate int64) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * float64(rate)
+	} else {
+		b.tokens = float64(rate)
+	}
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+	b.last = now
+}
+
+// quotaState is the usage of the quota of a user on the proxy. The states
+// are kept when the quotas are updated, so that usage of the sessions and
+// requests accepted before is still counted.
+type quotaState struct {
+	name  string
+	limit atomic.Value
+
+	conns    atomic2.Int64
+	memory   atomic2.Int64
+	rejected atomic2.Int64
+
+	mu        sync.Mutex
+	qps       tokenBucket
+	bandwidth tokenBucket
+}
+
+func (q *quotaState) getLimit() *models.Quota {
+	return q.limit.Load().(*models.Quota)
+}
+
+// quotas are the quotas of users set by the dashboard.
+var quotas struct {
+	sync.Mutex
+	users map[string]*quotaState
+}
+
+func getQuotaState(name string) *quotaState {
+	quotas.Lock()
+	defer quotas.Unlock()
+	return lockedGetQuotaState(name)
+}
+
+func lockedGetQuotaState(name string) *quotaState {
+	if q := quotas.users[name]; q != nil {
+		return q
+	}
+	if quotas.users == nil {
+		quotas.users = make(map[string]*quotaState)
+	}
+	q := &quotaState{name: name}
+	q.limit.Store(&models.Quota{})
+	quotas.users[name] = q
+	return q
+}
+
+// setQuotas replaces the limits of all users, users absent are unlimited.
+func setQuotas(m *models.Quotas) {
+	quotas.Lock()
+	defer quotas.Unlock()
+	for name, q := range quotas.users {
+		if m.Users[name] == nil {
+			q.limit.Store(&models.Quota{})
+		}
+	}
+	for name, u := range m.Users {
+		var limit = *u
+		lockedGetQuotaState(name).limit.Store(&limit)
+	}
+}
+
+func multiSize(multi []*redis.Resp) int64 {
+	var n int64
+	for _, m := range multi {
+		n += int64(len(m.Value))
+	}
+	return n
+}
+
+// acquire checks the request against the quota, and charges the request
+// to the usage. It returns the error reply if the quota is exceeded.
+func (q *quotaState) acquire(r *Request) *redis.Resp {
+	var limit = q.getLimit()
+	var size = multiSize(r.Multi)
+	if limit.Memory > 0 && q.memory.Int64()+size > limit.Memory {
+		q.rejected.Incr()
+		return redis.NewErrorf("OOM in-flight memory quota of user '%s' exceeded", q.name)
+	}
+	if limit.QPS > 0 || limit.Bandwidth > 0 {
+		var now = time.Now()
+		q.mu.Lock()
+		var resp *redis.Resp
+		if limit.QPS > 0 {
+			if q.qps.refill(now, limit.QPS); q.qps.tokens < 1 {
+				resp = redis.NewErrorf("LIMIT qps quota of user '%s' exceeded", q.name)
+			}
+		}
+		if limit.Bandwidth > 0 && resp == nil {
+			if q.bandwidth.refill(now, limit.Bandwidth); q.bandwidth.tokens <= 0 {
+				resp = redis.NewErrorf("LIMIT bandwidth quota of user '%s' exceeded", q.name)
+			}
+		}
+		if resp == nil {
+			q.qps.tokens--
+			q.bandwidth.tokens -= float64(size)
+		}
+		q.mu.Unlock()
+		if resp != nil {
+			q.rejected.Incr()
+			return resp
+		}
+	}
+	q.memory.Add(size)
+	r.quota, r.quotaSize = q, size
+	return nil
+}
+
+// releaseQuota returns the memory of the request, and charges the reply to the
+// bandwidth, which could be paid back by the following requests.
+func (r *Request) releaseQuota(resp *redis.Resp) {
+	var q = r.quota
+	if q == nil {
+		return
+	}
+	q.memory.Sub(r.quotaSize)
+	r.quota, r.quotaSize = nil, 0
+
+	if resp == nil || q.getLimit().Bandwidth <= 0 {
+		return
+	}
+	var size = respSize(resp)
+	for _, x := range r.Replies {
+		size += respSize(x)
+	}
+	q.mu.Lock()
+	q.bandwidth.tokens -= float64(size)
+	q.mu.Unlock()
+}
+
+// bindQuota counts the session in the connections of the user, and returns
+// the error reply if there are too many.
+func (s *Session) bindQuota(name string) *redis.Resp {
+	if s.quota != nil && s.quota.name == name {
+		return nil
+	}
+	var q = getQuotaState(name)
+	if n := q.getLimit().Connections; q.conns.Incr() > n && n > 0 {
+		q.conns.Decr()
+		q.rejected.Incr()
+		return redis.NewErrorf("LIMIT max number of connections of user '%s' reached", name)
+	}
+	s.unbindQuota()
+	s.quota = q
+	return nil
+}
+
+func (s *Session) unbindQuota() {
+	if s.quota != nil {
+		s.quota.conns.Decr()
+		s.quota = nil
+	}
+}
+
+type QuotaStats struct {
+	User     string        `json:"user"`
+	Limit    *models.Quota `json:"limit"`
+	Conns    int64         `json:"conns"`
+	Memory   int64         `json:"memory"`
+	Rejected int64         `json:"rejected"`
+}
+
+func GetQuotaStats() []*QuotaStats {
+	quotas.Lock()
+	defer quotas.Unlock()
+	var list []*QuotaStats
+	for name, q := range quotas.users {
+		list = append(list, &QuotaStats{
+			User: name, Limit: q.getLimit(),
+			Conns: q.conns.Int64(), Memory: q.memory.Int64(), Rejected: q.rejected.Int64(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].User < list[j].User
+	})
+	return list
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func isLimit(resp *redis.Resp, prefix string) bool {
+	return resp.IsError() && strings.HasPrefix(string(resp.Value), prefix)
+}
+
+func TestQuotas(t *testing.T) {
+	resetACLUsers()
+	defer resetACLUsers()
+	defer setQuotas(&models.Quotas{})
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return RespOK
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "ACL", "SETUSER", "tenant", "on", "nopass", "allkeys", "+@all").IsString())
+
+	setQuotas(&models.Quotas{Users: map[string]*models.Quota{
+		"tenant": {QPS: 2, Connections: 1, Memory: 64},
+	}})
+
+	a := newTestSession()
+	assert.Must(handleTestRequest(a, d, "AUTH", "tenant", "").IsString())
+	x := newTestSession()
+	assert.Must(isLimit(handleTestRequest(x, d, "AUTH", "tenant", ""), "LIMIT"))
+
+	assert.Must(isLimit(handleTestRequest(a, d, "SET", "k", strings.Repeat("v", 100)), "OOM"))
+	assert.Must(handleTestRequest(a, d, "SET", "k", "v").IsString())
+	assert.Must(handleTestRequest(a, d, "SET", "k", "v").IsString())
+	assert.Must(isLimit(handleTestRequest(a, d, "SET", "k", "v"), "LIMIT"))
+
+	q := getQuotaState("tenant")
+	assert.Must(q.conns.Int64() == 1 && q.rejected.Int64() == 3)
+
+	a.unbindQuota()
+	assert.Must(handleTestRequest(x, d, "AUTH", "tenant", "").IsString())
+
+	setQuotas(&models.Quotas{})
+	for i := 0; i < 10; i++ {
+		assert.Must(handleTestRequest(x, d, "SET", "k", "v").IsString())
+	}
+}
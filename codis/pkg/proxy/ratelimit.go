@@ -0,0 +1,181 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+type cmdLimiter struct {
+	rate int64
+
+	mu     sync.Mutex
+	bucket tokenBucket
+
+	rejected atomic2.Int64
+}
+
+// cmdLimiters holds the map of cmd_rate_limit, which is replaced as a whole
+// and read without locking by every request.
+var cmdLimiters atomic.Value
+
+func init() {
+	cmdLimiters.Store(map[string]*cmdLimiter{})
+}
+
+// parseCmdRateLimit parses the limits as "cmd:qps" separated by commas, e.g.
+// "hgetall:500,keys:10".
+func parseCmdRateLimit(list string) (map[string]int64, error) {
+	var limits = make(map[string]int64)
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		kv := strings.SplitN(s, ":", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("invalid limit '%s', should be cmd:qps", s)
+		}
+		var name = strings.ToUpper(strings.TrimSpace(kv[0]))
+		if name == "" {
+			return nil, errors.Errorf("invalid limit '%s', should be cmd:qps", s)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid qps of '%s'", s)
+		}
+		limits[name] = n
+	}
+	return limits, nil
+}
+
+// SetCmdRateLimit replaces the limits of commands, the limiters of commands
+// whose rate is kept are not reset.
+func SetCmdRateLimit(list string) error {
+	limits, err := parseCmdRateLimit(list)
+	if err != nil {
+		return err
+	}
+	var old = cmdLimiters.Load().(map[string]*cmdLimiter)
+	var m = make(map[string]*cmdLimiter, len(limits))
+	for name, rate := range limits {
+		if l := old[name]; l != nil && l.rate == rate {
+			m[name] = l
+		} else {
+			m[name] = &cmdLimiter{rate: rate}
+		}
+	}
+	cmdLimiters.Store(m)
+	return nil
+}
+
+// checkCmdRateLimit takes a token of the limiter of the command, and returns
+// the error reply if there is none left.
+func checkCmdRateLimit(opstr string) *redis.Resp {
+	var l = cmdLimiters.Load().(map[string]*cmdLimiter)[opstr]
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	l.bucket.refill(time.Now(), l.rate)
+	var ok = l.bucket.tokens >= 1
+	if ok {
+		l.bucket.tokens--
+	}
+	l.mu.Unlock()
+	if !ok {
+		l.rejected.Incr()
+		return redis.NewErrorf("LIMIT rate limit of command '%s' exceeded", strings.ToLower(opstr))
+	}
+	return nil
+}
+
+// qpsLimit is the share of the QPS limit of the product, which is set by the
+// dashboard as of the QPS of all proxies. The dashboard pushes the share every
+// 10 seconds at least, the share expires if it's not pushed for qpsLimitTTL,
+// e.g. the dashboard is gone, and then requests are no longer limited.
+var qpsLimit struct {
+	rate   atomic2.Int64
+	expire atomic2.Int64
+
+	mu     sync.Mutex
+	bucket tokenBucket
+
+	rejected atomic2.Int64
+}
+
+const qpsLimitTTL = time.Second * 30
+
+func setQPSLimit(n int64) {
+	qpsLimit.expire.Set(time.Now().Add(qpsLimitTTL).UnixNano())
+	qpsLimit.rate.Set(n)
+}
+
+// checkQPSLimit takes a token of the share of the QPS limit of the product,
+// and returns the error reply if there is none left.
+func checkQPSLimit() *redis.Resp {
+	var rate = qpsLimit.rate.Int64()
+	if rate <= 0 {
+		return nil
+	}
+	var now = time.Now()
+	if now.UnixNano() >= qpsLimit.expire.Int64() {
+		if qpsLimit.rate.CompareAndSwap(rate, 0) {
+			log.Warnf("qps limit = %d expired, not refreshed by dashboard for %s", rate, qpsLimitTTL)
+		}
+		return nil
+	}
+	qpsLimit.mu.Lock()
+	qpsLimit.bucket.refill(now, rate)
+	var ok = qpsLimit.bucket.tokens >= 1
+	if ok {
+		qpsLimit.bucket.tokens--
+	}
+	qpsLimit.mu.Unlock()
+	if !ok {
+		qpsLimit.rejected.Incr()
+		return redis.NewErrorf("LIMIT qps limit of product exceeded")
+	}
+	return nil
+}
+
+type QPSLimitStats struct {
+	Limit    int64 `json:"limit"`
+	Rejected int64 `json:"rejected"`
+}
+
+func GetQPSLimitStats() *QPSLimitStats {
+	return &QPSLimitStats{
+		Limit: qpsLimit.rate.Int64(), Rejected: qpsLimit.rejected.Int64(),
+	}
+}
+
+type CmdRateLimitStats struct {
+	OpStr    string `json:"opstr"`
+	Rate     int64  `json:"rate"`
+	Rejected int64  `json:"rejected"`
+}
+
+func GetCmdRateLimitStats() []*CmdRateLimitStats {
+	var m = cmdLimiters.Load().(map[string]*cmdLimiter)
+	var list []*CmdRateLimitStats
+	for name, l := range m {
+		list = append(list, &CmdRateLimitStats{
+			OpStr: name, Rate: l.rate, Rejected: l.rejected.Int64(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].OpStr < list[j].OpStr
+	})
+	return list
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestCmdRateLimit(t *testing.T) {
+	defer SetCmdRateLimit("")
+
+	_, err := parseCmdRateLimit("hgetall:500, keys:10")
+	assert.MustNoError(err)
+	for _, s := range []string{"hgetall", "hgetall:0", ":10", "keys:x"} {
+		_, err := parseCmdRateLimit(s)
+		assert.Must(err != nil)
+	}
+
+	assert.MustNoError(SetCmdRateLimit("hgetall:2"))
+	assert.Must(checkCmdRateLimit("GET") == nil)
+	assert.Must(checkCmdRateLimit("HGETALL") == nil)
+	assert.Must(checkCmdRateLimit("HGETALL") == nil)
+	assert.Must(checkCmdRateLimit("HGETALL").IsError())
+
+	assert.MustNoError(SetCmdRateLimit("hgetall:2,keys:1"))
+	assert.Must(checkCmdRateLimit("HGETALL").IsError())
+	assert.Must(checkCmdRateLimit("KEYS") == nil)
+
+	stats := GetCmdRateLimitStats()
+	assert.Must(len(stats) == 2 && stats[0].OpStr == "HGETALL" && stats[0].Rejected == 2)
+
+	assert.MustNoError(SetCmdRateLimit(""))
+	assert.Must(checkCmdRateLimit("HGETALL") == nil)
+}
+
+func TestQPSLimit(t *testing.T) {
+	defer setQPSLimit(0)
+
+	assert.Must(checkQPSLimit() == nil)
+	setQPSLimit(2)
+	assert.Must(checkQPSLimit() == nil)
+	assert.Must(checkQPSLimit() == nil)
+	assert.Must(checkQPSLimit().IsError())
+	assert.Must(GetQPSLimitStats().Rejected == 1)
+	setQPSLimit(0)
+	assert.Must(checkQPSLimit() == nil)
+
+	// The share expires if it's not refreshed.
+	setQPSLimit(1)
+	qpsLimit.expire.Set(time.Now().UnixNano())
+	assert.Must(checkQPSLimit() == nil && checkQPSLimit() == nil)
+	assert.Must(GetQPSLimitStats().Limit == 0)
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+var redactedValue = []byte("(redacted)")
+
+// redact holds the glob patterns of the keys of string commands and of the
+// fields of hash commands, whose values are masked in the slowlog and logs.
+var redact struct {
+	sync.RWMutex
+	keys   []string
+	fields []string
+}
+
+func parsePatterns(list string) []string {
+	var patterns []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			patterns = append(patterns, s)
+		}
+	}
+	return patterns
+}
+
+func SetRedactRules(keys, fields string) {
+	redact.Lock()
+	defer redact.Unlock()
+	redact.keys, redact.fields = parsePatterns(keys), parsePatterns(fields)
+}
+
+func matchAny(patterns []string, s []byte) bool {
+	for _, p := range patterns {
+		if globMatch(p, string(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactArgs returns the arguments with the sensitive values masked, or the
+// arguments themselves if there's nothing to mask. Passwords of AUTH, HELLO
+// and ACL SETUSER are always masked.
+func redactArgs(opstr string, multi []*redis.Resp) []*redis.Resp {
+	return redactMulti(opstr, multi, true)
+}
+
+// redactPasswords is redactArgs without the patterns of keys and fields.
+func redactPasswords(opstr string, multi []*redis.Resp) []*redis.Resp {
+	return redactMulti(opstr, multi, false)
+}
+
+func redactMulti(opstr string, multi []*redis.Resp, values bool) []*redis.Resp {
+	var masked []*redis.Resp
+	mask := func(i int) {
+		if i >= len(multi) {
+			return
+		}
+		if masked == nil {
+			masked = append([]*redis.Resp{}, multi...)
+		}
+		masked[i] = redis.NewBulkBytes(redactedValue)
+	}
+
+	switch opstr {
+	case "AUTH":
+		for i := 1; i < len(multi); i++ {
+			mask(i)
+		}
+	case "HELLO":
+		for i := 1; i < len(multi); i++ {
+			if strings.EqualFold(string(multi[i].Value), "AUTH") {
+				mask(i + 2)
+			}
+		}
+	case "ACL":
+		if len(multi) > 1 && strings.EqualFold(string(multi[1].Value), "SETUSER") {
+			for i := 3; i < len(multi); i++ {
+				if v := multi[i].Value; len(v) != 0 && (v[0] == '>' || v[0] == '<') {
+					mask(i)
+				}
+			}
+		}
+	}
+
+	if !values {
+		if masked != nil {
+			return masked
+		}
+		return multi
+	}
+
+	redact.RLock()
+	defer redact.RUnlock()
+
+	switch opstr {
+	case "SET", "SETNX", "GETSET", "APPEND", "SETEX", "PSETEX", "SETRANGE":
+		if len(redact.keys) == 0 || len(multi) < 3 || !matchAny(redact.keys, multi[1].Value) {
+			break
+		}
+		switch opstr {
+		case "SETEX", "PSETEX", "SETRANGE":
+			mask(3)
+		default:
+			mask(2)
+		}
+	case "MSET", "MSETNX":
+		for i := 1; i+1 < len(multi) && len(redact.keys) != 0; i += 2 {
+			if matchAny(redact.keys, multi[i].Value) {
+				mask(i + 1)
+			}
+		}
+	case "HSET", "HMSET", "HSETNX":
+		for i := 2; i+1 < len(multi) && len(redact.fields) != 0; i += 2 {
+			if matchAny(redact.fields, multi[i].Value) {
+				mask(i + 1)
+			}
+		}
+	}
+
+	if masked != nil {
+		return masked
+	}
+	return multi
+}
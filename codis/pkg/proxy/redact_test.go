@@ -0,0 +1,49 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestRedactArgs(t *testing.T) {
+	defer SetRedactRules("", "")
+
+	redacted := func(args ...string) string {
+		var multi []*redis.Resp
+		for _, arg := range args {
+			multi = append(multi, redis.NewBulkBytes([]byte(arg)))
+		}
+		opstr, _, err := getOpInfo(multi)
+		assert.MustNoError(err)
+		var cmd = make([]byte, 1024)
+		return string(cmd[:getWholeCmd(redactArgs(opstr, multi), cmd)])
+	}
+
+	assert.Must(redacted("AUTH", "secret") == "AUTH (redacted)")
+	assert.Must(redacted("auth", "alice", "secret") == "auth (redacted) (redacted)")
+	assert.Must(redacted("HELLO", "3", "AUTH", "alice", "secret") == "HELLO 3 AUTH alice (redacted)")
+	assert.Must(redacted("ACL", "SETUSER", "alice", "on", ">secret", "+@all") == "ACL SETUSER alice on (redacted) +@all")
+	assert.Must(redacted("SET", "user:token", "value") == "SET user:token value")
+
+	SetRedactRules("*:token, secret:*", "password")
+	assert.Must(redacted("SET", "user:token", "value") == "SET user:token (redacted)")
+	assert.Must(redacted("SETEX", "secret:1", "10", "value") == "SETEX secret:1 10 (redacted)")
+	assert.Must(redacted("SET", "user:name", "value") == "SET user:name value")
+	assert.Must(redacted("MSET", "a", "1", "user:token", "2") == "MSET a 1 user:token (redacted)")
+	assert.Must(redacted("HSET", "user", "name", "alice", "password", "secret") == "HSET user name alice password (redacted)")
+
+	var multi = []*redis.Resp{
+		redis.NewBulkBytes([]byte("SET")),
+		redis.NewBulkBytes([]byte("user:token")),
+		redis.NewBulkBytes([]byte("value")),
+	}
+	var args = slowlogArgs(redactArgs("SET", multi))
+	assert.Must(strings.Join(args, " ") == "SET user:token (redacted)")
+	assert.Must(string(multi[2].Value) == "value")
+}
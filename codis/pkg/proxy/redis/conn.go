@@ -4,6 +4,7 @@
 package redis
 
 import (
+	"crypto/tls"
 	"net"
 	"time"
 
@@ -32,6 +33,29 @@ func DialTimeout(addr string, timeout time.Duration, rbuf, wbuf int) (*Conn, err
 	return NewConn(c, rbuf, wbuf), nil
 }
 
+// DialTLSTimeout dials addr with TLS, and the host of addr is sent as SNI if
+// config.ServerName is empty.
+func DialTLSTimeout(addr string, timeout time.Duration, rbuf, wbuf int, config *tls.Config) (*Conn, error) {
+	c, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config = config.Clone()
+			config.ServerName = host
+		}
+	}
+	t := tls.Client(c, config)
+	t.SetDeadline(time.Now().Add(timeout))
+	if err := t.Handshake(); err != nil {
+		c.Close()
+		return nil, errors.Trace(err)
+	}
+	t.SetDeadline(time.Time{})
+	return NewConn(t, rbuf, wbuf), nil
+}
+
 func NewConn(sock net.Conn, rbuf, wbuf int) *Conn {
 	conn := &Conn{Sock: sock}
 	conn.Decoder = newConnDecoder(conn, rbuf)
@@ -59,7 +83,11 @@ func (c *Conn) CloseReader() error {
 }
 
 func (c *Conn) SetKeepAlivePeriod(d time.Duration) error {
-	if t, ok := c.Sock.(*net.TCPConn); ok {
+	var sock = c.Sock
+	if t, ok := sock.(*tls.Conn); ok {
+		sock = t.NetConn()
+	}
+	if t, ok := sock.(*net.TCPConn); ok {
 		if err := t.SetKeepAlive(d != 0); err != nil {
 			return errors.Trace(err)
 		}
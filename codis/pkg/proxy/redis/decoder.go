@@ -21,6 +21,11 @@ var (
 	ErrBadBulkBytesLen        = errors.New("bad bulk bytes len")
 	ErrBadBulkBytesLenTooLong = errors.New("bad bulk bytes len, too long")
 
+	ErrBadMapLen  = errors.New("bad map len")
+	ErrBadNull    = errors.New("bad null, should be empty")
+	ErrBadBoolean = errors.New("bad boolean, should be t or f")
+	ErrBadBlobLen = errors.New("bad blob len")
+
 	ErrBadMultiBulkLen     = errors.New("bad multi-bulk len")
 	ErrBadMultiBulkContent = errors.New("bad multi-bulk content, should be bulkbytes")
 )
@@ -131,10 +136,62 @@ func (d *Decoder) decodeResp() (*Resp, error) {
 		r.Value, err = d.decodeBulkBytes()
 	case TypeArray:
 		r.Array, err = d.decodeArray()
+	case TypeNull:
+		var b []byte
+		if b, err = d.decodeTextBytes(); err == nil && len(b) != 0 {
+			err = errors.Trace(ErrBadNull)
+		}
+	case TypeBoolean:
+		if r.Value, err = d.decodeTextBytes(); err == nil {
+			if len(r.Value) != 1 || (r.Value[0] != 't' && r.Value[0] != 'f') {
+				err = errors.Trace(ErrBadBoolean)
+			}
+		}
+	case TypeDouble, TypeBigNumber:
+		r.Value, err = d.decodeTextBytes()
+	case TypeBlobError, TypeVerbatim:
+		if r.Value, err = d.decodeBulkBytes(); err == nil && r.Value == nil {
+			err = errors.Trace(ErrBadBlobLen)
+		}
+	case TypeSet, TypePush:
+		if r.Array, err = d.decodeArray(); err == nil && r.Array == nil {
+			err = errors.Trace(ErrBadArrayLen)
+		}
+	case TypeMap:
+		r.Array, err = d.decodeMap()
+	case TypeAttribute:
+		// Attributes are auxiliary data attached to the following reply,
+		// the proxy doesn't make use of them, so they're dropped here.
+		if _, err = d.decodeMap(); err != nil {
+			return nil, err
+		}
+		return d.decodeResp()
 	}
 	return r, err
 }
 
+func (d *Decoder) decodeMap() ([]*Resp, error) {
+	n, err := d.decodeInt()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case n < 0:
+		return nil, errors.Trace(ErrBadMapLen)
+	case n*2 > MaxArrayLen:
+		return nil, errors.Trace(ErrBadArrayLenTooLong)
+	}
+	array := make([]*Resp, n*2)
+	for i := range array {
+		r, err := d.decodeResp()
+		if err != nil {
+			return nil, err
+		}
+		array[i] = r
+	}
+	return array, nil
+}
+
 func (d *Decoder) decodeTextBytes() ([]byte, error) {
 	b, err := d.br.ReadBytes('\n')
 	if err != nil {
@@ -108,6 +108,46 @@ func TestDecoder(t *testing.T) {
 	}
 }
 
+func TestDecodeResp3(t *testing.T) {
+	test := []string{
+		"_\r\n",
+		"#t\r\n",
+		",1.23\r\n",
+		",inf\r\n",
+		"(3492890328409238509324850943850943825024385\r\n",
+		"!21\r\nSYNTAX invalid syntax\r\n",
+		"=15\r\ntxt:Some string\r\n",
+		"%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n",
+		"~2\r\n+orange\r\n+apple\r\n",
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n",
+		"*2\r\n%1\r\n+key\r\n_\r\n~0\r\n",
+	}
+	for _, s := range test {
+		resp, err := DecodeFromBytes([]byte(s))
+		assert.MustNoError(err)
+		b, err := EncodeToBytes(resp)
+		assert.MustNoError(err)
+		assert.Must(string(b) == s)
+	}
+
+	resp, err := DecodeFromBytes([]byte("%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n"))
+	assert.MustNoError(err)
+	assert.Must(resp.IsMap() && len(resp.Array) == 4)
+
+	resp, err = DecodeFromBytes([]byte("!3\r\nERR\r\n"))
+	assert.MustNoError(err)
+	assert.Must(resp.IsError() && string(resp.Value) == "ERR")
+
+	resp, err = DecodeFromBytes([]byte("|1\r\n+ttl\r\n:3600\r\n+OK\r\n"))
+	assert.MustNoError(err)
+	assert.Must(resp.IsString() && string(resp.Value) == "OK")
+
+	for _, s := range []string{"_x\r\n", "#x\r\n", "%-1\r\n", "!-1\r\n", "~-1\r\n"} {
+		_, err := DecodeFromBytes([]byte(s))
+		assert.Must(err != nil)
+	}
+}
+
 type loopReader struct {
 	buf []byte
 	pos int
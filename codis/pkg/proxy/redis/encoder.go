@@ -122,6 +122,22 @@ func (e *Encoder) encodeResp(r *Resp) error {
 		return e.encodeBulkBytes(r.Value)
 	case TypeArray:
 		return e.encodeArray(r.Array)
+	case TypeNull:
+		return e.encodeTextBytes(nil)
+	case TypeBoolean, TypeDouble, TypeBigNumber:
+		return e.encodeTextBytes(r.Value)
+	case TypeBlobError, TypeVerbatim:
+		if r.Value == nil {
+			return errors.Errorf("bad resp %s, value is required", r.Type)
+		}
+		return e.encodeBulkBytes(r.Value)
+	case TypeSet, TypePush:
+		if r.Array == nil {
+			return errors.Errorf("bad resp %s, array is required", r.Type)
+		}
+		return e.encodeArray(r.Array)
+	case TypeMap:
+		return e.encodeMap(r.Array)
 	}
 }
 
@@ -167,6 +183,21 @@ func (e *Encoder) encodeBulkBytes(b []byte) error {
 	}
 }
 
+func (e *Encoder) encodeMap(array []*Resp) error {
+	if len(array)%2 != 0 {
+		return errors.Errorf("bad resp %s, odd number of elements", TypeMap)
+	}
+	if err := e.encodeInt(int64(len(array) / 2)); err != nil {
+		return err
+	}
+	for _, r := range array {
+		if err := e.encodeResp(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *Encoder) encodeArray(array []*Resp) error {
 	if array == nil {
 		return e.encodeInt(-1)
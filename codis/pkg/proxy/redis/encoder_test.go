@@ -77,6 +77,27 @@ func TestEncodeArray(t *testing.T) {
 	testEncodeAndCheck(t, resp, []byte("*3\r\n:0\r\n$-1\r\n$4\r\ntest\r\n"))
 }
 
+func TestEncodeResp3(t *testing.T) {
+	testEncodeAndCheck(t, NewNull(), []byte("_\r\n"))
+	testEncodeAndCheck(t, NewBoolean(true), []byte("#t\r\n"))
+	testEncodeAndCheck(t, NewBoolean(false), []byte("#f\r\n"))
+	testEncodeAndCheck(t, NewDouble(1.5), []byte(",1.5\r\n"))
+	testEncodeAndCheck(t, NewDouble(math.Inf(-1)), []byte(",-inf\r\n"))
+	testEncodeAndCheck(t, NewBigNumber([]byte("3492890328409238509324850943850943825024385")),
+		[]byte("(3492890328409238509324850943850943825024385\r\n"))
+	testEncodeAndCheck(t, NewVerbatim("txt", []byte("Some string")), []byte("=15\r\ntxt:Some string\r\n"))
+	testEncodeAndCheck(t, NewMap([]*Resp{
+		NewBulkBytes([]byte("first")), NewInt([]byte("1")),
+	}), []byte("%1\r\n$5\r\nfirst\r\n:1\r\n"))
+	testEncodeAndCheck(t, NewSet([]*Resp{}), []byte("~0\r\n"))
+	testEncodeAndCheck(t, NewPush([]*Resp{
+		NewBulkBytes([]byte("message")),
+	}), []byte(">1\r\n$7\r\nmessage\r\n"))
+
+	_, err := EncodeToBytes(NewMap([]*Resp{NewNull()}))
+	assert.Must(err != nil)
+}
+
 func testEncodeAndCheck(t *testing.T, resp *Resp, expect []byte) {
 	b, err := EncodeToBytes(resp)
 	assert.MustNoError(err)
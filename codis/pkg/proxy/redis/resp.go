@@ -3,7 +3,11 @@
 
 package redis
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
 
 type RespType byte
 
@@ -13,6 +17,18 @@ const (
 	TypeInt       RespType = ':'
 	TypeBulkBytes RespType = '$'
 	TypeArray     RespType = '*'
+
+	// RESP3 types, see https://github.com/redis/redis-specifications/blob/master/protocol/RESP3.md
+	TypeNull      RespType = '_'
+	TypeBoolean   RespType = '#'
+	TypeDouble    RespType = ','
+	TypeBigNumber RespType = '('
+	TypeBlobError RespType = '!'
+	TypeVerbatim  RespType = '='
+	TypeMap       RespType = '%'
+	TypeSet       RespType = '~'
+	TypePush      RespType = '>'
+	TypeAttribute RespType = '|'
 )
 
 func (t RespType) String() string {
@@ -27,11 +43,34 @@ func (t RespType) String() string {
 		return "<bulkbytes>"
 	case TypeArray:
 		return "<array>"
+	case TypeNull:
+		return "<null>"
+	case TypeBoolean:
+		return "<boolean>"
+	case TypeDouble:
+		return "<double>"
+	case TypeBigNumber:
+		return "<bignumber>"
+	case TypeBlobError:
+		return "<bloberror>"
+	case TypeVerbatim:
+		return "<verbatim>"
+	case TypeMap:
+		return "<map>"
+	case TypeSet:
+		return "<set>"
+	case TypePush:
+		return "<push>"
+	case TypeAttribute:
+		return "<attribute>"
 	default:
 		return fmt.Sprintf("<unknown-0x%02x>", byte(t))
 	}
 }
 
+// Resp is a decoded reply. Aggregate types keep their elements in Array,
+// and a map keeps its keys and values interleaved, so Array of a map with
+// n entries has 2n elements.
 type Resp struct {
 	Type RespType
 
@@ -44,7 +83,7 @@ func (r *Resp) IsString() bool {
 }
 
 func (r *Resp) IsError() bool {
-	return r.Type == TypeError
+	return r.Type == TypeError || r.Type == TypeBlobError
 }
 
 func (r *Resp) IsInt() bool {
@@ -59,6 +98,18 @@ func (r *Resp) IsArray() bool {
 	return r.Type == TypeArray
 }
 
+func (r *Resp) IsNull() bool {
+	return r.Type == TypeNull
+}
+
+func (r *Resp) IsMap() bool {
+	return r.Type == TypeMap
+}
+
+func (r *Resp) IsPush() bool {
+	return r.Type == TypePush
+}
+
 func NewString(value []byte) *Resp {
 	r := &Resp{}
 	r.Type = TypeString
@@ -97,3 +148,71 @@ func NewArray(array []*Resp) *Resp {
 	r.Array = array
 	return r
 }
+
+func NewNull() *Resp {
+	r := &Resp{}
+	r.Type = TypeNull
+	return r
+}
+
+func NewBoolean(value bool) *Resp {
+	r := &Resp{}
+	r.Type = TypeBoolean
+	if value {
+		r.Value = []byte("t")
+	} else {
+		r.Value = []byte("f")
+	}
+	return r
+}
+
+func NewDouble(value float64) *Resp {
+	r := &Resp{}
+	r.Type = TypeDouble
+	switch {
+	case math.IsInf(value, 1):
+		r.Value = []byte("inf")
+	case math.IsInf(value, -1):
+		r.Value = []byte("-inf")
+	case math.IsNaN(value):
+		r.Value = []byte("nan")
+	default:
+		r.Value = strconv.AppendFloat(nil, value, 'g', -1, 64)
+	}
+	return r
+}
+
+func NewBigNumber(value []byte) *Resp {
+	r := &Resp{}
+	r.Type = TypeBigNumber
+	r.Value = value
+	return r
+}
+
+func NewVerbatim(format string, value []byte) *Resp {
+	r := &Resp{}
+	r.Type = TypeVerbatim
+	r.Value = append([]byte(format+":"), value...)
+	return r
+}
+
+func NewMap(array []*Resp) *Resp {
+	r := &Resp{}
+	r.Type = TypeMap
+	r.Array = array
+	return r
+}
+
+func NewSet(array []*Resp) *Resp {
+	r := &Resp{}
+	r.Type = TypeSet
+	r.Array = array
+	return r
+}
+
+func NewPush(array []*Resp) *Resp {
+	r := &Resp{}
+	r.Type = TypePush
+	r.Array = array
+	return r
+}
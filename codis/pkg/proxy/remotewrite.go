@@ -0,0 +1,135 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/math2"
+)
+
+type promLabel struct {
+	name, value string
+}
+
+type promSeries struct {
+	labels []promLabel
+	value  float64
+}
+
+// promRemoteWriter collects the samples of the metric families as series of
+// the remote write protocol, labelled by job and instance as if scraped.
+type promRemoteWriter struct {
+	extra  []promLabel
+	series []*promSeries
+}
+
+func (w *promRemoteWriter) header(name, typ, help string) {
+}
+
+func (w *promRemoteWriter) sample(name string, value float64, labels ...string) {
+	var x = &promSeries{value: value}
+	x.labels = append(x.labels, promLabel{"__name__", name})
+	for i := 0; i+1 < len(labels); i += 2 {
+		x.labels = append(x.labels, promLabel{labels[i], labels[i+1]})
+	}
+	x.labels = append(x.labels, w.extra...)
+	sort.Slice(x.labels, func(i, j int) bool {
+		return x.labels[i].name < x.labels[j].name
+	})
+	w.series = append(w.series, x)
+}
+
+// encode returns the WriteRequest of the samples encoded in protobuf, all of
+// the samples are of the timestamp in ms.
+func (w *promRemoteWriter) encode(timestamp int64) []byte {
+	var b, ts, m []byte
+	for _, x := range w.series {
+		ts = ts[:0]
+		for _, l := range x.labels {
+			m = m[:0]
+			m = protoAppendBytes(m, 1, []byte(l.name))
+			m = protoAppendBytes(m, 2, []byte(l.value))
+			ts = protoAppendBytes(ts, 1, m)
+		}
+		m = m[:0]
+		m = protoAppendFixed64(m, 1, math.Float64bits(x.value))
+		m = protoAppendVarint(m, 2, uint64(timestamp))
+		ts = protoAppendBytes(ts, 2, m)
+		b = protoAppendBytes(b, 1, ts)
+	}
+	return b
+}
+
+func protoAppendVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|0))
+	return binary.AppendUvarint(b, v)
+}
+
+func protoAppendFixed64(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|1))
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func protoAppendBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// startMetricsRemoteWrite pushes the same metric families as /metrics to the
+// endpoint of Prometheus remote write, for the proxies that can't be scraped.
+// Like the scrapes, the pushes read snapshots of the stats of commands, and
+// never refresh or reset them.
+func (p *Proxy) startMetricsRemoteWrite() {
+	server := p.config.MetricsReportRemoteWriteServer
+	period := p.config.MetricsReportRemoteWritePeriod.Duration()
+	if server == "" {
+		return
+	}
+	period = math2.MaxDuration(time.Second, period)
+
+	model := p.Model()
+	extra := []promLabel{
+		{"job", "codis-proxy"},
+		{"instance", model.AdminAddr},
+	}
+	client := &http.Client{Timeout: time.Second * 10}
+
+	p.startMetricsReporter(period, func() error {
+		w := &promRemoteWriter{extra: extra}
+		p.collectMetrics(w)
+		body := snappy.Encode(nil, w.encode(time.Now().UnixNano()/int64(time.Millisecond)))
+
+		req, err := http.NewRequest("POST", server, bytes.NewReader(body))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+		rsp, err := client.Do(req)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode/100 != 2 {
+			msg, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 512))
+			return errors.Errorf("[%d] %s - %s", rsp.StatusCode, http.StatusText(rsp.StatusCode), msg)
+		}
+		io.Copy(ioutil.Discard, rsp.Body)
+		return nil
+	}, nil)
+}
@@ -0,0 +1,185 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+// keyLocks serializes the cross-slot moves of the same keys in the proxy.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the keys in order, and returns the func to unlock them.
+func (l *keyLocks) lock(keys ...string) func() {
+	sort.Strings(keys)
+	var locked []string
+	for i, key := range keys {
+		if i != 0 && key == keys[i-1] {
+			continue
+		}
+		l.mu.Lock()
+		if l.locks == nil {
+			l.locks = make(map[string]*keyLock)
+		}
+		k := l.locks[key]
+		if k == nil {
+			k = &keyLock{}
+			l.locks[key] = k
+		}
+		k.refs++
+		l.mu.Unlock()
+
+		k.Lock()
+		locked = append(locked, key)
+	}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, key := range locked {
+			k := l.locks[key]
+			k.Unlock()
+			if k.refs--; k.refs == 0 {
+				delete(l.locks, key)
+			}
+		}
+	}
+}
+
+// handleRequestRename forwards RENAME/RENAMENX if both keys belong to the same
+// slot. Otherwise, if rename_cross_slot_enabled, the key is moved with DUMP,
+// RESTORE and DEL, while holding the locks of both keys. Pika has no
+// DUMP/RESTORE, so it's for backends supporting them only.
+func (s *Session) handleRequestRename(r *Request, d *Router) error {
+	switch {
+	case len(r.Multi) != 3:
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", strings.ToLower(r.OpStr))
+		return nil
+	case d.isSameSlot(r.Multi[1:]):
+		return d.dispatch(r)
+	case !s.config.RenameCrossSlotEnabled:
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+		return nil
+	}
+	var src, dst = r.Multi[1], r.Multi[2]
+	var nx = r.OpStr == "RENAMENX"
+	r.Coalesce = func() error {
+		defer d.locks.lock(string(src.Value), string(dst.Value))()
+
+		var srcSlot, dstSlot = d.keySlot(src.Value), d.keySlot(dst.Value)
+
+		call := func(id int, args ...*redis.Resp) (*redis.Resp, error) {
+			resp, err := dispatchSlotWait(r, d, id, args)
+			if err == nil && resp.IsError() {
+				r.Resp = resp
+			}
+			return resp, err
+		}
+		bulk := func(s string) *redis.Resp {
+			return redis.NewBulkBytes([]byte(s))
+		}
+
+		payload, err := call(srcSlot, bulk("DUMP"), src)
+		switch {
+		case err != nil || r.Resp != nil:
+			return err
+		case payload.Value == nil:
+			r.Resp = redis.NewErrorf("ERR no such key")
+			return nil
+		}
+		pttl, err := call(srcSlot, bulk("PTTL"), src)
+		if err != nil || r.Resp != nil {
+			return err
+		}
+		var ttl = pttl.Value
+		if n, err := redis.Btoi64(ttl); err != nil || n < 0 {
+			ttl = []byte("0")
+		}
+
+		var restore = []*redis.Resp{bulk("RESTORE"), dst, redis.NewBulkBytes(ttl), payload}
+		if !nx {
+			restore = append(restore, bulk("REPLACE"))
+		}
+		resp, err := dispatchSlotWait(r, d, dstSlot, restore)
+		switch {
+		case err != nil:
+			return err
+		case resp.IsError():
+			if nx && strings.HasPrefix(string(resp.Value), "BUSYKEY") {
+				r.Resp = redis.NewInt([]byte("0"))
+			} else {
+				r.Resp = resp
+			}
+			return nil
+		}
+		if _, err := call(srcSlot, bulk("DEL"), src); err != nil || r.Resp != nil {
+			return err
+		}
+		if nx {
+			r.Resp = redis.NewInt([]byte("1"))
+		} else {
+			r.Resp = redis.NewString([]byte("OK"))
+		}
+		return nil
+	}
+	return nil
+}
+
+// handleRequestSMove forwards SMOVE if both keys belong to the same slot.
+// Otherwise, if smove_cross_slot_enabled, the member is moved with SREM and
+// SADD, and added back to the source if SADD fails.
+func (s *Session) handleRequestSMove(r *Request, d *Router) error {
+	if len(r.Multi) != 4 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'smove' command")
+		return nil
+	}
+	var src, dst, member = r.Multi[1], r.Multi[2], r.Multi[3]
+	switch {
+	case d.isSameSlot(r.Multi[1:3]):
+		return d.dispatch(r)
+	case !s.config.SMoveCrossSlotEnabled:
+		r.Resp = redis.NewErrorf("ERR keys in 'SMOVE' command must be in the same slot")
+		return nil
+	}
+	r.Coalesce = func() error {
+		defer d.locks.lock(string(src.Value), string(dst.Value))()
+
+		var sadd, srem = redis.NewBulkBytes([]byte("SADD")), redis.NewBulkBytes([]byte("SREM"))
+
+		resp, err := dispatchWait(r, d, []*redis.Resp{srem, src, member})
+		switch {
+		case err != nil:
+			return err
+		case resp.IsError() || string(resp.Value) == "0":
+			r.Resp = resp
+			return nil
+		}
+		resp, err = dispatchWait(r, d, []*redis.Resp{sadd, dst, member})
+		if err == nil && !resp.IsError() {
+			r.Resp = redis.NewInt([]byte("1"))
+			return nil
+		}
+		if _, err := dispatchWait(r, d, []*redis.Resp{sadd, src, member}); err != nil {
+			log.WarnErrorf(err, "session [%p] rollback of smove from %s failed", s, src.Value)
+		}
+		if err != nil {
+			return err
+		}
+		r.Resp = resp
+		return nil
+	}
+	return nil
+}
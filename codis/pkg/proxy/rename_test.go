@@ -0,0 +1,136 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestRenameCrossSlot(t *testing.T) {
+	var mu sync.Mutex
+	var data = map[string]string{"src": "payload"}
+	var ttls = map[string]string{}
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		mu.Lock()
+		defer mu.Unlock()
+		var key = string(multi[1].Value)
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "DUMP":
+			if v, ok := data[key]; ok {
+				return redis.NewBulkBytes([]byte(v))
+			}
+			return redis.NewBulkBytes(nil)
+		case "PTTL":
+			return redis.NewInt([]byte("-1"))
+		case "RESTORE":
+			if _, ok := data[key]; ok && len(multi) == 4 {
+				return redis.NewErrorf("BUSYKEY Target key name already exists.")
+			}
+			data[key] = string(multi[3].Value)
+			ttls[key] = string(multi[2].Value)
+			return redis.NewString([]byte("OK"))
+		case "DEL":
+			delete(data, key)
+			return redis.NewInt([]byte("1"))
+		default:
+			return redis.NewString([]byte("OK"))
+		}
+	}
+	b1, b2 := newFakeBackend(handler), newFakeBackend(handler)
+	defer b1.Close()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "RENAME", "{k}src", "{k}dst").IsString())
+	resp := handleTestRequest(s, d, "RENAMENX", "src", "dst")
+	assert.Must(resp.IsError() && strings.Contains(string(resp.Value), "same slot"))
+	assert.Must(handleTestRequest(s, d, "RENAME", "src").IsError())
+
+	config.RenameCrossSlotEnabled = true
+	defer func() {
+		config.RenameCrossSlotEnabled = false
+	}()
+
+	resp = handleTestRequest(s, d, "RENAME", "src", "dst")
+	assert.Must(resp.IsString() && string(resp.Value) == "OK")
+	mu.Lock()
+	assert.Must(data["dst"] == "payload" && ttls["dst"] == "0")
+	_, ok := data["src"]
+	assert.Must(!ok)
+	data["src"] = "other"
+	mu.Unlock()
+
+	resp = handleTestRequest(s, d, "RENAMENX", "src", "dst")
+	assert.Must(resp.IsInt() && string(resp.Value) == "0")
+	resp = handleTestRequest(s, d, "RENAMENX", "src", "new")
+	assert.Must(resp.IsInt() && string(resp.Value) == "1")
+
+	assert.Must(handleTestRequest(s, d, "RENAME", "missing", "dst").IsError())
+	assert.Must(len(d.locks.locks) == 0)
+}
+
+func TestSMoveCrossSlot(t *testing.T) {
+	var mu sync.Mutex
+	var sets = map[string]map[string]bool{
+		"src": {"m": true},
+	}
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		mu.Lock()
+		defer mu.Unlock()
+		var key, member = string(multi[1].Value), string(multi[2].Value)
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "SREM":
+			if !sets[key][member] {
+				return redis.NewInt([]byte("0"))
+			}
+			delete(sets[key], member)
+			return redis.NewInt([]byte("1"))
+		case "SADD":
+			if key == "wrongtype" {
+				return redis.NewErrorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+			}
+			if sets[key] == nil {
+				sets[key] = make(map[string]bool)
+			}
+			sets[key][member] = true
+			return redis.NewInt([]byte("1"))
+		default:
+			return redis.NewErrorf("ERR unexpected %s", multi[0].Value)
+		}
+	}
+	b1, b2 := newFakeBackend(handler), newFakeBackend(handler)
+	defer b1.Close()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	enabled := config.SMoveCrossSlotEnabled
+	defer func() {
+		config.SMoveCrossSlotEnabled = enabled
+	}()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "SMOVE", "src", "dst", "m").IsError())
+
+	config.SMoveCrossSlotEnabled = true
+	resp := handleTestRequest(s, d, "SMOVE", "src", "dst", "m")
+	assert.Must(resp.IsInt() && string(resp.Value) == "1")
+	resp = handleTestRequest(s, d, "SMOVE", "src", "dst", "m")
+	assert.Must(resp.IsInt() && string(resp.Value) == "0")
+
+	// The member is added back to the source if SADD fails.
+	assert.Must(handleTestRequest(s, d, "SMOVE", "dst", "wrongtype", "m").IsError())
+	mu.Lock()
+	assert.Must(sets["dst"]["m"] && !sets["src"]["m"])
+	mu.Unlock()
+}
@@ -0,0 +1,220 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+const (
+	ReplicaPolicyRandom     = "random"
+	ReplicaPolicyRoundRobin = "round-robin"
+	ReplicaPolicyLatency    = "latency"
+)
+
+// preferDataCenter moves the replicas in the data center of the proxy ahead
+// of the others, keeping the order of the groups otherwise. Replica groups
+// are ordered by the dashboard, the replicas on the same host first, then the
+// ones in the same data center, and the others, but the data center of the
+// proxy is known to the dashboard only if it's registered with it.
+func preferDataCenter(groups [][]string, datacenters map[string]string, dc string) [][]string {
+	if dc == "" || len(datacenters) == 0 {
+		return groups
+	}
+	var local, remote [][]string
+	for _, group := range groups {
+		var l, r []string
+		for _, addr := range group {
+			if datacenters[addr] == dc {
+				l = append(l, addr)
+			} else {
+				r = append(r, addr)
+			}
+		}
+		if len(l) != 0 {
+			local = append(local, l)
+		}
+		if len(r) != 0 {
+			remote = append(remote, r)
+		}
+	}
+	return append(local, remote...)
+}
+
+// selectReplica picks a replica of the group by backend_replica_policy of the
+// router the group belongs to.
+func selectReplica(group []*sharedBackendConn, r *Request) *BackendConn {
+	if len(group) == 0 {
+		return nil
+	}
+	var owner = group[0].owner
+	var database, seed, quick = r.Database, r.Seed16(), r.OpFlag.IsQuick()
+	var backendConn = func(s *sharedBackendConn) *BackendConn {
+		if !s.isWarm() || !isReplicaFresh(s) || isReplicaEjected(s) {
+			return nil
+		}
+		return s.BackendConn(database, seed, false, quick)
+	}
+	switch owner.config.BackendReplicaPolicy {
+	case ReplicaPolicyRoundRobin:
+		var start = uint(owner.next.Incr())
+		for i := range group {
+			if bc := backendConn(group[(start+uint(i))%uint(len(group))]); bc != nil {
+				return bc
+			}
+		}
+	case ReplicaPolicyLatency:
+		var best *BackendConn
+		for _, s := range group {
+			if bc := backendConn(s); bc != nil {
+				if best == nil || bc.Latency() < best.Latency() {
+					best = bc
+				}
+			}
+		}
+		return best
+	default:
+		var i = seed
+		for range group {
+			i = (i + 1) % uint(len(group))
+			if bc := backendConn(group[i]); bc != nil {
+				return bc
+			}
+		}
+	}
+	return nil
+}
+
+const replicaLagUnknown = -1
+
+// isReplicaFresh returns false if the replica lags behind its master more than
+// backend_replica_max_lag, or its lag is unknown.
+func isReplicaFresh(s *sharedBackendConn) bool {
+	var max = s.owner.config.BackendReplicaMaxLag
+	if max <= 0 {
+		return true
+	}
+	lag := s.lag.Int64()
+	return lag != replicaLagUnknown && lag <= max
+}
+
+// pollReplicaLags sends INFO replication to the master of each replica group,
+// and updates the lag of the replicas from the slaves listed in the reply.
+// It must be called with the lock held.
+func (s *Router) pollReplicaLags() {
+	if s.config.BackendReplicaMaxLag <= 0 {
+		return
+	}
+	var masters = make(map[string][]*sharedBackendConn)
+	var seen = make(map[*sharedBackendConn]bool)
+	for i := range s.slots {
+		slot := &s.slots[i]
+		addr := slot.backend.bc.Addr()
+		if addr == "" {
+			continue
+		}
+		for _, group := range slot.replicaGroups {
+			for _, replica := range group {
+				if !seen[replica] {
+					seen[replica] = true
+					masters[addr] = append(masters[addr], replica)
+				}
+			}
+		}
+	}
+	for addr, replicas := range masters {
+		bc := s.pool.primary.Get(addr).BackendConn(0, 0, false, false)
+		if bc == nil {
+			for _, replica := range replicas {
+				replica.lag.Set(replicaLagUnknown)
+			}
+			continue
+		}
+		m := &Request{Batch: &sync.WaitGroup{}}
+		m.Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte("INFO")),
+			redis.NewBulkBytes([]byte("replication")),
+		}
+		bc.PushBack(m)
+
+		addr, replicas := addr, replicas
+		keepAliveCallback <- func() {
+			m.Batch.Wait()
+			var lags map[string]int64
+			switch resp := m.Resp; {
+			case m.Err != nil:
+				log.WarnErrorf(m.Err, "poll replica lags of master %s failed", addr)
+			case resp == nil || !resp.IsBulkBytes():
+				log.Warnf("poll replica lags of master %s failed, bad info resp", addr)
+			default:
+				lags = parseReplicaLags(string(resp.Value))
+			}
+			for _, replica := range replicas {
+				if lag, ok := lags[replica.Addr()]; ok {
+					replica.lag.Set(lag)
+				} else {
+					replica.lag.Set(replicaLagUnknown)
+				}
+			}
+		}
+	}
+}
+
+// parseReplicaLags returns the lag of each slave listed in INFO replication,
+// e.g. "slave0:ip=127.0.0.1,port=6380,conn_fd=10,lag=(db0:0)", which is the
+// max lag of all databases if there're many.
+func parseReplicaLags(text string) map[string]int64 {
+	var lags = make(map[string]int64)
+	for _, line := range strings.Split(text, "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], "slave") {
+			continue
+		}
+		if _, err := strconv.Atoi(kv[0][len("slave"):]); err != nil {
+			continue
+		}
+		var ip, port string
+		var lag int64 = replicaLagUnknown
+		for _, field := range strings.Split(kv[1], ",") {
+			switch {
+			case strings.HasPrefix(field, "ip="):
+				ip = field[len("ip="):]
+			case strings.HasPrefix(field, "port="):
+				port = field[len("port="):]
+			}
+		}
+		if i := strings.Index(kv[1], "lag="); i >= 0 {
+			lag = parseReplicaLag(kv[1][i+len("lag="):])
+		}
+		if ip != "" && port != "" {
+			lags[net.JoinHostPort(ip, port)] = lag
+		}
+	}
+	return lags
+}
+
+func parseReplicaLag(s string) int64 {
+	var lag int64 = replicaLagUnknown
+	for _, f := range strings.FieldsFunc(s, func(c rune) bool {
+		return c == '(' || c == ')' || c == ',' || c == ' '
+	}) {
+		if i := strings.IndexByte(f, ':'); i >= 0 {
+			f = f[i+1:]
+		}
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil || n < 0 {
+			return replicaLagUnknown
+		}
+		if n > lag {
+			lag = n
+		}
+	}
+	return lag
+}
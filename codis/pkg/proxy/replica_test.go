@@ -0,0 +1,172 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestReplicaPolicy(t *testing.T) {
+	var backends = make([]*fakeBackend, 3)
+	for i, name := range []string{"primary", "fast", "slow"} {
+		var value = []byte(name)
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			if string(value) == "slow" {
+				time.Sleep(time.Millisecond * 20)
+			}
+			return redis.NewBulkBytes(value)
+		})
+		defer backends[i].Close()
+	}
+	policy := config.BackendReplicaPolicy
+	defer func() {
+		config.BackendReplicaPolicy = policy
+	}()
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: backends[0].Addr(),
+			ReplicaGroups: [][]string{{backends[1].Addr(), backends[2].Addr()}},
+		}))
+	}
+	d.Start()
+
+	s := newTestSession()
+	get := func() string {
+		return string(handleTestRequest(s, d, "GET", "key").Value)
+	}
+	for i := 0; get() == "primary"; i++ {
+		assert.Must(i < 100)
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	config.BackendReplicaPolicy = ReplicaPolicyRoundRobin
+	var seen = make(map[string]int)
+	for i := 0; i < 10; i++ {
+		seen[get()]++
+	}
+	assert.Must(seen["fast"] == 5 && seen["slow"] == 5)
+
+	config.BackendReplicaPolicy = ReplicaPolicyLatency
+	for i := 0; i < 3; i++ {
+		get()
+	}
+	for i := 0; i < 10; i++ {
+		assert.Must(get() == "fast")
+	}
+}
+
+func TestBackendLatency(t *testing.T) {
+	var bc BackendConn
+	assert.Must(bc.Latency() == 0)
+	bc.updateLatency(800)
+	assert.Must(bc.Latency() == 800)
+	bc.updateLatency(1600)
+	assert.Must(bc.Latency() == 900)
+	bc.updateLatency(0)
+	assert.Must(bc.Latency() == 900)
+}
+
+func TestParseReplicaLags(t *testing.T) {
+	lags := parseReplicaLags(`
+# Replication(MASTER)
+role:master
+connected_slaves:3
+slave0:ip=10.0.0.1,port=9221,conn_fd=104,lag=(db0:0)
+slave1:ip=10.0.0.2,port=9221,conn_fd=105,lag=(db0:10)(db1:300)
+slave2:ip=10.0.0.3,port=6379,state=online,offset=100,lag=1
+db0:binlog_offset=2 384,safety_purge=none
+`)
+	assert.Must(len(lags) == 3)
+	assert.Must(lags["10.0.0.1:9221"] == 0)
+	assert.Must(lags["10.0.0.2:9221"] == 300)
+	assert.Must(lags["10.0.0.3:6379"] == 1)
+}
+
+func TestReplicaMaxLag(t *testing.T) {
+	var backends = make([]*fakeBackend, 3)
+	var lags = []int64{0, 10}
+	backends[0] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		if string(multi[0].Value) != "INFO" {
+			return redis.NewBulkBytes([]byte("primary"))
+		}
+		var info = "role:master\n"
+		for i, b := range backends[1:] {
+			host, port, _ := net.SplitHostPort(b.Addr())
+			info += fmt.Sprintf("slave%d:ip=%s,port=%s,lag=(db0:%d)\n", i, host, port, lags[i])
+		}
+		return redis.NewBulkBytes([]byte(info))
+	})
+	defer backends[0].Close()
+	for i, name := range []string{"fresh", "stale"} {
+		var value = []byte(name)
+		backends[i+1] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			return redis.NewBulkBytes(value)
+		})
+		defer backends[i+1].Close()
+	}
+
+	maxLag := config.BackendReplicaMaxLag
+	defer func() {
+		config.BackendReplicaMaxLag = maxLag
+	}()
+	config.BackendReplicaMaxLag = 5
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: backends[0].Addr(),
+			ReplicaGroups: [][]string{{backends[1].Addr(), backends[2].Addr()}},
+		}))
+	}
+	d.Start()
+
+	s := newTestSession()
+	get := func() string {
+		return string(handleTestRequest(s, d, "GET", "key").Value)
+	}
+	assert.Must(get() == "primary")
+	for i := 0; get() != "fresh"; i++ {
+		assert.Must(i < 100)
+		assert.MustNoError(d.KeepAlive())
+		time.Sleep(time.Millisecond * 10)
+	}
+	for i := 0; i < 10; i++ {
+		assert.Must(get() == "fresh")
+	}
+}
+
+func TestReplicaDataCenter(t *testing.T) {
+	var groups = [][]string{{"a", "b"}, {"c", "d"}}
+	var datacenters = map[string]string{"b": "dc1", "d": "dc1", "a": "dc2"}
+	assert.Must(fmt.Sprint(preferDataCenter(groups, datacenters, "dc1")) == "[[b] [d] [a] [c]]")
+	assert.Must(fmt.Sprint(preferDataCenter(groups, datacenters, "")) == "[[a b] [c d]]")
+	assert.Must(fmt.Sprint(preferDataCenter(groups, nil, "dc1")) == "[[a b] [c d]]")
+
+	dc := config.ProxyDataCenter
+	defer func() {
+		config.ProxyDataCenter = dc
+	}()
+	config.ProxyDataCenter = "dc1"
+
+	d := NewRouter(config)
+	defer d.Close()
+	assert.MustNoError(d.FillSlot(&models.Slot{
+		Id: 0, BackendAddr: "127.0.0.1:0",
+		ReplicaGroups:      [][]string{{"127.0.0.1:1", "127.0.0.1:2"}},
+		ReplicaDataCenters: map[string]string{"127.0.0.1:2": "dc1"},
+	}))
+	groups = d.GetSlot(0).ReplicaGroups
+	assert.Must(fmt.Sprint(groups) == "[[127.0.0.1:2] [127.0.0.1:1]]")
+}
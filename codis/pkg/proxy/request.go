@@ -22,14 +22,54 @@ type Request struct {
 	OpFlag
 
 	Database              int32
+	ReplicaRead           bool
+	MasterRead            bool
+	Writes                *recentWrites
 	ReceiveTime           int64
 	SendToServerTime      int64
 	ReceiveFromServerTime int64
 	TasksLen              int64
 
+	// Deadline is the time in unix nano after which the client doesn't wait
+	// for the reply anymore, as set by CLIENT DEADLINE, or zero if none.
+	Deadline int64
+
+	// Namespace is the key prefix of the ACL user, stripped from the reply.
+	Namespace string
+
+	quota     *quotaState
+	quotaSize int64
+
+	// session is set if the reply is counted in its output buffer.
+	session    *Session
+	outputSize int64
+
+	inflight *inflightSize
+
+	// trace is set if the request is sampled by tracing, and span is the
+	// span of the backend the request is sent to.
+	trace *requestTrace
+	span  *backendSpan
+
+	// backend is the addr of the backend the request is sent to.
+	backend string
+
+	// flightLeave is set if the request is the leader of a flight, it's
+	// called once the request is replied.
+	flightLeave func()
+
+	// slotStats is of the slot the request is dispatched to, at slotStart.
+	slotStats *slotStats
+	slotStart int64
+	slot      int
+
 	*redis.Resp
 	Err error
 
+	// Replies are written right after Resp, e.g. SUBSCRIBE with several
+	// channels replies once for each of them.
+	Replies []*redis.Resp
+
 	Coalesce func() error
 }
 
@@ -46,7 +86,13 @@ func (r *Request) MakeSubRequest(n int) []Request {
 		x.OpFlag = r.OpFlag
 		x.Broken = r.Broken
 		x.Database = r.Database
+		x.ReplicaRead = r.ReplicaRead
+		x.MasterRead = r.MasterRead
+		x.Writes = r.Writes
 		x.ReceiveTime = r.ReceiveTime
+		x.Deadline = r.Deadline
+		x.inflight = r.inflight
+		x.trace = r.trace
 	}
 	return sub
 }
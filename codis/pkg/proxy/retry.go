@@ -0,0 +1,80 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+var RetryCount atomic2.Int64
+
+var errRespReadOnly = []byte("READONLY")
+
+// isRetryable returns whether the request failed on a transient error of the
+// backend, i.e. the connection is reset, or the server is loading the data or
+// has become a replica, which may be cured by the time the request is resent.
+func isRetryable(r *Request) bool {
+	switch {
+	case r.IsBroken():
+		return false
+	case r.Err != nil:
+		return true
+	case r.Resp == nil || !r.Resp.IsError():
+		return false
+	}
+	return bytes.HasPrefix(r.Resp.Value, errRespLoading) || bytes.HasPrefix(r.Resp.Value, errRespReadOnly)
+}
+
+// retryBackoff returns the jittered delay before the n-th retry, which is
+// drawn from the upper half of backend_retry_backoff * 2^(n-1).
+func retryBackoff(base time.Duration, n int) time.Duration {
+	var d = base << uint(n-1)
+	if d <= 0 || d > time.Second {
+		d = time.Second
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// dispatchRetry sends a read-only request like dispatch, and resends it up to
+// backend_retry_max times if it fails on a transient error. The retries are
+// made in the background, and the request is done once the last one is
+// replied, so the session writer never waits for the backoff.
+func (s *Session) dispatchRetry(r *Request, d *Router) error {
+	var retries, base = s.config.BackendRetryMax, s.config.BackendRetryBackoff.Duration()
+
+	sub := r.MakeSubRequest(1)[0]
+	sub.Batch = &sync.WaitGroup{}
+	sub.Multi = r.Multi
+	if err := d.dispatch(&sub); err != nil {
+		return err
+	}
+	r.Batch.Add(1)
+	go func() {
+		defer r.Batch.Done()
+		for n := 1; ; n++ {
+			sub.Batch.Wait()
+			if n > retries || !isRetryable(&sub) {
+				return
+			}
+			RetryCount.Incr()
+			time.Sleep(retryBackoff(base, n))
+
+			sub.Resp, sub.Err, sub.Group = nil, nil, nil
+			if err := d.dispatch(&sub); err != nil {
+				sub.Err = err
+				return
+			}
+		}
+	}()
+	r.Coalesce = func() error {
+		r.Resp, r.Err = sub.Resp, sub.Err
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestRetryTransientErrors(t *testing.T) {
+	var fails atomic2.Int64
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		switch string(multi[0].Value) {
+		case "GET":
+			if fails.Decr() >= 0 {
+				return redis.NewErrorf("LOADING Redis is loading the dataset in memory")
+			}
+			return redis.NewBulkBytes([]byte("v"))
+		case "SET":
+			if fails.Decr() >= 0 {
+				return redis.NewErrorf("READONLY You can't write against a read only replica.")
+			}
+		}
+		return redis.NewString([]byte("OK"))
+	})
+	defer backend.Close()
+
+	retries, backoff := config.BackendRetryMax, config.BackendRetryBackoff
+	defer func() {
+		config.BackendRetryMax, config.BackendRetryBackoff = retries, backoff
+	}()
+	config.BackendRetryMax = 2
+	config.BackendRetryBackoff.UnmarshalText([]byte("1ms"))
+
+	d := newTestRouter(backend.Addr())
+	defer d.Close()
+	s := newTestSession()
+
+	var count = RetryCount.Int64()
+	fails.Set(2)
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "v")
+	assert.Must(RetryCount.Int64() == count+2)
+
+	fails.Set(3)
+	assert.Must(handleTestRequest(s, d, "GET", "key").IsError())
+
+	fails.Set(1)
+	assert.Must(handleTestRequest(s, d, "SET", "key", "v").IsError())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for n := 1; n <= 20; n++ {
+		d := retryBackoff(time.Millisecond*10, n)
+		max := time.Millisecond * 10 << uint(n-1)
+		if max > time.Second {
+			max = time.Second
+		}
+		assert.Must(d >= max/2 && d <= max)
+	}
+	assert.Must(isRetryable(&Request{Err: ErrBackendConnReset}))
+	assert.Must(!isRetryable(&Request{Resp: redis.NewErrorf("ERR wrong type")}))
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sort"
+	"strconv"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+const (
+	RouterModeSlots = "slots"
+	RouterModeRing  = "ring"
+)
+
+// hashRing is a consistent hash ring of the backends, with virtual nodes. In
+// ring mode, keys are hashed onto the ring instead of the slot table, and
+// sent through the first slot of the backend they belong to, so adding or
+// removing a group moves only a part of the keys, which is enough for
+// pure-cache deployments.
+type hashRing struct {
+	addrs  []string
+	slots  []int
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash uint64
+	slot int
+}
+
+func newHashRing(addrs []string, slots []int, vnodes int) *hashRing {
+	var points = make([]ringPoint, 0, len(addrs)*vnodes)
+	for i, addr := range addrs {
+		for j := 0; j < vnodes; j++ {
+			h := xxhash64([]byte(addr + "#" + strconv.Itoa(j)))
+			points = append(points, ringPoint{h, slots[i]})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return points[i].slot < points[j].slot
+	})
+	return &hashRing{addrs: addrs, slots: slots, points: points}
+}
+
+// lookup returns the slot the key is sent through, or -1 if the ring is
+// empty. Keys with the same hash tag are always on the same backend.
+func (r *hashRing) lookup(key []byte) int {
+	if len(r.points) == 0 {
+		return -1
+	}
+	h := xxhash64(hashTag(key))
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	return r.points[i%len(r.points)].slot
+}
+
+// updateRing rebuilds the ring if the backends in the slot table changed. It
+// must be called with the lock held.
+func (s *Router) updateRing() {
+	if s.config.RouterMode != RouterModeRing {
+		return
+	}
+	var addrs []string
+	var slots []int
+	var seen = make(map[string]int)
+	for i := range s.slots {
+		addr := s.slots[i].backend.bc.Addr()
+		if addr == "" {
+			continue
+		}
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		seen[addr] = i
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		slots = append(slots, seen[addr])
+	}
+	if s.ring != nil && equalStrings(s.ring.addrs, addrs) && equalInts(s.ring.slots, slots) {
+		return
+	}
+	s.ring = newHashRing(addrs, slots, s.config.RingVirtualNodes)
+}
+
+func (s *Router) isRingMode() bool {
+	return s.config.RouterMode == RouterModeRing
+}
+
+// keySlot returns the slot the key is sent through, which is the first slot
+// of the backend of the key on the ring in ring mode.
+func (s *Router) keySlot(key []byte) int {
+	if s.isRingMode() {
+		s.mu.RLock()
+		ring := s.ring
+		s.mu.RUnlock()
+		if ring != nil {
+			if id := ring.lookup(key); id >= 0 {
+				return id
+			}
+		}
+	}
+	return int(Hash(key) % uint32(models.GetMaxSlotNum()))
+}
+
+// isSameSlot returns whether the keys are all sent through the same slot.
+func (s *Router) isSameSlot(keys []*redis.Resp) bool {
+	for i := 1; i < len(keys); i++ {
+		if s.keySlot(keys[i].Value) != s.keySlot(keys[0].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestHashRing(t *testing.T) {
+	r3 := newHashRing([]string{"a", "b", "c"}, []int{0, 1, 2}, 160)
+	r2 := newHashRing([]string{"a", "b"}, []int{0, 1}, 160)
+
+	var count = make(map[int]int)
+	for i := 0; i < 3000; i++ {
+		key := []byte("key" + strconv.Itoa(i))
+		id := r3.lookup(key)
+		count[id]++
+		// Only the keys of the removed backend are moved.
+		if id != 2 {
+			assert.Must(r2.lookup(key) == id)
+		}
+	}
+	assert.Must(len(count) == 3)
+	for _, n := range count {
+		assert.Must(n > 3000/6)
+	}
+	assert.Must(r3.lookup([]byte("{tag}a")) == r3.lookup([]byte("{tag}b")))
+
+	assert.Must(newHashRing(nil, nil, 160).lookup([]byte("key")) == -1)
+}
+
+func TestRingRouting(t *testing.T) {
+	var addrs []string
+	var names = make(map[string]int)
+	for i, name := range []string{"b1", "b2", "b3", "r1"} {
+		names[name] = i
+		var value = []byte(name)
+		b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			return redis.NewBulkBytes(value)
+		})
+		defer b.Close()
+		addrs = append(addrs, b.Addr())
+	}
+
+	mode, vnodes, replica := config.RouterMode, config.RingVirtualNodes, config.SessionReplicaRead
+	defer func() {
+		config.RouterMode, config.RingVirtualNodes, config.SessionReplicaRead = mode, vnodes, replica
+	}()
+	config.RouterMode, config.RingVirtualNodes, config.SessionReplicaRead = RouterModeRing, 160, ReplicaReadOnly
+
+	d := NewRouter(config)
+	defer d.Close()
+	fill := func(fenced bool) {
+		for i := 0; i < models.GetMaxSlotNum(); i++ {
+			assert.MustNoError(d.FillSlot(&models.Slot{
+				Id: i, BackendAddr: addrs[i%3], Fenced: fenced,
+				ReplicaGroups: [][]string{{addrs[3]}},
+			}))
+		}
+	}
+	fill(false)
+	d.Start()
+	assert.Must(len(d.backendAddrs()) == 3)
+
+	s := newTestSession()
+	var seen = make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		key := "key" + strconv.Itoa(i)
+		resp := handleTestRequest(s, d, "GET", key)
+		assert.Must(resp.IsBulkBytes())
+		seen[string(resp.Value)] = true
+
+		// Keys are hashed onto the ring, and sent through the first slot
+		// of their backend.
+		id := d.ring.lookup([]byte(key))
+		assert.Must(id < 3 && addrs[names[string(resp.Value)]] == d.slotAddr(id))
+	}
+	assert.Must(len(seen) == 3)
+
+	// Fenced slots reject writes, and reads are sent to replicas as usual.
+	fill(true)
+	assert.Must(handleTestRequest(s, d, "SET", "key", "v").IsError())
+	assert.Must(handleTestRequest(s, d, "READONLY").IsString())
+	for i := 0; !d.pool.replica.Get(addrs[3]).isWarm(); i++ {
+		assert.Must(i < 100)
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "r1")
+}
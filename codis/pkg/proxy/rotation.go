@@ -0,0 +1,136 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/log"
+	redisclient "pika/codis/v2/pkg/utils/redis"
+	"pika/codis/v2/pkg/utils/rpc"
+)
+
+// proxyAuth is product_auth and session_auth of a proxy, which are changed
+// at runtime once refreshed from secrets, and their rotations, in which the
+// old and the new passwords are both accepted until the deadline, by the
+// backends and by the default user respectively.
+type proxyAuth struct {
+	mu sync.RWMutex
+
+	productAuth, sessionAuth string
+
+	product, session redisclient.AuthRotation
+}
+
+// productAuth returns product_auth, or the one refreshed from secrets.
+func (c *Config) productAuth() string {
+	if c.auth == nil {
+		return c.ProductAuth
+	}
+	c.auth.mu.RLock()
+	defer c.auth.mu.RUnlock()
+	if c.auth.productAuth != "" {
+		return c.auth.productAuth
+	}
+	return c.ProductAuth
+}
+
+// sessionAuth returns session_auth, or the one refreshed from secrets.
+func (c *Config) sessionAuth() string {
+	if c.auth == nil {
+		return c.SessionAuth
+	}
+	c.auth.mu.RLock()
+	defer c.auth.mu.RUnlock()
+	if c.auth.sessionAuth != "" {
+		return c.auth.sessionAuth
+	}
+	return c.SessionAuth
+}
+
+func (c *Config) setProductAuth(auth string) {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	c.auth.productAuth = auth
+}
+
+func (c *Config) setSessionAuth(auth string) {
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	c.auth.sessionAuth = auth
+}
+
+func (c *Config) productAuthRotation() *redisclient.AuthRotation {
+	if c.auth == nil {
+		return nil
+	}
+	return &c.auth.product
+}
+
+func (c *Config) sessionAuthRotation() *redisclient.AuthRotation {
+	if c.auth == nil {
+		return nil
+	}
+	return &c.auth.session
+}
+
+// SetAuthRotation starts the rotation of product_auth and session_auth as
+// pushed by the dashboard. Backends are authenticated with the new and then
+// the old product_auth, and xauths of all of them are accepted by the admin API.
+func (p *Proxy) SetAuthRotation(r *models.AuthRotation) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosedProxy
+	}
+	var deadline = time.Unix(r.Deadline, 0)
+
+	for _, x := range []struct {
+		name     string
+		rotation *redisclient.AuthRotation
+		auth, to string
+	}{
+		{"product_auth", p.config.productAuthRotation(), p.config.productAuth(), r.ProductAuth},
+		{"session_auth", p.config.sessionAuthRotation(), p.config.sessionAuth(), r.SessionAuth},
+	} {
+		var auth = x.rotation.Current(x.auth)
+		if x.to == "" && auth != x.auth {
+			log.Warnf("[%p] %s is still rotated, restart with the new one to clear", p, x.name)
+			continue
+		}
+		x.rotation.Set(auth, x.to, deadline)
+	}
+
+	p.xauths = nil
+	for _, auth := range append(p.config.productAuthRotation().Known(), p.config.productAuth()) {
+		p.xauths = append(p.xauths, rpc.NewXAuth(p.config.ProductName, auth, p.model.Token))
+	}
+	log.Warnf("[%p] set auth rotation:\n%s", p, r.Masked().Encode())
+	p.rotation = r
+	return nil
+}
+
+func (p *Proxy) AuthRotation() *models.AuthRotation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rotation
+}
+
+// IsXAuth returns whether the xauth is of product_auth, or of the old or the
+// new one of the rotation.
+func (p *Proxy) IsXAuth(xauth string) bool {
+	if xauth == p.xauth {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, x := range p.xauths {
+		if xauth == x {
+			return true
+		}
+	}
+	return false
+}
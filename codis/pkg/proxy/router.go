@@ -21,6 +21,8 @@ type Router struct {
 		replica *sharedBackendConnPool
 	}
 	slots []Slot
+	locks keyLocks
+	ring  *hashRing
 
 	config *Config
 	online bool
@@ -59,6 +61,8 @@ func (s *Router) Close() {
 	for i := range s.slots {
 		s.fillSlot(&models.Slot{Id: i}, false, nil)
 	}
+	s.pool.primary.Drain(true)
+	s.pool.replica.Drain(true)
 }
 
 func (s *Router) GetSlots() []*models.Slot {
@@ -81,6 +85,65 @@ func (s *Router) GetSlot(id int) *models.Slot {
 	return slot.snapshot()
 }
 
+// backendSlots returns the id of one slot for each distinct backend.
+func (s *Router) backendSlots() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []int
+	var seen = make(map[string]bool)
+	for i := range s.slots {
+		addr := s.addrOfSlot(i)
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		ids = append(ids, i)
+	}
+	return ids
+}
+
+// backendAddrs returns the addr of each distinct backend.
+func (s *Router) backendAddrs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var addrs []string
+	var seen = make(map[string]bool)
+	for i := range s.slots {
+		addr := s.addrOfSlot(i)
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+func (s *Router) slotAddr(id int) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.addrOfSlot(id)
+}
+
+// addrOfSlot returns the backend of the slot. It must be called with the
+// lock held.
+func (s *Router) addrOfSlot(id int) string {
+	return s.slots[id].backend.bc.Addr()
+}
+
+// assignedSlots returns the number of slots with a backend.
+func (s *Router) assignedSlots() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n int
+	for i := range s.slots {
+		if s.addrOfSlot(i) != "" {
+			n++
+		}
+	}
+	return n
+}
+
 func (s *Router) HasSwitched() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -128,26 +191,94 @@ func (s *Router) KeepAlive() error {
 	}
 	s.pool.primary.KeepAlive()
 	s.pool.replica.KeepAlive()
+	s.pollReplicaLags()
+	s.probeBackends()
 	return nil
 }
 
+// hasReplicaGroups returns whether any slot has replica groups.
+func (s *Router) hasReplicaGroups() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.slots {
+		if len(s.slots[i].replicaGroups) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Router) isOnline() bool {
 	return s.online && !s.closed
 }
 
 func (s *Router) dispatch(r *Request) error {
 	hkey := getHashKey(r.Multi, r.OpStr)
-	var id = Hash(hkey) % uint32(models.GetMaxSlotNum())
+	var id = s.keySlot(hkey)
+	r.Writes.track(r, id)
+	sampleHotKey(hkey)
+	s.slots[id].stats.dispatch(r, id)
+	r.trace.setSlot(id)
 	slot := &s.slots[id]
-	return slot.forward(r, hkey)
+	return slot.stats.fail(slot.forward(r, hkey))
 }
 
 func (s *Router) dispatchSlot(r *Request, id int) error {
 	if id < 0 || id >= models.GetMaxSlotNum() {
 		return ErrInvalidSlotId
 	}
+	r.Writes.track(r, id)
+	s.slots[id].stats.dispatch(r, id)
+	r.trace.setSlot(id)
 	slot := &s.slots[id]
-	return slot.forward(r, nil)
+	return slot.stats.fail(slot.forward(r, nil))
+}
+
+// dispatchBatch sends a request with many keys of the slot, which can't be
+// done while the slot is being migrated, since keys are migrated one by one
+// before being accessed. It returns false in that case.
+func (s *Router) dispatchBatch(r *Request, id int) (bool, error) {
+	if id < 0 || id >= models.GetMaxSlotNum() {
+		return false, ErrInvalidSlotId
+	}
+	r.Writes.track(r, id)
+	s.slots[id].stats.dispatch(r, id)
+	r.trace.setSlot(id)
+	slot := &s.slots[id]
+	slot.lock.RLock()
+	switch {
+	case slot.backend.bc == nil:
+		slot.lock.RUnlock()
+		return false, slot.stats.fail(ErrSlotIsNotReady)
+	case slot.migrate.bc != nil:
+		slot.lock.RUnlock()
+		return false, nil
+	case (&forwardHelper{}).fenced(slot, r):
+		slot.lock.RUnlock()
+		return true, nil
+	}
+	bc := (&forwardHelper{}).forward2(slot, r)
+	if bc == nil {
+		slot.lock.RUnlock()
+		return false, slot.stats.fail(ErrBackendIsBroken)
+	}
+	r.Group = &slot.refs
+	r.Group.Add(1)
+	slot.lock.RUnlock()
+	bc.PushBack(r)
+	return true, nil
+}
+
+// slotBackendAddr returns the address of the backend of the slot, or "" if
+// the slot isn't ready.
+func (s *Router) slotBackendAddr(id int) string {
+	slot := &s.slots[id]
+	slot.lock.RLock()
+	defer slot.lock.RUnlock()
+	if slot.backend.bc == nil {
+		return ""
+	}
+	return slot.backend.bc.Addr()
 }
 
 func (s *Router) dispatchAddr(r *Request, addr string) bool {
@@ -182,6 +313,7 @@ func (s *Router) fillSlot(m *models.Slot, switched bool, method forwardMethod) {
 	slot.replicaGroups = nil
 
 	slot.switched = switched
+	slot.fenced = m.Fenced
 
 	if addr := m.BackendAddr; len(addr) != 0 {
 		slot.backend.bc = s.pool.primary.Retain(addr)
@@ -192,9 +324,10 @@ func (s *Router) fillSlot(m *models.Slot, switched bool, method forwardMethod) {
 		slot.migrate.id = m.MigrateFromGroupId
 	}
 	if !s.config.BackendPrimaryOnly {
-		for i := range m.ReplicaGroups {
+		var groups = preferDataCenter(m.ReplicaGroups, m.ReplicaDataCenters, s.config.ProxyDataCenter)
+		for i := range groups {
 			var group []*sharedBackendConn
-			for _, addr := range m.ReplicaGroups[i] {
+			for _, addr := range groups[i] {
 				group = append(group, s.pool.replica.Retain(addr))
 			}
 			if len(group) == 0 {
@@ -206,6 +339,7 @@ func (s *Router) fillSlot(m *models.Slot, switched bool, method forwardMethod) {
 	if method != nil {
 		slot.method = method
 	}
+	s.updateRing()
 
 	if !m.Locked {
 		slot.unblock()
@@ -233,14 +367,52 @@ func (s *Router) fillSlot(m *models.Slot, switched bool, method forwardMethod) {
 
 // SetPrimaryQuickConn Set the number of quick connections.
 func (s *Router) SetPrimaryQuickConn(quick int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	s.pool.primary.SetQuickConn(quick)
 }
 
 // SetReplicaQuickConn Set the number of quick connections.
 func (s *Router) SetReplicaQuickConn(quick int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	s.pool.replica.SetQuickConn(quick)
 }
 
+// Parallel returns the number of connections, i.e. the pairs of worker
+// goroutines, to each primary and replica backend.
+func (s *Router) Parallel() (primary, replica int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pool.primary.parallel, s.pool.replica.parallel
+}
+
+// SetParallel replaces the pools of backend connections by the ones with the
+// new numbers of parallel connections. The slots are refilled one by one, so
+// that the requests in flight are done before the old connections are closed.
+func (s *Router) SetParallel(primary, replica int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosedRouter
+	}
+	var old = s.pool
+	if primary == old.primary.parallel && replica == old.replica.parallel {
+		return nil
+	}
+	s.pool.primary = newSharedBackendConnPool(s.config, primary, old.primary.quick)
+	s.pool.replica = newSharedBackendConnPool(s.config, replica, old.replica.quick)
+	for i := range s.slots {
+		slot := &s.slots[i]
+		s.fillSlot(slot.snapshot(), slot.switched, nil)
+	}
+	old.primary.Drain(true)
+	old.replica.Drain(true)
+	log.Warnf("set backend parallel primary %d -> %d, replica %d -> %d",
+		old.primary.parallel, primary, old.replica.parallel, replica)
+	return nil
+}
+
 func (s *Router) SwitchMasters(masters map[int]string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -248,7 +420,9 @@ func (s *Router) SwitchMasters(masters map[int]string) error {
 		return ErrClosedRouter
 	}
 	cache := &redis.InfoCache{
-		Auth: s.config.ProductAuth, Timeout: time.Millisecond * 100,
+		Auth: s.config.productAuth(), Timeout: time.Millisecond * 100,
+
+		Rotation: s.config.productAuthRotation(),
 	}
 	for i := range s.slots {
 		s.trySwitchMaster(i, masters, cache)
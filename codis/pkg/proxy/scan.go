@@ -0,0 +1,181 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// The cursor returned to the client keeps the index of the group being
+// scanned in the lowest bits, and the cursor of that group in the rest.
+const (
+	scanGroupBits = 10
+	scanGroupMask = 1<<scanGroupBits - 1
+
+	MaxScanBackendCursor = 1<<(64-scanGroupBits) - 1
+)
+
+// handleRequestScan iterates the groups one after another, ordered by the
+// first slot they serve. Like redis, keys may be returned more than once,
+// e.g. while slots are being migrated.
+func (s *Session) handleRequestScan(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'SCAN' command")
+		return nil
+	}
+	cursor, err := strconv.ParseUint(string(r.Multi[1].Value), 10, 64)
+	if err != nil {
+		r.Resp = redis.NewErrorf("ERR invalid cursor")
+		return nil
+	}
+	ids := d.backendSlots()
+	if len(ids) == 0 {
+		return ErrSlotIsNotReady
+	}
+	var index = int(cursor & scanGroupMask)
+	if index >= len(ids) {
+		// The groups have been changed since the scan started.
+		r.Resp = newScanReply(0, nil)
+		return nil
+	}
+
+	sub := r.MakeSubRequest(1)
+	sub[0].Multi = make([]*redis.Resp, len(r.Multi))
+	copy(sub[0].Multi, r.Multi)
+	sub[0].Multi[1] = redis.NewBulkBytes(strconv.AppendUint(nil, cursor>>scanGroupBits, 10))
+	if err := d.dispatchSlot(&sub[0], ids[index]); err != nil {
+		return err
+	}
+	r.Coalesce = func() error {
+		switch resp := sub[0].Resp; {
+		case sub[0].Err != nil:
+			return sub[0].Err
+		case resp == nil:
+			return ErrRespIsRequired
+		case resp.IsError():
+			r.Resp = resp
+			return nil
+		case !resp.IsArray() || len(resp.Array) != 2:
+			r.Resp = redis.NewErrorf("ERR bad scan resp: %s", resp.Type)
+			return nil
+		default:
+			next, err := strconv.ParseUint(string(resp.Array[0].Value), 10, 64)
+			switch {
+			case err != nil:
+				r.Resp = redis.NewErrorf("ERR bad scan cursor resp: %s", resp.Array[0].Value)
+			case next > MaxScanBackendCursor:
+				r.Resp = redis.NewErrorf("ERR scan cursor of backend is out of range")
+			case next != 0:
+				r.Resp = newScanReply(next<<scanGroupBits|uint64(index), resp.Array[1])
+			case index+1 < len(ids):
+				r.Resp = newScanReply(uint64(index+1), resp.Array[1])
+			default:
+				r.Resp = newScanReply(0, resp.Array[1])
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func newScanReply(cursor uint64, keys *redis.Resp) *redis.Resp {
+	if keys == nil {
+		keys = redis.NewArray([]*redis.Resp{})
+	}
+	return redis.NewArray([]*redis.Resp{
+		redis.NewBulkBytes(strconv.AppendUint(nil, cursor, 10)),
+		keys,
+	})
+}
+
+// handleRequestKeys answers KEYS by scanning all groups in parallel, if it
+// has been enabled by keys_fanout_enabled. The reply is cut at
+// keys_fanout_max_results keys.
+func (s *Session) handleRequestKeys(r *Request, d *Router) error {
+	if !s.config.KeysFanoutEnabled {
+		return fmt.Errorf("command '%s' is not allowed", r.OpStr)
+	}
+	if len(r.Multi) != 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'KEYS' command")
+		return nil
+	}
+	ids := d.backendSlots()
+	if len(ids) == 0 {
+		return ErrSlotIsNotReady
+	}
+	var limit = s.config.KeysFanoutMaxResults
+	r.Coalesce = func() error {
+		var total atomic2.Int64
+		var keys = make([][]*redis.Resp, len(ids))
+		var resps = make([]*redis.Resp, len(ids))
+		var errs = make([]error, len(ids))
+		var wg sync.WaitGroup
+		for i := range ids {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				keys[i], resps[i], errs[i] = scanAllKeys(r, d, ids[i], &total, limit)
+			}(i)
+		}
+		wg.Wait()
+
+		var array = []*redis.Resp{}
+		var seen = make(map[string]bool)
+		for i := range ids {
+			if errs[i] != nil {
+				return errs[i]
+			}
+			if resps[i] != nil {
+				r.Resp = resps[i]
+				return nil
+			}
+			for _, key := range keys[i] {
+				if int64(len(array)) < limit && !seen[string(key.Value)] {
+					seen[string(key.Value)] = true
+					array = append(array, key)
+				}
+			}
+		}
+		r.Resp = redis.NewArray(array)
+		return nil
+	}
+	return nil
+}
+
+// scanAllKeys scans the group serving the slot until the end, or until
+// enough keys have been found. An error reply is returned as is.
+func scanAllKeys(r *Request, d *Router, id int, total *atomic2.Int64, limit int64) ([]*redis.Resp, *redis.Resp, error) {
+	var keys []*redis.Resp
+	var cursor = []byte("0")
+	for total.Int64() < limit {
+		resp, err := dispatchSlotWait(r, d, id, []*redis.Resp{
+			redis.NewBulkBytes([]byte("SCAN")),
+			redis.NewBulkBytes(cursor),
+			redis.NewBulkBytes([]byte("MATCH")),
+			r.Multi[1],
+			redis.NewBulkBytes([]byte("COUNT")),
+			redis.NewBulkBytes([]byte("1000")),
+		})
+		switch {
+		case err != nil:
+			return nil, nil, err
+		case resp.IsError():
+			return nil, resp, nil
+		case !resp.IsArray() || len(resp.Array) != 2:
+			return nil, redis.NewErrorf("ERR bad scan resp: %s", resp.Type), nil
+		default:
+			keys = append(keys, resp.Array[1].Array...)
+			total.Add(int64(len(resp.Array[1].Array)))
+			if cursor = resp.Array[0].Value; string(cursor) == "0" {
+				return keys, nil, nil
+			}
+		}
+	}
+	return keys, nil, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestScan(t *testing.T) {
+	var backends = make([]*fakeBackend, 3)
+	var addrs = make([]string, len(backends))
+	for i := range backends {
+		var keys = []string{
+			"key-" + strconv.Itoa(i) + "-a",
+			"key-" + strconv.Itoa(i) + "-b",
+		}
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			assert.Must(string(multi[2].Value) == "MATCH")
+			cursor, err := strconv.Atoi(string(multi[1].Value))
+			assert.MustNoError(err)
+			next := "0"
+			if cursor+1 < len(keys) {
+				next = strconv.Itoa(cursor + 1)
+			}
+			return redis.NewArray([]*redis.Resp{
+				redis.NewBulkBytes([]byte(next)),
+				redis.NewArray([]*redis.Resp{redis.NewBulkBytes([]byte(keys[cursor]))}),
+			})
+		})
+		defer backends[i].Close()
+		addrs[i] = backends[i].Addr()
+	}
+
+	d := newTestRouter(addrs...)
+	defer d.Close()
+
+	s := newTestSession()
+
+	var keys = make(map[string]bool)
+	var cursor = "0"
+	for i := 0; ; i++ {
+		assert.Must(i < 10)
+		resp := handleTestRequest(s, d, "SCAN", cursor, "MATCH", "key-*")
+		assert.Must(resp.IsArray() && len(resp.Array) == 2)
+		for _, key := range resp.Array[1].Array {
+			keys[string(key.Value)] = true
+		}
+		if cursor = string(resp.Array[0].Value); cursor == "0" {
+			break
+		}
+	}
+	assert.Must(len(keys) == 6)
+
+	assert.Must(handleTestRequest(s, d, "SCAN", "-1").IsError())
+	assert.Must(handleTestRequest(s, d, "SCAN").IsError())
+
+	resp := handleTestRequest(s, d, "SCAN", "1023")
+	assert.Must(resp.IsArray() && string(resp.Array[0].Value) == "0")
+}
+
+func TestKeysFanout(t *testing.T) {
+	var backends = make([]*fakeBackend, 2)
+	var addrs = make([]string, len(backends))
+	for i := range backends {
+		var keys = []*redis.Resp{
+			redis.NewBulkBytes([]byte("key-" + strconv.Itoa(i) + "-a")),
+			redis.NewBulkBytes([]byte("key-" + strconv.Itoa(i) + "-b")),
+			redis.NewBulkBytes([]byte("key-" + strconv.Itoa(i) + "-c")),
+		}
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			assert.Must(string(multi[0].Value) == "SCAN" && string(multi[3].Value) == "key-*")
+			cursor, err := strconv.Atoi(string(multi[1].Value))
+			assert.MustNoError(err)
+			next := "0"
+			if cursor+1 < len(keys) {
+				next = strconv.Itoa(cursor + 1)
+			}
+			return redis.NewArray([]*redis.Resp{
+				redis.NewBulkBytes([]byte(next)),
+				redis.NewArray([]*redis.Resp{keys[cursor]}),
+			})
+		})
+		defer backends[i].Close()
+		addrs[i] = backends[i].Addr()
+	}
+
+	d := newTestRouter(addrs...)
+	defer d.Close()
+
+	s := newTestSession()
+	r := newTestRequest("KEYS", "key-*")
+	assert.Must(s.handleRequest(r, d) != nil)
+
+	enabled, limit := config.KeysFanoutEnabled, config.KeysFanoutMaxResults
+	defer func() {
+		config.KeysFanoutEnabled, config.KeysFanoutMaxResults = enabled, limit
+	}()
+	config.KeysFanoutEnabled = true
+
+	resp := handleTestRequest(s, d, "KEYS", "key-*")
+	assert.Must(resp.IsArray() && len(resp.Array) == 6)
+
+	config.KeysFanoutMaxResults = 4
+	resp = handleTestRequest(s, d, "KEYS", "key-*")
+	assert.Must(resp.IsArray() && len(resp.Array) == 4)
+
+	assert.Must(handleTestRequest(s, d, "KEYS").IsError())
+}
@@ -0,0 +1,316 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+const MaxScriptRecords = 4096
+
+// scripts keeps the bodies of the scripts seen by the proxy, so EVALSHA can
+// be resent as EVAL when the backend replies NOSCRIPT. If the proxy has a
+// coordinator, the scripts are shared with other proxies through it, so they
+// are also known to other proxies and after restarts.
+var scripts struct {
+	sync.RWMutex
+	bodies map[string][]byte
+
+	store *models.Store
+}
+
+func init() {
+	scripts.bodies = make(map[string][]byte, 64)
+}
+
+func scriptSHA1(body []byte) string {
+	sum := sha1.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// setScriptStore shares the scripts through the store, the scripts already
+// in the store are loaded, store can be nil to stop sharing.
+func setScriptStore(store *models.Store) error {
+	scripts.Lock()
+	scripts.store = store
+	scripts.Unlock()
+	if store == nil {
+		return nil
+	}
+	shared, err := store.ListScripts()
+	if err != nil {
+		return err
+	}
+	scripts.Lock()
+	defer scripts.Unlock()
+	for sha, body := range shared {
+		if len(scripts.bodies) >= MaxScriptRecords {
+			break
+		}
+		if sha == scriptSHA1(body) {
+			scripts.bodies[sha] = body
+		}
+	}
+	return nil
+}
+
+func registerScript(body []byte) string {
+	sha := scriptSHA1(body)
+	scripts.Lock()
+	defer scripts.Unlock()
+	if _, ok := scripts.bodies[sha]; !ok && len(scripts.bodies) < MaxScriptRecords {
+		body = append([]byte{}, body...)
+		scripts.bodies[sha] = body
+		if store := scripts.store; store != nil {
+			go func() {
+				if err := store.UpdateScript(sha, body); err != nil {
+					log.WarnErrorf(err, "store: update script %s failed", sha)
+				}
+			}()
+		}
+	}
+	return sha
+}
+
+func allScripts() [][]byte {
+	scripts.RLock()
+	defer scripts.RUnlock()
+	var all = make([][]byte, 0, len(scripts.bodies))
+	for _, body := range scripts.bodies {
+		all = append(all, body)
+	}
+	return all
+}
+
+func flushScripts() {
+	scripts.Lock()
+	defer scripts.Unlock()
+	scripts.bodies = make(map[string][]byte, 64)
+	if store := scripts.store; store != nil {
+		go func() {
+			shared, err := store.ListScripts()
+			if err != nil {
+				log.WarnErrorf(err, "store: list scripts failed")
+				return
+			}
+			for sha := range shared {
+				if err := store.DeleteScript(sha); err != nil {
+					log.WarnErrorf(err, "store: delete script %s failed", sha)
+				}
+			}
+		}()
+	}
+}
+
+// loadScripts loads all known scripts into the backend, it's used when a
+// new group starts serving slots, e.g. after scaling out.
+func loadScripts(addr string, config *Config) error {
+	var cmds [][]*redis.Resp
+	for _, body := range allScripts() {
+		cmds = append(cmds, []*redis.Resp{
+			redis.NewBulkBytes([]byte("SCRIPT")),
+			redis.NewBulkBytes([]byte("LOAD")),
+			redis.NewBulkBytes(body),
+		})
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+	c, err := dialBackend(addr, 0, config)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	replies, err := doCommands(c, cmds...)
+	if err != nil {
+		return err
+	}
+	for _, resp := range replies {
+		if resp.IsError() {
+			return fmt.Errorf("error resp: %s", resp.Value)
+		}
+	}
+	return nil
+}
+
+// lookupScript returns the body of the script, the store is asked if it's
+// unknown to the proxy, e.g. it's loaded through another proxy.
+func lookupScript(sha []byte) []byte {
+	var key = strings.ToLower(string(sha))
+	scripts.RLock()
+	body, store := scripts.bodies[key], scripts.store
+	scripts.RUnlock()
+	if body != nil || store == nil {
+		return body
+	}
+	body, err := store.LoadScript(key)
+	if err != nil {
+		log.WarnErrorf(err, "store: load script %s failed", key)
+		return nil
+	}
+	if body == nil || scriptSHA1(body) != key {
+		return nil
+	}
+	scripts.Lock()
+	defer scripts.Unlock()
+	if len(scripts.bodies) < MaxScriptRecords {
+		scripts.bodies[key] = body
+	}
+	return body
+}
+
+var noScriptPrefix = []byte("NOSCRIPT")
+
+// handleRequestEval routes scripts and functions by their keys, which must
+// belong to the same slot. Scripts without keys are routed by their first
+// argument, or as if the key were empty if there are no arguments either.
+func (s *Session) handleRequestEval(r *Request, d *Router) error {
+	var nblks = len(r.Multi) - 1
+	if nblks < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", r.OpStr)
+		return nil
+	}
+	var readonly = strings.HasSuffix(r.OpStr, "_RO")
+	switch numkeys, err := redis.Btoi64(r.Multi[2].Value); {
+	case err != nil:
+		r.Resp = redis.NewErrorf("ERR value is not an integer or out of range")
+	case numkeys < 0:
+		r.Resp = redis.NewErrorf("ERR Number of keys can't be negative")
+	case numkeys < 1 && readonly:
+		r.Resp = redis.NewErrorf("ERR '%s' requires at least one key", r.OpStr)
+	case numkeys > int64(nblks-2):
+		r.Resp = redis.NewErrorf("ERR Number of keys can't be greater than number of args")
+	case !d.isSameSlot(r.Multi[3 : 3+numkeys]):
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+	default:
+		switch r.OpStr {
+		case "EVAL", "EVAL_RO":
+			registerScript(r.Multi[1].Value)
+		case "EVALSHA", "EVALSHA_RO":
+			r.Coalesce = func() error {
+				return s.retryNoScript(r, d)
+			}
+		}
+		return d.dispatch(r)
+	}
+	return nil
+}
+
+// retryNoScript resends EVALSHA as EVAL if the script is missing in the
+// backend, and the proxy knows its body.
+func (s *Session) retryNoScript(r *Request, d *Router) error {
+	if r.Err != nil || r.Resp == nil || !r.Resp.IsError() || !bytes.HasPrefix(r.Resp.Value, noScriptPrefix) {
+		return nil
+	}
+	body := lookupScript(r.Multi[1].Value)
+	if body == nil {
+		return nil
+	}
+	var opstr = "EVAL"
+	if r.OpStr == "EVALSHA_RO" {
+		opstr = "EVAL_RO"
+	}
+	sub := r.MakeSubRequest(1)[0]
+	sub.Batch = &sync.WaitGroup{}
+	sub.OpStr = opstr
+	sub.Multi = make([]*redis.Resp, 0, len(r.Multi))
+	sub.Multi = append(sub.Multi,
+		redis.NewBulkBytes([]byte(opstr)),
+		redis.NewBulkBytes(body),
+	)
+	sub.Multi = append(sub.Multi, r.Multi[2:]...)
+	if err := d.dispatch(&sub); err != nil {
+		return err
+	}
+	sub.Batch.Wait()
+	r.Resp, r.Err = sub.Resp, sub.Err
+	return nil
+}
+
+// handleRequestScript sends SCRIPT LOAD/FLUSH/EXISTS to every group, so that
+// EVALSHA works regardless of which group the keys belong to.
+func (s *Session) handleRequestScript(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'SCRIPT' command")
+		return nil
+	}
+	switch sub := strings.ToUpper(string(r.Multi[1].Value)); {
+	case sub == "LOAD" && len(r.Multi) == 3:
+		registerScript(r.Multi[2].Value)
+		return s.broadcastScript(r, d, func(replies []*redis.Resp) *redis.Resp {
+			return replies[0]
+		})
+	case sub == "FLUSH" && len(r.Multi) <= 3:
+		return s.broadcastScript(r, d, func(replies []*redis.Resp) *redis.Resp {
+			flushScripts()
+			return replies[0]
+		})
+	case sub == "EXISTS" && len(r.Multi) >= 3:
+		// A script exists only if it has been loaded into all groups.
+		return s.broadcastScript(r, d, func(replies []*redis.Resp) *redis.Resp {
+			var array = make([]*redis.Resp, len(r.Multi)-2)
+			for i := range array {
+				var exists = true
+				for _, resp := range replies {
+					if !resp.IsArray() || len(resp.Array) != len(array) {
+						return redis.NewErrorf("ERR bad script exists resp: %s", resp.Type)
+					}
+					exists = exists && string(resp.Array[i].Value) == "1"
+				}
+				if exists {
+					array[i] = redis.NewInt([]byte("1"))
+				} else {
+					array[i] = redis.NewInt([]byte("0"))
+				}
+			}
+			return redis.NewArray(array)
+		})
+	default:
+		r.Resp = redis.NewErrorf("ERR SCRIPT subcommand '%s' is not allowed", sub)
+		return nil
+	}
+}
+
+func (s *Session) broadcastScript(r *Request, d *Router, merge func(replies []*redis.Resp) *redis.Resp) error {
+	ids := d.backendSlots()
+	if len(ids) == 0 {
+		return ErrSlotIsNotReady
+	}
+	var sub = r.MakeSubRequest(len(ids))
+	for i := range sub {
+		sub[i].Multi = r.Multi
+		if err := d.dispatchSlot(&sub[i], ids[i]); err != nil {
+			return err
+		}
+	}
+	r.Coalesce = func() error {
+		var replies = make([]*redis.Resp, len(sub))
+		for i := range sub {
+			if err := sub[i].Err; err != nil {
+				return err
+			}
+			switch resp := sub[i].Resp; {
+			case resp == nil:
+				return ErrRespIsRequired
+			case resp.IsError():
+				r.Resp = resp
+				return nil
+			default:
+				replies[i] = resp
+			}
+		}
+		r.Resp = merge(replies)
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	fsclient "pika/codis/v2/pkg/models/fs"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestEvalRouting(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "EVALSHA", "EVALSHA_RO":
+			return redis.NewErrorf("NOSCRIPT No matching script. Please use EVAL.")
+		default:
+			return redis.NewArray(multi)
+		}
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "EVAL", "return 1", "2", "{tag}a", "{tag}b", "arg")
+	assert.Must(resp.IsArray() && len(resp.Array) == 6)
+	assert.Must(handleTestRequest(s, d, "EVAL", "return 1", "0").IsArray())
+	multi := []*redis.Resp{
+		redis.NewBulkBytes([]byte("EVAL")), redis.NewBulkBytes([]byte("return 1")),
+		redis.NewBulkBytes([]byte("0")), redis.NewBulkBytes([]byte("arg")),
+	}
+	assert.Must(string(getHashKey(multi, "EVAL")) == "arg")
+	assert.Must(getHashKey(multi[:3], "EVAL") == nil)
+
+	assert.Must(handleTestRequest(s, d, "EVAL", "return 1", "2", "a", "b").IsError())
+	assert.Must(handleTestRequest(s, d, "EVAL", "return 1", "-1").IsError())
+	assert.Must(handleTestRequest(s, d, "EVAL", "return 1", "3", "a").IsError())
+
+	// The body of an unknown script can't be resent.
+	resp = handleTestRequest(s, d, "EVALSHA", "ffffffffffffffffffffffffffffffffffffffff", "1", "a")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "NOSCRIPT"))
+
+	var sha = scriptSHA1([]byte("return 2"))
+	assert.Must(handleTestRequest(s, d, "EVAL", "return 2", "1", "a").IsArray())
+	resp = handleTestRequest(s, d, "EVALSHA", strings.ToUpper(sha), "1", "a", "arg")
+	assert.Must(resp.IsArray() && len(resp.Array) == 5)
+	assert.Must(string(resp.Array[0].Value) == "EVAL" && string(resp.Array[1].Value) == "return 2")
+	resp = handleTestRequest(s, d, "EVALSHA_RO", sha, "1", "a")
+	assert.Must(resp.IsArray() && string(resp.Array[0].Value) == "EVAL_RO")
+}
+
+func TestScriptLoad(t *testing.T) {
+	var loads atomic2.Int64
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		loads.Incr()
+		return redis.NewBulkBytes([]byte(scriptSHA1(multi[2].Value)))
+	}
+	b1 := newFakeBackend(handler)
+	defer b1.Close()
+	b2 := newFakeBackend(handler)
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "SCRIPT", "LOAD", "return 3")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == scriptSHA1([]byte("return 3")))
+	assert.Must(loads.Int64() == 2)
+	assert.Must(lookupScript(resp.Value) != nil)
+
+	assert.Must(handleTestRequest(s, d, "SCRIPT", "LOAD").IsError())
+	assert.Must(handleTestRequest(s, d, "SCRIPT", "KILL").IsError())
+}
+
+func TestScriptShared(t *testing.T) {
+	c, err := fsclient.New(t.TempDir())
+	assert.MustNoError(err)
+	defer c.Close()
+	store := models.NewStore(c, "test")
+	assert.MustNoError(setScriptStore(store))
+	defer setScriptStore(nil)
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		if strings.ToUpper(string(multi[0].Value)) == "EVALSHA" {
+			return redis.NewErrorf("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return redis.NewArray(multi)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	// The script is loaded through another proxy, which shares it.
+	var sha = scriptSHA1([]byte("return 5"))
+	registerScript([]byte("return 5"))
+	for i := 0; ; i++ {
+		body, err := store.LoadScript(sha)
+		assert.MustNoError(err)
+		if body != nil {
+			break
+		}
+		assert.Must(i < 100)
+		time.Sleep(time.Millisecond * 10)
+	}
+	scripts.Lock()
+	delete(scripts.bodies, sha)
+	scripts.Unlock()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "EVALSHA", sha, "1", "a")
+	assert.Must(resp.IsArray() && string(resp.Array[1].Value) == "return 5")
+}
+
+func TestScriptFlushExists(t *testing.T) {
+	var sha = scriptSHA1([]byte("return 4"))
+	handler := func(exists string) func(multi []*redis.Resp) *redis.Resp {
+		return func(multi []*redis.Resp) *redis.Resp {
+			switch strings.ToUpper(string(multi[1].Value)) {
+			case "EXISTS":
+				var array []*redis.Resp
+				for _, m := range multi[2:] {
+					if string(m.Value) == sha {
+						array = append(array, redis.NewInt([]byte(exists)))
+					} else {
+						array = append(array, redis.NewInt([]byte("0")))
+					}
+				}
+				return redis.NewArray(array)
+			default:
+				return redis.NewString([]byte("OK"))
+			}
+		}
+	}
+	b1 := newFakeBackend(handler("1"))
+	defer b1.Close()
+	b2 := newFakeBackend(handler("0"))
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "SCRIPT", "EXISTS", sha, "ffff")
+	assert.Must(resp.IsArray() && len(resp.Array) == 2)
+	assert.Must(string(resp.Array[0].Value) == "0" && string(resp.Array[1].Value) == "0")
+
+	d2 := newTestRouter(b1.Addr())
+	defer d2.Close()
+	resp = handleTestRequest(s, d2, "SCRIPT", "EXISTS", sha)
+	assert.Must(resp.IsArray() && string(resp.Array[0].Value) == "1")
+
+	registerScript([]byte("return 4"))
+	assert.Must(handleTestRequest(s, d, "SCRIPT", "FLUSH", "ASYNC").IsString())
+	assert.Must(lookupScript([]byte(sha)) == nil)
+}
+
+func TestScriptSyncOnScaleOut(t *testing.T) {
+	b1 := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewString([]byte("OK"))
+	})
+	defer b1.Close()
+
+	var loaded = make(chan string, 16)
+	b2 := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		if len(multi) == 3 && strings.ToUpper(string(multi[1].Value)) == "LOAD" {
+			loaded <- string(multi[2].Value)
+		}
+		return redis.NewString([]byte("OK"))
+	})
+	defer b2.Close()
+
+	p, _ := openProxy()
+	defer p.Close()
+
+	var slots []*models.Slot
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		slots = append(slots, &models.Slot{Id: i, BackendAddr: b1.Addr()})
+	}
+	assert.MustNoError(p.FillSlots(slots))
+
+	registerScript([]byte("return 5"))
+	assert.MustNoError(p.FillSlot(&models.Slot{Id: 0, BackendAddr: b2.Addr()}))
+
+	for {
+		select {
+		case body := <-loaded:
+			if body == "return 5" {
+				return
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("scripts are not loaded into the new group")
+		}
+	}
+}
+
+func TestFunction(t *testing.T) {
+	var loads atomic2.Int64
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "FUNCTION":
+			if strings.ToUpper(string(multi[1].Value)) == "LOAD" {
+				loads.Incr()
+				return redis.NewBulkBytes([]byte(libraryName(multi[len(multi)-1].Value)))
+			}
+			return redis.NewString([]byte("OK"))
+		default:
+			return redis.NewArray(multi)
+		}
+	}
+	b1 := newFakeBackend(handler)
+	defer b1.Close()
+	b2 := newFakeBackend(handler)
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	var code = "#!lua name=mylib\nredis.register_function('f', function() return 1 end)"
+	assert.Must(libraryName([]byte(code)) == "mylib")
+	assert.Must(libraryName([]byte("return 1")) == "")
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "FUNCTION", "LOAD", "REPLACE", code)
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "mylib")
+	assert.Must(loads.Int64() == 2)
+	assert.Must(len(allLibraries()) == 1)
+
+	resp = handleTestRequest(s, d, "FCALL", "f", "2", "{tag}a", "{tag}b", "arg")
+	assert.Must(resp.IsArray() && len(resp.Array) == 6)
+	assert.Must(handleTestRequest(s, d, "FCALL", "f", "2", "a", "b").IsError())
+	assert.Must(handleTestRequest(s, d, "FCALL_RO", "f", "0").IsError())
+
+	assert.Must(handleTestRequest(s, d, "FUNCTION", "DELETE", "mylib").IsString())
+	assert.Must(len(allLibraries()) == 0)
+	assert.Must(handleTestRequest(s, d, "FUNCTION", "RESTORE", "x").IsError())
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/secret"
+)
+
+// setupSecrets replaces the secret settings referring to Vault, files or
+// environment variables with the secrets, and refreshes them until closed.
+func (p *Proxy) setupSecrets(config *Config) error {
+	var vault *secret.Vault
+	if config.VaultAddr != "" {
+		v, err := secret.NewVault(config.VaultAddr, config.VaultTokenFile, config.VaultNamespace, config.VaultCAFile)
+		if err != nil {
+			return err
+		}
+		vault = v
+	}
+	m := secret.NewManager(vault)
+	p.secrets = m
+
+	for _, s := range []struct {
+		name    string
+		setting *string
+		file    bool
+	}{
+		{"product_auth", &config.ProductAuth, false},
+		{"session_auth", &config.SessionAuth, false},
+		{"admin_token_secret", &config.AdminTokenSecret, false},
+		{"jodis_auth", &config.JodisAuth, false},
+		{"metrics_report_influxdb_password", &config.MetricsReportInfluxdbPassword, false},
+		{"admin_tls_cert_file", &config.AdminTLSCertFile, true},
+		{"admin_tls_key_file", &config.AdminTLSKeyFile, true},
+		{"admin_tls_ca_file", &config.AdminTLSCAFile, true},
+		{"proxy_tls_cert_file", &config.ProxyTLSCertFile, true},
+		{"proxy_tls_key_file", &config.ProxyTLSKeyFile, true},
+		{"proxy_tls_ca_file", &config.ProxyTLSCAFile, true},
+		{"backend_tls_cert_file", &config.BackendTLSCertFile, true},
+		{"backend_tls_key_file", &config.BackendTLSKeyFile, true},
+		{"backend_tls_ca_file", &config.BackendTLSCAFile, true},
+	} {
+		if err := m.Bind(s.name, s.setting, s.file); err != nil {
+			return err
+		}
+	}
+
+	m.Start(config.SecretRefreshPeriod.Duration(), func(name, value string) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		switch name {
+		case "product_auth":
+			p.config.setProductAuth(value)
+			p.xauths = append(p.xauths, rpc.NewXAuth(p.config.ProductName, value, p.model.Token))
+		case "session_auth":
+			p.config.setSessionAuth(value)
+		case "admin_token_secret":
+			if err := rpc.SetupToken(value, "codis-proxy"); err != nil {
+				log.WarnErrorf(err, "[%p] apply %s failed", p, name)
+				return
+			}
+		default:
+			log.Warnf("[%p] %s is changed, restart codis-proxy to apply", p, name)
+			return
+		}
+		log.Warnf("[%p] %s is changed and applied", p, name)
+	})
+	return nil
+}
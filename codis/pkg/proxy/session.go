@@ -4,6 +4,7 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"pika/codis/v2/pkg/models"
@@ -52,17 +54,76 @@ type Session struct {
 	rand *rand.Rand
 
 	authorized bool
+	authcmds   int64
+
+	// user is the ACL user authenticated by AUTH or HELLO, or empty for the
+	// default user.
+	user string
+
+	// quota is the quota of the user the session is counted in.
+	quota *quotaState
+
+	output outputBuffer
+
+	// deadline is the time of requests to wait for replies, as set by CLIENT
+	// DEADLINE, or zero if they wait until the backends reply.
+	deadline time.Duration
+
+	// tracking is the state of CLIENT TRACKING, or nil if it's off. It's set
+	// by the session only, with the lock of tracking held.
+	tracking *trackingState
+
+	// priority is the ACL priority of the user as of authentication, read by
+	// the max clients policy of other sessions.
+	priority atomic2.Int64
+	evicted  bool
+
+	id    int64
+	proto int
+
+	// client is the name, the library set by CLIENT SETINFO and the last
+	// command of the session, read by CLIENT LIST of other sessions.
+	client struct {
+		sync.Mutex
+		name, cmd       string
+		libName, libVer string
+	}
+
+	tasks  *RequestChan
+	pubsub *pubsubState
+	txn    txnState
+
+	blocking blockState
+
+	// readonly or readwrite is set by READONLY or READWRITE, otherwise reads
+	// follow session_replica_read.
+	readonly, readwrite bool
+
+	writes *recentWrites
+
+	flush struct {
+		token  string
+		expire time.Time
+	}
 }
 
+var sessionId atomic2.Int64
+
 func (s *Session) String() string {
+	s.client.Lock()
+	var name, libName, libVer = s.client.name, s.client.libName, s.client.libVer
+	s.client.Unlock()
 	o := &struct {
 		Ops        int64  `json:"ops"`
 		CreateUnix int64  `json:"create"`
 		LastOpUnix int64  `json:"lastop,omitempty"`
 		RemoteAddr string `json:"remote"`
+		Name       string `json:"name,omitempty"`
+		LibName    string `json:"lib_name,omitempty"`
+		LibVer     string `json:"lib_ver,omitempty"`
 	}{
-		s.Ops, s.CreateUnix, s.LastOpUnix,
-		s.Conn.RemoteAddr(),
+		atomic.LoadInt64(&s.Ops), s.CreateUnix, atomic.LoadInt64(&s.LastOpUnix),
+		s.Conn.RemoteAddr(), name, libName, libVer,
 	}
 	b, _ := json.Marshal(o)
 	return string(b)
@@ -80,19 +141,28 @@ func NewSession(sock net.Conn, config *Config, proxy *Proxy) *Session {
 	s := &Session{
 		Conn: c, config: config, proxy: proxy,
 		CreateUnix: time.Now().Unix(),
+		id:         sessionId.Incr(),
+		proto:      2,
+		writes:     newRecentWrites(config.SessionReadYourWrites.Duration()),
 	}
 	s.stats.opmap = make(map[string]*opStats, 16)
 	s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
-	log.Infof("session [%p] create: %s", s, s)
+	s.logger().Infof("session [%p] create: %s", s, s)
 	return s
 }
 
+// logger attaches the session id to the lines, so that they can be grouped
+// by session once encoded as JSON.
+func (s *Session) logger() *log.Entry {
+	return log.With(log.Fields{"session": s.id})
+}
+
 func (s *Session) CloseReaderWithError(err error) error {
 	s.exit.Do(func() {
 		if err != nil {
-			log.Infof("session [%p] closed: %s, error: %s", s, s, err)
+			s.logger().Infof("session [%p] closed: %s, error: %s", s, s, err)
 		} else {
-			log.Infof("session [%p] closed: %s, quit", s, s)
+			s.logger().Infof("session [%p] closed: %s, quit", s, s)
 		}
 	})
 	return s.Conn.CloseReader()
@@ -101,9 +171,9 @@ func (s *Session) CloseReaderWithError(err error) error {
 func (s *Session) CloseWithError(err error) error {
 	s.exit.Do(func() {
 		if err != nil {
-			log.Infof("session [%p] closed: %s, error: %s", s, s, err)
+			s.logger().Infof("session [%p] closed: %s, error: %s", s, s, err)
 		} else {
-			log.Infof("session [%p] closed: %s, quit", s, s)
+			s.logger().Infof("session [%p] closed: %s, quit", s, s)
 		}
 	})
 	s.broken.Set(true)
@@ -120,14 +190,16 @@ var RespOK = redis.NewString([]byte("OK"))
 
 func (s *Session) Start(d *Router) {
 	s.start.Do(func() {
-		if int(incrSessions()) > s.config.ProxyMaxClients {
+		tasks := NewRequestChanBuffer(1024)
+		s.tasks = tasks
+
+		if !s.admit() {
 			go func() {
 				s.Conn.Encode(redis.NewErrorf("ERR max number of clients reached"), true)
 				s.CloseWithError(ErrTooManySessions)
 				s.incrOpFails(nil, nil)
 				s.flushOpStats(true)
 			}()
-			decrSessions()
 			return
 		}
 
@@ -138,19 +210,23 @@ func (s *Session) Start(d *Router) {
 				s.incrOpFails(nil, nil)
 				s.flushOpStats(true)
 			}()
-			decrSessions()
+			s.leave()
 			return
 		}
 
-		tasks := NewRequestChanBuffer(1024)
-
 		go func() {
 			s.loopWriter(tasks)
-			decrSessions()
+			s.leave()
 		}()
 
 		go func() {
 			s.loopReader(tasks, d)
+			s.unbindQuota()
+			s.closePubSub()
+			s.untrackAll()
+			s.stopMonitor()
+			s.txn.closeConn()
+			s.blocking.close()
 			tasks.Close()
 		}()
 	})
@@ -167,6 +243,7 @@ func (s *Session) loopReader(tasks *RequestChan, d *Router) (err error) {
 	)
 
 	for !s.quit {
+		s.waitOutput(false)
 		multi, err := s.Conn.DecodeMultiBulk()
 		if err != nil {
 			return err
@@ -182,17 +259,29 @@ func (s *Session) loopReader(tasks *RequestChan, d *Router) (err error) {
 		}
 
 		start := time.Now()
-		s.LastOpUnix = start.Unix()
-		s.Ops++
+		atomic.StoreInt64(&s.LastOpUnix, start.Unix())
+		atomic.AddInt64(&s.Ops, 1)
 
 		r := &Request{}
 		r.Multi = multi
 		r.Batch = &sync.WaitGroup{}
 		r.Database = s.database
+		r.ReplicaRead = s.isReplicaRead()
+		r.MasterRead = s.readwrite
+		r.Writes = s.writes
 		r.ReceiveTime = start.UnixNano()
 		r.TasksLen = int64(tasksLen)
+		r.trace = sampleTrace()
+		if s.deadline != 0 {
+			r.Deadline = start.Add(s.deadline).UnixNano()
+		}
+		if s.output.limit(false).enabled() {
+			r.session = s
+		}
 
-		if err := s.handleRequest(r, d); err != nil {
+		err = s.handleRequest(r, d)
+		s.setLastCmd(r.OpStr)
+		if err != nil {
 			r.Resp = redis.NewErrorf("ERR handle request, %s", err)
 			tasks.PushBack(r)
 			if breakOnFailure {
@@ -209,6 +298,9 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 	defer func() {
 		s.CloseWithError(err)
 		tasks.PopFrontAllVoid(func(r *Request) {
+			r.releaseQuota(nil)
+			r.releaseInflight()
+			s.releaseOutput(r)
 			s.incrOpFails(r, nil)
 		})
 		s.flushOpStats(true)
@@ -224,7 +316,18 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 	p.MaxBuffered = maxPipelineLen / 2
 
 	return tasks.PopFrontAll(func(r *Request) error {
+		if r.Multi == nil {
+			// Messages pushed from pubsub connections.
+			s.releaseOutput(r)
+			if err := p.Encode(r.Resp); err != nil {
+				return err
+			}
+			return p.Flush(tasks.IsEmpty())
+		}
 		resp, err := s.handleResponse(r)
+		r.releaseQuota(resp)
+		r.releaseInflight()
+		s.releaseOutput(r)
 		if err != nil {
 			resp = redis.NewErrorf("ERR handle response, %s", err)
 			if breakOnFailure {
@@ -235,12 +338,20 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 		if err := p.Encode(resp); err != nil {
 			return s.incrOpFails(r, err)
 		}
+		for _, x := range r.Replies {
+			if err := p.Encode(x); err != nil {
+				return s.incrOpFails(r, err)
+			}
+		}
 		fflush := tasks.IsEmpty()
 		if err := p.Flush(fflush); err != nil {
 			return s.incrOpFails(r, err)
 		} else {
 			s.incrOpStats(r, resp.Type)
 		}
+		if r.trace != nil {
+			s.finishTrace(r, resp.IsError())
+		}
 
 		nowTime := time.Now().UnixNano()
 		duration := int64((nowTime - r.ReceiveTime) / 1e3)
@@ -248,6 +359,11 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 		if fflush {
 			s.flushOpStats(false)
 		}
+		if threshold := s.config.LatencyMonitorThreshold; threshold > 0 {
+			if ms := duration / 1e3; ms >= threshold {
+				recordLatency(r.OpStr, nowTime/1e9, ms)
+			}
+		}
 		if s.config.SlowlogLogSlowerThan >= 0 {
 			if duration >= s.config.SlowlogLogSlowerThan {
 				SlowCmdCount.Incr()
@@ -266,8 +382,19 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 				if r.ReceiveFromServerTime > 0 {
 					d2 = int64((nowTime - r.ReceiveFromServerTime) / 1e3)
 				}
-				index := getWholeCmd(r.Multi, cmd)
-				log.Errorf("%s remote:%s, start_time(us):%d, duration(us): [%d, %d, %d], %d, tasksLen:%d, command:[%s].",
+				multi := redactArgs(r.OpStr, r.Multi)
+				recordSlowlog(multi, &SlowlogEntry{
+					UnixTime: r.ReceiveTime / 1e9, Duration: duration,
+					RemoteAddr: s.Conn.RemoteAddr(), ClientName: s.getName(),
+					Backend:    r.backend,
+					QueueUsecs: d0, RttUsecs: d1, ReplyUsecs: d2,
+				})
+				index := getWholeCmd(multi, cmd)
+				var logger = s.logger().With(log.Fields{"cmd": r.OpStr})
+				if r.slotStats != nil {
+					logger = logger.With(log.Fields{"slot": r.slot})
+				}
+				logger.Errorf("%s remote:%s, start_time(us):%d, duration(us): [%d, %d, %d], %d, tasksLen:%d, command:[%s].",
 					time.Unix(r.ReceiveTime/1e9, 0).Format("2006-01-02 15:04:05"), s.Conn.RemoteAddr(), r.ReceiveTime/1e3, d0, d1, d2, duration, r.TasksLen, string(cmd[:index]))
 			}
 		}
@@ -276,7 +403,9 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 }
 
 func (s *Session) handleResponse(r *Request) (*redis.Resp, error) {
-	r.Batch.Wait()
+	if !r.waitResponse() {
+		return redis.NewErrorf("TIMEOUT deadline of request exceeded"), nil
+	}
 	if r.Coalesce != nil {
 		if err := r.Coalesce(); err != nil {
 			return nil, err
@@ -287,6 +416,18 @@ func (s *Session) handleResponse(r *Request) (*redis.Resp, error) {
 	} else if r.Resp == nil {
 		return nil, ErrRespIsRequired
 	}
+	if ns := r.Namespace; ns != "" {
+		stripNamespaceReply(ns, r.OpStr, r.Resp)
+		for _, x := range r.Replies {
+			stripNamespaceReply(ns, r.OpStr, x)
+		}
+	}
+	switch {
+	case r.OpFlag.IsRespReturnSingleValue():
+		checkBigValue(r)
+	case r.OpFlag.IsRespReturnArray():
+		checkBigArray(r)
+	}
 	return r.Resp, nil
 }
 
@@ -299,6 +440,10 @@ func (s *Session) handleRequest(r *Request, d *Router) error {
 	r.OpFlag = flag
 	r.Broken = &s.broken
 
+	if flag.IsAlias() {
+		r.Multi[0] = redis.NewBulkBytes([]byte(opstr))
+	}
+
 	if flag.IsNotAllowed() {
 		return fmt.Errorf("command '%s' is not allowed", opstr)
 	}
@@ -308,19 +453,132 @@ func (s *Session) handleRequest(r *Request, d *Router) error {
 		return s.handleQuit(r)
 	case "AUTH":
 		return s.handleAuth(r)
+	case "HELLO":
+		return s.handleHello(r, d)
 	case "CODIS.INFO":
 		return s.handleCodisInfo(r)
 	}
 
+	var user = s.aclUser()
+	if user == nil || !user.enabled {
+		s.authorized, s.user = false, ""
+		s.priority.Set(0)
+		user = s.aclUser()
+	}
 	if !s.authorized {
-		if s.config.SessionAuth != "" {
+		if !user.enabled || !user.nopass {
 			r.Resp = redis.NewErrorf("NOAUTH Authentication required")
 			return nil
 		}
 		s.authorized = true
 	}
 
+	if n := s.config.SessionAuthMaxCommands; n > 0 && !user.nopass {
+		if s.authcmds++; s.authcmds >= n {
+			s.authorized, s.authcmds = false, 0
+		}
+	}
+
+	if resp := user.check(r); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	if resp := checkBigRequest(r); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	if resp := checkBatchLimit(r); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	if resp := r.acquireInflight(); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	if resp := checkQPSLimit(); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	if resp := checkCmdRateLimit(opstr); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	if resp := s.bindQuota(user.name); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	if resp := s.quota.acquire(r); resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	s.auditRequest(r, user.name)
+	feedMonitors(s, r)
+
+	if user.namespace != "" {
+		if resp := applyNamespace(r, user.namespace); resp != nil {
+			r.Resp = resp
+			return nil
+		}
+	}
+
+	if s.proto == 2 && s.subscriptions() != 0 {
+		switch opstr {
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		case "PING":
+			var msg []byte
+			if len(r.Multi) > 1 {
+				msg = r.Multi[1].Value
+			}
+			r.Resp = redis.NewArray([]*redis.Resp{
+				redis.NewBulkBytes([]byte("pong")),
+				redis.NewBulkBytes(append([]byte{}, msg...)),
+			})
+			return nil
+		default:
+			r.Resp = redis.NewErrorf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(opstr))
+			return nil
+		}
+	}
+
+	if opstr == "CLIENT" {
+		return s.handleClient(r)
+	}
+	waitClientPause(r)
+
+	if s.txn.multi {
+		switch opstr {
+		case "MULTI", "EXEC", "DISCARD", "WATCH":
+		default:
+			return s.handleTxnQueued(r, d)
+		}
+	}
+
+	switch {
+	case opstr == "FLUSHALL" || opstr == "FLUSHDB" || opstr == "SWAPDB":
+		clearHotCache()
+		flushTracking()
+		defer setHotCacheInvalidate(r, clearHotCache)
+	case opstr == "EXEC":
+		var db, queued = r.Database, append([][]*redis.Resp{}, s.txn.queued...)
+		invalidateHotCache(db, queued...)
+		invalidateTracking(s, db, queued...)
+		defer setHotCacheInvalidate(r, func() {
+			invalidateHotCache(db, queued...)
+		})
+	case !flag.IsReadOnly():
+		var db, multi = r.Database, r.Multi
+		invalidateHotCache(db, multi)
+		invalidateTracking(s, db, multi)
+		defer setHotCacheInvalidate(r, func() {
+			invalidateHotCache(db, multi)
+		})
+	default:
+		s.trackRead(r)
+	}
+
 	switch opstr {
+	case "ACL":
+		return s.handleACL(r)
 	case "SELECT":
 		return s.handleSelect(r)
 	case "PING":
@@ -331,11 +589,59 @@ func (s *Session) handleRequest(r *Request, d *Router) error {
 		return s.handleRequestMGet(r, d)
 	case "MSET":
 		return s.handleRequestMSet(r, d)
+	case "MSETNX":
+		return s.handleRequestMSetNX(r, d)
+	case "CLUSTER", "ASKING":
+		return s.handleRequestCluster(r, d)
+	case "READONLY", "READWRITE":
+		return s.handleReadMode(r)
 	case "DEL":
 		return s.handleRequestDel(r, d)
 	case "EXISTS":
 		return s.handleRequestExists(r, d)
-	case "PCONFIG":
+	case "RANDOMKEY":
+		return s.handleRequestRandomKey(r, d)
+	case "DEBUG":
+		return s.handleRequestDebug(r, d)
+	case "BITFIELD_RO":
+		return s.handleRequestBitFieldRO(r, d)
+	case "SORT_RO":
+		return s.handleRequestSortRO(r, d)
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO":
+		return s.handleRequestEval(r, d)
+	case "SCRIPT":
+		return s.handleRequestScript(r, d)
+	case "FUNCTION":
+		return s.handleRequestFunction(r, d)
+	case "BLPOP", "BRPOP", "BRPOPLPUSH", "BLMOVE", "BLMPOP", "BZPOPMIN", "BZPOPMAX", "BZMPOP":
+		return s.handleRequestBlocking(r, d)
+	case "SCAN":
+		return s.handleRequestScan(r, d)
+	case "KEYS":
+		return s.handleRequestKeys(r, d)
+	case "DBSIZE":
+		return s.handleRequestDBSize(r, d)
+	case "FLUSHALL", "FLUSHDB":
+		return s.handleRequestFlush(r, d)
+	case "XREAD", "XREADGROUP":
+		return s.handleRequestXRead(r, d)
+	case "COPY", "GEOSEARCHSTORE", "LMOVE", "RPOPLPUSH":
+		return s.handleRequestSrcDst(r, d)
+	case "LMPOP", "ZMPOP", "SINTERCARD":
+		return s.handleRequestNumKeys(r, d)
+	case "OBJECT":
+		return s.handleRequestObject(r, d)
+	case "SDIFF", "SINTER", "SUNION":
+		return s.handleRequestSetAlgebra(r, d)
+	case "ZINTERSTORE", "ZUNIONSTORE":
+		return s.handleRequestZStore(r, d)
+	case "RENAME", "RENAMENX":
+		return s.handleRequestRename(r, d)
+	case "SMOVE":
+		return s.handleRequestSMove(r, d)
+	case "BITOP":
+		return s.handleRequestBitOp(r, d)
+	case "PCONFIG", "XCONFIG":
 		return s.handlePConfig(r)
 	case "SLOTSINFO":
 		return s.handleRequestSlotsInfo(r, d)
@@ -343,11 +649,98 @@ func (s *Session) handleRequest(r *Request, d *Router) error {
 		return s.handleRequestSlotsScan(r, d)
 	case "SLOTSMAPPING":
 		return s.handleRequestSlotsMapping(r, d)
+	case "XMONITOR":
+		return s.handleXMonitor(r)
+	case "MONITOR":
+		return s.handleMonitor(r)
+	case "SLOWLOG":
+		return s.handleSlowlog(r)
+	case "XSLOWLOG":
+		return s.handleXSlowlog(r)
+	case "MULTI":
+		return s.handleMulti(r)
+	case "EXEC":
+		return s.handleExec(r, d)
+	case "DISCARD":
+		return s.handleDiscard(r)
+	case "WATCH":
+		return s.handleWatch(r, d)
+	case "UNWATCH":
+		return s.handleUnwatch(r)
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		return s.handleSubscribe(r, d)
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return s.handleUnsubscribe(r)
+	case "LATENCY":
+		return s.handleLatency(r)
 	default:
-		return d.dispatch(r)
+		if flag&FlagMayWrite != 0 && !isKnownOp(opstr) {
+			incrUnknownCmd(opstr)
+		}
+		return s.dispatchDefault(r, d)
 	}
 }
 
+// dispatchDefault dispatches the request, unless it's answered by the caches
+// of the proxy, or collapsed into the same request in flight.
+func (s *Session) dispatchDefault(r *Request, d *Router) error {
+	var resp, fill = lookupHotCache(r)
+	if resp == nil && fill == nil {
+		resp, fill = lookupNegativeCache(r)
+	}
+	if resp != nil {
+		r.Resp = resp
+		return nil
+	}
+	var err error
+	if s.config.BackendRetryMax > 0 && r.IsReadOnly() {
+		err = s.dispatchRetry(r, d)
+	} else {
+		joined, leader := joinFlight(r, d)
+		if !joined {
+			err = d.dispatch(r)
+		}
+		switch {
+		case leader && err != nil:
+			r.leaveFlight()
+		case leader:
+			setFlightLeave(r)
+		}
+	}
+	if fill != nil {
+		setHotCacheFill(r, fill)
+	}
+	return err
+}
+
+const (
+	ReplicaReadAlways = "always"
+	ReplicaReadOnly   = "readonly"
+)
+
+func (s *Session) handleReadMode(r *Request) error {
+	if len(r.Multi) != 1 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", strings.ToLower(r.OpStr))
+		return nil
+	}
+	s.readonly = r.OpStr == "READONLY"
+	s.readwrite = !s.readonly
+	r.Resp = RespOK
+	return nil
+}
+
+// isReplicaRead returns whether read-only commands of the session may be sent
+// to the replica groups.
+func (s *Session) isReplicaRead() bool {
+	switch {
+	case s.readonly:
+		return true
+	case s.readwrite:
+		return false
+	}
+	return s.config.SessionReplicaRead != ReplicaReadOnly
+}
+
 func (s *Session) handleQuit(r *Request) error {
 	s.quit = true
 	r.Resp = RespOK
@@ -355,23 +748,122 @@ func (s *Session) handleQuit(r *Request) error {
 }
 
 func (s *Session) handleAuth(r *Request) error {
-	if len(r.Multi) != 2 {
+	var name, pass string
+	switch len(r.Multi) {
+	case 2:
+		name, pass = "default", string(r.Multi[1].Value)
+	case 3:
+		name, pass = string(r.Multi[1].Value), string(r.Multi[2].Value)
+	default:
 		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'AUTH' command")
 		return nil
 	}
+	var user = getACLUser(name, s.config)
 	switch {
-	case s.config.SessionAuth == "":
+	case len(r.Multi) == 2 && user.enabled && user.nopass:
 		r.Resp = redis.NewErrorf("ERR Client sent AUTH, but no password is set")
-	case s.config.SessionAuth != string(r.Multi[1].Value):
+	case user == nil || !user.checkPassword(pass):
 		s.authorized = false
-		r.Resp = redis.NewErrorf("ERR invalid password")
+		r.Resp = redis.NewErrorf("WRONGPASS invalid username-password pair or user is disabled.")
 	default:
-		s.authorized = true
+		if resp := s.bindQuota(name); resp != nil {
+			r.Resp = resp
+			return nil
+		}
+		s.authorized, s.authcmds, s.user = true, 0, name
+		s.priority.Set(user.priority)
 		r.Resp = RespOK
 	}
 	return nil
 }
 
+// handleHello negotiates the protocol of the session. With RESP3, only the
+// replies made by the proxy, e.g. HELLO and pushes of pubsub and tracking,
+// are in RESP3 types, since backends are always connected by RESP2, and their
+// replies are forwarded as they are, e.g. HGETALL still replies an array. The
+// role is replica if the reads of the session are sent to replicas.
+func (s *Session) handleHello(r *Request, d *Router) error {
+	var proto = s.proto
+	var args = r.Multi[1:]
+	if len(args) != 0 {
+		switch v, err := redis.Btoi64(args[0].Value); {
+		case err != nil:
+			r.Resp = redis.NewErrorf("ERR Protocol version is not an integer or out of range")
+			return nil
+		case v != 2 && v != 3:
+			r.Resp = redis.NewErrorf("NOPROTO unsupported protocol version")
+			return nil
+		default:
+			proto = int(v)
+		}
+		args = args[1:]
+	}
+
+	var auth, name []byte
+	var user = []byte("default")
+	for len(args) != 0 {
+		switch opt := strings.ToUpper(string(args[0].Value)); {
+		case opt == "AUTH" && len(args) >= 3:
+			user, auth = args[1].Value, args[2].Value
+			args = args[3:]
+		case opt == "SETNAME" && len(args) >= 2:
+			name = args[1].Value
+			args = args[2:]
+		default:
+			r.Resp = redis.NewErrorf("ERR Syntax error in HELLO option '%s'", args[0].Value)
+			return nil
+		}
+	}
+
+	switch {
+	case auth != nil:
+		u := getACLUser(string(user), s.config)
+		if u == nil || !u.checkPassword(string(auth)) {
+			s.authorized = false
+			r.Resp = redis.NewErrorf("WRONGPASS invalid username-password pair or user is disabled.")
+			return nil
+		}
+		if resp := s.bindQuota(string(user)); resp != nil {
+			r.Resp = resp
+			return nil
+		}
+		s.authorized, s.authcmds, s.user = true, 0, string(user)
+		s.priority.Set(u.priority)
+	case !s.authorized && !s.isNoPass():
+		r.Resp = redis.NewErrorf("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return nil
+	}
+	if name != nil {
+		s.setName(string(name))
+	}
+	s.proto = proto
+
+	var info = []*redis.Resp{
+		redis.NewBulkBytes([]byte("server")), redis.NewBulkBytes([]byte("codis-proxy")),
+		redis.NewBulkBytes([]byte("version")), redis.NewBulkBytes([]byte(utils.Version)),
+		redis.NewBulkBytes([]byte("proto")), redis.NewInt(strconv.AppendInt(nil, int64(s.proto), 10)),
+		redis.NewBulkBytes([]byte("id")), redis.NewInt(strconv.AppendInt(nil, s.id, 10)),
+		redis.NewBulkBytes([]byte("mode")), redis.NewBulkBytes([]byte("standalone")),
+		redis.NewBulkBytes([]byte("role")), redis.NewBulkBytes([]byte(s.role(d))),
+		redis.NewBulkBytes([]byte("modules")), redis.NewArray([]*redis.Resp{}),
+	}
+	if s.proto == 3 {
+		r.Resp = redis.NewMap(info)
+	} else {
+		r.Resp = redis.NewArray(info)
+	}
+	return nil
+}
+
+// role returns replica if the reads of the session are sent to replicas,
+// or otherwise master.
+func (s *Session) role(d *Router) string {
+	if d != nil && s.isReplicaRead() && d.hasReplicaGroups() {
+		return "replica"
+	}
+	return "master"
+}
+
 func (s *Session) handleCodisInfo(r *Request) error {
 	if len(r.Multi) != 0 {
 		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'CODIS.INFO' command")
@@ -409,7 +901,7 @@ func (s *Session) handleRequestPing(r *Request, d *Router) error {
 	var addr string
 	var nblks = len(r.Multi) - 1
 	switch {
-	case nblks == 0:
+	case nblks == 0 || (nblks == 1 && bytes.IndexByte(r.Multi[1].Value, ':') < 0):
 		slot := uint32(time.Now().Nanosecond()) % uint32(models.GetMaxSlotNum())
 		return d.dispatchSlot(r, int(slot))
 	default:
@@ -428,9 +920,8 @@ func (s *Session) handleRequestInfo(r *Request, d *Router) error {
 	var addr string
 	var nblks = len(r.Multi) - 1
 	switch {
-	case nblks == 0:
-		slot := uint32(time.Now().Nanosecond()) % uint32(models.GetMaxSlotNum())
-		return d.dispatchSlot(r, int(slot))
+	case nblks == 0 || (nblks == 1 && bytes.IndexByte(r.Multi[1].Value, ':') < 0):
+		return s.handleRequestMergedInfo(r, d)
 	default:
 		addr = string(r.Multi[1].Value)
 		copy(r.Multi[1:], r.Multi[2:])
@@ -443,6 +934,333 @@ func (s *Session) handleRequestInfo(r *Request, d *Router) error {
 	return nil
 }
 
+// handleRequestRandomKey replies RANDOMKEY of a group chosen randomly,
+// weighted by the number of keys reported by DBSIZE, so that every key has
+// about the same chance. Both DBSIZE and RANDOMKEY are sent to all groups in
+// parallel, so Coalesce only picks one of the replies without waiting.
+func (s *Session) handleRequestRandomKey(r *Request, d *Router) error {
+	if len(r.Multi) != 1 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'RANDOMKEY' command")
+		return nil
+	}
+	ids := d.backendSlots()
+	if len(ids) == 0 {
+		return ErrSlotIsNotReady
+	}
+	var sub = r.MakeSubRequest(len(ids) * 2)
+	var keys = sub[len(ids):]
+	for i := range ids {
+		sub[i].Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte("DBSIZE")),
+		}
+		if err := d.dispatchSlot(&sub[i], ids[i]); err != nil {
+			return err
+		}
+		keys[i].Multi = r.Multi
+		if err := d.dispatchSlot(&keys[i], ids[i]); err != nil {
+			return err
+		}
+	}
+	r.Coalesce = func() error {
+		var total int64
+		var sizes = make([]int64, len(ids))
+		for i := range ids {
+			if err := sub[i].Err; err != nil {
+				return err
+			}
+			switch resp := sub[i].Resp; {
+			case resp == nil:
+				return ErrRespIsRequired
+			case resp.IsError():
+				r.Resp = resp
+				return nil
+			default:
+				n, err := redis.Btoi64(resp.Value)
+				if err != nil || n < 0 {
+					r.Resp = redis.NewErrorf("ERR bad dbsize resp: %s", resp.Value)
+					return nil
+				}
+				sizes[i] = n
+				total += n
+			}
+		}
+		if total == 0 {
+			r.Resp = redis.NewBulkBytes(nil)
+			return nil
+		}
+		var x = s.rand.Int63n(total)
+		var i = 0
+		for x -= sizes[i]; x >= 0; x -= sizes[i] {
+			i++
+		}
+		// Try the other groups with keys if the keys of the chosen one are
+		// deleted after DBSIZE.
+		for j := range ids {
+			k := (i + j) % len(ids)
+			if sizes[k] == 0 {
+				continue
+			}
+			if err := keys[k].Err; err != nil {
+				return err
+			}
+			switch resp := keys[k].Resp; {
+			case resp == nil:
+				return ErrRespIsRequired
+			case resp.IsBulkBytes() && resp.Value == nil:
+				continue
+			default:
+				r.Resp = resp
+				return nil
+			}
+		}
+		r.Resp = redis.NewBulkBytes(nil)
+		return nil
+	}
+	return nil
+}
+
+// handleRequestDBSize sums the number of keys of all groups. DBSIZE GROUPS
+// replies the number of each group as [group_id, addr, dbsize] instead.
+func (s *Session) handleRequestDBSize(r *Request, d *Router) error {
+	var detail bool
+	switch {
+	case len(r.Multi) == 2 && strings.ToUpper(string(r.Multi[1].Value)) == "GROUPS":
+		detail = true
+	case len(r.Multi) != 1:
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'DBSIZE' command")
+		return nil
+	}
+	ids := d.backendSlots()
+	if len(ids) == 0 {
+		return ErrSlotIsNotReady
+	}
+	var sub = r.MakeSubRequest(len(ids))
+	for i := range sub {
+		sub[i].Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte("DBSIZE")),
+		}
+		if err := d.dispatchSlot(&sub[i], ids[i]); err != nil {
+			return err
+		}
+	}
+	r.Coalesce = func() error {
+		var total int64
+		var array = make([]*redis.Resp, len(sub))
+		for i := range sub {
+			if err := sub[i].Err; err != nil {
+				return err
+			}
+			switch resp := sub[i].Resp; {
+			case resp == nil:
+				return ErrRespIsRequired
+			case resp.IsError():
+				r.Resp = resp
+				return nil
+			case !resp.IsInt():
+				r.Resp = redis.NewErrorf("ERR bad dbsize resp: %s", resp.Type)
+				return nil
+			default:
+				n, err := redis.Btoi64(resp.Value)
+				if err != nil {
+					r.Resp = redis.NewErrorf("ERR bad dbsize resp: %s", resp.Value)
+					return nil
+				}
+				total += n
+				var gid, addr = int64(0), ""
+				if m := d.GetSlot(ids[i]); m != nil {
+					gid, addr = int64(m.BackendAddrGroupId), m.BackendAddr
+				}
+				array[i] = redis.NewArray([]*redis.Resp{
+					redis.NewInt(strconv.AppendInt(nil, gid, 10)),
+					redis.NewBulkBytes([]byte(addr)),
+					resp,
+				})
+			}
+		}
+		if detail {
+			r.Resp = redis.NewArray(array)
+		} else {
+			r.Resp = redis.NewInt(strconv.AppendInt(nil, total, 10))
+		}
+		return nil
+	}
+	return nil
+}
+
+// dispatchSlotWait sends the command to the slot on behalf of the request,
+// and waits for the reply. It's meant to be called from Coalesce, and only
+// for commands without keys, which aren't migrated along with the slot.
+func dispatchSlotWait(r *Request, d *Router, id int, multi []*redis.Resp) (*redis.Resp, error) {
+	sub := r.MakeSubRequest(1)[0]
+	sub.Batch = &sync.WaitGroup{}
+	sub.OpStr = string(multi[0].Value)
+	sub.Multi = multi
+	if err := d.dispatchSlot(&sub, id); err != nil {
+		return nil, err
+	}
+	return waitSubRequest(&sub)
+}
+
+// dispatchWait is dispatchSlotWait for commands with a key, which is routed
+// by the key, so it's migrated first while its slot is being migrated.
+func dispatchWait(r *Request, d *Router, multi []*redis.Resp) (*redis.Resp, error) {
+	sub := r.MakeSubRequest(1)[0]
+	sub.Batch = &sync.WaitGroup{}
+	sub.OpStr = string(multi[0].Value)
+	sub.Multi = multi
+	if err := d.dispatch(&sub); err != nil {
+		return nil, err
+	}
+	return waitSubRequest(&sub)
+}
+
+func waitSubRequest(sub *Request) (*redis.Resp, error) {
+	sub.Batch.Wait()
+	switch {
+	case sub.Err != nil:
+		return nil, sub.Err
+	case sub.Resp == nil:
+		return nil, ErrRespIsRequired
+	}
+	return sub.Resp, nil
+}
+
+// handleRequestDebug only allows DEBUG OBJECT, which is routed by key. The
+// serializedlength in the reply is fed into the big-key report.
+func (s *Session) handleRequestDebug(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'DEBUG' command")
+		return nil
+	}
+	if sub := strings.ToUpper(string(r.Multi[1].Value)); sub != "OBJECT" {
+		r.Resp = redis.NewErrorf("ERR DEBUG subcommand '%s' is not allowed", sub)
+		return nil
+	}
+	if len(r.Multi) != 3 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'DEBUG OBJECT' command")
+		return nil
+	}
+	var key = r.Multi[2].Value
+	r.Coalesce = func() error {
+		if r.Err != nil || r.Resp == nil || !r.Resp.IsString() {
+			return nil
+		}
+		if n, ok := parseSerializedLength(r.Resp.Value); ok {
+			recordBigKey(key, n, r.OpStr)
+		}
+		return nil
+	}
+	return d.dispatch(r)
+}
+
+// handleRequestSrcDst requires the first two keys, i.e. the source and the
+// destination of COPY or GEOSEARCHSTORE, to belong to the same slot, since
+// the backend can only read keys it holds.
+func (s *Session) handleRequestSrcDst(r *Request, d *Router) error {
+	if len(r.Multi) < 3 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", strings.ToLower(r.OpStr))
+		return nil
+	}
+	if !d.isSameSlot(r.Multi[1:3]) {
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+		return nil
+	}
+	return d.dispatch(r)
+}
+
+// handleRequestObject only allows the subcommands inspecting a key, which
+// are routed by the key.
+func (s *Session) handleRequestObject(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'OBJECT' command")
+		return nil
+	}
+	switch sub := strings.ToUpper(string(r.Multi[1].Value)); sub {
+	case "ENCODING", "REFCOUNT", "IDLETIME", "FREQ":
+		if len(r.Multi) != 3 {
+			r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'OBJECT %s' command", sub)
+			return nil
+		}
+		return d.dispatch(r)
+	default:
+		r.Resp = redis.NewErrorf("ERR OBJECT subcommand '%s' is not allowed", sub)
+		return nil
+	}
+}
+
+// handleRequestNumKeys requires the keys following numkeys to belong to the
+// same slot.
+func (s *Session) handleRequestNumKeys(r *Request, d *Router) error {
+	keys, errResp := numKeys(r.Multi, 1)
+	switch {
+	case errResp != nil:
+		r.Resp = errResp
+		return nil
+	case !d.isSameSlot(keys):
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+		return nil
+	}
+	return d.dispatch(r)
+}
+
+func (s *Session) handleRequestBitFieldRO(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'BITFIELD_RO' command")
+		return nil
+	}
+	for i := 2; i < len(r.Multi); i += 3 {
+		switch strings.ToUpper(string(r.Multi[i].Value)) {
+		case "GET":
+			if i+2 >= len(r.Multi) {
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+		case "SET", "INCRBY", "OVERFLOW":
+			r.Resp = redis.NewErrorf("ERR BITFIELD_RO only supports the GET subcommand")
+			return nil
+		default:
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		}
+	}
+	return d.dispatch(r)
+}
+
+// handleRequestSortRO rejects patterns that refer to other keys, which may
+// live in other slots. Patterns without '*' (e.g. BY nosort, GET #) never
+// look up other keys, so they are still allowed.
+func (s *Session) handleRequestSortRO(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'SORT_RO' command")
+		return nil
+	}
+	for i := 2; i < len(r.Multi); i++ {
+		switch strings.ToUpper(string(r.Multi[i].Value)) {
+		case "STORE":
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		case "BY", "GET":
+			if i+1 >= len(r.Multi) {
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+			i++
+			if bytes.IndexByte(r.Multi[i].Value, '*') >= 0 {
+				r.Resp = redis.NewErrorf("ERR BY/GET patterns are not supported by 'SORT_RO' in proxy")
+				return nil
+			}
+		case "LIMIT":
+			i += 2
+		}
+	}
+	return d.dispatch(r)
+}
+
+func (s *Session) isBatchRequest(nkeys int) bool {
+	var threshold = s.config.SessionBatchThreshold
+	return threshold > 0 && nkeys >= threshold
+}
+
 func (s *Session) handleRequestMGet(r *Request, d *Router) error {
 	var nkeys = len(r.Multi) - 1
 	switch {
@@ -451,6 +1269,27 @@ func (s *Session) handleRequestMGet(r *Request, d *Router) error {
 		return nil
 	case nkeys == 1:
 		return d.dispatch(r)
+	case s.isBatchRequest(nkeys):
+		return s.handleRequestBatch(r, d, func(batches []*keyBatch) error {
+			var array = make([]*redis.Resp, nkeys)
+			for _, b := range batches {
+				var values []*redis.Resp
+				for _, resp := range b.replies {
+					if !resp.IsArray() {
+						return fmt.Errorf("bad mget resp: %s array.len = %d", resp.Type, len(resp.Array))
+					}
+					values = append(values, resp.Array...)
+				}
+				if len(values) != len(b.index) {
+					return fmt.Errorf("bad mget resp: array.len = %d, expected %d", len(values), len(b.index))
+				}
+				for i, value := range values {
+					array[b.index[i]] = value
+				}
+			}
+			r.Resp = redis.NewArray(array)
+			return nil
+		})
 	}
 	var sub = r.MakeSubRequest(nkeys)
 	for i := range sub {
@@ -530,6 +1369,21 @@ func (s *Session) handleRequestDel(r *Request, d *Router) error {
 		return nil
 	case nkeys == 1:
 		return d.dispatch(r)
+	case s.isBatchRequest(nkeys):
+		return s.handleRequestBatch(r, d, func(batches []*keyBatch) error {
+			var n int64
+			for _, b := range batches {
+				for _, resp := range b.replies {
+					v, err := redis.Btoi64(resp.Value)
+					if !resp.IsInt() || err != nil {
+						return fmt.Errorf("bad del resp: %s value = %q", resp.Type, resp.Value)
+					}
+					n += v
+				}
+			}
+			r.Resp = redis.NewInt(strconv.AppendInt(nil, n, 10))
+			return nil
+		})
 	}
 	var sub = r.MakeSubRequest(nkeys)
 	for i := range sub {
@@ -730,7 +1584,7 @@ func (s *Session) incrOpStats(r *Request, t redis.RespType) {
 	stat, ok = s.stats.opmap[r.OpStr]
 	if !ok || stat == nil {
 		stat = getOpStats(r.OpStr, true)
-		s.stats.opmap[r.OpStr] = stat
+		s.stats.opmap[stat.opstr] = stat
 	}
 	stat.incrOpStats(responseTime, redis.RespType(t))
 	stat, ok = s.stats.opmap["ALL"]
@@ -803,11 +1657,11 @@ func (s *Session) handlePConfig(r *Request) error {
 		if len(r.Multi) == 3 {
 			key := strings.ToLower(string(r.Multi[2].Value))
 			value := ""
-			r.Resp = s.proxy.ConfigSet(key, value)
+			r.Resp = s.proxy.SetConfig(key, value, s.configWho())
 		} else if len(r.Multi) == 4 {
 			key := strings.ToLower(string(r.Multi[2].Value))
 			value := string(r.Multi[3].Value)
-			r.Resp = s.proxy.ConfigSet(key, value)
+			r.Resp = s.proxy.SetConfig(key, value, s.configWho())
 		} else {
 			r.Resp = redis.NewErrorf("ERR config set parameters.")
 		}
@@ -823,6 +1677,162 @@ func (s *Session) handlePConfig(r *Request) error {
 	return nil
 }
 
+// configWho returns who changes the config in the history, i.e. the user and
+// the addr of the session.
+func (s *Session) configWho() string {
+	var who = s.user
+	if who == "" {
+		who = "default"
+	}
+	if s.Conn != nil {
+		who += "@" + s.Conn.RemoteAddr()
+	}
+	return who
+}
+
+func (s *Session) handleSlowlog(r *Request) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'SLOWLOG' command")
+		return nil
+	}
+	var subCmd = strings.ToUpper(string(r.Multi[1].Value))
+	switch {
+	case subCmd == "GET" && len(r.Multi) <= 4:
+		var n = 10
+		var verbose bool
+		if len(r.Multi) == 4 {
+			if strings.ToUpper(string(r.Multi[3].Value)) != "VERBOSE" {
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+			verbose = true
+		}
+		if len(r.Multi) >= 3 {
+			v, err := strconv.Atoi(string(r.Multi[2].Value))
+			if err != nil || v < -1 {
+				r.Resp = redis.NewErrorf("ERR count should be greater than or equal to -1")
+				return nil
+			}
+			n = v
+		}
+		var array []*redis.Resp
+		for _, e := range GetSlowlog(n) {
+			array = append(array, slowlogEntryResp(e, verbose))
+		}
+		r.Resp = redis.NewArray(array)
+	case subCmd == "LEN" && len(r.Multi) == 2:
+		r.Resp = redis.NewInt(strconv.AppendInt(nil, int64(SlowlogLen()), 10))
+	case subCmd == "RESET" && len(r.Multi) == 2:
+		ResetSlowlog()
+		r.Resp = redis.NewString([]byte("OK"))
+	default:
+		r.Resp = redis.NewErrorf("ERR Unknown SLOWLOG subcommand or wrong args. Try GET [count [VERBOSE]], LEN, RESET.")
+	}
+	return nil
+}
+
+func (s *Session) handleLatency(r *Request) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'LATENCY' command")
+		return nil
+	}
+	var subCmd = strings.ToUpper(string(r.Multi[1].Value))
+	switch {
+	case subCmd == "LATEST" && len(r.Multi) == 2:
+		var array []*redis.Resp
+		for _, e := range GetLatencyLatest() {
+			var unixTime int64
+			if len(e.Samples) != 0 {
+				unixTime = e.Samples[0].UnixTime
+			}
+			array = append(array, redis.NewArray([]*redis.Resp{
+				redis.NewBulkBytes([]byte(e.Name)),
+				redis.NewInt(strconv.AppendInt(nil, unixTime, 10)),
+				redis.NewInt(strconv.AppendInt(nil, e.Latest, 10)),
+				redis.NewInt(strconv.AppendInt(nil, e.Max, 10)),
+			}))
+		}
+		r.Resp = redis.NewArray(array)
+	case subCmd == "HISTORY" && len(r.Multi) == 3:
+		var array []*redis.Resp
+		for _, sample := range GetLatencyHistory(string(r.Multi[2].Value)) {
+			array = append(array, redis.NewArray([]*redis.Resp{
+				redis.NewInt(strconv.AppendInt(nil, sample.UnixTime, 10)),
+				redis.NewInt(strconv.AppendInt(nil, sample.Latency, 10)),
+			}))
+		}
+		r.Resp = redis.NewArray(array)
+	case subCmd == "RESET":
+		var names []string
+		for _, m := range r.Multi[2:] {
+			names = append(names, string(m.Value))
+		}
+		r.Resp = redis.NewInt(strconv.AppendInt(nil, int64(ResetLatency(names...)), 10))
+	default:
+		r.Resp = redis.NewErrorf("ERR Unknown LATENCY subcommand or wrong args. Try LATEST, HISTORY, RESET.")
+	}
+	return nil
+}
+
+func (s *Session) handleXMonitor(r *Request) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'XMONITOR' command")
+		return nil
+	}
+	var subCmd = strings.ToUpper(string(r.Multi[1].Value))
+	switch {
+	case subCmd == "UNKNOWN" && len(r.Multi) == 2:
+		cmds, overflow := GetUnknownCmds()
+		var array = make([]*redis.Resp, 0, len(cmds)*2+2)
+		for _, c := range cmds {
+			array = append(array,
+				redis.NewBulkBytes([]byte(c.OpStr)),
+				redis.NewInt(strconv.AppendInt(nil, c.Calls, 10)),
+			)
+		}
+		if overflow != 0 {
+			array = append(array,
+				redis.NewBulkBytes([]byte("(overflow)")),
+				redis.NewInt(strconv.AppendInt(nil, overflow, 10)),
+			)
+		}
+		r.Resp = redis.NewArray(array)
+	case subCmd == "UNKNOWN" && len(r.Multi) == 3 && strings.ToUpper(string(r.Multi[2].Value)) == "RESET":
+		ResetUnknownCmds()
+		r.Resp = RespOK
+	case subCmd == "BIGKEYS" && len(r.Multi) == 2:
+		keys := GetBigKeys()
+		var array = make([]*redis.Resp, 0, len(keys))
+		for _, k := range keys {
+			array = append(array, redis.NewArray([]*redis.Resp{
+				redis.NewBulkBytes([]byte(k.Key)),
+				redis.NewBulkBytes([]byte(k.Type)),
+				redis.NewInt(strconv.AppendInt(nil, k.Size, 10)),
+				redis.NewBulkBytes([]byte(k.OpStr)),
+				redis.NewInt(strconv.AppendInt(nil, k.UnixTime, 10)),
+				redis.NewInt(strconv.AppendInt(nil, k.Count, 10)),
+			}))
+		}
+		r.Resp = redis.NewArray(array)
+	case subCmd == "BIGKEYS" && len(r.Multi) == 3 && strings.ToUpper(string(r.Multi[2].Value)) == "RESET":
+		ResetBigKeys()
+		r.Resp = RespOK
+	case subCmd == "HOTKEYS" && len(r.Multi) == 2:
+		keys := GetHotKeys()
+		var array = make([]*redis.Resp, 0, len(keys)*2)
+		for _, k := range keys {
+			array = append(array,
+				redis.NewBulkBytes([]byte(k.Key)),
+				redis.NewInt(strconv.AppendInt(nil, k.Count, 10)),
+			)
+		}
+		r.Resp = redis.NewArray(array)
+	default:
+		r.Resp = redis.NewErrorf("ERR Unknown XMONITOR subcommand or wrong args. Try UNKNOWN [RESET], BIGKEYS [RESET], HOTKEYS.")
+	}
+	return nil
+}
+
 func (s *Session) updateMaxDelay(duration int64, r *Request) {
 	e := s.getOpStats(r.OpStr, true) // There is no race condition in the session
 	if duration > e.maxDelay.Int64() {
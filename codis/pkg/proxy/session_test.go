@@ -0,0 +1,605 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+type fakeBackend struct {
+	l net.Listener
+}
+
+// newFakeBackend answers each request by the handler.
+func newFakeBackend(handler func(multi []*redis.Resp) *redis.Resp) *fakeBackend {
+	return newFakeConnBackend(func(c *redis.Conn) {
+		for {
+			multi, err := c.DecodeMultiBulk()
+			if err != nil {
+				return
+			}
+			if err := c.Encode(handler(multi), true); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// newFakeConnBackend serves each connection by the function, for backends
+// keeping the state of connections, e.g. subscriptions or transactions.
+func newFakeConnBackend(serve func(c *redis.Conn)) *fakeBackend {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c *redis.Conn) {
+				defer c.Close()
+				serve(c)
+			}(redis.NewConn(c, 8192, 8192))
+		}
+	}()
+	return &fakeBackend{l: l}
+}
+
+func (b *fakeBackend) Addr() string {
+	return b.l.Addr().String()
+}
+
+func (b *fakeBackend) Close() {
+	b.l.Close()
+}
+
+func newTestRouter(addrs ...string) *Router {
+	d := NewRouter(config)
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: addrs[i%len(addrs)],
+		}))
+	}
+	d.Start()
+	return d
+}
+
+func newTestSession() *Session {
+	s := &Session{config: config, id: sessionId.Incr(), proto: 2}
+	s.stats.opmap = make(map[string]*opStats, 16)
+	s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	return s
+}
+
+func newTestRequest(args ...string) *Request {
+	r := &Request{Batch: &sync.WaitGroup{}}
+	for _, arg := range args {
+		r.Multi = append(r.Multi, redis.NewBulkBytes([]byte(arg)))
+	}
+	return r
+}
+
+func handleTestRequest(s *Session, d *Router, args ...string) *redis.Resp {
+	r := newTestRequest(args...)
+	r.ReplicaRead = s.isReplicaRead()
+	r.MasterRead = s.readwrite
+	r.Writes = s.writes
+	assert.MustNoError(s.handleRequest(r, d))
+	resp, err := s.handleResponse(r)
+	assert.MustNoError(err)
+	return resp
+}
+
+func TestRandomKey(t *testing.T) {
+	var backends = make([]*fakeBackend, 2)
+	var addrs = make([]string, len(backends))
+	for i := range backends {
+		key := []byte("key-" + string(rune('a'+i)))
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			if string(multi[0].Value) == "DBSIZE" {
+				return redis.NewInt([]byte("10"))
+			}
+			return redis.NewBulkBytes(key)
+		})
+		defer backends[i].Close()
+		addrs[i] = backends[i].Addr()
+	}
+
+	d := newTestRouter(addrs...)
+	defer d.Close()
+	assert.Must(len(d.backendSlots()) == 2)
+
+	s := newTestSession()
+	var seen = make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		resp := handleTestRequest(s, d, "RANDOMKEY")
+		assert.Must(resp.IsBulkBytes())
+		seen[string(resp.Value)] = true
+	}
+	assert.Must(seen["key-a"] && seen["key-b"])
+
+	resp := handleTestRequest(s, d, "RANDOMKEY", "x")
+	assert.Must(resp.IsError())
+}
+
+func TestRandomKeyWeighted(t *testing.T) {
+	var sizes = []string{"0", "5", "0", "3"}
+	var backends = make([]*fakeBackend, len(sizes))
+	var addrs = make([]string, len(backends))
+	for i := range backends {
+		key, size, deleted := []byte("key-"+string(rune('a'+i))), sizes[i], i == 3
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			switch {
+			case string(multi[0].Value) == "DBSIZE":
+				return redis.NewInt([]byte(size))
+			case deleted:
+				// The keys are deleted after DBSIZE.
+				return redis.NewBulkBytes(nil)
+			}
+			return redis.NewBulkBytes(key)
+		})
+		defer backends[i].Close()
+		addrs[i] = backends[i].Addr()
+	}
+
+	d := newTestRouter(addrs...)
+	defer d.Close()
+
+	s := newTestSession()
+	for i := 0; i < 16; i++ {
+		resp := handleTestRequest(s, d, "RANDOMKEY")
+		assert.Must(resp.IsBulkBytes() && string(resp.Value) == "key-b")
+	}
+
+	d2 := newTestRouter(addrs[0])
+	defer d2.Close()
+	resp := handleTestRequest(s, d2, "RANDOMKEY")
+	assert.Must(resp.IsBulkBytes() && resp.Value == nil)
+}
+
+func TestEvalReadOnlyRouting(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes(multi[3].Value)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "EVAL_RO", "return 1", "1", "key")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "key")
+	resp = handleTestRequest(s, d, "EVALSHA_RO", "sha", "2", "{tag}a", "{tag}b")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "{tag}a")
+
+	assert.Must(handleTestRequest(s, d, "EVAL_RO", "return 1", "2", "a", "b").IsError())
+	assert.Must(handleTestRequest(s, d, "EVAL_RO", "return 1", "0").IsError())
+	assert.Must(handleTestRequest(s, d, "EVAL_RO", "return 1", "2", "a").IsError())
+}
+
+func TestBitFieldReadOnlyRouting(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewArray([]*redis.Resp{redis.NewInt([]byte("0"))})
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "BITFIELD_RO", "key").IsArray())
+	assert.Must(handleTestRequest(s, d, "BITFIELD_RO", "key", "GET", "u8", "0", "get", "i4", "8").IsArray())
+
+	assert.Must(handleTestRequest(s, d, "BITFIELD_RO").IsError())
+	assert.Must(handleTestRequest(s, d, "BITFIELD_RO", "key", "SET", "u8", "0", "1").IsError())
+	assert.Must(handleTestRequest(s, d, "BITFIELD_RO", "key", "GET", "u8", "0", "INCRBY", "u8", "0", "1").IsError())
+	assert.Must(handleTestRequest(s, d, "BITFIELD_RO", "key", "OVERFLOW", "SAT").IsError())
+	assert.Must(handleTestRequest(s, d, "BITFIELD_RO", "key", "GET", "u8").IsError())
+}
+
+func TestSortReadOnlyRouting(t *testing.T) {
+	master := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes([]byte("master"))
+	})
+	defer master.Close()
+	replica := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes([]byte("replica"))
+	})
+	defer replica.Close()
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: master.Addr(),
+			ReplicaGroups: [][]string{{replica.Addr()}},
+		}))
+	}
+	d.Start()
+
+	s := newTestSession()
+	var resp *redis.Resp
+	// Replicas are only picked once their connections have been established.
+	for i := 0; i < 100; i++ {
+		resp = handleTestRequest(s, d, "SORT_RO", "key", "LIMIT", "0", "10", "ALPHA", "DESC")
+		if string(resp.Value) == "replica" {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "replica")
+	resp = handleTestRequest(s, d, "SORT_RO", "key", "BY", "nosort", "GET", "#")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "replica")
+	resp = handleTestRequest(s, d, "SORT", "key")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "master")
+
+	assert.Must(handleTestRequest(s, d, "SORT_RO", "key", "STORE", "dst").IsError())
+	assert.Must(handleTestRequest(s, d, "SORT_RO", "key", "BY", "weight_*").IsError())
+	assert.Must(handleTestRequest(s, d, "SORT_RO", "key", "GET", "#", "GET", "obj_*->name").IsError())
+	assert.Must(handleTestRequest(s, d, "SORT_RO", "key", "GET").IsError())
+}
+
+func TestSessionAuthMaxCommands(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes([]byte("value"))
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	c := *config
+	c.SessionAuth = "secret"
+	c.SessionAuthMaxCommands = 3
+
+	s := newTestSession()
+	s.config = &c
+
+	isNoAuth := func(resp *redis.Resp) bool {
+		return resp.IsError() && strings.HasPrefix(string(resp.Value), "NOAUTH")
+	}
+	assert.Must(isNoAuth(handleTestRequest(s, d, "GET", "key")))
+
+	for i := 0; i < 2; i++ {
+		assert.Must(handleTestRequest(s, d, "AUTH", "secret").IsString())
+		for j := 0; j < 3; j++ {
+			assert.Must(handleTestRequest(s, d, "GET", "key").IsBulkBytes())
+		}
+		assert.Must(isNoAuth(handleTestRequest(s, d, "GET", "key")))
+		assert.Must(isNoAuth(handleTestRequest(s, d, "GET", "key")))
+	}
+}
+
+func TestUnknownCmds(t *testing.T) {
+	ResetUnknownCmds()
+	defer ResetUnknownCmds()
+
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewErrorf("ERR unknown command '%s'", multi[0].Value)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "GETT", "key").IsError())
+	assert.Must(handleTestRequest(s, d, "gett", "key").IsError())
+	assert.Must(handleTestRequest(s, d, "SETT", "key", "value").IsError())
+
+	resp := handleTestRequest(s, d, "XMONITOR", "UNKNOWN")
+	assert.Must(resp.IsArray() && len(resp.Array) == 4)
+	assert.Must(string(resp.Array[0].Value) == "GETT" && string(resp.Array[1].Value) == "2")
+	assert.Must(string(resp.Array[2].Value) == "SETT" && string(resp.Array[3].Value) == "1")
+
+	resp = handleTestRequest(s, d, "XMONITOR", "UNKNOWN", "RESET")
+	assert.Must(resp.IsString())
+	resp = handleTestRequest(s, d, "XMONITOR", "UNKNOWN")
+	assert.Must(resp.IsArray() && len(resp.Array) == 0)
+}
+
+func TestUnknownCmdsBounded(t *testing.T) {
+	ResetUnknownCmds()
+	defer ResetUnknownCmds()
+
+	for i := 0; i < MaxUnknownCmds*2; i++ {
+		incrUnknownCmd("CMD" + strconv.Itoa(i))
+	}
+	incrUnknownCmd("CMD0")
+
+	cmds, overflow := GetUnknownCmds()
+	assert.Must(len(cmds) == MaxUnknownCmds)
+	assert.Must(overflow == MaxUnknownCmds)
+	for _, c := range cmds {
+		if c.OpStr == "CMD0" {
+			assert.Must(c.Calls == 2)
+		}
+	}
+
+	for i := 0; i < MaxUnknownCmds; i++ {
+		getOpStats("CMD"+strconv.Itoa(i), true)
+	}
+	assert.Must(getOpStats("CMD-FOLDED", true).opstr == UnknownOpStr)
+	assert.Must(getOpStats("CMD-FOLDED", false) == nil)
+	assert.Must(getOpStats("GET", true).opstr == "GET")
+}
+
+func TestHello(t *testing.T) {
+	s := newTestSession()
+
+	resp := handleTestRequest(s, nil, "HELLO")
+	assert.Must(resp.IsArray() && len(resp.Array) == 14)
+	assert.Must(string(resp.Array[5].Value) == "2")
+
+	resp = handleTestRequest(s, nil, "HELLO", "3", "SETNAME", "myclient")
+	assert.Must(resp.IsMap() && len(resp.Array) == 14)
+	assert.Must(string(resp.Array[4].Value) == "proto" && string(resp.Array[5].Value) == "3")
+	assert.Must(s.proto == 3 && s.getName() == "myclient")
+
+	assert.Must(handleTestRequest(s, nil, "HELLO", "4").IsError())
+	assert.Must(handleTestRequest(s, nil, "HELLO", "x").IsError())
+	assert.Must(handleTestRequest(s, nil, "HELLO", "3", "SETNAME").IsError())
+	assert.Must(s.proto == 3)
+}
+
+func TestHelloRole(t *testing.T) {
+	mode := config.SessionReplicaRead
+	defer func() {
+		config.SessionReplicaRead = mode
+	}()
+	config.SessionReplicaRead = ReplicaReadOnly
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: "127.0.0.1:0",
+			ReplicaGroups: [][]string{{"127.0.0.1:1"}},
+		}))
+	}
+
+	s := newTestSession()
+	assert.Must(string(handleTestRequest(s, d, "HELLO").Array[11].Value) == "master")
+	assert.Must(handleTestRequest(s, d, "READONLY").IsString())
+	assert.Must(string(handleTestRequest(s, d, "HELLO").Array[11].Value) == "replica")
+	assert.Must(string(handleTestRequest(s, nil, "HELLO").Array[11].Value) == "master")
+}
+
+func TestHelloAuth(t *testing.T) {
+	c := *config
+	c.SessionAuth = "secret"
+
+	s := newTestSession()
+	s.config = &c
+
+	resp := handleTestRequest(s, nil, "HELLO", "3")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "NOAUTH"))
+	resp = handleTestRequest(s, nil, "HELLO", "3", "AUTH", "default", "wrong")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "WRONGPASS"))
+	resp = handleTestRequest(s, nil, "HELLO", "3", "AUTH", "someone", "secret")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "WRONGPASS"))
+	assert.Must(s.proto == 2 && !s.authorized)
+
+	resp = handleTestRequest(s, nil, "HELLO", "3", "AUTH", "default", "secret")
+	assert.Must(resp.IsMap())
+	assert.Must(s.proto == 3 && s.authorized)
+}
+
+func TestDBSize(t *testing.T) {
+	var backends = make([]*fakeBackend, 3)
+	var addrs = make([]string, len(backends))
+	for i := range backends {
+		size := []byte(strconv.Itoa(i + 1))
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			return redis.NewInt(size)
+		})
+		defer backends[i].Close()
+		addrs[i] = backends[i].Addr()
+	}
+
+	d := newTestRouter(addrs...)
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "DBSIZE")
+	assert.Must(resp.IsInt() && string(resp.Value) == "6")
+
+	resp = handleTestRequest(s, d, "DBSIZE", "groups")
+	assert.Must(resp.IsArray() && len(resp.Array) == 3)
+	for i, x := range resp.Array {
+		assert.Must(len(x.Array) == 3 && string(x.Array[1].Value) == addrs[i])
+		assert.Must(string(x.Array[2].Value) == strconv.Itoa(i+1))
+	}
+
+	assert.Must(handleTestRequest(s, d, "DBSIZE", "x").IsError())
+}
+
+func TestSrcDstSameSlot(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewInt([]byte("1"))
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "COPY", "{k}src", "{k}dst", "REPLACE").IsInt())
+	assert.Must(handleTestRequest(s, d, "COPY", "src", "dst").IsError())
+	assert.Must(handleTestRequest(s, d, "COPY", "src").IsError())
+
+	assert.Must(handleTestRequest(s, d, "GEOSEARCHSTORE", "{g}dst", "{g}src", "FROMMEMBER", "m", "BYRADIUS", "1", "km").IsInt())
+	assert.Must(handleTestRequest(s, d, "GEOSEARCHSTORE", "dst", "src", "FROMMEMBER", "m", "BYRADIUS", "1", "km").IsError())
+	assert.Must(handleTestRequest(s, d, "GEOSEARCH", "src", "FROMMEMBER", "m", "BYRADIUS", "1", "km").IsInt())
+
+	assert.Must(handleTestRequest(s, d, "RPOPLPUSH", "{l}src", "{l}dst").IsInt())
+	assert.Must(handleTestRequest(s, d, "RPOPLPUSH", "src", "dst").IsError())
+	assert.Must(handleTestRequest(s, d, "LMOVE", "{l}src", "{l}dst", "LEFT", "RIGHT").IsInt())
+	assert.Must(handleTestRequest(s, d, "LMOVE", "list", "list", "LEFT", "RIGHT").IsInt())
+	assert.Must(handleTestRequest(s, d, "LMOVE", "src", "dst", "LEFT", "RIGHT").IsError())
+}
+
+func TestDispatchWaitMigrating(t *testing.T) {
+	var mu sync.Mutex
+	var migrated []string
+	b1 := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "SLOTSMGRTTAGONE":
+			migrated = append(migrated, string(multi[4].Value))
+			return redis.NewInt([]byte("1"))
+		case "SLOTSMGRT-EXEC-WRAPPER":
+			migrated = append(migrated, string(multi[1].Value))
+			return redis.NewArray([]*redis.Resp{redis.NewInt([]byte("0")), redis.NewBulkBytes(nil)})
+		}
+		return redis.NewErrorf("ERR unexpected %s", multi[0].Value)
+	})
+	defer b1.Close()
+	b2 := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewString([]byte("OK"))
+	})
+	defer b2.Close()
+
+	d := newTestRouter(b2.Addr())
+	defer d.Close()
+
+	id := int(Hash([]byte("dest")) % uint32(models.GetMaxSlotNum()))
+	assert.MustNoError(d.FillSlot(&models.Slot{
+		Id: id, BackendAddr: b2.Addr(), MigrateFrom: b1.Addr(),
+	}))
+
+	r := newTestRequest("BITOP", "AND", "dest", "src")
+	resp, err := dispatchWait(r, d, []*redis.Resp{
+		redis.NewBulkBytes([]byte("SET")), redis.NewBulkBytes([]byte("dest")), redis.NewBulkBytes([]byte("v")),
+	})
+	assert.MustNoError(err)
+	assert.Must(string(resp.Value) == "OK")
+	mu.Lock()
+	assert.Must(len(migrated) == 1 && migrated[0] == "dest")
+	mu.Unlock()
+}
+
+func TestObjectRouting(t *testing.T) {
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes(multi[2].Value)
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "OBJECT", "encoding", "key")
+	assert.Must(resp.IsBulkBytes() && string(resp.Value) == "key")
+	assert.Must(handleTestRequest(s, d, "OBJECT", "IDLETIME", "key").IsBulkBytes())
+	assert.Must(handleTestRequest(s, d, "OBJECT", "HELP").IsError())
+	assert.Must(handleTestRequest(s, d, "OBJECT", "REFCOUNT").IsError())
+	assert.Must(handleTestRequest(s, d, "OBJECT").IsError())
+
+	_, flag, err := getOpInfo([]*redis.Resp{redis.NewBulkBytes([]byte("PEXPIRETIME"))})
+	assert.Must(err == nil && flag.IsReadOnly())
+}
+
+func TestReplicaRead(t *testing.T) {
+	var backends = make([]*fakeBackend, 2)
+	for i, name := range []string{"primary", "replica"} {
+		var value = []byte(name)
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			return redis.NewBulkBytes(value)
+		})
+		defer backends[i].Close()
+	}
+
+	mode := config.SessionReplicaRead
+	defer func() {
+		config.SessionReplicaRead = mode
+	}()
+	config.SessionReplicaRead = ReplicaReadAlways
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: backends[0].Addr(),
+			ReplicaGroups: [][]string{{backends[1].Addr()}},
+		}))
+	}
+	d.Start()
+
+	get := func(s *Session) string {
+		return string(handleTestRequest(s, d, "GET", "key").Value)
+	}
+
+	s := newTestSession()
+	for i := 0; get(s) != "replica"; i++ {
+		assert.Must(i < 100)
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Must(handleTestRequest(s, d, "READWRITE").IsString())
+	assert.Must(get(s) == "primary")
+	assert.Must(string(handleTestRequest(s, d, "SET", "key", "v").Value) == "primary")
+	assert.Must(handleTestRequest(s, d, "READONLY").IsString())
+	assert.Must(get(s) == "replica")
+
+	config.SessionReplicaRead = ReplicaReadOnly
+	s = newTestSession()
+	assert.Must(get(s) == "primary")
+	assert.Must(handleTestRequest(s, d, "READONLY").IsString())
+	assert.Must(get(s) == "replica")
+	assert.Must(handleTestRequest(s, d, "READONLY", "x").IsError())
+}
+
+func TestReadYourWrites(t *testing.T) {
+	var backends = make([]*fakeBackend, 2)
+	for i, name := range []string{"primary", "replica"} {
+		var value = []byte(name)
+		backends[i] = newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+			return redis.NewBulkBytes(value)
+		})
+		defer backends[i].Close()
+	}
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{
+			Id: i, BackendAddr: backends[0].Addr(),
+			ReplicaGroups: [][]string{{backends[1].Addr()}},
+		}))
+	}
+	d.Start()
+
+	s := newTestSession()
+	s.writes = newRecentWrites(time.Millisecond * 200)
+	get := func(key string) string {
+		return string(handleTestRequest(s, d, "GET", key).Value)
+	}
+	for i := 0; get("key") != "replica"; i++ {
+		assert.Must(i < 100)
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	handleTestRequest(s, d, "SET", "{tag}1", "v")
+	assert.Must(get("{tag}2") == "primary")
+	assert.Must(get("key") == "replica")
+	assert.Must(get("{tag}2") == "primary")
+
+	other := newTestSession()
+	other.writes = newRecentWrites(time.Hour)
+	assert.Must(string(handleTestRequest(other, d, "GET", "{tag}2").Value) == "replica")
+
+	time.Sleep(time.Millisecond * 250)
+	assert.Must(get("{tag}2") == "replica")
+}
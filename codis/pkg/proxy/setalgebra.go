@@ -0,0 +1,344 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+// handleRequestSetAlgebra forwards SDIFF/SINTER/SUNION if all keys belong to
+// the same slot. Otherwise the members of each set are read by the proxy to
+// compute the result, which fails if any set replied has more than
+// set_algebra_max_members.
+func (s *Session) handleRequestSetAlgebra(r *Request, d *Router) error {
+	var keys = r.Multi[1:]
+	switch {
+	case len(keys) == 0:
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", r.OpStr)
+		return nil
+	case d.isSameSlot(keys):
+		return d.dispatch(r)
+	}
+	var limit = s.config.SetAlgebraMaxMembers
+	if limit == 0 {
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+		return nil
+	}
+	sub, err := s.sendEachKey(r, d, keys, "SMEMBERS")
+	if err != nil {
+		return err
+	}
+	r.Coalesce = func() error {
+		sets, err := eachKeyReplies(sub)
+		if err != nil {
+			return err
+		}
+		for i, resp := range sets {
+			switch {
+			case !resp.IsArray():
+				r.Resp = resp
+				return nil
+			case int64(len(resp.Array)) > limit:
+				r.Resp = tooManyMembers(keys[i], len(resp.Array), limit)
+				return nil
+			}
+		}
+		r.Resp = redis.NewArray(computeSetAlgebra(r.OpStr, sets))
+		return nil
+	}
+	return nil
+}
+
+func tooManyMembers(key *redis.Resp, n int, limit int64) *redis.Resp {
+	return redis.NewErrorf("ERR key '%s' has %d members, more than %d", key.Value, n, limit)
+}
+
+// sendEachKey sends the command to each of the keys like dispatchEachKey, but
+// doesn't wait for the replies, which are ready in Coalesce of the request.
+func (s *Session) sendEachKey(r *Request, d *Router, keys []*redis.Resp, args ...string) ([]Request, error) {
+	var sub = r.MakeSubRequest(len(keys))
+	for i := range sub {
+		sub[i].OpStr = args[0]
+		sub[i].Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte(args[0])), keys[i],
+		}
+		for _, arg := range args[1:] {
+			sub[i].Multi = append(sub[i].Multi, redis.NewBulkBytes([]byte(arg)))
+		}
+		if err := d.dispatch(&sub[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// eachKeyReplies returns the replies of the sub requests of each key.
+func eachKeyReplies(sub []Request) ([]*redis.Resp, error) {
+	var replies = make([]*redis.Resp, len(sub))
+	for i := range sub {
+		switch {
+		case sub[i].Err != nil:
+			return nil, sub[i].Err
+		case sub[i].Resp == nil:
+			return nil, ErrRespIsRequired
+		}
+		replies[i] = sub[i].Resp
+	}
+	return replies, nil
+}
+
+// dispatchEachKey sends the command to each of the keys, e.g. "ZRANGE key 0 -1"
+// for args "ZRANGE", "0", "-1", and waits for the replies. It's meant to be
+// called from Coalesce.
+func (s *Session) dispatchEachKey(r *Request, d *Router, keys []*redis.Resp, args ...string) ([]*redis.Resp, error) {
+	var wg = &sync.WaitGroup{}
+	var sub = r.MakeSubRequest(len(keys))
+	for i := range sub {
+		sub[i].Batch = wg
+		sub[i].OpStr = args[0]
+		sub[i].Multi = []*redis.Resp{
+			redis.NewBulkBytes([]byte(args[0])), keys[i],
+		}
+		for _, arg := range args[1:] {
+			sub[i].Multi = append(sub[i].Multi, redis.NewBulkBytes([]byte(arg)))
+		}
+		if err := d.dispatch(&sub[i]); err != nil {
+			wg.Wait()
+			return nil, err
+		}
+	}
+	wg.Wait()
+	return eachKeyReplies(sub)
+}
+
+func computeSetAlgebra(opstr string, sets []*redis.Resp) []*redis.Resp {
+	var members = make([]map[string]bool, len(sets))
+	for i, set := range sets {
+		members[i] = make(map[string]bool, len(set.Array))
+		for _, m := range set.Array {
+			members[i][string(m.Value)] = true
+		}
+	}
+	var result = []*redis.Resp{}
+	switch opstr {
+	case "SUNION":
+		var seen = make(map[string]bool)
+		for _, set := range sets {
+			for _, m := range set.Array {
+				if !seen[string(m.Value)] {
+					seen[string(m.Value)] = true
+					result = append(result, m)
+				}
+			}
+		}
+	case "SINTER", "SDIFF":
+		var inter = opstr == "SINTER"
+		for _, m := range sets[0].Array {
+			var keep = true
+			for i := 1; i < len(sets) && keep; i++ {
+				keep = members[i][string(m.Value)] == inter
+			}
+			if keep {
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+// handleRequestZStore forwards ZUNIONSTORE/ZINTERSTORE if the destination and
+// all keys belong to the same slot. Otherwise the proxy reads each sorted set
+// with ZRANGE WITHSCORES, which fails if any of them has more than
+// set_algebra_max_members, computes the result, and writes it to the
+// destination with a single ZADD.
+func (s *Session) handleRequestZStore(r *Request, d *Router) error {
+	if len(r.Multi) < 4 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", r.OpStr)
+		return nil
+	}
+	keys, errResp := numKeys(r.Multi, 2)
+	if errResp != nil {
+		r.Resp = errResp
+		return nil
+	}
+	var dest = r.Multi[1]
+	var weights = make([]float64, len(keys))
+	for i := range weights {
+		weights[i] = 1
+	}
+	var aggregate = "SUM"
+	for i := 3 + len(keys); i < len(r.Multi); i++ {
+		switch strings.ToUpper(string(r.Multi[i].Value)) {
+		case "WEIGHTS":
+			if i+len(keys) >= len(r.Multi) {
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+			for j := range weights {
+				w, err := strconv.ParseFloat(string(r.Multi[i+1+j].Value), 64)
+				if err != nil || math.IsNaN(w) {
+					r.Resp = redis.NewErrorf("ERR weight value is not a float")
+					return nil
+				}
+				weights[j] = w
+			}
+			i += len(keys)
+		case "AGGREGATE":
+			if i+1 >= len(r.Multi) {
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+			switch aggregate = strings.ToUpper(string(r.Multi[i+1].Value)); aggregate {
+			case "SUM", "MIN", "MAX":
+			default:
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+			i++
+		default:
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		}
+	}
+	if d.isSameSlot(append([]*redis.Resp{dest}, keys...)) {
+		return d.dispatch(r)
+	}
+	var limit = s.config.SetAlgebraMaxMembers
+	if limit == 0 {
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+		return nil
+	}
+	sub, err := s.sendEachKey(r, d, keys, "ZRANGE", "0", "-1", "WITHSCORES")
+	if err != nil {
+		return err
+	}
+	r.Coalesce = func() error {
+		zsets, err := eachKeyReplies(sub)
+		if err != nil {
+			return err
+		}
+		var members = make([][]zsetMember, len(zsets))
+		for i, resp := range zsets {
+			if resp.IsError() {
+				r.Resp = resp
+				return nil
+			}
+			if members[i], err = parseZSetMembers(resp); err != nil {
+				r.Resp = redis.NewErrorf("ERR %s", err)
+				return nil
+			}
+			if int64(len(members[i])) > limit {
+				r.Resp = tooManyMembers(keys[i], len(members[i]), limit)
+				return nil
+			}
+		}
+		result := computeZSetAlgebra(r.OpStr == "ZINTERSTORE", members, weights, aggregate)
+
+		resp, err := dispatchWait(r, d, []*redis.Resp{
+			redis.NewBulkBytes([]byte("DEL")), dest,
+		})
+		switch {
+		case err != nil:
+			return err
+		case resp.IsError() || len(result) == 0:
+			if !resp.IsError() {
+				resp = redis.NewInt([]byte("0"))
+			}
+			r.Resp = resp
+			return nil
+		}
+		var multi = []*redis.Resp{redis.NewBulkBytes([]byte("ZADD")), dest}
+		for _, m := range result {
+			multi = append(multi,
+				redis.NewBulkBytes([]byte(strconv.FormatFloat(m.score, 'g', -1, 64))),
+				redis.NewBulkBytes([]byte(m.member)),
+			)
+		}
+		if r.Resp, err = dispatchWait(r, d, multi); err != nil {
+			return err
+		}
+		return nil
+	}
+	return nil
+}
+
+type zsetMember struct {
+	member string
+	score  float64
+}
+
+// parseZSetMembers parses the reply of ZRANGE WITHSCORES, either as a flat
+// array of member/score pairs, or as an array of [member, score] in RESP3.
+func parseZSetMembers(resp *redis.Resp) ([]zsetMember, error) {
+	if !resp.IsArray() {
+		return nil, errors.Errorf("bad zrange resp: %s", resp.Value)
+	}
+	var pairs []*redis.Resp
+	for _, elem := range resp.Array {
+		if elem.IsArray() {
+			pairs = append(pairs, elem.Array...)
+		} else {
+			pairs = append(pairs, elem)
+		}
+	}
+	if len(pairs)%2 != 0 {
+		return nil, errors.Errorf("bad zrange resp: %d elements", len(pairs))
+	}
+	var members = make([]zsetMember, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		score, err := strconv.ParseFloat(string(pairs[i+1].Value), 64)
+		if err != nil {
+			return nil, errors.Errorf("bad zrange score: %s", pairs[i+1].Value)
+		}
+		members = append(members, zsetMember{string(pairs[i].Value), score})
+	}
+	return members, nil
+}
+
+func computeZSetAlgebra(inter bool, zsets [][]zsetMember, weights []float64, aggregate string) []zsetMember {
+	var merge = func(a, b float64) float64 {
+		switch aggregate {
+		case "MIN":
+			return math.Min(a, b)
+		case "MAX":
+			return math.Max(a, b)
+		default:
+			return a + b
+		}
+	}
+	var scores = make(map[string]float64)
+	var counts = make(map[string]int)
+	var result []zsetMember
+	for i, zset := range zsets {
+		for _, m := range zset {
+			score := m.score * weights[i]
+			if math.IsNaN(score) {
+				score = 0
+			}
+			if _, ok := scores[m.member]; !ok {
+				result = append(result, zsetMember{member: m.member})
+				scores[m.member] = score
+			} else if score = merge(scores[m.member], score); math.IsNaN(score) {
+				scores[m.member] = 0
+			} else {
+				scores[m.member] = score
+			}
+			counts[m.member]++
+		}
+	}
+	var filtered = result[:0]
+	for _, m := range result {
+		if inter && counts[m.member] != len(zsets) {
+			continue
+		}
+		filtered = append(filtered, zsetMember{m.member, scores[m.member]})
+	}
+	return filtered
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestSetAlgebra(t *testing.T) {
+	var sets = map[string][]string{
+		"a":   {"1", "2", "3", "4"},
+		"b":   {"2", "3", "5"},
+		"c":   {"3", "4", "6"},
+		"big": {"1", "2", "3", "4", "5", "6"},
+	}
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		var members = sets[string(multi[1].Value)]
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "SMEMBERS":
+			var array = []*redis.Resp{}
+			for _, m := range members {
+				array = append(array, redis.NewBulkBytes([]byte(m)))
+			}
+			return redis.NewArray(array)
+		default:
+			return redis.NewErrorf("ERR unexpected %s", multi[0].Value)
+		}
+	}
+	b1, b2 := newFakeBackend(handler), newFakeBackend(handler)
+	defer b1.Close()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	limit := config.SetAlgebraMaxMembers
+	defer func() {
+		config.SetAlgebraMaxMembers = limit
+	}()
+	config.SetAlgebraMaxMembers = 5
+
+	members := func(resp *redis.Resp) string {
+		assert.Must(resp.IsArray())
+		var list []string
+		for _, m := range resp.Array {
+			list = append(list, string(m.Value))
+		}
+		return strings.Join(list, ",")
+	}
+
+	s := newTestSession()
+	assert.Must(members(handleTestRequest(s, d, "SUNION", "a", "b", "c")) == "1,2,3,4,5,6")
+	assert.Must(members(handleTestRequest(s, d, "SINTER", "a", "b", "c")) == "3")
+	assert.Must(members(handleTestRequest(s, d, "SDIFF", "a", "b", "c")) == "1")
+	assert.Must(members(handleTestRequest(s, d, "SINTER", "a", "x")) == "")
+
+	// The limit is enforced on the sets replied.
+	resp := handleTestRequest(s, d, "SUNION", "a", "big")
+	assert.Must(resp.IsError() && strings.Contains(string(resp.Value), "has 6 members"))
+	assert.Must(handleTestRequest(s, d, "SDIFF").IsError())
+
+	config.SetAlgebraMaxMembers = 0
+	assert.Must(handleTestRequest(s, d, "SUNION", "a", "b").IsError())
+}
+
+func TestZSetStore(t *testing.T) {
+	var zsets = map[string][]string{
+		"a": {"x", "1", "y", "2"},
+		"b": {"y", "3", "z", "4"},
+	}
+	var mu sync.Mutex
+	var stored = make(map[string][]string)
+	handler := func(multi []*redis.Resp) *redis.Resp {
+		mu.Lock()
+		defer mu.Unlock()
+		var key = string(multi[1].Value)
+		switch strings.ToUpper(string(multi[0].Value)) {
+		case "ZRANGE":
+			var array = []*redis.Resp{}
+			for _, v := range zsets[key] {
+				array = append(array, redis.NewBulkBytes([]byte(v)))
+			}
+			return redis.NewArray(array)
+		case "DEL":
+			delete(stored, key)
+			return redis.NewInt([]byte("0"))
+		case "ZADD":
+			for _, arg := range multi[2:] {
+				stored[key] = append(stored[key], string(arg.Value))
+			}
+			return redis.NewInt([]byte(strconv.Itoa(len(multi[2:]) / 2)))
+		default:
+			return redis.NewErrorf("ERR unexpected %s", multi[0].Value)
+		}
+	}
+	b1, b2 := newFakeBackend(handler), newFakeBackend(handler)
+	defer b1.Close()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr(), b2.Addr())
+	defer d.Close()
+
+	limit := config.SetAlgebraMaxMembers
+	defer func() {
+		config.SetAlgebraMaxMembers = limit
+	}()
+	config.SetAlgebraMaxMembers = 2
+
+	result := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(stored["dst"], ",")
+	}
+
+	s := newTestSession()
+	resp := handleTestRequest(s, d, "ZUNIONSTORE", "dst", "2", "a", "b")
+	assert.Must(resp.IsInt() && string(resp.Value) == "3")
+	assert.Must(result() == "1,x,5,y,4,z")
+
+	resp = handleTestRequest(s, d, "ZINTERSTORE", "dst", "2", "a", "b", "WEIGHTS", "2", "0.5", "AGGREGATE", "MAX")
+	assert.Must(resp.IsInt() && string(resp.Value) == "1")
+	assert.Must(result() == "4,y")
+
+	resp = handleTestRequest(s, d, "ZINTERSTORE", "dst", "2", "a", "none")
+	assert.Must(resp.IsInt() && string(resp.Value) == "0")
+	assert.Must(result() == "")
+
+	config.SetAlgebraMaxMembers = 1
+	assert.Must(handleTestRequest(s, d, "ZUNIONSTORE", "dst", "2", "a", "b").IsError())
+	config.SetAlgebraMaxMembers = 2
+
+	assert.Must(handleTestRequest(s, d, "ZUNIONSTORE", "dst", "2", "a").IsError())
+	assert.Must(handleTestRequest(s, d, "ZUNIONSTORE", "dst", "2", "a", "b", "WEIGHTS", "1").IsError())
+	assert.Must(handleTestRequest(s, d, "ZUNIONSTORE", "dst", "2", "a", "b", "AGGREGATE", "AVG").IsError())
+
+	mu.Lock()
+	zsets["b"] = append(zsets["b"], "w", "5")
+	mu.Unlock()
+	assert.Must(handleTestRequest(s, d, "ZUNIONSTORE", "dst", "2", "a", "b").IsError())
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// flightMaxAge is the max age of a request in flight that others join, in
+// case the request is never left, e.g. its session is closed.
+const flightMaxAge = time.Second
+
+type flightCall struct {
+	leader *Request
+	start  int64
+}
+
+// flights are the requests in flight of the commands of singleflight_commands,
+// indexed by the database and the key, and then by the role of the backends
+// and the command, so that the flights of a key are dropped by its writes.
+var flights struct {
+	sync.Mutex
+	calls map[string]map[string]*flightCall
+
+	commands atomic.Value
+
+	collapsed atomic2.Int64
+}
+
+func init() {
+	flights.calls = make(map[string]map[string]*flightCall)
+	flights.commands.Store(map[string]bool{})
+}
+
+// SetSingleflightCommands sets the commands collapsed, as names separated by
+// commas, e.g. "get,hget".
+func SetSingleflightCommands(list string) {
+	var m = make(map[string]bool)
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			m[strings.ToUpper(s)] = true
+		}
+	}
+	flights.commands.Store(m)
+}
+
+// flightCmd returns the command of the request prefixed by the role of the
+// backend it's sent to, so that master reads never join replica reads. The
+// reads of a slot written recently by the session are sent to the master.
+func flightCmd(r *Request, d *Router, key []byte) string {
+	var replica = r.ReplicaRead && !r.MasterRead
+	if replica && r.Writes != nil {
+		replica = !r.Writes.isRecent(d.keySlot(key))
+	}
+	if replica {
+		return "r:" + hotCacheCmd(r.Multi)
+	}
+	return "m:" + hotCacheCmd(r.Multi)
+}
+
+// joinFlight makes the request wait for the reply of the same request in
+// flight, and returns true if it does. Otherwise, the request might be the
+// leader of others, as the second result, and it leaves the flight once it's
+// replied by the backend, see setResponse.
+func joinFlight(r *Request, d *Router) (joined, leader bool) {
+	if !r.IsReadOnly() || r.Namespace != "" || !flights.commands.Load().(map[string]bool)[r.OpStr] {
+		return false, false
+	}
+	var key = getHashKey(r.Multi, r.OpStr)
+	var k, cmd = hotCacheKey(r.Database, key), flightCmd(r, d, key)
+	var now = time.Now().UnixNano()
+
+	flights.Lock()
+	defer flights.Unlock()
+	if c := flights.calls[k][cmd]; c != nil && now-c.start < int64(flightMaxAge) {
+		var leader = c.leader
+		r.Coalesce = func() error {
+			leader.Batch.Wait()
+			r.Resp, r.Err = leader.Resp, leader.Err
+			return nil
+		}
+		flights.collapsed.Incr()
+		return true, false
+	}
+	var c = &flightCall{leader: r, start: now}
+	if flights.calls[k] == nil {
+		flights.calls[k] = make(map[string]*flightCall)
+	}
+	flights.calls[k][cmd] = c
+	r.flightLeave = func() {
+		flights.Lock()
+		defer flights.Unlock()
+		if m := flights.calls[k]; m[cmd] == c {
+			delete(m, cmd)
+			if len(m) == 0 {
+				delete(flights.calls, k)
+			}
+		}
+	}
+	return false, true
+}
+
+// leaveFlight removes the request from the flights, if it's the leader, so
+// that the requests afterwards aren't collapsed into the reply.
+func (r *Request) leaveFlight() {
+	if leave := r.flightLeave; leave != nil {
+		r.flightLeave = nil
+		leave()
+	}
+}
+
+// setFlightLeave leaves the flight before the coalescing of the request, in
+// case the request is answered without a reply of the backend.
+func setFlightLeave(r *Request) {
+	var coalesce = r.Coalesce
+	r.Coalesce = func() error {
+		r.leaveFlight()
+		if coalesce != nil {
+			return coalesce()
+		}
+		return nil
+	}
+}
+
+// invalidateFlights removes the flights of any key of the commands, which
+// are writes, so that the reads afterwards never join the reads before.
+func invalidateFlights(db int32, multis ...[]*redis.Resp) {
+	flights.Lock()
+	defer flights.Unlock()
+	if len(flights.calls) == 0 {
+		return
+	}
+	for _, multi := range multis {
+		for i := 1; i < len(multi); i++ {
+			delete(flights.calls, hotCacheKey(db, multi[i].Value))
+		}
+	}
+}
+
+// clearFlights removes all flights, e.g. for FLUSHALL.
+func clearFlights() {
+	flights.Lock()
+	defer flights.Unlock()
+	flights.calls = make(map[string]map[string]*flightCall)
+}
+
+func GetSingleflightCollapsed() int64 {
+	return flights.collapsed.Int64()
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+func TestSingleflight(t *testing.T) {
+	SetSingleflightCommands("get")
+	defer SetSingleflightCommands("")
+
+	var reads atomic2.Int64
+	b := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		reads.Incr()
+		time.Sleep(time.Millisecond * 100)
+		return redis.NewBulkBytes([]byte("value"))
+	})
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	var collapsed = GetSingleflightCollapsed()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := newTestSession()
+			assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "value")
+		}()
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+	assert.Must(reads.Int64() < 10 && GetSingleflightCollapsed()-collapsed == 10-reads.Int64())
+
+	// The requests after the reply aren't collapsed.
+	reads.Set(0)
+	s := newTestSession()
+	assert.Must(string(handleTestRequest(s, d, "GET", "key").Value) == "value")
+	assert.Must(string(handleTestRequest(s, d, "HGET", "key", "f").Value) == "value")
+	assert.Must(reads.Int64() == 2)
+}
+
+func TestSingleflightInvalidate(t *testing.T) {
+	SetSingleflightCommands("get")
+	defer SetSingleflightCommands("")
+	defer clearFlights()
+
+	get := func(replica bool) *Request {
+		r := newTestRequest("GET", "key")
+		opstr, flag, err := getOpInfo(r.Multi)
+		assert.MustNoError(err)
+		r.OpStr, r.OpFlag, r.ReplicaRead = opstr, flag, replica
+		return r
+	}
+	var r1 = get(false)
+	joined, leader := joinFlight(r1, nil)
+	assert.Must(!joined && leader)
+	joined, _ = joinFlight(get(false), nil)
+	assert.Must(joined)
+
+	// The replica reads never join the master reads.
+	var r2 = get(true)
+	joined, leader = joinFlight(r2, nil)
+	assert.Must(!joined && leader)
+
+	// The reads after a write of the key never join the reads before.
+	invalidateHotCache(0, []*redis.Resp{redis.NewBulkBytes([]byte("SET")), redis.NewBulkBytes([]byte("key"))})
+	var r3 = get(false)
+	joined, leader = joinFlight(r3, nil)
+	assert.Must(!joined && leader)
+
+	// The leader leaves once replied, the older leaders are no-op.
+	r1.leaveFlight()
+	joined, _ = joinFlight(get(false), nil)
+	assert.Must(joined)
+	r3.leaveFlight()
+	r2.leaveFlight()
+	joined, _ = joinFlight(get(false), nil)
+	assert.Must(!joined)
+}
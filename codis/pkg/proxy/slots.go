@@ -18,6 +18,7 @@ type Slot struct {
 	refs sync.WaitGroup
 
 	switched bool
+	fenced   bool
 
 	backend, migrate struct {
 		id int
@@ -26,12 +27,15 @@ type Slot struct {
 	replicaGroups [][]*sharedBackendConn
 
 	method forwardMethod
+
+	stats slotStats
 }
 
 func (s *Slot) snapshot() *models.Slot {
 	var m = &models.Slot{
 		Id:     s.id,
 		Locked: s.lock.hold,
+		Fenced: s.fenced,
 
 		BackendAddr:        s.backend.bc.Addr(),
 		BackendAddrGroupId: s.backend.id,
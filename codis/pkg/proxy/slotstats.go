@@ -0,0 +1,142 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"time"
+
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// slotStats are the statistics of the requests dispatched to a slot, the
+// latency is from the dispatch until the reply of the backend.
+type slotStats struct {
+	ops    atomic2.Int64
+	errors atomic2.Int64
+	nsecs  atomic2.Int64
+
+	qps atomic2.Int64
+	avg atomic2.Int64
+
+	// last are the counters at the last refresh, only used by refresh.
+	last struct {
+		ops, nsecs int64
+	}
+}
+
+// SlotStats are the statistics of a slot, QPS and AvgUsecs are of the last
+// refresh period.
+type SlotStats struct {
+	Id           int   `json:"id"`
+	Calls        int64 `json:"calls"`
+	Errors       int64 `json:"errors"`
+	Usecs        int64 `json:"usecs"`
+	UsecsPercall int64 `json:"usecs_percall"`
+	QPS          int64 `json:"qps"`
+	AvgUsecs     int64 `json:"avg_usecs"`
+}
+
+func (s *slotStats) dispatch(r *Request, id int) {
+	s.ops.Incr()
+	r.slotStats, r.slotStart = s, time.Now().UnixNano()
+	r.slot = id
+}
+
+// fail counts the request failed before being sent to a backend.
+func (s *slotStats) fail(err error) error {
+	if err != nil {
+		s.errors.Incr()
+	}
+	return err
+}
+
+func (s *slotStats) done(r *Request, failed bool) {
+	s.nsecs.Add(time.Now().UnixNano() - r.slotStart)
+	if failed {
+		s.errors.Incr()
+	}
+}
+
+func (s *slotStats) refresh(elapsed time.Duration) {
+	var ops, nsecs = s.ops.Int64(), s.nsecs.Int64()
+	var calls = ops - s.last.ops
+	switch {
+	case calls <= 0:
+		s.qps.Set(0)
+		s.avg.Set(0)
+	default:
+		s.qps.Set(int64(float64(calls)*float64(time.Second)/float64(elapsed) + 0.5))
+		if d := nsecs - s.last.nsecs; d > 0 {
+			s.avg.Set(d / calls / 1e3)
+		} else {
+			s.avg.Set(0)
+		}
+	}
+	s.last.ops, s.last.nsecs = ops, nsecs
+}
+
+func (s *slotStats) reset() {
+	s.ops.Set(0)
+	s.errors.Set(0)
+	s.nsecs.Set(0)
+}
+
+// SlotStats returns the statistics of the slots ever dispatched, ordered by
+// the id of the slot.
+func (s *Router) SlotStats() []*SlotStats {
+	var array []*SlotStats
+	for i := range s.slots {
+		var x = &s.slots[i].stats
+		var calls = x.ops.Int64()
+		if calls == 0 {
+			continue
+		}
+		var o = &SlotStats{
+			Id: i, Calls: calls,
+			Errors:   x.errors.Int64(),
+			Usecs:    x.nsecs.Int64() / 1e3,
+			QPS:      x.qps.Int64(),
+			AvgUsecs: x.avg.Int64(),
+		}
+		o.UsecsPercall = o.Usecs / calls
+		array = append(array, o)
+	}
+	return array
+}
+
+func (s *Router) refreshSlotStats(elapsed time.Duration) {
+	for i := range s.slots {
+		s.slots[i].stats.refresh(elapsed)
+	}
+}
+
+func (s *Router) resetSlotStats() {
+	for i := range s.slots {
+		s.slots[i].stats.reset()
+	}
+}
+
+// loopSlotStats refreshes the QPS and latency of the slots every second.
+func (p *Proxy) loopSlotStats() {
+	var ticker = time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var last = time.Now()
+	for {
+		select {
+		case <-p.exit.C:
+			return
+		case now := <-ticker.C:
+			p.router.refreshSlotStats(now.Sub(last))
+			last = now
+		}
+	}
+}
+
+func (p *Proxy) SlotStats() []*SlotStats {
+	return p.router.SlotStats()
+}
+
+func (p *Proxy) ResetSlotStats() {
+	p.router.resetSlotStats()
+}
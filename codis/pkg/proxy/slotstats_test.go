@@ -0,0 +1,74 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestSlotStats(t *testing.T) {
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		if string(multi[1].Value) == "bad" {
+			return redis.NewErrorf("ERR bad")
+		}
+		return redis.NewBulkBytes([]byte("v"))
+	})
+	defer backend.Close()
+
+	var conf = *config
+	p, err := New(&conf)
+	assert.MustNoError(err)
+	defer p.Close()
+
+	var id = int(Hash([]byte("key")) % uint32(models.GetMaxSlotNum()))
+	var bad = int(Hash([]byte("bad")) % uint32(models.GetMaxSlotNum()))
+	assert.MustNoError(p.router.FillSlot(&models.Slot{Id: id, BackendAddr: backend.Addr()}))
+	assert.MustNoError(p.router.FillSlot(&models.Slot{Id: bad, BackendAddr: backend.Addr()}))
+	assert.MustNoError(p.Start())
+
+	c, err := redis.DialTimeout(p.Model().ProxyAddr, time.Second*5, 1024, 1024)
+	assert.MustNoError(err)
+	defer c.Close()
+	for _, key := range []string{"key", "key", "bad"} {
+		assert.MustNoError(c.EncodeMultiBulk([]*redis.Resp{
+			redis.NewBulkBytes([]byte("GET")), redis.NewBulkBytes([]byte(key)),
+		}, true))
+		_, err := c.Decode()
+		assert.MustNoError(err)
+	}
+
+	var stats = make(map[int]*SlotStats)
+	for _, x := range p.SlotStats() {
+		stats[x.Id] = x
+	}
+	assert.Must(stats[id].Calls == 2 && stats[id].Errors == 0)
+	assert.Must(stats[bad].Calls == 1 && stats[bad].Errors == 1)
+	assert.Must(len(p.Stats(StatsSlots).Slots) == len(stats))
+
+	p.ResetSlotStats()
+	assert.Must(len(p.SlotStats()) == 0)
+}
+
+func TestSlotStatsRefresh(t *testing.T) {
+	var s = &slotStats{}
+	for i := 0; i < 10; i++ {
+		s.dispatch(&Request{}, 0)
+	}
+	s.nsecs.Set(int64(time.Millisecond * 20))
+	s.refresh(time.Second * 2)
+	assert.Must(s.qps.Int64() == 5 && s.avg.Int64() == 2000)
+
+	s.refresh(time.Second)
+	assert.Must(s.qps.Int64() == 0 && s.avg.Int64() == 0)
+
+	s.reset()
+	s.ops.Set(3)
+	s.refresh(time.Second)
+	assert.Must(s.qps.Int64() == 0)
+}
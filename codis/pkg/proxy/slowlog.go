@@ -0,0 +1,359 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
+)
+
+const (
+	MaxSlowlogEntries = 128
+
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+// SlowlogEntry is a slow request, the duration is split into the time in the
+// queue until sent to the backend, the round trip time of the backend, and
+// the time until the reply is written, which are -1 if not sent.
+type SlowlogEntry struct {
+	Id         int64    `json:"id"`
+	UnixTime   int64    `json:"unixtime"`
+	Duration   int64    `json:"duration"`
+	Args       []string `json:"args"`
+	RemoteAddr string   `json:"remote_addr"`
+	ClientName string   `json:"client_name,omitempty"`
+	Backend    string   `json:"backend,omitempty"`
+	QueueUsecs int64    `json:"queue_usecs"`
+	RttUsecs   int64    `json:"rtt_usecs"`
+	ReplyUsecs int64    `json:"reply_usecs"`
+}
+
+var slowlog struct {
+	sync.Mutex
+	entries [MaxSlowlogEntries]*SlowlogEntry
+	head    int
+	size    int
+	nextId  int64
+
+	changes, saved int64
+}
+
+// slowlogArgs copies the command arguments, trimming them the same way
+// redis does so that huge requests won't blow up the slowlog.
+func slowlogArgs(multi []*redis.Resp) []string {
+	var argc = len(multi)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	var args = make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		if i == slowlogMaxArgc-1 && len(multi) > slowlogMaxArgc {
+			args = append(args, fmt.Sprintf("... (%d more arguments)", len(multi)-slowlogMaxArgc+1))
+			break
+		}
+		value := multi[i].Value
+		if len(value) > slowlogMaxArgLen {
+			args = append(args, fmt.Sprintf("%s... (%d more bytes)", value[:slowlogMaxArgLen], len(value)-slowlogMaxArgLen))
+		} else {
+			args = append(args, string(value))
+		}
+	}
+	return args
+}
+
+func recordSlowlog(multi []*redis.Resp, e *SlowlogEntry) {
+	e.Args = slowlogArgs(multi)
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	e.Id = slowlog.nextId
+	slowlog.nextId++
+	slowlog.head = (slowlog.head + MaxSlowlogEntries - 1) % MaxSlowlogEntries
+	slowlog.entries[slowlog.head] = e
+	if slowlog.size < MaxSlowlogEntries {
+		slowlog.size++
+	}
+	slowlog.changes++
+}
+
+// GetSlowlog returns at most n entries, newest first. n < 0 means all.
+func GetSlowlog(n int) []*SlowlogEntry {
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	if n < 0 || n > slowlog.size {
+		n = slowlog.size
+	}
+	var all = make([]*SlowlogEntry, 0, n)
+	for i := 0; i < n; i++ {
+		all = append(all, slowlog.entries[(slowlog.head+i)%MaxSlowlogEntries])
+	}
+	return all
+}
+
+func SlowlogLen() int {
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	return slowlog.size
+}
+
+func ResetSlowlog() {
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	for i := range slowlog.entries {
+		slowlog.entries[i] = nil
+	}
+	slowlog.head = 0
+	slowlog.size = 0
+	slowlog.changes++
+}
+
+// SlowlogFilter selects the entries of the command, the first key matching
+// the glob pattern, and the duration in us of at least MinDuration.
+type SlowlogFilter struct {
+	Cmd         string
+	KeyPattern  string
+	MinDuration int64
+}
+
+func (f *SlowlogFilter) match(e *SlowlogEntry) bool {
+	switch {
+	case f == nil:
+		return true
+	case f.Cmd != "" && (len(e.Args) == 0 || !strings.EqualFold(e.Args[0], f.Cmd)):
+		return false
+	case f.KeyPattern != "" && (len(e.Args) < 2 || !globMatch(f.KeyPattern, e.Args[1])):
+		return false
+	}
+	return e.Duration >= f.MinDuration
+}
+
+// FilterSlowlog returns at most n entries matching the filter, newest first.
+// n < 0 means all.
+func FilterSlowlog(n int, f *SlowlogFilter) []*SlowlogEntry {
+	var all []*SlowlogEntry
+	for _, e := range GetSlowlog(-1) {
+		if n >= 0 && len(all) >= n {
+			break
+		}
+		if f.match(e) {
+			all = append(all, e)
+		}
+	}
+	return all
+}
+
+// slowlogEntryResp returns the entry as of SLOWLOG GET, with the backend and
+// the split of the duration appended if verbose.
+func slowlogEntryResp(e *SlowlogEntry, verbose bool) *redis.Resp {
+	var args = make([]*redis.Resp, len(e.Args))
+	for i := range e.Args {
+		args[i] = redis.NewBulkBytes([]byte(e.Args[i]))
+	}
+	var entry = []*redis.Resp{
+		redis.NewInt(strconv.AppendInt(nil, e.Id, 10)),
+		redis.NewInt(strconv.AppendInt(nil, e.UnixTime, 10)),
+		redis.NewInt(strconv.AppendInt(nil, e.Duration, 10)),
+		redis.NewArray(args),
+		redis.NewBulkBytes([]byte(e.RemoteAddr)),
+		redis.NewBulkBytes([]byte(e.ClientName)),
+	}
+	if verbose {
+		entry = append(entry, redis.NewArray([]*redis.Resp{
+			redis.NewBulkBytes([]byte("backend")), redis.NewBulkBytes([]byte(e.Backend)),
+			redis.NewBulkBytes([]byte("queue_usecs")), redis.NewInt(strconv.AppendInt(nil, e.QueueUsecs, 10)),
+			redis.NewBulkBytes([]byte("rtt_usecs")), redis.NewInt(strconv.AppendInt(nil, e.RttUsecs, 10)),
+			redis.NewBulkBytes([]byte("reply_usecs")), redis.NewInt(strconv.AppendInt(nil, e.ReplyUsecs, 10)),
+		}))
+	}
+	return redis.NewArray(entry)
+}
+
+// LoadSlowlog restores the slowlog saved by SaveSlowlog, it's fine if the
+// file doesn't exist.
+func LoadSlowlog(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+	var all []*SlowlogEntry
+	if err := json.Unmarshal(b, &all); err != nil {
+		return errors.Trace(err)
+	}
+	if len(all) > MaxSlowlogEntries {
+		all = all[:MaxSlowlogEntries]
+	}
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	for i := range slowlog.entries {
+		slowlog.entries[i] = nil
+	}
+	slowlog.head, slowlog.size = 0, len(all)
+	for i, e := range all {
+		slowlog.entries[i] = e
+		if e.Id >= slowlog.nextId {
+			slowlog.nextId = e.Id + 1
+		}
+	}
+	return nil
+}
+
+// SaveSlowlog writes the slowlog to the file if it's changed since it was
+// saved successfully last time.
+func SaveSlowlog(path string) error {
+	slowlog.Lock()
+	var changes, saved = slowlog.changes, slowlog.saved
+	slowlog.Unlock()
+	if changes == saved {
+		return nil
+	}
+	b, err := json.MarshalIndent(GetSlowlog(-1), "", "    ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var tmp = path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Trace(err)
+	}
+	slowlog.Lock()
+	slowlog.saved = changes
+	slowlog.Unlock()
+	return nil
+}
+
+// ExportSlowlog sends the entries to the target, in a JSON array POSTed if
+// it's an HTTP URL, or otherwise appended to the file as JSON lines.
+func ExportSlowlog(target string, entries []*SlowlogEntry) error {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		if entries == nil {
+			entries = []*SlowlogEntry{}
+		}
+		return rpc.ApiPostJson(target, entries)
+	}
+	var buf bytes.Buffer
+	var enc = json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+// parseSlowlogFilter parses the filters of XSLOWLOG, [CMD name] [KEY pattern]
+// [MINDURATION us].
+func parseSlowlogFilter(args []*redis.Resp) (*SlowlogFilter, error) {
+	if len(args)%2 != 0 {
+		return nil, errors.New("ERR syntax error")
+	}
+	var f = &SlowlogFilter{}
+	for i := 0; i < len(args); i += 2 {
+		var value = string(args[i+1].Value)
+		switch strings.ToUpper(string(args[i].Value)) {
+		case "CMD":
+			f.Cmd = value
+		case "KEY":
+			f.KeyPattern = value
+		case "MINDURATION":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("ERR min duration should be greater than or equal to 0")
+			}
+			f.MinDuration = n
+		default:
+			return nil, errors.New("ERR syntax error")
+		}
+	}
+	return f, nil
+}
+
+// handleXSlowlog handles XSLOWLOG GET [count] [filters], LEN [filters], RESET
+// and EXPORT [filters], which sends the entries to slowlog_export_target in
+// the background, and replies the number of entries at once.
+func (s *Session) handleXSlowlog(r *Request) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'XSLOWLOG' command")
+		return nil
+	}
+	var subCmd = strings.ToUpper(string(r.Multi[1].Value))
+	var args = r.Multi[2:]
+	var n = -1
+	if subCmd == "GET" {
+		n = 10
+		if len(args)%2 != 0 {
+			v, err := strconv.Atoi(string(args[0].Value))
+			if err != nil || v < -1 {
+				r.Resp = redis.NewErrorf("ERR count should be greater than or equal to -1")
+				return nil
+			}
+			n, args = v, args[1:]
+		}
+	}
+	switch subCmd {
+	case "GET", "LEN", "EXPORT":
+		f, err := parseSlowlogFilter(args)
+		if err != nil {
+			r.Resp = redis.NewErrorf("%s", err)
+			return nil
+		}
+		var entries = FilterSlowlog(n, f)
+		switch subCmd {
+		case "GET":
+			var array = make([]*redis.Resp, 0, len(entries))
+			for _, e := range entries {
+				array = append(array, slowlogEntryResp(e, true))
+			}
+			r.Resp = redis.NewArray(array)
+		case "LEN":
+			r.Resp = redis.NewInt(strconv.AppendInt(nil, int64(len(entries)), 10))
+		case "EXPORT":
+			var target = s.config.SlowlogExportTarget
+			if target == "" {
+				r.Resp = redis.NewErrorf("ERR slowlog_export_target is not set")
+				return nil
+			}
+			go func() {
+				if err := ExportSlowlog(target, entries); err != nil {
+					log.WarnErrorf(err, "session [%p] export slowlog to %s failed", s, target)
+				}
+			}()
+			r.Resp = redis.NewInt(strconv.AppendInt(nil, int64(len(entries)), 10))
+		}
+	case "RESET":
+		if len(args) != 0 {
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		}
+		ResetSlowlog()
+		r.Resp = RespOK
+	default:
+		r.Resp = redis.NewErrorf("ERR Unknown XSLOWLOG subcommand or wrong args. Try GET [count] [CMD name] [KEY pattern] [MINDURATION us], LEN, RESET, EXPORT.")
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestSlowlogArgs(t *testing.T) {
+	var multi []*redis.Resp
+	for i := 0; i < slowlogMaxArgc+8; i++ {
+		multi = append(multi, redis.NewBulkBytes([]byte(strconv.Itoa(i))))
+	}
+	multi[1] = redis.NewBulkBytes(make([]byte, slowlogMaxArgLen+10))
+
+	args := slowlogArgs(multi)
+	assert.Must(len(args) == slowlogMaxArgc)
+	assert.Must(len(args[1]) > slowlogMaxArgLen)
+	assert.Must(args[slowlogMaxArgc-1] == "... (9 more arguments)")
+}
+
+func TestSlowlogCommand(t *testing.T) {
+	var saved = config.SlowlogLogSlowerThan
+	config.SlowlogLogSlowerThan = 0
+	defer func() {
+		config.SlowlogLogSlowerThan = saved
+	}()
+	ResetSlowlog()
+	defer ResetSlowlog()
+
+	p, _ := openProxy()
+	defer p.Close()
+	assert.MustNoError(p.Start())
+
+	c, err := redis.DialTimeout(p.Model().ProxyAddr, time.Second*5, 1024, 1024)
+	assert.MustNoError(err)
+	defer c.Close()
+
+	do := func(args ...string) *redis.Resp {
+		var multi = make([]*redis.Resp, len(args))
+		for i := range args {
+			multi[i] = redis.NewBulkBytes([]byte(args[i]))
+		}
+		assert.MustNoError(c.EncodeMultiBulk(multi, true))
+		resp, err := c.Decode()
+		assert.MustNoError(err)
+		return resp
+	}
+
+	resp := do("SLOWLOG", "LEN")
+	assert.Must(resp.IsInt() && string(resp.Value) == "0")
+
+	// The entry is recorded right after the reply has been flushed.
+	for i := 0; i < 100 && SlowlogLen() == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	resp = do("SLOWLOG", "GET")
+	assert.Must(resp.IsArray() && len(resp.Array) == 1)
+	entry := resp.Array[0]
+	assert.Must(entry.IsArray() && len(entry.Array) == 6)
+	args := entry.Array[3]
+	assert.Must(len(args.Array) == 2 && string(args.Array[1].Value) == "LEN")
+
+	resp = do("SLOWLOG", "GET", "1", "VERBOSE")
+	entry = resp.Array[0]
+	assert.Must(len(entry.Array) == 7 && len(entry.Array[6].Array) == 8)
+	assert.Must(string(entry.Array[6].Array[2].Value) == "queue_usecs" && string(entry.Array[6].Array[3].Value) == "-1")
+	assert.Must(do("SLOWLOG", "GET", "1", "FULL").IsError())
+
+	assert.Must(do("SLOWLOG", "RESET").IsString())
+	resp = do("SLOWLOG", "GET", "-1")
+	assert.Must(resp.IsArray())
+	for _, entry := range resp.Array {
+		assert.Must(string(entry.Array[3].Array[1].Value) != "LEN")
+	}
+	assert.Must(do("SLOWLOG", "GET", "x").IsError())
+}
+
+func TestSlowlogApi(t *testing.T) {
+	ResetSlowlog()
+	defer ResetSlowlog()
+
+	p, addr := openProxy()
+	defer p.Close()
+
+	recordSlowlog([]*redis.Resp{redis.NewBulkBytes([]byte("GET")), redis.NewBulkBytes([]byte("key"))}, &SlowlogEntry{
+		UnixTime: 100, Duration: 3000, RemoteAddr: "127.0.0.1:1000", ClientName: "app",
+		Backend: "127.0.0.1:6379", QueueUsecs: 1000, RttUsecs: 1500, ReplyUsecs: 500,
+	})
+
+	var c = NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, p.Model().Token)
+	entries, err := c.Slowlog()
+	assert.MustNoError(err)
+	assert.Must(len(entries) == 1)
+	var e = entries[0]
+	assert.Must(len(e.Args) == 2 && e.ClientName == "app" && e.Backend == "127.0.0.1:6379")
+	assert.Must(e.QueueUsecs == 1000 && e.RttUsecs == 1500 && e.ReplyUsecs == 500)
+
+	assert.MustNoError(c.ResetSlowlog())
+	assert.Must(SlowlogLen() == 0)
+}
+
+func TestXSlowlog(t *testing.T) {
+	ResetSlowlog()
+	defer ResetSlowlog()
+
+	record := func(duration int64, args ...string) {
+		var multi []*redis.Resp
+		for _, arg := range args {
+			multi = append(multi, redis.NewBulkBytes([]byte(arg)))
+		}
+		recordSlowlog(multi, &SlowlogEntry{UnixTime: 100, Duration: duration, ReplyUsecs: -1})
+	}
+	record(1000, "GET", "user:1")
+	record(5000, "SET", "user:2", "v")
+	record(9000, "get", "order:1")
+
+	s := newTestSession()
+	resp := handleTestRequest(s, nil, "XSLOWLOG", "GET", "CMD", "get")
+	assert.Must(resp.IsArray() && len(resp.Array) == 2 && len(resp.Array[0].Array) == 7)
+	assert.Must(string(resp.Array[0].Array[3].Array[1].Value) == "order:1")
+	resp = handleTestRequest(s, nil, "XSLOWLOG", "GET", "1", "KEY", "user:*")
+	assert.Must(len(resp.Array) == 1 && string(resp.Array[0].Array[3].Array[1].Value) == "user:2")
+	resp = handleTestRequest(s, nil, "XSLOWLOG", "LEN", "MINDURATION", "5000")
+	assert.Must(resp.IsInt() && string(resp.Value) == "2")
+	assert.Must(handleTestRequest(s, nil, "XSLOWLOG", "GET", "KEY").IsError())
+	assert.Must(handleTestRequest(s, nil, "XSLOWLOG", "LEN", "MINDURATION", "-1").IsError())
+	assert.Must(handleTestRequest(s, nil, "XSLOWLOG", "EXPORT").IsError())
+
+	var dir = t.TempDir()
+	var conf = *config
+	conf.SlowlogExportTarget = filepath.Join(dir, "export.json")
+	s.config = &conf
+	resp = handleTestRequest(s, nil, "XSLOWLOG", "EXPORT", "CMD", "GET")
+	assert.Must(resp.IsInt() && string(resp.Value) == "2")
+	var lines int
+	for i := 0; lines != 2; i++ {
+		assert.Must(i < 100)
+		time.Sleep(time.Millisecond * 10)
+		f, err := os.Open(conf.SlowlogExportTarget)
+		if err != nil {
+			continue
+		}
+		lines = 0
+		for scanner := bufio.NewScanner(f); scanner.Scan(); {
+			lines++
+		}
+		f.Close()
+	}
+
+	// The slowlog is saved again if it failed to be saved.
+	var path = filepath.Join(dir, "slowlog.json")
+	assert.Must(SaveSlowlog(filepath.Join(dir, "missing", "slowlog.json")) != nil)
+	assert.MustNoError(SaveSlowlog(path))
+	_, err := os.Stat(path)
+	assert.MustNoError(err)
+	assert.Must(handleTestRequest(s, nil, "XSLOWLOG", "RESET").IsString())
+	assert.Must(SlowlogLen() == 0)
+	assert.MustNoError(LoadSlowlog(path))
+	assert.Must(SlowlogLen() == 3 && GetSlowlog(1)[0].Args[1] == "order:1")
+	record(1000, "DEL", "user:3")
+	assert.Must(GetSlowlog(1)[0].Id > GetSlowlog(2)[1].Id)
+	assert.MustNoError(LoadSlowlog(filepath.Join(dir, "missing.json")))
+}
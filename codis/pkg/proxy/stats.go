@@ -18,13 +18,6 @@ import (
 )
 
 const (
-	TPFirstGrade            = 5 //5ms - 200ms
-	TPFirstGradeSize        = 40
-	TPSecondGrade           = 25 //225ms - 700ms
-	TPSecondGradeSize       = 20
-	TPThirdGrade            = 250 //950ms - 3200ms
-	TPThirdGradeSize        = 10
-	TPMaxNum                = TPFirstGradeSize + TPSecondGradeSize + TPThirdGradeSize
 	ClearSlowFlagPeriodRate = 3 // The cleanup cycle for slow commands is three times the duration of the statistics cycle.
 	IntervalNum             = 5
 	DelayKindNum            = 8
@@ -37,6 +30,9 @@ var (
 
 	// Unit: ms
 	DelayNumMark = [DelayKindNum]int64{50, 100, 200, 300, 500, 1000, 2000, 3000}
+
+	// The quantiles computed from the latency histogram of each command.
+	TPQuantiles = [...]float64{0.5, 0.9, 0.95, 0.99, 0.999, 0.9999}
 )
 
 type delayInfo struct {
@@ -44,15 +40,14 @@ type delayInfo struct {
 	calls    atomic2.Int64
 	nsecs    atomic2.Int64
 	nsecsmax atomic2.Int64
-	avg      int64
 	qps      atomic2.Int64
 
-	tp     [TPMaxNum]atomic2.Int64
-	tp90   int64
-	tp99   int64
-	tp999  int64
-	tp9999 int64
-	tp100  int64
+	// mu guards the values computed by RefreshOpStats, which are read by
+	// the snapshots of the stats, e.g. GetOpStatsAll.
+	mu    sync.Mutex
+	avg   int64
+	tpus  [len(TPQuantiles)]int64 // us
+	tp100 int64
 
 	delayCount [DelayKindNum]atomic2.Int64
 	delay50ms  int64
@@ -79,6 +74,10 @@ type opStats struct {
 		errors atomic2.Int64
 	}
 	maxDelay atomic2.Int64
+
+	// hist is shared by the intervals, which are refreshed together.
+	hist    latencyHistogram
+	buckets [len(latencyBuckets)]atomic2.Int64
 }
 
 type OpStats struct {
@@ -95,12 +94,19 @@ type OpStats struct {
 	MaxDelay     int64 `json:"max_delay"`
 	QPS          int64 `json:"qps"`
 	AVG          int64 `json:"avg"`
+	TP50         int64 `json:"tp50"`
 	TP90         int64 `json:"tp90"`
+	TP95         int64 `json:"tp95"`
 	TP99         int64 `json:"tp99"`
 	TP999        int64 `json:"tp999"`
 	TP9999       int64 `json:"tp9999"`
 	TP100        int64 `json:"tp100"`
 
+	P50Usecs  int64 `json:"p50_usecs"`
+	P95Usecs  int64 `json:"p95_usecs"`
+	P99Usecs  int64 `json:"p99_usecs"`
+	P999Usecs int64 `json:"p999_usecs"`
+
 	Delay50ms  int64 `json:"delay50ms"`
 	Delay100ms int64 `json:"delay100ms"`
 	Delay200ms int64 `json:"delay200ms"`
@@ -119,6 +125,7 @@ var (
 var cmdstats struct {
 	opmapLock sync.RWMutex //Lock only for opmap.
 	opmap     map[string]*opStats
+	unknown   int
 
 	total atomic2.Int64
 	fails atomic2.Int64
@@ -127,7 +134,6 @@ var cmdstats struct {
 	}
 
 	qps             atomic2.Int64
-	tpDelay         [TPMaxNum]int64 //us
 	refreshPeriod   atomic2.Int64
 	logSlowerThan   atomic2.Int64
 	autoSetSlowFlag atomic2.Bool
@@ -182,17 +188,6 @@ func init() {
 	cmdstats.opmap = make(map[string]*opStats, 128)
 	cmdstats.refreshPeriod.Set(int64(time.Second))
 
-	//init tp delay array
-	for i := 0; i < TPMaxNum; i++ {
-		if i < TPFirstGradeSize {
-			cmdstats.tpDelay[i] = int64(i+1) * TPFirstGrade
-		} else if i < TPFirstGradeSize+TPSecondGradeSize {
-			cmdstats.tpDelay[i] = TPFirstGradeSize*TPFirstGrade + int64(i-TPFirstGradeSize+1)*TPSecondGrade
-		} else {
-			cmdstats.tpDelay[i] = TPFirstGradeSize*TPFirstGrade + TPSecondGradeSize*TPSecondGrade + int64(i-TPFirstGradeSize-TPSecondGradeSize+1)*TPThirdGrade
-		}
-	}
-
 	// init LastRefreshTime array
 	for i := 0; i < IntervalNum; i++ {
 		LastRefreshTime[i] = time.Now()
@@ -210,13 +205,10 @@ func init() {
 			func() {
 				cmdstats.opmapLock.RLock()
 				defer cmdstats.opmapLock.RUnlock()
+				for _, v := range cmdstats.opmap {
+					v.RefreshOpStats()
+				}
 				for i := 0; i < IntervalNum; i++ {
-					/*if int64(float64(time.Since(LastRefreshTime[i]))/float64(time.Second)) < IntervalMark[i] {
-						continue
-					}*/
-					for _, v := range cmdstats.opmap {
-						v.RefreshOpStats(i)
-					}
 					LastRefreshTime[i] = time.Now()
 				}
 			}()
@@ -224,8 +216,9 @@ func init() {
 	}()
 }
 
-func (s *delayInfo) refreshTpInfo(cmd string) {
-	s.refresh4TpInfo(cmd)
+// refreshTpInfo sets the quantiles in us computed from the histogram.
+func (s *delayInfo) refreshTpInfo(tpus []int64) {
+	copy(s.tpus[:], tpus)
 	s.tp100 = s.nsecsmax.Int64() / 1e6
 	if calls := s.calls.Int64(); calls != 0 {
 		s.avg = s.nsecs.Int64() / 1e6 / calls
@@ -234,99 +227,16 @@ func (s *delayInfo) refreshTpInfo(cmd string) {
 	}
 }
 
-func (s *delayInfo) refresh4TpInfo(cmd string) {
-	persents1 := 0.9
-	persents2 := 0.99
-	persents3 := 0.999
-	persents4 := 0.9999
-
-	if s.calls.Int64() == 0 {
-		s.tp90 = 0
-		s.tp99 = 0
-		s.tp999 = 0
-		s.tp9999 = 0
-		return
-	}
-
-	tpnum1 := int64(float64(s.calls.Int64()) * persents1)
-	tpnum2 := int64(float64(s.calls.Int64()) * persents2)
-	tpnum3 := int64(float64(s.calls.Int64()) * persents3)
-	tpnum4 := int64(float64(s.calls.Int64()) * persents4)
-
-	var index1, index2, index3, index4 int
-	var count int64
-	var i int
-
-	for i = 0; i < len(s.tp); i++ {
-		count += s.tp[i].Int64()
-		if count >= tpnum1 || i == len(s.tp)-1 {
-			index1 = i
-			break
-		}
-	}
-
-	if count >= tpnum2 || i == len(s.tp)-1 {
-		index2 = i
-	} else {
-		for i = i + 1; i < len(s.tp); i++ {
-			count += s.tp[i].Int64()
-			if count >= tpnum2 || i == len(s.tp)-1 {
-				index2 = i
-				break
-			}
-		}
-	}
-
-	if count >= tpnum3 || i == len(s.tp)-1 {
-		index3 = i
-	} else {
-		for i = i + 1; i < len(s.tp); i++ {
-			count += s.tp[i].Int64()
-			if count >= tpnum3 || i == len(s.tp)-1 {
-				index3 = i
-				break
-			}
-		}
-	}
-
-	if count >= tpnum4 || i == len(s.tp)-1 {
-		index4 = i
-	} else {
-		for i = i + 1; i < len(s.tp); i++ {
-			count += s.tp[i].Int64()
-			if count >= tpnum4 || i == len(s.tp)-1 {
-				index4 = i
-				break
-			}
-		}
-	}
-
-	// If an anomaly occurs in the statistics, print a log line.
-	if i == len(s.tp)-1 && s.tp[i].Int64() <= 0 {
-		log.Warnf("refreshTpInfo err: cmd-[%s] tpinfo is unavailable", cmd)
-	}
-
-	if index1 >= 0 && index2 >= index1 && index3 >= index2 && index4 >= index3 && index4 < TPMaxNum {
-		s.tp90 = cmdstats.tpDelay[index1]
-		s.tp99 = cmdstats.tpDelay[index2]
-		s.tp999 = cmdstats.tpDelay[index3]
-		s.tp9999 = cmdstats.tpDelay[index4]
-		return
-	}
-
-	log.Warnf("refreshTpInfo err: cmd-[%s] reset exception tpinf", cmd)
-	s.tp90 = -1
-	s.tp99 = -1
-	s.tp999 = -1
-	s.tp9999 = -1
-	return
+// tp returns the latency of the quantile in ms, rounded up like the upper
+// bound of a bucket.
+func (s *delayInfo) tp(i int) int64 {
+	return (s.tpus[i] + 999) / 1e3
 }
 
 func (s *delayInfo) resetTpInfo() {
 	s.calls.Set(0)
 	s.nsecs.Set(0)
 	s.nsecsmax.Set(0)
-	s.tp = [TPMaxNum]atomic2.Int64{0}
 }
 
 func (s *delayInfo) refreshDelayInfo() {
@@ -346,29 +256,6 @@ func (s *delayInfo) resetDelayInfo() {
 
 // The unit of duration in IncrTP() is nanoseconds (ns).
 func (s *opStats) incrTP(duration int64) {
-	var index int64 = -1
-	var duration_ms int64 = duration / 1e6
-	if duration_ms <= 0 {
-		//s.tp[0].Incr()
-		index = 0
-	} else if duration_ms <= TPFirstGrade*TPFirstGradeSize {
-		index = (duration_ms+TPFirstGrade-1)/TPFirstGrade - 1
-		//s.tp[index].Incr()
-	} else if duration_ms <= TPFirstGrade*TPFirstGradeSize+TPSecondGrade*TPSecondGradeSize {
-		index = (duration_ms-TPFirstGrade*TPFirstGradeSize+TPSecondGrade-1)/TPSecondGrade + TPFirstGradeSize - 1
-		//s.tp[index].Incr()
-	} else if duration_ms <= TPFirstGrade*TPFirstGradeSize+TPSecondGrade*TPSecondGradeSize+TPThirdGrade*TPThirdGradeSize {
-		index = (duration_ms-TPFirstGrade*TPFirstGradeSize-TPSecondGrade*TPSecondGradeSize+TPThirdGrade-1)/TPThirdGrade + TPFirstGradeSize + TPSecondGradeSize - 1
-		//s.tp[index].Incr()
-	} else {
-		index = TPMaxNum - 1
-		//s.tp[TPMaxNum-1].Incr()
-	}
-
-	if index < 0 {
-		return
-	}
-
 	for i := 0; i < IntervalNum; i++ {
 		s.delayInfo[i].calls.Incr()
 		s.delayInfo[i].nsecs.Add(duration)
@@ -390,22 +277,34 @@ func (s *opStats) incrTP(duration int64) {
 				}
 			}
 		}
-		s.delayInfo[i].tp[index].Incr()
 	}
 }
 
-func (s *opStats) RefreshOpStats(index int) {
-	if index < 0 || index >= IntervalNum {
-		return
+func (s *opStats) RefreshOpStats() {
+	tpus := s.hist.percentiles(TPQuantiles[:]...)
+	s.hist.reset()
+
+	for index := 0; index < IntervalNum; index++ {
+		normalized := math.Max(0, float64(s.delayInfo[index].calls.Int64())) / float64(time.Since(LastRefreshTime[index])) * float64(time.Second)
+		s.delayInfo[index].qps.Set(int64(normalized + 0.5))
+
+		s.delayInfo[index].mu.Lock()
+		s.delayInfo[index].refreshTpInfo(tpus)
+		s.delayInfo[index].resetTpInfo()
+
+		// Count the number of timed-out commands.
+		s.delayInfo[index].refreshDelayInfo()
+		s.delayInfo[index].resetDelayInfo()
+		s.delayInfo[index].mu.Unlock()
 	}
-	normalized := math.Max(0, float64(s.delayInfo[index].calls.Int64())) / float64(time.Since(LastRefreshTime[index])) * float64(time.Second)
-	s.delayInfo[index].qps.Set(int64(normalized + 0.5))
-	s.delayInfo[index].refreshTpInfo(s.opstr)
-	s.delayInfo[index].resetTpInfo()
+}
 
-	// Count the number of timed-out commands.
-	s.delayInfo[index].refreshDelayInfo()
-	s.delayInfo[index].resetDelayInfo()
+// quantiles returns the latencies of TPQuantiles in us, as of the last
+// refresh.
+func (s *delayInfo) quantiles() [len(TPQuantiles)]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tpus
 }
 
 // The unit of duration is milliseconds (ms).
@@ -433,6 +332,8 @@ func (s *opStats) GetOpStatsByInterval(interval int64) *OpStats {
 		index = 0
 	}
 
+	s.delayInfo[index].mu.Lock()
+	defer s.delayInfo[index].mu.Unlock()
 	o := &OpStats{
 		OpStr:      s.opstr,
 		Interval:   s.delayInfo[index].interval,
@@ -443,11 +344,17 @@ func (s *opStats) GetOpStatsByInterval(interval int64) *OpStats {
 		TotalUsecs: s.delayInfo[index].nsecs.Int64() / 1e3,
 		QPS:        s.delayInfo[index].qps.Int64(),
 		AVG:        s.delayInfo[index].avg,
-		TP90:       s.delayInfo[index].tp90,
-		TP99:       s.delayInfo[index].tp99,
-		TP999:      s.delayInfo[index].tp999,
-		TP9999:     s.delayInfo[index].tp9999,
+		TP50:       s.delayInfo[index].tp(0),
+		TP90:       s.delayInfo[index].tp(1),
+		TP95:       s.delayInfo[index].tp(2),
+		TP99:       s.delayInfo[index].tp(3),
+		TP999:      s.delayInfo[index].tp(4),
+		TP9999:     s.delayInfo[index].tp(5),
 		TP100:      s.delayInfo[index].tp100,
+		P50Usecs:   s.delayInfo[index].tpus[0],
+		P95Usecs:   s.delayInfo[index].tpus[2],
+		P99Usecs:   s.delayInfo[index].tpus[3],
+		P999Usecs:  s.delayInfo[index].tpus[4],
 		Delay50ms:  s.delayInfo[index].delay50ms,
 		Delay100ms: s.delayInfo[index].delay100ms,
 		Delay200ms: s.delayInfo[index].delay200ms,
@@ -476,6 +383,8 @@ func (s *opStats) incrOpStats(responseTime int64, t redis.RespType) {
 
 	// Collect TP (transaction processing) data.
 	s.incrTP(responseTime)
+	s.hist.record(responseTime)
+	s.observe(responseTime)
 	// Count the number of timeout commands.
 	s.incrDelayNum(responseTime / 1e6)
 }
@@ -512,15 +421,36 @@ func getOpStats(opstr string, create bool) *opStats {
 	}
 
 	cmdstats.opmapLock.Lock()
-	s = cmdstats.opmap[opstr]
-	if s == nil {
-		s = &opStats{opstr: opstr}
-		for i := 0; i < IntervalNum; i++ {
-			s.delayInfo[i] = &delayInfo{interval: IntervalMark[i]}
+	defer cmdstats.opmapLock.Unlock()
+	if s = cmdstats.opmap[opstr]; s != nil {
+		return s
+	}
+	if opstr != "ALL" && !isKnownOp(opstr) {
+		if cmdstats.unknown >= MaxUnknownCmds {
+			return getUnknownOpStats()
 		}
-		cmdstats.opmap[opstr] = s
+		cmdstats.unknown++
 	}
-	cmdstats.opmapLock.Unlock()
+	return newOpStats(opstr)
+}
+
+// getUnknownOpStats returns the stats of the commands missing from the
+// command table beyond the first MaxUnknownCmds, which are folded into a
+// single entry, so random command names can't blow up the stats.
+// It must be called with the lock held.
+func getUnknownOpStats() *opStats {
+	if s := cmdstats.opmap[UnknownOpStr]; s != nil {
+		return s
+	}
+	return newOpStats(UnknownOpStr)
+}
+
+func newOpStats(opstr string) *opStats {
+	s := &opStats{opstr: opstr}
+	for i := 0; i < IntervalNum; i++ {
+		s.delayInfo[i] = &delayInfo{interval: IntervalMark[i]}
+	}
+	cmdstats.opmap[opstr] = s
 	return s
 }
 
@@ -538,6 +468,8 @@ func (s sliceOpStats) Less(i, j int) bool {
 	return s[i].OpStr < s[j].OpStr
 }
 
+// GetOpStatsAll returns a snapshot of the stats of commands as of the last
+// refresh, it doesn't refresh or reset the stats of intervals.
 func GetOpStatsAll() []*OpStats {
 	var all = make([]*OpStats, 0, 128)
 	cmdstats.opmapLock.RLock()
@@ -554,9 +486,7 @@ func GetOpStatsByInterval(interval int64) []*OpStats {
 	cmdstats.opmapLock.RLock()
 	defer cmdstats.opmapLock.RUnlock()
 	for _, s := range cmdstats.opmap {
-		for i := 0; i < IntervalNum; i++ {
-			s.RefreshOpStats(i)
-		}
+		s.RefreshOpStats()
 		all = append(all, s.GetOpStatsByInterval(interval))
 	}
 	sort.Sort(sliceOpStats(all))
@@ -573,6 +503,10 @@ func ResetStats() {
 		v.nsecs.Set(0)
 		v.fails.Set(0)
 		v.redis.errors.Set(0)
+		v.hist.reset()
+		for i := range v.buckets {
+			v.buckets[i].Set(0)
+		}
 	}
 
 	cmdstats.total.Set(0)
@@ -581,6 +515,59 @@ func ResetStats() {
 	sessions.total.Set(sessions.alive.Int64())
 }
 
+const (
+	MaxUnknownCmds = 128
+	UnknownOpStr   = "UNKNOWN"
+)
+
+type UnknownCmd struct {
+	OpStr string `json:"opstr"`
+	Calls int64  `json:"calls"`
+}
+
+var unknowncmds struct {
+	sync.Mutex
+	opmap    map[string]int64
+	overflow int64
+}
+
+func init() {
+	unknowncmds.opmap = make(map[string]int64, 16)
+}
+
+// incrUnknownCmd counts commands that are missing from the command table.
+// Only the first MaxUnknownCmds distinct names are tracked, the others are
+// counted as overflow, so random command names can't blow up the report.
+func incrUnknownCmd(opstr string) {
+	unknowncmds.Lock()
+	defer unknowncmds.Unlock()
+	if _, ok := unknowncmds.opmap[opstr]; ok || len(unknowncmds.opmap) < MaxUnknownCmds {
+		unknowncmds.opmap[opstr]++
+	} else {
+		unknowncmds.overflow++
+	}
+}
+
+func GetUnknownCmds() ([]*UnknownCmd, int64) {
+	unknowncmds.Lock()
+	defer unknowncmds.Unlock()
+	var all = make([]*UnknownCmd, 0, len(unknowncmds.opmap))
+	for opstr, calls := range unknowncmds.opmap {
+		all = append(all, &UnknownCmd{OpStr: opstr, Calls: calls})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].OpStr < all[j].OpStr
+	})
+	return all, unknowncmds.overflow
+}
+
+func ResetUnknownCmds() {
+	unknowncmds.Lock()
+	defer unknowncmds.Unlock()
+	unknowncmds.opmap = make(map[string]int64, 16)
+	unknowncmds.overflow = 0
+}
+
 func (s *Session) incrOpTotal() {
 	s.stats.total.Incr()
 }
@@ -600,6 +587,10 @@ func incrOpFails(n int64) {
 var sessions struct {
 	total atomic2.Int64
 	alive atomic2.Int64
+
+	rejected atomic2.Int64
+	evicted  atomic2.Int64
+	slow     atomic2.Int64
 }
 
 func incrSessions() int64 {
@@ -619,6 +610,18 @@ func SessionsAlive() int64 {
 	return sessions.alive.Int64()
 }
 
+func SessionsRejected() int64 {
+	return sessions.rejected.Int64()
+}
+
+func SessionsEvicted() int64 {
+	return sessions.evicted.Int64()
+}
+
+func SessionsSlow() int64 {
+	return sessions.slow.Int64()
+}
+
 type SysUsage struct {
 	Now time.Time
 	CPU float64
@@ -0,0 +1,62 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+)
+
+// handleRequestXRead routes XREAD/XREADGROUP by the streams, which must
+// belong to the same slot. With BLOCK, the command is sent through the
+// connection used by blocking commands of the session.
+func (s *Session) handleRequestXRead(r *Request, d *Router) error {
+	var index = streamsIndex(r.Multi)
+	if index == 0 {
+		r.Resp = redis.NewErrorf("ERR syntax error")
+		return nil
+	}
+	var nargs = len(r.Multi) - index - 1
+	if nargs == 0 || nargs%2 != 0 {
+		r.Resp = redis.NewErrorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", strings.ToLower(r.OpStr))
+		return nil
+	}
+	var keys = r.Multi[index+1 : index+1+nargs/2]
+	if !d.isSameSlot(keys) {
+		r.Resp = redis.NewErrorf("ERR keys in '%s' command must be in the same slot", r.OpStr)
+		return nil
+	}
+
+	var block = -1
+	for i := 1; i < index; i++ {
+		switch strings.ToUpper(string(r.Multi[i].Value)) {
+		case "BLOCK":
+			block = i + 1
+		case "COUNT":
+			i++
+		case "GROUP":
+			i += 2
+		}
+	}
+	if block < 0 || block >= index {
+		return d.dispatch(r)
+	}
+	ms, err := redis.Btoi64(r.Multi[block].Value)
+	switch {
+	case err != nil:
+		r.Resp = redis.NewErrorf("ERR timeout is not an integer or out of range")
+		return nil
+	case ms < 0:
+		r.Resp = redis.NewErrorf("ERR timeout is negative")
+		return nil
+	}
+	var slot = d.keySlot(keys[0].Value)
+	var timeout = time.Duration(ms) * time.Millisecond
+	r.Coalesce = func() error {
+		return s.doBlocking(r, d, slot, timeout)
+	}
+	return nil
+}
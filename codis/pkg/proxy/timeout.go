@@ -0,0 +1,101 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+// The classes of commands with their own timeouts of replies from backends,
+// set by the command table of the dashboard.
+const (
+	ClassQuick    = "quick"
+	ClassSlow     = "slow"
+	ClassBlocking = "blocking"
+	ClassAdmin    = "admin"
+)
+
+type cmdTimeoutTable struct {
+	classes  map[string]string
+	timeouts map[string]time.Duration
+}
+
+// cmdTimeouts holds the table of the timeouts of classes, replaced as a whole
+// by SetCommandOverrides.
+var cmdTimeouts atomic.Value
+
+func init() {
+	cmdTimeouts.Store(&cmdTimeoutTable{})
+}
+
+func isCommandClass(class string) bool {
+	switch class {
+	case ClassQuick, ClassSlow, ClassBlocking, ClassAdmin:
+		return true
+	}
+	return false
+}
+
+func parseCommandTimeouts(c *models.Commands, isKnown func(name string) bool) (*cmdTimeoutTable, error) {
+	var t = &cmdTimeoutTable{
+		classes:  make(map[string]string),
+		timeouts: make(map[string]time.Duration),
+	}
+	for class, s := range c.Timeouts {
+		if !isCommandClass(strings.ToLower(class)) {
+			return nil, errors.Errorf("invalid class '%s' of timeout", class)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return nil, errors.Errorf("invalid timeout '%s' of class '%s'", s, class)
+		}
+		t.timeouts[strings.ToLower(class)] = d
+	}
+	for name, class := range c.Classes {
+		if !isKnown(strings.ToUpper(name)) {
+			return nil, errors.Errorf("invalid classified command '%s'", name)
+		}
+		if !isCommandClass(strings.ToLower(class)) {
+			return nil, errors.Errorf("invalid class '%s' of command '%s'", class, name)
+		}
+		t.classes[strings.ToUpper(name)] = strings.ToLower(class)
+	}
+	return t, nil
+}
+
+// commandClass returns the class of the command, as set by the command table
+// or else by the ACL categories and flags of the command.
+func commandClass(opstr string, flag OpFlag) string {
+	var t = cmdTimeouts.Load().(*cmdTimeoutTable)
+	if class, ok := t.classes[opstr]; ok {
+		return class
+	}
+	switch {
+	case aclCategorySet["BLOCKING"][opstr]:
+		return ClassBlocking
+	case aclCategorySet["ADMIN"][opstr]:
+		return ClassAdmin
+	case flag.IsQuick():
+		return ClassQuick
+	}
+	return ClassSlow
+}
+
+// commandTimeout returns the timeout of replies of the command, or the given
+// default if the timeout of its class isn't set.
+func commandTimeout(opstr string, flag OpFlag, def time.Duration) time.Duration {
+	var t = cmdTimeouts.Load().(*cmdTimeoutTable)
+	if len(t.timeouts) == 0 || opstr == "" {
+		return def
+	}
+	if d, ok := t.timeouts[commandClass(opstr, flag)]; ok {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestCommandTimeouts(t *testing.T) {
+	defer SetCommandOverrides(&models.Commands{})
+
+	get, lrange := getOpInfoForTest("GET"), getOpInfoForTest("LRANGE")
+	assert.Must(commandClass("GET", get.Flag) == ClassQuick)
+	assert.Must(commandClass("BLPOP", 0) == ClassBlocking)
+	assert.Must(commandClass("SLOWLOG", 0) == ClassAdmin)
+	assert.Must(commandTimeout("GET", get.Flag, time.Second*30) == time.Second*30)
+
+	assert.Must(SetCommandOverrides(&models.Commands{Timeouts: map[string]string{"fast": "1s"}}) != nil)
+	assert.Must(SetCommandOverrides(&models.Commands{Timeouts: map[string]string{"quick": "x"}}) != nil)
+	assert.Must(SetCommandOverrides(&models.Commands{Classes: map[string]string{"NOSUCHCMD": "slow"}}) != nil)
+	assert.Must(SetCommandOverrides(&models.Commands{Classes: map[string]string{"GET": "fast"}}) != nil)
+
+	assert.MustNoError(SetCommandOverrides(&models.Commands{
+		Timeouts: map[string]string{"quick": "1s", "slow": "2m"},
+		Classes:  map[string]string{"lrange": "SLOW", "hgetall": "quick"},
+	}))
+	assert.Must(commandTimeout("GET", get.Flag, time.Second*30) == time.Second)
+	assert.Must(commandTimeout("LRANGE", lrange.Flag, time.Second*30) == time.Minute*2)
+	assert.Must(commandTimeout("HGETALL", 0, time.Second*30) == time.Second)
+	assert.Must(commandTimeout("BLPOP", 0, time.Second*30) == time.Second*30)
+	assert.Must(commandTimeout("", 0, time.Second*30) == time.Second*30)
+}
+
+func getOpInfoForTest(opstr string) OpInfo {
+	opTableLock.RLock()
+	defer opTableLock.RUnlock()
+	return opTable[opstr]
+}
@@ -0,0 +1,308 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+// trackingState is the state of CLIENT TRACKING of a session, keys are the
+// keys read by the session since they were invalidated last time, mapped to
+// the keys seen by the client, i.e. without the prefix of its namespace.
+type trackingState struct {
+	noloop bool
+	keys   map[trackingKey]string
+}
+
+// trackingKey is a key of the backends in the database.
+type trackingKey struct {
+	db  int32
+	key string
+}
+
+// tracking holds the sessions tracking each key, which are pushed with the
+// invalidation messages once the key is written through the proxy, or is
+// reported by the keyspace notifications of the backends.
+var tracking struct {
+	sync.Mutex
+	keys map[trackingKey]map[*Session]bool
+
+	sessions atomic2.Int64
+}
+
+func init() {
+	tracking.keys = make(map[trackingKey]map[*Session]bool)
+}
+
+// handleTracking handles CLIENT TRACKING ON|OFF [NOLOOP], the tracking is
+// supported for RESP3 only, since REDIRECT isn't.
+func (s *Session) handleTracking(r *Request) error {
+	var noloop bool
+	for _, arg := range r.Multi[3:] {
+		switch strings.ToUpper(string(arg.Value)) {
+		case "NOLOOP":
+			noloop = true
+		default:
+			r.Resp = redis.NewErrorf("ERR syntax error, only NOLOOP is supported by the proxy")
+			return nil
+		}
+	}
+	switch strings.ToUpper(string(r.Multi[2].Value)) {
+	case "ON":
+		if s.proto != 3 {
+			r.Resp = redis.NewErrorf("ERR TRACKING requires RESP3 in the proxy, switch to it by HELLO 3")
+			return nil
+		}
+		tracking.Lock()
+		if s.tracking == nil {
+			s.tracking = &trackingState{keys: make(map[trackingKey]string)}
+			tracking.sessions.Incr()
+		}
+		s.tracking.noloop = noloop
+		tracking.Unlock()
+	case "OFF":
+		s.untrackAll()
+	default:
+		r.Resp = redis.NewErrorf("ERR syntax error")
+		return nil
+	}
+	r.Resp = RespOK
+	return nil
+}
+
+// untrackAll turns off the tracking of the session, it must be called before
+// the tasks of the session are closed.
+func (s *Session) untrackAll() {
+	tracking.Lock()
+	defer tracking.Unlock()
+	if s.tracking == nil {
+		return
+	}
+	for key := range s.tracking.keys {
+		if m := tracking.keys[key]; m != nil {
+			if delete(m, s); len(m) == 0 {
+				delete(tracking.keys, key)
+			}
+		}
+	}
+	s.tracking = nil
+	tracking.sessions.Decr()
+}
+
+// trackRead remembers the keys of the read request, if the session has the
+// tracking on.
+func (s *Session) trackRead(r *Request) {
+	if s.tracking == nil || !r.IsReadOnly() {
+		return
+	}
+	var keys [][]byte
+	switch r.OpStr {
+	case "MGET", "EXISTS":
+		for _, x := range r.Multi[1:] {
+			keys = append(keys, x.Value)
+		}
+	default:
+		if key := getHashKey(r.Multi, r.OpStr); key != nil {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	tracking.Lock()
+	defer tracking.Unlock()
+	if s.tracking == nil {
+		return
+	}
+	for _, key := range keys {
+		var k = trackingKey{r.Database, string(key)}
+		if _, ok := s.tracking.keys[k]; ok {
+			continue
+		}
+		s.tracking.keys[k] = string(bytes.TrimPrefix(key, []byte(r.Namespace)))
+		if tracking.keys[k] == nil {
+			tracking.keys[k] = make(map[*Session]bool)
+		}
+		tracking.keys[k][s] = true
+	}
+}
+
+// invalidateTracking pushes the invalidation messages of any key of the
+// commands in the database to the sessions tracking it, except the session
+// writing the keys if it's NOLOOP.
+func invalidateTracking(from *Session, db int32, multis ...[]*redis.Resp) {
+	if tracking.sessions.Int64() == 0 {
+		return
+	}
+	var keys []trackingKey
+	for _, multi := range multis {
+		for _, x := range multi[1:] {
+			keys = append(keys, trackingKey{db, string(x.Value)})
+		}
+	}
+	invalidateTrackingKeys(from, keys)
+}
+
+func invalidateTrackingKeys(from *Session, keys []trackingKey) {
+	tracking.Lock()
+	defer tracking.Unlock()
+	var pushes = make(map[*Session][]*redis.Resp)
+	for _, k := range keys {
+		var m = tracking.keys[k]
+		if m == nil {
+			continue
+		}
+		for s := range m {
+			if s == from && s.tracking.noloop {
+				continue
+			}
+			var key = s.tracking.keys[k]
+			delete(s.tracking.keys, k)
+			delete(m, s)
+			pushes[s] = append(pushes[s], redis.NewBulkBytes([]byte(key)))
+		}
+		if len(m) == 0 {
+			delete(tracking.keys, k)
+		}
+	}
+	for s, array := range pushes {
+		s.pushInvalidate(redis.NewArray(array))
+	}
+}
+
+// flushTracking pushes the invalidation messages of all keys to all the
+// sessions tracking, e.g. for FLUSHALL.
+func flushTracking() {
+	if tracking.sessions.Int64() == 0 {
+		return
+	}
+	tracking.Lock()
+	defer tracking.Unlock()
+	var sessions = make(map[*Session]bool)
+	for _, m := range tracking.keys {
+		for s := range m {
+			sessions[s] = true
+		}
+	}
+	tracking.keys = make(map[trackingKey]map[*Session]bool)
+	for s := range sessions {
+		s.tracking.keys = make(map[trackingKey]string)
+		s.pushInvalidate(redis.NewNull())
+	}
+}
+
+// pushInvalidate must be called with the lock of tracking held, the session
+// is tracking, thus its tasks are not closed yet.
+func (s *Session) pushInvalidate(keys *redis.Resp) {
+	r := &Request{Batch: &sync.WaitGroup{}}
+	r.Resp = redis.NewPush([]*redis.Resp{
+		redis.NewBulkBytes([]byte("invalidate")), keys,
+	})
+	r.ReceiveTime = time.Now().UnixNano()
+	s.tasks.PushBack(r)
+}
+
+var keyspacePattern = []byte("__keyspace@*__:*")
+
+// watchKeyspace subscribes to the keyspace notifications of the backends,
+// and invalidates the keys written, by the proxy or not. It requires the
+// notify-keyspace-events of the backends to be set, e.g. "K$lshzxeg".
+func (p *Proxy) watchKeyspace() {
+	var mu sync.Mutex
+	var conns = make(map[string]*redis.Conn)
+	var ticker = time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+	for {
+		for _, addr := range p.router.backendAddrs() {
+			mu.Lock()
+			var c = conns[addr]
+			mu.Unlock()
+			if c != nil {
+				continue
+			}
+			c, err := dialBackend(addr, 0, p.config)
+			if err != nil {
+				log.WarnErrorf(err, "[%p] watch keyspace of %s failed", p, addr)
+				continue
+			}
+			c.ReaderTimeout = 0
+			multi := []*redis.Resp{
+				redis.NewBulkBytes([]byte("PSUBSCRIBE")), redis.NewBulkBytes(keyspacePattern),
+			}
+			if err := c.EncodeMultiBulk(multi, true); err != nil {
+				log.WarnErrorf(err, "[%p] watch keyspace of %s failed", p, addr)
+				c.Close()
+				continue
+			}
+			mu.Lock()
+			conns[addr] = c
+			mu.Unlock()
+			go func(addr string, c *redis.Conn) {
+				loopKeyspaceReader(c)
+				mu.Lock()
+				if conns[addr] == c {
+					delete(conns, addr)
+				}
+				mu.Unlock()
+			}(addr, c)
+		}
+		select {
+		case <-p.exit.C:
+			mu.Lock()
+			for _, c := range conns {
+				c.Close()
+			}
+			mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func loopKeyspaceReader(c *redis.Conn) {
+	defer c.Close()
+	for {
+		resp, err := c.Decode()
+		if err != nil {
+			return
+		}
+		if !resp.IsArray() || len(resp.Array) != 4 || string(resp.Array[0].Value) != "pmessage" {
+			continue
+		}
+		db, key, ok := parseKeyspaceChannel(resp.Array[2].Value)
+		if !ok {
+			continue
+		}
+		var multi = []*redis.Resp{resp.Array[3], redis.NewBulkBytes(key)}
+		invalidateHotCache(db, multi)
+		invalidateTracking(nil, db, multi)
+	}
+}
+
+// parseKeyspaceChannel parses the database and key of the channel of the
+// keyspace notifications, e.g. "__keyspace@0__:key".
+func parseKeyspaceChannel(channel []byte) (int32, []byte, bool) {
+	var prefix = []byte(keyspaceChannel)
+	if !bytes.HasPrefix(channel, prefix) {
+		return 0, nil, false
+	}
+	var rest = channel[len(prefix):]
+	var i = bytes.Index(rest, []byte("__:"))
+	if i < 0 {
+		return 0, nil, false
+	}
+	db, err := strconv.ParseInt(string(rest[:i]), 10, 32)
+	if err != nil {
+		return 0, nil, false
+	}
+	return int32(db), rest[i+3:], true
+}
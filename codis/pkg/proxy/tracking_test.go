@@ -0,0 +1,96 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestClientTracking(t *testing.T) {
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewString([]byte("OK"))
+	})
+	defer backend.Close()
+
+	d := NewRouter(config)
+	defer d.Close()
+	for i := 0; i < models.GetMaxSlotNum(); i++ {
+		assert.MustNoError(d.FillSlot(&models.Slot{Id: i, BackendAddr: backend.Addr()}))
+	}
+	d.Start()
+
+	newTrackingSession := func(noloop bool) *Session {
+		s := newTestSession()
+		s.tasks = NewRequestChanBuffer(16)
+		assert.Must(handleTestRequest(s, d, "CLIENT", "TRACKING", "ON").IsError())
+		s.proto = 3
+		if noloop {
+			assert.Must(string(handleTestRequest(s, d, "CLIENT", "TRACKING", "ON", "NOLOOP").Value) == "OK")
+		} else {
+			assert.Must(string(handleTestRequest(s, d, "CLIENT", "TRACKING", "ON").Value) == "OK")
+		}
+		return s
+	}
+	popInvalidate := func(s *Session) *redis.Resp {
+		r, ok := s.tasks.PopFront()
+		assert.Must(ok && r.Resp.IsPush() && string(r.Resp.Array[0].Value) == "invalidate")
+		return r.Resp.Array[1]
+	}
+
+	s1, s2 := newTrackingSession(false), newTrackingSession(true)
+	defer s1.untrackAll()
+	defer s2.untrackAll()
+
+	handleTestRequest(s1, d, "GET", "tracking-a")
+	handleTestRequest(s1, d, "GET", "tracking-b")
+	handleTestRequest(s1, d, "GET", "tracking-c")
+	handleTestRequest(s2, d, "GET", "tracking-a")
+
+	handleTestRequest(s2, d, "SET", "tracking-a", "v")
+	keys := popInvalidate(s1)
+	assert.Must(len(keys.Array) == 1 && string(keys.Array[0].Value) == "tracking-a")
+	assert.Must(s2.tasks.IsEmpty())
+
+	// The key is invalidated once until it's read again.
+	handleTestRequest(newTestSession(), d, "SET", "tracking-a", "v")
+	assert.Must(s1.tasks.IsEmpty())
+	assert.Must(string(popInvalidate(s2).Array[0].Value) == "tracking-a")
+
+	invalidateTracking(nil, 0, newTestRequest("DEL", "tracking-b", "tracking-c").Multi)
+	keys = popInvalidate(s1)
+	assert.Must(len(keys.Array) == 2)
+
+	handleTestRequest(s1, d, "GET", "tracking-a")
+	handleTestRequest(s2, d, "GET", "tracking-b")
+	flushTracking()
+	assert.Must(popInvalidate(s1).IsNull())
+	assert.Must(popInvalidate(s2).IsNull())
+
+	assert.Must(string(handleTestRequest(s1, d, "CLIENT", "TRACKING", "OFF").Value) == "OK")
+	handleTestRequest(s1, d, "GET", "tracking-a")
+	handleTestRequest(newTestSession(), d, "SET", "tracking-a", "v")
+	assert.Must(s1.tasks.IsEmpty())
+
+	// The keys are tracked per database, and pushed without the namespace.
+	resetACLUsers()
+	defer resetACLUsers()
+	assert.Must(handleTestRequest(newTestSession(), d, "ACL", "SETUSER", "t1", "on", "nopass", "allkeys",
+		"allchannels", "+@all", "namespace:t1:").IsString())
+	s3 := newTrackingSession(false)
+	defer s3.untrackAll()
+	assert.Must(handleTestRequest(s3, d, "AUTH", "t1", "").IsString())
+	handleTestRequest(s3, d, "GET", "tracking-d")
+	invalidateTracking(nil, 1, newTestRequest("DEL", "t1:tracking-d").Multi)
+	assert.Must(s3.tasks.IsEmpty())
+	invalidateTracking(nil, 0, newTestRequest("DEL", "t1:tracking-d").Multi)
+	keys = popInvalidate(s3)
+	assert.Must(len(keys.Array) == 1 && string(keys.Array[0].Value) == "tracking-d")
+
+	db, key, ok := parseKeyspaceChannel([]byte("__keyspace@3__:a:b"))
+	assert.Must(ok && db == 3 && string(key) == "a:b")
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/math2"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+const (
+	MinGCPercent   = 10
+	MaxGCPercent   = 10000
+	MinMemoryLimit = 64 << 20
+	MaxMaxProcs    = 1024
+
+	MaxBackendParallel = 64
+)
+
+// RuntimeTuning changes the settings of the go runtime by the admin API, the
+// fields not set are left unchanged.
+//
+// GCPercent is GOGC, -1 to turn off GC, which requires a memory limit.
+// MemoryLimit is GOMEMLIMIT in bytes, 0 for no limit. MaxProcs is GOMAXPROCS,
+// which is pinned and not adjusted by --max-ncpu anymore, 0 to unpin it.
+// PrimaryParallel and ReplicaParallel are the numbers of connections to each
+// backend, each of which is served by a pair of worker goroutines.
+type RuntimeTuning struct {
+	GCPercent   *int   `json:"gc_percent,omitempty"`
+	MemoryLimit *int64 `json:"memory_limit,omitempty"`
+	MaxProcs    *int   `json:"max_procs,omitempty"`
+
+	PrimaryParallel *int `json:"backend_primary_parallel,omitempty"`
+	ReplicaParallel *int `json:"backend_replica_parallel,omitempty"`
+}
+
+type RuntimeTuningStats struct {
+	GCPercent      int   `json:"gc_percent"`
+	MemoryLimit    int64 `json:"memory_limit"`
+	MaxProcs       int   `json:"max_procs"`
+	MaxProcsPinned bool  `json:"max_procs_pinned"`
+
+	PrimaryParallel int `json:"backend_primary_parallel"`
+	ReplicaParallel int `json:"backend_replica_parallel"`
+
+	NumGC        uint32  `json:"num_gc"`
+	NextGC       uint64  `json:"next_gc"`
+	HeapAlloc    uint64  `json:"heap_alloc"`
+	LastPauseUs  uint64  `json:"last_pause_us"`
+	GCCPUPercent float64 `json:"gc_cpu_percent"`
+}
+
+var tuning struct {
+	sync.Mutex
+	gcPercent int
+
+	pinned atomic2.Bool
+}
+
+func init() {
+	tuning.gcPercent = debug.SetGCPercent(100)
+	debug.SetGCPercent(tuning.gcPercent)
+}
+
+func (t *RuntimeTuning) validate() error {
+	var gcPercent, memoryLimit = tuning.gcPercent, debug.SetMemoryLimit(-1)
+	if t.GCPercent != nil {
+		gcPercent = *t.GCPercent
+		if gcPercent != -1 && (gcPercent < MinGCPercent || gcPercent > MaxGCPercent) {
+			return errors.Errorf("invalid gc_percent, should be -1 or in [%d,%d]", MinGCPercent, MaxGCPercent)
+		}
+	}
+	if t.MemoryLimit != nil {
+		memoryLimit = *t.MemoryLimit
+		if memoryLimit != 0 && memoryLimit < MinMemoryLimit {
+			return errors.Errorf("invalid memory_limit, should be 0 or at least %d", MinMemoryLimit)
+		}
+	}
+	if gcPercent < 0 && (memoryLimit == 0 || memoryLimit == math.MaxInt64) {
+		return errors.New("invalid gc_percent, GC can't be turned off without memory_limit")
+	}
+	if t.MaxProcs != nil {
+		if n := *t.MaxProcs; n < 0 || n > MaxMaxProcs {
+			return errors.Errorf("invalid max_procs, should be in [0,%d]", MaxMaxProcs)
+		}
+	}
+	return nil
+}
+
+// SetRuntimeTuning validates and applies the tuning as a whole, and returns
+// the settings afterwards.
+func SetRuntimeTuning(t *RuntimeTuning) (*RuntimeTuningStats, error) {
+	tuning.Lock()
+	defer tuning.Unlock()
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	if t.MemoryLimit != nil {
+		var n = *t.MemoryLimit
+		if n == 0 {
+			n = math.MaxInt64
+		}
+		log.Warnf("set memory limit %d -> %d", debug.SetMemoryLimit(n), n)
+	}
+	if t.GCPercent != nil {
+		log.Warnf("set gc percent %d -> %d", debug.SetGCPercent(*t.GCPercent), *t.GCPercent)
+		tuning.gcPercent = *t.GCPercent
+	}
+	if t.MaxProcs != nil {
+		if n := *t.MaxProcs; n != 0 {
+			log.Warnf("set max procs %d -> %d, pinned", runtime.GOMAXPROCS(n), n)
+			tuning.pinned.Set(true)
+		} else {
+			log.Warnf("unpin max procs %d", runtime.GOMAXPROCS(0))
+			tuning.pinned.Set(false)
+		}
+	}
+	return lockedRuntimeTuningStats(), nil
+}
+
+// SetRuntimeTuning applies the tuning of the go runtime and of the worker
+// goroutines of the router, nothing is changed if any of them is invalid.
+func (p *Proxy) SetRuntimeTuning(t *RuntimeTuning) (*RuntimeTuningStats, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosedProxy
+	}
+	var primary, replica = p.config.BackendPrimaryParallel, p.config.BackendReplicaParallel
+	if t.PrimaryParallel != nil {
+		primary = *t.PrimaryParallel
+		if primary < 1 || primary > MaxBackendParallel || primary <= p.config.BackendPrimaryQuick {
+			return nil, errors.Errorf("invalid backend_primary_parallel, should be in [%d,%d]",
+				math2.MaxInt(1, p.config.BackendPrimaryQuick+1), MaxBackendParallel)
+		}
+	}
+	if t.ReplicaParallel != nil {
+		replica = *t.ReplicaParallel
+		if replica < 1 || replica > MaxBackendParallel || replica <= p.config.BackendReplicaQuick {
+			return nil, errors.Errorf("invalid backend_replica_parallel, should be in [%d,%d]",
+				math2.MaxInt(1, p.config.BackendReplicaQuick+1), MaxBackendParallel)
+		}
+	}
+	stats, err := SetRuntimeTuning(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.router.SetParallel(primary, replica); err != nil {
+		return nil, err
+	}
+	p.config.BackendPrimaryParallel = primary
+	p.config.BackendReplicaParallel = replica
+	stats.PrimaryParallel, stats.ReplicaParallel = p.router.Parallel()
+	return stats, nil
+}
+
+// RuntimeTuningStats returns the settings of the go runtime and the router.
+func (p *Proxy) RuntimeTuningStats() *RuntimeTuningStats {
+	var stats = GetRuntimeTuningStats()
+	stats.PrimaryParallel, stats.ReplicaParallel = p.router.Parallel()
+	return stats
+}
+
+// IsMaxProcsPinned returns whether GOMAXPROCS is set by the admin API, so
+// that it's not adjusted automatically.
+func IsMaxProcsPinned() bool {
+	return tuning.pinned.Bool()
+}
+
+func GetRuntimeTuningStats() *RuntimeTuningStats {
+	tuning.Lock()
+	defer tuning.Unlock()
+	return lockedRuntimeTuningStats()
+}
+
+func lockedRuntimeTuningStats() *RuntimeTuningStats {
+	var r runtime.MemStats
+	runtime.ReadMemStats(&r)
+
+	var stats = &RuntimeTuningStats{
+		GCPercent:      tuning.gcPercent,
+		MemoryLimit:    debug.SetMemoryLimit(-1),
+		MaxProcs:       runtime.GOMAXPROCS(0),
+		MaxProcsPinned: tuning.pinned.Bool(),
+		NumGC:          r.NumGC,
+		NextGC:         r.NextGC,
+		HeapAlloc:      r.HeapAlloc,
+		GCCPUPercent:   r.GCCPUFraction * 100,
+	}
+	if stats.MemoryLimit == math.MaxInt64 {
+		stats.MemoryLimit = 0
+	}
+	if r.NumGC != 0 {
+		stats.LastPauseUs = r.PauseNs[(r.NumGC+255)%256] / 1e3
+	}
+	return stats
+}
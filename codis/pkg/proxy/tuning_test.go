@@ -0,0 +1,83 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"runtime"
+	"testing"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestRuntimeTuning(x *testing.T) {
+	s, addr := openProxy()
+	defer s.Close()
+
+	var c = NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, s.Model().Token)
+
+	saved, err := c.RuntimeTuning()
+	assert.MustNoError(err)
+	assert.Must(saved.MaxProcs == runtime.GOMAXPROCS(0) && !saved.MaxProcsPinned)
+	defer func() {
+		var unpin = 0
+		SetRuntimeTuning(&RuntimeTuning{GCPercent: &saved.GCPercent, MemoryLimit: &saved.MemoryLimit, MaxProcs: &unpin})
+		runtime.GOMAXPROCS(saved.MaxProcs)
+	}()
+
+	var off, small, limit, procs = -1, 5, int64(1 << 30), 2
+	_, err = c.SetRuntimeTuning(&RuntimeTuning{GCPercent: &small})
+	assert.Must(err != nil)
+	_, err = c.SetRuntimeTuning(&RuntimeTuning{GCPercent: &off})
+	assert.Must(err != nil)
+
+	stats, err := c.SetRuntimeTuning(&RuntimeTuning{GCPercent: &off, MemoryLimit: &limit, MaxProcs: &procs})
+	assert.MustNoError(err)
+	assert.Must(stats.GCPercent == -1 && stats.MemoryLimit == limit)
+	assert.Must(stats.MaxProcs == 2 && stats.MaxProcsPinned && IsMaxProcsPinned())
+
+	var nolimit = int64(0)
+	_, err = c.SetRuntimeTuning(&RuntimeTuning{MemoryLimit: &nolimit})
+	assert.Must(err != nil)
+
+	st := s.Stats(StatsRuntime)
+	assert.Must(st.Runtime.Tuning != nil && st.Runtime.Tuning.MemoryLimit == limit)
+}
+
+func TestRuntimeTuningParallel(x *testing.T) {
+	backend := newFakeBackend(func(multi []*redis.Resp) *redis.Resp {
+		return redis.NewBulkBytes([]byte("v"))
+	})
+	defer backend.Close()
+
+	s, addr := openProxy()
+	defer s.Close()
+	assert.MustNoError(s.router.FillSlot(&models.Slot{Id: 0, BackendAddr: backend.Addr(), Locked: true}))
+	assert.MustNoError(s.router.FillSlot(&models.Slot{Id: 1, BackendAddr: backend.Addr()}))
+
+	var c = NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, s.Model().Token)
+
+	var zero, quick, three = 0, s.config.BackendPrimaryQuick, 3
+	_, err := c.SetRuntimeTuning(&RuntimeTuning{PrimaryParallel: &zero})
+	assert.Must(err != nil)
+	if quick > 0 {
+		_, err = c.SetRuntimeTuning(&RuntimeTuning{PrimaryParallel: &quick})
+		assert.Must(err != nil)
+	}
+
+	stats, err := c.SetRuntimeTuning(&RuntimeTuning{PrimaryParallel: &three})
+	assert.MustNoError(err)
+	assert.Must(stats.PrimaryParallel == 3 && stats.ReplicaParallel == s.config.BackendReplicaParallel)
+	assert.Must(string(s.ConfigGet("backend_primary_parallel").Value) == "3")
+
+	for _, id := range []int{0, 1} {
+		slot := &s.router.slots[id]
+		assert.Must(slot.backend.bc.owner == s.router.pool.primary)
+		assert.Must(len(slot.backend.bc.conns[0]) == 3)
+	}
+	assert.Must(s.router.slots[0].lock.hold && !s.router.slots[1].lock.hold)
+}
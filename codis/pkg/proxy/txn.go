@@ -0,0 +1,256 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync"
+
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+var ErrSlotIsMigrating = errors.New("slot is migrating")
+
+// txnState keeps the transaction of a session. All keys watched or used in
+// a transaction must belong to the same slot, and the transaction runs on
+// a connection owned by the session, to the group serving that slot.
+//
+// The fields besides conn and addr are only used in loopReader, while the
+// connection is used from Coalesce in loopWriter, so requests sent before
+// are always answered before WATCH or EXEC is sent to the backend.
+type txnState struct {
+	multi   bool
+	dirty   bool
+	watched bool
+	hasSlot bool
+	slot    int
+
+	queued [][]*redis.Resp
+	ops    []string
+
+	mu   sync.Mutex
+	conn *redis.Conn
+	addr string
+}
+
+func (t *txnState) setSlot(id int) bool {
+	if t.hasSlot {
+		return t.slot == id
+	}
+	t.hasSlot, t.slot = true, id
+	return true
+}
+
+func (t *txnState) reset() {
+	t.multi, t.dirty, t.watched, t.hasSlot = false, false, false, false
+	t.queued, t.ops = nil, nil
+}
+
+func (t *txnState) takeConn() (*redis.Conn, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, addr := t.conn, t.addr
+	t.conn, t.addr = nil, ""
+	return c, addr
+}
+
+func (t *txnState) hasConn() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn != nil
+}
+
+func (t *txnState) closeConn() {
+	if c, _ := t.takeConn(); c != nil {
+		c.Close()
+	}
+}
+
+// getConn returns the connection of the transaction, or opens one to the
+// group serving the slot. It fails if the slot is being migrated, since
+// the keys could be found in either group.
+func (t *txnState) getConn(s *Session, d *Router, slot int, database int32) (*redis.Conn, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		return t.conn, t.addr, nil
+	}
+	m := d.GetSlot(slot)
+	switch {
+	case m == nil || m.BackendAddr == "":
+		return nil, "", ErrSlotIsNotReady
+	case m.MigrateFrom != "":
+		return nil, "", ErrSlotIsMigrating
+	}
+	c, err := dialBackend(m.BackendAddr, int(database), s.config)
+	if err != nil {
+		return nil, "", err
+	}
+	t.conn, t.addr = c, m.BackendAddr
+	return c, m.BackendAddr, nil
+}
+
+func (s *Session) handleWatch(r *Request, d *Router) error {
+	t := &s.txn
+	switch {
+	case t.multi:
+		r.Resp = redis.NewErrorf("ERR WATCH inside MULTI is not allowed")
+		return nil
+	case len(r.Multi) < 2:
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'watch' command")
+		return nil
+	}
+	for _, key := range r.Multi[1:] {
+		if !t.setSlot(d.keySlot(key.Value)) {
+			r.Resp = redis.NewErrorf("ERR keys in transaction must be in the same slot")
+			return nil
+		}
+	}
+	t.watched = true
+
+	var slot = t.slot
+	r.Coalesce = func() error {
+		c, _, err := t.getConn(s, d, slot, r.Database)
+		if err != nil {
+			r.Resp = redis.NewErrorf("ERR %s", err)
+			return nil
+		}
+		replies, err := doCommands(c, r.Multi)
+		if err != nil {
+			t.closeConn()
+			return err
+		}
+		r.Resp = replies[0]
+		return nil
+	}
+	return nil
+}
+
+func (s *Session) handleUnwatch(r *Request) error {
+	t := &s.txn
+	t.watched, t.hasSlot = false, false
+	r.Coalesce = func() error {
+		t.closeConn()
+		r.Resp = RespOK
+		return nil
+	}
+	return nil
+}
+
+func (s *Session) handleMulti(r *Request) error {
+	t := &s.txn
+	if t.multi {
+		r.Resp = redis.NewErrorf("ERR MULTI calls can not be nested")
+		return nil
+	}
+	t.multi = true
+	r.Resp = RespOK
+	return nil
+}
+
+// txnDenied are the commands answered, rewritten or fanned out by the proxy,
+// which can't be queued as is on the backend connection of a transaction.
+var txnDenied = map[string]bool{
+	"ACL": true, "SELECT": true, "INFO": true, "CLUSTER": true, "ASKING": true,
+	"READONLY": true, "READWRITE": true, "RANDOMKEY": true, "DEBUG": true,
+	"BITFIELD_RO": true, "SORT_RO": true, "SCRIPT": true, "FUNCTION": true,
+	"EVAL": true, "EVALSHA": true, "EVAL_RO": true, "EVALSHA_RO": true,
+	"FCALL": true, "FCALL_RO": true, "SCAN": true, "KEYS": true, "DBSIZE": true,
+	"FLUSHALL": true, "FLUSHDB": true, "OBJECT": true, "PCONFIG": true,
+	"XCONFIG": true, "SLOTSINFO": true, "SLOTSSCAN": true, "SLOTSMAPPING": true,
+	"XMONITOR": true, "MONITOR": true, "SLOWLOG": true, "XSLOWLOG": true,
+	"LATENCY": true, "UNWATCH": true, "SUBSCRIBE": true, "UNSUBSCRIBE": true,
+	"PSUBSCRIBE": true, "PUNSUBSCRIBE": true,
+}
+
+func (s *Session) handleTxnQueued(r *Request, d *Router) error {
+	t := &s.txn
+	if txnDenied[r.OpStr] {
+		t.dirty = true
+		r.Resp = redis.NewErrorf("ERR command '%s' is not allowed in transaction", strings.ToLower(r.OpStr))
+		return nil
+	}
+	for _, key := range aclKeys(r.Multi, r.OpStr) {
+		if !t.setSlot(d.keySlot(key.Value)) {
+			t.dirty = true
+			r.Resp = redis.NewErrorf("ERR keys in transaction must be in the same slot")
+			return nil
+		}
+	}
+	t.queued = append(t.queued, r.Multi)
+	t.ops = append(t.ops, r.OpStr)
+	r.Resp = redis.NewString([]byte("QUEUED"))
+	return nil
+}
+
+func (s *Session) handleDiscard(r *Request) error {
+	t := &s.txn
+	if !t.multi {
+		r.Resp = redis.NewErrorf("ERR DISCARD without MULTI")
+		return nil
+	}
+	t.reset()
+	r.Coalesce = func() error {
+		t.closeConn()
+		r.Resp = RespOK
+		return nil
+	}
+	return nil
+}
+
+func (s *Session) handleExec(r *Request, d *Router) error {
+	t := &s.txn
+	if !t.multi {
+		r.Resp = redis.NewErrorf("ERR EXEC without MULTI")
+		return nil
+	}
+	var dirty, watched, slot, queued, ops = t.dirty, t.watched, t.slot, t.queued, t.ops
+	if !t.hasSlot {
+		slot = 0
+	}
+	t.reset()
+
+	r.Coalesce = func() error {
+		defer t.closeConn()
+		if dirty {
+			r.Resp = redis.NewErrorf("EXECABORT Transaction discarded because of previous errors.")
+			return nil
+		}
+		if watched && !t.hasConn() {
+			// WATCH has failed, or the connection has been lost.
+			r.Resp = redis.NewArray(nil)
+			return nil
+		}
+		c, addr, err := t.getConn(s, d, slot, r.Database)
+		if err != nil {
+			r.Resp = redis.NewErrorf("EXECABORT Transaction discarded, %s", err)
+			return nil
+		}
+		if m := d.GetSlot(slot); m == nil || m.BackendAddr != addr || m.MigrateFrom != "" {
+			// The watched keys may have been moved away since WATCH, which is
+			// reported in the same way as the keys being modified.
+			r.Resp = redis.NewArray(nil)
+			return nil
+		}
+		var cmds = make([][]*redis.Resp, 0, len(queued)+2)
+		cmds = append(cmds, []*redis.Resp{redis.NewBulkBytes([]byte("MULTI"))})
+		cmds = append(cmds, queued...)
+		cmds = append(cmds, []*redis.Resp{redis.NewBulkBytes([]byte("EXEC"))})
+		replies, err := doCommands(c, cmds...)
+		if err != nil {
+			return err
+		}
+		r.Resp = replies[len(replies)-1]
+		if ns := r.Namespace; ns != "" && r.Resp.IsArray() {
+			for i, x := range r.Resp.Array {
+				if i < len(ops) {
+					stripNamespaceReply(ns, ops[i], x)
+				}
+			}
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy/redis"
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+// fakeTxnBackend implements GET/SET with MULTI/EXEC/WATCH for the tests.
+type fakeTxnBackend struct {
+	*fakeBackend
+
+	mu      sync.Mutex
+	data    map[string]string
+	version map[string]int
+}
+
+func newFakeTxnBackend() *fakeTxnBackend {
+	b := &fakeTxnBackend{data: make(map[string]string), version: make(map[string]int)}
+	b.fakeBackend = newFakeConnBackend(b.serve)
+	return b
+}
+
+func (b *fakeTxnBackend) call(multi []*redis.Resp) *redis.Resp {
+	switch strings.ToUpper(string(multi[0].Value)) {
+	case "SET":
+		b.data[string(multi[1].Value)] = string(multi[2].Value)
+		b.version[string(multi[1].Value)]++
+		return redis.NewString([]byte("OK"))
+	case "GET":
+		if v, ok := b.data[string(multi[1].Value)]; ok {
+			return redis.NewBulkBytes([]byte(v))
+		}
+		return redis.NewBulkBytes(nil)
+	default:
+		return redis.NewString([]byte("OK"))
+	}
+}
+
+func (b *fakeTxnBackend) serve(c *redis.Conn) {
+	var watched map[string]int
+	var queued [][]*redis.Resp
+	var multi bool
+	for {
+		args, err := c.DecodeMultiBulk()
+		if err != nil {
+			return
+		}
+		var resp *redis.Resp
+		b.mu.Lock()
+		switch op := strings.ToUpper(string(args[0].Value)); {
+		case op == "WATCH":
+			if watched == nil {
+				watched = make(map[string]int)
+			}
+			for _, key := range args[1:] {
+				watched[string(key.Value)] = b.version[string(key.Value)]
+			}
+			resp = redis.NewString([]byte("OK"))
+		case op == "MULTI":
+			multi, queued = true, nil
+			resp = redis.NewString([]byte("OK"))
+		case op == "EXEC":
+			var array []*redis.Resp
+			var dirty bool
+			for key, v := range watched {
+				dirty = dirty || b.version[key] != v
+			}
+			if !dirty {
+				array = []*redis.Resp{}
+				for _, x := range queued {
+					array = append(array, b.call(x))
+				}
+			}
+			multi, queued, watched = false, nil, nil
+			resp = redis.NewArray(array)
+		case multi:
+			queued = append(queued, args)
+			resp = redis.NewString([]byte("QUEUED"))
+		default:
+			resp = b.call(args)
+		}
+		b.mu.Unlock()
+		if err := c.Encode(resp, true); err != nil {
+			return
+		}
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	b := newFakeTxnBackend()
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s, d, "MULTI").IsError())
+	assert.Must(string(handleTestRequest(s, d, "SET", "{user}name", "codis").Value) == "QUEUED")
+	assert.Must(string(handleTestRequest(s, d, "GET", "{user}name").Value) == "QUEUED")
+	resp := handleTestRequest(s, d, "EXEC")
+	assert.Must(resp.IsArray() && len(resp.Array) == 2)
+	assert.Must(string(resp.Array[1].Value) == "codis")
+
+	assert.Must(handleTestRequest(s, d, "EXEC").IsError())
+	assert.Must(handleTestRequest(s, d, "DISCARD").IsError())
+
+	assert.Must(handleTestRequest(s, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s, d, "SET", "{user}a", "1").IsString())
+	assert.Must(handleTestRequest(s, d, "SET", "{other}b", "1").IsError())
+	resp = handleTestRequest(s, d, "EXEC")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "EXECABORT"))
+
+	assert.Must(handleTestRequest(s, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s, d, "MSET", "{user}a", "1", "{user}b", "2").IsString())
+	assert.Must(handleTestRequest(s, d, "MSET", "{user}a", "1", "{other}b", "2").IsError())
+	resp = handleTestRequest(s, d, "EXEC")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "EXECABORT"))
+
+	assert.Must(handleTestRequest(s, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s, d, "KEYS", "*").IsError())
+	resp = handleTestRequest(s, d, "EXEC")
+	assert.Must(resp.IsError() && strings.HasPrefix(string(resp.Value), "EXECABORT"))
+
+	assert.Must(handleTestRequest(s, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s, d, "SET", "{user}a", "1").IsString())
+	assert.Must(handleTestRequest(s, d, "DISCARD").IsString())
+	assert.Must(handleTestRequest(s, d, "GET", "{user}a").Value == nil)
+}
+
+func TestTransactionWatch(t *testing.T) {
+	b := newFakeTxnBackend()
+	defer b.Close()
+
+	d := newTestRouter(b.Addr())
+	defer d.Close()
+
+	s1, s2 := newTestSession(), newTestSession()
+
+	assert.Must(handleTestRequest(s1, d, "WATCH", "{k}1", "{k}2").IsString())
+	assert.Must(handleTestRequest(s1, d, "WATCH", "{x}").IsError())
+	assert.Must(handleTestRequest(s1, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s1, d, "WATCH", "{k}1").IsError())
+	assert.Must(handleTestRequest(s1, d, "SET", "{k}1", "v1").IsString())
+	resp := handleTestRequest(s1, d, "EXEC")
+	assert.Must(resp.IsArray() && len(resp.Array) == 1)
+
+	assert.Must(handleTestRequest(s1, d, "WATCH", "{k}1").IsString())
+	assert.Must(handleTestRequest(s2, d, "SET", "{k}1", "v2").IsString())
+	assert.Must(handleTestRequest(s1, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s1, d, "SET", "{k}1", "v3").IsString())
+	resp = handleTestRequest(s1, d, "EXEC")
+	assert.Must(resp.IsArray() && resp.Array == nil)
+	assert.Must(string(handleTestRequest(s1, d, "GET", "{k}1").Value) == "v2")
+
+	assert.Must(handleTestRequest(s1, d, "WATCH", "{k}1").IsString())
+	assert.Must(handleTestRequest(s1, d, "UNWATCH").IsString())
+	assert.Must(handleTestRequest(s2, d, "SET", "{k}1", "v4").IsString())
+	assert.Must(handleTestRequest(s1, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s1, d, "SET", "{k}1", "v5").IsString())
+	resp = handleTestRequest(s1, d, "EXEC")
+	assert.Must(resp.IsArray() && len(resp.Array) == 1)
+}
+
+func TestTransactionWatchMigrating(t *testing.T) {
+	b1 := newFakeTxnBackend()
+	defer b1.Close()
+	b2 := newFakeTxnBackend()
+	defer b2.Close()
+
+	d := newTestRouter(b1.Addr())
+	defer d.Close()
+
+	s := newTestSession()
+	assert.Must(handleTestRequest(s, d, "WATCH", "key").IsString())
+
+	id := int(Hash([]byte("key")) % uint32(models.GetMaxSlotNum()))
+	assert.MustNoError(d.FillSlot(&models.Slot{
+		Id: id, BackendAddr: b2.Addr(), MigrateFrom: b1.Addr(),
+	}))
+
+	assert.Must(handleTestRequest(s, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s, d, "SET", "key", "value").IsString())
+	resp := handleTestRequest(s, d, "EXEC")
+	assert.Must(resp.IsArray() && resp.Array == nil)
+
+	resp = handleTestRequest(s, d, "WATCH", "key")
+	assert.Must(resp.IsError() && strings.Contains(string(resp.Value), "migrating"))
+	assert.Must(handleTestRequest(s, d, "MULTI").IsString())
+	assert.Must(handleTestRequest(s, d, "SET", "key", "value").IsString())
+	resp = handleTestRequest(s, d, "EXEC")
+	assert.Must(resp.IsArray() && resp.Array == nil)
+}
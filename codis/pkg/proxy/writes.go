@@ -0,0 +1,62 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// recentWrites records the slots written by a session, so that the reads of
+// the session are sent to the masters within session_read_your_writes after a
+// write of the same slot.
+type recentWrites struct {
+	mu     sync.Mutex
+	window time.Duration
+	slots  map[int]time.Time
+}
+
+func newRecentWrites(window time.Duration) *recentWrites {
+	if window <= 0 {
+		return nil
+	}
+	return &recentWrites{window: window, slots: make(map[int]time.Time)}
+}
+
+// track records a write of the slot, or routes a read of the slot to the
+// master if it's written recently.
+func (w *recentWrites) track(r *Request, id int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var now = time.Now()
+	if !r.IsReadOnly() {
+		w.slots[id] = now.Add(w.window)
+		return
+	}
+	if r.MasterRead {
+		return
+	}
+	if expire, ok := w.slots[id]; ok {
+		if now.Before(expire) {
+			r.ReplicaRead, r.MasterRead = false, true
+		} else {
+			delete(w.slots, id)
+		}
+	}
+}
+
+// isRecent returns whether the slot is written within the window, i.e. the
+// reads of the slot are to be routed to the master by track.
+func (w *recentWrites) isRecent(id int) bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	expire, ok := w.slots[id]
+	return ok && time.Now().Before(expire)
+}
@@ -12,6 +12,8 @@ import (
 	"pika/codis/v2/pkg/utils/bytesize"
 	"pika/codis/v2/pkg/utils/errors"
 	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/secret"
 	"pika/codis/v2/pkg/utils/timesize"
 )
 
@@ -35,10 +37,40 @@ coordinator_addr = "/tmp/codis"
 product_name = "codis-demo"
 product_auth = ""
 
+# Set Vault to fetch secrets from, the token is read from vault_token_file, or from the environment
+# variable VAULT_TOKEN if empty. Secret settings, e.g. product_auth, admin_token_secret
+# and the files of TLS certificates and keys, may refer to secrets instead of plain values as
+#   "vault:<path>#<field>", e.g. "vault:secret/data/codis#product_auth" (KV version 1 or 2)
+#   "file:<path>", e.g. written by a KMS agent, or "env:<name>".
+# Secrets are refreshed every secret_refresh_period, or before their vault leases expire if sooner.
+# Files of TLS are rewritten and reloaded once changed, and a changed admin_token_secret
+# is applied at once, other secrets changed are applied after restart.
+vault_addr = ""
+vault_token_file = ""
+vault_namespace = ""
+vault_ca_file = ""
+secret_refresh_period = "5m"
+
 # Set bind address for admin(rpc), tcp only.
 admin_addr = "0.0.0.0:18080"
 
-# Set slot num
+# Set mutual TLS of the admin(rpc) API among codis-dashboard, codis-proxy and codis-fe, which is enabled
+# if admin_tls_cert_file, admin_tls_key_file and admin_tls_ca_file are set. Peers must present certificates
+# signed by admin_tls_ca_file, and with a common name or DNS name in admin_tls_allowed_names if not empty,
+# e.g. "codis-dashboard,codis-proxy,codis-fe". product_auth is still required as before.
+admin_tls_cert_file = ""
+admin_tls_key_file = ""
+admin_tls_ca_file = ""
+admin_tls_allowed_names = ""
+
+# Set the secret to sign tokens (JWT with HS256) of the admin(rpc) API, at least 16 bytes. If it's set,
+# requests must have header "Authorization: Bearer <token>", tokens of role "read" are allowed to GET
+# only and tokens of role "admin" are allowed to call any API. codis-dashboard, codis-proxy and codis-fe
+# must share the same secret, and tokens for tools can be issued by codis-admin --issue-token.
+admin_token_secret = ""
+
+# Set slot num, e.g. 1024, 4096 or 16384. It's fixed when the product is created, and proxies
+# must use the same slot num as the dashboard.
 max_slot_num = 1024
 
 # Set arguments for data migration (only accept 'sync' & 'semi-async').
@@ -49,6 +81,12 @@ migration_async_maxbytes = "32mb"
 migration_async_numkeys = 500
 migration_timeout = "30s"
 
+# Set the QPS limit of the product, shared by all proxies, 0 means unlimited. The dashboard splits
+# it among the proxies every second, half evenly and half by the QPS of each proxy, and proxies
+# refuse requests over their shares. It can be changed by codis-admin --qps-limit at runtime, which is
+# stored and overrides this one since then. Proxies drop their shares if not refreshed for 30 seconds.
+product_qps_limit = 0
+
 # Set configs for redis sentinel.
 sentinel_check_server_state_interval = "10s"
 sentinel_check_master_failover_interval = "2s"
@@ -70,11 +108,23 @@ type Config struct {
 
 	AdminAddr string `toml:"admin_addr" json:"admin_addr"`
 
+	AdminTLSCertFile     string `toml:"admin_tls_cert_file" json:"admin_tls_cert_file"`
+	AdminTLSKeyFile      string `toml:"admin_tls_key_file" json:"admin_tls_key_file"`
+	AdminTLSCAFile       string `toml:"admin_tls_ca_file" json:"admin_tls_ca_file"`
+	AdminTLSAllowedNames string `toml:"admin_tls_allowed_names" json:"admin_tls_allowed_names"`
+	AdminTokenSecret     string `toml:"admin_token_secret" json:"-"`
+
 	HostAdmin string `toml:"-" json:"-"`
 
 	ProductName string `toml:"product_name" json:"product_name"`
 	ProductAuth string `toml:"product_auth" json:"-"`
 
+	VaultAddr           string            `toml:"vault_addr" json:"vault_addr"`
+	VaultTokenFile      string            `toml:"vault_token_file" json:"vault_token_file"`
+	VaultNamespace      string            `toml:"vault_namespace" json:"vault_namespace"`
+	VaultCAFile         string            `toml:"vault_ca_file" json:"vault_ca_file"`
+	SecretRefreshPeriod timesize.Duration `toml:"secret_refresh_period" json:"secret_refresh_period"`
+
 	MigrationMethod        string            `toml:"migration_method" json:"migration_method"`
 	MigrationParallelSlots int               `toml:"migration_parallel_slots" json:"migration_parallel_slots"`
 	MigrationAsyncMaxBulks int               `toml:"migration_async_maxbulks" json:"migration_async_maxbulks"`
@@ -82,6 +132,8 @@ type Config struct {
 	MigrationAsyncNumKeys  int               `toml:"migration_async_numkeys" json:"migration_async_numkeys"`
 	MigrationTimeout       timesize.Duration `toml:"migration_timeout" json:"migration_timeout"`
 
+	ProductQPSLimit int64 `toml:"product_qps_limit" json:"product_qps_limit"`
+
 	MaxSlotNum int `toml:"max_slot_num" json:"max_slot_num"`
 
 	SentinelCheckServerStateInterval    timesize.Duration `toml:"sentinel_check_server_state_interval" json:"sentinel_client_timeout"`
@@ -134,9 +186,20 @@ func (c *Config) Validate() error {
 	if c.AdminAddr == "" {
 		return errors.New("invalid admin_addr")
 	}
+	if c.AdminTLSCertFile != "" || c.AdminTLSKeyFile != "" || c.AdminTLSCAFile != "" {
+		if c.AdminTLSCertFile == "" || c.AdminTLSKeyFile == "" || c.AdminTLSCAFile == "" {
+			return errors.New("invalid admin_tls_cert_file, admin_tls_key_file or admin_tls_ca_file")
+		}
+	}
+	if c.AdminTokenSecret != "" && !secret.IsRef(c.AdminTokenSecret) && len(c.AdminTokenSecret) < rpc.MinTokenSecretLen {
+		return errors.New("invalid admin_token_secret")
+	}
 	if c.ProductName == "" {
 		return errors.New("invalid product_name")
 	}
+	if c.SecretRefreshPeriod < 0 {
+		return errors.New("invalid secret_refresh_period")
+	}
 	if c.MaxSlotNum <= 0 {
 		return errors.New("invalid max_slot_num")
 	}
@@ -158,6 +221,9 @@ func (c *Config) Validate() error {
 	if c.MigrationTimeout <= 0 {
 		return errors.New("invalid migration_timeout")
 	}
+	if c.ProductQPSLimit < 0 {
+		return errors.New("invalid product_qps_limit")
+	}
 	if c.SentinelClientTimeout <= 0 {
 		return errors.New("invalid sentinel_client_timeout")
 	}
@@ -21,6 +21,9 @@ type context struct {
 	proxy map[string]*models.Proxy
 
 	sentinel *models.Sentinel
+	commands *models.Commands
+	rotation *models.AuthRotation
+	quotas   *models.Quotas
 
 	hosts struct {
 		sync.Mutex
@@ -80,6 +83,7 @@ func (ctx *context) toSlot(m *models.SlotMapping, p *models.Proxy) *models.Slot
 	slot := &models.Slot{
 		Id:     m.Id,
 		Locked: ctx.isSlotLocked(m),
+		Fenced: ctx.isGroupFenced(m.GroupId) || ctx.isGroupFenced(m.Action.TargetId),
 
 		ForwardMethod: ctx.method,
 	}
@@ -88,6 +92,7 @@ func (ctx *context) toSlot(m *models.SlotMapping, p *models.Proxy) *models.Slot
 		slot.BackendAddr = ctx.getGroupMaster(m.GroupId)
 		slot.BackendAddrGroupId = m.GroupId
 		slot.ReplicaGroups = ctx.toReplicaGroups(m.GroupId, p)
+		slot.ReplicaDataCenters = ctx.toReplicaDataCenters(m.GroupId)
 	case models.ActionPreparing:
 		slot.BackendAddr = ctx.getGroupMaster(m.GroupId)
 		slot.BackendAddrGroupId = m.GroupId
@@ -165,6 +170,25 @@ func (ctx *context) toReplicaGroups(gid int, p *models.Proxy) [][]string {
 	return replicas
 }
 
+// toReplicaDataCenters returns the data centers of the replicas of the group,
+// so that proxies can prefer the replicas in their own data centers.
+func (ctx *context) toReplicaDataCenters(gid int) map[string]string {
+	g := ctx.group[gid]
+	if g == nil {
+		return nil
+	}
+	var datacenters map[string]string
+	for _, s := range g.Servers {
+		if s.ReplicaGroup && s.DataCenter != "" {
+			if datacenters == nil {
+				datacenters = make(map[string]string)
+			}
+			datacenters[s.Addr] = s.DataCenter
+		}
+	}
+	return datacenters
+}
+
 func (ctx *context) toSlotSlice(slots []*models.SlotMapping, p *models.Proxy) []*models.Slot {
 	var slice = make([]*models.Slot, len(slots))
 	for i, m := range slots {
@@ -298,6 +322,13 @@ func (ctx *context) isGroupLocked(gid int) bool {
 	return false
 }
 
+func (ctx *context) isGroupFenced(gid int) bool {
+	if g := ctx.group[gid]; g != nil {
+		return g.Fenced
+	}
+	return false
+}
+
 func (ctx *context) isGroupPromoting(gid int) bool {
 	if g := ctx.group[gid]; g != nil {
 		return g.Promoting.State != models.ActionNothing
@@ -312,6 +343,38 @@ func (ctx *context) getProxy(token string) (*models.Proxy, error) {
 	return nil, errors.Errorf("proxy-[%s] doesn't exist", token)
 }
 
+// checkProxyHashing fails if the proxy hashes keys differently from the other
+// proxies of the product, which would send the same key to different slots.
+func (ctx *context) checkProxyHashing(p *models.Proxy) error {
+	for _, x := range ctx.proxy {
+		switch {
+		case x.Token == p.Token:
+		case x.HashTag != p.HashTag:
+			return errors.Errorf("proxy@%s hash_tag = %q, mismatch %q of proxy-[%s]", p.AdminAddr, p.HashTag, x.HashTag, x.Token)
+		case x.HashMode != p.HashMode:
+			return errors.Errorf("proxy@%s hash_mode = %q, mismatch %q of proxy-[%s]", p.AdminAddr, p.HashMode, x.HashMode, x.Token)
+		case x.HashKeySum != p.HashKeySum:
+			return errors.Errorf("proxy@%s hash_key mismatch of proxy-[%s]", p.AdminAddr, x.Token)
+		}
+	}
+	return nil
+}
+
+// checkSlotsMigration fails if keys aren't hashed by the proxies as Pika does
+// in slotsmgrt, i.e. crc32 of the "{}" hash tag, or keys would be migrated
+// along with slots they don't belong to.
+func (ctx *context) checkSlotsMigration() error {
+	for _, p := range ctx.proxy {
+		switch {
+		case p.HashTag != "":
+			return errors.Errorf("proxy-[%s] hash_tag = %q, slots can't be migrated", p.Token, p.HashTag)
+		case p.HashMode != "":
+			return errors.Errorf("proxy-[%s] hash_mode = %q, slots can't be migrated", p.Token, p.HashMode)
+		}
+	}
+	return nil
+}
+
 func (ctx *context) maxProxyId() (maxId int) {
 	for _, p := range ctx.proxy {
 		maxId = math2.MaxInt(maxId, p.Id)
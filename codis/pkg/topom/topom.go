@@ -23,7 +23,9 @@ import (
 	"pika/codis/v2/pkg/utils/redis"
 	"pika/codis/v2/pkg/utils/rpc"
 	gxruntime "pika/codis/v2/pkg/utils/runtime"
+	"pika/codis/v2/pkg/utils/secret"
 	"pika/codis/v2/pkg/utils/sync2/atomic2"
+	"pika/codis/v2/pkg/utils/tls2"
 )
 
 type Topom struct {
@@ -39,6 +41,18 @@ type Topom struct {
 		proxy map[string]*models.Proxy
 
 		sentinel *models.Sentinel
+		commands *models.Commands
+		rotation *models.AuthRotation
+		quotas   *models.Quotas
+	}
+
+	// auth is the rotation of product_auth applied to the clients of servers
+	// and proxies, and the passwords of the rotation, which are stored only
+	// as hashes.
+	auth struct {
+		rotation redis.AuthRotation
+
+		productAuth, sessionAuth string
 	}
 
 	exit struct {
@@ -63,6 +77,18 @@ type Topom struct {
 		executor atomic2.Int64
 	}
 
+	qpslimit struct {
+		limit atomic2.Int64
+
+		mu     sync.Mutex
+		shares map[string]int64
+		pushed map[string]time.Time
+	}
+
+	confighistory struct {
+		seen map[string]int64
+	}
+
 	stats struct {
 		redisp *redis.Pool
 
@@ -76,6 +102,8 @@ type Topom struct {
 		monitor *redis.CodisSentinel
 		masters map[int]string
 	}
+
+	secrets *secret.Manager
 }
 
 var ErrClosedTopom = errors.New("use of closed topom")
@@ -90,8 +118,13 @@ func New(client models.Client, config *Config) (*Topom, error) {
 	s := &Topom{}
 	s.config = config
 	s.exit.C = make(chan struct{})
+	if err := s.setupSecrets(config); err != nil {
+		return nil, err
+	}
 	s.action.redisp = redis.NewPool(config.ProductAuth, config.MigrationTimeout.Duration())
+	s.action.redisp.SetAuthRotation(&s.auth.rotation)
 	s.action.progress.status.Store("")
+	s.qpslimit.limit.Set(config.ProductQPSLimit)
 
 	s.ha.redisp = redis.NewPool("", time.Second*5)
 
@@ -109,6 +142,7 @@ func New(client models.Client, config *Config) (*Topom, error) {
 	s.store = models.NewStore(client, config.ProductName)
 
 	s.stats.redisp = redis.NewPool(config.ProductAuth, time.Second*5)
+	s.stats.redisp.SetAuthRotation(&s.auth.rotation)
 	s.stats.servers = make(map[string]*RedisStats)
 	s.stats.proxies = make(map[string]*ProxyStats)
 
@@ -125,10 +159,25 @@ func New(client models.Client, config *Config) (*Topom, error) {
 }
 
 func (s *Topom) setup(config *Config) error {
+	if config.AdminTLSCertFile != "" {
+		if err := rpc.SetupTLS(tls2.Files{
+			CertFile: config.AdminTLSCertFile,
+			KeyFile:  config.AdminTLSKeyFile,
+			CAFile:   config.AdminTLSCAFile,
+		}, rpc.ParseNames(config.AdminTLSAllowedNames)); err != nil {
+			return err
+		}
+	}
+	if config.AdminTokenSecret != "" {
+		if err := rpc.SetupToken(config.AdminTokenSecret, "codis-dashboard"); err != nil {
+			return err
+		}
+	}
+
 	if l, err := net.Listen("tcp", config.AdminAddr); err != nil {
 		return errors.Trace(err)
 	} else {
-		s.ladmin = l
+		s.ladmin = rpc.NewListener(l)
 
 		x, err := utils.ReplaceUnspecifiedIP("tcp", l.Addr().String(), s.config.HostAdmin)
 		if err != nil {
@@ -166,6 +215,10 @@ func (s *Topom) Close() error {
 		}
 	}
 
+	if s.secrets != nil {
+		s.secrets.Close()
+	}
+
 	defer s.store.Close()
 
 	if s.online {
@@ -177,6 +230,25 @@ func (s *Topom) Close() error {
 	return nil
 }
 
+// checkMaxSlotNum records the number of slots when the product is created,
+// and makes sure it's never changed, since keys are hashed into slots by it.
+func (s *Topom) checkMaxSlotNum() error {
+	n, err := s.store.LoadMaxSlotNum()
+	switch {
+	case err != nil:
+		log.ErrorErrorf(err, "store: load max_slot_num of %s failed", s.config.ProductName)
+		return errors.Errorf("store: load max_slot_num of %s failed", s.config.ProductName)
+	case n == 0:
+		if err := s.store.UpdateMaxSlotNum(models.GetMaxSlotNum()); err != nil {
+			log.ErrorErrorf(err, "store: update max_slot_num of %s failed", s.config.ProductName)
+			return errors.Errorf("store: update max_slot_num of %s failed", s.config.ProductName)
+		}
+	case n != models.GetMaxSlotNum():
+		return errors.Errorf("max_slot_num = %d, but %s is created with %d", models.GetMaxSlotNum(), s.config.ProductName, n)
+	}
+	return nil
+}
+
 func (s *Topom) Start(routines bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -190,9 +262,29 @@ func (s *Topom) Start(routines bool) error {
 			log.ErrorErrorf(err, "store: acquire lock of %s failed", s.config.ProductName)
 			return errors.Errorf("store: acquire lock of %s failed", s.config.ProductName)
 		}
+		if err := s.checkMaxSlotNum(); err != nil {
+			if err := s.store.Release(); err != nil {
+				log.WarnErrorf(err, "store: release lock of %s failed", s.config.ProductName)
+			}
+			return err
+		}
+		if err := s.loadQPSLimit(); err != nil {
+			if err := s.store.Release(); err != nil {
+				log.WarnErrorf(err, "store: release lock of %s failed", s.config.ProductName)
+			}
+			return err
+		}
 		s.online = true
 	}
 
+	if ctx, err := s.newContext(); err != nil {
+		return err
+	} else if r, err := s.authRotation(ctx.rotation); err != nil {
+		log.WarnErrorf(err, "apply auth rotation failed")
+	} else {
+		s.applyAuthRotation(r)
+	}
+
 	if !routines {
 		return nil
 	}
@@ -312,6 +404,9 @@ func (s *Topom) newContext() (*context, error) {
 			ctx.group = s.cache.group
 			ctx.proxy = s.cache.proxy
 			ctx.sentinel = s.cache.sentinel
+			ctx.commands = s.cache.commands
+			ctx.rotation = s.cache.rotation
+			ctx.quotas = s.cache.quotas
 			ctx.hosts.m = make(map[string]net.IP)
 			ctx.method, _ = models.ParseForwardMethod(s.config.MigrationMethod)
 			return ctx, nil
@@ -352,6 +447,13 @@ func (s *Topom) Stats() (*Stats, error) {
 	stats.SlotAction.Progress.Status = s.action.progress.status.Load().(string)
 	stats.SlotAction.Executor = s.action.executor.Int64()
 
+	stats.Commands = ctx.commands
+	stats.AuthRotation = ctx.rotation.Masked()
+	stats.Quotas = ctx.quotas
+
+	stats.QPSLimit.Limit = s.qpslimit.limit.Int64()
+	stats.QPSLimit.Shares = s.qpsLimitShares()
+
 	stats.HA.Model = ctx.sentinel
 	stats.HA.Stats = map[string]*RedisStats{}
 	for _, server := range ctx.sentinel.Servers {
@@ -394,6 +496,17 @@ type Stats struct {
 		Executor int64 `json:"executor"`
 	} `json:"slot_action"`
 
+	Commands *models.Commands `json:"commands"`
+
+	AuthRotation *models.AuthRotation `json:"auth_rotation"`
+
+	Quotas *models.Quotas `json:"quotas"`
+
+	QPSLimit struct {
+		Limit  int64            `json:"limit"`
+		Shares map[string]int64 `json:"shares,omitempty"`
+	} `json:"qps_limit"`
+
 	HA struct {
 		Model   *models.Sentinel       `json:"model"`
 		Stats   map[string]*RedisStats `json:"stats"`
@@ -401,6 +514,12 @@ type Stats struct {
 	} `json:"sentinels"`
 }
 
+// newRedisClient returns a client of the server authenticated by product_auth,
+// or by the passwords of its rotation in turn.
+func (s *Topom) newRedisClient(addr string, timeout time.Duration) (*redis.Client, error) {
+	return s.auth.rotation.NewClient(addr, s.config.ProductAuth, timeout)
+}
+
 func (s *Topom) Config() *Config {
 	return s.config
 }
@@ -20,7 +20,6 @@ import (
 	"pika/codis/v2/pkg/models"
 	"pika/codis/v2/pkg/utils/errors"
 	"pika/codis/v2/pkg/utils/log"
-	"pika/codis/v2/pkg/utils/redis"
 	"pika/codis/v2/pkg/utils/rpc"
 )
 
@@ -47,6 +46,9 @@ func newApiServer(t *Topom) http.Handler {
 		}
 		c.Next()
 	})
+	m.Use(func(w http.ResponseWriter, req *http.Request) {
+		rpc.ApiVerifyToken(w, req)
+	})
 	m.Use(gzip.All())
 	m.Use(func(c martini.Context, w http.ResponseWriter) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -77,6 +79,8 @@ func newApiServer(t *Topom) http.Handler {
 		r.Put("/reload/:xauth", api.Reload)
 		r.Put("/shutdown/:xauth", api.Shutdown)
 		r.Put("/loglevel/:xauth/:value", api.LogLevel)
+		r.Put("/profile/:xauth/:kind", api.Profile)
+		r.Put("/profile/:xauth/:kind/:seconds", api.Profile)
 		r.Group("/proxy", func(r martini.Router) {
 			r.Put("/create/:xauth/:addr", api.CreateProxy)
 			r.Put("/online/:xauth/:addr", api.OnlineProxy)
@@ -113,6 +117,24 @@ func newApiServer(t *Topom) http.Handler {
 			r.Put("/assign/:xauth/offline", binding.Json([]*models.SlotMapping{}), api.SlotsAssignOffline)
 			r.Put("/rebalance/:xauth/:confirm", api.SlotsRebalance)
 		})
+		r.Group("/commands", func(r martini.Router) {
+			r.Put("/update/:xauth", binding.Json(models.Commands{}), api.UpdateCommands)
+			r.Put("/resync/:xauth", api.ResyncCommands)
+		})
+		r.Group("/auth-rotation", func(r martini.Router) {
+			r.Put("/update/:xauth", binding.Json(models.AuthRotation{}), api.UpdateAuthRotation)
+			r.Put("/resync/:xauth", api.ResyncAuthRotation)
+			r.Put("/clear/:xauth", api.ClearAuthRotation)
+		})
+		r.Group("/quotas", func(r martini.Router) {
+			r.Put("/update/:xauth", binding.Json(models.Quotas{}), api.UpdateQuotas)
+			r.Put("/resync/:xauth", api.ResyncQuotas)
+		})
+		r.Group("/config", func(r martini.Router) {
+			r.Get("/history/:xauth", api.ConfigHistory)
+			r.Put("/rollback/:xauth/:version", api.RollbackConfig)
+		})
+		r.Put("/qpslimit/:xauth/:value", api.SetProductQPSLimit)
 	})
 
 	m.MapTo(r, (*martini.Routes)(nil))
@@ -359,7 +381,7 @@ func (s *apiServer) GroupAddServer(params martini.Params) (int, string) {
 		return rpc.ApiResponseError(err)
 	}
 	dc := params["datacenter"]
-	c, err := redis.NewClient(addr, s.topom.Config().ProductAuth, time.Second)
+	c, err := s.topom.newRedisClient(addr, time.Second)
 	if err != nil {
 		log.WarnErrorf(err, "create redis client to %s failed", addr)
 		return rpc.ApiResponseError(err)
@@ -457,7 +479,7 @@ func (s *apiServer) InfoServer(params martini.Params) (int, string) {
 	if err != nil {
 		return rpc.ApiResponseError(err)
 	}
-	c, err := redis.NewClient(addr, s.topom.Config().ProductAuth, time.Second)
+	c, err := s.topom.newRedisClient(addr, time.Second)
 	if err != nil {
 		log.WarnErrorf(err, "create redis client to %s failed", addr)
 		return rpc.ApiResponseError(err)
@@ -596,6 +618,14 @@ func (s *apiServer) LogLevel(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) Profile(params martini.Params, w http.ResponseWriter) {
+	if err := s.verifyXAuth(params); err != nil {
+		rpc.ApiWriteError(w, err)
+		return
+	}
+	rpc.ApiResponseProfile(w, "dashboard", params["kind"], params["seconds"])
+}
+
 func (s *apiServer) Shutdown(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -653,6 +683,115 @@ func (s *apiServer) SlotsAssignOffline(slots []*models.SlotMapping, params marti
 	return rpc.ApiResponseJson("OK")
 }
 
+func (s *apiServer) UpdateCommands(c models.Commands, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.UpdateCommands(&c); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) ResyncCommands(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.ResyncCommands(); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) UpdateQuotas(q models.Quotas, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.UpdateQuotas(&q); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) SetProductQPSLimit(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	value, err := s.parseInteger(params, "value")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.SetProductQPSLimit(int64(value)); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) ResyncQuotas(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.ResyncQuotas(); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) ConfigHistory(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	h, err := s.topom.ConfigHistory()
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(h)
+}
+
+func (s *apiServer) RollbackConfig(params martini.Params, req *http.Request) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	version, err := s.parseInteger(params, "version")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.RollbackConfig(int64(version), "dashboard@"+req.RemoteAddr); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) UpdateAuthRotation(r models.AuthRotation, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.UpdateAuthRotation(&r); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) ResyncAuthRotation(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.ResyncAuthRotation(); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) ClearAuthRotation(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.ClearAuthRotation(); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
 func (s *apiServer) SlotsRebalance(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -740,6 +879,11 @@ func (c *ApiClient) LogLevel(level log.LogLevel) error {
 	return rpc.ApiPutJson(url, nil, nil)
 }
 
+func (c *ApiClient) Profile(kind string, seconds int) ([]byte, error) {
+	url := c.encodeURL("/api/topom/profile/%s/%s/%d", c.xauth, kind, seconds)
+	return rpc.ApiPutProfile(url, seconds)
+}
+
 func (c *ApiClient) Shutdown() error {
 	url := c.encodeURL("/api/topom/shutdown/%s", c.xauth)
 	return rpc.ApiPutJson(url, nil, nil)
@@ -902,3 +1046,57 @@ func (c *ApiClient) SlotsRebalance(confirm bool) (map[int]int, error) {
 		return m, nil
 	}
 }
+
+func (c *ApiClient) UpdateCommands(commands *models.Commands) error {
+	url := c.encodeURL("/api/topom/commands/update/%s", c.xauth)
+	return rpc.ApiPutJson(url, commands, nil)
+}
+
+func (c *ApiClient) ResyncCommands() error {
+	url := c.encodeURL("/api/topom/commands/resync/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) UpdateQuotas(q *models.Quotas) error {
+	url := c.encodeURL("/api/topom/quotas/update/%s", c.xauth)
+	return rpc.ApiPutJson(url, q, nil)
+}
+
+func (c *ApiClient) SetProductQPSLimit(n int64) error {
+	url := c.encodeURL("/api/topom/qpslimit/%s/%d", c.xauth, n)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) ResyncQuotas() error {
+	url := c.encodeURL("/api/topom/quotas/resync/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) ConfigHistory() (*models.ConfigHistory, error) {
+	url := c.encodeURL("/api/topom/config/history/%s", c.xauth)
+	var h = &models.ConfigHistory{}
+	if err := rpc.ApiGetJson(url, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (c *ApiClient) RollbackConfig(version int64) error {
+	url := c.encodeURL("/api/topom/config/rollback/%s/%d", c.xauth, version)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) UpdateAuthRotation(r *models.AuthRotation) error {
+	url := c.encodeURL("/api/topom/auth-rotation/update/%s", c.xauth)
+	return rpc.ApiPutJson(url, r, nil)
+}
+
+func (c *ApiClient) ResyncAuthRotation() error {
+	url := c.encodeURL("/api/topom/auth-rotation/resync/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) ClearAuthRotation() error {
+	url := c.encodeURL("/api/topom/auth-rotation/clear/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
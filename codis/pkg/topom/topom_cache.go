@@ -45,12 +45,33 @@ func (s *Topom) dirtySentinelCache() {
 	})
 }
 
+func (s *Topom) dirtyCommandsCache() {
+	s.cache.hooks.PushBack(func() {
+		s.cache.commands = nil
+	})
+}
+
+func (s *Topom) dirtyAuthRotationCache() {
+	s.cache.hooks.PushBack(func() {
+		s.cache.rotation = nil
+	})
+}
+
+func (s *Topom) dirtyQuotasCache() {
+	s.cache.hooks.PushBack(func() {
+		s.cache.quotas = nil
+	})
+}
+
 func (s *Topom) dirtyCacheAll() {
 	s.cache.hooks.PushBack(func() {
 		s.cache.slots = nil
 		s.cache.group = nil
 		s.cache.proxy = nil
 		s.cache.sentinel = nil
+		s.cache.commands = nil
+		s.cache.rotation = nil
+		s.cache.quotas = nil
 	})
 }
 
@@ -83,6 +104,24 @@ func (s *Topom) refillCache() error {
 	} else {
 		s.cache.sentinel = sentinel
 	}
+	if commands, err := s.refillCacheCommands(s.cache.commands); err != nil {
+		log.ErrorErrorf(err, "store: load commands failed")
+		return errors.Errorf("store: load commands failed")
+	} else {
+		s.cache.commands = commands
+	}
+	if rotation, err := s.refillCacheAuthRotation(s.cache.rotation); err != nil {
+		log.ErrorErrorf(err, "store: load auth rotation failed")
+		return errors.Errorf("store: load auth rotation failed")
+	} else {
+		s.cache.rotation = rotation
+	}
+	if quotas, err := s.refillCacheQuotas(s.cache.quotas); err != nil {
+		log.ErrorErrorf(err, "store: load quotas failed")
+		return errors.Errorf("store: load quotas failed")
+	} else {
+		s.cache.quotas = quotas
+	}
 	return nil
 }
 
@@ -163,6 +202,48 @@ func (s *Topom) refillCacheSentinel(sentinel *models.Sentinel) (*models.Sentinel
 	return &models.Sentinel{}, nil
 }
 
+func (s *Topom) refillCacheCommands(commands *models.Commands) (*models.Commands, error) {
+	if commands != nil {
+		return commands, nil
+	}
+	c, err := s.store.LoadCommands(false)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		return c, nil
+	}
+	return &models.Commands{}, nil
+}
+
+func (s *Topom) refillCacheAuthRotation(rotation *models.AuthRotation) (*models.AuthRotation, error) {
+	if rotation != nil {
+		return rotation, nil
+	}
+	r, err := s.store.LoadAuthRotation(false)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		return r, nil
+	}
+	return &models.AuthRotation{}, nil
+}
+
+func (s *Topom) refillCacheQuotas(quotas *models.Quotas) (*models.Quotas, error) {
+	if quotas != nil {
+		return quotas, nil
+	}
+	q, err := s.store.LoadQuotas(false)
+	if err != nil {
+		return nil, err
+	}
+	if q != nil {
+		return q, nil
+	}
+	return &models.Quotas{}, nil
+}
+
 func (s *Topom) storeUpdateSlotMapping(m *models.SlotMapping) error {
 	log.Warnf("update slot-[%d]:\n%s", m.Id, m.Encode())
 	if err := s.store.UpdateSlotMapping(m); err != nil {
@@ -241,3 +322,38 @@ func (s *Topom) storeUpdateSentinel(p *models.Sentinel) error {
 	}
 	return nil
 }
+
+func (s *Topom) storeUpdateCommands(c *models.Commands) error {
+	log.Warnf("update commands:\n%s", c.Encode())
+	if err := s.store.UpdateCommands(c); err != nil {
+		log.ErrorErrorf(err, "store: update commands failed")
+		return errors.Errorf("store: update commands failed")
+	}
+	return nil
+}
+
+func (s *Topom) storeUpdateAuthRotation(r *models.AuthRotation) error {
+	log.Warnf("update auth rotation:\n%s", r.Masked().Encode())
+	if err := s.store.UpdateAuthRotation(r); err != nil {
+		log.ErrorErrorf(err, "store: update auth rotation failed")
+		return errors.Errorf("store: update auth rotation failed")
+	}
+	return nil
+}
+
+func (s *Topom) storeUpdateQuotas(q *models.Quotas) error {
+	log.Warnf("update quotas:\n%s", q.Encode())
+	if err := s.store.UpdateQuotas(q); err != nil {
+		log.ErrorErrorf(err, "store: update quotas failed")
+		return errors.Errorf("store: update quotas failed")
+	}
+	return nil
+}
+
+func (s *Topom) storeUpdateConfigHistory(h *models.ConfigHistory) error {
+	if err := s.store.UpdateConfigHistory(h); err != nil {
+		log.ErrorErrorf(err, "store: update config history failed")
+		return errors.Errorf("store: update config history failed")
+	}
+	return nil
+}
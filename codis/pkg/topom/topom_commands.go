@@ -0,0 +1,80 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2"
+)
+
+// UpdateCommands replaces the commands disabled or renamed on all proxies.
+func (s *Topom) UpdateCommands(c *models.Commands) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+	if err := proxy.ValidateCommandOverrides(c); err != nil {
+		return err
+	}
+	defer s.dirtyCommandsCache()
+
+	c.OutOfSync = true
+	if err := s.storeUpdateCommands(c); err != nil {
+		return err
+	}
+	ctx.commands = c
+
+	if err := s.resyncCommands(ctx); err != nil {
+		log.Warnf("resync commands failed")
+		return err
+	}
+	c.OutOfSync = false
+	return s.storeUpdateCommands(c)
+}
+
+func (s *Topom) ResyncCommands() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+	defer s.dirtyCommandsCache()
+
+	if err := s.resyncCommands(ctx); err != nil {
+		log.Warnf("resync commands failed")
+		return err
+	}
+	c := ctx.commands
+	c.OutOfSync = false
+	return s.storeUpdateCommands(c)
+}
+
+func (s *Topom) resyncCommands(ctx *context) error {
+	var fut sync2.Future
+	for _, p := range ctx.proxy {
+		fut.Add()
+		go func(p *models.Proxy) {
+			err := s.newProxyClient(p).SetCommands(ctx.commands)
+			if err != nil {
+				log.ErrorErrorf(err, "proxy-[%s] resync commands failed", p.Token)
+			}
+			fut.Done(p.Token, err)
+		}(p)
+	}
+	for t, v := range fut.Wait() {
+		switch err := v.(type) {
+		case error:
+			if err != nil {
+				return errors.Errorf("proxy-[%s] resync commands failed", t)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"fmt"
+	"strings"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+// loadConfigHistory returns the config history of the product, with seen set
+// to the last change collected of each proxy if not yet, e.g. after restart.
+func (s *Topom) loadConfigHistory() (*models.ConfigHistory, error) {
+	h, err := s.store.LoadConfigHistory(false)
+	if err != nil {
+		log.ErrorErrorf(err, "store: load config history failed")
+		return nil, errors.Errorf("store: load config history failed")
+	}
+	if h == nil {
+		h = &models.ConfigHistory{}
+	}
+	if s.confighistory.seen == nil {
+		s.confighistory.seen = make(map[string]int64)
+		for _, c := range h.Changes {
+			if c.Seq > s.confighistory.seen[c.Proxy] {
+				s.confighistory.seen[c.Proxy] = c.Seq
+			}
+		}
+	}
+	return h, nil
+}
+
+// collectConfigChanges appends the config changes of the proxies to the
+// history, once they report a config version newer than collected. The
+// changes are fetched from the proxies without holding the lock, and those
+// collected meanwhile by another call are skipped.
+func (s *Topom) collectConfigChanges(proxies map[string]*models.Proxy, stats map[string]*ProxyStats) {
+	var pending = s.pendingConfigChanges(proxies, stats)
+	if len(pending) == 0 {
+		return
+	}
+
+	var collected = make(map[string][]*models.ConfigChange)
+	for token, since := range pending {
+		list, err := s.newProxyClient(proxies[token]).ConfigChanges(since)
+		if err != nil {
+			log.WarnErrorf(err, "proxy-[%s] collect config changes failed", token)
+			continue
+		}
+		collected[token] = list
+	}
+	if len(collected) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.loadConfigHistory()
+	if err != nil {
+		return
+	}
+	var changes []*models.ConfigChange
+	for token, list := range collected {
+		var seen = s.confighistory.seen[token]
+		for _, c := range list {
+			if c.Seq <= seen {
+				continue
+			}
+			c.Proxy = token
+			changes = append(changes, c)
+			if c.Seq > s.confighistory.seen[token] {
+				s.confighistory.seen[token] = c.Seq
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	h.Append(changes...)
+	if err := s.storeUpdateConfigHistory(h); err != nil {
+		return
+	}
+	for _, c := range h.Changes[len(h.Changes)-len(changes):] {
+		log.Warnf("config version %d: proxy-[%s] %s = %q -> %q by %s", c.Version, c.Proxy, c.Key, c.Old, c.New, c.Who)
+	}
+}
+
+// pendingConfigChanges returns the proxies having changes not yet collected,
+// with the last change collected of each.
+func (s *Topom) pendingConfigChanges(proxies map[string]*models.Proxy, stats map[string]*ProxyStats) map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.confighistory.seen == nil {
+		if _, err := s.loadConfigHistory(); err != nil {
+			return nil
+		}
+	}
+	for token := range s.confighistory.seen {
+		if proxies[token] == nil {
+			delete(s.confighistory.seen, token)
+		}
+	}
+	var pending = make(map[string]int64)
+	for token, x := range stats {
+		var p = proxies[token]
+		if p != nil && x.Stats != nil && x.Stats.ConfigVersion > s.confighistory.seen[token] {
+			pending[token] = s.confighistory.seen[token]
+		}
+	}
+	return pending
+}
+
+func (s *Topom) ConfigHistory() (*models.ConfigHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadConfigHistory()
+}
+
+// RollbackConfig restores the config of all the proxies to the version, by
+// setting each key changed since then back to the value before the first of
+// the changes. The rollback is recorded in the history as new changes. Keys
+// failed to be restored don't stop the others, and are all reported.
+func (s *Topom) RollbackConfig(version int64, who string) error {
+	type rollback struct {
+		proxy  *models.Proxy
+		change *models.ConfigChange
+	}
+	var plan []rollback
+
+	if err := func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		ctx, err := s.newContext()
+		if err != nil {
+			return err
+		}
+		h, err := s.loadConfigHistory()
+		if err != nil {
+			return err
+		}
+		if version < 0 || version > h.Version {
+			return errors.Errorf("invalid config version %d", version)
+		}
+		changes, ok := h.Since(version)
+		if !ok {
+			return errors.Errorf("config version %d is no longer in the history", version)
+		}
+		type proxyKey struct {
+			token, key string
+		}
+		var restore = make(map[proxyKey]bool)
+		for _, c := range changes {
+			var k = proxyKey{c.Proxy, c.Key}
+			if restore[k] || ctx.proxy[c.Proxy] == nil {
+				continue
+			}
+			restore[k] = true
+			plan = append(plan, rollback{ctx.proxy[c.Proxy], &models.ConfigChange{
+				Who: fmt.Sprintf("%s (rollback to version %d)", who, version),
+				Key: c.Key, New: c.Old,
+			}})
+		}
+		return nil
+	}(); err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, x := range plan {
+		if err := s.newProxyClient(x.proxy).SetConfig(x.change); err != nil {
+			log.ErrorErrorf(err, "proxy-[%s] rollback config %s failed", x.proxy.Token, x.change.Key)
+			failed = append(failed, fmt.Sprintf("proxy-[%s] %s", x.proxy.Token, x.change.Key))
+		}
+	}
+	if len(failed) != 0 {
+		log.Warnf("rollback config to version %d by %s, %d/%d keys failed", version, who, len(failed), len(plan))
+		return errors.Errorf("rollback config to version %d failed on %d/%d keys: %s",
+			version, len(failed), len(plan), strings.Join(failed, ", "))
+	}
+	log.Warnf("rollback config to version %d by %s", version, who)
+	return nil
+}
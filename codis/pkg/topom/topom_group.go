@@ -68,6 +68,7 @@ func (s *Topom) ResyncGroup(gid int) error {
 	if err != nil {
 		return err
 	}
+	g.Fenced = false
 
 	if err := s.resyncSlotMappingsByGroupId(ctx, gid); err != nil {
 		log.Warnf("group-[%d] resync-group failed", g.Id)
@@ -88,6 +89,7 @@ func (s *Topom) ResyncGroupAll() error {
 	}
 
 	for _, g := range ctx.group {
+		g.Fenced = false
 		if err := s.resyncSlotMappingsByGroupId(ctx, g.Id); err != nil {
 			log.Warnf("group-[%d] resync-group failed", g.Id)
 			return err
@@ -179,9 +181,7 @@ func (s *Topom) GroupDelServer(gid int, addr string) error {
 	}
 	defer s.dirtyGroupCache(g.Id)
 
-	if index != 0 && g.Servers[index].ReplicaGroup {
-		g.OutOfSync = true
-	}
+	var resync = index != 0 && g.Servers[index].ReplicaGroup
 
 	var slice = make([]*models.GroupServer, 0, len(g.Servers))
 	for i, x := range g.Servers {
@@ -195,7 +195,13 @@ func (s *Topom) GroupDelServer(gid int, addr string) error {
 
 	g.Servers = slice
 
-	return s.storeUpdateGroup(g)
+	if err := s.storeUpdateGroup(g); err != nil {
+		return err
+	}
+	if resync {
+		return s.resyncReplicaGroups(ctx, g)
+	}
+	return nil
 }
 
 func (s *Topom) GroupPromoteServer(gid int, addr string) error {
@@ -302,7 +308,7 @@ func (s *Topom) GroupPromoteServer(gid int, addr string) error {
 		if err := s.storeUpdateGroup(g); err != nil {
 			return err
 		}
-		_ = promoteServerToNewMaster(slice[0].Addr, s.config.ProductAuth)
+		_ = s.promoteServerToNewMaster(slice[0].Addr)
 		fallthrough
 
 	case models.ActionFinished:
@@ -382,7 +388,7 @@ func (s *Topom) tryFixReplicationRelationship(group *models.Group, groupServer *
 		}
 
 		// execute the command `slaveof no one`
-		if err = promoteServerToNewMaster(state.Addr, s.config.ProductAuth); err != nil {
+		if err = s.promoteServerToNewMaster(state.Addr); err != nil {
 			return err
 		}
 	} else {
@@ -392,7 +398,7 @@ func (s *Topom) tryFixReplicationRelationship(group *models.Group, groupServer *
 		}
 
 		// current server is slave, execute the command `slaveof [new master ip] [new master port] force`
-		if err = updateMasterToNewOneForcefully(groupServer.Addr, curMasterAddr, s.config.ProductAuth); err != nil {
+		if err = s.updateMasterToNewOneForcefully(groupServer.Addr, curMasterAddr); err != nil {
 			return err
 		}
 	}
@@ -441,22 +447,36 @@ func (s *Topom) trySwitchGroupsToNewMaster(ctx *context, masterOfflineGroups []*
 	for _, group := range masterOfflineGroups {
 		log.Infof("group-[%d] try to switch new master", group.Id)
 		group.OutOfSync = true
+		group.Fenced = true
 		err := s.storeUpdateGroup(group)
 		if err != nil {
 			s.dirtyGroupCache(group.Id)
 			continue
 		}
 
+		// Fence writes to the old master until proxies know the new one,
+		// or writes accepted by the old master during the switch are lost.
+		slots := ctx.getSlotMappingsByGroupId(group.Id)
+		if err := s.resyncSlotMappings(ctx, slots...); err != nil {
+			log.Warnf("group-[%d] fence writes failed, %v", group.Id, err)
+		}
+
 		// try to switch to new master
 		if err := s.trySwitchGroupMaster(group); err != nil {
 			log.Errorf("group-[%d] switch master failed, %v", group.Id, err)
+			group.Fenced = false
+			_ = s.storeUpdateGroup(group)
+			s.dirtyGroupCache(group.Id)
+			s.resyncSlotMappings(ctx, slots...)
 			continue
 		}
 
 		// Notify all servers to update slot information
-		slots := ctx.getSlotMappingsByGroupId(group.Id)
+		group.Fenced = false
 		if err := s.resyncSlotMappings(ctx, slots...); err != nil {
 			log.Warnf("group-[%d] notify all proxy failed, %v", group.Id, err)
+			_ = s.storeUpdateGroup(group)
+			s.dirtyGroupCache(group.Id)
 			continue
 		} else {
 			group.OutOfSync = false
@@ -475,7 +495,7 @@ func (s *Topom) trySwitchGroupMaster(group *models.Group) error {
 	}
 
 	// TODO liuchengyu check new master is available
-	//available := isAvailableAsNewMaster(masterServer, s.Config())
+	//available := s.isAvailableAsNewMaster(masterServer)
 	//if !available {
 	//	return ""
 	//}
@@ -483,8 +503,8 @@ func (s *Topom) trySwitchGroupMaster(group *models.Group) error {
 	return s.doSwitchGroupMaster(group, newMasterAddr, newMasterIndex)
 }
 
-func isAvailableAsNewMaster(groupServer *models.GroupServer, conf *Config) bool {
-	rc, err := redis.NewClient(groupServer.Addr, conf.ProductAuth, 500*time.Millisecond)
+func (s *Topom) isAvailableAsNewMaster(groupServer *models.GroupServer) bool {
+	rc, err := s.newRedisClient(groupServer.Addr, 500*time.Millisecond)
 	if err != nil {
 		log.Warnf("connect GroupServer[%v] failed!, error:%v", groupServer.Addr, err)
 		return false
@@ -513,7 +533,7 @@ func (s *Topom) doSwitchGroupMaster(g *models.Group, newMasterAddr string, newMa
 
 	log.Warnf("group-[%d] will switch master to server[%d] = %s", g.Id, newMasterIndex, newMasterAddr)
 	// Set the slave node as the new master node
-	if err = promoteServerToNewMaster(newMasterAddr, s.config.ProductAuth); err != nil {
+	if err = s.promoteServerToNewMaster(newMasterAddr); err != nil {
 		return errors.Errorf("promote server[%v] to new master failed, err:%v", newMasterAddr, err)
 	}
 
@@ -533,9 +553,9 @@ func (s *Topom) doSwitchGroupMaster(g *models.Group, newMasterAddr string, newMa
 		}
 
 		if server.IsEligibleForMasterElection {
-			err = updateMasterToNewOne(server.Addr, newMasterAddr, s.config.ProductAuth)
+			err = s.updateMasterToNewOne(server.Addr, newMasterAddr)
 		} else {
-			err = updateMasterToNewOneForcefully(server.Addr, newMasterAddr, s.config.ProductAuth)
+			err = s.updateMasterToNewOneForcefully(server.Addr, newMasterAddr)
 		}
 
 		if err != nil {
@@ -553,24 +573,24 @@ func (s *Topom) doSwitchGroupMaster(g *models.Group, newMasterAddr string, newMa
 	return err
 }
 
-func updateMasterToNewOne(serverAddr, masterAddr string, auth string) (err error) {
+func (s *Topom) updateMasterToNewOne(serverAddr, masterAddr string) (err error) {
 	log.Infof("[%s] switch master to server [%s]", serverAddr, masterAddr)
-	return setNewRedisMaster(serverAddr, masterAddr, auth, false)
+	return s.setNewRedisMaster(serverAddr, masterAddr, false)
 }
 
-func promoteServerToNewMaster(serverAddr, auth string) (err error) {
+func (s *Topom) promoteServerToNewMaster(serverAddr string) (err error) {
 	log.Infof("[%s] switch master to NO:ONE", serverAddr)
-	return setNewRedisMaster(serverAddr, "NO:ONE", auth, false)
+	return s.setNewRedisMaster(serverAddr, "NO:ONE", false)
 }
 
-func updateMasterToNewOneForcefully(serverAddr, masterAddr string, auth string) (err error) {
+func (s *Topom) updateMasterToNewOneForcefully(serverAddr, masterAddr string) (err error) {
 	log.Infof("[%s] switch master to server [%s] forcefully", serverAddr, masterAddr)
-	return setNewRedisMaster(serverAddr, masterAddr, auth, true)
+	return s.setNewRedisMaster(serverAddr, masterAddr, true)
 }
 
-func setNewRedisMaster(serverAddr, masterAddr string, auth string, force bool) (err error) {
+func (s *Topom) setNewRedisMaster(serverAddr, masterAddr string, force bool) (err error) {
 	var rc *redis.Client
-	if rc, err = redis.NewClient(serverAddr, auth, 500*time.Millisecond); err != nil {
+	if rc, err = s.newRedisClient(serverAddr, 500*time.Millisecond); err != nil {
 		return errors.Errorf("create redis client to %s failed, err:%v", serverAddr, err)
 	}
 	defer rc.Close()
@@ -602,12 +622,28 @@ func (s *Topom) EnableReplicaGroups(gid int, addr string, value bool) error {
 	}
 	defer s.dirtyGroupCache(g.Id)
 
+	g.Servers[index].ReplicaGroup = value
+
+	if err := s.storeUpdateGroup(g); err != nil {
+		return err
+	}
 	if len(g.Servers) != 1 && ctx.isGroupInUse(g.Id) {
-		g.OutOfSync = true
+		return s.resyncReplicaGroups(ctx, g)
 	}
-	g.Servers[index].ReplicaGroup = value
+	return nil
+}
 
-	return s.storeUpdateGroup(g)
+// resyncReplicaGroups sends the replica groups to the proxies after the group
+// is stored, so that they connect to the servers added, and drain the
+// connections to the servers removed. The group is left out of sync if it
+// fails.
+func (s *Topom) resyncReplicaGroups(ctx *context, g *models.Group) error {
+	if err := s.resyncSlotMappingsByGroupId(ctx, g.Id); err != nil {
+		log.Warnf("group-[%d] resync replica groups failed, %v", g.Id, err)
+		g.OutOfSync = true
+		return s.storeUpdateGroup(g)
+	}
+	return nil
 }
 
 func (s *Topom) EnableReplicaGroupsAll(value bool) error {
@@ -789,9 +825,9 @@ func (s *Topom) newSyncActionExecutor(addr string) (func() error, error) {
 
 	return func() error {
 		if index != 0 {
-			return updateMasterToNewOne(addr, masterAddr, s.config.ProductAuth)
+			return s.updateMasterToNewOne(addr, masterAddr)
 		} else {
-			return promoteServerToNewMaster(addr, s.config.ProductAuth)
+			return s.promoteServerToNewMaster(addr)
 		}
 	}, nil
 }
@@ -28,6 +28,12 @@ func (s *Topom) CreateProxy(addr string) error {
 	if err := c.XPing(); err != nil {
 		return errors.Errorf("proxy@%s check xauth failed, %s", addr, err)
 	}
+	if p.MaxSlotNum != models.GetMaxSlotNum() {
+		return errors.Errorf("proxy@%s max_slot_num = %d, mismatch %d", addr, p.MaxSlotNum, models.GetMaxSlotNum())
+	}
+	if err := ctx.checkProxyHashing(p); err != nil {
+		return err
+	}
 	if ctx.proxy[p.Token] != nil {
 		return errors.Errorf("proxy-[%s] already exists", p.Token)
 	} else {
@@ -59,6 +65,12 @@ func (s *Topom) OnlineProxy(addr string) error {
 	if err := c.XPing(); err != nil {
 		return errors.Errorf("proxy@%s check xauth failed", addr)
 	}
+	if p.MaxSlotNum != models.GetMaxSlotNum() {
+		return errors.Errorf("proxy@%s max_slot_num = %d, mismatch %d", addr, p.MaxSlotNum, models.GetMaxSlotNum())
+	}
+	if err := ctx.checkProxyHashing(p); err != nil {
+		return err
+	}
 	defer s.dirtyProxyCache(p.Token)
 
 	if d := ctx.proxy[p.Token]; d != nil {
@@ -119,7 +131,7 @@ func (s *Topom) ReinitProxy(token string) error {
 
 func (s *Topom) newProxyClient(p *models.Proxy) *proxy.ApiClient {
 	c := proxy.NewApiClient(p.AdminAddr)
-	c.SetXAuth(s.config.ProductName, s.config.ProductAuth, p.Token)
+	c.SetXAuth(s.config.ProductName, s.auth.rotation.Current(s.config.ProductAuth), p.Token)
 	return c
 }
 
@@ -129,6 +141,25 @@ func (s *Topom) reinitProxy(ctx *context, p *models.Proxy, c *proxy.ApiClient) e
 		log.ErrorErrorf(err, "proxy-[%s] fillslots failed", p.Token)
 		return errors.Errorf("proxy-[%s] fillslots failed", p.Token)
 	}
+	if err := c.SetCommands(ctx.commands); err != nil {
+		log.ErrorErrorf(err, "proxy-[%s] set commands failed", p.Token)
+		return errors.Errorf("proxy-[%s] set commands failed", p.Token)
+	}
+	if err := c.SetQuotas(ctx.quotas); err != nil {
+		log.ErrorErrorf(err, "proxy-[%s] set quotas failed", p.Token)
+		return errors.Errorf("proxy-[%s] set quotas failed", p.Token)
+	}
+	if r := ctx.rotation; r.ProductAuthHash != "" || r.SessionAuthHash != "" {
+		r, err := s.authRotation(r)
+		if err != nil {
+			log.ErrorErrorf(err, "proxy-[%s] set auth rotation failed", p.Token)
+			return errors.Errorf("proxy-[%s] set auth rotation failed", p.Token)
+		}
+		if err := c.SetAuthRotation(r); err != nil {
+			log.ErrorErrorf(err, "proxy-[%s] set auth rotation failed", p.Token)
+			return errors.Errorf("proxy-[%s] set auth rotation failed", p.Token)
+		}
+	}
 	if err := c.Start(); err != nil {
 		log.ErrorErrorf(err, "proxy-[%s] start failed", p.Token)
 		return errors.Errorf("proxy-[%s] start failed", p.Token)
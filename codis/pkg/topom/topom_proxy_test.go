@@ -5,7 +5,10 @@ package topom
 
 import (
 	"testing"
+	"time"
 
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/proxy"
 	"pika/codis/v2/pkg/utils/assert"
 )
 
@@ -78,3 +81,173 @@ func TestRemoveProxy(x *testing.T) {
 	assert.MustNoError(t.RemoveProxy(p2.Token, true))
 	check([]string{})
 }
+
+func TestUpdateCommands(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p, c := openProxy()
+	defer c.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p.AdminAddr))
+	defer proxy.SetCommandOverrides(&models.Commands{})
+
+	assert.Must(t.UpdateCommands(&models.Commands{Disabled: []string{"NOSUCHCMD"}}) != nil)
+	assert.MustNoError(t.UpdateCommands(&models.Commands{
+		Disabled: []string{"KEYS"},
+		Renamed:  map[string]string{"FLUSHDB": "FLUSHDB_1234"},
+	}))
+
+	ctx, err := t.newContext()
+	assert.MustNoError(err)
+	assert.Must(!ctx.commands.OutOfSync && len(ctx.commands.Disabled) == 1)
+
+	o, err := c.Overview()
+	assert.MustNoError(err)
+	assert.Must(o.Commands != nil && o.Commands.Renamed["FLUSHDB"] == "FLUSHDB_1234")
+}
+
+func TestUpdateAuthRotation(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p, c := openProxy()
+	defer c.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p.AdminAddr))
+
+	var deadline = time.Now().Add(time.Hour).Unix()
+	assert.Must(t.UpdateAuthRotation(&models.AuthRotation{Deadline: deadline}) != nil)
+	assert.Must(t.UpdateAuthRotation(&models.AuthRotation{SessionAuth: "new", Deadline: 1}) != nil)
+	assert.MustNoError(t.UpdateAuthRotation(&models.AuthRotation{SessionAuth: "new", Deadline: deadline}))
+	assert.Must(t.UpdateAuthRotation(&models.AuthRotation{SessionAuth: "next", Deadline: deadline}) != nil)
+	assert.Must(t.ClearAuthRotation() != nil)
+
+	ctx, err := t.newContext()
+	assert.MustNoError(err)
+	assert.Must(!ctx.rotation.OutOfSync && ctx.rotation.SessionAuthHash == models.HashAuth("new"))
+
+	r, err := t.store.LoadAuthRotation(true)
+	assert.MustNoError(err)
+	assert.Must(r.SessionAuth == "" && r.SessionAuthHash == models.HashAuth("new"))
+
+	o, err := c.Overview()
+	assert.MustNoError(err)
+	assert.Must(o.AuthRotation != nil && o.AuthRotation.SessionAuth == "******")
+	assert.Must(o.AuthRotation.Deadline == deadline)
+
+	t.auth.sessionAuth = ""
+	assert.Must(t.ResyncAuthRotation() != nil)
+}
+
+func TestUpdateQuotas(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p, c := openProxy()
+	defer c.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p.AdminAddr))
+
+	assert.Must(t.UpdateQuotas(&models.Quotas{
+		Users: map[string]*models.Quota{"alice": {QPS: -1}},
+	}) != nil)
+	assert.MustNoError(t.UpdateQuotas(&models.Quotas{
+		Users: map[string]*models.Quota{"alice": {QPS: 100, Connections: 10}},
+	}))
+
+	ctx, err := t.newContext()
+	assert.MustNoError(err)
+	assert.Must(!ctx.quotas.OutOfSync && ctx.quotas.Users["alice"].QPS == 100)
+
+	o, err := c.Overview()
+	assert.MustNoError(err)
+	assert.Must(o.Quotas != nil && o.Quotas.Users["alice"].Connections == 10)
+}
+
+func TestShareQPSLimit(x *testing.T) {
+	shares := splitQPSLimit(1000, map[string]int64{"a": 300, "b": 100, "c": 0})
+	assert.Must(shares["a"] == 167+375 && shares["b"] == 167+125 && shares["c"] == 167)
+	shares = splitQPSLimit(10, map[string]int64{"a": 0, "b": 0})
+	assert.Must(shares["a"] == 5 && shares["b"] == 5)
+
+	t := openTopom()
+	defer t.Close()
+
+	p, c := openProxy()
+	defer c.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p.AdminAddr))
+
+	ctx, err := t.newContext()
+	assert.MustNoError(err)
+	x1, err := c.StatsSimple()
+	assert.MustNoError(err)
+	stats := map[string]*ProxyStats{p.Token: {Stats: x1}}
+
+	assert.Must(t.SetProductQPSLimit(-1) != nil)
+	assert.MustNoError(t.SetProductQPSLimit(500))
+	t.shareQPSLimit(ctx.proxy, stats)
+	assert.Must(t.qpsLimitShares()[p.Token] == 500)
+	x2, err := c.StatsSimple()
+	assert.MustNoError(err)
+	assert.Must(x2.QPSLimit != nil && x2.QPSLimit.Limit == 500)
+
+	n, ok, err := t.store.LoadQPSLimit()
+	assert.MustNoError(err)
+	assert.Must(ok && n == 500)
+	t.qpslimit.limit.Set(0)
+	assert.MustNoError(t.loadQPSLimit())
+	assert.Must(t.GetProductQPSLimit() == 500)
+
+	// The share unchanged is pushed again once it's about to expire.
+	t.qpslimit.pushed[p.Token] = time.Now().Add(-qpsLimitRepushPeriod)
+	t.shareQPSLimit(ctx.proxy, stats)
+	assert.Must(time.Since(t.qpslimit.pushed[p.Token]) < qpsLimitRepushPeriod)
+
+	assert.MustNoError(t.SetProductQPSLimit(0))
+	t.shareQPSLimit(ctx.proxy, stats)
+	x3, err := c.StatsSimple()
+	assert.MustNoError(err)
+	assert.Must(x3.QPSLimit.Limit == 0)
+}
+
+func TestConfigHistory(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p, c := openProxy()
+	defer c.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p.AdminAddr))
+
+	collect := func() {
+		ctx, err := t.newContext()
+		assert.MustNoError(err)
+		x, err := c.StatsSimple()
+		assert.MustNoError(err)
+		t.collectConfigChanges(ctx.proxy, map[string]*ProxyStats{p.Token: {Stats: x}})
+	}
+	for _, v := range []string{"5s", "10s"} {
+		assert.MustNoError(c.SetConfig(&models.ConfigChange{Who: "alice", Key: "session_recv_timeout", New: v}))
+	}
+	collect()
+	collect()
+
+	h, err := t.ConfigHistory()
+	assert.MustNoError(err)
+	assert.Must(h.Version == 2 && len(h.Changes) == 2)
+	assert.Must(h.Changes[0].Proxy == p.Token && h.Changes[0].Who == "alice" && h.Changes[1].Old == "5s")
+	var original = h.Changes[0].Old
+
+	assert.Must(t.RollbackConfig(3, "bob") != nil)
+	assert.MustNoError(t.RollbackConfig(0, "bob"))
+	o, err := c.Overview()
+	assert.MustNoError(err)
+	assert.Must(o.Config.SessionRecvTimeout.Duration().String() == original)
+
+	collect()
+	h, err = t.ConfigHistory()
+	assert.MustNoError(err)
+	assert.Must(h.Version == 3 && h.Changes[2].Old == "10s" && h.Changes[2].New == original)
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+// qpsLimitRepushPeriod is the period the shares unchanged are pushed again,
+// so that proxies are able to expire their shares if the dashboard is gone.
+const qpsLimitRepushPeriod = time.Second * 10
+
+func (s *Topom) GetProductQPSLimit() int64 {
+	return s.qpslimit.limit.Int64()
+}
+
+// SetProductQPSLimit changes the QPS limit of the product, which is stored
+// to survive restarts, and applied to the proxies by the next refresh of
+// proxy stats.
+func (s *Topom) SetProductQPSLimit(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.newContext(); err != nil {
+		return err
+	}
+	if n < 0 {
+		return errors.Errorf("invalid product qps limit = %d", n)
+	}
+	if err := s.store.UpdateQPSLimit(n); err != nil {
+		log.ErrorErrorf(err, "store: update qps limit failed")
+		return errors.Errorf("store: update qps limit failed")
+	}
+	s.qpslimit.limit.Set(n)
+	log.Warnf("set product qps limit = %d", n)
+	return nil
+}
+
+// loadQPSLimit restores the QPS limit set at runtime, which overrides
+// product_qps_limit of the config.
+func (s *Topom) loadQPSLimit() error {
+	n, ok, err := s.store.LoadQPSLimit()
+	switch {
+	case err != nil:
+		log.ErrorErrorf(err, "store: load qps limit of %s failed", s.config.ProductName)
+		return errors.Errorf("store: load qps limit of %s failed", s.config.ProductName)
+	case ok:
+		s.qpslimit.limit.Set(n)
+		log.Warnf("load product qps limit = %d", n)
+	}
+	return nil
+}
+
+// splitQPSLimit splits the limit among the proxies, half evenly so that idle
+// proxies are able to take requests, and half by the QPS of each proxy.
+func splitQPSLimit(limit int64, qps map[string]int64) map[string]int64 {
+	var shares = make(map[string]int64, len(qps))
+	if len(qps) == 0 {
+		return shares
+	}
+	var total int64
+	for _, n := range qps {
+		total += n
+	}
+	var even = float64(limit) / float64(len(qps))
+	for token, n := range qps {
+		var share = even
+		if total > 0 {
+			share = even/2 + float64(limit)/2*float64(n)/float64(total)
+		}
+		shares[token] = int64(share + 0.5)
+		if shares[token] < 1 {
+			shares[token] = 1
+		}
+	}
+	return shares
+}
+
+// shareQPSLimit pushes the shares of the QPS limit to the proxies as of the
+// stats, proxies without stats keep their shares until they expire. A share
+// is pushed only if it differs from the last one by more than 5%, or it's not
+// pushed for qpsLimitRepushPeriod.
+func (s *Topom) shareQPSLimit(proxies map[string]*models.Proxy, stats map[string]*ProxyStats) {
+	var limit = s.qpslimit.limit.Int64()
+	var qps = make(map[string]int64)
+	for token, x := range stats {
+		if x.Stats != nil && x.Stats.Online && proxies[token] != nil {
+			qps[token] = x.Stats.Ops.QPS
+		}
+	}
+	var shares = make(map[string]int64)
+	if limit > 0 {
+		shares = splitQPSLimit(limit, qps)
+	} else {
+		for token := range qps {
+			shares[token] = 0
+		}
+	}
+
+	var pushes = make(map[string]int64)
+	s.qpslimit.mu.Lock()
+	for token := range s.qpslimit.shares {
+		if proxies[token] == nil {
+			delete(s.qpslimit.shares, token)
+			delete(s.qpslimit.pushed, token)
+		}
+	}
+	for token, share := range shares {
+		last, ok := s.qpslimit.shares[token]
+		if ok && (last == share || (last != 0 && share != 0 && abs64(share-last)*20 <= last)) {
+			if last == 0 || time.Since(s.qpslimit.pushed[token]) < qpsLimitRepushPeriod {
+				continue
+			}
+		}
+		pushes[token] = share
+	}
+	s.qpslimit.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for token, share := range pushes {
+		wg.Add(1)
+		go func(p *models.Proxy, share int64) {
+			defer wg.Done()
+			if err := s.newProxyClient(p).SetQPSLimit(share); err != nil {
+				log.WarnErrorf(err, "proxy-[%s] set qps limit failed", p.Token)
+				return
+			}
+			s.qpslimit.mu.Lock()
+			defer s.qpslimit.mu.Unlock()
+			if s.qpslimit.shares == nil {
+				s.qpslimit.shares = make(map[string]int64)
+				s.qpslimit.pushed = make(map[string]time.Time)
+			}
+			s.qpslimit.shares[p.Token] = share
+			s.qpslimit.pushed[p.Token] = time.Now()
+		}(proxies[token], share)
+	}
+	wg.Wait()
+}
+
+func (s *Topom) qpsLimitShares() map[string]int64 {
+	s.qpslimit.mu.Lock()
+	defer s.qpslimit.mu.Unlock()
+	var shares = make(map[string]int64, len(s.qpslimit.shares))
+	for token, share := range s.qpslimit.shares {
+		shares[token] = share
+	}
+	return shares
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2"
+)
+
+// UpdateQuotas replaces the quotas of the users on all proxies.
+func (s *Topom) UpdateQuotas(q *models.Quotas) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	defer s.dirtyQuotasCache()
+
+	q.OutOfSync = true
+	if err := s.storeUpdateQuotas(q); err != nil {
+		return err
+	}
+	ctx.quotas = q
+
+	if err := s.resyncQuotas(ctx); err != nil {
+		log.Warnf("resync quotas failed")
+		return err
+	}
+	q.OutOfSync = false
+	return s.storeUpdateQuotas(q)
+}
+
+func (s *Topom) ResyncQuotas() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+	defer s.dirtyQuotasCache()
+
+	if err := s.resyncQuotas(ctx); err != nil {
+		log.Warnf("resync quotas failed")
+		return err
+	}
+	q := ctx.quotas
+	q.OutOfSync = false
+	return s.storeUpdateQuotas(q)
+}
+
+func (s *Topom) resyncQuotas(ctx *context) error {
+	var fut sync2.Future
+	for _, p := range ctx.proxy {
+		fut.Add()
+		go func(p *models.Proxy) {
+			err := s.newProxyClient(p).SetQuotas(ctx.quotas)
+			if err != nil {
+				log.ErrorErrorf(err, "proxy-[%s] resync quotas failed", p.Token)
+			}
+			fut.Done(p.Token, err)
+		}(p)
+	}
+	for t, v := range fut.Wait() {
+		switch err := v.(type) {
+		case error:
+			if err != nil {
+				return errors.Errorf("proxy-[%s] resync quotas failed", t)
+			}
+		}
+	}
+	return nil
+}
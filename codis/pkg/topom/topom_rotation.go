@@ -0,0 +1,177 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"time"
+
+	"pika/codis/v2/pkg/models"
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2"
+)
+
+// UpdateAuthRotation starts the rotation of product_auth or session_auth on
+// all proxies, the old and the new passwords are both accepted until the
+// deadline. Passwords of servers should be changed before the deadline, and
+// configs of the dashboard and proxies updated before they're restarted.
+// The passwords are kept in memory and only their hashes are stored, so a
+// dashboard restarted during the rotation has to be given them again.
+func (s *Topom) UpdateAuthRotation(r *models.AuthRotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+	var now = time.Now().Unix()
+	switch {
+	case r.ProductAuth == "" && r.SessionAuth == "":
+		return errors.New("new product_auth or session_auth is required")
+	case r.Deadline <= now:
+		return errors.New("invalid deadline of auth rotation")
+	case ctx.rotation.Deadline > now:
+		return errors.Errorf("auth rotation is in progress until %s", time.Unix(ctx.rotation.Deadline, 0))
+	}
+	defer s.dirtyAuthRotationCache()
+
+	if r.ProductAuth == "" || r.SessionAuth == "" {
+		last, err := s.authRotation(ctx.rotation)
+		if err != nil {
+			return err
+		}
+		if r.ProductAuth == "" {
+			r.ProductAuth = last.ProductAuth
+		}
+		if r.SessionAuth == "" {
+			r.SessionAuth = last.SessionAuth
+		}
+	}
+	r.OutOfSync = true
+	if err := s.storeUpdateAuthRotation(r); err != nil {
+		return err
+	}
+	s.auth.productAuth, s.auth.sessionAuth = r.ProductAuth, r.SessionAuth
+	ctx.rotation = r.Hashed()
+
+	err = s.resyncAuthRotation(ctx)
+	s.applyAuthRotation(r)
+	if err != nil {
+		log.Warnf("resync auth rotation failed")
+		return err
+	}
+	ctx.rotation.OutOfSync = false
+	return s.storeUpdateAuthRotation(ctx.rotation)
+}
+
+func (s *Topom) ResyncAuthRotation() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+	defer s.dirtyAuthRotationCache()
+
+	if err := s.resyncAuthRotation(ctx); err != nil {
+		log.Warnf("resync auth rotation failed")
+		return err
+	}
+	r := ctx.rotation
+	r.OutOfSync = false
+	return s.storeUpdateAuthRotation(r)
+}
+
+// ClearAuthRotation forgets the rotation finished, once the dashboard and all
+// proxies are restarted with the new passwords.
+func (s *Topom) ClearAuthRotation() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+	if ctx.rotation.Deadline > time.Now().Unix() {
+		return errors.Errorf("auth rotation is in progress until %s", time.Unix(ctx.rotation.Deadline, 0))
+	}
+	defer s.dirtyAuthRotationCache()
+
+	r := &models.AuthRotation{OutOfSync: true}
+	if err := s.storeUpdateAuthRotation(r); err != nil {
+		return err
+	}
+	s.auth.productAuth, s.auth.sessionAuth = "", ""
+	ctx.rotation = r
+
+	if err := s.resyncAuthRotation(ctx); err != nil {
+		log.Warnf("resync auth rotation failed")
+		return err
+	}
+	r.OutOfSync = false
+	return s.storeUpdateAuthRotation(r)
+}
+
+// authRotation returns the rotation stored with the passwords of the hashes,
+// which are the ones in memory, or product_auth of the config if the dashboard
+// is restarted with the new one.
+func (s *Topom) authRotation(r *models.AuthRotation) (*models.AuthRotation, error) {
+	var x = &models.AuthRotation{Deadline: r.Deadline, OutOfSync: r.OutOfSync}
+	for _, a := range []struct {
+		name, hash string
+		auth       *string
+		candidates []string
+	}{
+		{"product_auth", r.ProductAuthHash, &x.ProductAuth, []string{s.auth.productAuth, s.config.ProductAuth}},
+		{"session_auth", r.SessionAuthHash, &x.SessionAuth, []string{s.auth.sessionAuth}},
+	} {
+		if a.hash == "" {
+			continue
+		}
+		for _, auth := range a.candidates {
+			if auth != "" && models.HashAuth(auth) == a.hash {
+				*a.auth = auth
+				break
+			}
+		}
+		if *a.auth == "" {
+			return nil, errors.Errorf("%s of auth rotation is unknown since restart, update the rotation again", a.name)
+		}
+	}
+	return x, nil
+}
+
+func (s *Topom) applyAuthRotation(r *models.AuthRotation) {
+	if r == nil || r.ProductAuth == "" {
+		return
+	}
+	var auth = s.auth.rotation.Current(s.config.ProductAuth)
+	s.auth.rotation.Set(auth, r.ProductAuth, time.Unix(r.Deadline, 0))
+}
+
+func (s *Topom) resyncAuthRotation(ctx *context) error {
+	r, err := s.authRotation(ctx.rotation)
+	if err != nil {
+		return err
+	}
+	var fut sync2.Future
+	for _, p := range ctx.proxy {
+		fut.Add()
+		go func(p *models.Proxy) {
+			err := s.newProxyClient(p).SetAuthRotation(r)
+			if err != nil {
+				log.ErrorErrorf(err, "proxy-[%s] resync auth rotation failed", p.Token)
+			}
+			fut.Done(p.Token, err)
+		}(p)
+	}
+	for t, v := range fut.Wait() {
+		switch err := v.(type) {
+		case error:
+			if err != nil {
+				return errors.Errorf("proxy-[%s] resync auth rotation failed", t)
+			}
+		}
+	}
+	return nil
+}
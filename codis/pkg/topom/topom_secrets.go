@@ -0,0 +1,57 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/rpc"
+	"pika/codis/v2/pkg/utils/secret"
+)
+
+// setupSecrets replaces the secret settings referring to Vault, files or
+// environment variables with the secrets, and refreshes them until closed.
+func (s *Topom) setupSecrets(config *Config) error {
+	var vault *secret.Vault
+	if config.VaultAddr != "" {
+		v, err := secret.NewVault(config.VaultAddr, config.VaultTokenFile, config.VaultNamespace, config.VaultCAFile)
+		if err != nil {
+			return err
+		}
+		vault = v
+	}
+	m := secret.NewManager(vault)
+
+	for _, x := range []struct {
+		name    string
+		setting *string
+		file    bool
+	}{
+		{"product_auth", &config.ProductAuth, false},
+		{"admin_token_secret", &config.AdminTokenSecret, false},
+		{"admin_tls_cert_file", &config.AdminTLSCertFile, true},
+		{"admin_tls_key_file", &config.AdminTLSKeyFile, true},
+		{"admin_tls_ca_file", &config.AdminTLSCAFile, true},
+	} {
+		if err := m.Bind(x.name, x.setting, x.file); err != nil {
+			m.Close()
+			return err
+		}
+	}
+	s.secrets = m
+
+	m.Start(config.SecretRefreshPeriod.Duration(), func(name, value string) {
+		switch name {
+		case "admin_token_secret":
+			if err := rpc.SetupToken(value, "codis-dashboard"); err != nil {
+				log.WarnErrorf(err, "apply %s failed", name)
+				return
+			}
+		default:
+			log.Warnf("%s is changed, restart codis-dashboard to apply", name)
+			return
+		}
+		log.Warnf("%s is changed and applied", name)
+	})
+	return nil
+}
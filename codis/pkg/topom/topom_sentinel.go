@@ -21,7 +21,7 @@ func (s *Topom) CheckStateAndSwitchSlavesAndMasters(filter func(index int, g *mo
 		return nil
 	}
 
-	states := checkGroupServersReplicationState(s.Config(), groupServers)
+	states := s.checkGroupServersReplicationState(groupServers)
 	var slaveOfflineGroups []*models.Group
 	var masterOfflineGroups []*models.Group
 	var recoveredGroupServersState []*redis.ReplicationState
@@ -98,7 +98,8 @@ func (s *Topom) checkAndUpdateGroupServerState(conf *Config, group *models.Group
 	}
 }
 
-func checkGroupServersReplicationState(conf *Config, gs map[int][]*models.GroupServer) []*redis.ReplicationState {
+func (s *Topom) checkGroupServersReplicationState(gs map[int][]*models.GroupServer) []*redis.ReplicationState {
+	conf := s.Config()
 	config := &redis.MonitorConfig{
 		Quorum:               conf.SentinelQuorum,
 		ParallelSyncs:        conf.SentinelParallelSyncs,
@@ -109,6 +110,7 @@ func checkGroupServersReplicationState(conf *Config, gs map[int][]*models.GroupS
 	}
 
 	sentinel := redis.NewCodisSentinel(conf.ProductName, conf.ProductAuth)
+	sentinel.Rotation = &s.auth.rotation
 	return sentinel.RefreshMastersAndSlavesClient(config.ParallelSyncs, gs)
 }
 
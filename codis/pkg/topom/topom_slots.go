@@ -42,6 +42,9 @@ func (s *Topom) SlotCreateAction(sid int, gid int) error {
 	if m.GroupId == gid {
 		return errors.Errorf("slot-[%d] already in group-[%d]", sid, gid)
 	}
+	if err := ctx.checkSlotsMigration(); err != nil {
+		return err
+	}
 	defer s.dirtySlotsCache(m.Id)
 
 	m.Action.State = models.ActionPending
@@ -65,6 +68,9 @@ func (s *Topom) SlotCreateActionSome(groupFrom, groupTo int, numSlots int) error
 	if len(g.Servers) == 0 {
 		return errors.Errorf("group-[%d] is empty", g.Id)
 	}
+	if err := ctx.checkSlotsMigration(); err != nil {
+		return err
+	}
 
 	var pending []int
 	for _, m := range ctx.slots {
@@ -119,6 +125,9 @@ func (s *Topom) SlotCreateActionRange(beg, end int, gid int, must bool) error {
 	if len(g.Servers) == 0 {
 		return errors.Errorf("group-[%d] is empty", g.Id)
 	}
+	if err := ctx.checkSlotsMigration(); err != nil {
+		return err
+	}
 
 	var pending []int
 	for sid := beg; sid <= end; sid++ {
@@ -690,6 +699,9 @@ func (s *Topom) SlotsRebalance(confirm bool) (map[int]int, error) {
 	if !confirm {
 		return plans, nil
 	}
+	if err := ctx.checkSlotsMigration(); err != nil {
+		return nil, err
+	}
 
 	var slotIds []int
 	for sid, _ := range plans {
@@ -72,6 +72,37 @@ func TestSlotCreateAction(x *testing.T) {
 	assert.Must(t.SlotCreateAction(sid, gid) != nil)
 }
 
+func TestSlotCreateActionHashTag(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	const sid = 100
+	const gid = 200
+
+	g := &models.Group{Id: gid, Servers: []*models.GroupServer{
+		&models.GroupServer{Addr: "server"},
+	}}
+	contextCreateGroup(t, g)
+	contextCreateProxy(t, &models.Proxy{Token: "proxy", HashTag: "[]"})
+	assert.Must(t.SlotCreateAction(sid, gid) != nil)
+	assert.Must(t.SlotCreateActionRange(sid, sid, gid, true) != nil)
+
+	ctx, err := t.newContext()
+	assert.MustNoError(err)
+	assert.Must(ctx.checkProxyHashing(&models.Proxy{Token: "other"}) != nil)
+	assert.MustNoError(ctx.checkProxyHashing(&models.Proxy{Token: "other", HashTag: "[]"}))
+	assert.Must(ctx.checkProxyHashing(&models.Proxy{Token: "other", HashTag: "[]", HashMode: "crc16"}) != nil)
+
+	contextCreateProxy(t, &models.Proxy{Token: "proxy", HashMode: "crc16"})
+	assert.Must(t.SlotCreateAction(sid, gid) != nil)
+
+	contextCreateProxy(t, &models.Proxy{Token: "proxy", HashMode: "siphash", HashKeySum: "sum1"})
+	ctx, err = t.newContext()
+	assert.MustNoError(err)
+	assert.Must(ctx.checkProxyHashing(&models.Proxy{Token: "other", HashMode: "siphash", HashKeySum: "sum2"}) != nil)
+	assert.MustNoError(ctx.checkProxyHashing(&models.Proxy{Token: "other", HashMode: "siphash", HashKeySum: "sum1"}))
+}
+
 func TestSlotRemoveAction(x *testing.T) {
 	t := openTopom()
 	defer t.Close()
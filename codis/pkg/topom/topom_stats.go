@@ -147,8 +147,11 @@ func (s *Topom) RefreshProxyStats(timeout time.Duration) (*sync2.Future, error)
 			stats[k] = v.(*ProxyStats)
 		}
 		s.mu.Lock()
-		defer s.mu.Unlock()
 		s.stats.proxies = stats
+		s.mu.Unlock()
+
+		s.shareQPSLimit(ctx.proxy, stats)
+		s.collectConfigChanges(ctx.proxy, stats)
 	}()
 	return &fut, nil
 }
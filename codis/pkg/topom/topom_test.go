@@ -21,10 +21,13 @@ func init() {
 	log.SetLevel(log.LevelError)
 }
 
+var MaxSlotNum = config.MaxSlotNum
+
 func init() {
 	config.AdminAddr = "0.0.0.0:0"
 	config.ProductName = "topom_test"
 	config.ProductAuth = "topom_auth"
+	models.SetMaxSlotNum(MaxSlotNum)
 }
 
 func newDiskClient() *fsclient.Client {
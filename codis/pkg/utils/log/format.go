@@ -0,0 +1,216 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"pika/codis/v2/pkg/utils/trace"
+)
+
+type LogFormat int64
+
+const (
+	FormatText = LogFormat(iota)
+	FormatJSON
+)
+
+func (f LogFormat) String() string {
+	switch f {
+	default:
+		return "UNKNOWN"
+	case FormatText:
+		return "TEXT"
+	case FormatJSON:
+		return "JSON"
+	}
+}
+
+func (f *LogFormat) ParseFromString(s string) bool {
+	switch strings.ToUpper(s) {
+	case "TEXT":
+		*f = FormatText
+	case "JSON":
+		*f = FormatJSON
+	default:
+		return false
+	}
+	return true
+}
+
+func (f *LogFormat) Set(v LogFormat) {
+	atomic.StoreInt64((*int64)(f), int64(v))
+}
+
+func (f *LogFormat) Get() LogFormat {
+	return LogFormat(atomic.LoadInt64((*int64)(f)))
+}
+
+// Fields are the context of a line, e.g. session, cmd and slot, which are
+// encoded as keys of the JSON object, or appended as key=value in text.
+type Fields map[string]interface{}
+
+func (f Fields) sortedKeys() []string {
+	var keys = make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendFields(b *bytes.Buffer, fields Fields) {
+	for _, k := range fields.sortedKeys() {
+		var s = fmt.Sprint(fields[k])
+		if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+			s = strconv.Quote(s)
+		}
+		fmt.Fprint(b, " ", k, "=", s)
+	}
+}
+
+func (t LogType) level() string {
+	return strings.ToLower(strings.Trim(t.String(), "[]"))
+}
+
+// encodeJSON encodes a line as a JSON object with ts, level, caller and msg,
+// followed by the fields of the logger and of the line, then error and stack.
+func (l *Logger) encodeJSON(traceskip int, fields Fields, err error, t LogType, s string, stack trace.Stack) []byte {
+	var b bytes.Buffer
+	var sep = byte('{')
+	add := func(key string, value interface{}) {
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		k, _ := json.Marshal(key)
+		b.WriteByte(sep)
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+		sep = ','
+	}
+	add("ts", time.Now().Format("2006-01-02T15:04:05.000000Z07:00"))
+	add("level", t.level())
+
+	if flags := l.log.Flags(); flags&(Lshortfile|Llongfile) != 0 {
+		if _, file, line, ok := runtime.Caller(traceskip + 1); ok {
+			if flags&Lshortfile != 0 {
+				file = filepath.Base(file)
+			}
+			add("caller", fmt.Sprintf("%s:%d", file, line))
+		}
+	}
+	if prefix := l.log.Prefix(); prefix != "" {
+		add("prefix", strings.TrimSpace(prefix))
+	}
+	add("msg", strings.TrimSuffix(s, "\n"))
+
+	for _, f := range []Fields{l.staticFields(), fields} {
+		for _, k := range f.sortedKeys() {
+			add(k, f[k])
+		}
+	}
+	if err != nil {
+		add("error", err.Error())
+	}
+	if len(stack) != 0 {
+		add("stack", stack.StringWithIndent(0))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// Entry is a logger with the fields of a context, e.g. of a session.
+type Entry struct {
+	l      *Logger
+	fields Fields
+}
+
+func (l *Logger) With(fields Fields) *Entry {
+	return &Entry{l: l, fields: fields}
+}
+
+func (e *Entry) With(fields Fields) *Entry {
+	var merged = make(Fields, len(e.fields)+len(fields))
+	for k, v := range e.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Entry{l: e.l, fields: merged}
+}
+
+func (e *Entry) Errorf(format string, v ...interface{}) {
+	t := TYPE_ERROR
+	if e.l.isDisabled(t) {
+		return
+	}
+	s := fmt.Sprintf(format, v...)
+	e.l.outputFields(1, e.fields, nil, t, s)
+}
+
+func (e *Entry) ErrorErrorf(err error, format string, v ...interface{}) {
+	t := TYPE_ERROR
+	if e.l.isDisabled(t) {
+		return
+	}
+	s := fmt.Sprintf(format, v...)
+	e.l.outputFields(1, e.fields, err, t, s)
+}
+
+func (e *Entry) Warnf(format string, v ...interface{}) {
+	t := TYPE_WARN
+	if e.l.isDisabled(t) {
+		return
+	}
+	s := fmt.Sprintf(format, v...)
+	e.l.outputFields(1, e.fields, nil, t, s)
+}
+
+func (e *Entry) WarnErrorf(err error, format string, v ...interface{}) {
+	t := TYPE_WARN
+	if e.l.isDisabled(t) {
+		return
+	}
+	s := fmt.Sprintf(format, v...)
+	e.l.outputFields(1, e.fields, err, t, s)
+}
+
+func (e *Entry) Infof(format string, v ...interface{}) {
+	t := TYPE_INFO
+	if e.l.isDisabled(t) {
+		return
+	}
+	s := fmt.Sprintf(format, v...)
+	e.l.outputFields(1, e.fields, nil, t, s)
+}
+
+func (e *Entry) InfoErrorf(err error, format string, v ...interface{}) {
+	t := TYPE_INFO
+	if e.l.isDisabled(t) {
+		return
+	}
+	s := fmt.Sprintf(format, v...)
+	e.l.outputFields(1, e.fields, err, t, s)
+}
+
+func (e *Entry) Debugf(format string, v ...interface{}) {
+	t := TYPE_DEBUG
+	if e.l.isDisabled(t) {
+		return
+	}
+	s := fmt.Sprintf(format, v...)
+	e.l.outputFields(1, e.fields, nil, t, s)
+}
@@ -127,6 +127,9 @@ type Logger struct {
 	log   *log.Logger
 	level LogLevel
 	trace LogLevel
+
+	format LogFormat
+	fields atomic.Value
 }
 
 var StdLog = New(NopCloser(os.Stderr), "")
@@ -178,6 +181,55 @@ func (l *Logger) SetTraceLevel(v LogLevel) {
 	l.trace.Set(v)
 }
 
+func (l *Logger) SetFormat(v LogFormat) {
+	l.format.Set(v)
+}
+
+func (l *Logger) SetFormatString(s string) bool {
+	var v LogFormat
+	if !v.ParseFromString(s) {
+		return false
+	} else {
+		l.SetFormat(v)
+		return true
+	}
+}
+
+// SetField sets a field attached to every line of the logger, e.g. the
+// proxy-id, or removes it if value is nil.
+func (l *Logger) SetField(key string, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var fields = make(Fields)
+	for k, v := range l.staticFields() {
+		fields[k] = v
+	}
+	if value != nil {
+		fields[key] = value
+	} else {
+		delete(fields, key)
+	}
+	l.fields.Store(fields)
+}
+
+func (l *Logger) staticFields() Fields {
+	fields, _ := l.fields.Load().(Fields)
+	return fields
+}
+
+// SetOutput replaces the writer of the logger, the previous one is closed.
+func (l *Logger) SetOutput(writer io.Writer) {
+	out, ok := writer.(io.WriteCloser)
+	if !ok {
+		out = NopCloser(writer)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Close()
+	l.out = out
+	l.log.SetOutput(out)
+}
+
 func (l *Logger) Close() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -380,18 +432,29 @@ func (l *Logger) Println(v ...interface{}) {
 }
 
 func (l *Logger) output(traceskip int, err error, t LogType, s string) error {
+	return l.outputFields(traceskip+1, nil, err, t, s)
+}
+
+func (l *Logger) outputFields(traceskip int, fields Fields, err error, t LogType, s string) error {
 	var stack trace.Stack
 	if l.isTraceEnabled(t) {
 		stack = trace.TraceN(traceskip+1, 32)
 	}
 
-	var b bytes.Buffer
-	fmt.Fprint(&b, t, " ", s)
-
-	if len(s) == 0 || s[len(s)-1] != '\n' {
-		fmt.Fprint(&b, "\n")
+	if l.format.Get() == FormatJSON {
+		b := l.encodeJSON(traceskip+1, fields, err, t, s, stack)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		_, err := l.out.Write(b)
+		return err
 	}
 
+	var b bytes.Buffer
+	fmt.Fprint(&b, t, " ", strings.TrimSuffix(s, "\n"))
+	appendFields(&b, l.staticFields())
+	appendFields(&b, fields)
+	fmt.Fprint(&b, "\n")
+
 	if err != nil {
 		fmt.Fprint(&b, "[error]: ", err.Error(), "\n")
 		if stack := errors.Stack(err); stack != nil {
@@ -436,6 +499,26 @@ func SetTrace(v LogLevel) {
 	StdLog.SetTraceLevel(v)
 }
 
+func SetFormat(v LogFormat) {
+	StdLog.SetFormat(v)
+}
+
+func SetFormatString(s string) bool {
+	return StdLog.SetFormatString(s)
+}
+
+func SetField(key string, value interface{}) {
+	StdLog.SetField(key, value)
+}
+
+func SetOutput(writer io.Writer) {
+	StdLog.SetOutput(writer)
+}
+
+func With(fields Fields) *Entry {
+	return StdLog.With(fields)
+}
+
 func Panic(v ...interface{}) {
 	t := TYPE_PANIC
 	s := fmt.Sprint(v...)
@@ -0,0 +1,108 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+func TestJSONFormat(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, "")
+	l.SetField("proxy-id", "abc")
+
+	l.With(Fields{"session": 1}).Infof("text %d", 1)
+	must(t, strings.HasSuffix(b.String(), "[INFO] text 1 proxy-id=abc session=1\n"))
+
+	b.Reset()
+	l.SetFormat(FormatJSON)
+	l.With(Fields{"session": 2, "cmd": "GET"}).With(Fields{"slot": 10}).WarnErrorf(errors.New("oops"), "json %d", 2)
+
+	var m map[string]interface{}
+	mustNoError(t, json.Unmarshal(b.Bytes(), &m))
+	must(t, m["level"] == "warn" && m["msg"] == "json 2" && m["error"] == "oops")
+	must(t, m["proxy-id"] == "abc" && m["session"] == 2.0 && m["cmd"] == "GET" && m["slot"] == 10.0)
+	must(t, strings.HasPrefix(m["caller"].(string), "log_test.go:"))
+	_, err := time.Parse(time.RFC3339Nano, m["ts"].(string))
+	mustNoError(t, err)
+
+	var format LogFormat
+	must(t, format.ParseFromString("json") && format == FormatJSON)
+	must(t, !format.ParseFromString("xml"))
+}
+
+func TestSetOutput(t *testing.T) {
+	var b1, b2 bytes.Buffer
+	l := New(&b1, "")
+	l.Info("first")
+	l.SetOutput(&b2)
+	l.Info("second")
+	must(t, strings.Contains(b1.String(), "first") && !strings.Contains(b1.String(), "second"))
+	must(t, strings.Contains(b2.String(), "second"))
+}
+
+func TestRollingFileSize(t *testing.T) {
+	var dir = t.TempDir()
+	var base = filepath.Join(dir, "proxy.log")
+	w, err := NewRollingFileOptions(base, RollingOptions{MaxSize: 100, MaxBackups: 2, Compress: true})
+	mustNoError(t, err)
+
+	var line = []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 8; i++ {
+		_, err := w.Write(line)
+		mustNoError(t, err)
+		time.Sleep(time.Millisecond * 20)
+	}
+	mustNoError(t, w.Close())
+
+	info, err := os.Stat(base)
+	mustNoError(t, err)
+	must(t, info.Size() == int64(len(line)))
+
+	var backups []string
+	for i := 0; i < 100; i++ {
+		backups, _ = filepath.Glob(base + ".*.gz")
+		if all, _ := filepath.Glob(base + ".*"); len(backups) == 2 && len(all) == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	must(t, len(backups) == 2)
+
+	f, err := os.Open(backups[0])
+	mustNoError(t, err)
+	defer f.Close()
+	z, err := gzip.NewReader(f)
+	mustNoError(t, err)
+	b, err := ioutil.ReadAll(z)
+	mustNoError(t, err)
+	must(t, bytes.Equal(b, line))
+
+	_, err = NewRollingFileOptions(base, RollingOptions{MaxSize: -1})
+	must(t, err != nil)
+}
+
+func must(t *testing.T, b bool) {
+	t.Helper()
+	if !b {
+		t.Fatal("assertion failed")
+	}
+}
+
+func mustNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,10 +4,13 @@
 package log
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,8 +26,19 @@ type rollingFile struct {
 	basePath string
 	filePath string
 	fileFrag string
+	fileSize int64
 
 	rolling RollingFormat
+	options RollingOptions
+}
+
+// RollingOptions are of a rolling file that also rotates by size, the rotated
+// files are compressed by gzip, and only the latest MaxBackups are kept.
+type RollingOptions struct {
+	Rolling    RollingFormat
+	MaxSize    int64
+	MaxBackups int
+	Compress   bool
 }
 
 var ErrClosedRollingFile = errors.New("rolling file is closed")
@@ -47,9 +61,14 @@ func (r *rollingFile) roll() error {
 		}
 		r.file.Close()
 		r.file = nil
+		r.rotated(r.filePath)
 	}
 	r.fileFrag = suffix
-	r.filePath = fmt.Sprintf("%s.%s", r.basePath, r.fileFrag)
+	if r.fileFrag != "" {
+		r.filePath = fmt.Sprintf("%s.%s", r.basePath, r.fileFrag)
+	} else {
+		r.filePath = r.basePath
+	}
 
 	if dir, _ := filepath.Split(r.basePath); dir != "" && dir != "." {
 		if err := os.MkdirAll(dir, 0777); err != nil {
@@ -60,10 +79,111 @@ func (r *rollingFile) roll() error {
 	f, err := os.OpenFile(r.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		return errors.Trace(err)
-	} else {
-		r.file = f
+	}
+	r.file, r.fileSize = f, 0
+	if info, err := f.Stat(); err == nil {
+		r.fileSize = info.Size()
+	}
+	return nil
+}
+
+// rotate renames the current file once it exceeds MaxSize, it's reopened by
+// the next roll.
+func (r *rollingFile) rotate() error {
+	if r.file == nil {
 		return nil
 	}
+	r.file.Close()
+	r.file = nil
+	var path = fmt.Sprintf("%s.%s", r.filePath, time.Now().Format("20060102-150405.000000"))
+	if err := os.Rename(r.filePath, path); err != nil {
+		return errors.Trace(err)
+	}
+	r.rotated(path)
+	return nil
+}
+
+// rotated compresses the rotated file and removes the stale backups in the
+// background, so that writes are never blocked by them.
+func (r *rollingFile) rotated(path string) {
+	if !r.options.Compress && r.options.MaxBackups <= 0 {
+		return
+	}
+	var active = r.filePath
+	go func() {
+		if r.options.Compress {
+			if err := compressFile(path); err != nil {
+				fmt.Fprintf(os.Stderr, "compress log file %s failed: %s\n", path, err)
+			}
+		}
+		if r.options.MaxBackups > 0 {
+			removeBackups(r.basePath, active, r.options.MaxBackups)
+		}
+	}()
+}
+
+func compressFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	var tmp = path + ".gz.tmp"
+	w, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	z := gzip.NewWriter(w)
+	if _, err := io.Copy(z, f); err != nil {
+		w.Close()
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+	if err := z.Close(); err != nil {
+		w.Close()
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Remove(path))
+}
+
+// removeBackups keeps the latest n of the files named as basePath.*, except
+// the active one and the ones being compressed.
+func removeBackups(basePath, active string, n int) {
+	matches, err := filepath.Glob(basePath + ".*")
+	if err != nil {
+		return
+	}
+	type backup struct {
+		path  string
+		mtime time.Time
+	}
+	var backups []backup
+	for _, path := range matches {
+		if path == active || strings.HasSuffix(path, ".tmp") {
+			continue
+		}
+		if _, err := os.Stat(path + ".gz.tmp"); err == nil {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			backups = append(backups, backup{path, info.ModTime()})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].mtime.After(backups[j].mtime)
+	})
+	for i := n; i < len(backups); i++ {
+		os.Remove(backups[i].path)
+	}
 }
 
 func (r *rollingFile) Close() error {
@@ -94,7 +214,17 @@ func (r *rollingFile) Write(b []byte) (int, error) {
 		return 0, err
 	}
 
+	if max := r.options.MaxSize; max > 0 && r.fileSize > 0 && r.fileSize+int64(len(b)) > max {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+		if err := r.roll(); err != nil {
+			return 0, err
+		}
+	}
+
 	n, err := r.file.Write(b)
+	r.fileSize += int64(n)
 	if err != nil {
 		return n, errors.Trace(err)
 	} else {
@@ -108,3 +238,15 @@ func NewRollingFile(basePath string, rolling RollingFormat) (io.WriteCloser, err
 	}
 	return &rollingFile{basePath: basePath, rolling: rolling}, nil
 }
+
+// NewRollingFileOptions opens a file rolled by time if options.Rolling isn't
+// empty, and rotated by size if options.MaxSize is positive.
+func NewRollingFileOptions(basePath string, options RollingOptions) (io.WriteCloser, error) {
+	if _, file := filepath.Split(basePath); file == "" {
+		return nil, errors.Errorf("invalid base-path = %s, file name is required", basePath)
+	}
+	if options.MaxSize < 0 || options.MaxBackups < 0 {
+		return nil, errors.Errorf("invalid max-size = %d or max-backups = %d", options.MaxSize, options.MaxBackups)
+	}
+	return &rollingFile{basePath: basePath, rolling: options.Rolling, options: options}, nil
+}
@@ -444,6 +444,8 @@ type Pool struct {
 	auth string
 	pool map[string]*list.List
 
+	rotation *AuthRotation
+
 	timeout time.Duration
 
 	exit struct {
@@ -520,12 +522,19 @@ func (p *Pool) Cleanup() error {
 	return nil
 }
 
+// SetAuthRotation makes the clients created authenticate with the passwords
+// of the rotation of the auth of the pool in turn. It must be called before
+// the pool is used.
+func (p *Pool) SetAuthRotation(r *AuthRotation) {
+	p.rotation = r
+}
+
 func (p *Pool) GetClient(addr string) (*Client, error) {
 	c, err := p.getClientFromCache(addr)
 	if err != nil || c != nil {
 		return c, err
 	}
-	return NewClient(addr, p.auth, p.timeout)
+	return p.rotation.NewClient(addr, p.auth, p.timeout)
 }
 
 func (p *Pool) getClientFromCache(addr string) (*Client, error) {
@@ -595,6 +604,8 @@ type InfoCache struct {
 	Auth string
 	data map[string]map[string]string
 
+	Rotation *AuthRotation
+
 	Timeout time.Duration
 }
 
@@ -635,7 +646,7 @@ func (s *InfoCache) GetRunId(addr string) string {
 }
 
 func (s *InfoCache) getSlow(addr string) (map[string]string, error) {
-	c, err := NewClient(addr, s.Auth, s.Timeout)
+	c, err := s.Rotation.NewClient(addr, s.Auth, s.Timeout)
 	if err != nil {
 		return nil, err
 	}
@@ -18,6 +18,9 @@ type CodisSentinel struct {
 
 	Product, Auth string
 
+	// Rotation is the rotation of Auth, if any.
+	Rotation *AuthRotation
+
 	LogFunc func(format string, args ...interface{})
 	ErrFunc func(err error, format string, args ...interface{})
 }
@@ -136,7 +139,7 @@ func (s *CodisSentinel) infoReplicationDispatch(addr string) (*InfoReplication,
 		client *Client
 		err    error
 	)
-	if client, err = NewClient(addr, s.Auth, time.Second); err != nil {
+	if client, err = s.Rotation.NewClient(addr, s.Auth, time.Second); err != nil {
 		log.WarnErrorf(err, "create redis client to %s failed", addr)
 		return nil, err
 	}
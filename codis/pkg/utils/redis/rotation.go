@@ -0,0 +1,128 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package redis
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthRotation replaces a password with a new one, both of which are accepted
+// until the deadline, so peers can switch to the new one without failures.
+// Passwords replaced by former rotations are still known, and replaced by
+// the latest one. A nil rotation doesn't replace any password.
+type AuthRotation struct {
+	mu       sync.RWMutex
+	from, to string
+	deadline time.Time
+	known    map[string]bool
+}
+
+// Set starts the rotation of the password from to the password to, an empty
+// to stops the rotation. Setting the same to again only moves the deadline.
+func (r *AuthRotation) Set(from, to string, deadline time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if to == "" {
+		r.from, r.to, r.deadline, r.known = "", "", time.Time{}, nil
+		return
+	}
+	if to == r.to {
+		from = r.from
+	}
+	if r.known == nil {
+		r.known = make(map[string]bool)
+	}
+	r.known[from], r.known[to] = true, true
+	r.from, r.to, r.deadline = from, to, deadline
+}
+
+func (r *AuthRotation) rotating(auth string) (rotated, window bool) {
+	if r.to == "" || !r.known[auth] {
+		return false, false
+	}
+	return true, time.Now().Before(r.deadline)
+}
+
+// Candidates returns the passwords to try in order instead of auth, the new
+// one and then the old one during the rotation, or only the new one after.
+func (r *AuthRotation) Candidates(auth string) []string {
+	if r == nil {
+		return []string{auth}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	switch rotated, window := r.rotating(auth); {
+	case !rotated:
+		return []string{auth}
+	case window && r.from != r.to:
+		return []string{r.to, r.from}
+	default:
+		return []string{r.to}
+	}
+}
+
+// Current returns the latest password replacing auth, which is the new one
+// of the rotation since it starts.
+func (r *AuthRotation) Current(auth string) string {
+	if r == nil {
+		return auth
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if rotated, _ := r.rotating(auth); rotated {
+		return r.to
+	}
+	return auth
+}
+
+// Known returns the passwords replaced by the rotations and the new one.
+func (r *AuthRotation) Known() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list []string
+	for auth := range r.known {
+		list = append(list, auth)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Deadline returns the deadline of the rotation, or zero if not rotating.
+func (r *AuthRotation) Deadline() time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.deadline
+}
+
+// NewClient returns a client of the server authenticated with the passwords
+// to try instead of auth in turn.
+func (r *AuthRotation) NewClient(addr string, auth string, timeout time.Duration) (*Client, error) {
+	var err error
+	for _, auth := range r.Candidates(auth) {
+		var c *Client
+		if c, err = NewClient(addr, auth, timeout); err == nil || !isAuthError(err) {
+			return c, err
+		}
+	}
+	return nil, err
+}
+
+func isAuthError(err error) bool {
+	var s = err.Error()
+	for _, msg := range []string{"WRONGPASS", "invalid password", "invalid username-password"} {
+		if strings.Contains(s, msg) {
+			return true
+		}
+	}
+	return false
+}
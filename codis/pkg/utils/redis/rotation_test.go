@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthRotation(t *testing.T) {
+	r := &AuthRotation{}
+	assert.Equal(t, []string{"a"}, r.Candidates("a"))
+	assert.Equal(t, "a", r.Current("a"))
+
+	r.Set("a", "b", time.Now().Add(time.Hour))
+	assert.Equal(t, []string{"b", "a"}, r.Candidates("a"))
+	assert.Equal(t, []string{"b", "a"}, r.Candidates("b"))
+	assert.Equal(t, []string{"x"}, r.Candidates("x"))
+	assert.Equal(t, "b", r.Current("a"))
+
+	r.Set(r.Current("a"), "b", time.Now().Add(-time.Second))
+	assert.Equal(t, []string{"b"}, r.Candidates("a"))
+
+	r.Set(r.Current("a"), "c", time.Now().Add(time.Hour))
+	assert.Equal(t, []string{"c", "b"}, r.Candidates("a"))
+	assert.Equal(t, []string{"a", "b", "c"}, r.Known())
+
+	r.Set("", "", time.Time{})
+	assert.Equal(t, []string{"a"}, r.Candidates("a"))
+	assert.Empty(t, r.Known())
+}
+
+func TestIsAuthError(t *testing.T) {
+	assert.True(t, isAuthError(errors.New("WRONGPASS invalid username-password pair")))
+	assert.True(t, isAuthError(errors.New("ERR invalid password")))
+	assert.False(t, isAuthError(errors.New("ERR connection refused")))
+}
@@ -29,6 +29,8 @@ const (
 
 var client *http.Client
 
+var transport *http.Transport
+
 func init() {
 	var dials atomic2.Int64
 	tr := &http.Transport{}
@@ -40,6 +42,7 @@ func init() {
 		}
 		return c, err
 	}
+	transport = tr
 	client = &http.Client{
 		Transport: tr,
 		Timeout:   time.Minute,
@@ -126,6 +129,9 @@ func apiRequestJson(method string, url string, args, reply interface{}) error {
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
 	}
+	if err := SetAuthorization(req); err != nil {
+		return err
+	}
 
 	var start = time.Now()
 
@@ -153,7 +159,7 @@ func apiRequestJson(method string, url string, args, reply interface{}) error {
 		} else {
 			return nil
 		}
-	case 800, 1500:
+	case 401, 403, 800, 1500:
 		e, err := responseBodyAsError(rsp)
 		if err != nil {
 			return err
@@ -200,7 +206,7 @@ func ApiResponseJson(v interface{}) (int, string) {
 
 func EncodeURL(host string, format string, args ...interface{}) string {
 	var u url.URL
-	u.Scheme = "http"
+	u.Scheme = Scheme()
 	u.Host = host
 	u.Path = fmt.Sprintf(format, args...)
 	return u.String()
@@ -0,0 +1,143 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package rpc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+	"pika/codis/v2/pkg/utils/sync2/atomic2"
+)
+
+const (
+	DefaultProfileSeconds = 30
+	MaxProfileSeconds     = 300
+
+	// MaxProfiles is the number of profiles taken at the same time, so that
+	// profiling doesn't slow down the process too much.
+	MaxProfiles = 1
+)
+
+var profiling atomic2.Int64
+
+var ErrTooManyProfiles = errors.New("too many profiles in progress")
+
+// ParseProfileSeconds returns the seconds of the profile, which is the
+// default if empty.
+func ParseProfileSeconds(text string) (int, error) {
+	if text == "" {
+		return DefaultProfileSeconds, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n <= 0 || n > MaxProfileSeconds {
+		return 0, errors.Errorf("invalid profile seconds, should be in [1,%d]", MaxProfileSeconds)
+	}
+	return n, nil
+}
+
+// WriteProfile writes the profile in the format of pprof. The profiles of cpu,
+// block and mutex are sampled for the seconds, the others are taken at once.
+func WriteProfile(w io.Writer, kind string, seconds int) error {
+	if profiling.Incr() > MaxProfiles {
+		profiling.Decr()
+		return errors.Trace(ErrTooManyProfiles)
+	}
+	defer profiling.Decr()
+
+	var d = time.Duration(seconds) * time.Second
+	switch kind {
+	case "cpu":
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return errors.Trace(err)
+		}
+		time.Sleep(d)
+		pprof.StopCPUProfile()
+		return nil
+	case "block":
+		runtime.SetBlockProfileRate(1)
+		time.Sleep(d)
+		runtime.SetBlockProfileRate(0)
+	case "mutex":
+		var fraction = runtime.SetMutexProfileFraction(1)
+		time.Sleep(d)
+		runtime.SetMutexProfileFraction(fraction)
+	case "heap", "allocs", "goroutine", "threadcreate":
+	default:
+		return errors.Errorf("invalid profile kind '%s'", kind)
+	}
+	return errors.Trace(pprof.Lookup(kind).WriteTo(w, 0))
+}
+
+// ApiResponseProfile replies the profile as a download named after the
+// process, or the error as ApiResponseError.
+func ApiResponseProfile(w http.ResponseWriter, name, kind, seconds string) {
+	n, err := ParseProfileSeconds(seconds)
+	if err == nil {
+		log.Warnf("profile %s of %s for %ds", kind, name, n)
+		var b bytes.Buffer
+		if err = WriteProfile(&b, kind, n); err == nil {
+			var file = fmt.Sprintf("%s-%s-%s.pprof", name, kind, time.Now().Format("20060102150405"))
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file))
+			w.WriteHeader(http.StatusOK)
+			w.Write(b.Bytes())
+			return
+		}
+	}
+	ApiWriteError(w, err)
+}
+
+// ApiWriteError writes the error as ApiResponseError, for handlers writing
+// the response by themselves.
+func ApiWriteError(w http.ResponseWriter, err error) {
+	code, body := ApiResponseError(err)
+	w.WriteHeader(code)
+	io.WriteString(w, body)
+}
+
+// ApiPutProfile triggers the profile and downloads it, waiting for it to be
+// sampled. It's PUT so that tokens of role read aren't allowed.
+func ApiPutProfile(url string, seconds int) ([]byte, error) {
+	req, err := http.NewRequest(MethodPut, url, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := SetAuthorization(req); err != nil {
+		return nil, err
+	}
+	var c = &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(seconds)*time.Second + time.Minute,
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, rsp.Body)
+		rsp.Body.Close()
+	}()
+
+	switch rsp.StatusCode {
+	case 200:
+		return responseBodyAsBytes(rsp)
+	case 401, 403, 800, 1500:
+		e, err := responseBodyAsError(rsp)
+		if err != nil {
+			return nil, err
+		}
+		return nil, e
+	default:
+		return nil, errors.Errorf("[%d] %s - %s", rsp.StatusCode, http.StatusText(rsp.StatusCode), url)
+	}
+}
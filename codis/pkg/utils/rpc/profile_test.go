@@ -0,0 +1,40 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package rpc
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestWriteProfile(t *testing.T) {
+	for _, kind := range []string{"heap", "goroutine", "block"} {
+		var b bytes.Buffer
+		assert.MustNoError(WriteProfile(&b, kind, 1))
+		assert.Must(b.Len() != 0)
+	}
+	assert.Must(WriteProfile(&bytes.Buffer{}, "trace", 1) != nil)
+
+	profiling.Set(MaxProfiles)
+	err := WriteProfile(&bytes.Buffer{}, "heap", 1)
+	profiling.Set(0)
+	assert.Must(err != nil && strings.Contains(err.Error(), ErrTooManyProfiles.Error()))
+
+	_, err = ParseProfileSeconds("0")
+	assert.Must(err != nil)
+	n, err := ParseProfileSeconds("")
+	assert.Must(err == nil && n == DefaultProfileSeconds)
+
+	w := httptest.NewRecorder()
+	ApiResponseProfile(w, "test", "goroutine", "1")
+	assert.Must(w.Code == 200 && w.Body.Len() != 0)
+	assert.Must(strings.HasPrefix(w.Header().Get("Content-Disposition"), `attachment; filename="test-goroutine-`))
+	w = httptest.NewRecorder()
+	ApiResponseProfile(w, "test", "goroutine", "x")
+	assert.Must(w.Code == 800)
+}
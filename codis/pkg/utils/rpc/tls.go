@@ -0,0 +1,109 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package rpc
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/tls2"
+)
+
+var apiTLS struct {
+	server *tls.Config
+}
+
+// SetupTLS enables mutual TLS of the admin API, for both the servers and the
+// clients of the process, with the certificate of the files. Peers must have
+// certificates signed by the CAs of the files, and if names isn't empty, with
+// the common name or one of the DNS names in names.
+func SetupTLS(files tls2.Files, names []string) error {
+	if files.CertFile == "" || files.KeyFile == "" || files.CAFile == "" {
+		return errors.New("certificate, key and ca files are required")
+	}
+	server, err := tls2.NewServerConfig(files, true)
+	if err != nil {
+		return err
+	}
+	client, err := tls2.NewClientConfig(files, "")
+	if err != nil {
+		return err
+	}
+	if len(names) != 0 {
+		var verify = client.VerifyConnection
+		client.VerifyConnection = func(cs tls.ConnectionState) error {
+			if err := verify(cs); err != nil {
+				return err
+			}
+			return verifyPeerName(cs, names)
+		}
+		var get = server.GetConfigForClient
+		server.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := get(hello)
+			if err != nil {
+				return nil, err
+			}
+			c.VerifyConnection = func(cs tls.ConnectionState) error {
+				return verifyPeerName(cs, names)
+			}
+			return c, nil
+		}
+	}
+	transport.TLSClientConfig = client
+	apiTLS.server = server
+	return nil
+}
+
+func verifyPeerName(cs tls.ConnectionState, names []string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no certificate of peer")
+	}
+	var cert = cs.PeerCertificates[0]
+	for _, name := range names {
+		if cert.Subject.CommonName == name {
+			return nil
+		}
+		for _, dns := range cert.DNSNames {
+			if dns == name {
+				return nil
+			}
+		}
+	}
+	return errors.Errorf("peer %q is not allowed", cert.Subject.CommonName)
+}
+
+// ParseNames splits the comma separated names.
+func ParseNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// NewListener serves the admin API with TLS if SetupTLS is called.
+func NewListener(l net.Listener) net.Listener {
+	if apiTLS.server == nil {
+		return l
+	}
+	return tls.NewListener(l, apiTLS.server)
+}
+
+// Scheme is the scheme of the admin API, "https" if SetupTLS is called.
+func Scheme() string {
+	if apiTLS.server == nil {
+		return "http"
+	}
+	return "https"
+}
+
+// ClientTLSConfig is the TLS config of the clients of the admin API, or nil
+// if SetupTLS isn't called.
+func ClientTLSConfig() *tls.Config {
+	return transport.TLSClientConfig
+}
@@ -0,0 +1,28 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func TestVerifyPeerName(t *testing.T) {
+	names := ParseNames(" codis-dashboard, ,codis-proxy")
+	assert.Must(len(names) == 2 && names[0] == "codis-dashboard" && names[1] == "codis-proxy")
+
+	peer := func(cn string, dns ...string) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: cn}, DNSNames: dns},
+		}}
+	}
+	assert.MustNoError(verifyPeerName(peer("codis-proxy"), names))
+	assert.MustNoError(verifyPeerName(peer("x", "codis-dashboard"), names))
+	assert.Must(verifyPeerName(peer("codis-fe"), names) != nil)
+	assert.Must(verifyPeerName(tls.ConnectionState{}, names) != nil)
+}
@@ -0,0 +1,219 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+)
+
+const (
+	RoleRead  = "read"
+	RoleAdmin = "admin"
+)
+
+const MinTokenSecretLen = 16
+
+// ClientTokenTTL is the expiry of the tokens signed by the clients of the
+// admin API for their own requests.
+const ClientTokenTTL = time.Minute * 5
+
+var (
+	ErrTokenRequired  = errors.New("token is required")
+	ErrTokenMalformed = errors.New("token is malformed")
+	ErrTokenSignature = errors.New("token signature is invalid")
+	ErrTokenExpired   = errors.New("token is expired")
+	ErrTokenRole      = errors.New("token role is not allowed")
+)
+
+// TokenClaims are the claims of a JWT signed with HS256.
+type TokenClaims struct {
+	Subject   string `json:"sub,omitempty"`
+	Role      string `json:"role"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func isValidRole(role string) bool {
+	return role == RoleRead || role == RoleAdmin
+}
+
+func tokenSignature(secret []byte, payload string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// IssueToken signs the claims as a JWT with the secret.
+func IssueToken(secret string, claims *TokenClaims) (string, error) {
+	if len(secret) < MinTokenSecretLen {
+		return "", errors.Errorf("token secret must have at least %d bytes", MinTokenSecretLen)
+	}
+	if !isValidRole(claims.Role) {
+		return "", errors.Errorf("invalid role '%s'", claims.Role)
+	}
+	if claims.ExpiresAt <= 0 {
+		return "", errors.New("token must have an expiry")
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	var payload = tokenHeader + "." + base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + tokenSignature([]byte(secret), payload), nil
+}
+
+// NewTokenClaims returns the claims of a token expiring after ttl.
+func NewTokenClaims(subject, role string, ttl time.Duration) *TokenClaims {
+	var now = time.Now()
+	return &TokenClaims{
+		Subject:   subject,
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
+
+// ParseToken verifies the signature and the expiry of the token, and returns
+// its claims.
+func ParseToken(secret string, token string) (*TokenClaims, error) {
+	segs := strings.Split(token, ".")
+	if len(segs) != 3 || segs[0] != tokenHeader {
+		return nil, ErrTokenMalformed
+	}
+	var payload = segs[0] + "." + segs[1]
+	if !hmac.Equal([]byte(segs[2]), []byte(tokenSignature([]byte(secret), payload))) {
+		return nil, ErrTokenSignature
+	}
+	b, err := base64.RawURLEncoding.DecodeString(segs[1])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	claims := &TokenClaims{}
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if !isValidRole(claims.Role) {
+		return nil, ErrTokenRole
+	}
+	if claims.ExpiresAt <= 0 || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+// apiToken is the secret to verify the tokens of requests to the admin API,
+// and to sign tokens of the requests sent by the clients of the process, or
+// the token given to the clients if the process doesn't know the secret.
+var apiToken struct {
+	sync.Mutex
+	secret  string
+	subject string
+
+	token  string
+	expire time.Time
+}
+
+// SetupToken requires tokens signed by the secret on the admin API served by
+// the process, and its clients sign admin tokens as the subject.
+func SetupToken(secret string, subject string) error {
+	if len(secret) < MinTokenSecretLen {
+		return errors.Errorf("token secret must have at least %d bytes", MinTokenSecretLen)
+	}
+	apiToken.Lock()
+	defer apiToken.Unlock()
+	apiToken.secret, apiToken.subject = secret, subject
+	apiToken.token, apiToken.expire = "", time.Time{}
+	return nil
+}
+
+// SetClientToken makes the clients of the process send the token issued
+// before, e.g. by codis-admin --issue-token.
+func SetClientToken(token string) {
+	apiToken.Lock()
+	defer apiToken.Unlock()
+	apiToken.token, apiToken.expire = token, time.Time{}
+}
+
+func clientToken() (string, error) {
+	apiToken.Lock()
+	defer apiToken.Unlock()
+	if apiToken.secret == "" {
+		return apiToken.token, nil
+	}
+	var now = time.Now()
+	if apiToken.token != "" && now.Add(ClientTokenTTL/2).Before(apiToken.expire) {
+		return apiToken.token, nil
+	}
+	claims := NewTokenClaims(apiToken.subject, RoleAdmin, ClientTokenTTL)
+	token, err := IssueToken(apiToken.secret, claims)
+	if err != nil {
+		return "", err
+	}
+	apiToken.token, apiToken.expire = token, time.Unix(claims.ExpiresAt, 0)
+	return token, nil
+}
+
+// SetAuthorization sets the token of the request sent to the admin API.
+func SetAuthorization(req *http.Request) error {
+	token, err := clientToken()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// VerifyRequest checks the token of the request if SetupToken is called,
+// tokens of role read are allowed to GET only. It returns the http status
+// code of the error.
+func VerifyRequest(req *http.Request) (int, error) {
+	apiToken.Lock()
+	var secret = apiToken.secret
+	apiToken.Unlock()
+	if secret == "" {
+		return http.StatusOK, nil
+	}
+	var auth = req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return http.StatusUnauthorized, ErrTokenRequired
+	}
+	claims, err := ParseToken(secret, strings.TrimSpace(auth[7:]))
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	switch {
+	case claims.Role == RoleAdmin:
+	case req.Method == MethodGet || req.Method == "HEAD":
+	default:
+		return http.StatusForbidden, ErrTokenRole
+	}
+	return http.StatusOK, nil
+}
+
+// ApiVerifyToken responds the error if the request isn't authorized, it's
+// used as a middleware of the admin API.
+func ApiVerifyToken(w http.ResponseWriter, req *http.Request) bool {
+	code, err := VerifyRequest(req)
+	if err == nil {
+		return true
+	}
+	_, body := ApiResponseError(err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write([]byte(body))
+	return false
+}
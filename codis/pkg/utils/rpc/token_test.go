@@ -0,0 +1,76 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+const testTokenSecret = "0123456789abcdef"
+
+func TestIssueToken(t *testing.T) {
+	token, err := IssueToken(testTokenSecret, NewTokenClaims("tool", RoleRead, time.Hour))
+	assert.MustNoError(err)
+
+	claims, err := ParseToken(testTokenSecret, token)
+	assert.MustNoError(err)
+	assert.Must(claims.Subject == "tool" && claims.Role == RoleRead)
+
+	_, err = ParseToken("fedcba9876543210", token)
+	assert.Must(err == ErrTokenSignature)
+	_, err = ParseToken(testTokenSecret, strings.Replace(token, ".", ".x", 1))
+	assert.Must(err == ErrTokenSignature)
+	_, err = ParseToken(testTokenSecret, "abc")
+	assert.Must(err == ErrTokenMalformed)
+
+	expired, err := IssueToken(testTokenSecret, NewTokenClaims("tool", RoleAdmin, -time.Second))
+	assert.MustNoError(err)
+	_, err = ParseToken(testTokenSecret, expired)
+	assert.Must(err == ErrTokenExpired)
+
+	_, err = IssueToken("short", NewTokenClaims("tool", RoleAdmin, time.Hour))
+	assert.Must(err != nil)
+	_, err = IssueToken(testTokenSecret, NewTokenClaims("tool", "root", time.Hour))
+	assert.Must(err != nil)
+}
+
+func TestVerifyRequest(t *testing.T) {
+	defer func() {
+		apiToken.secret, apiToken.token = "", ""
+	}()
+
+	request := func(method string, token string) int {
+		req := httptest.NewRequest(method, "/api/proxy/model", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		code, _ := VerifyRequest(req)
+		return code
+	}
+	assert.Must(request(MethodPut, "") == http.StatusOK)
+
+	assert.MustNoError(SetupToken(testTokenSecret, "codis-dashboard"))
+	assert.Must(request(MethodGet, "") == http.StatusUnauthorized)
+	assert.Must(request(MethodGet, "abc") == http.StatusUnauthorized)
+
+	read, err := IssueToken(testTokenSecret, NewTokenClaims("tool", RoleRead, time.Hour))
+	assert.MustNoError(err)
+	assert.Must(request(MethodGet, read) == http.StatusOK)
+	assert.Must(request(MethodPut, read) == http.StatusForbidden)
+
+	req := httptest.NewRequest(MethodPut, "/api/proxy/start", nil)
+	assert.MustNoError(SetAuthorization(req))
+	code, err := VerifyRequest(req)
+	assert.Must(code == http.StatusOK && err == nil)
+
+	w := httptest.NewRecorder()
+	assert.Must(!ApiVerifyToken(w, httptest.NewRequest(MethodGet, "/topom", nil)))
+	assert.Must(w.Code == http.StatusUnauthorized)
+}
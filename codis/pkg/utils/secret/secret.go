@@ -0,0 +1,273 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+// Package secret resolves the settings referring to secrets kept out of the
+// config files, e.g. in HashiCorp Vault, and refreshes them periodically.
+//
+// A reference is one of
+//
+//	vault:<path>#<field>   the field of the secret read from Vault
+//	file:<path>            the content of the file, e.g. written by a KMS agent
+//	env:<name>             the environment variable
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+// IsRef returns whether the setting refers to a secret.
+func IsRef(s string) bool {
+	for _, prefix := range []string{"vault:", "file:", "env:"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type binding struct {
+	name string
+	ref  string
+	file bool
+
+	value string
+}
+
+// Manager resolves the references of the bound settings, and refreshes them
+// until it's closed.
+type Manager struct {
+	mu    sync.Mutex
+	vault *Vault
+	dir   string
+	binds []*binding
+
+	leases map[string]*VaultSecret
+	exit   chan struct{}
+	once   sync.Once
+}
+
+// NewManager returns the manager, vault can be nil if no setting refers to
+// Vault.
+func NewManager(vault *Vault) *Manager {
+	return &Manager{
+		vault:  vault,
+		leases: make(map[string]*VaultSecret),
+		exit:   make(chan struct{}),
+	}
+}
+
+// Bind resolves the setting if it's a reference, and replaces it with the
+// secret. For a setting of file, the secret is written to a private file and
+// the setting is replaced with the path of the file.
+func (m *Manager) Bind(name string, setting *string, file bool) error {
+	if !IsRef(*setting) {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := &binding{name: name, ref: *setting, file: file}
+	value, err := m.resolve(b, make(map[string]*VaultSecret))
+	if err != nil {
+		return errors.Errorf("resolve %s failed: %s", name, err)
+	}
+	b.value = value
+	m.binds = append(m.binds, b)
+	*setting = value
+	log.Warnf("secret: resolve %s from %s", name, b.ref)
+	return nil
+}
+
+func (m *Manager) resolve(b *binding, read map[string]*VaultSecret) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(b.ref, "vault:"):
+		if m.vault == nil {
+			return "", errors.New("vault isn't configured")
+		}
+		var path, field = b.ref[len("vault:"):], ""
+		if i := strings.LastIndexByte(path, '#'); i >= 0 {
+			path, field = path[:i], path[i+1:]
+		}
+		if path == "" || field == "" {
+			return "", errors.Errorf("invalid reference '%s'", b.ref)
+		}
+		s := read[path]
+		if s == nil {
+			var err error
+			if s, err = m.vault.Read(path); err != nil {
+				return "", err
+			}
+			read[path] = s
+			m.leases[path] = s
+		}
+		v, err := s.Field(field)
+		if err != nil {
+			return "", err
+		}
+		value = v
+	case strings.HasPrefix(b.ref, "file:"):
+		var path = b.ref[len("file:"):]
+		if b.file {
+			return path, nil
+		}
+		c, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		value = strings.TrimSpace(string(c))
+	case strings.HasPrefix(b.ref, "env:"):
+		v, ok := os.LookupEnv(b.ref[len("env:"):])
+		if !ok {
+			return "", errors.Errorf("environment variable of '%s' not found", b.ref)
+		}
+		value = v
+	}
+	if b.file {
+		return m.writeFile(b.name, value)
+	}
+	return value, nil
+}
+
+// writeFile replaces the file of the secret atomically, and keeps it if the
+// content isn't changed, so that watchers of the file see a new mtime only
+// if the secret is changed.
+func (m *Manager) writeFile(name, value string) (string, error) {
+	if m.dir == "" {
+		dir, err := ioutil.TempDir("", "codis-secret-")
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		m.dir = dir
+	}
+	var path = filepath.Join(m.dir, name)
+	if c, err := ioutil.ReadFile(path); err == nil && string(c) == value {
+		return path, nil
+	}
+	f, err := ioutil.TempFile(m.dir, name+".tmp")
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return "", errors.Trace(err)
+	}
+	if err := f.Close(); err != nil {
+		return "", errors.Trace(err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", errors.Trace(err)
+	}
+	return path, nil
+}
+
+// Start refreshes the secrets every period, or before the leases of the
+// secrets of Vault expire if sooner. onChange is called with the new value
+// of each setting changed, files of secrets are rewritten before that.
+func (m *Manager) Start(period time.Duration, onChange func(name, value string)) {
+	m.mu.Lock()
+	var n = len(m.binds)
+	m.mu.Unlock()
+	if n == 0 || period <= 0 {
+		return
+	}
+	go func() {
+		for {
+			var wait = m.nextRefresh(period)
+			select {
+			case <-m.exit:
+				return
+			case <-time.After(wait):
+			}
+			for _, c := range m.refresh() {
+				if onChange != nil {
+					onChange(c.name, c.value)
+				}
+			}
+		}
+	}()
+}
+
+func (m *Manager) nextRefresh(period time.Duration) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var wait = period
+	for _, s := range m.leases {
+		if s.LeaseDuration <= 0 {
+			continue
+		}
+		if d := time.Duration(s.LeaseDuration) * time.Second / 2; d < wait {
+			wait = d
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+type change struct {
+	name, value string
+}
+
+// refresh renews the token and the renewable leases of Vault, and resolves
+// all settings again. It returns the settings changed.
+func (m *Manager) refresh() []change {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var read = make(map[string]*VaultSecret)
+	if m.vault != nil {
+		if err := m.vault.RenewToken(); err != nil {
+			log.WarnErrorf(err, "secret: renew vault token failed")
+		}
+		for path, s := range m.leases {
+			if !s.Renewable || s.LeaseID == "" {
+				continue
+			}
+			if err := m.vault.RenewLease(s.LeaseID); err != nil {
+				log.WarnErrorf(err, "secret: renew lease of %s failed, read again", path)
+				continue
+			}
+			read[path] = s
+		}
+	}
+
+	var changes []change
+	for _, b := range m.binds {
+		value, err := m.resolve(b, read)
+		if err != nil {
+			log.WarnErrorf(err, "secret: refresh %s failed, keep the last one", b.name)
+			continue
+		}
+		if value == b.value {
+			continue
+		}
+		b.value = value
+		log.Warnf("secret: %s is changed", b.name)
+		changes = append(changes, change{b.name, value})
+	}
+	return changes
+}
+
+// Close stops refreshing and removes the files of secrets.
+func (m *Manager) Close() {
+	m.once.Do(func() {
+		close(m.exit)
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dir != "" {
+		os.RemoveAll(m.dir)
+		m.dir = ""
+	}
+}
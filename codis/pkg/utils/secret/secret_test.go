@@ -0,0 +1,91 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package secret
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func newFakeVault(data map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/secret/data/codis":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"lease_duration": 0,
+				"data":           map[string]interface{}{"data": data, "metadata": map[string]interface{}{}},
+			})
+		case "/v1/auth/token/renew-self":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestManager(t *testing.T) {
+	var data = map[string]interface{}{"product_auth": "auth-1", "tls_key": "key-1"}
+	server := newFakeVault(data)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "codis-secret-test-")
+	assert.MustNoError(err)
+	defer os.RemoveAll(dir)
+	var tokenFile = filepath.Join(dir, "token")
+	assert.MustNoError(ioutil.WriteFile(tokenFile, []byte("s.token\n"), 0600))
+
+	vault, err := NewVault(server.URL, tokenFile, "", "")
+	assert.MustNoError(err)
+	m := NewManager(vault)
+	defer m.Close()
+
+	var auth = "vault:secret/data/codis#product_auth"
+	assert.MustNoError(m.Bind("product_auth", &auth, false))
+	assert.Must(auth == "auth-1")
+
+	var key = "vault:secret/data/codis#tls_key"
+	assert.MustNoError(m.Bind("tls_key", &key, true))
+	b, err := ioutil.ReadFile(key)
+	assert.MustNoError(err)
+	assert.Must(string(b) == "key-1")
+
+	os.Setenv("CODIS_SECRET_TEST", "env-1")
+	defer os.Unsetenv("CODIS_SECRET_TEST")
+	var env = "env:CODIS_SECRET_TEST"
+	assert.MustNoError(m.Bind("session_auth", &env, false))
+	assert.Must(env == "env-1")
+
+	var plain = "plain"
+	assert.MustNoError(m.Bind("plain", &plain, false))
+	assert.Must(plain == "plain")
+
+	var missing = "vault:secret/data/codis#missing"
+	assert.Must(m.Bind("missing", &missing, false) != nil)
+	var denied = "vault:secret/data/other#x"
+	assert.Must(m.Bind("denied", &denied, false) != nil)
+
+	data["product_auth"], data["tls_key"] = "auth-2", "key-2"
+	changes := m.refresh()
+	assert.Must(len(changes) == 1 && changes[0].name == "product_auth" && changes[0].value == "auth-2")
+	b, err = ioutil.ReadFile(key)
+	assert.MustNoError(err)
+	assert.Must(string(b) == "key-2")
+
+	m.Close()
+	_, err = os.Stat(key)
+	assert.Must(os.IsNotExist(err))
+}
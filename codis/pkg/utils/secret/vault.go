@@ -0,0 +1,145 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/tls2"
+)
+
+// Vault is a client of the HTTP API of HashiCorp Vault.
+type Vault struct {
+	Addr      string
+	Token     string
+	Namespace string
+
+	client *http.Client
+}
+
+// NewVault returns the client of the vault at addr. The token is read from
+// tokenFile if given, or else from the environment variable VAULT_TOKEN, and
+// the server is verified by the CAs of caFile if given.
+func NewVault(addr, tokenFile, namespace, caFile string) (*Vault, error) {
+	var token = os.Getenv("VAULT_TOKEN")
+	if tokenFile != "" {
+		b, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token == "" {
+		return nil, errors.New("vault token is required")
+	}
+	tr := &http.Transport{}
+	if caFile != "" {
+		c, err := tls2.NewClientConfig(tls2.Files{CAFile: caFile}, "")
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig = c
+	}
+	return &Vault{
+		Addr: strings.TrimSuffix(addr, "/"), Token: token, Namespace: namespace,
+		client: &http.Client{Transport: tr, Timeout: time.Second * 10},
+	}, nil
+}
+
+// VaultSecret is the response of a read, the data of KV version 2 engines
+// is unwrapped.
+type VaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+func (v *Vault) request(method, path string, args interface{}) (*VaultSecret, error) {
+	var body io.Reader
+	if args != nil {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, v.Addr+"/v1/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	rsp, err := v.client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(b, &e)
+		return nil, errors.Errorf("vault %s %s: [%d] %s", method, path, rsp.StatusCode, strings.Join(e.Errors, "; "))
+	}
+	s := &VaultSecret{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s, nil
+}
+
+// Read reads the secret at the path, e.g. "secret/data/codis".
+func (v *Vault) Read(path string) (*VaultSecret, error) {
+	s, err := v.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := s.Data["data"].(map[string]interface{}); ok {
+		if _, ok := s.Data["metadata"]; ok {
+			s.Data = data
+		}
+	}
+	return s, nil
+}
+
+// Field returns the field of the secret as a string.
+func (s *VaultSecret) Field(name string) (string, error) {
+	switch v := s.Data[name].(type) {
+	case nil:
+		return "", errors.Errorf("field '%s' not found", name)
+	case string:
+		return v, nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// RenewToken renews the lease of the token of the client.
+func (v *Vault) RenewToken() error {
+	_, err := v.request("POST", "auth/token/renew-self", map[string]interface{}{})
+	return err
+}
+
+// RenewLease renews the lease of a dynamic secret.
+func (v *Vault) RenewLease(leaseID string) error {
+	_, err := v.request("PUT", "sys/leases/renew", map[string]interface{}{"lease_id": leaseID})
+	return err
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"pika/codis/v2/pkg/utils/errors"
@@ -72,8 +73,13 @@ var (
 
 var ErrBadTimeSize = errors.New("invalid timesize")
 
+// Parse parses the time size, e.g. "10", "1.5", "500ms" or "1m30s" as of
+// time.Duration.String, the unit is second if omitted.
 func Parse(s string) (time.Duration, error) {
 	if !fullRegexp.MatchString(s) {
+		if d, err := time.ParseDuration(strings.TrimSpace(s)); err == nil {
+			return d, nil
+		}
 		return 0, errors.Trace(ErrBadTimeSize)
 	}
 
@@ -33,4 +33,9 @@ func TestTimeSize(t *testing.T) {
 	assert.Must(MustParse(" 1.5 h ") == time.Duration(1.5*float64(time.Hour)))
 	assert.Must(MustParse(" 1.5 ms ") == time.Duration(1.5*float64(time.Millisecond)))
 	assert.Must(MustParse(" 1.5 us ") == time.Duration(1.5*float64(time.Microsecond)))
+
+	assert.Must(MustParse("30m0s") == 30*time.Minute)
+	assert.Must(MustParse(" 1h30m ") == 90*time.Minute)
+	_, err := Parse("1x30m")
+	assert.Must(err != nil)
 }
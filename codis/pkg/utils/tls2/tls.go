@@ -0,0 +1,177 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package tls2
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"pika/codis/v2/pkg/utils/errors"
+	"pika/codis/v2/pkg/utils/log"
+)
+
+// ReloadInterval is the min interval to check whether the files are changed.
+var ReloadInterval = time.Second
+
+// Files are the PEM files of a certificate and its key, and of the CAs to
+// verify the peers, each of which may be empty.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+type loaded struct {
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+// reloader loads the files again once they're modified, and keeps the last
+// good ones if the new ones are broken.
+type reloader struct {
+	mu    sync.Mutex
+	files Files
+
+	last    loaded
+	modTime time.Time
+	checked time.Time
+}
+
+func (r *reloader) modified() time.Time {
+	var t time.Time
+	for _, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if name == "" {
+			continue
+		}
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return t
+}
+
+func (r *reloader) load() (loaded, error) {
+	var l loaded
+	if r.files.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return l, errors.Trace(err)
+		}
+		l.cert = &cert
+	}
+	if r.files.CAFile != "" {
+		b, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return l, errors.Trace(err)
+		}
+		l.pool = x509.NewCertPool()
+		if !l.pool.AppendCertsFromPEM(b) {
+			return l, errors.Errorf("no certificate found in %s", r.files.CAFile)
+		}
+	}
+	return l, nil
+}
+
+func (r *reloader) get() loaded {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) < ReloadInterval {
+		return r.last
+	}
+	r.checked = time.Now()
+	if t := r.modified(); !t.Equal(r.modTime) {
+		l, err := r.load()
+		if err != nil {
+			log.WarnErrorf(err, "reload tls files %+v failed", r.files)
+			return r.last
+		}
+		log.Warnf("reload tls files %+v", r.files)
+		r.last, r.modTime = l, t
+	}
+	return r.last
+}
+
+func newReloader(files Files) (*reloader, error) {
+	r := &reloader{files: files}
+	l, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.last, r.modTime, r.checked = l, r.modified(), time.Now()
+	return r, nil
+}
+
+// NewServerConfig returns the config of a TLS listener with the certificate
+// of the files, which requires and verifies the certificates of the clients
+// by the CAs if clientAuth is true.
+func NewServerConfig(files Files, clientAuth bool) (*tls.Config, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("certificate and key files are required")
+	}
+	r, err := newReloader(files)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			l := r.get()
+			c := &tls.Config{
+				Certificates: []tls.Certificate{*l.cert},
+				MinVersion:   tls.VersionTLS12,
+			}
+			if clientAuth {
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+				c.ClientCAs = l.pool
+			}
+			return c, nil
+		},
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// NewClientConfig returns the config of TLS connections to servers, with the
+// certificate of the files if any. The servers are verified by the CAs of the
+// files only if given, or else by the CAs of the host. serverName is sent as
+// SNI and verified, or the host of the address dialed if empty.
+func NewClientConfig(files Files, serverName string) (*tls.Config, error) {
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, errors.New("certificate and key files must be set together")
+	}
+	r, err := newReloader(files)
+	if err != nil {
+		return nil, err
+	}
+	c := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if files.CertFile != "" {
+		c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.get().cert, nil
+		}
+	}
+	if files.CAFile != "" {
+		// Verified by VerifyConnection instead, with the CAs reloaded.
+		c.InsecureSkipVerify = true
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no certificate of server")
+			}
+			opts := x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         r.get().pool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package tls2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pika/codis/v2/pkg/utils/assert"
+)
+
+func writeTestCert(dir, name string) (cert, key string) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.MustNoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	assert.MustNoError(err)
+	b, err := x509.MarshalECPrivateKey(k)
+	assert.MustNoError(err)
+
+	cert, key = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.MustNoError(os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.MustNoError(os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600))
+	return cert, key
+}
+
+func handshake(c *tls.Config) string {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", c)
+	assert.MustNoError(err)
+	defer l.Close()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	assert.MustNoError(err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestServerConfigReload(t *testing.T) {
+	saved := ReloadInterval
+	defer func() {
+		ReloadInterval = saved
+	}()
+	ReloadInterval = 0
+
+	dir := t.TempDir()
+	cert, key := writeTestCert(dir, "first")
+	c, err := NewServerConfig(Files{CertFile: cert, KeyFile: key}, false)
+	assert.MustNoError(err)
+	assert.Must(handshake(c) == "first")
+
+	writeTestCert(dir, "second")
+	future := time.Now().Add(time.Minute)
+	assert.MustNoError(os.Chtimes(cert, future, future))
+	assert.Must(handshake(c) == "second")
+
+	assert.MustNoError(os.WriteFile(key, []byte("broken"), 0600))
+	future = future.Add(time.Minute)
+	assert.MustNoError(os.Chtimes(key, future, future))
+	assert.Must(handshake(c) == "second")
+
+	_, err = NewServerConfig(Files{}, false)
+	assert.Must(err != nil)
+}
+
+func TestClientConfigPinning(t *testing.T) {
+	cert, key := writeTestCert(t.TempDir(), "server")
+	other, _ := writeTestCert(t.TempDir(), "other")
+
+	s, err := NewServerConfig(Files{CertFile: cert, KeyFile: key}, false)
+	assert.MustNoError(err)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", s)
+	assert.MustNoError(err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+
+	dial := func(ca string) error {
+		c, err := NewClientConfig(Files{CAFile: ca}, "127.0.0.1")
+		assert.MustNoError(err)
+		conn, err := tls.Dial("tcp", l.Addr().String(), c)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	assert.MustNoError(dial(cert))
+	assert.Must(dial(other) != nil)
+}